@@ -5,5 +5,15 @@ go 1.20
 require (
 	github.com/mattn/go-sqlite3 v1.14.17
 	github.com/robfig/cron v1.2.0
+	github.com/yuin/gopher-lua v1.1.1
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+	golang.org/x/crypto v0.23.0
+	golang.org/x/sys v0.20.0
 	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/text v0.15.0 // indirect
 )
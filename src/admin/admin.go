@@ -0,0 +1,99 @@
+package admin
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"xserver/src/config"
+)
+
+const (
+	// KeyEnv is the environment variable with the api key of the admin commands user, admin.token is used without it.
+	KeyEnv = "XSERVER_ADMIN_KEY"
+)
+
+func Url(config *config.Config, path string) string {
+	url := config.Url
+	if strings.HasPrefix(url, ":") {
+		url = "localhost" + url
+	}
+	return config.Scheme() + "://" + url + path
+}
+
+// loopback reports whether the server url host is the local machine, certificates of local servers aren't verified.
+func loopback(config *config.Config) bool {
+	host, _, err := net.SplitHostPort(config.Url)
+	if err != nil {
+		return false
+	}
+	if host == "" || host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func Request(config *config.Config, path string, body interface{}) ([]byte, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Admin] [Error] failed encode request: %s", err)
+	}
+
+	status, responseData, err := Call(config, http.MethodPost, path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("[XServer] [Admin] [Error] server responded with %d: %s", status, strings.TrimSpace(string(responseData)))
+	}
+
+	return responseData, nil
+}
+
+// Call sends the request with the admin key to the server and returns the response of any status.
+func Call(config *config.Config, method string, path string, body []byte) (int, []byte, error) {
+	return CallHost(config, "", method, path, body)
+}
+
+// CallHost sends the request with the Host header of the virtual host, the server url host is sent without it.
+func CallHost(config *config.Config, host string, method string, path string, body []byte) (int, []byte, error) {
+	request, err := http.NewRequest(method, Url(config, path), bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, fmt.Errorf("[XServer] [Admin] [Error] failed create request: %s", err)
+	}
+	if host != "" {
+		request.Host = host
+	}
+	request.Header.Set("Content-Type", "application/json")
+	token := config.Admin.Token
+	if key := os.Getenv(KeyEnv); key != "" {
+		token = key
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	if config.TlsEnabled() && loopback(config) {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, nil, fmt.Errorf("[XServer] [Admin] [Error] failed request server: %s", err)
+	}
+	defer response.Body.Close()
+
+	responseData, err := io.ReadAll(response.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("[XServer] [Admin] [Error] failed read response: %s", err)
+	}
+	return response.StatusCode, responseData, nil
+}
@@ -1,23 +1,74 @@
 package builders
 
 import (
+	"fmt"
+	"os"
 	"os/exec"
+	"runtime"
+	"strings"
 )
 
+func ExecutableName(name string) string {
+	if runtime.GOOS == "windows" {
+		return name + ".exe"
+	}
+	return name
+}
+
 func Tool(tool string, filePath string, outputPath string, flags ...string) error {
 	cmdArguments := append(flags, []string{"-o", outputPath, filePath}...)
 	cmd := exec.Command(tool, cmdArguments...)
-	if err := cmd.Run(); err != nil {
-		return err
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(output)))
 	}
 	return nil
 }
 
-func Go(filePath string, outputPath string, flags ...string) error {
+func Go(tool string, filePath string, outputPath string, flags ...string) error {
 	cmdArguments := append([]string{"build"}, flags...)
-	return Tool("go", filePath, outputPath, cmdArguments...)
+	return Tool(tool, filePath, outputPath, cmdArguments...)
+}
+
+func Cpp(tool string, filePath string, outputPath string, flags ...string) error {
+	return Tool(tool, filePath, outputPath, flags...)
+}
+
+func Plugin(tool string, filePath string, outputPath string, flags ...string) error {
+	cmdArguments := append([]string{"build", "-buildmode=plugin"}, flags...)
+	return Tool(tool, filePath, outputPath, cmdArguments...)
+}
+
+func ExpandTemplate(template string, sourcePath string, outputPath string, args []string) []string {
+	command := []string{}
+	for _, field := range strings.Fields(template) {
+		if field == "{args}" {
+			command = append(command, args...)
+			continue
+		}
+		field = strings.ReplaceAll(field, "{source}", sourcePath)
+		field = strings.ReplaceAll(field, "{output}", outputPath)
+		command = append(command, field)
+	}
+	return command
+}
+
+func Template(template string, filePath string, outputPath string, flags ...string) error {
+	command := ExpandTemplate(template, filePath, outputPath, flags)
+	if len(command) == 0 {
+		return fmt.Errorf("build command is empty")
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
 }
 
-func Cpp(filePath string, outputPath string, flags ...string) error {
-	return Tool("go", filePath, outputPath, flags...)
+func Hook(command string, env []string) ([]byte, error) {
+	cmd := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	}
+	cmd.Env = append(os.Environ(), env...)
+	return cmd.CombinedOutput()
 }
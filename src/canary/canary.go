@@ -0,0 +1,170 @@
+package canary
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	StateRunning    = "running"
+	StatePassed     = "passed"
+	StateRolledBack = "rolled_back"
+)
+
+type Thresholds struct {
+	Window       time.Duration
+	MaxErrorRate float64
+	MaxLatency   time.Duration
+	MinRequests  int
+}
+
+type Status struct {
+	Handler          string    `json:"handler"`
+	Variant          string    `json:"variant"`
+	Percent          int       `json:"percent"`
+	State            string    `json:"state"`
+	Reason           string    `json:"reason,omitempty"`
+	StartedAt        time.Time `json:"started_at"`
+	Requests         int       `json:"requests"`
+	Errors           int       `json:"errors"`
+	AverageLatencyMs float64   `json:"average_latency_ms"`
+}
+
+type canary struct {
+	status  Status
+	latency time.Duration
+	timer   *time.Timer
+}
+
+type Canaries struct {
+	mutex      sync.Mutex
+	thresholds Thresholds
+	canaries   map[string]*canary
+	onFinished func(status Status)
+}
+
+// Create creates canaries monitor, onFinished is called once the canary is passed or rolled back.
+func Create(thresholds Thresholds, onFinished func(status Status)) *Canaries {
+	return &Canaries{
+		thresholds: thresholds,
+		canaries:   map[string]*canary{},
+		onFinished: onFinished,
+	}
+}
+
+func (canaries *Canaries) Start(handler string, variant string, percent int) {
+	canaries.mutex.Lock()
+	defer canaries.mutex.Unlock()
+
+	if previous, ok := canaries.canaries[handler]; ok && previous.timer != nil {
+		previous.timer.Stop()
+	}
+
+	current := &canary{
+		status: Status{
+			Handler:   handler,
+			Variant:   variant,
+			Percent:   percent,
+			State:     StateRunning,
+			StartedAt: time.Now(),
+		},
+	}
+	current.timer = time.AfterFunc(canaries.thresholds.Window, func() { canaries.finish(current, true) })
+	canaries.canaries[handler] = current
+}
+
+// exceeded returns the reason the canary exceeds thresholds, checkMinimum skips canaries without enough requests.
+func (canaries *Canaries) exceeded(current *canary, checkMinimum bool) string {
+	status := current.status
+	if status.Requests == 0 || (checkMinimum && status.Requests < canaries.thresholds.MinRequests) {
+		return ""
+	}
+
+	errorRate := float64(status.Errors) / float64(status.Requests)
+	if errorRate > canaries.thresholds.MaxErrorRate {
+		return fmt.Sprintf("error rate %.2f exceeds %.2f", errorRate, canaries.thresholds.MaxErrorRate)
+	}
+
+	latency := current.latency / time.Duration(status.Requests)
+	if canaries.thresholds.MaxLatency > 0 && latency > canaries.thresholds.MaxLatency {
+		return fmt.Sprintf("average latency %s exceeds %s", latency, canaries.thresholds.MaxLatency)
+	}
+	return ""
+}
+
+func (canaries *Canaries) finish(current *canary, windowElapsed bool) {
+	canaries.mutex.Lock()
+	if current.status.State != StateRunning {
+		canaries.mutex.Unlock()
+		return
+	}
+
+	reason := canaries.exceeded(current, !windowElapsed)
+	switch {
+	case reason != "":
+		current.status.State = StateRolledBack
+		current.status.Reason = reason
+		current.timer.Stop()
+	case windowElapsed:
+		current.status.State = StatePassed
+	default:
+		canaries.mutex.Unlock()
+		return
+	}
+	status := current.status
+	canaries.mutex.Unlock()
+
+	canaries.onFinished(status)
+}
+
+// Record adds the result of the request routed from the handler to the canary variant.
+func (canaries *Canaries) Record(handler string, duration time.Duration, failed bool) {
+	canaries.mutex.Lock()
+	current, ok := canaries.canaries[handler]
+	if !ok || current.status.State != StateRunning {
+		canaries.mutex.Unlock()
+		return
+	}
+
+	current.status.Requests++
+	if failed {
+		current.status.Errors++
+	}
+	current.latency += duration
+	current.status.AverageLatencyMs = float64(current.latency.Microseconds()) / 1000 / float64(current.status.Requests)
+	canaries.mutex.Unlock()
+
+	canaries.finish(current, false)
+}
+
+func (canaries *Canaries) Rollback(handler string, reason string) error {
+	canaries.mutex.Lock()
+	current, ok := canaries.canaries[handler]
+	if !ok || current.status.State != StateRunning {
+		canaries.mutex.Unlock()
+		return fmt.Errorf(`[XServer] [Canary] [Error] no running canary of "%s" handler`, handler)
+	}
+
+	current.timer.Stop()
+	current.status.State = StateRolledBack
+	current.status.Reason = reason
+	status := current.status
+	canaries.mutex.Unlock()
+
+	canaries.onFinished(status)
+	return nil
+}
+
+func (canaries *Canaries) List() []Status {
+	canaries.mutex.Lock()
+	defer canaries.mutex.Unlock()
+
+	result := []Status{}
+	for _, current := range canaries.canaries {
+		result = append(result, current.status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Handler < result[j].Handler })
+	return result
+}
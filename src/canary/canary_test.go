@@ -0,0 +1,89 @@
+package canary
+
+import (
+	"testing"
+	"time"
+)
+
+func waitFinished(t *testing.T, finished chan Status) Status {
+	t.Helper()
+	select {
+	case status := <-finished:
+		return status
+	case <-time.After(5 * time.Second):
+		t.Fatal("canary is not finished")
+	}
+	return Status{}
+}
+
+func TestCanary(t *testing.T) {
+	tests := []struct {
+		name     string
+		requests []time.Duration
+		failed   int
+		state    string
+	}{
+		{name: "passed", requests: []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond}, state: StatePassed},
+		{name: "error rate", requests: []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond}, failed: 2, state: StateRolledBack},
+		{name: "latency", requests: []time.Duration{time.Second, time.Second, time.Second}, state: StateRolledBack},
+		{name: "without requests", state: StatePassed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			finished := make(chan Status, 1)
+			canaries := Create(Thresholds{Window: 100 * time.Millisecond, MaxErrorRate: 0.5, MaxLatency: 100 * time.Millisecond, MinRequests: 3}, func(status Status) {
+				finished <- status
+			})
+			canaries.Start("users", "users_v2", 10)
+			for index, duration := range test.requests {
+				canaries.Record("users", duration, index < test.failed)
+			}
+
+			status := waitFinished(t, finished)
+			if status.State != test.state || status.Handler != "users" || status.Variant != "users_v2" || status.Requests != len(test.requests) {
+				t.Fatalf("unexpected status %+v", status)
+			}
+			if (status.Reason != "") != (test.state == StateRolledBack) {
+				t.Fatalf("unexpected reason %q", status.Reason)
+			}
+		})
+	}
+}
+
+func TestMinRequests(t *testing.T) {
+	finished := make(chan Status, 1)
+	canaries := Create(Thresholds{Window: time.Hour, MaxErrorRate: 0.1, MinRequests: 3}, func(status Status) {
+		finished <- status
+	})
+	canaries.Start("users", "users_v2", 10)
+	canaries.Record("users", time.Millisecond, true)
+	canaries.Record("users", time.Millisecond, true)
+	if list := canaries.List(); len(list) != 1 || list[0].State != StateRunning || list[0].Errors != 2 {
+		t.Fatalf("canary must run until min requests, got %+v", list)
+	}
+	canaries.Record("users", time.Millisecond, true)
+	if status := waitFinished(t, finished); status.State != StateRolledBack {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	finished := make(chan Status, 1)
+	canaries := Create(Thresholds{Window: time.Hour}, func(status Status) {
+		finished <- status
+	})
+	if err := canaries.Rollback("users", "manual"); err == nil {
+		t.Fatal("rollback without running canary must fail")
+	}
+	canaries.Start("users", "users_v2", 10)
+	if err := canaries.Rollback("users", "manual"); err != nil {
+		t.Fatal(err)
+	}
+	if status := waitFinished(t, finished); status.State != StateRolledBack || status.Reason != "manual" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	canaries.Record("users", time.Millisecond, true)
+	if err := canaries.Rollback("users", "manual"); err == nil {
+		t.Fatal("finished canary must not be rolled back again")
+	}
+}
@@ -0,0 +1,339 @@
+package cbor
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	ContentType = "application/cbor"
+
+	majorUnsigned = 0
+	majorNegative = 1
+	majorBytes    = 2
+	majorText     = 3
+	majorArray    = 4
+	majorMap      = 5
+	majorTag      = 6
+
+	indefinite = 31
+	breakCode  = 0xff
+
+	// maxDepth is the max nesting of decoded arrays, maps and tags.
+	maxDepth = 100
+)
+
+var (
+	errTruncated = errors.New("truncated cbor value")
+	errBreak     = errors.New("unexpected cbor break")
+)
+
+// Is reports whether the media type is cbor.
+func Is(mediaType string) bool {
+	return mediaType == ContentType
+}
+
+// Marshal encodes the decoded json value, json numbers are integers when they are whole, map keys are sorted.
+func Marshal(value interface{}) ([]byte, error) {
+	return appendValue(nil, value)
+}
+
+func appendHead(data []byte, major byte, argument uint64) []byte {
+	major <<= 5
+	switch {
+	case argument < 24:
+		return append(data, major|byte(argument))
+	case argument <= math.MaxUint8:
+		return append(data, major|24, byte(argument))
+	case argument <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(data, major|25), uint16(argument))
+	case argument <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(data, major|26), uint32(argument))
+	default:
+		return binary.BigEndian.AppendUint64(append(data, major|27), argument)
+	}
+}
+
+func appendInt(data []byte, value int64) []byte {
+	if value >= 0 {
+		return appendHead(data, majorUnsigned, uint64(value))
+	}
+	return appendHead(data, majorNegative, uint64(-1-value))
+}
+
+func appendValue(data []byte, value interface{}) ([]byte, error) {
+	switch value := value.(type) {
+	case nil:
+		return append(data, 0xf6), nil
+	case bool:
+		if value {
+			return append(data, 0xf5), nil
+		}
+		return append(data, 0xf4), nil
+	case int:
+		return appendInt(data, int64(value)), nil
+	case int64:
+		return appendInt(data, value), nil
+	case float64:
+		return binary.BigEndian.AppendUint64(append(data, 0xfb), math.Float64bits(value)), nil
+	case json.Number:
+		if number, err := value.Int64(); err == nil {
+			return appendInt(data, number), nil
+		}
+		number, err := value.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendValue(data, number)
+	case string:
+		return append(appendHead(data, majorText, uint64(len(value))), value...), nil
+	case []byte:
+		return append(appendHead(data, majorBytes, uint64(len(value))), value...), nil
+	case []interface{}:
+		data = appendHead(data, majorArray, uint64(len(value)))
+		for _, item := range value {
+			var err error
+			if data, err = appendValue(data, item); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	case map[string]interface{}:
+		keys := []string{}
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		data = appendHead(data, majorMap, uint64(len(value)))
+		for _, key := range keys {
+			data = append(appendHead(data, majorText, uint64(len(key))), key...)
+			var err error
+			if data, err = appendValue(data, value[key]); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported cbor value %T", value)
+	}
+}
+
+// Unmarshal decodes the value as json would, byte strings are strings, map keys are formatted as strings, tags are skipped.
+func Unmarshal(data []byte) (interface{}, error) {
+	decoder := &decoder{data: data}
+	value, err := decoder.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoder.data) != 0 {
+		return nil, errors.New("trailing data after cbor value")
+	}
+	return value, nil
+}
+
+type decoder struct {
+	data []byte
+}
+
+func (decoder *decoder) take(size uint64) ([]byte, error) {
+	if uint64(len(decoder.data)) < size {
+		return nil, errTruncated
+	}
+	result := decoder.data[:size]
+	decoder.data = decoder.data[size:]
+	return result, nil
+}
+
+// head reads the major type and the argument of the item, indefinite lengths are reported by the flag.
+func (decoder *decoder) head() (byte, uint64, bool, error) {
+	data, err := decoder.take(1)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), false, nil
+	case info == indefinite:
+		return major, 0, true, nil
+	case info > 27:
+		return 0, 0, false, fmt.Errorf("invalid cbor additional info %d", info)
+	}
+	size := uint64(1) << (info - 24)
+	if data, err = decoder.take(size); err != nil {
+		return 0, 0, false, err
+	}
+	switch size {
+	case 1:
+		return major, uint64(data[0]), false, nil
+	case 2:
+		return major, uint64(binary.BigEndian.Uint16(data)), false, nil
+	case 4:
+		return major, uint64(binary.BigEndian.Uint32(data)), false, nil
+	default:
+		return major, binary.BigEndian.Uint64(data), false, nil
+	}
+}
+
+func (decoder *decoder) atBreak() bool {
+	if len(decoder.data) != 0 && decoder.data[0] == breakCode {
+		decoder.data = decoder.data[1:]
+		return true
+	}
+	return false
+}
+
+func (decoder *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("cbor value exceeds %d nesting levels", maxDepth)
+	}
+	if len(decoder.data) != 0 {
+		switch decoder.data[0] {
+		case breakCode:
+			return nil, errBreak
+		case 0xf9, 0xfa, 0xfb:
+			return decoder.float()
+		}
+	}
+	major, argument, indefiniteLength, err := decoder.head()
+	if err != nil {
+		return nil, err
+	}
+	if indefiniteLength && (major == majorUnsigned || major == majorNegative || major == majorTag) {
+		return nil, fmt.Errorf("invalid indefinite length of cbor major type %d", major)
+	}
+
+	switch major {
+	case majorUnsigned:
+		if argument > math.MaxInt64 {
+			return float64(argument), nil
+		}
+		return int64(argument), nil
+	case majorNegative:
+		if argument > math.MaxInt64 {
+			return -1 - float64(argument), nil
+		}
+		return -1 - int64(argument), nil
+	case majorBytes, majorText:
+		if !indefiniteLength {
+			data, err := decoder.take(argument)
+			return string(data), err
+		}
+		text := []byte{}
+		for !decoder.atBreak() {
+			chunk, err := decoder.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			part, ok := chunk.(string)
+			if !ok {
+				return nil, errors.New("invalid chunk of indefinite length cbor string")
+			}
+			text = append(text, part...)
+		}
+		return string(text), nil
+	case majorArray:
+		// every item takes one byte at least, longer lengths are truncated values
+		if argument > uint64(len(decoder.data)) {
+			return nil, errTruncated
+		}
+		result := []interface{}{}
+		for i := uint64(0); indefiniteLength || i < argument; i++ {
+			if indefiniteLength && decoder.atBreak() {
+				break
+			}
+			item, err := decoder.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, item)
+		}
+		return result, nil
+	case majorMap:
+		if argument > uint64(len(decoder.data)) {
+			return nil, errTruncated
+		}
+		result := map[string]interface{}{}
+		for i := uint64(0); indefiniteLength || i < argument; i++ {
+			if indefiniteLength && decoder.atBreak() {
+				break
+			}
+			key, err := decoder.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			value, err := decoder.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if text, ok := key.(string); ok {
+				result[text] = value
+			} else {
+				result[fmt.Sprint(key)] = value
+			}
+		}
+		return result, nil
+	case majorTag:
+		return decoder.value(depth + 1)
+	}
+
+	switch argument {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported cbor simple value %d", argument)
+}
+
+func (decoder *decoder) float() (interface{}, error) {
+	head, _ := decoder.take(1)
+	switch head[0] {
+	case 0xf9:
+		data, err := decoder.take(2)
+		if err != nil {
+			return nil, err
+		}
+		return halfFloat(binary.BigEndian.Uint16(data)), nil
+	case 0xfa:
+		data, err := decoder.take(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), nil
+	default:
+		data, err := decoder.take(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	}
+}
+
+// halfFloat converts the IEEE 754 half precision float.
+func halfFloat(half uint16) float64 {
+	exponent, mantissa := int(half>>10)&0x1f, float64(half&0x3ff)
+	var value float64
+	switch exponent {
+	case 0:
+		value = math.Ldexp(mantissa, -24)
+	case 0x1f:
+		if mantissa == 0 {
+			value = math.Inf(1)
+		} else {
+			value = math.NaN()
+		}
+	default:
+		value = math.Ldexp(mantissa+1024, exponent-25)
+	}
+	if half&0x8000 != 0 {
+		return -value
+	}
+	return value
+}
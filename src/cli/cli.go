@@ -0,0 +1,319 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"xserver/src/config"
+)
+
+const (
+	HelpCommand     = "help"
+	CompleteCommand = "__complete"
+)
+
+// Usage is the usage line of the command with its description.
+// Literal words and `a|b` alternatives are subcommands, `<name>` and `[<name>]` are placeholders and words starting with `-` are flags,
+// `[--flag <value>]` and `--flag <value>` flags take values.
+type Usage struct {
+	Line        string
+	Description string
+}
+
+// Command is the program command, commands without config are run with the nil config.
+type Command struct {
+	Name          string
+	Usages        []Usage
+	WithoutConfig bool
+	Run           func(config *config.Config, arguments []string) error
+}
+
+// Cli is the program commands with help of every command and shells completion.
+type Cli struct {
+	name     string
+	flags    []Usage
+	commands []*Command
+	current  *Command
+}
+
+func New(name string, flags []Usage) *Cli {
+	return &Cli{name: name, flags: flags, commands: []*Command{}}
+}
+
+func (cli *Cli) Add(command *Command) {
+	cli.commands = append(cli.commands, command)
+}
+
+func (cli *Cli) Find(name string) (*Command, bool) {
+	for _, command := range cli.commands {
+		if command.Name == name {
+			return command, true
+		}
+	}
+	return nil, false
+}
+
+// Select sets the command run now, its help is printed by Usage.
+func (cli *Cli) Select(command *Command) {
+	cli.current = command
+}
+
+// Selected returns the name of the command run now.
+func (cli *Cli) Selected() string {
+	if cli.current == nil {
+		return ""
+	}
+	return cli.current.Name
+}
+
+// Parse parses arguments by flags of the selected command.
+func (cli *Cli) Parse(arguments []string) (*Arguments, error) {
+	if cli.current == nil {
+		return parse(arguments, map[string]bool{})
+	}
+	return cli.current.Parse(arguments)
+}
+
+// Usage prints the help of the selected command or all commands.
+func (cli *Cli) Usage(writer io.Writer) {
+	if cli.current != nil {
+		cli.Help(writer, cli.current)
+		return
+	}
+
+	fmt.Fprintf(writer, "usage: %s [%s] <command>\n", cli.name, strings.Join(cli.flagsNames(), "|"))
+	fmt.Fprintln(writer, "\tflags:")
+	for _, flag := range cli.flags {
+		fmt.Fprintf(writer, "\t\t%s: %s\n", flag.Line, flag.Description)
+	}
+	fmt.Fprintln(writer, "\tcommands:")
+	for _, command := range cli.commands {
+		for _, usage := range command.Usages {
+			fmt.Fprintf(writer, "\t\t%s: %s\n", usage.Line, usage.Description)
+		}
+	}
+	fmt.Fprintf(writer, "\t\t%s <command>: print usage of the command, also printed by <command> --help\n", HelpCommand)
+}
+
+// Help prints usage lines of the command.
+func (cli *Cli) Help(writer io.Writer, command *Command) {
+	fmt.Fprintln(writer, "usage:")
+	for _, usage := range command.Usages {
+		fmt.Fprintf(writer, "\t%s %s: %s\n", cli.name, usage.Line, usage.Description)
+	}
+}
+
+func (cli *Cli) flagsNames() []string {
+	names := []string{}
+	for _, flag := range cli.flags {
+		for _, name := range strings.Split(flag.Line, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+	return names
+}
+
+// HelpRequested reports whether arguments ask for the command help.
+func HelpRequested(arguments []string) bool {
+	for _, argument := range arguments {
+		if argument == "--" {
+			return false
+		}
+		if argument == "--help" || argument == "-h" {
+			return true
+		}
+	}
+	return false
+}
+
+// tokens splits the usage line by spaces outside of brackets.
+func tokens(line string) []string {
+	result := []string{}
+	depth := 0
+	start := 0
+	for index, char := range line {
+		switch char {
+		case '[', '<':
+			depth++
+		case ']', '>':
+			depth--
+		case ' ':
+			if depth == 0 {
+				if index > start {
+					result = append(result, line[start:index])
+				}
+				start = index + 1
+			}
+		}
+	}
+	if start < len(line) {
+		result = append(result, line[start:])
+	}
+	return result
+}
+
+// parsedUsage is the usage line split to positional tokens and flags, flags map to their value tokens.
+type parsedUsage struct {
+	positional []string
+	flags      map[string]string
+}
+
+func parseUsage(line string) parsedUsage {
+	usage := parsedUsage{positional: []string{}, flags: map[string]string{}}
+	words := tokens(line)
+	for index := 1; index < len(words); index++ {
+		word := strings.TrimSuffix(words[index], "...")
+		inner := word
+		if strings.HasPrefix(word, "[") && strings.HasSuffix(word, "]") {
+			inner = word[1 : len(word)-1]
+		}
+		if !strings.HasPrefix(inner, "-") {
+			usage.positional = append(usage.positional, word)
+			continue
+		}
+
+		name, value, _ := strings.Cut(inner, " ")
+		if value == "" && inner == word && index+1 < len(words) && strings.HasPrefix(words[index+1], "<") {
+			index++
+			value = words[index]
+		}
+		usage.flags[name] = value
+	}
+	return usage
+}
+
+// Parse separates flags of the usage lines from positional arguments, flags values are the next arguments or follow `=`.
+func (command *Command) Parse(arguments []string) (*Arguments, error) {
+	flags := map[string]bool{}
+	for _, usage := range command.Usages {
+		for name, value := range parseUsage(usage.Line).flags {
+			flags[name] = value != ""
+		}
+	}
+	return parse(arguments, flags)
+}
+
+// Complete returns candidates of the last word, values returns candidates of placeholders by name.
+func (cli *Cli) Complete(words []string, values func(name string) []string) []string {
+	globalFlags := map[string]bool{}
+	for _, name := range cli.flagsNames() {
+		globalFlags[name] = true
+	}
+	filtered := []string{}
+	for index, word := range words {
+		if index == len(words)-1 || !globalFlags[word] {
+			filtered = append(filtered, word)
+		}
+	}
+	words = filtered
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current := words[len(words)-1]
+
+	if len(words) == 1 {
+		if strings.HasPrefix(current, "-") {
+			return matching(cli.flagsNames(), current)
+		}
+		names := []string{HelpCommand}
+		for _, command := range cli.commands {
+			names = append(names, command.Name)
+		}
+		return matching(names, current)
+	}
+
+	if words[0] == HelpCommand && len(words) == 2 {
+		return cli.Complete(words[1:], values)
+	}
+	command, ok := cli.Find(words[0])
+	if !ok {
+		return nil
+	}
+
+	usages := []parsedUsage{}
+	flags := map[string]string{}
+	for _, usage := range command.Usages {
+		parsed := parseUsage(usage.Line)
+		usages = append(usages, parsed)
+		for name, value := range parsed.flags {
+			flags[name] = value
+		}
+	}
+	if strings.HasPrefix(current, "-") {
+		names := []string{"--help"}
+		for name := range flags {
+			names = append(names, name)
+		}
+		return matching(names, current)
+	}
+
+	positional := []string{}
+	for index := 1; index < len(words)-1; index++ {
+		if value, ok := flags[words[index]]; ok {
+			if value != "" {
+				if index+1 == len(words)-1 {
+					return matching(tokenCandidates(value, values), current)
+				}
+				index++
+			}
+			continue
+		}
+		positional = append(positional, words[index])
+	}
+
+	candidates := []string{}
+	for _, usage := range usages {
+		if len(usage.positional) <= len(positional) {
+			continue
+		}
+		matched := true
+		for index, word := range positional {
+			if !tokenMatches(usage.positional[index], word) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			candidates = append(candidates, tokenCandidates(usage.positional[len(positional)], values)...)
+		}
+	}
+	return matching(candidates, current)
+}
+
+// tokenCandidates returns alternatives of literal tokens and values of placeholders.
+func tokenCandidates(token string, values func(name string) []string) []string {
+	token = strings.TrimSuffix(token, "...")
+	token = strings.TrimSuffix(strings.TrimPrefix(token, "["), "]")
+	if strings.HasPrefix(token, "<") {
+		return values(strings.Trim(token, "<>"))
+	}
+	return strings.Split(token, "|")
+}
+
+func tokenMatches(token string, word string) bool {
+	token = strings.TrimSuffix(strings.TrimPrefix(token, "["), "]")
+	if strings.HasPrefix(token, "<") {
+		return true
+	}
+	for _, alternative := range strings.Split(token, "|") {
+		if alternative == word {
+			return true
+		}
+	}
+	return false
+}
+
+// matching returns unique sorted candidates with the prefix.
+func matching(candidates []string, prefix string) []string {
+	unique := map[string]bool{}
+	result := []string{}
+	for _, candidate := range candidates {
+		if candidate != "" && strings.HasPrefix(candidate, prefix) && !unique[candidate] {
+			unique[candidate] = true
+			result = append(result, candidate)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
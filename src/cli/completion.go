@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	bashCompletion = `_{name}() {
+	local IFS=$'\n'
+	COMPREPLY=($({name} {complete} "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _{name} {name}
+`
+	zshCompletion = `#compdef {name}
+_{name}() {
+	local -a candidates
+	candidates=("${(@f)$({name} {complete} "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	if [[ -n "${candidates[1]}" ]]; then
+		compadd -a candidates
+	else
+		_files
+	fi
+}
+compdef _{name} {name}
+`
+	fishCompletion = `function __{name}_complete
+	set -l candidates ({name} {complete} (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)
+	if test (count $candidates) -eq 0
+		__fish_complete_path (commandline -ct)
+	else
+		printf '%s\n' $candidates
+	end
+end
+complete -c {name} -f -a '(__{name}_complete)'
+`
+)
+
+// Script returns the completion script of the shell, scripts complete words by the hidden complete command.
+func (cli *Cli) Script(shell string) (string, error) {
+	scripts := map[string]string{"bash": bashCompletion, "zsh": zshCompletion, "fish": fishCompletion}
+	script, ok := scripts[shell]
+	if !ok {
+		return "", fmt.Errorf(`unknown shell "%s", expected bash, zsh or fish`, shell)
+	}
+	return strings.NewReplacer("{name}", cli.name, "{complete}", CompleteCommand).Replace(script), nil
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Arguments are positional arguments and flags of the command, repeated flags keep all values.
+type Arguments struct {
+	Positional []string
+	flags      map[string][]string
+}
+
+// parse separates flags from positional arguments, arguments after `--` are positional.
+func parse(arguments []string, flags map[string]bool) (*Arguments, error) {
+	result := &Arguments{Positional: []string{}, flags: map[string][]string{}}
+	for index := 0; index < len(arguments); index++ {
+		argument := arguments[index]
+		if argument == "--" {
+			result.Positional = append(result.Positional, arguments[index+1:]...)
+			break
+		}
+		if !strings.HasPrefix(argument, "-") || argument == "-" {
+			result.Positional = append(result.Positional, argument)
+			continue
+		}
+
+		name, value, inline := strings.Cut(argument, "=")
+		takesValue, ok := flags[name]
+		if !ok {
+			return nil, fmt.Errorf(`unknown flag "%s"`, name)
+		}
+		if !takesValue {
+			if inline {
+				return nil, fmt.Errorf(`flag "%s" takes no value`, name)
+			}
+			result.flags[name] = append(result.flags[name], "")
+			continue
+		}
+		if !inline {
+			if index+1 >= len(arguments) {
+				return nil, fmt.Errorf(`flag "%s" requires a value`, name)
+			}
+			index++
+			value = arguments[index]
+		}
+		result.flags[name] = append(result.flags[name], value)
+	}
+	return result, nil
+}
+
+func (arguments *Arguments) Bool(name string) bool {
+	_, ok := arguments.flags[name]
+	return ok
+}
+
+// String returns the last value of the flag or the fallback without it.
+func (arguments *Arguments) String(name string, fallback string) string {
+	values := arguments.flags[name]
+	if len(values) == 0 {
+		return fallback
+	}
+	return values[len(values)-1]
+}
+
+func (arguments *Arguments) Strings(name string) []string {
+	return arguments.flags[name]
+}
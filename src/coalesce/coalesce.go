@@ -0,0 +1,145 @@
+package coalesce
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/metrics"
+)
+
+const (
+	CoalescedHeader = "X-Coalesced"
+)
+
+var (
+	// keyHeaders are request headers responses may depend on, requests with other values are not coalesced.
+	keyHeaders = []string{"Authorization", "Cookie", "Accept", "Accept-Encoding", "Accept-Language"}
+)
+
+func init() {
+	metrics.Register("xserver_coalesced_requests_total", metrics.CounterType, "Number of requests responded with the response of the identical concurrent request.")
+}
+
+// call is the in progress request execution, waiters get its response once done is closed.
+type call struct {
+	done   chan struct{}
+	status int
+	header http.Header
+	body   []byte
+}
+
+// Calls coalesces concurrent identical GET requests of handlers into one execution.
+type Calls struct {
+	handlers map[string]bool
+	headers  []string
+	mutex    sync.Mutex
+	calls    map[string]*call
+}
+
+// Create creates calls of handlers with the coalesce option, the api keys header is a part of the calls key.
+func Create(handlers map[string]config.ExecutableServerUnit, apiKeysHeader string) *Calls {
+	headers := append([]string{}, keyHeaders...)
+	if apiKeysHeader != "" {
+		headers = append(headers, apiKeysHeader)
+	}
+	calls := &Calls{handlers: map[string]bool{}, headers: headers, calls: map[string]*call{}}
+	for handlerName, handler := range handlers {
+		if handler.Coalesce {
+			calls.handlers[handlerName] = true
+		}
+	}
+	return calls
+}
+
+// Handles returns whether GET requests of the handler are coalesced.
+func (calls *Calls) Handles(handlerName string) bool {
+	return calls != nil && calls.handlers[handlerName]
+}
+
+// bufferedWriter keeps the response with its own headers to write it to all waiters.
+type bufferedWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (writer *bufferedWriter) Header() http.Header {
+	return writer.header
+}
+
+func (writer *bufferedWriter) Write(data []byte) (int, error) {
+	return writer.body.Write(data)
+}
+
+func (writer *bufferedWriter) WriteHeader(status int) {
+	writer.status = status
+}
+
+// detached keeps values of the request context without its cancellation, so the execution isn't cancelled if the first client goes away.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (detached) Err() error {
+	return nil
+}
+
+func (calls *Calls) key(handlerName string, target string, request *http.Request) string {
+	parts := []string{handlerName, target, request.Method, request.URL.RequestURI()}
+	for _, name := range calls.headers {
+		parts = append(parts, strings.Join(request.Header.Values(name), ","))
+	}
+	return strings.Join(parts, "\n")
+}
+
+func respond(writer http.ResponseWriter, current *call) {
+	for name, values := range current.header {
+		writer.Header()[name] = values
+	}
+	writer.WriteHeader(current.status)
+	writer.Write(current.body)
+}
+
+// Serve serves the request of the handler target by next, identical requests arrived while it is in progress get its response instead of own execution.
+func (calls *Calls) Serve(handlerName string, target string, writer http.ResponseWriter, request *http.Request, next func(writer http.ResponseWriter, request *http.Request) bool) {
+	callKey := calls.key(handlerName, target, request)
+
+	calls.mutex.Lock()
+	if current, ok := calls.calls[callKey]; ok {
+		calls.mutex.Unlock()
+		select {
+		case <-current.done:
+		case <-request.Context().Done():
+			return
+		}
+		metrics.Inc("xserver_coalesced_requests_total", "handler", handlerName)
+		writer.Header().Set(CoalescedHeader, "true")
+		respond(writer, current)
+		return
+	}
+	current := &call{done: make(chan struct{})}
+	calls.calls[callKey] = current
+	calls.mutex.Unlock()
+
+	buffered := &bufferedWriter{header: http.Header{}, status: http.StatusOK}
+	next(buffered, request.WithContext(detached{request.Context()}))
+	current.status, current.header, current.body = buffered.status, buffered.header, buffered.body.Bytes()
+
+	calls.mutex.Lock()
+	delete(calls.calls, callKey)
+	calls.mutex.Unlock()
+	close(current.done)
+	respond(writer, current)
+}
@@ -0,0 +1,86 @@
+package coalesce
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"xserver/src/config"
+)
+
+func TestServe(t *testing.T) {
+	tests := []struct {
+		name       string
+		first      http.Header
+		second     http.Header
+		executions int32
+	}{
+		{name: "identical", executions: 1},
+		{name: "authorization", first: http.Header{"Authorization": {"Bearer first"}}, second: http.Header{"Authorization": {"Bearer second"}}, executions: 2},
+		{name: "api key", first: http.Header{"X-Api-Key": {"first"}}, second: http.Header{"X-Api-Key": {"second"}}, executions: 2},
+		{name: "same api key", first: http.Header{"X-Api-Key": {"first"}}, second: http.Header{"X-Api-Key": {"first"}}, executions: 1},
+		{name: "cookie", first: http.Header{"Cookie": {"session=first"}}, executions: 2},
+		{name: "accept", first: http.Header{"Accept": {"text/plain"}}, second: http.Header{"Accept": {"application/json"}}, executions: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := Create(map[string]config.ExecutableServerUnit{"handler": {Coalesce: true}}, "X-Api-Key")
+			executions := int32(0)
+			started := make(chan struct{})
+			release := make(chan struct{})
+			next := func(writer http.ResponseWriter, request *http.Request) bool {
+				if atomic.AddInt32(&executions, 1) == 1 {
+					close(started)
+					<-release
+				}
+				writer.Write([]byte("response"))
+				return false
+			}
+
+			recorders := []*httptest.ResponseRecorder{httptest.NewRecorder(), httptest.NewRecorder()}
+			group := sync.WaitGroup{}
+			for index, header := range []http.Header{test.first, test.second} {
+				request := httptest.NewRequest(http.MethodGet, "/handler?a=1", nil)
+				for name, values := range header {
+					request.Header[name] = values
+				}
+				group.Add(1)
+				go func(recorder *httptest.ResponseRecorder) {
+					defer group.Done()
+					calls.Serve("handler", "handler", recorder, request, next)
+				}(recorders[index])
+				if index == 0 {
+					<-started
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			group.Wait()
+
+			if executions != test.executions {
+				t.Fatalf("expected %d executions, got %d", test.executions, executions)
+			}
+			for _, recorder := range recorders {
+				if recorder.Body.String() != "response" {
+					t.Fatalf("unexpected response %q", recorder.Body.String())
+				}
+			}
+			if coalesced := recorders[1].Header().Get(CoalescedHeader) == "true"; coalesced != (test.executions == 1) {
+				t.Fatalf("unexpected %s header of the second request", CoalescedHeader)
+			}
+		})
+	}
+}
+
+func TestHandles(t *testing.T) {
+	calls := Create(map[string]config.ExecutableServerUnit{"coalesced": {Coalesce: true}, "plain": {}}, "")
+	if !calls.Handles("coalesced") || calls.Handles("plain") || calls.Handles("unknown") {
+		t.Fatal("unexpected coalesced handlers")
+	}
+	var disabled *Calls
+	if disabled.Handles("coalesced") {
+		t.Fatal("nil calls must not coalesce")
+	}
+}
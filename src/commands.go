@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"xserver/src/cli"
+	"xserver/src/config"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	commandLine *cli.Cli
+)
+
+func init() {
+	commandLine = cli.New("xserver", []cli.Usage{
+		{Line: "-v, -vv", Description: "console output of debug or verbose messages"},
+		{Line: "-q, --quiet", Description: "console output of errors only"},
+	})
+
+	for _, command := range []*cli.Command{
+		{Name: "build", Run: build, Usages: []cli.Usage{
+			{Line: "build [--sign]", Description: "compiles all handlers and tasks, with --sign also writes build manifest signed with build.signing_key"},
+		}},
+		{Name: "keygen", Run: keygenCommand, WithoutConfig: true, Usages: []cli.Usage{
+			{Line: "keygen [<directory>]", Description: "generate signing.key and signing.pub ed25519 keys for build signing"},
+		}},
+		{Name: "start", Run: start, Usages: []cli.Usage{
+			{Line: "start", Description: "start server"},
+		}},
+		{Name: "init", Run: initCommand, WithoutConfig: true, Usages: []cli.Usage{
+			{Line: "init [--sdk] [<directory>]", Description: "generate persistent handlers protocol shims for Go, Python and Node and the protobuf schema (sdk by default), with --sdk also generate database, key value and response helpers"},
+		}},
+		{Name: "tasks", Run: tasksCommand, Usages: []cli.Usage{
+			{Line: "tasks [list]", Description: "list tasks of the running server"},
+			{Line: "tasks pause <task>", Description: "pause task of the running server"},
+			{Line: "tasks run <task>", Description: "run task of the running server now, paused tasks are run too"},
+			{Line: "tasks resume <task>", Description: "resume task of the running server"},
+			{Line: "tasks period <task> <period>", Description: "change task period of the running server"},
+		}},
+		{Name: "flags", Run: flagsCommand, Usages: []cli.Usage{
+			{Line: "flags [list]", Description: "list handlers flags of the running server"},
+			{Line: "flags enable <handler>", Description: "enable handler of the running server"},
+			{Line: "flags disable <handler>", Description: "disable handler of the running server, it responds with 404"},
+			{Line: "flags split <handler> <variant> <percent>", Description: "route percent of handler requests to variant handler, 0 disables split"},
+			{Line: "flags reset <handler>", Description: "remove handler flag"},
+		}},
+		{Name: "canary", Run: canaryCommand, Usages: []cli.Usage{
+			{Line: "canary [list]", Description: "list canaries of the running server"},
+			{Line: "canary start <handler> <variant> <percent>", Description: "route percent of handler requests to variant handler and roll back on errors"},
+			{Line: "canary rollback <handler>", Description: "roll back running canary of handler"},
+		}},
+		{Name: "usage", Run: usageCommand, Usages: []cli.Usage{
+			{Line: "usage [<api_key>] [--from <day>] [--to <day>]", Description: "print api keys quotas usage and requests by key, handler and day (current month by default) of the running server"},
+		}},
+		{Name: "tenants", Run: tenantsCommand, Usages: []cli.Usage{
+			{Line: "tenants [list]", Description: "list tenants with their units, tables, api keys and quotas usage of the running server"},
+			{Line: "tenants suspend|resume <tenant>", Description: "disable handlers and pause tasks of the tenant of the running server or enable and resume them"},
+		}},
+		{Name: "slo", Run: sloCommand, Usages: []cli.Usage{
+			{Line: "slo", Description: "list handlers SLOs compliance and burn rates of the running server"},
+		}},
+		{Name: "traces", Run: tracesCommand, Usages: []cli.Usage{
+			{Line: "traces [<handler>] [--failed]", Description: "list kept request traces of the running server, with --failed only traces of failed requests"},
+		}},
+		{Name: "host", Run: hostCommand, Usages: []cli.Usage{
+			{Line: "host", Description: "show resources usage of the running server process, built units and database"},
+		}},
+		{Name: "faults", Run: faultsCommand, Usages: []cli.Usage{
+			{Line: "faults [list]", Description: "list handlers faults of the running server"},
+			{Line: "faults enable|disable <handler>", Description: "toggle configured faults injection of handler of the running server"},
+		}},
+		{Name: "quarantine", Run: quarantineCommand, Usages: []cli.Usage{
+			{Line: "quarantine [list]", Description: "list handlers quarantined after immediate failures in a row of the running server"},
+			{Line: "quarantine release <handler>", Description: "serve the quarantined handler of the running server again"},
+		}},
+		{Name: "db", Run: dbCommand, Usages: []cli.Usage{
+			{Line: "db compact|vacuum|integrity|rotate_key|retention [--dry-run]", Description: "run database maintenance operation on the running server, retention with --dry-run reports expired records without changes"},
+		}},
+		{Name: "snapshots", Run: snapshotsCommand, Usages: []cli.Usage{
+			{Line: "snapshots [list]", Description: "list snapshots of the config, database and build manifest from the newest one"},
+			{Line: "snapshots create", Description: "take the snapshot on the running server now"},
+		}},
+		{Name: "restore", Run: restoreCommand, WithoutConfig: true, Usages: []cli.Usage{
+			{Line: "restore --from <snapshot|file>", Description: "restore the config, database and build manifest of the stopped server from the snapshot name or archive file, replaced files are saved with .bak suffix"},
+		}},
+		{Name: "export", Run: exportCommand, Usages: []cli.Usage{
+			{Line: "export [--built] [--output <file>]", Description: "archive the config, units sources or built units with --built, database schema and secrets references to move the project to another machine"},
+		}},
+		{Name: "import", Run: importCommand, WithoutConfig: true, Usages: []cli.Usage{
+			{Line: "import <file> [--force]", Description: "write files of the exported project to the working directory, with --force changed files are replaced and saved with .bak suffix"},
+		}},
+		{Name: "console", Run: consoleCommand, Usages: []cli.Usage{
+			{Line: "console", Description: "open the interactive console of the running server to call handlers, run tasks, query the database and print metrics"},
+		}},
+		{Name: "modes", Run: modesCommand, Usages: []cli.Usage{
+			{Line: "modes [list]", Description: "list modes of the running server"},
+			{Line: "modes enable|disable read_only|maintenance", Description: "toggle mode of the running server"},
+		}},
+		{Name: "logs", Run: logsCommand, Usages: []cli.Usage{
+			{Line: "logs [-f] [<unit>] [--tenant <tenant>] [--level error|info|debug|verbose] [--since <duration>]", Description: "print recent log messages of the running server, with -f follow new messages"},
+		}},
+		{Name: "rebuild", Run: rebuildCommand, Usages: []cli.Usage{
+			{Line: "rebuild <unit>", Description: "rebuild handler or task of the running server and reload it without restart"},
+		}},
+		{Name: "pull", Run: pullCommand, Usages: []cli.Usage{
+			{Line: "pull [<unit>]", Description: "fetch git sources and rebuild git units of the running server (all by default)"},
+		}},
+		{Name: "diff", Run: diffCommand, Usages: []cli.Usage{
+			{Line: "diff <handler> <handler> --requests <file.ndjson>", Description: "replay recorded requests against two built handlers and report responses differences"},
+		}},
+		{Name: "replay", Run: replayCommand, Usages: []cli.Usage{
+			{Line: "replay <file.ndjson|database> [--target <url>] [--handler <handler>]", Description: "re-send recorded requests to target (server url by default)"},
+		}},
+		{Name: "doctor", Run: doctorCommand, Usages: []cli.Usage{
+			{Line: "doctor", Description: "check toolchains, permissions and port required by config"},
+		}},
+		{Name: "migrate-config", Run: migrateConfigCommand, WithoutConfig: true, Usages: []cli.Usage{
+			{Line: "migrate-config [<path>]", Description: "upgrade config file to the current version, the previous file is saved with .bak suffix"},
+		}},
+		{Name: "config", Run: configCommand, WithoutConfig: true, Usages: []cli.Usage{
+			{Line: "config get [<key>]", Description: "print dotted key value of the running server config, e.g. tasks.cleanup.period, all config by default"},
+			{Line: "config set <key> <value> [--save]", Description: "change log_level, modes.read_only|maintenance, handlers.<handler>.enabled|faults.enable or tasks.<task>.period of the running server, with --save also write it to config file"},
+			{Line: "config defaults [--profile low_memory]", Description: "print all config keys with their default values, maps have <name> sample entries"},
+			{Line: "config key", Description: "generate config master key for " + config.KeyEnv + " environment variable"},
+			{Line: "config encrypt [--field <field>]... [<path>]", Description: "encrypt values of fields (token, secret, key, dsn and other sensitive keys by default) of config file in place with the master key"},
+			{Line: "config decrypt [<path>]", Description: "decrypt all encrypted values of config file in place with the master key"},
+		}},
+		{Name: "service", Run: serviceCommand, WithoutConfig: true, Usages: []cli.Usage{
+			{Line: "service install [<name>]", Description: "register windows service running server from current directory (xserver by default)"},
+			{Line: "service uninstall [<name>]", Description: "stop and remove windows service"},
+			{Line: "service run [<name>] [<directory>]", Description: "run server under windows service manager"},
+		}},
+		{Name: "completion", Run: completionCommand, WithoutConfig: true, Usages: []cli.Usage{
+			{Line: "completion bash|zsh|fish", Description: "print the shell completion script, e.g. source <(xserver completion bash)"},
+		}},
+	} {
+		commandLine.Add(command)
+	}
+}
+
+func usage() {
+	commandLine.Usage(os.Stdout)
+}
+
+// parseArguments separates flags of the running command usage lines from positional arguments.
+func parseArguments(arguments []string) (*cli.Arguments, error) {
+	parsed, err := commandLine.Parse(arguments)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Error] %s, see xserver %s --help", err, commandLine.Selected())
+	}
+	return parsed, nil
+}
+
+func completionCommand(_ *config.Config, arguments []string) error {
+	if len(arguments) != 1 {
+		usage()
+		return nil
+	}
+	script, err := commandLine.Script(arguments[0])
+	if err != nil {
+		return fmt.Errorf("[XServer] [Completion] [Error] %s", err)
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// completionValues returns names of units, tenants and api keys of the config file, the config isn't loaded to keep the output clean.
+func completionValues() func(name string) []string {
+	names := &struct {
+		Handlers map[string]interface{} `yaml:"handlers"`
+		Tasks    map[string]interface{} `yaml:"tasks"`
+		Tenants  map[string]interface{} `yaml:"tenants"`
+		ApiKeys  struct {
+			Keys map[string]interface{} `yaml:"keys"`
+		} `yaml:"api_keys"`
+	}{}
+	if data, err := os.ReadFile(configPath); err == nil {
+		yaml.Unmarshal(data, names)
+	}
+
+	keys := func(maps ...map[string]interface{}) []string {
+		result := []string{}
+		for _, values := range maps {
+			for key := range values {
+				result = append(result, key)
+			}
+		}
+		sort.Strings(result)
+		return result
+	}
+	return func(name string) []string {
+		switch name {
+		case "handler", "variant":
+			return keys(names.Handlers)
+		case "task":
+			return keys(names.Tasks)
+		case "unit":
+			return keys(names.Handlers, names.Tasks)
+		case "tenant":
+			return keys(names.Tenants)
+		case "api_key":
+			return keys(names.ApiKeys.Keys)
+		}
+		return nil
+	}
+}
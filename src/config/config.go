@@ -3,76 +3,2299 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"mime"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"xserver/src/messages"
 
 	"gopkg.in/yaml.v2"
 )
 
 const (
+	Version = 1
+
+	ProfileDefault   = ""
+	ProfileLowMemory = "low_memory"
+
+	defaultLogBuffer   = 1024
+	lowMemoryLogBuffer = 64
+
+	defaultLogHistory   = 1000
+	lowMemoryLogHistory = 100
+
+	defaultApiKeysHeader = "X-Api-Key"
+
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+
+	defaultReportingWindow      = "1h"
+	defaultReportingMaxIssues   = 1000
+	lowMemoryReportingMaxIssues = 100
+
 	defaultStoragePath = "storage.db"
 	defaultSchemaPath  = "schema.json"
+	defaultStatePath   = "state.json"
+	DefaultOutputDir   = "bin"
+
+	defaultWebhookRetries = 3
+	defaultWebhookBackoff = "1s"
+
+	defaultHandlerErrorsWindow = "1m"
+
+	defaultCanaryWindow       = "10m"
+	defaultCanaryMaxErrorRate = 0.05
+	defaultCanaryMinRequests  = 20
+
+	RecordingDatabase      = "database"
+	defaultRecordingSample = 1
+	defaultRecordingOutput = "requests.ndjson"
+
+	defaultMaintenanceStatus = 503
+	defaultRedirectStatus    = 301
+
+	StartupFailFast          = "fail_fast"
+	StartupDegrade           = "degrade"
+	defaultDependencyTimeout = "5s"
+
+	SecurityHeadersBasic  = "basic"
+	SecurityHeadersStrict = "strict"
+
+	ErrorsLegacy            = "legacy"
+	ErrorsProblem           = "problem"
+	defaultErrorsTypePrefix = "urn:xserver:error:"
+	defaultErrorsLanguage   = "en"
+	defaultAcmeDirectory    = "https://acme-v02.api.letsencrypt.org/directory"
+	defaultAcmeCache        = "acme"
+	defaultMailMaxSize      = 10 << 20
+	defaultWatcherInterval  = "10s"
+	defaultDebounce         = "1s"
+	RedirectRest            = "*"
+	defaultWatcherPattern   = "*"
+	defaultKnownHosts       = "~/.ssh/known_hosts"
+	WatcherKeep             = "keep"
+	WatcherDelete           = "delete"
+	WatcherMove             = "move"
+	LogFormatText           = "text"
+	ListenTcp               = "tcp"
+	ListenUdp               = "udp"
+	LogFormatJson           = "json"
+
+	ReportCsv  = "csv"
+	ReportHtml = "html"
+	ReportJson = "json"
+
+	ProtocolJsonRpc = "jsonrpc"
+	ProtocolExec    = "exec"
+
+	EncodingJson     = "json"
+	EncodingProtobuf = "protobuf"
+
+	QueryParamString  = "string"
+	QueryParamInteger = "integer"
+	QueryParamFloat   = "float"
+
+	IoClassRealtime   = "realtime"
+	IoClassBestEffort = "best_effort"
+	IoClassIdle       = "idle"
+
+	defaultRateLimitWindow = "1s"
+	defaultIdempotencyTtl  = "24h"
+
+	defaultObservabilityInterval = "15s"
+	defaultHostInterval          = "30s"
+
+	defaultStartupTimeout  = "10s"
+	defaultBatchMaxSize    = 8
+	defaultBatchMaxDelay   = "10ms"
+	defaultShutdownTimeout = "30s"
+
+	defaultWorkersQueueTimeout = "10s"
+	defaultWorkersRetryAfter   = 1
+	defaultWorkersReapInterval = "1m"
+	defaultGpusPerDevice       = 1
+
+	defaultQuarantineFailures = 5
+	defaultQuarantineWithin   = "1s"
+	defaultQuarantineDuration = "1m"
+
+	defaultTaskHistoryRetention = "168h"
+	defaultTaskHistoryMaxOutput = 4096
+
+	CronFormatLegacy   = "legacy"
+	CronFormatStandard = "standard"
+
+	QuotaReject       = "reject"
+	QuotaEvictOldest  = "evict_oldest"
+	QuotaEvictTtl     = "evict_ttl"
+	defaultQuotaAlert = 0.8
+
+	RetentionDelete         = "delete"
+	RetentionArchive        = "archive"
+	defaultRetentionArchive = "archive"
+	defaultS3AccessKeyEnv   = "AWS_ACCESS_KEY_ID"
+	defaultS3SecretKeyEnv   = "AWS_SECRET_ACCESS_KEY"
+	defaultSnapshotsKeep    = 7
+
+	lowMemoryTaskHistoryMaxOutput = 1024
+
+	defaultCacheTtl          = "1m"
+	defaultCacheMaxEntries   = 1000
+	lowMemoryCacheMaxEntries = 100
+)
+
+var (
+	defaultToolchains = map[string]string{
+		"cc": "g++",
+	}
+	defaultMaintenanceOperations = []string{"integrity", "compact"}
+	redirectPlaceholder          = regexp.MustCompile(`\{([^{}/]+)\}`)
+	Weekdays                     = map[string]time.Weekday{
+		"sun": time.Sunday,
+		"mon": time.Monday,
+		"tue": time.Tuesday,
+		"wed": time.Wednesday,
+		"thu": time.Thursday,
+		"fri": time.Friday,
+		"sat": time.Saturday,
+	}
 )
 
 type Build struct {
 	Tool  string   `yaml:"tool"`
 	Flags []string `yaml:"flags"`
+	Pre   []string `yaml:"pre"`
+	Post  []string `yaml:"post"`
 }
 
 type Run struct {
-	Tool string   `yaml:"tool"`
-	Args []string `yaml:"arguments"`
+	Tool           string   `yaml:"tool"`
+	Args           []string `yaml:"arguments"`
+	Engine         string   `yaml:"engine"`
+	Protocol       string   `yaml:"protocol"`
+	Socket         string   `yaml:"socket"`
+	Port           int      `yaml:"port"`
+	StartupTimeout string   `yaml:"startup_timeout"`
+	Warm           bool     `yaml:"warm"`
+	Batch          *Batch   `yaml:"batch"`
+	Encoding       string   `yaml:"encoding"`
+}
+
+// Batch is requests of jsonrpc handlers sent to the process at once, up to MaxSize requests queued within MaxDelay.
+type Batch struct {
+	MaxSize  int    `yaml:"max_size"`
+	MaxDelay string `yaml:"max_delay"`
+}
+
+// Listen serves tcp connections or udp datagrams by the handler process, batches are udp datagrams sent to one process.
+type Listen struct {
+	Protocol string `yaml:"protocol"`
+	Address  string `yaml:"address"`
+	Reply    bool   `yaml:"reply"`
+	Batch    *Batch `yaml:"batch"`
+}
+
+// Redirect answers requests of the path with the redirect to the target, {name} segments and the trailing * are substituted in the target.
+type Redirect struct {
+	From   string `yaml:"from"`
+	To     string `yaml:"to"`
+	Status int    `yaml:"status"`
+	Host   string `yaml:"host"`
+}
+
+// Process is the scheduling, umask and locale of unit processes, zero values keep ones of the server.
+type Process struct {
+	Nice       int    `yaml:"nice"`
+	IoClass    string `yaml:"io_class"`
+	IoPriority int    `yaml:"io_priority"`
+	Umask      string `yaml:"umask"`
+	Locale     string `yaml:"locale"`
+}
+
+// Devices are GPUs assigned to unit processes by the workers gpus scheduler and device files they require.
+type Devices struct {
+	Gpus  int      `yaml:"gpus"`
+	Paths []string `yaml:"paths"`
+}
+
+type Git struct {
+	Url string `yaml:"url"`
+	Ref string `yaml:"ref"`
+}
+
+type Language struct {
+	Build string `yaml:"build"`
+	Run   string `yaml:"run"`
+}
+
+type Monitor struct {
+	RunWithin     string `yaml:"run_within"`
+	SuccessWithin string `yaml:"success_within"`
+}
+
+type Mock struct {
+	Status  int               `yaml:"status"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+}
+
+type ReportFilter struct {
+	Name     string `yaml:"name"`
+	Operator string `yaml:"operator"`
+	Value    string `yaml:"value"`
+}
+
+type ReportQuery struct {
+	Table   string         `yaml:"table"`
+	Fields  []string       `yaml:"fields"`
+	Filters []ReportFilter `yaml:"filters"`
+}
+
+type ReportEmail struct {
+	To      []string `yaml:"to"`
+	Subject string   `yaml:"subject"`
+}
+
+// Report is the task rendering the database query result and delivering it instead of running the task file.
+type Report struct {
+	Query    ReportQuery  `yaml:"query"`
+	Format   string       `yaml:"format"`
+	Template string       `yaml:"template"`
+	File     string       `yaml:"file"`
+	Webhook  string       `yaml:"webhook"`
+	Email    *ReportEmail `yaml:"email"`
+}
+
+type Statsd struct {
+	Address   string            `yaml:"address"`
+	Prefix    string            `yaml:"prefix"`
+	Dogstatsd bool              `yaml:"dogstatsd"`
+	Tags      map[string]string `yaml:"tags"`
+}
+
+type RemoteWrite struct {
+	Url      string            `yaml:"url"`
+	Token    string            `yaml:"token"`
+	Username string            `yaml:"username"`
+	Password string            `yaml:"password"`
+	Labels   map[string]string `yaml:"labels"`
+}
+
+type HostThresholds struct {
+	CpuPercent     float64 `yaml:"cpu_percent"`
+	MemoryMb       int64   `yaml:"memory_mb"`
+	OpenFds        int     `yaml:"open_fds"`
+	ChildProcesses int     `yaml:"child_processes"`
+	BinMb          int64   `yaml:"bin_mb"`
+	DatabaseMb     int64   `yaml:"database_mb"`
+}
+
+type Host struct {
+	Interval   string         `yaml:"interval"`
+	Thresholds HostThresholds `yaml:"thresholds"`
+}
+
+// Observability is the push exporters of metrics, for servers that can't be scraped.
+type Observability struct {
+	Interval    string       `yaml:"interval"`
+	Statsd      *Statsd      `yaml:"statsd"`
+	RemoteWrite *RemoteWrite `yaml:"remote_write"`
+}
+
+type Smtp struct {
+	Address  string `yaml:"address"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// Mail accepts inbound mail over SMTP, recipients are addresses or *@domain mapped to handlers.
+type Mail struct {
+	Address    string            `yaml:"address"`
+	Hostname   string            `yaml:"hostname"`
+	MaxSize    int64             `yaml:"max_size"`
+	Recipients map[string]string `yaml:"recipients"`
+}
+
+// Sftp is the remote directory of the watcher, the host key is verified by known_hosts.
+type Sftp struct {
+	Address     string `yaml:"address"`
+	Username    string `yaml:"username"`
+	PasswordEnv string `yaml:"password_env"`
+	Key         string `yaml:"key"`
+	KnownHosts  string `yaml:"known_hosts"`
+}
+
+// Watcher runs the handler or task for every new file of the local or sftp directory matched by the pattern.
+type Watcher struct {
+	Path     string `yaml:"path"`
+	Sftp     *Sftp  `yaml:"sftp"`
+	Pattern  string `yaml:"pattern"`
+	Interval string `yaml:"interval"`
+	Handler  string `yaml:"handler"`
+	Task     string `yaml:"task"`
+	Content  bool   `yaml:"content"`
+	After    string `yaml:"after"`
+	MoveTo   string `yaml:"move_to"`
+	FailedTo string `yaml:"failed_to"`
+}
+
+type Faults struct {
+	Enable         bool   `yaml:"enable"`
+	ErrorPercent   int    `yaml:"error_percent"`
+	Latency        string `yaml:"latency"`
+	LatencyPercent int    `yaml:"latency_percent"`
+	DropPercent    int    `yaml:"drop_percent"`
+}
+
+type Slo struct {
+	Objective        float64 `yaml:"objective"`
+	Latency          string  `yaml:"latency"`
+	LatencyObjective float64 `yaml:"latency_objective"`
+	Window           string  `yaml:"window"`
+	AlertWindow      string  `yaml:"alert_window"`
+	BurnRate         float64 `yaml:"burn_rate"`
+	MinRequests      int     `yaml:"min_requests"`
+}
+
+type HandlerTracing struct {
+	SampleRate *float64 `yaml:"sample_rate"`
+}
+
+type RateLimit struct {
+	Requests int    `yaml:"requests"`
+	Window   string `yaml:"window"`
+}
+
+type Idempotency struct {
+	Ttl      string `yaml:"ttl"`
+	Required bool   `yaml:"required"`
+}
+
+// Group is the shared settings of handlers, handlers settings override them.
+type Group struct {
+	Prefix    string            `yaml:"prefix"`
+	Host      string            `yaml:"host"`
+	Tenant    string            `yaml:"tenant"`
+	Env       map[string]string `yaml:"env"`
+	ApiKeys   []string          `yaml:"api_keys"`
+	RateLimit *RateLimit        `yaml:"rate_limit"`
+	Headers   map[string]string `yaml:"headers"`
+	Run       *Run              `yaml:"run"`
+	Process   *Process          `yaml:"process"`
+	Devices   *Devices          `yaml:"devices"`
+	Faults    *Faults           `yaml:"faults"`
+	Slo       *Slo              `yaml:"slo"`
+	Tracing   *HandlerTracing   `yaml:"tracing"`
 }
 
 type ExecutableServerUnit struct {
-	Path       string `yaml:"path"`
-	File       string `yaml:"file"`
-	Period     string `yaml:"period"`
-	Build      *Build `yaml:"build"`
-	Run        *Run   `yaml:"run"`
-	LogsEnable bool   `yaml:"log"`
+	Path        string            `yaml:"path"`
+	Host        string            `yaml:"host"`
+	Shadow      string            `yaml:"shadow"`
+	Faults      *Faults           `yaml:"faults"`
+	Slo         *Slo              `yaml:"slo"`
+	Tracing     *HandlerTracing   `yaml:"tracing"`
+	Mock        *Mock             `yaml:"mock"`
+	Report      *Report           `yaml:"report"`
+	File        string            `yaml:"file"`
+	Git         *Git              `yaml:"git"`
+	Resources   []string          `yaml:"resources"`
+	Period      string            `yaml:"period"`
+	Timezone    string            `yaml:"timezone"`
+	Jitter      string            `yaml:"jitter"`
+	DependsOn   []string          `yaml:"depends_on"`
+	OnChange    string            `yaml:"on_change"`
+	Debounce    string            `yaml:"debounce"`
+	Monitor     *Monitor          `yaml:"monitor"`
+	Timeout     string            `yaml:"timeout"`
+	MaxOutput   int               `yaml:"max_output"`
+	MaxLine     int               `yaml:"max_line"`
+	Build       *Build            `yaml:"build"`
+	Run         *Run              `yaml:"run"`
+	Process     *Process          `yaml:"process"`
+	Devices     *Devices          `yaml:"devices"`
+	Toolchains  map[string]string `yaml:"toolchains"`
+	LogsEnable  bool              `yaml:"log"`
+	Tenant      string            `yaml:"tenant"`
+	Group       string            `yaml:"group"`
+	Env         map[string]string `yaml:"env"`
+	ApiKeys     []string          `yaml:"api_keys"`
+	RateLimit   *RateLimit        `yaml:"rate_limit"`
+	Headers     map[string]string `yaml:"headers"`
+	Templates   map[string]string `yaml:"templates"`
+	Normalize   bool              `yaml:"normalize"`
+	Etag        bool              `yaml:"etag"`
+	Idempotency *Idempotency      `yaml:"idempotency"`
+	Coalesce    bool              `yaml:"coalesce"`
+	Routes      []Route           `yaml:"routes"`
+	Listen      *Listen           `yaml:"listen"`
+}
+
+// Route routes handler requests matched by all its conditions to another handler.
+type Route struct {
+	Handler string            `yaml:"handler"`
+	Header  map[string]string `yaml:"header"`
+	Query   map[string]string `yaml:"query"`
+	Time    *TimeWindow       `yaml:"time"`
+}
+
+type TimeWindow struct {
+	Days     []string `yaml:"days"`
+	From     string   `yaml:"from"`
+	To       string   `yaml:"to"`
+	Timezone string   `yaml:"timezone"`
+}
+
+type TaskHistory struct {
+	Enable    bool   `yaml:"enable"`
+	Retention string `yaml:"retention"`
+	MaxOutput int    `yaml:"max_output"`
+}
+
+type Maintenance struct {
+	Period     string   `yaml:"period"`
+	Timezone   string   `yaml:"timezone"`
+	Operations []string `yaml:"operations"`
+}
+
+type TableQuota struct {
+	MaxRows int64  `yaml:"max_rows"`
+	Policy  string `yaml:"policy"`
+	Ttl     string `yaml:"ttl"`
+	Field   string `yaml:"field"`
+}
+
+type Quotas struct {
+	MaxSize int64                 `yaml:"max_size"`
+	Alert   float64               `yaml:"alert"`
+	Tables  map[string]TableQuota `yaml:"tables"`
+}
+
+type S3 struct {
+	Endpoint     string `yaml:"endpoint"`
+	Region       string `yaml:"region"`
+	Bucket       string `yaml:"bucket"`
+	Prefix       string `yaml:"prefix"`
+	AccessKeyEnv string `yaml:"access_key_env"`
+	SecretKeyEnv string `yaml:"secret_key_env"`
+}
+
+// Snapshots are periodic archives of the config, database and build manifest kept in the directory or the S3 bucket.
+type Snapshots struct {
+	Period    string `yaml:"period"`
+	Timezone  string `yaml:"timezone"`
+	Keep      int    `yaml:"keep"`
+	Directory string `yaml:"directory"`
+	S3        *S3    `yaml:"s3"`
+}
+
+type RetentionRule struct {
+	Field   string `yaml:"field"`
+	Days    int    `yaml:"days"`
+	Action  string `yaml:"action"`
+	Archive string `yaml:"archive"`
+	S3      bool   `yaml:"s3"`
+}
+
+type Retention struct {
+	Tables map[string]RetentionRule `yaml:"tables"`
+	S3     S3                       `yaml:"s3"`
+}
+
+type Cache struct {
+	Enable     bool   `yaml:"enable"`
+	Ttl        string `yaml:"ttl"`
+	MaxEntries int    `yaml:"max_entries"`
+}
+
+type Encryption struct {
+	KeyEnv          string   `yaml:"key_env"`
+	PreviousKeysEnv []string `yaml:"previous_keys_env"`
 }
 
 type Database struct {
-	Enable  bool   `yaml:"enable"`
-	Storage string `yaml:"storage" default:"storage.db"`
-	Schema  string `yaml:"schema" default:"schema.json"`
+	Enable         bool             `yaml:"enable"`
+	Storage        string           `yaml:"storage" default:"storage.db"`
+	Schema         string           `yaml:"schema" default:"schema.json"`
+	TaskHistory    TaskHistory      `yaml:"task_history"`
+	Maintenance    Maintenance      `yaml:"maintenance"`
+	Rest           bool             `yaml:"rest"`
+	Quotas         Quotas           `yaml:"quotas"`
+	Retention      Retention        `yaml:"retention"`
+	Cache          Cache            `yaml:"cache"`
+	Encryption     Encryption       `yaml:"encryption"`
+	FileEncryption Encryption       `yaml:"file_encryption"`
+	UnredactToken  string           `yaml:"unredact_token"`
+	Etag           bool             `yaml:"etag"`
+	SnapshotReads  bool             `yaml:"snapshot_reads"`
+	Queries        map[string]Query `yaml:"queries"`
+}
+
+// Query is the named select of the database, filters values "{name}" are replaced by parameters of the invocation.
+type Query struct {
+	Table   string                `yaml:"table"`
+	Fields  []string              `yaml:"fields"`
+	Filters []QueryFilter         `yaml:"filters"`
+	Include []string              `yaml:"include"`
+	Params  map[string]QueryParam `yaml:"params"`
+	ApiKeys []string              `yaml:"api_keys"`
+}
+
+type QueryFilter struct {
+	Name     string `yaml:"name"`
+	Operator string `yaml:"operator"`
+	Value    string `yaml:"value"`
+}
+
+// QueryParam is the parameter of the query, filters of missing optional parameters without default are skipped.
+type QueryParam struct {
+	Type     string `yaml:"type"`
+	Required bool   `yaml:"required"`
+	Default  string `yaml:"default"`
+}
+
+type Webhook struct {
+	Url     string   `yaml:"url"`
+	Secret  string   `yaml:"secret"`
+	Events  []string `yaml:"events"`
+	Retries *int     `yaml:"retries"`
+	Backoff string   `yaml:"backoff"`
+}
+
+type NotificationChannel struct {
+	Type   string `yaml:"type"`
+	Url    string `yaml:"url"`
+	Token  string `yaml:"token"`
+	ChatId string `yaml:"chat_id"`
+}
+
+type Notifications struct {
+	Channels            map[string]NotificationChannel `yaml:"channels"`
+	Templates           map[string]string              `yaml:"templates"`
+	TaskFailures        int                            `yaml:"task_failures"`
+	HandlerErrors       int                            `yaml:"handler_errors"`
+	HandlerErrorsWindow string                         `yaml:"handler_errors_window"`
+	ServerStart         bool                           `yaml:"server_start"`
+}
+
+type Scrub struct {
+	Headers  []string `yaml:"headers"`
+	Fields   []string `yaml:"fields"`
+	Patterns []string `yaml:"patterns"`
+}
+
+type Recording struct {
+	Enable   bool     `yaml:"enable"`
+	Sample   float64  `yaml:"sample"`
+	Output   string   `yaml:"output"`
+	Handlers []string `yaml:"handlers"`
+	Scrub    Scrub    `yaml:"scrub"`
+}
+
+type MaintenanceResponse struct {
+	Status  int               `yaml:"status"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+}
+
+type Modes struct {
+	ReadOnly            bool                `yaml:"read_only"`
+	Maintenance         bool                `yaml:"maintenance"`
+	MaintenanceResponse MaintenanceResponse `yaml:"maintenance_response"`
+}
+
+type Dependency struct {
+	Name string `yaml:"name"`
+	Url  string `yaml:"url"`
+}
+
+type Startup struct {
+	OnFailure string       `yaml:"on_failure"`
+	Timeout   string       `yaml:"timeout"`
+	Depends   []Dependency `yaml:"depends"`
+}
+
+type ApiKey struct {
+	Key     string `yaml:"key"`
+	KeyEnv  string `yaml:"key_env"`
+	Daily   int64  `yaml:"daily"`
+	Monthly int64  `yaml:"monthly"`
+	Tenant  string `yaml:"tenant"`
+	Role    string `yaml:"role"`
+}
+
+// Secret returns the key value or the value of its environment variable.
+func (key ApiKey) Secret() string {
+	if key.KeyEnv != "" {
+		return os.Getenv(key.KeyEnv)
+	}
+	return key.Key
+}
+
+type ApiKeys struct {
+	Required bool              `yaml:"required"`
+	Header   string            `yaml:"header"`
+	Keys     map[string]ApiKey `yaml:"keys"`
+}
+
+type Certificate struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+}
+
+// Acme obtains and renews certificates of domains by HTTP-01 and TLS-ALPN-01 challenges.
+type Acme struct {
+	Domains   []string `yaml:"domains"`
+	Email     string   `yaml:"email"`
+	Directory string   `yaml:"directory"`
+	Cache     string   `yaml:"cache"`
+	Http      string   `yaml:"http"`
+}
+
+// Tls is the default certificate and certificates of hosts chosen by SNI.
+type Tls struct {
+	Cert  string                 `yaml:"cert"`
+	Key   string                 `yaml:"key"`
+	Hosts map[string]Certificate `yaml:"hosts"`
+	Acme  Acme                   `yaml:"acme"`
+}
+
+type Tenant struct {
+	Prefix  string   `yaml:"prefix"`
+	Tables  []string `yaml:"tables"`
+	Daily   int64    `yaml:"daily"`
+	Monthly int64    `yaml:"monthly"`
+}
+
+type Reporting struct {
+	Dsn         string `yaml:"dsn"`
+	Environment string `yaml:"environment"`
+	Window      string `yaml:"window"`
+	MaxIssues   int    `yaml:"max_issues"`
+}
+
+type Tracing struct {
+	Enable             bool     `yaml:"enable"`
+	SampleRate         *float64 `yaml:"sample_rate"`
+	AlwaysSampleErrors *bool    `yaml:"always_sample_errors"`
+	SlowThreshold      string   `yaml:"slow_threshold"`
+	MaxSpans           int      `yaml:"max_spans"`
+	MaxTraces          int      `yaml:"max_traces"`
+}
+
+type Errors struct {
+	Format     string                       `yaml:"format"`
+	TypePrefix string                       `yaml:"type_prefix"`
+	Language   string                       `yaml:"language"`
+	Structured bool                         `yaml:"structured"`
+	Messages   map[string]map[string]string `yaml:"messages"`
+}
+
+type Canary struct {
+	Window       string  `yaml:"window"`
+	MaxErrorRate float64 `yaml:"max_error_rate"`
+	MaxLatency   string  `yaml:"max_latency"`
+	MinRequests  int     `yaml:"min_requests"`
+}
+
+type ProjectBuild struct {
+	OutputDir  string `yaml:"output_dir"`
+	SigningKey string `yaml:"signing_key"`
+	VerifyKey  string `yaml:"verify_key"`
+}
+
+// Quarantine stops running the handler after failures in a row within the time from the process start, -1 failures disables it.
+type Quarantine struct {
+	Failures int    `yaml:"failures"`
+	Within   string `yaml:"within"`
+	Duration string `yaml:"duration"`
+}
+
+type Workers struct {
+	MaxProcesses int        `yaml:"max_processes"`
+	MaxQueue     int        `yaml:"max_queue"`
+	QueueTimeout string     `yaml:"queue_timeout"`
+	RetryAfter   int        `yaml:"retry_after"`
+	Quarantine   Quarantine `yaml:"quarantine"`
+	ReapInterval string     `yaml:"reap_interval"`
+	MaxOutput    int        `yaml:"max_output"`
+	MaxLine      int        `yaml:"max_line"`
+	Gpus         Gpus       `yaml:"gpus"`
+}
+
+// Gpus are GPUs shared by units processes, every device runs up to PerDevice processes at once.
+type Gpus struct {
+	Devices      []string `yaml:"devices"`
+	PerDevice    int      `yaml:"per_device"`
+	QueueTimeout string   `yaml:"queue_timeout"`
+}
+
+type Admin struct {
+	Token        string `yaml:"token"`
+	GithubSecret string `yaml:"github_secret"`
 }
 
 type Config struct {
-	Url      string                          `yaml:"url"`
-	LogPath  string                          `yaml:"log"`
-	LogLevel string                          `yaml:"log_level"`
-	Database Database                        `yaml:"database"`
-	Handlers map[string]ExecutableServerUnit `yaml:"handlers"`
-	Tasks    map[string]ExecutableServerUnit `yaml:"tasks"`
+	Version         int                             `yaml:"version"`
+	Strict          bool                            `yaml:"strict"`
+	Toolchains      map[string]string               `yaml:"toolchains"`
+	Languages       map[string]Language             `yaml:"languages"`
+	Build           ProjectBuild                    `yaml:"build"`
+	Url             string                          `yaml:"url"`
+	Tls             Tls                             `yaml:"tls"`
+	LogPath         string                          `yaml:"log"`
+	LogLevel        string                          `yaml:"log_level"`
+	LogBuffer       int                             `yaml:"log_buffer"`
+	LogHistory      int                             `yaml:"log_history"`
+	LogFormat       string                          `yaml:"log_format"`
+	Profile         string                          `yaml:"profile"`
+	CronFormat      string                          `yaml:"cron_format"`
+	State           string                          `yaml:"state"`
+	ExecHeaders     bool                            `yaml:"exec_headers"`
+	ShutdownTimeout string                          `yaml:"shutdown_timeout"`
+	Admin           Admin                           `yaml:"admin"`
+	Workers         Workers                         `yaml:"workers"`
+	Database        Database                        `yaml:"database"`
+	Handlers        map[string]ExecutableServerUnit `yaml:"handlers"`
+	Tasks           map[string]ExecutableServerUnit `yaml:"tasks"`
+	Webhooks        map[string]Webhook              `yaml:"webhooks"`
+	Notifications   Notifications                   `yaml:"notifications"`
+	Canary          Canary                          `yaml:"canary"`
+	Recording       Recording                       `yaml:"recording"`
+	Tracing         Tracing                         `yaml:"tracing"`
+	Modes           Modes                           `yaml:"modes"`
+	Errors          Errors                          `yaml:"errors"`
+	Startup         Startup                         `yaml:"startup"`
+	Reporting       Reporting                       `yaml:"reporting"`
+	ApiKeys         ApiKeys                         `yaml:"api_keys"`
+	Tenants         map[string]Tenant               `yaml:"tenants"`
+	Groups          map[string]Group                `yaml:"groups"`
+	Headers         map[string]string               `yaml:"headers"`
+	SecurityHeaders string                          `yaml:"security_headers"`
+	Smtp            Smtp                            `yaml:"smtp"`
+	Mail            Mail                            `yaml:"mail"`
+	Watchers        map[string]Watcher              `yaml:"watchers"`
+	Redirects       []Redirect                      `yaml:"redirects"`
+	Observability   Observability                   `yaml:"observability"`
+	Host            Host                            `yaml:"host"`
+	Snapshots       Snapshots                       `yaml:"snapshots"`
 }
 
-func (config *Config) setDefaults() {
-	if config.Database.Storage == "" {
-		config.Database.Storage = defaultStoragePath
+func toolchain(toolchains map[string]string, name string) string {
+	if tool := toolchains[name]; tool != "" {
+		return tool
+	}
+	if tool, ok := defaultToolchains[name]; ok {
+		return tool
 	}
+	return name
+}
 
-	if config.Database.Schema == "" {
-		config.Database.Schema = defaultSchemaPath
+func (config *Config) Toolchain(name string) string {
+	return toolchain(config.Toolchains, name)
+}
+
+func (unit ExecutableServerUnit) Toolchain(name string) string {
+	return toolchain(unit.Toolchains, name)
+}
+
+func mergeToolchains(units map[string]ExecutableServerUnit, toolchains map[string]string) {
+	for name, unit := range units {
+		merged := map[string]string{}
+		for toolchainName, tool := range toolchains {
+			merged[toolchainName] = tool
+		}
+		for toolchainName, tool := range unit.Toolchains {
+			merged[toolchainName] = tool
+		}
+		unit.Toolchains = merged
+		units[name] = unit
 	}
 }
 
-func Load(path string) (*Config, error) {
-	fmt.Printf("[Config] read config file: %s\n", path)
+func (config *Config) HandlersOutputDir() string {
+	return filepath.Join(config.Build.OutputDir, "handlers")
+}
 
-	config := &Config{}
+func (config *Config) TasksOutputDir() string {
+	return filepath.Join(config.Build.OutputDir, "tasks")
+}
 
-	data, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("[Config] [Error] failed read config file: %s\n", err)
+func (config *Config) ManifestPath() string {
+	return filepath.Join(config.Build.OutputDir, "manifest.json")
+}
+
+func (config *Config) SourcesOutputDir() string {
+	return filepath.Join(config.Build.OutputDir, "sources")
+}
+
+// SecretsEnv returns sorted names of environment variables the config reads secrets from.
+func (config *Config) SecretsEnv() []string {
+	names := map[string]bool{}
+	for _, key := range config.ApiKeys.Keys {
+		names[key.KeyEnv] = true
+	}
+	for _, encryption := range []Encryption{config.Database.Encryption, config.Database.FileEncryption} {
+		names[encryption.KeyEnv] = true
+		for _, env := range encryption.PreviousKeysEnv {
+			names[env] = true
+		}
 	}
+	if config.Database.Retention.S3.Bucket != "" {
+		names[config.Database.Retention.S3.AccessKeyEnv] = true
+		names[config.Database.Retention.S3.SecretKeyEnv] = true
+	}
+	if config.Snapshots.S3 != nil {
+		names[config.Snapshots.S3.AccessKeyEnv] = true
+		names[config.Snapshots.S3.SecretKeyEnv] = true
+	}
+	for _, watcher := range config.Watchers {
+		if watcher.Sftp != nil {
+			names[watcher.Sftp.PasswordEnv] = true
+		}
+	}
+	delete(names, "")
 
-	if err := yaml.Unmarshal(data, config); err != nil {
-		return nil, fmt.Errorf("[Config] [Error] failed map config file: %s\n", err)
+	secrets := []string{}
+	for name := range names {
+		secrets = append(secrets, name)
 	}
+	sort.Strings(secrets)
+	return secrets
+}
 
-	config.setDefaults()
+// RunsFile reports whether the unit runs its file per call, mocks, engines and long running protocols don't.
+func (unit ExecutableServerUnit) RunsFile() bool {
+	return unit.File != "" && unit.Mock == nil && unit.Report == nil && (unit.Run == nil || (unit.Run.Engine == "" && unit.Run.Protocol == ""))
+}
+
+// HandlerPath returns the handler path under the routing prefixes of its group and tenant.
+func (config *Config) HandlerPath(handlerName string) string {
+	handler := config.Handlers[handlerName]
+	path := handler.Path
+	if path == "" {
+		return path
+	}
+	if handler.Group != "" {
+		path = config.Groups[handler.Group].Prefix + "/" + strings.TrimPrefix(path, "/")
+	}
+	if handler.Tenant != "" {
+		path = config.Tenants[handler.Tenant].Prefix + "/" + strings.TrimPrefix(path, "/")
+	}
+	return path
+}
+
+// HandlerPattern returns the handler path prefixed with its host, handlers with host serve requests of the host only.
+func (config *Config) HandlerPattern(handlerName string) string {
+	path := config.HandlerPath(handlerName)
+	if path == "" {
+		return path
+	}
+	return strings.ToLower(config.Handlers[handlerName].Host) + path
+}
+
+func (config *Config) TlsEnabled() bool {
+	return config.Tls.Cert != "" || len(config.Tls.Hosts) != 0 || len(config.Tls.Acme.Domains) != 0
+}
+
+// Scheme returns the url scheme of the server.
+func (config *Config) Scheme() string {
+	if config.TlsEnabled() {
+		return "https"
+	}
+	return "http"
+}
+
+// mergeGroups applies settings of groups to their handlers, handlers settings override them.
+func mergeGroups(handlers map[string]ExecutableServerUnit, groups map[string]Group) {
+	for name, handler := range handlers {
+		group, ok := groups[handler.Group]
+		if !ok {
+			continue
+		}
+		if handler.Tenant == "" {
+			handler.Tenant = group.Tenant
+		}
+		if handler.Host == "" {
+			handler.Host = group.Host
+		}
+		if len(handler.ApiKeys) == 0 {
+			handler.ApiKeys = group.ApiKeys
+		}
+		if handler.RateLimit == nil && group.RateLimit != nil {
+			rateLimit := *group.RateLimit
+			handler.RateLimit = &rateLimit
+		}
+		if handler.Run == nil && group.Run != nil {
+			run := *group.Run
+			handler.Run = &run
+		}
+		if handler.Process == nil && group.Process != nil {
+			process := *group.Process
+			handler.Process = &process
+		}
+		if handler.Devices == nil && group.Devices != nil {
+			devices := *group.Devices
+			handler.Devices = &devices
+		}
+		if handler.Faults == nil && group.Faults != nil {
+			faults := *group.Faults
+			handler.Faults = &faults
+		}
+		if handler.Slo == nil && group.Slo != nil {
+			slo := *group.Slo
+			handler.Slo = &slo
+		}
+		if handler.Tracing == nil && group.Tracing != nil {
+			tracing := *group.Tracing
+			handler.Tracing = &tracing
+		}
+		env := map[string]string{}
+		for key, value := range group.Env {
+			env[key] = value
+		}
+		for key, value := range handler.Env {
+			env[key] = value
+		}
+		handler.Env = env
+		headers := map[string]string{}
+		for name, value := range group.Headers {
+			headers[name] = value
+		}
+		for name, value := range handler.Headers {
+			headers[name] = value
+		}
+		handler.Headers = headers
+		handlers[name] = handler
+	}
+}
+
+// TableTenant returns the tenant owning the table, tables without tenant are shared.
+func (config *Config) TableTenant(tableName string) string {
+	for tenantName, tenant := range config.Tenants {
+		for _, table := range tenant.Tables {
+			if table == tableName {
+				return tenantName
+			}
+		}
+	}
+	return ""
+}
+
+// TenantUnits returns names of handlers and tasks of the tenant.
+func (config *Config) TenantUnits(tenantName string) map[string]bool {
+	units := map[string]bool{}
+	for _, configUnits := range []map[string]ExecutableServerUnit{config.Handlers, config.Tasks} {
+		for unitName, unit := range configUnits {
+			if unit.Tenant == tenantName {
+				units[unitName] = true
+			}
+		}
+	}
+	return units
+}
+
+func (config *Config) LowMemory() bool {
+	return config.Profile == ProfileLowMemory
+}
+
+func (config *Config) setProfileDefaults() {
+	if !config.LowMemory() {
+		return
+	}
+
+	if config.LogBuffer == 0 {
+		config.LogBuffer = lowMemoryLogBuffer
+	}
+
+	if config.LogHistory == 0 {
+		config.LogHistory = lowMemoryLogHistory
+	}
+
+	if config.Reporting.MaxIssues == 0 {
+		config.Reporting.MaxIssues = lowMemoryReportingMaxIssues
+	}
+
+	if config.Database.TaskHistory.MaxOutput == 0 {
+		config.Database.TaskHistory.MaxOutput = lowMemoryTaskHistoryMaxOutput
+	}
+
+	if config.Database.Cache.MaxEntries == 0 {
+		config.Database.Cache.MaxEntries = lowMemoryCacheMaxEntries
+	}
 
-	fmt.Println("[Config] config loaded successfully: ", *config)
+	if config.Workers.MaxProcesses == 0 {
+		config.Workers.MaxProcesses = runtime.NumCPU()
+	}
+
+	// handlers run per request are served by the persistent jsonrpc process, protocol exec keeps the process per request
+	perCall := map[string]bool{}
+	for _, handlerName := range config.Mail.Recipients {
+		perCall[handlerName] = true
+	}
+	for _, watcher := range config.Watchers {
+		perCall[watcher.Handler] = true
+	}
+	for handlerName, handler := range config.Handlers {
+		if !handler.RunsFile() || handler.Listen != nil || perCall[handlerName] {
+			continue
+		}
+		run := Run{}
+		if handler.Run != nil {
+			run = *handler.Run
+		}
+		run.Protocol = ProtocolJsonRpc
+		handler.Run = &run
+		config.Handlers[handlerName] = handler
+	}
+}
+
+func (config *Config) setDefaults() {
+	config.setProfileDefaults()
+
+	for _, handler := range config.Handlers {
+		if handler.Run != nil && handler.Run.Protocol == ProtocolExec {
+			handler.Run.Protocol = ""
+		}
+	}
+
+	if config.CronFormat == "" {
+		config.CronFormat = CronFormatLegacy
+	}
+
+	if config.LogBuffer == 0 {
+		config.LogBuffer = defaultLogBuffer
+	}
+
+	if config.LogHistory == 0 {
+		config.LogHistory = defaultLogHistory
+	}
+
+	if config.State == "" {
+		config.State = defaultStatePath
+	}
+
+	if config.Build.OutputDir == "" {
+		config.Build.OutputDir = DefaultOutputDir
+	}
+
+	if config.ShutdownTimeout == "" {
+		config.ShutdownTimeout = defaultShutdownTimeout
+	}
+
+	if config.Database.Storage == "" {
+		config.Database.Storage = defaultStoragePath
+	}
+
+	if config.Database.Schema == "" {
+		config.Database.Schema = defaultSchemaPath
+	}
+
+	if config.Database.TaskHistory.Retention == "" {
+		config.Database.TaskHistory.Retention = defaultTaskHistoryRetention
+	}
+
+	if config.Database.TaskHistory.MaxOutput == 0 {
+		config.Database.TaskHistory.MaxOutput = defaultTaskHistoryMaxOutput
+	}
+
+	if config.Database.Maintenance.Period != "" && len(config.Database.Maintenance.Operations) == 0 {
+		config.Database.Maintenance.Operations = defaultMaintenanceOperations
+		if len(config.Database.Retention.Tables) != 0 {
+			config.Database.Maintenance.Operations = append([]string{"retention"}, defaultMaintenanceOperations...)
+		}
+	}
+
+	for _, handler := range config.Handlers {
+		for _, route := range handler.Routes {
+			if route.Time == nil {
+				continue
+			}
+			if route.Time.From == "" {
+				route.Time.From = "00:00"
+			}
+			if route.Time.To == "" {
+				route.Time.To = "00:00"
+			}
+		}
+	}
+
+	for table, rule := range config.Database.Retention.Tables {
+		if rule.Action == "" {
+			rule.Action = RetentionDelete
+		}
+		if rule.Archive == "" {
+			rule.Archive = defaultRetentionArchive
+		}
+		config.Database.Retention.Tables[table] = rule
+	}
+	if config.Database.Retention.S3.AccessKeyEnv == "" {
+		config.Database.Retention.S3.AccessKeyEnv = defaultS3AccessKeyEnv
+	}
+	if config.Database.Retention.S3.SecretKeyEnv == "" {
+		config.Database.Retention.S3.SecretKeyEnv = defaultS3SecretKeyEnv
+	}
+
+	if config.Snapshots.Keep == 0 {
+		config.Snapshots.Keep = defaultSnapshotsKeep
+	}
+	if config.Snapshots.S3 != nil {
+		if config.Snapshots.S3.AccessKeyEnv == "" {
+			config.Snapshots.S3.AccessKeyEnv = defaultS3AccessKeyEnv
+		}
+		if config.Snapshots.S3.SecretKeyEnv == "" {
+			config.Snapshots.S3.SecretKeyEnv = defaultS3SecretKeyEnv
+		}
+	}
+
+	if config.Database.Cache.Ttl == "" {
+		config.Database.Cache.Ttl = defaultCacheTtl
+	}
+
+	if config.Database.Cache.MaxEntries == 0 {
+		config.Database.Cache.MaxEntries = defaultCacheMaxEntries
+	}
+
+	if config.Database.Quotas.Alert == 0 {
+		config.Database.Quotas.Alert = defaultQuotaAlert
+	}
+
+	for table, quota := range config.Database.Quotas.Tables {
+		if quota.Policy == "" {
+			quota.Policy = QuotaReject
+		}
+		config.Database.Quotas.Tables[table] = quota
+	}
+
+	if config.Workers.QueueTimeout == "" {
+		config.Workers.QueueTimeout = defaultWorkersQueueTimeout
+	}
+
+	if config.Workers.RetryAfter == 0 {
+		config.Workers.RetryAfter = defaultWorkersRetryAfter
+	}
+
+	if config.Workers.ReapInterval == "" {
+		config.Workers.ReapInterval = defaultWorkersReapInterval
+	}
+
+	if config.Workers.Gpus.PerDevice == 0 {
+		config.Workers.Gpus.PerDevice = defaultGpusPerDevice
+	}
+
+	if config.Workers.Gpus.QueueTimeout == "" {
+		config.Workers.Gpus.QueueTimeout = config.Workers.QueueTimeout
+	}
+
+	if config.Workers.Quarantine.Failures == 0 {
+		config.Workers.Quarantine.Failures = defaultQuarantineFailures
+	}
+
+	if config.Workers.Quarantine.Within == "" {
+		config.Workers.Quarantine.Within = defaultQuarantineWithin
+	}
+
+	if config.Workers.Quarantine.Duration == "" {
+		config.Workers.Quarantine.Duration = defaultQuarantineDuration
+	}
+
+	if config.Notifications.HandlerErrorsWindow == "" {
+		config.Notifications.HandlerErrorsWindow = defaultHandlerErrorsWindow
+	}
+
+	if config.Canary.Window == "" {
+		config.Canary.Window = defaultCanaryWindow
+	}
+
+	if config.Canary.MaxErrorRate == 0 {
+		config.Canary.MaxErrorRate = defaultCanaryMaxErrorRate
+	}
+
+	if config.Canary.MinRequests == 0 {
+		config.Canary.MinRequests = defaultCanaryMinRequests
+	}
+
+	if config.Recording.Sample == 0 {
+		config.Recording.Sample = defaultRecordingSample
+	}
+
+	if config.Recording.Output == "" {
+		config.Recording.Output = defaultRecordingOutput
+	}
+
+	if config.Modes.MaintenanceResponse.Status == 0 {
+		config.Modes.MaintenanceResponse.Status = defaultMaintenanceStatus
+	}
+
+	if config.Reporting.Window == "" {
+		config.Reporting.Window = defaultReportingWindow
+	}
+
+	if config.ApiKeys.Header == "" {
+		config.ApiKeys.Header = defaultApiKeysHeader
+	}
+
+	for tenantName, tenant := range config.Tenants {
+		if tenant.Prefix == "" {
+			tenant.Prefix = "/" + tenantName
+		}
+		tenant.Prefix = strings.TrimSuffix(tenant.Prefix, "/")
+		config.Tenants[tenantName] = tenant
+	}
+
+	if config.Reporting.MaxIssues == 0 {
+		config.Reporting.MaxIssues = defaultReportingMaxIssues
+	}
+
+	if config.Startup.OnFailure == "" {
+		config.Startup.OnFailure = StartupDegrade
+	}
+
+	if config.Startup.Timeout == "" {
+		config.Startup.Timeout = defaultDependencyTimeout
+	}
+
+	for index, dependency := range config.Startup.Depends {
+		if dependency.Name == "" {
+			config.Startup.Depends[index].Name = dependency.Url
+		}
+	}
+
+	if config.Errors.Format == "" {
+		config.Errors.Format = ErrorsLegacy
+	}
+
+	if config.Errors.TypePrefix == "" {
+		config.Errors.TypePrefix = defaultErrorsTypePrefix
+	}
+
+	for name, watcher := range config.Watchers {
+		if watcher.Interval == "" {
+			watcher.Interval = defaultWatcherInterval
+		}
+		if watcher.Pattern == "" {
+			watcher.Pattern = defaultWatcherPattern
+		}
+		if watcher.After == "" {
+			watcher.After = WatcherKeep
+		}
+		if watcher.Sftp != nil && watcher.Sftp.KnownHosts == "" {
+			watcher.Sftp.KnownHosts = defaultKnownHosts
+		}
+		config.Watchers[name] = watcher
+	}
+
+	for index := range config.Redirects {
+		if config.Redirects[index].Status == 0 {
+			config.Redirects[index].Status = defaultRedirectStatus
+		}
+	}
+
+	if config.Mail.MaxSize == 0 {
+		config.Mail.MaxSize = defaultMailMaxSize
+	}
+
+	if config.Tls.Acme.Directory == "" {
+		config.Tls.Acme.Directory = defaultAcmeDirectory
+	}
+
+	if config.Tls.Acme.Cache == "" {
+		config.Tls.Acme.Cache = defaultAcmeCache
+	}
+
+	if config.Errors.Language == "" {
+		config.Errors.Language = defaultErrorsLanguage
+	}
+
+	if config.LogFormat == "" {
+		config.LogFormat = LogFormatText
+	}
+
+	if len(config.Recording.Scrub.Headers) == 0 {
+		config.Recording.Scrub.Headers = []string{"Authorization", "Cookie"}
+	}
+
+	for groupName, group := range config.Groups {
+		group.Prefix = strings.TrimSuffix(group.Prefix, "/")
+		config.Groups[groupName] = group
+	}
+	mergeGroups(config.Handlers, config.Groups)
+
+	for name, handler := range config.Handlers {
+		if handler.RateLimit != nil && handler.RateLimit.Window == "" {
+			handler.RateLimit.Window = defaultRateLimitWindow
+		}
+		if handler.Idempotency != nil && handler.Idempotency.Ttl == "" {
+			handler.Idempotency.Ttl = defaultIdempotencyTtl
+		}
+		if handler.MaxOutput == 0 {
+			handler.MaxOutput = config.Workers.MaxOutput
+		}
+		if handler.MaxLine == 0 {
+			handler.MaxLine = config.Workers.MaxLine
+		}
+		config.Handlers[name] = handler
+	}
+
+	for name, task := range config.Tasks {
+		if task.MaxLine == 0 {
+			task.MaxLine = config.Workers.MaxLine
+		}
+		if task.OnChange != "" && task.Debounce == "" {
+			task.Debounce = defaultDebounce
+		}
+		config.Tasks[name] = task
+	}
+
+	if config.Observability.Interval == "" {
+		config.Observability.Interval = defaultObservabilityInterval
+	}
+
+	if config.Host.Interval == "" {
+		config.Host.Interval = defaultHostInterval
+	}
+
+	for _, task := range config.Tasks {
+		if task.Report != nil && task.Report.Format == "" {
+			task.Report.Format = ReportCsv
+		}
+	}
+
+	mergeToolchains(config.Handlers, config.Toolchains)
+	mergeToolchains(config.Tasks, config.Toolchains)
+
+	for name, handler := range config.Handlers {
+		if handler.Run != nil && handler.Run.StartupTimeout == "" {
+			handler.Run.StartupTimeout = defaultStartupTimeout
+		}
+		if handler.Run != nil && handler.Run.Encoding == "" {
+			handler.Run.Encoding = EncodingJson
+		}
+		if handler.Listen != nil && handler.Listen.Batch != nil {
+			if handler.Listen.Batch.MaxSize == 0 {
+				handler.Listen.Batch.MaxSize = defaultBatchMaxSize
+			}
+			if handler.Listen.Batch.MaxDelay == "" {
+				handler.Listen.Batch.MaxDelay = defaultBatchMaxDelay
+			}
+		}
+		if handler.Run != nil && handler.Run.Batch != nil {
+			if handler.Run.Batch.MaxSize == 0 {
+				handler.Run.Batch.MaxSize = defaultBatchMaxSize
+			}
+			if handler.Run.Batch.MaxDelay == "" {
+				handler.Run.Batch.MaxDelay = defaultBatchMaxDelay
+			}
+		}
+		config.Handlers[name] = handler
+	}
+
+	for queryName, query := range config.Database.Queries {
+		for paramName, param := range query.Params {
+			if param.Type == "" {
+				param.Type = QueryParamString
+			}
+			query.Params[paramName] = param
+		}
+		config.Database.Queries[queryName] = query
+	}
+
+	for name, webhook := range config.Webhooks {
+		if webhook.Retries == nil {
+			retries := defaultWebhookRetries
+			webhook.Retries = &retries
+		}
+		if webhook.Backoff == "" {
+			webhook.Backoff = defaultWebhookBackoff
+		}
+		config.Webhooks[name] = webhook
+	}
+}
+
+func (config *Config) verifyTasksDependencies() error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := map[string]int{}
+
+	var visit func(taskName string, path []string) error
+	visit = func(taskName string, path []string) error {
+		switch states[taskName] {
+		case visiting:
+			return fmt.Errorf("tasks dependency cycle: %s", strings.Join(append(path, taskName), " -> "))
+		case visited:
+			return nil
+		}
+
+		states[taskName] = visiting
+		for _, dependency := range config.Tasks[taskName].DependsOn {
+			if _, ok := config.Tasks[dependency]; !ok {
+				return fmt.Errorf(`unknown dependency "%s" of "%s" task`, dependency, taskName)
+			}
+			if err := visit(dependency, append(path, taskName)); err != nil {
+				return err
+			}
+		}
+		states[taskName] = visited
+
+		return nil
+	}
+
+	taskNames := []string{}
+	for taskName := range config.Tasks {
+		taskNames = append(taskNames, taskName)
+	}
+	sort.Strings(taskNames)
+
+	for _, taskName := range taskNames {
+		if err := visit(taskName, []string{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (config *Config) verifyVersion() error {
+	if config.Version == 0 {
+		fmt.Printf("[Config] [Warning] config version is not set, run xserver migrate-config to set version %d\n", Version)
+		return nil
+	}
+
+	if config.Version > Version {
+		return fmt.Errorf("config version %d is newer than supported %d, upgrade xserver", config.Version, Version)
+	}
+
+	if config.Version < Version {
+		return fmt.Errorf("config version %d is outdated, run xserver migrate-config to upgrade it to %d", config.Version, Version)
+	}
+
+	return nil
+}
+
+func (config *Config) verifyLanguages() error {
+	for extension, language := range config.Languages {
+		if !strings.HasPrefix(extension, ".") {
+			return fmt.Errorf(`language extension "%s" must start with "."`, extension)
+		}
+		if language.Build == "" && language.Run == "" {
+			return fmt.Errorf(`language "%s" must define build or run command`, extension)
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyTasksTriggers() error {
+	for taskName, task := range config.Tasks {
+		if task.OnChange == "" {
+			continue
+		}
+		if len(task.DependsOn) != 0 {
+			return fmt.Errorf(`task "%s" can't have both on_change and depends_on`, taskName)
+		}
+		if _, err := filepath.Match(task.OnChange, ""); err != nil {
+			return fmt.Errorf(`invalid on_change "%s" of "%s" task: %s`, task.OnChange, taskName, err)
+		}
+		if debounce, err := time.ParseDuration(task.Debounce); err != nil || debounce < 0 {
+			return fmt.Errorf(`invalid debounce "%s" of "%s" task, expected duration`, task.Debounce, taskName)
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyMocks() error {
+	for taskName, task := range config.Tasks {
+		if task.Mock != nil {
+			return fmt.Errorf(`task "%s" can't be a mock`, taskName)
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyObservability() error {
+	if interval, err := time.ParseDuration(config.Observability.Interval); err != nil || interval <= 0 {
+		return fmt.Errorf("observability interval must be a positive duration")
+	}
+	if interval, err := time.ParseDuration(config.Host.Interval); err != nil || interval <= 0 {
+		return fmt.Errorf("host interval must be a positive duration")
+	}
+	if config.Observability.Statsd != nil && config.Observability.Statsd.Address == "" {
+		return fmt.Errorf("observability statsd requires address")
+	}
+	if config.Observability.RemoteWrite != nil && config.Observability.RemoteWrite.Url == "" {
+		return fmt.Errorf("observability remote_write requires url")
+	}
+	return nil
+}
+
+func (config *Config) verifyRetention() error {
+	retention := config.Database.Retention
+	for table, rule := range retention.Tables {
+		if rule.Field == "" || rule.Days <= 0 {
+			return fmt.Errorf(`retention of "%s" table requires field and positive days`, table)
+		}
+		if rule.Action != RetentionDelete && rule.Action != RetentionArchive {
+			return fmt.Errorf(`unknown retention action "%s" of "%s" table, expected %s or %s`, rule.Action, table, RetentionDelete, RetentionArchive)
+		}
+		if rule.S3 && (retention.S3.Bucket == "" || retention.S3.Region == "") {
+			return fmt.Errorf(`retention of "%s" table requires database.retention.s3 bucket and region`, table)
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyReports() error {
+	for handlerName, handler := range config.Handlers {
+		if handler.Report != nil {
+			return fmt.Errorf(`handler "%s" can't be a report`, handlerName)
+		}
+	}
+	for taskName, task := range config.Tasks {
+		report := task.Report
+		if report == nil {
+			continue
+		}
+		if !config.Database.Enable {
+			return fmt.Errorf(`report of "%s" task requires enabled database`, taskName)
+		}
+		if report.Query.Table == "" {
+			return fmt.Errorf(`report of "%s" task requires query table`, taskName)
+		}
+		if report.Format != ReportCsv && report.Format != ReportHtml && report.Format != ReportJson {
+			return fmt.Errorf(`unknown report format "%s" of "%s" task, expected %s, %s or %s`, report.Format, taskName, ReportCsv, ReportHtml, ReportJson)
+		}
+		if report.File == "" && report.Webhook == "" && report.Email == nil {
+			return fmt.Errorf(`report of "%s" task requires file, webhook or email delivery`, taskName)
+		}
+		if report.Email != nil {
+			if len(report.Email.To) == 0 {
+				return fmt.Errorf(`report email of "%s" task requires recipients`, taskName)
+			}
+			if config.Smtp.Address == "" || config.Smtp.From == "" {
+				return fmt.Errorf(`report email of "%s" task requires smtp address and from`, taskName)
+			}
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyQuotas() error {
+	if config.Database.Quotas.Alert < 0 || config.Database.Quotas.Alert > 1 {
+		return fmt.Errorf("database quotas alert must be between 0 and 1")
+	}
+	for table, quota := range config.Database.Quotas.Tables {
+		switch quota.Policy {
+		case QuotaReject, QuotaEvictOldest:
+			if quota.MaxRows <= 0 {
+				return fmt.Errorf(`%s quota of "%s" table requires positive max_rows`, quota.Policy, table)
+			}
+		case QuotaEvictTtl:
+			if quota.Field == "" {
+				return fmt.Errorf(`%s quota of "%s" table requires field`, quota.Policy, table)
+			}
+			if _, err := time.ParseDuration(quota.Ttl); err != nil {
+				return fmt.Errorf(`invalid ttl of "%s" table quota: %s`, table, err)
+			}
+		default:
+			return fmt.Errorf(`unknown policy "%s" of "%s" table quota`, quota.Policy, table)
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyShadows() error {
+	for handlerName, handler := range config.Handlers {
+		if handler.Shadow == "" {
+			continue
+		}
+		if _, ok := config.Handlers[handler.Shadow]; !ok || handler.Shadow == handlerName {
+			return fmt.Errorf(`invalid shadow handler "%s" of "%s" handler`, handler.Shadow, handlerName)
+		}
+	}
+	return nil
+}
+
+// verifyHost verifies the host is the domain name without scheme, port and path.
+func verifyHost(host string) error {
+	if host == "" {
+		return nil
+	}
+	if strings.ContainsAny(host, ":/ ") {
+		return fmt.Errorf(`invalid host "%s", expected domain name without scheme, port and path e.g. api.example.com`, host)
+	}
+	return nil
+}
+
+func (config *Config) verifyHosts() error {
+	for handlerName, handler := range config.Handlers {
+		if err := verifyHost(handler.Host); err != nil {
+			return fmt.Errorf(`"%s" handler: %s`, handlerName, err)
+		}
+	}
+	for groupName, group := range config.Groups {
+		if err := verifyHost(group.Host); err != nil {
+			return fmt.Errorf(`"%s" group: %s`, groupName, err)
+		}
+	}
+
+	if (config.Tls.Cert == "") != (config.Tls.Key == "") {
+		return fmt.Errorf("tls cert and key must be set together")
+	}
+	for host, certificate := range config.Tls.Hosts {
+		if err := verifyHost(strings.TrimPrefix(host, "*.")); err != nil {
+			return fmt.Errorf("tls hosts: %s", err)
+		}
+		if certificate.Cert == "" || certificate.Key == "" {
+			return fmt.Errorf(`tls host "%s" requires cert and key`, host)
+		}
+	}
+	for _, domain := range config.Tls.Acme.Domains {
+		if strings.HasPrefix(domain, "*") {
+			return fmt.Errorf(`tls acme domain "%s" is the wildcard one, it requires DNS-01 challenges`, domain)
+		}
+		if err := verifyHost(domain); err != nil || domain == "" {
+			return fmt.Errorf(`invalid tls acme domain "%s"`, domain)
+		}
+	}
+	if _, err := url.Parse(config.Tls.Acme.Directory); err != nil {
+		return fmt.Errorf("invalid tls acme directory: %s", err)
+	}
+	return nil
+}
+
+func (config *Config) verifyRoutes() error {
+	for handlerName, handler := range config.Handlers {
+		for index, route := range handler.Routes {
+			if _, ok := config.Handlers[route.Handler]; !ok || route.Handler == handlerName {
+				return fmt.Errorf(`invalid handler "%s" of "%s" handler route %d`, route.Handler, handlerName, index+1)
+			}
+			if len(route.Header) == 0 && len(route.Query) == 0 && route.Time == nil {
+				return fmt.Errorf(`"%s" handler route %d has no header, query or time conditions`, handlerName, index+1)
+			}
+			if route.Time == nil {
+				continue
+			}
+			for _, day := range route.Time.Days {
+				if _, ok := Weekdays[strings.ToLower(day)]; !ok {
+					return fmt.Errorf(`unknown day "%s" of "%s" handler route %d, expected mon, tue, wed, thu, fri, sat or sun`, day, handlerName, index+1)
+				}
+			}
+			for _, clock := range []string{route.Time.From, route.Time.To} {
+				if _, err := time.Parse("15:04", clock); err != nil {
+					return fmt.Errorf(`invalid time "%s" of "%s" handler route %d, expected hh:mm`, clock, handlerName, index+1)
+				}
+			}
+			if _, err := time.LoadLocation(route.Time.Timezone); err != nil {
+				return fmt.Errorf(`invalid timezone of "%s" handler route %d: %s`, handlerName, index+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyStartup() error {
+	if config.Startup.OnFailure != StartupFailFast && config.Startup.OnFailure != StartupDegrade {
+		return fmt.Errorf(`unknown startup on_failure "%s", expected %s or %s`, config.Startup.OnFailure, StartupFailFast, StartupDegrade)
+	}
+
+	if _, err := time.ParseDuration(config.Startup.Timeout); err != nil {
+		return fmt.Errorf("invalid startup timeout: %s", err)
+	}
+
+	for _, dependency := range config.Startup.Depends {
+		target, err := url.Parse(dependency.Url)
+		if err != nil || target.Host == "" || (target.Scheme != "http" && target.Scheme != "https" && target.Scheme != "tcp") {
+			return fmt.Errorf(`invalid url "%s" of "%s" startup dependency, expected http, https or tcp url`, dependency.Url, dependency.Name)
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyApiKeys() error {
+	for name, key := range config.ApiKeys.Keys {
+		if (key.Key == "") == (key.KeyEnv == "") {
+			return fmt.Errorf(`api key "%s" requires either key or key_env`, name)
+		}
+		if key.Daily < 0 || key.Monthly < 0 {
+			return fmt.Errorf(`quotas of "%s" api key must not be negative`, name)
+		}
+		if key.Role != "" && key.Role != RoleViewer && key.Role != RoleOperator && key.Role != RoleAdmin {
+			return fmt.Errorf(`unknown role "%s" of "%s" api key, expected %s, %s or %s`, key.Role, name, RoleViewer, RoleOperator, RoleAdmin)
+		}
+	}
+	if config.ApiKeys.Required && len(config.ApiKeys.Keys) == 0 {
+		return fmt.Errorf("required api keys require at least one key")
+	}
+	return nil
+}
+
+func (config *Config) verifyTenants() error {
+	prefixes := map[string]string{}
+	tables := map[string]string{}
+	for tenantName, tenant := range config.Tenants {
+		if !strings.HasPrefix(tenant.Prefix, "/") {
+			return fmt.Errorf(`prefix "%s" of "%s" tenant must start with /`, tenant.Prefix, tenantName)
+		}
+		if other, ok := prefixes[tenant.Prefix]; ok {
+			return fmt.Errorf(`"%s" and "%s" tenants have the same prefix "%s"`, other, tenantName, tenant.Prefix)
+		}
+		prefixes[tenant.Prefix] = tenantName
+		if tenant.Daily < 0 || tenant.Monthly < 0 {
+			return fmt.Errorf(`quotas of "%s" tenant must not be negative`, tenantName)
+		}
+		for _, table := range tenant.Tables {
+			if other, ok := tables[table]; ok {
+				return fmt.Errorf(`table "%s" belongs to both "%s" and "%s" tenants`, table, other, tenantName)
+			}
+			tables[table] = tenantName
+		}
+	}
+
+	for unitTag, units := range map[string]map[string]ExecutableServerUnit{"handler": config.Handlers, "task": config.Tasks} {
+		for unitName, unit := range units {
+			if _, ok := config.Tenants[unit.Tenant]; unit.Tenant != "" && !ok {
+				return fmt.Errorf(`unknown tenant "%s" of "%s" %s`, unit.Tenant, unitName, unitTag)
+			}
+		}
+	}
+	for keyName, key := range config.ApiKeys.Keys {
+		if _, ok := config.Tenants[key.Tenant]; key.Tenant != "" && !ok {
+			return fmt.Errorf(`unknown tenant "%s" of "%s" api key`, key.Tenant, keyName)
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyGroups() error {
+	for groupName, group := range config.Groups {
+		if group.Prefix != "" && !strings.HasPrefix(group.Prefix, "/") {
+			return fmt.Errorf(`prefix "%s" of "%s" group must start with /`, group.Prefix, groupName)
+		}
+	}
+
+	for handlerName, handler := range config.Handlers {
+		if _, ok := config.Groups[handler.Group]; handler.Group != "" && !ok {
+			return fmt.Errorf(`unknown group "%s" of "%s" handler`, handler.Group, handlerName)
+		}
+		for _, keyName := range handler.ApiKeys {
+			if _, ok := config.ApiKeys.Keys[keyName]; !ok {
+				return fmt.Errorf(`unknown api key "%s" of "%s" handler`, keyName, handlerName)
+			}
+		}
+		if handler.Idempotency != nil {
+			if ttl, err := time.ParseDuration(handler.Idempotency.Ttl); err != nil || ttl <= 0 {
+				return fmt.Errorf(`idempotency ttl of "%s" handler must be a positive duration`, handlerName)
+			}
+			if !config.Database.Enable {
+				return fmt.Errorf(`idempotency of "%s" handler requires enabled database`, handlerName)
+			}
+		}
+		if handler.RateLimit != nil {
+			window, err := time.ParseDuration(handler.RateLimit.Window)
+			if err != nil || window <= 0 || handler.RateLimit.Requests <= 0 {
+				return fmt.Errorf(`rate limit of "%s" handler requires positive requests and window`, handlerName)
+			}
+		}
+	}
+	return nil
+}
+
+func verifyProcess(unitName string, process *Process) error {
+	if process == nil {
+		return nil
+	}
+	if process.Nice < -20 || process.Nice > 19 {
+		return fmt.Errorf(`nice of "%s" must be between -20 and 19`, unitName)
+	}
+	if process.IoClass != "" && process.IoClass != IoClassRealtime && process.IoClass != IoClassBestEffort && process.IoClass != IoClassIdle {
+		return fmt.Errorf(`unknown io class "%s" of "%s", expected %s, %s or %s`, process.IoClass, unitName, IoClassRealtime, IoClassBestEffort, IoClassIdle)
+	}
+	if process.IoPriority < 0 || process.IoPriority > 7 {
+		return fmt.Errorf(`io priority of "%s" must be between 0 and 7`, unitName)
+	}
+	if process.Umask != "" {
+		if umask, err := strconv.ParseUint(process.Umask, 8, 32); err != nil || umask > 0777 {
+			return fmt.Errorf(`invalid umask "%s" of "%s", expected octal e.g. 027`, process.Umask, unitName)
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifySnapshots() error {
+	snapshots := config.Snapshots
+	if snapshots.Directory != "" && snapshots.S3 != nil {
+		return fmt.Errorf("snapshots directory and s3 are exclusive")
+	}
+	if snapshots.Period != "" && snapshots.Directory == "" && snapshots.S3 == nil {
+		return fmt.Errorf("snapshots period requires snapshots directory or s3")
+	}
+	if snapshots.S3 != nil && (snapshots.S3.Bucket == "" || snapshots.S3.Region == "") {
+		return fmt.Errorf("snapshots s3 requires bucket and region")
+	}
+	if snapshots.Keep < 0 {
+		return fmt.Errorf("snapshots keep must be positive")
+	}
+	return nil
+}
+
+func (config *Config) verifyBatches() error {
+	for handlerName, handler := range config.Handlers {
+		if handler.Run == nil {
+			continue
+		}
+		if handler.Run.Encoding != EncodingJson && handler.Run.Encoding != EncodingProtobuf {
+			return fmt.Errorf(`invalid run encoding "%s" of "%s" handler, expected %s or %s`, handler.Run.Encoding, handlerName, EncodingJson, EncodingProtobuf)
+		}
+		if handler.Run.Encoding == EncodingProtobuf && handler.Run.Protocol != ProtocolJsonRpc {
+			return fmt.Errorf(`%s encoding of "%s" handler requires %s protocol`, EncodingProtobuf, handlerName, ProtocolJsonRpc)
+		}
+		if !handler.Run.Warm && handler.Run.Batch == nil {
+			continue
+		}
+		if handler.Run.Protocol != ProtocolJsonRpc {
+			return fmt.Errorf(`warm and batch of "%s" handler require %s protocol`, handlerName, ProtocolJsonRpc)
+		}
+		if handler.Run.Batch == nil {
+			continue
+		}
+		if handler.Run.Batch.MaxSize <= 0 {
+			return fmt.Errorf(`batch max_size of "%s" handler must be positive`, handlerName)
+		}
+		if delay, err := time.ParseDuration(handler.Run.Batch.MaxDelay); err != nil || delay < 0 {
+			return fmt.Errorf(`invalid batch max_delay "%s" of "%s" handler, expected duration`, handler.Run.Batch.MaxDelay, handlerName)
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyListeners() error {
+	addresses := map[string]string{}
+	for handlerName, handler := range config.Handlers {
+		listen := handler.Listen
+		if listen == nil {
+			continue
+		}
+		if listen.Protocol != ListenTcp && listen.Protocol != ListenUdp {
+			return fmt.Errorf(`unknown listen protocol "%s" of "%s" handler, expected %s or %s`, listen.Protocol, handlerName, ListenTcp, ListenUdp)
+		}
+		if _, _, err := net.SplitHostPort(listen.Address); err != nil {
+			return fmt.Errorf(`invalid listen address "%s" of "%s" handler: %s`, listen.Address, handlerName, err)
+		}
+		key := listen.Protocol + " " + listen.Address
+		if other, ok := addresses[key]; ok {
+			return fmt.Errorf(`"%s" and "%s" handlers listen the same %s address %s`, other, handlerName, listen.Protocol, listen.Address)
+		}
+		addresses[key] = handlerName
+		if !handler.RunsFile() {
+			return fmt.Errorf(`listen of "%s" handler requires the file run per connection without engine and protocol`, handlerName)
+		}
+		if listen.Batch == nil {
+			continue
+		}
+		if listen.Protocol != ListenUdp || listen.Reply {
+			return fmt.Errorf(`listen batch of "%s" handler requires %s protocol without reply`, handlerName, ListenUdp)
+		}
+		if listen.Batch.MaxSize <= 0 {
+			return fmt.Errorf(`listen batch max_size of "%s" handler must be positive`, handlerName)
+		}
+		if delay, err := time.ParseDuration(listen.Batch.MaxDelay); err != nil || delay < 0 {
+			return fmt.Errorf(`invalid listen batch max_delay "%s" of "%s" handler, expected duration`, listen.Batch.MaxDelay, handlerName)
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyTemplates() error {
+	for handlerName, handler := range config.Handlers {
+		for mediaType, path := range handler.Templates {
+			parsed, _, err := mime.ParseMediaType(mediaType)
+			if err != nil || strings.Contains(parsed, "*") || parsed == "application/json" {
+				return fmt.Errorf(`invalid template media type "%s" of "%s" handler`, mediaType, handlerName)
+			}
+			if path == "" {
+				return fmt.Errorf(`template "%s" of "%s" handler requires file`, mediaType, handlerName)
+			}
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyRedirects() error {
+	for _, redirect := range config.Redirects {
+		if !strings.HasPrefix(redirect.From, "/") {
+			return fmt.Errorf(`redirect from "%s" must start with /`, redirect.From)
+		}
+		if redirect.To == "" {
+			return fmt.Errorf(`redirect from "%s" requires to`, redirect.From)
+		}
+		switch redirect.Status {
+		case 301, 302, 303, 307, 308:
+		default:
+			return fmt.Errorf(`invalid status %d of redirect from "%s", expected 301, 302, 303, 307 or 308`, redirect.Status, redirect.From)
+		}
+		names := map[string]bool{}
+		segments := strings.Split(redirect.From, "/")
+		for index, segment := range segments {
+			if segment == RedirectRest && index == len(segments)-1 {
+				names["path"] = true
+				continue
+			}
+			if strings.Contains(segment, RedirectRest) {
+				return fmt.Errorf(`redirect from "%s" may have * as the last segment only`, redirect.From)
+			}
+			if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+				names[segment[1:len(segment)-1]] = true
+			}
+		}
+		for _, match := range redirectPlaceholder.FindAllStringSubmatch(redirect.To, -1) {
+			if !names[match[1]] {
+				return fmt.Errorf(`unknown placeholder "%s" of redirect from "%s"`, match[0], redirect.From)
+			}
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyQueries() error {
+	for queryName, query := range config.Database.Queries {
+		if query.Table == "" {
+			return fmt.Errorf(`"%s" query requires table`, queryName)
+		}
+		for paramName, param := range query.Params {
+			if param.Type != QueryParamString && param.Type != QueryParamInteger && param.Type != QueryParamFloat {
+				return fmt.Errorf(`invalid type "%s" of "%s" parameter of "%s" query, expected %s, %s or %s`, param.Type, paramName, queryName, QueryParamString, QueryParamInteger, QueryParamFloat)
+			}
+		}
+		for _, keyName := range query.ApiKeys {
+			if _, ok := config.ApiKeys.Keys[keyName]; !ok {
+				return fmt.Errorf(`unknown api key "%s" of "%s" query`, keyName, queryName)
+			}
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyMail() error {
+	if config.Mail.Address == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(config.Mail.Address); err != nil {
+		return fmt.Errorf(`invalid mail address "%s": %s`, config.Mail.Address, err)
+	}
+	if config.Mail.MaxSize < 0 {
+		return fmt.Errorf("mail max_size must be positive")
+	}
+	if len(config.Mail.Recipients) == 0 {
+		return fmt.Errorf("mail requires recipients")
+	}
+	for recipient, handlerName := range config.Mail.Recipients {
+		if _, domain, ok := strings.Cut(recipient, "@"); !ok || domain == "" {
+			return fmt.Errorf(`invalid mail recipient "%s", expected address or *@domain`, recipient)
+		}
+		handler, ok := config.Handlers[handlerName]
+		if !ok {
+			return fmt.Errorf(`unknown handler "%s" of mail recipient "%s"`, handlerName, recipient)
+		}
+		if !handler.RunsFile() {
+			return fmt.Errorf(`handler "%s" of mail recipient "%s" requires the file run per message without engine and protocol`, handlerName, recipient)
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyWatchers() error {
+	for name, watcher := range config.Watchers {
+		if watcher.Path == "" {
+			return fmt.Errorf(`watcher "%s" requires path`, name)
+		}
+		if (watcher.Handler == "") == (watcher.Task == "") {
+			return fmt.Errorf(`watcher "%s" requires either handler or task`, name)
+		}
+		unit, ok := config.Handlers[watcher.Handler]
+		if watcher.Task != "" {
+			unit, ok = config.Tasks[watcher.Task]
+		}
+		if !ok {
+			return fmt.Errorf(`unknown handler or task of watcher "%s"`, name)
+		}
+		if !unit.RunsFile() {
+			return fmt.Errorf(`unit of watcher "%s" requires the file run per call without engine and protocol`, name)
+		}
+		if _, err := filepath.Match(watcher.Pattern, ""); err != nil {
+			return fmt.Errorf(`invalid pattern "%s" of watcher "%s": %s`, watcher.Pattern, name, err)
+		}
+		if interval, err := time.ParseDuration(watcher.Interval); err != nil || interval <= 0 {
+			return fmt.Errorf(`invalid interval "%s" of watcher "%s", expected positive duration`, watcher.Interval, name)
+		}
+		switch watcher.After {
+		case WatcherKeep, WatcherDelete:
+		case WatcherMove:
+			if watcher.MoveTo == "" {
+				return fmt.Errorf(`watcher "%s" moving files requires move_to`, name)
+			}
+		default:
+			return fmt.Errorf(`unknown after "%s" of watcher "%s", expected %s, %s or %s`, watcher.After, name, WatcherKeep, WatcherDelete, WatcherMove)
+		}
+		if watcher.Sftp == nil {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(watcher.Sftp.Address); err != nil {
+			return fmt.Errorf(`invalid sftp address "%s" of watcher "%s": %s`, watcher.Sftp.Address, name, err)
+		}
+		if watcher.Sftp.Username == "" || (watcher.Sftp.PasswordEnv == "" && watcher.Sftp.Key == "") {
+			return fmt.Errorf(`sftp of watcher "%s" requires username and password_env or key`, name)
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyWorkers() error {
+	if interval, err := time.ParseDuration(config.Workers.ReapInterval); err != nil || interval < 0 {
+		return fmt.Errorf(`invalid workers reap interval "%s", expected duration or 0`, config.Workers.ReapInterval)
+	}
+	for _, units := range []map[string]ExecutableServerUnit{config.Handlers, config.Tasks} {
+		for unitName, unit := range units {
+			if unit.MaxOutput < 0 || unit.MaxLine < 0 {
+				return fmt.Errorf(`max_output and max_line of "%s" must not be negative`, unitName)
+			}
+			if err := verifyProcess(unitName, unit.Process); err != nil {
+				return err
+			}
+			if err := config.verifyDevices(unitName, unit.Devices); err != nil {
+				return err
+			}
+		}
+	}
+	if config.Workers.Gpus.PerDevice <= 0 {
+		return fmt.Errorf("workers gpus per_device must be positive")
+	}
+	if _, err := time.ParseDuration(config.Workers.Gpus.QueueTimeout); err != nil {
+		return fmt.Errorf("invalid workers gpus queue timeout: %s", err)
+	}
+	return config.verifyQuarantine()
+}
+
+func (config *Config) verifyDevices(unitName string, devices *Devices) error {
+	if devices == nil {
+		return nil
+	}
+	if devices.Gpus < 0 || devices.Gpus > len(config.Workers.Gpus.Devices) {
+		return fmt.Errorf(`gpus of "%s" must be between 0 and %d workers gpus devices`, unitName, len(config.Workers.Gpus.Devices))
+	}
+	for _, path := range devices.Paths {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf(`device path "%s" of "%s" must be absolute`, path, unitName)
+		}
+	}
+	return nil
+}
+
+func (config *Config) verifyQuarantine() error {
+	quarantine := config.Workers.Quarantine
+	if quarantine.Failures < -1 {
+		return fmt.Errorf("workers quarantine failures must be positive or -1")
+	}
+	for name, value := range map[string]string{"within": quarantine.Within, "duration": quarantine.Duration} {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid workers quarantine %s: %s", name, err)
+		}
+		if duration <= 0 {
+			return fmt.Errorf("workers quarantine %s must be positive", name)
+		}
+	}
+	return nil
+}
+
+func (config *Config) verify() error {
+	if err := config.verifyVersion(); err != nil {
+		return err
+	}
+
+	if err := config.verifyLanguages(); err != nil {
+		return err
+	}
+
+	if config.Profile != ProfileDefault && config.Profile != ProfileLowMemory {
+		return fmt.Errorf(`unknown profile "%s"`, config.Profile)
+	}
+
+	if config.CronFormat != CronFormatLegacy && config.CronFormat != CronFormatStandard {
+		return fmt.Errorf(`unknown cron_format "%s", expected %s or %s`, config.CronFormat, CronFormatLegacy, CronFormatStandard)
+	}
+
+	if config.LowMemory() && config.ExecHeaders {
+		return fmt.Errorf("exec_headers buffers handlers output and is not supported by %s profile", ProfileLowMemory)
+	}
+
+	if err := config.verifyTasksDependencies(); err != nil {
+		return err
+	}
+
+	if err := config.verifyTasksTriggers(); err != nil {
+		return err
+	}
+
+	if err := config.verifyShadows(); err != nil {
+		return err
+	}
+
+	if err := config.verifyRoutes(); err != nil {
+		return err
+	}
+
+	if err := config.verifyHosts(); err != nil {
+		return err
+	}
+
+	if err := config.verifyListeners(); err != nil {
+		return err
+	}
+
+	if err := config.verifyMail(); err != nil {
+		return err
+	}
+
+	if err := config.verifyQueries(); err != nil {
+		return err
+	}
+	if err := config.verifyRedirects(); err != nil {
+		return err
+	}
+
+	if err := config.verifyTemplates(); err != nil {
+		return err
+	}
+
+	if err := config.verifyWatchers(); err != nil {
+		return err
+	}
+
+	if err := config.verifyMocks(); err != nil {
+		return err
+	}
+
+	if err := config.verifyObservability(); err != nil {
+		return err
+	}
+
+	if err := config.verifyRetention(); err != nil {
+		return err
+	}
+
+	if err := config.verifyReports(); err != nil {
+		return err
+	}
+
+	if err := config.verifyQuotas(); err != nil {
+		return err
+	}
+
+	if err := config.verifySnapshots(); err != nil {
+		return err
+	}
+
+	if err := config.verifyBatches(); err != nil {
+		return err
+	}
+
+	if err := config.verifyWorkers(); err != nil {
+		return err
+	}
+
+	if _, err := time.ParseDuration(config.Database.Cache.Ttl); err != nil {
+		return fmt.Errorf("invalid database cache ttl: %s", err)
+	}
+
+	if _, err := time.ParseDuration(config.Reporting.Window); err != nil {
+		return fmt.Errorf("invalid reporting window: %s", err)
+	}
+
+	if err := config.verifyStartup(); err != nil {
+		return err
+	}
+
+	if err := config.verifyApiKeys(); err != nil {
+		return err
+	}
+
+	if err := config.verifyTenants(); err != nil {
+		return err
+	}
+
+	if err := config.verifyGroups(); err != nil {
+		return err
+	}
+
+	if config.SecurityHeaders != "" && config.SecurityHeaders != SecurityHeadersBasic && config.SecurityHeaders != SecurityHeadersStrict {
+		return fmt.Errorf(`unknown security headers preset "%s", expected %s or %s`, config.SecurityHeaders, SecurityHeadersBasic, SecurityHeadersStrict)
+	}
+
+	if config.Errors.Format != ErrorsLegacy && config.Errors.Format != ErrorsProblem {
+		return fmt.Errorf(`unknown errors format "%s", expected %s or %s`, config.Errors.Format, ErrorsLegacy, ErrorsProblem)
+	}
+
+	if _, err := messages.NewCatalog(config.Errors.Language, config.Errors.Messages); err != nil {
+		return fmt.Errorf("errors: %s", err)
+	}
+
+	if config.LogFormat != LogFormatText && config.LogFormat != LogFormatJson {
+		return fmt.Errorf(`unknown log format "%s", expected %s or %s`, config.LogFormat, LogFormatText, LogFormatJson)
+	}
+
+	if config.Recording.Sample < 0 || config.Recording.Sample > 1 {
+		return fmt.Errorf("recording sample must be between 0 and 1")
+	}
+
+	if config.Recording.Enable && config.Recording.Output == RecordingDatabase && !config.Database.Enable {
+		return fmt.Errorf("recording to database requires enabled database")
+	}
+
+	return nil
+}
+
+func Load(path string) (*Config, error) {
+	fmt.Printf("[Config] read config file: %s\n", path)
+
+	config := &Config{}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[Config] [Error] failed read config file: %s\n", err)
+	}
+
+	if data, err = decryptConfig(data); err != nil {
+		return nil, fmt.Errorf("[Config] [Error] failed decrypt config file: %s\n", err)
+	}
+
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("[Config] [Error] failed map config file: %s\n", err)
+	}
+
+	if err := verifyKeys(data, config.Strict); err != nil {
+		return nil, fmt.Errorf("[Config] [Error] failed verify config keys: %s\n", err)
+	}
+
+	config.setDefaults()
+
+	if config.Build.OutputDir, err = filepath.Abs(config.Build.OutputDir); err != nil {
+		return nil, fmt.Errorf("[Config] [Error] failed resolve build output directory: %s\n", err)
+	}
+
+	if err := config.verify(); err != nil {
+		return nil, fmt.Errorf("[Config] [Error] failed verify config file: %s\n", err)
+	}
 
 	return config, nil
 }
@@ -0,0 +1,265 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// KeyEnv is the environment variable of the base64 encoded 32 bytes master key of encrypted config values.
+	KeyEnv = "XSERVER_CONFIG_KEY"
+
+	encryptedPrefix = "ENC[aes256_gcm,"
+	encryptedSuffix = "]"
+)
+
+var (
+	// SensitiveKeys are names of config keys encrypted if no fields are selected.
+	SensitiveKeys = []string{"token", "secret", "github_secret", "unredact_token", "key", "dsn", "password"}
+)
+
+func masterKey() (cipher.AEAD, error) {
+	encoded := os.Getenv(KeyEnv)
+	if encoded == "" {
+		return nil, fmt.Errorf("master key env %s is not set", KeyEnv)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("master key env %s must be base64 encoded 32 bytes key", KeyEnv)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// GenerateKey returns a new base64 encoded master key.
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Encrypted reports whether the config file data has encrypted values.
+func Encrypted(data []byte) bool {
+	return strings.Contains(string(data), encryptedPrefix)
+}
+
+func encrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix) && strings.HasSuffix(value, encryptedSuffix)
+}
+
+func encryptValue(aead cipher.AEAD, value string) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed) + encryptedSuffix, nil
+}
+
+func decryptValue(aead cipher.AEAD, value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(value, encryptedPrefix), encryptedSuffix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("wrong master key or corrupted value")
+	}
+	return string(plain), nil
+}
+
+// transformNodes replaces string values of the yaml document in place, so comments and the layout of the file are kept,
+// path is the dotted path of the value e.g. "admin.token" or "startup.depends.0.url".
+func transformNodes(node *yaml.Node, path string, transform func(path string, value string) (string, error)) error {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := transformNodes(child, path, transform); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			if err := transformNodes(node.Content[index+1], join(node.Content[index].Value), transform); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for index, child := range node.Content {
+			if err := transformNodes(child, join(strconv.Itoa(index)), transform); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if node.ShortTag() != "!!str" {
+			return nil
+		}
+		transformed, err := transform(path, node.Value)
+		if err != nil {
+			return err
+		}
+		if transformed != node.Value {
+			node.Value = transformed
+			node.Style &^= yaml.LiteralStyle | yaml.FoldedStyle
+		}
+	}
+	return nil
+}
+
+// encodeDocument returns the yaml document with the two spaces indentation of config files.
+func encodeDocument(document *yaml.Node) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// selected returns whether the value path matches one of fields, fields with dots are full paths and other fields are key names at any depth.
+func selected(path string, fields []string) bool {
+	name := path[strings.LastIndex(path, ".")+1:]
+	for _, field := range fields {
+		if field == path || (!strings.Contains(field, ".") && field == name) {
+			return true
+		}
+	}
+	return false
+}
+
+// decryptConfig returns the config data with decrypted values, the data is returned as is if it has no encrypted values.
+func decryptConfig(data []byte) ([]byte, error) {
+	if !bytes.Contains(data, []byte(encryptedPrefix)) {
+		return data, nil
+	}
+
+	document := &yaml.Node{}
+	if err := yaml.Unmarshal(data, document); err != nil {
+		return nil, err
+	}
+
+	var aead cipher.AEAD
+	if err := transformNodes(document, "", func(path string, value string) (string, error) {
+		if !encrypted(value) {
+			return value, nil
+		}
+		if aead == nil {
+			var err error
+			if aead, err = masterKey(); err != nil {
+				return "", fmt.Errorf(`failed decrypt "%s": %s`, path, err)
+			}
+		}
+		plain, err := decryptValue(aead, value)
+		if err != nil {
+			return "", fmt.Errorf(`failed decrypt "%s": %s`, path, err)
+		}
+		return plain, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return encodeDocument(document)
+}
+
+// Encrypt encrypts values of the selected fields of the config file in place, SensitiveKeys are encrypted if no fields are selected.
+// Values are decrypted by Load with the master key from KeyEnv, returns paths of newly encrypted values.
+func Encrypt(path string, fields []string) ([]string, error) {
+	if len(fields) == 0 {
+		fields = SensitiveKeys
+	}
+
+	aead, err := masterKey()
+	if err != nil {
+		return nil, fmt.Errorf("[Config] [Encrypt] [Error] %s", err)
+	}
+
+	encryptedPaths := []string{}
+	err = rewriteConfig(path, func(valuePath string, value string) (string, error) {
+		if value == "" || encrypted(value) || !selected(valuePath, fields) {
+			return value, nil
+		}
+		encryptedPaths = append(encryptedPaths, valuePath)
+		return encryptValue(aead, value)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("[Config] [Encrypt] [Error] %s", err)
+	}
+	return encryptedPaths, nil
+}
+
+// Decrypt decrypts all encrypted values of the config file in place, returns paths of decrypted values.
+func Decrypt(path string) ([]string, error) {
+	aead, err := masterKey()
+	if err != nil {
+		return nil, fmt.Errorf("[Config] [Decrypt] [Error] %s", err)
+	}
+
+	decryptedPaths := []string{}
+	err = rewriteConfig(path, func(valuePath string, value string) (string, error) {
+		if !encrypted(value) {
+			return value, nil
+		}
+		plain, err := decryptValue(aead, value)
+		if err != nil {
+			return "", fmt.Errorf(`failed decrypt "%s": %s`, valuePath, err)
+		}
+		decryptedPaths = append(decryptedPaths, valuePath)
+		return plain, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("[Config] [Decrypt] [Error] %s", err)
+	}
+	return decryptedPaths, nil
+}
+
+// rewriteConfig transforms string values of the config file, comments and the order of keys are kept.
+func rewriteConfig(path string, transform func(path string, value string) (string, error)) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed read config file: %s", err)
+	}
+
+	document := &yaml.Node{}
+	if err := yaml.Unmarshal(data, document); err != nil {
+		return fmt.Errorf("failed parse config file: %s", err)
+	}
+	if err := transformNodes(document, "", transform); err != nil {
+		return err
+	}
+
+	rewritten, err := encodeDocument(document)
+	if err != nil {
+		return fmt.Errorf("failed encode config: %s", err)
+	}
+	if err := ioutil.WriteFile(path, rewritten, 0644); err != nil {
+		return fmt.Errorf("failed write config file: %s", err)
+	}
+	return nil
+}
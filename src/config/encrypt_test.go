@@ -0,0 +1,129 @@
+package config
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const encryptTestConfig = `# project config
+version: 1
+admin:
+  token: "123" # operator token
+database:
+  unredact_token: sesame
+  password: ""
+handlers:
+  a:
+    args:
+      - secret
+`
+
+func TestSelected(t *testing.T) {
+	tests := []struct {
+		path     string
+		fields   []string
+		expected bool
+	}{
+		{"admin.token", []string{"token"}, true},
+		{"admin.token", []string{"admin.token"}, true},
+		{"admin.token", []string{"webhooks.token"}, false},
+		{"notifications.channels.slack.url", []string{"url"}, true},
+		{"notifications.channels.slack.url", []string{"slack"}, false},
+		{"startup.depends.0.url", []string{"startup.depends.0.url"}, true},
+	}
+	for _, test := range tests {
+		if result := selected(test.path, test.fields); result != test.expected {
+			t.Errorf("selected(%q, %v) = %v, expected %v", test.path, test.fields, result, test.expected)
+		}
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(KeyEnv, key)
+
+	tests := []struct {
+		name     string
+		fields   []string
+		expected []string
+	}{
+		{"sensitive keys", nil, []string{"admin.token", "database.unredact_token"}},
+		{"selected path", []string{"handlers.a.args.0"}, []string{"handlers.a.args.0"}},
+		{"no matches", []string{"missing"}, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestConfig(t, encryptTestConfig)
+
+			encryptedPaths, err := Encrypt(path, test.fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(encryptedPaths, ",") != strings.Join(test.expected, ",") {
+				t.Fatalf("encrypted %v, expected %v", encryptedPaths, test.expected)
+			}
+			data, _ := ioutil.ReadFile(path)
+			if !strings.Contains(string(data), "# project config") || !strings.Contains(string(data), "# operator token") {
+				t.Fatalf("comments are not kept:\n%s", data)
+			}
+			if len(test.expected) != 0 && !Encrypted(data) {
+				t.Fatalf("values are not encrypted:\n%s", data)
+			}
+
+			decrypted, err := decryptConfig(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, value := range []string{`"123"`, "sesame", "- secret"} {
+				if !strings.Contains(string(decrypted), value) {
+					t.Fatalf("decrypted config has no %s:\n%s", value, decrypted)
+				}
+			}
+
+			decryptedPaths, err := Decrypt(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(decryptedPaths, ",") != strings.Join(test.expected, ",") {
+				t.Fatalf("decrypted %v, expected %v", decryptedPaths, test.expected)
+			}
+			data, _ = ioutil.ReadFile(path)
+			if string(data) != encryptTestConfig {
+				t.Fatalf("decrypted config differs:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestDecryptConfigErrors(t *testing.T) {
+	key, _ := GenerateKey()
+	otherKey, _ := GenerateKey()
+	t.Setenv(KeyEnv, key)
+	path := writeTestConfig(t, encryptTestConfig)
+	if _, err := Encrypt(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(path)
+
+	tests := []struct {
+		name string
+		key  string
+		data string
+	}{
+		{"missing key", "", string(data)},
+		{"wrong key", otherKey, string(data)},
+		{"malformed value", key, "token: ENC[aes256_gcm,###]\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(KeyEnv, test.key)
+			if _, err := decryptConfig([]byte(test.data)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
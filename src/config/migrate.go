@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	migrations = map[int]func(config yaml.MapSlice) (yaml.MapSlice, error){
+		0: migrateUnversioned,
+	}
+)
+
+func migrateUnversioned(config yaml.MapSlice) (yaml.MapSlice, error) {
+	return config, nil
+}
+
+// legacyPeriod converts the 5 fields period of the legacy cron_format, "second minute hour day_of_month month",
+// to the same 6 fields period, other periods are the same in both formats.
+func legacyPeriod(period string) string {
+	if fields := strings.Fields(period); len(fields) == 5 {
+		return strings.Join(append(fields, "*"), " ")
+	}
+	return period
+}
+
+// migrateCronFormat rewrites periods of the legacy cron_format keeping their schedules and selects the standard format.
+func migrateCronFormat(config yaml.MapSlice) (yaml.MapSlice, error) {
+	keys := []string{"database.maintenance.period", "snapshots.period"}
+	if tasks, ok := Lookup(config, "tasks"); ok {
+		items, _ := tasks.(yaml.MapSlice)
+		for _, item := range items {
+			keys = append(keys, fmt.Sprintf("tasks.%v.period", item.Key))
+		}
+	}
+
+	var err error
+	for _, key := range keys {
+		period, ok := Lookup(config, key)
+		if text, isText := period.(string); ok && isText && legacyPeriod(text) != text {
+			if config, err = Assign(config, key, legacyPeriod(text)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return Assign(config, "cron_format", CronFormatStandard)
+}
+
+func configVersion(config yaml.MapSlice) (int, error) {
+	for _, item := range config {
+		if item.Key != "version" {
+			continue
+		}
+		version, ok := item.Value.(int)
+		if !ok {
+			return 0, fmt.Errorf("version must be an integer, got %v", item.Value)
+		}
+		return version, nil
+	}
+	return 0, nil
+}
+
+func setConfigVersion(config yaml.MapSlice, version int) yaml.MapSlice {
+	for index, item := range config {
+		if item.Key == "version" {
+			config[index].Value = version
+			return config
+		}
+	}
+	return append(yaml.MapSlice{{Key: "version", Value: version}}, config...)
+}
+
+func Migrate(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("[Config] [Migrate] [Error] failed read config file: %s", err)
+	}
+
+	config := yaml.MapSlice{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return 0, fmt.Errorf("[Config] [Migrate] [Error] failed map config file: %s", err)
+	}
+
+	version, err := configVersion(config)
+	if err != nil {
+		return 0, fmt.Errorf("[Config] [Migrate] [Error] %s", err)
+	}
+	if version > Version {
+		return version, fmt.Errorf("[Config] [Migrate] [Error] config version %d is newer than supported %d, upgrade xserver", version, Version)
+	}
+	_, hasCronFormat := Lookup(config, "cron_format")
+	if version == Version && hasCronFormat {
+		return version, nil
+	}
+
+	for ; version < Version; version++ {
+		migration, ok := migrations[version]
+		if !ok {
+			return version, fmt.Errorf("[Config] [Migrate] [Error] migration from version %d is unknown", version)
+		}
+		if config, err = migration(config); err != nil {
+			return version, fmt.Errorf("[Config] [Migrate] [Error] failed migrate from version %d: %s", version, err)
+		}
+		config = setConfigVersion(config, version+1)
+	}
+
+	if !hasCronFormat {
+		if config, err = migrateCronFormat(config); err != nil {
+			return version, fmt.Errorf("[Config] [Migrate] [Error] failed migrate cron format: %s", err)
+		}
+	}
+
+	migrated, err := yaml.Marshal(config)
+	if err != nil {
+		return version, fmt.Errorf("[Config] [Migrate] [Error] failed encode config: %s", err)
+	}
+
+	if err := ioutil.WriteFile(path+".bak", data, 0644); err != nil {
+		return version, fmt.Errorf("[Config] [Migrate] [Error] failed write config backup: %s", err)
+	}
+
+	if err := ioutil.WriteFile(path, migrated, 0644); err != nil {
+		return version, fmt.Errorf("[Config] [Migrate] [Error] failed write config file: %s", err)
+	}
+
+	return version, nil
+}
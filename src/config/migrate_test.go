@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func writeTestConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLegacyPeriod(t *testing.T) {
+	tests := []struct {
+		period   string
+		expected string
+	}{
+		{"0 3 * * *", "0 3 * * * *"},
+		{"*/5  * * * *", "*/5 * * * * *"},
+		{"0 0 3 * * *", "0 0 3 * * *"},
+		{"@every 1m", "@every 1m"},
+		{"@daily", "@daily"},
+	}
+	for _, test := range tests {
+		if result := legacyPeriod(test.period); result != test.expected {
+			t.Errorf("legacyPeriod(%q) = %q, expected %q", test.period, result, test.expected)
+		}
+	}
+}
+
+func TestMigrateCronFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected map[string]string
+	}{
+		{
+			name:   "legacy periods",
+			config: "version: 1\ntasks:\n  a:\n    period: \"0 3 * * *\"\n  b:\n    period: \"@every 1m\"\n  c:\n    file: c.py\ndatabase:\n  maintenance:\n    period: \"0 0 3 * *\"\nsnapshots:\n  period: \"0 30 2 * *\"\n",
+			expected: map[string]string{
+				"tasks.a.period":              "0 3 * * * *",
+				"tasks.b.period":              "@every 1m",
+				"database.maintenance.period": "0 0 3 * * *",
+				"snapshots.period":            "0 30 2 * * *",
+				"cron_format":                 CronFormatStandard,
+			},
+		},
+		{
+			name:     "selected format",
+			config:   "version: 1\ncron_format: legacy\ntasks:\n  a:\n    period: \"0 3 * * *\"\n",
+			expected: map[string]string{"tasks.a.period": "0 3 * * *", "cron_format": CronFormatLegacy},
+		},
+		{
+			name:     "unversioned",
+			config:   "tasks:\n  a:\n    period: \"0 3 * * *\"\n",
+			expected: map[string]string{"tasks.a.period": "0 3 * * * *", "cron_format": CronFormatStandard, "version": "1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeTestConfig(t, test.config)
+			if _, err := Migrate(path); err != nil {
+				t.Fatal(err)
+			}
+			data, _ := ioutil.ReadFile(path)
+			document := yaml.MapSlice{}
+			if err := yaml.Unmarshal(data, &document); err != nil {
+				t.Fatal(err)
+			}
+			for key, expected := range test.expected {
+				value, ok := Lookup(document, key)
+				if !ok {
+					t.Fatalf("no %s in migrated config:\n%s", key, data)
+				}
+				if result := fmt.Sprint(value); result != expected {
+					t.Errorf("%s = %q, expected %q", key, result, expected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import "testing"
+
+func TestLowMemoryProfileDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  string
+		protocol map[string]string
+	}{
+		{
+			name:    "low memory",
+			profile: ProfileLowMemory,
+			protocol: map[string]string{
+				"plain":    ProtocolJsonRpc,
+				"tool":     ProtocolJsonRpc,
+				"exec":     "",
+				"http":     "http",
+				"plugin":   "",
+				"listener": "",
+				"mail":     "",
+				"watched":  "",
+			},
+		},
+		{
+			name:    "default",
+			profile: ProfileDefault,
+			protocol: map[string]string{
+				"plain":    "",
+				"tool":     "",
+				"exec":     "",
+				"http":     "http",
+				"plugin":   "",
+				"listener": "",
+				"mail":     "",
+				"watched":  "",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &Config{
+				Profile: test.profile,
+				Handlers: map[string]ExecutableServerUnit{
+					"plain":    {File: "plain.py"},
+					"tool":     {File: "tool.py", Run: &Run{Tool: "python3"}},
+					"exec":     {File: "exec.py", Run: &Run{Protocol: ProtocolExec}},
+					"http":     {File: "http.py", Run: &Run{Protocol: "http"}},
+					"plugin":   {File: "plugin.go", Run: &Run{Engine: "plugin"}},
+					"listener": {File: "listener.py", Listen: &Listen{Protocol: ListenTcp}},
+					"mail":     {File: "mail.py"},
+					"watched":  {File: "watched.py"},
+					"mock":     {Mock: &Mock{}},
+				},
+				Mail:     Mail{Recipients: map[string]string{"*@example.com": "mail"}},
+				Watchers: map[string]Watcher{"files": {Handler: "watched"}},
+			}
+			config.setDefaults()
+
+			for name, expected := range test.protocol {
+				protocol := ""
+				if run := config.Handlers[name].Run; run != nil {
+					protocol = run.Protocol
+				}
+				if protocol != expected {
+					t.Errorf(`protocol of "%s" handler is "%s", expected "%s"`, name, protocol, expected)
+				}
+			}
+			if run := config.Handlers["tool"].Run; run.Tool != "python3" {
+				t.Errorf("run options of handlers are not kept: %+v", run)
+			}
+			if config.Handlers["mock"].Run != nil {
+				t.Error("mocks must not get the runner")
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// schemaName is the name of sample map entries of the defaults config, e.g. "handlers.<name>.period".
+	schemaName = "<name>"
+)
+
+// schemaKeys returns yaml keys of the struct type with their types.
+func schemaKeys(structType reflect.Type) map[string]reflect.Type {
+	keys := map[string]reflect.Type{}
+	for index := 0; index < structType.NumField(); index++ {
+		field := structType.Field(index)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		keys[key] = field.Type
+	}
+	return keys
+}
+
+// suggestKey returns the known key closest to the unknown key, empty if no key is close enough.
+func suggestKey(key string, keys map[string]reflect.Type) string {
+	suggestion := ""
+	best := len(key)/2 + 1
+	for known := range keys {
+		if distance := editDistance(key, known); distance < best || (distance == best && known < suggestion) {
+			suggestion, best = known, distance
+		}
+	}
+	return suggestion
+}
+
+func editDistance(first string, second string) int {
+	previous := make([]int, len(second)+1)
+	current := make([]int, len(second)+1)
+	for index := range previous {
+		previous[index] = index
+	}
+	for i := 1; i <= len(first); i++ {
+		current[0] = i
+		for j := 1; j <= len(second); j++ {
+			cost := 1
+			if first[i-1] == second[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(second)]
+}
+
+// unknownKeys returns keys of the yaml value missing in the schema of the value type, e.g. "tasks.cleanup.peroid".
+func unknownKeys(value interface{}, valueType reflect.Type, path string) []string {
+	for valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	unknown := []string{}
+	switch valueType.Kind() {
+	case reflect.Struct:
+		document, ok := value.(yaml.MapSlice)
+		if !ok {
+			return unknown
+		}
+		keys := schemaKeys(valueType)
+		for _, item := range document {
+			key := fmt.Sprint(item.Key)
+			fieldType, ok := keys[key]
+			if !ok {
+				message := fmt.Sprintf(`unknown key "%s"`, join(key))
+				if suggestion := suggestKey(key, keys); suggestion != "" {
+					message += fmt.Sprintf(`, did you mean "%s"?`, suggestion)
+				}
+				unknown = append(unknown, message)
+				continue
+			}
+			unknown = append(unknown, unknownKeys(item.Value, fieldType, join(key))...)
+		}
+	case reflect.Map:
+		document, ok := value.(yaml.MapSlice)
+		if !ok {
+			return unknown
+		}
+		for _, item := range document {
+			unknown = append(unknown, unknownKeys(item.Value, valueType.Elem(), join(fmt.Sprint(item.Key)))...)
+		}
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			return unknown
+		}
+		for index, item := range items {
+			unknown = append(unknown, unknownKeys(item, valueType.Elem(), join(fmt.Sprint(index)))...)
+		}
+	}
+	return unknown
+}
+
+// verifyKeys reports keys of the config data unknown to the Config schema, they are errors in the strict mode and warnings otherwise.
+func verifyKeys(data []byte, strict bool) error {
+	document := yaml.MapSlice{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return err
+	}
+
+	unknown := unknownKeys(document, reflect.TypeOf(Config{}), "")
+	if len(unknown) == 0 {
+		return nil
+	}
+	if strict {
+		return fmt.Errorf("%s", strings.Join(unknown, "; "))
+	}
+	for _, message := range unknown {
+		fmt.Printf("[Config] [Warning] %s\n", message)
+	}
+	return nil
+}
+
+// fillSchema allocates nil pointers and adds sample entries to maps and lists of structs, so all keys of the schema are present.
+func fillSchema(value reflect.Value) {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		fillSchema(value.Elem())
+	case reflect.Struct:
+		for index := 0; index < value.NumField(); index++ {
+			fillSchema(value.Field(index))
+		}
+	case reflect.Map:
+		if value.IsNil() {
+			value.Set(reflect.MakeMap(value.Type()))
+		}
+		elemType := value.Type().Elem()
+		if elemType.Kind() == reflect.Struct || elemType.Kind() == reflect.Ptr {
+			elem := reflect.New(elemType).Elem()
+			fillSchema(elem)
+			value.SetMapIndex(reflect.ValueOf(schemaName), elem)
+		}
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Struct && value.Len() == 0 {
+			elem := reflect.New(value.Type().Elem()).Elem()
+			fillSchema(elem)
+			value.Set(reflect.Append(value, elem))
+		}
+	}
+}
+
+// Defaults returns the config of all keys with their default values of the profile, maps have "<name>" sample entries.
+func Defaults(profile string) ([]byte, error) {
+	config := &Config{Version: Version, Profile: profile}
+	fillSchema(reflect.ValueOf(config).Elem())
+	config.setDefaults()
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("[Config] [Error] failed encode defaults: %s", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	redactedValue = "[redacted]"
+)
+
+// transformValues replaces string values of the yaml document, path is the dotted path of the value e.g. "admin.token" or "startup.depends.0.url".
+func transformValues(value interface{}, path string, transform func(path string, value string) (interface{}, error)) (interface{}, error) {
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch current := value.(type) {
+	case yaml.MapSlice:
+		for index := range current {
+			transformed, err := transformValues(current[index].Value, join(fmt.Sprint(current[index].Key)), transform)
+			if err != nil {
+				return nil, err
+			}
+			current[index].Value = transformed
+		}
+		return current, nil
+	case []interface{}:
+		for index := range current {
+			transformed, err := transformValues(current[index], join(strconv.Itoa(index)), transform)
+			if err != nil {
+				return nil, err
+			}
+			current[index] = transformed
+		}
+		return current, nil
+	case string:
+		return transform(path, current)
+	}
+	return value, nil
+}
+
+// Document returns the config as yaml document with values of SensitiveKeys redacted.
+func (config *Config) Document() (yaml.MapSlice, error) {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	document := yaml.MapSlice{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	if _, err := transformValues(document, "", func(path string, value string) (interface{}, error) {
+		if value != "" && selected(path, SensitiveKeys) {
+			return redactedValue, nil
+		}
+		return value, nil
+	}); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// Lookup returns the value of the dotted key of the document, e.g. "tasks.cleanup.period", the whole document for the empty key.
+func Lookup(document yaml.MapSlice, key string) (interface{}, bool) {
+	var current interface{} = document
+	if key == "" {
+		return current, true
+	}
+	for _, part := range strings.Split(key, ".") {
+		items, ok := current.(yaml.MapSlice)
+		if !ok {
+			return nil, false
+		}
+		found := false
+		for _, item := range items {
+			if fmt.Sprint(item.Key) == part {
+				current, found = item.Value, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// Assign sets the value of the dotted key of the document, missing maps are added.
+func Assign(document yaml.MapSlice, key string, value interface{}) (yaml.MapSlice, error) {
+	parts := strings.SplitN(key, ".", 2)
+	for index, item := range document {
+		if fmt.Sprint(item.Key) != parts[0] {
+			continue
+		}
+		if len(parts) == 1 {
+			document[index].Value = value
+			return document, nil
+		}
+		nested, ok := item.Value.(yaml.MapSlice)
+		if !ok && item.Value != nil {
+			return nil, fmt.Errorf(`"%s" is not a map`, parts[0])
+		}
+		assigned, err := Assign(nested, parts[1], value)
+		if err != nil {
+			return nil, err
+		}
+		document[index].Value = assigned
+		return document, nil
+	}
+
+	if len(parts) == 1 {
+		return append(document, yaml.MapItem{Key: parts[0], Value: value}), nil
+	}
+	assigned, err := Assign(yaml.MapSlice{}, parts[1], value)
+	if err != nil {
+		return nil, err
+	}
+	return append(document, yaml.MapItem{Key: parts[0], Value: assigned}), nil
+}
+
+// Save writes the value of the dotted key to the config file, other values including encrypted ones are kept.
+func Save(path string, key string, value interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("[Config] [Save] [Error] failed read config file: %s", err)
+	}
+
+	document := yaml.MapSlice{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("[Config] [Save] [Error] failed parse config file: %s", err)
+	}
+	if document, err = Assign(document, key, value); err != nil {
+		return fmt.Errorf(`[Config] [Save] [Error] failed set "%s": %s`, key, err)
+	}
+
+	saved, err := yaml.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("[Config] [Save] [Error] failed encode config: %s", err)
+	}
+	if err := ioutil.WriteFile(path, saved, 0644); err != nil {
+		return fmt.Errorf("[Config] [Save] [Error] failed write config file: %s", err)
+	}
+	return nil
+}
+
+// Plain converts yaml documents of the value to maps, so the value can be encoded to json.
+func Plain(value interface{}) interface{} {
+	switch current := value.(type) {
+	case yaml.MapSlice:
+		result := map[string]interface{}{}
+		for _, item := range current {
+			result[fmt.Sprint(item.Key)] = Plain(item.Value)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(current))
+		for index, item := range current {
+			result[index] = Plain(item)
+		}
+		return result
+	}
+	return value
+}
@@ -0,0 +1,19 @@
+package config
+
+import "testing"
+
+func TestWebhookDefaults(t *testing.T) {
+	zero := 0
+	config := &Config{Webhooks: map[string]Webhook{
+		"default":         {Url: "http://localhost"},
+		"without retries": {Url: "http://localhost", Retries: &zero, Backoff: "5s"},
+	}}
+	config.setDefaults()
+
+	if webhook := config.Webhooks["default"]; webhook.Retries == nil || *webhook.Retries != defaultWebhookRetries || webhook.Backoff != defaultWebhookBackoff {
+		t.Fatalf("unexpected defaults %+v", webhook)
+	}
+	if webhook := config.Webhooks["without retries"]; webhook.Retries == nil || *webhook.Retries != 0 || webhook.Backoff != "5s" {
+		t.Fatalf("configured retries and backoff must be kept, got %+v", webhook)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"xserver/src/admin"
+	"xserver/src/config"
+	"xserver/src/console"
+	"xserver/src/database/schema"
+)
+
+const (
+	consoleHistoryFile = ".xserver_history"
+)
+
+var (
+	consoleCommands   = []string{"help", "handlers", "call", "tasks", "run", "tables", "select", "db", "metrics", "exit"}
+	consoleOperations = []string{"insert", "select", "update", "delete", "explain", "history", "restore"}
+)
+
+// consoleSession is the console connected to the running server.
+type consoleSession struct {
+	config      *config.Config
+	metricNames []string
+}
+
+func consoleHelp() {
+	fmt.Println("commands:")
+	fmt.Println("\thandlers: list handlers and their paths")
+	fmt.Println("\tcall <handler> [body]: call the handler, GET without body and POST with it")
+	fmt.Println("\ttasks: list tasks")
+	fmt.Println("\trun <task>: run the task now")
+	fmt.Println("\ttables: list database tables")
+	fmt.Println("\tselect <table> [filters]: select records of the table by json filters list")
+	fmt.Println("\tdb <operation> <request>: send the json request to the database operation endpoint")
+	fmt.Println("\tmetrics [prefix]: print metrics of the name prefix")
+	fmt.Println("\texit: close the console, Ctrl-D also closes it")
+}
+
+func consoleCommand(config *config.Config, arguments []string) error {
+	if len(arguments) != 0 {
+		usage()
+		return nil
+	}
+
+	if _, err := admin.Request(config, "/admin/modes", nil); err != nil {
+		return fmt.Errorf("[XServer] [Console] [Error] server is not available: %s", err)
+	}
+
+	historyPath := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		historyPath = filepath.Join(home, consoleHistoryFile)
+	}
+	session := &consoleSession{config: config}
+	lines := console.New(historyPath, session.complete)
+	defer lines.Close()
+
+	fmt.Printf("[XServer] [Console] connected to %s, type help for commands\n", admin.Url(config, ""))
+	for {
+		line, err := lines.ReadLine("xserver> ")
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			continue
+		}
+		if line == "exit" || line == "quit" {
+			return nil
+		}
+		if err := session.execute(line); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// printResponse prints the json response indented, other responses are printed as is.
+func printResponse(data []byte) {
+	indented := &bytes.Buffer{}
+	if err := json.Indent(indented, bytes.TrimSpace(data), "", "  "); err == nil {
+		fmt.Println(indented.String())
+		return
+	}
+	fmt.Println(strings.TrimRight(string(data), "\n"))
+}
+
+func (session *consoleSession) execute(line string) error {
+	command, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+	argument, body, _ := strings.Cut(rest, " ")
+	body = strings.TrimSpace(body)
+
+	switch command {
+	case "help":
+		consoleHelp()
+	case "handlers":
+		for _, name := range session.handlers() {
+			fmt.Printf("%s\t%s\n", name, session.config.HandlerPattern(name))
+		}
+	case "call":
+		if argument == "" {
+			return fmt.Errorf("usage: call <handler> [body]")
+		}
+		if _, ok := session.config.Handlers[argument]; !ok {
+			return fmt.Errorf(`[XServer] [Console] [Error] unknown handler "%s"`, argument)
+		}
+		path := session.config.HandlerPath(argument)
+		if path == "" {
+			return fmt.Errorf(`[XServer] [Console] [Error] "%s" handler has no path`, argument)
+		}
+		method := http.MethodGet
+		if body != "" {
+			method = http.MethodPost
+		}
+		status, data, err := admin.CallHost(session.config, strings.ToLower(session.config.Handlers[argument].Host), method, path, []byte(body))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d %s\n", status, http.StatusText(status))
+		printResponse(data)
+	case "tasks":
+		return session.request("/admin/tasks", nil)
+	case "run":
+		if argument == "" {
+			return fmt.Errorf("usage: run <task>")
+		}
+		return session.request("/admin/tasks/run", &taskRequest{Task: argument})
+	case "tables":
+		tables, err := session.tables()
+		if err != nil {
+			return err
+		}
+		fmt.Println(strings.Join(tables, "\n"))
+	case "select":
+		if argument == "" {
+			return fmt.Errorf("usage: select <table> [filters]")
+		}
+		request := map[string]interface{}{"table": argument}
+		if body != "" {
+			filters := []interface{}{}
+			if err := json.Unmarshal([]byte(body), &filters); err != nil {
+				return fmt.Errorf("[XServer] [Console] [Error] failed parse filters: %s", err)
+			}
+			request["filters"] = filters
+		}
+		data, _ := json.Marshal(request)
+		return session.database("select", data)
+	case "db":
+		if argument == "" || body == "" {
+			return fmt.Errorf("usage: db <operation> <request>")
+		}
+		return session.database(argument, []byte(body))
+	case "metrics":
+		status, data, err := admin.Call(session.config, http.MethodGet, "/metrics", nil)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return fmt.Errorf("[XServer] [Console] [Error] server responded with %d: %s", status, strings.TrimSpace(string(data)))
+		}
+		for _, metric := range strings.Split(string(data), "\n") {
+			if metric != "" && !strings.HasPrefix(metric, "#") && strings.HasPrefix(metric, argument) {
+				fmt.Println(metric)
+			}
+		}
+	default:
+		return fmt.Errorf(`[XServer] [Console] [Error] unknown command "%s", type help for commands`, command)
+	}
+	return nil
+}
+
+func (session *consoleSession) request(path string, body interface{}) error {
+	data, err := admin.Request(session.config, path, body)
+	if err != nil {
+		return err
+	}
+	printResponse(data)
+	return nil
+}
+
+func (session *consoleSession) database(operation string, body []byte) error {
+	status, data, err := admin.Call(session.config, http.MethodPost, "/db/"+operation, body)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		fmt.Printf("%d %s\n", status, http.StatusText(status))
+	}
+	printResponse(data)
+	return nil
+}
+
+func (session *consoleSession) handlers() []string {
+	names := []string{}
+	for name := range session.config.Handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (session *consoleSession) tasks() []string {
+	names := []string{}
+	for name := range session.config.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (session *consoleSession) tables() ([]string, error) {
+	if !session.config.Database.Enable {
+		return nil, fmt.Errorf("[XServer] [Console] [Error] database is disabled")
+	}
+	data, err := os.ReadFile(session.config.Database.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Console] [Error] failed read database schema: %s", err)
+	}
+	tables, err := schema.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Console] [Error] failed parse database schema: %s", err)
+	}
+	names := []string{}
+	for _, table := range tables {
+		names = append(names, table.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// metrics returns metrics names of the server, they are requested once.
+func (session *consoleSession) metrics() []string {
+	if session.metricNames != nil {
+		return session.metricNames
+	}
+	status, data, err := admin.Call(session.config, http.MethodGet, "/metrics", nil)
+	if err != nil || status != http.StatusOK {
+		return nil
+	}
+	session.metricNames = []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if name, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			session.metricNames = append(session.metricNames, strings.Fields(name)[0])
+		}
+	}
+	return session.metricNames
+}
+
+// complete returns candidates of the last word: commands first and their arguments by the command.
+func (session *consoleSession) complete(line string) []string {
+	words := strings.Fields(line)
+	if strings.HasSuffix(line, " ") || len(words) == 0 {
+		words = append(words, "")
+	}
+
+	options := []string{}
+	switch {
+	case len(words) == 1:
+		options = consoleCommands
+	case len(words) == 2 && words[0] == "call":
+		options = session.handlers()
+	case len(words) == 2 && words[0] == "run":
+		options = session.tasks()
+	case len(words) == 2 && words[0] == "select":
+		options, _ = session.tables()
+	case len(words) == 2 && words[0] == "db":
+		options = consoleOperations
+	case len(words) == 2 && words[0] == "metrics":
+		options = session.metrics()
+	}
+
+	word := words[len(words)-1]
+	candidates := []string{}
+	for _, option := range options {
+		if strings.HasPrefix(option, word) {
+			candidates = append(candidates, option)
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,248 @@
+package console
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	maxHistory = 1000
+)
+
+// Console reads lines of the interactive console with history and tab completion,
+// lines are read without editing if the input is not a terminal.
+type Console struct {
+	input       *os.File
+	output      io.Writer
+	reader      *bufio.Reader
+	history     []string
+	historyPath string
+	complete    func(line string) []string
+}
+
+// New creates the console with the history of the file, complete returns candidates of the last word of the line.
+func New(historyPath string, complete func(line string) []string) *Console {
+	console := &Console{
+		input:       os.Stdin,
+		output:      os.Stdout,
+		reader:      bufio.NewReader(os.Stdin),
+		history:     []string{},
+		historyPath: historyPath,
+		complete:    complete,
+	}
+	if data, err := os.ReadFile(historyPath); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if line != "" {
+				console.history = append(console.history, line)
+			}
+		}
+	}
+	return console
+}
+
+// Close saves the history.
+func (console *Console) Close() error {
+	if console.historyPath == "" {
+		return nil
+	}
+	history := console.history
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+	return os.WriteFile(console.historyPath, []byte(strings.Join(history, "\n")+"\n"), 0600)
+}
+
+// ReadLine returns the next line, io.EOF is returned on Ctrl-D of the empty line or the end of the input.
+func (console *Console) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(int(console.input.Fd()))
+	var line string
+	if err != nil {
+		line, err = console.readPlain(prompt)
+	} else {
+		line, err = console.readRaw(prompt)
+		restore()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	line = strings.TrimSpace(line)
+	if line != "" && (len(console.history) == 0 || console.history[len(console.history)-1] != line) {
+		console.history = append(console.history, line)
+	}
+	return line, nil
+}
+
+func (console *Console) readPlain(prompt string) (string, error) {
+	fmt.Fprint(console.output, prompt)
+	line, err := console.reader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", io.EOF
+	}
+	return line, nil
+}
+
+type editor struct {
+	console      *Console
+	prompt       string
+	buffer       []rune
+	cursor       int
+	historyIndex int
+	current      []rune
+}
+
+func (editor *editor) redraw() {
+	fmt.Fprintf(editor.console.output, "\r\x1b[K%s%s", editor.prompt, string(editor.buffer))
+	if back := len(editor.buffer) - editor.cursor; back > 0 {
+		fmt.Fprintf(editor.console.output, "\x1b[%dD", back)
+	}
+}
+
+func (editor *editor) set(line []rune) {
+	editor.buffer = append([]rune{}, line...)
+	editor.cursor = len(editor.buffer)
+}
+
+func (editor *editor) insert(text []rune) {
+	buffer := append([]rune{}, editor.buffer[:editor.cursor]...)
+	buffer = append(buffer, text...)
+	editor.buffer = append(buffer, editor.buffer[editor.cursor:]...)
+	editor.cursor += len(text)
+}
+
+func (editor *editor) browse(step int) {
+	index := editor.historyIndex + step
+	history := editor.console.history
+	if index < 0 || index > len(history) {
+		return
+	}
+	if editor.historyIndex == len(history) {
+		editor.current = editor.buffer
+	}
+	editor.historyIndex = index
+	if index == len(history) {
+		editor.set(editor.current)
+	} else {
+		editor.set([]rune(history[index]))
+	}
+}
+
+// completeWord extends the last word by the common prefix of candidates and lists them if it can't be extended.
+func (editor *editor) completeWord() {
+	if editor.console.complete == nil {
+		return
+	}
+	line := string(editor.buffer[:editor.cursor])
+	word := line[strings.LastIndexAny(line, " \t")+1:]
+	candidates := editor.console.complete(line)
+	if len(candidates) == 0 {
+		return
+	}
+
+	prefix := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(candidates) == 1 {
+		prefix += " "
+	}
+	if len(prefix) > len(word) && strings.HasPrefix(prefix, word) {
+		editor.insert([]rune(prefix[len(word):]))
+		return
+	}
+	if len(candidates) > 1 {
+		sort.Strings(candidates)
+		fmt.Fprintf(editor.console.output, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	}
+}
+
+func (console *Console) readRaw(prompt string) (string, error) {
+	editor := &editor{console: console, prompt: prompt, buffer: []rune{}, historyIndex: len(console.history)}
+	editor.redraw()
+	for {
+		key, _, err := console.reader.ReadRune()
+		if err != nil {
+			fmt.Fprint(console.output, "\r\n")
+			return "", io.EOF
+		}
+
+		switch key {
+		case '\r', '\n':
+			fmt.Fprint(console.output, "\r\n")
+			return string(editor.buffer), nil
+		case 3: // Ctrl-C drops the line
+			fmt.Fprint(console.output, "^C\r\n")
+			return "", nil
+		case 4: // Ctrl-D
+			if len(editor.buffer) == 0 {
+				fmt.Fprint(console.output, "\r\n")
+				return "", io.EOF
+			}
+			if editor.cursor < len(editor.buffer) {
+				editor.buffer = append(editor.buffer[:editor.cursor], editor.buffer[editor.cursor+1:]...)
+			}
+		case 127, 8:
+			if editor.cursor > 0 {
+				editor.buffer = append(editor.buffer[:editor.cursor-1], editor.buffer[editor.cursor:]...)
+				editor.cursor--
+			}
+		case 1: // Ctrl-A
+			editor.cursor = 0
+		case 5: // Ctrl-E
+			editor.cursor = len(editor.buffer)
+		case 11: // Ctrl-K
+			editor.buffer = editor.buffer[:editor.cursor]
+		case 21: // Ctrl-U
+			editor.buffer = editor.buffer[editor.cursor:]
+			editor.cursor = 0
+		case '\t':
+			editor.completeWord()
+		case 27:
+			console.escape(editor)
+		default:
+			if key >= 32 {
+				editor.insert([]rune{key})
+			}
+		}
+		editor.redraw()
+	}
+}
+
+// escape handles arrows, home, end and delete keys sequences.
+func (console *Console) escape(editor *editor) {
+	if next, _, err := console.reader.ReadRune(); err != nil || (next != '[' && next != 'O') {
+		return
+	}
+	code, _, err := console.reader.ReadRune()
+	if err != nil {
+		return
+	}
+	switch code {
+	case 'A':
+		editor.browse(-1)
+	case 'B':
+		editor.browse(1)
+	case 'C':
+		if editor.cursor < len(editor.buffer) {
+			editor.cursor++
+		}
+	case 'D':
+		if editor.cursor > 0 {
+			editor.cursor--
+		}
+	case 'H':
+		editor.cursor = 0
+	case 'F':
+		editor.cursor = len(editor.buffer)
+	case '3':
+		if next, _, err := console.reader.ReadRune(); err == nil && next == '~' && editor.cursor < len(editor.buffer) {
+			editor.buffer = append(editor.buffer[:editor.cursor], editor.buffer[editor.cursor+1:]...)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package console
+
+import "errors"
+
+// makeRaw is supported on Linux only, lines are read without editing on other platforms.
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported")
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"xserver/src/cbor"
+	"xserver/src/metrics"
+	"xserver/src/msgpack"
+	"xserver/src/problem"
+)
+
+// codec is the binary encoding of json requests and responses.
+type codec struct {
+	name        string
+	contentType string
+	marshal     func(value interface{}) ([]byte, error)
+	unmarshal   func(data []byte) (interface{}, error)
+}
+
+var (
+	codecs = []codec{
+		{name: "msgpack", contentType: msgpack.ContentType, marshal: msgpack.Marshal, unmarshal: msgpack.Unmarshal},
+		{name: "cbor", contentType: cbor.ContentType, marshal: cbor.Marshal, unmarshal: cbor.Unmarshal},
+	}
+)
+
+func init() {
+	metrics.Register("xserver_db_binary_requests_total", metrics.CounterType, "Number of database requests or responses encoded as msgpack or cbor.")
+}
+
+// findCodec returns the codec of the content type.
+func findCodec(contentType string) *codec {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	if msgpack.Is(mediaType) {
+		return &codecs[0]
+	}
+	if cbor.Is(mediaType) {
+		return &codecs[1]
+	}
+	return nil
+}
+
+// acceptedCodec returns the codec of the first binary media type named by the Accept header.
+func acceptedCodec(accept string) *codec {
+	for _, part := range strings.Split(accept, ",") {
+		if found := findCodec(strings.TrimSpace(part)); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Binary serves /db endpoints with msgpack and cbor bodies: requests are passed to the endpoint as json,
+// responses are encoded by the codec named by Accept or by the codec of the request.
+func Binary(operation string, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		requestCodec := findCodec(request.Header.Get("Content-Type"))
+		responseCodec := acceptedCodec(request.Header.Get("Accept"))
+		if responseCodec == nil {
+			responseCodec = requestCodec
+		}
+		if requestCodec == nil && responseCodec == nil {
+			next(writer, request)
+			return
+		}
+		metrics.Inc("xserver_db_binary_requests_total", "operation", operation, "encoding", responseCodec.name)
+
+		if requestCodec != nil {
+			data, err := io.ReadAll(request.Body)
+			var decoded interface{}
+			if err == nil {
+				decoded, err = requestCodec.unmarshal(data)
+			}
+			if err == nil {
+				data, err = json.Marshal(decoded)
+			}
+			if err != nil {
+				problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, fmt.Sprintf("[XServer] [Database] [Error] failed decode %s request: %s", requestCodec.name, err)).WithResult(false))
+				return
+			}
+			request.Body = io.NopCloser(bytes.NewReader(data))
+			request.ContentLength = int64(len(data))
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("Content-Length", strconv.Itoa(len(data)))
+		}
+
+		buffered := &bufferedWriter{ResponseWriter: writer, status: http.StatusOK}
+		next(buffered, request)
+
+		decoder := json.NewDecoder(bytes.NewReader(buffered.body.Bytes()))
+		decoder.UseNumber()
+		var response interface{}
+		err := decoder.Decode(&response)
+		var encoded []byte
+		if err == nil {
+			encoded, err = responseCodec.marshal(response)
+		}
+		if err != nil {
+			writer.WriteHeader(buffered.status)
+			writer.Write(buffered.body.Bytes())
+			return
+		}
+		writer.Header().Del("Content-Length")
+		writer.Header().Set("Content-Type", responseCodec.contentType)
+		writer.WriteHeader(buffered.status)
+		writer.Write(encoded)
+	}
+}
+
+// Encodings serves /db endpoints with protobuf, msgpack and cbor bodies besides json.
+func Encodings(operation string, next http.HandlerFunc) http.HandlerFunc {
+	return Protobuf(operation, Binary(operation, next))
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+	"xserver/src/metrics"
+)
+
+func init() {
+	metrics.Register("xserver_db_cache_hits_total", metrics.CounterType, "Number of select requests served from the cache.")
+	metrics.Register("xserver_db_cache_misses_total", metrics.CounterType, "Number of select requests missed the cache.")
+	metrics.Register("xserver_db_cache_entries", metrics.GaugeType, "Number of cached select responses.")
+}
+
+type cacheEntry struct {
+	response  []byte
+	expiresAt time.Time
+	tables    map[string]bool
+}
+
+// cache keeps select responses until the ttl expires or any table of the response is written.
+type cache struct {
+	mutex      sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*cacheEntry
+	generation uint64
+}
+
+func newCache(ttl time.Duration, maxEntries int) *cache {
+	return &cache{ttl: ttl, maxEntries: maxEntries, entries: map[string]*cacheEntry{}}
+}
+
+func cacheKey(request *Request) string {
+	key, _ := json.Marshal(request)
+	return string(key)
+}
+
+// get returns the cached response and the cache generation, responses selected during writes of other generations are not cached.
+func (cache *cache) get(request *Request) ([]byte, uint64, bool) {
+	if cache == nil || strings.HasPrefix(request.Table, "__") {
+		return nil, 0, false
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	key := cacheKey(request)
+	entry, ok := cache.entries[key]
+	if ok && time.Now().After(entry.expiresAt) {
+		delete(cache.entries, key)
+		ok = false
+	}
+	if !ok {
+		metrics.Inc("xserver_db_cache_misses_total", "table", request.Table)
+		metrics.Set("xserver_db_cache_entries", float64(len(cache.entries)))
+		return nil, cache.generation, false
+	}
+	metrics.Inc("xserver_db_cache_hits_total", "table", request.Table)
+	return entry.response, cache.generation, true
+}
+
+// put caches the response of the request depending on the tables, expired or the soonest expiring entries are dropped if the cache is full.
+func (cache *cache) put(request *Request, generation uint64, tables []string, response []byte) {
+	if cache == nil || strings.HasPrefix(request.Table, "__") {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if generation != cache.generation {
+		return
+	}
+
+	now := time.Now()
+	if len(cache.entries) >= cache.maxEntries {
+		soonestKey := ""
+		for key, entry := range cache.entries {
+			if now.After(entry.expiresAt) {
+				delete(cache.entries, key)
+				continue
+			}
+			if soonestKey == "" || entry.expiresAt.Before(cache.entries[soonestKey].expiresAt) {
+				soonestKey = key
+			}
+		}
+		if len(cache.entries) >= cache.maxEntries {
+			delete(cache.entries, soonestKey)
+		}
+	}
+
+	entry := &cacheEntry{response: response, expiresAt: now.Add(cache.ttl), tables: map[string]bool{}}
+	for _, table := range tables {
+		entry.tables[table] = true
+	}
+	cache.entries[cacheKey(request)] = entry
+	metrics.Set("xserver_db_cache_entries", float64(len(cache.entries)))
+}
+
+// invalidate drops responses depending on the table, all responses are dropped for the empty table.
+func (cache *cache) invalidate(table string) {
+	if cache == nil {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.generation++
+	for key, entry := range cache.entries {
+		if table == "" || entry.tables[table] {
+			delete(cache.entries, key)
+		}
+	}
+	metrics.Set("xserver_db_cache_entries", float64(len(cache.entries)))
+}
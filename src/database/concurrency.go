@@ -0,0 +1,49 @@
+package database
+
+import (
+	"fmt"
+	"xserver/src/database/schema"
+)
+
+// ConflictError is returned by conditional writes of records changed since the requested revision, it is responded with 409 status.
+type ConflictError struct {
+	Table    string
+	Revision int64
+}
+
+func (err *ConflictError) Error() string {
+	return fmt.Sprintf(`[XServer] [Database] [Error] "%s" record is changed since revision %d`, err.Table, err.Revision)
+}
+
+func (database *Database) checkIfRevision(request *Request) error {
+	if request.IfRevision != nil && !database.table(request.Table).Versioned {
+		return fmt.Errorf(`[XServer] [Database] [Error] if_revision of not versioned "%s" table`, request.Table)
+	}
+	return nil
+}
+
+// conflict returns the conflict error if the conditional write changed nothing while records matched by filters exist.
+func (database *Database) conflict(request *Request, affected int64) error {
+	if request.IfRevision == nil || affected != 0 {
+		return nil
+	}
+
+	unconditional := *request
+	unconditional.IfRevision = nil
+	count := 0
+	if err := database.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", request.Table) + database.filtersClause(&unconditional)).Scan(&count); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed check revision conflict: %s", err)
+	}
+	if count != 0 {
+		return &ConflictError{Table: request.Table, Revision: *request.IfRevision}
+	}
+	return nil
+}
+
+// revisionIncrement returns the SET expression of the next revision for versioned tables.
+func revisionIncrement(table schema.Table) string {
+	if !table.Versioned {
+		return ""
+	}
+	return fmt.Sprintf("%s = %s + 1", schema.RevisionField, schema.RevisionField)
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// cursor is the position after the last record of the page, records are ordered by the primary key,
+// so records inserted or deleted meanwhile don't shift next pages as offsets do.
+type cursor struct {
+	Table   string   `json:"t"`
+	Filters string   `json:"f"`
+	Key     []string `json:"k"`
+}
+
+// filtersDigest identifies filters of the request, cursors are valid only for requests with the same filters.
+func filtersDigest(request *Request) string {
+	data, _ := json.Marshal([]interface{}{request.Filters, request.WithDeleted})
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:8])
+}
+
+// verifyPage checks the limit and the cursor of the request, pages are ordered by the primary key of the table.
+func (database *Database) verifyPage(request *Request) error {
+	if request.Limit == 0 && request.Cursor == "" {
+		return nil
+	}
+	if request.Limit <= 0 {
+		return fmt.Errorf("[XServer] [Database] [Select] [Error] limit must be positive for cursor pagination")
+	}
+	table := database.table(request.Table)
+	if len(table.PrimaryKey) == 0 {
+		return fmt.Errorf(`[XServer] [Database] [Select] [Error] cursor pagination of "%s" table requires primary key`, request.Table)
+	}
+	redactedKey := redactedFields(table)
+	for _, fieldName := range table.PrimaryKey {
+		if redactedKey[fieldName] && !database.unredacted(request.Unredact) {
+			return fmt.Errorf(`[XServer] [Database] [Select] [Error] cursor pagination of "%s" table with redacted primary key requires unredact token`, request.Table)
+		}
+	}
+	if request.Cursor == "" {
+		return nil
+	}
+	_, err := database.decodeCursor(request)
+	return err
+}
+
+func (database *Database) decodeCursor(request *Request) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(request.Cursor)
+	position := &cursor{}
+	if err == nil {
+		err = json.Unmarshal(data, position)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Database] [Select] [Error] invalid cursor")
+	}
+	if position.Table != request.Table || position.Filters != filtersDigest(request) || len(position.Key) != len(database.table(request.Table).PrimaryKey) {
+		return nil, fmt.Errorf("[XServer] [Database] [Select] [Error] cursor does not match the table and filters of the request")
+	}
+	return position, nil
+}
+
+// pageClauses returns the condition of records after the cursor and the ORDER BY and LIMIT clauses of the page,
+// one record more than the limit is selected to know whether the next page exists.
+func (database *Database) pageClauses(request *Request) (string, string) {
+	if request.Limit <= 0 {
+		return "", ""
+	}
+	key := database.table(request.Table).PrimaryKey
+	order := fmt.Sprintf(" ORDER BY %s LIMIT %d", strings.Join(key, ", "), request.Limit+1)
+	position, err := database.decodeCursor(request)
+	if request.Cursor == "" || err != nil {
+		return "", order
+	}
+	values := []string{}
+	for _, value := range position.Key {
+		values = append(values, quote(value))
+	}
+	if len(key) == 1 {
+		return fmt.Sprintf("%s > %s", key[0], values[0]), order
+	}
+	return fmt.Sprintf("(%s) > (%s)", strings.Join(key, ", "), strings.Join(values, ", ")), order
+}
+
+// pageFields returns selected fields with primary key fields of the table, the cursor is made of them.
+func (database *Database) pageFields(request *Request) []RequestField {
+	if request.Limit <= 0 || len(request.Fields) == 0 {
+		return request.Fields
+	}
+	fields := append([]RequestField{}, request.Fields...)
+	for _, fieldName := range database.table(request.Table).PrimaryKey {
+		selected := false
+		for _, field := range request.Fields {
+			selected = selected || field.Name == fieldName
+		}
+		if !selected {
+			fields = append(fields, RequestField{Name: fieldName})
+		}
+	}
+	return fields
+}
+
+// nextCursor drops the record after the page and returns the cursor of the next page, the last page has no cursor.
+func (database *Database) nextCursor(request *Request, columns []string, rows [][]sql.NullString) ([][]sql.NullString, string) {
+	if request.Limit <= 0 || len(rows) <= request.Limit {
+		return rows, ""
+	}
+	rows = rows[:request.Limit]
+	last := rows[len(rows)-1]
+	position := cursor{Table: request.Table, Filters: filtersDigest(request)}
+	for _, fieldName := range database.table(request.Table).PrimaryKey {
+		for i, column := range columns {
+			if column == fieldName {
+				position.Key = append(position.Key, last[i].String)
+			}
+		}
+	}
+	data, _ := json.Marshal(position)
+	return rows, base64.RawURLEncoding.EncodeToString(data)
+}
@@ -3,10 +3,14 @@ package database
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 	"xserver/src/config"
 	"xserver/src/database/schema"
 	"xserver/src/logger"
@@ -26,25 +30,63 @@ type RequestField struct {
 }
 
 type Request struct {
-	Table   string          `json:"table"`
-	Fields  []RequestField  `json:"fields"`
-	Filters []RequestFilter `json:"filters"`
+	Table       string          `json:"table"`
+	Fields      []RequestField  `json:"fields"`
+	Filters     []RequestFilter `json:"filters"`
+	WithDeleted bool            `json:"with_deleted"`
+	Include     []string        `json:"include"`
+	IfRevision  *int64          `json:"if_revision"`
+	Unredact    string          `json:"unredact,omitempty"`
+	Limit       int             `json:"limit,omitempty"`
+	Cursor      string          `json:"cursor,omitempty"`
 }
 
 type Database struct {
-	config *config.Database
-	db     *sql.DB
+	config           *config.Database
+	db               *sql.DB
+	maintenanceMutex sync.Mutex
+	quotaMutex       sync.Mutex
+	quotaAlerts      map[string]bool
+	tablesMutex      sync.RWMutex
+	tables           map[string]schema.Table
+	patterns         map[string]*regexp.Regexp
+	cache            *cache
+	encryption       *encryption
+	fileEncryption   bool
+	queriesMutex     sync.RWMutex
+	queries          map[string]NamedQuery
+	apiKeys          map[string]bool
 }
 
 func Create(config *config.Config) (*Database, error) {
-	db, err := sql.Open("sqlite3", config.Database.Storage)
+	db, fileEncryption, err := openStorage(&config.Database)
 	if err != nil {
-		return nil, fmt.Errorf("[XServer] [Database] [Error] failed open database: %s", err)
+		return nil, err
 	}
 
 	database := &Database{
-		config: &config.Database,
-		db:     db,
+		config:         &config.Database,
+		db:             db,
+		quotaAlerts:    map[string]bool{},
+		fileEncryption: fileEncryption,
+	}
+
+	if config.Database.Cache.Enable {
+		ttl, err := time.ParseDuration(config.Database.Cache.Ttl)
+		if err != nil {
+			return nil, fmt.Errorf("[XServer] [Database] [Error] failed parse cache ttl: %s", err)
+		}
+		database.cache = newCache(ttl, config.Database.Cache.MaxEntries)
+	}
+
+	if database.encryption, err = newEncryption(config.Database.Encryption); err != nil {
+		return nil, err
+	}
+
+	if config.Database.SnapshotReads {
+		if err := database.enableSnapshotReads(); err != nil {
+			return nil, err
+		}
 	}
 
 	schemaFile, err := os.Open(config.Database.Schema)
@@ -57,6 +99,38 @@ func Create(config *config.Config) (*Database, error) {
 		return nil, err
 	}
 
+	if err := database.initTaskHistory(); err != nil {
+		return nil, err
+	}
+
+	if err := database.initKeyValue(); err != nil {
+		return nil, err
+	}
+
+	if err := database.initFlags(); err != nil {
+		return nil, err
+	}
+
+	if err := database.initRecordings(); err != nil {
+		return nil, err
+	}
+
+	if err := database.initRevisions(); err != nil {
+		return nil, err
+	}
+
+	if err := database.initUsage(); err != nil {
+		return nil, err
+	}
+
+	if err := database.initIdempotency(); err != nil {
+		return nil, err
+	}
+
+	if err := database.initQueries(config); err != nil {
+		return nil, err
+	}
+
 	return database, nil
 }
 
@@ -64,6 +138,18 @@ func (database *Database) Close() {
 	database.db.Close()
 }
 
+func (database *Database) table(name string) schema.Table {
+	database.tablesMutex.RLock()
+	defer database.tablesMutex.RUnlock()
+	return database.tables[name]
+}
+
+// Table returns the schema of the table.
+func (database *Database) Table(name string) (schema.Table, bool) {
+	table := database.table(name)
+	return table, table.Name != ""
+}
+
 func (database *Database) SetSchema(data io.Reader) error {
 	shcemaData, err := io.ReadAll(data)
 	if err != nil {
@@ -77,132 +163,363 @@ func (database *Database) SetSchema(data io.Reader) error {
 		return fmt.Errorf("[XServer] [Database] [Error] failed verify schema: %s", err)
 	}
 
+	for _, table := range tables {
+		if len(encryptedFields(table)) != 0 && database.encryption == nil {
+			return fmt.Errorf(`[XServer] [Database] [Error] encrypted fields of "%s" table require database.encryption.key_env`, table.Name)
+		}
+	}
+
 	if err := schema.Migration(database.db, shcemaData); err != nil {
 		return err
 	}
 
+	tablesMap := map[string]schema.Table{}
+	patterns := map[string]*regexp.Regexp{}
+	for _, table := range tables {
+		tablesMap[table.Name] = table
+		for _, field := range table.Fields {
+			if field.Pattern != "" {
+				patterns[field.Pattern] = regexp.MustCompile(field.Pattern)
+			}
+		}
+	}
+	database.tablesMutex.Lock()
+	database.tables = tablesMap
+	database.patterns = patterns
+	database.tablesMutex.Unlock()
+	database.cache.invalidate("")
+
 	return nil
 }
 
-func (database *Database) Insert(data io.Reader, responseWriter io.Writer) error {
-	request := &Request{}
-	if err := json.NewDecoder(data).Decode(request); err != nil {
-		return fmt.Errorf("[XServer] [Database] [Insert] [Error] failed decode json request: %s", err)
+// InsertRecord inserts the record and returns its rowid.
+func (database *Database) InsertRecord(request *Request) (int64, error) {
+	if err := database.validate(request, true); err != nil {
+		return 0, err
+	}
+	if err := database.checkQuotas(request, true); err != nil {
+		return 0, err
+	}
+	request.Fields = append(request.Fields, database.defaults(request)...)
+	fields, err := database.encryptFields(request)
+	if err != nil {
+		return 0, err
 	}
 
 	names := []string{}
-	for _, field := range request.Fields {
+	for _, field := range fields {
 		names = append(names, field.Name)
 	}
 
 	values := []string{}
-	for _, field := range request.Fields {
+	for _, field := range fields {
 		values = append(values, field.Value)
 	}
 
 	sqlCommand := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", request.Table, strings.Join(names, ", "), strings.Join(values, ", "))
-	logger.Debug(fmt.Sprintf("[XServer] [Database] [Insert] sql request: %s", sqlCommand))
+	logger.Debug(fmt.Sprintf("[XServer] [Database] [Insert] sql request: %s", database.redactSql(request, sqlCommand)))
 
-	_, err := database.db.Exec(sqlCommand)
+	startedAt := time.Now()
+	result, err := database.write("insert", request, sqlCommand, "")
+	observeQuery("insert", request.Table, startedAt)
+	if constraintErr := constraintError(request.Table, err); constraintErr != nil {
+		return 0, constraintErr
+	}
 	if err != nil {
-		return fmt.Errorf("[XServer] [Database] [Insert] [Error] failed database request: %s", err)
+		return 0, fmt.Errorf("[XServer] [Database] [Insert] [Error] failed database request: %s", err)
 	}
+	database.evict(request.Table)
 
-	responseWriter.Write([]byte(`{"result": true}`))
-	return nil
+	return result.LastInsertId()
 }
 
-func (database *Database) Select(data io.Reader, responseWriter io.Writer) error {
+// decodeRequest decodes the json request of the operation, internal tables are not addressable by requests.
+func decodeRequest(operation string, data io.Reader) (*Request, error) {
 	request := &Request{}
 	if err := json.NewDecoder(data).Decode(request); err != nil {
-		return fmt.Errorf("[XServer] [Database] [Select] [Error] failed decode json request: %s", err)
+		return nil, fmt.Errorf("[XServer] [Database] [%s] [Error] failed decode json request: %s", operation, err)
+	}
+	if err := checkTable(operation, request.Table); err != nil {
+		return nil, err
 	}
+	return request, nil
+}
+
+func checkTable(operation string, tableName string) error {
+	if strings.HasPrefix(tableName, "__") {
+		return fmt.Errorf(`[XServer] [Database] [%s] [Error] unknown table "%s"`, operation, tableName)
+	}
+	return nil
+}
 
+func (database *Database) Insert(data io.Reader, responseWriter io.Writer) error {
+	request, err := decodeRequest("Insert", data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := database.InsertRecord(request); err != nil {
+		return err
+	}
+
+	responseWriter.Write([]byte(`{"result": true}`))
+	return nil
+}
+
+// filtersClause returns the WHERE clause of request filters, soft deleted records are skipped unless with_deleted is set
+// and if_revision matches only records of the revision.
+func (database *Database) filtersClause(request *Request) string {
+	filters := []string{}
+	for _, filter := range request.Filters {
+		filters = append(filters, fmt.Sprintf("%s %s %s", filter.Name, filter.Operator, filter.Value))
+	}
+	if database.table(request.Table).SoftDelete && !request.WithDeleted {
+		filters = append(filters, schema.DeletedAtField+" IS NULL")
+	}
+	if request.IfRevision != nil {
+		filters = append(filters, fmt.Sprintf("%s = %d", schema.RevisionField, *request.IfRevision))
+	}
+
+	if len(filters) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(filters, " AND ")
+}
+
+func (database *Database) selectCommand(request *Request) string {
 	sqlCommand := fmt.Sprintf("SELECT * FROM %s", request.Table)
 
-	if len(request.Fields) != 0 {
+	if requestFields := database.pageFields(request); len(requestFields) != 0 {
 		fields := []string{}
-		for _, field := range request.Fields {
+		for _, field := range requestFields {
 			fields = append(fields, field.Name)
 		}
 		sqlCommand = fmt.Sprintf("SELECT %s FROM %s", strings.Join(fields, ", "), request.Table)
 	}
 
-	if len(request.Filters) != 0 {
-		filters := []string{}
-		for _, filter := range request.Filters {
-			filters = append(filters, fmt.Sprintf("%s %s %s", filter.Name, filter.Operator, filter.Value))
-		}
-		sqlFilters := " WHERE " + strings.Join(filters, " AND ")
-		sqlCommand = sqlCommand + sqlFilters
+	filters := database.filtersClause(request)
+	after, order := database.pageClauses(request)
+	switch {
+	case after != "" && filters == "":
+		filters = " WHERE " + after
+	case after != "":
+		filters += " AND " + after
+	}
+	return sqlCommand + filters + order
+}
+
+// selectRows returns selected columns, rows and records referenced by included fields.
+func (database *Database) selectRows(request *Request) ([]string, [][]sql.NullString, map[string]map[string]map[string]*string, error) {
+	if err := database.checkEncryptedFilters(request); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := database.verifyPage(request); err != nil {
+		return nil, nil, nil, err
+	}
+
+	sqlCommand := database.selectCommand(request)
+	logger.Debug(fmt.Sprintf("[XServer] [Database] [Select] sql request: %s", database.redactSql(request, sqlCommand)))
+
+	reader, done, err := database.snapshot()
+	if err != nil {
+		return nil, nil, nil, err
 	}
-	logger.Debug(fmt.Sprintf("[XServer] [Database] [Select] sql request: %s", sqlCommand))
+	defer done()
 
-	result, err := database.db.Query(sqlCommand)
+	defer observeQuery("select", request.Table, time.Now())
+	result, err := reader.Query(sqlCommand)
 	if err != nil {
-		return fmt.Errorf("[XServer] [Database] [Select] [Error] failed database request: %s", err)
+		return nil, nil, nil, fmt.Errorf("[XServer] [Database] [Select] [Error] failed database request: %s", err)
 	}
 	defer result.Close()
 
 	columns, err := result.Columns()
 	if err != nil {
-		return fmt.Errorf("[XServer] [Database] [Select] [Error] failed get result columns: %s", err)
+		return nil, nil, nil, fmt.Errorf("[XServer] [Database] [Select] [Error] failed get result columns: %s", err)
 	}
 
-	records := []string{}
+	rows := [][]sql.NullString{}
 
 	for result.Next() {
-		values := make([]string, len(columns))
+		values := make([]sql.NullString, len(columns))
 		valuesPointers := make([]interface{}, len(columns))
 		for i := range values {
 			valuesPointers[i] = &values[i]
 		}
 
 		if err := result.Scan(valuesPointers...); err != nil {
-			return fmt.Errorf("[XServer] [Database] [Select] [Error] failed scan row values: %s", err)
+			return nil, nil, nil, fmt.Errorf("[XServer] [Database] [Select] [Error] failed scan row values: %s", err)
 		}
 
+		rows = append(rows, values)
+	}
+	result.Close()
+
+	if err := database.decryptRows(database.table(request.Table), columns, rows); err != nil {
+		return nil, nil, nil, fmt.Errorf("[XServer] [Database] [Select] [Error] %s", err)
+	}
+	if !database.unredacted(request.Unredact) {
+		database.redactRows(database.table(request.Table), columns, rows)
+	}
+
+	included, err := database.includeReferences(reader, request, columns, rows)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("[XServer] [Database] [Select] [Error] failed include references: %s", err)
+	}
+
+	return columns, rows, included, nil
+}
+
+// SelectRecords returns selected records, null values are nil and included references are records maps.
+func (database *Database) SelectRecords(request *Request) ([]map[string]interface{}, error) {
+	columns, rows, included, err := database.selectRows(request)
+	if err != nil {
+		return nil, err
+	}
+	rows, _ = database.nextCursor(request, columns, rows)
+
+	records := []map[string]interface{}{}
+	for _, values := range rows {
+		record := map[string]interface{}{}
+		for i, column := range columns {
+			switch references, ok := included[column]; {
+			case ok:
+				record[column] = references[values[i].String]
+			case values[i].Valid:
+				record[column] = values[i].String
+			default:
+				record[column] = nil
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// SelectTable returns selected columns and rows, null values are empty strings.
+func (database *Database) SelectTable(request *Request) ([]string, [][]string, error) {
+	columns, rows, _, err := database.selectRows(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, _ = database.nextCursor(request, columns, rows)
+
+	table := make([][]string, len(rows))
+	for index, values := range rows {
+		table[index] = make([]string, len(values))
+		for i := range values {
+			table[index][i] = values[i].String
+		}
+	}
+	return columns, table, nil
+}
+
+func (database *Database) Select(data io.Reader, responseWriter io.Writer) error {
+	request, err := decodeRequest("Select", data)
+	if err != nil {
+		return err
+	}
+
+	response, generation, ok := database.cache.get(request)
+	if ok {
+		responseWriter.Write(response)
+		return nil
+	}
+
+	columns, rows, included, err := database.selectRows(request)
+	if err != nil {
+		return err
+	}
+	rows, next := database.nextCursor(request, columns, rows)
+
+	records := []string{}
+
+	for _, values := range rows {
 		record := []string{}
 
 		for i, column := range columns {
-			record = append(record, fmt.Sprintf(`"%s": "%s"`, column, values[i]))
+			if references, ok := included[column]; ok {
+				reference, _ := json.Marshal(references[values[i].String])
+				record = append(record, fmt.Sprintf(`"%s": %s`, column, reference))
+				continue
+			}
+			record = append(record, fmt.Sprintf(`"%s": "%s"`, column, values[i].String))
 		}
 
 		records = append(records, fmt.Sprintf("{%s}", strings.Join(record, ", ")))
 	}
 
-	responseWriter.Write([]byte(fmt.Sprintf(`{"result": [%s]}`, strings.Join(records, ", "))))
+	response = []byte(fmt.Sprintf(`{"result": [%s]}`, strings.Join(records, ", ")))
+	if next != "" {
+		response = []byte(fmt.Sprintf(`{"result": [%s], "cursor": "%s"}`, strings.Join(records, ", "), next))
+	}
+	database.cache.put(request, generation, database.dependencies(request), response)
+	responseWriter.Write(response)
 
 	return nil
 }
 
-func (database *Database) Update(data io.Reader, responseWriter io.Writer) error {
-	request := &Request{}
-	if err := json.NewDecoder(data).Decode(request); err != nil {
-		return fmt.Errorf("[XServer] [Database] [Update] [Error] failed decode json request: %s", err)
-	}
-
-	sqlCommand := fmt.Sprintf("UPDATE %s SET ", request.Table)
-
+func (database *Database) updateCommand(request *Request) (string, string) {
 	fields := []string{}
 	for _, field := range request.Fields {
 		fields = append(fields, fmt.Sprintf("%s = %s", field.Name, field.Value))
 	}
-	sqlCommand = sqlCommand + strings.Join(fields, ", ")
+	if increment := revisionIncrement(database.table(request.Table)); increment != "" {
+		fields = append(fields, increment)
+	}
+	filtersClause := database.filtersClause(request)
+	return fmt.Sprintf("UPDATE %s SET ", request.Table) + strings.Join(fields, ", ") + filtersClause, filtersClause
+}
 
-	if len(request.Filters) != 0 {
-		filters := []string{}
-		for _, filter := range request.Filters {
-			filters = append(filters, fmt.Sprintf("%s %s %s", filter.Name, filter.Operator, filter.Value))
-		}
-		sqlFilters := " WHERE " + strings.Join(filters, " AND ")
-		sqlCommand = sqlCommand + sqlFilters
+// UpdateRecords updates records matched by request filters and returns the number of updated records.
+func (database *Database) UpdateRecords(request *Request) (int64, error) {
+	if err := database.validate(request, false); err != nil {
+		return 0, err
 	}
-	logger.Debug(fmt.Sprintf("[XServer] [Database] [Update] sql request: %s", sqlCommand))
+	if err := database.checkIfRevision(request); err != nil {
+		return 0, err
+	}
+	if err := database.checkQuotas(request, false); err != nil {
+		return 0, err
+	}
+	if err := database.checkEncryptedFilters(request); err != nil {
+		return 0, err
+	}
+	fields, err := database.encryptFields(request)
+	if err != nil {
+		return 0, err
+	}
+	encrypted := *request
+	encrypted.Fields = fields
+
+	sqlCommand, filtersClause := database.updateCommand(&encrypted)
+	logger.Debug(fmt.Sprintf("[XServer] [Database] [Update] sql request: %s", database.redactSql(request, sqlCommand)))
 
-	_, err := database.db.Exec(sqlCommand)
+	startedAt := time.Now()
+	result, err := database.write("update", request, sqlCommand, filtersClause)
+	observeQuery("update", request.Table, startedAt)
+	if constraintErr := constraintError(request.Table, err); constraintErr != nil {
+		return 0, constraintErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("[XServer] [Database] [Update] [Error] failed database request: %s", err)
+	}
+
+	updated, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("[XServer] [Database] [Update] [Error] failed database request: %s", err)
+		return 0, err
+	}
+	return updated, database.conflict(request, updated)
+}
+
+func (database *Database) Update(data io.Reader, responseWriter io.Writer) error {
+	request, err := decodeRequest("Update", data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := database.UpdateRecords(request); err != nil {
+		return err
 	}
 
 	responseWriter.Write([]byte(`{"result": true}`))
@@ -210,27 +527,57 @@ func (database *Database) Update(data io.Reader, responseWriter io.Writer) error
 	return nil
 }
 
-func (database *Database) Delete(data io.Reader, responseWriter io.Writer) error {
-	request := &Request{}
-	if err := json.NewDecoder(data).Decode(request); err != nil {
-		return fmt.Errorf("[XServer] [Database] [Delete] [Error] failed decode json request: %s", err)
+// deleteCommand returns the delete command, records of soft delete tables are marked with deleted_at instead.
+func (database *Database) deleteCommand(request *Request) (string, string) {
+	filtersClause := database.filtersClause(request)
+	if table := database.table(request.Table); table.SoftDelete {
+		sqlCommand := fmt.Sprintf("UPDATE %s SET %s = %d", request.Table, schema.DeletedAtField, time.Now().UnixNano())
+		if increment := revisionIncrement(table); increment != "" {
+			sqlCommand += ", " + increment
+		}
+		return sqlCommand + filtersClause, filtersClause
 	}
+	return fmt.Sprintf("DELETE FROM %s", request.Table) + filtersClause, filtersClause
+}
 
-	sqlCommand := fmt.Sprintf("DELETE FROM %s", request.Table)
+// DeleteRecords deletes records matched by request filters and returns the number of deleted records.
+func (database *Database) DeleteRecords(request *Request) (int64, error) {
+	if err := database.checkIfRevision(request); err != nil {
+		return 0, err
+	}
+	if err := database.checkEncryptedFilters(request); err != nil {
+		return 0, err
+	}
 
-	if len(request.Filters) != 0 {
-		filters := []string{}
-		for _, filter := range request.Filters {
-			filters = append(filters, fmt.Sprintf("%s %s %s", filter.Name, filter.Operator, filter.Value))
-		}
-		sqlFilters := " WHERE " + strings.Join(filters, " AND ")
-		sqlCommand = sqlCommand + sqlFilters
+	sqlCommand, filtersClause := database.deleteCommand(request)
+	logger.Debug(fmt.Sprintf("[XServer] [Database] [Delete] sql request: %s", database.redactSql(request, sqlCommand)))
+
+	startedAt := time.Now()
+	result, err := database.write("delete", request, sqlCommand, filtersClause)
+	observeQuery("delete", request.Table, startedAt)
+	var validationError *ValidationError
+	if errors.As(err, &validationError) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("[XServer] [Database] [Delete] [Error] failed database request: %s", err)
 	}
-	logger.Debug(fmt.Sprintf("[XServer] [Database] [Delete] sql request: %s", sqlCommand))
 
-	_, err := database.db.Exec(sqlCommand)
+	deleted, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("[XServer] [Database] [Delete] [Error] failed database request: %s", err)
+		return 0, err
+	}
+	return deleted, database.conflict(request, deleted)
+}
+
+func (database *Database) Delete(data io.Reader, responseWriter io.Writer) error {
+	request, err := decodeRequest("Delete", data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := database.DeleteRecords(request); err != nil {
+		return err
 	}
 
 	responseWriter.Write([]byte(`{"result": true}`))
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"xserver/src/config"
+)
+
+const testSchema = `[{"name":"Users","fields":[{"name":"name","type":"string"},{"name":"age","type":"integer"}],"primary_key":["name"]}]`
+
+// testConfig writes the schema to the temporary directory, the storage is seeded with the migration table.
+func testConfig(t *testing.T, schema string) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	serverConfig := &config.Config{Database: config.Database{
+		Enable:  true,
+		Storage: filepath.Join(dir, "storage.db"),
+		Schema:  filepath.Join(dir, "schema.json"),
+	}}
+	if err := os.WriteFile(serverConfig.Database.Schema, []byte(schema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	seedSchema(t, serverConfig.Database.Storage)
+	return serverConfig
+}
+
+// openTestDatabase creates the database of the config, it is closed with the test.
+func openTestDatabase(t *testing.T, serverConfig *config.Config) *Database {
+	t.Helper()
+	storage, err := Create(serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { storage.Close() })
+	return storage
+}
+
+// createTestDatabase creates the database of the test schema in the temporary directory, change adjusts the config before the database is created.
+func createTestDatabase(t *testing.T, change func(config *config.Config)) *Database {
+	t.Helper()
+	serverConfig := testConfig(t, testSchema)
+	if change != nil {
+		change(serverConfig)
+	}
+	return openTestDatabase(t, serverConfig)
+}
+
+// seedSchema creates the migration table with the empty current schema as the previous one.
+func seedSchema(t *testing.T, path string) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE __Schema(version TEXT NOT NULL, data TEXT, PRIMARY KEY(version)); INSERT INTO __Schema VALUES('current', '[]')"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInternalTables(t *testing.T) {
+	storage := createTestDatabase(t, nil)
+	operations := map[string]func(io.Reader, io.Writer) error{
+		"insert":  storage.Insert,
+		"select":  storage.Select,
+		"stream":  storage.SelectStream,
+		"update":  storage.Update,
+		"delete":  storage.Delete,
+		"explain": storage.Explain,
+		"history": storage.History,
+		"restore": storage.Restore,
+	}
+	for name, operation := range operations {
+		t.Run(name, func(t *testing.T) {
+			response := &bytes.Buffer{}
+			err := operation(strings.NewReader(`{"table": "__Schema", "key": {"version": "current"}}`), response)
+			if err == nil || !strings.Contains(err.Error(), `unknown table "__Schema"`) {
+				t.Fatalf("internal table must be rejected, got %v", err)
+			}
+			if response.Len() != 0 {
+				t.Fatalf("unexpected response %s", response.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"time"
+	"xserver/src/database/schema"
+)
+
+func newUuid() (string, error) {
+	data := make([]byte, 16)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	data[6] = data[6]&0x0f | 0x40
+	data[8] = data[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", data[0:4], data[4:6], data[6:8], data[8:10], data[10:]), nil
+}
+
+// defaultValue returns the sql value of the field default, generators are evaluated on every insert.
+func defaultValue(table schema.Table, field schema.TableField) string {
+	switch field.Default {
+	case schema.DefaultNow:
+		now := time.Now()
+		if field.Numeric() {
+			return strconv.FormatInt(now.UnixNano(), 10)
+		}
+		return quote(now.UTC().Format(time.RFC3339Nano))
+	case schema.DefaultUuid:
+		uuid, err := newUuid()
+		if err != nil {
+			return "NULL"
+		}
+		return quote(uuid)
+	case schema.DefaultAutoIncrement:
+		return fmt.Sprintf("(SELECT COALESCE(MAX(%s), 0) + 1 FROM %s)", field.Name, table.Name)
+	}
+	return field.Default
+}
+
+// defaults returns default values of table fields missed in the insert request.
+func (database *Database) defaults(request *Request) []RequestField {
+	set := map[string]bool{}
+	for _, field := range request.Fields {
+		set[field.Name] = true
+	}
+
+	table := database.table(request.Table)
+	fields := []RequestField{}
+	for _, field := range table.Fields {
+		if field.Default != "" && !set[field.Name] {
+			fields = append(fields, RequestField{Name: field.Name, Value: defaultValue(table, field)})
+		}
+	}
+	return fields
+}
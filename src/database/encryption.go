@@ -0,0 +1,304 @@
+package database
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"xserver/src/config"
+	"xserver/src/database/schema"
+)
+
+const (
+	encryptedPrefix = "enc:"
+)
+
+type encryptionKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// encryption encrypts values with the current key and decrypts values encrypted with the current or previous keys.
+type encryption struct {
+	current *encryptionKey
+	keys    map[string]*encryptionKey
+}
+
+// loadKey returns the base64 encoded 32 bytes key of the environment variable.
+func loadKey(env string) ([]byte, error) {
+	encoded := os.Getenv(env)
+	if encoded == "" {
+		return nil, fmt.Errorf(`encryption key env "%s" is not set`, env)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf(`encryption key env "%s" must be base64 encoded 32 bytes key`, env)
+	}
+	return key, nil
+}
+
+func newEncryptionKey(env string) (*encryptionKey, error) {
+	key, err := loadKey(env)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(key)
+	return &encryptionKey{id: hex.EncodeToString(hash[:4]), aead: aead}, nil
+}
+
+func newEncryption(settings config.Encryption) (*encryption, error) {
+	if settings.KeyEnv == "" {
+		return nil, nil
+	}
+
+	current, err := newEncryptionKey(settings.KeyEnv)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Database] [Error] failed load encryption key: %s", err)
+	}
+	encryption := &encryption{current: current, keys: map[string]*encryptionKey{current.id: current}}
+	for _, env := range settings.PreviousKeysEnv {
+		key, err := newEncryptionKey(env)
+		if err != nil {
+			return nil, fmt.Errorf("[XServer] [Database] [Error] failed load previous encryption key: %s", err)
+		}
+		encryption.keys[key.id] = key
+	}
+	return encryption, nil
+}
+
+// encrypt returns the value encrypted with the current key as "enc:<key id>:<base64 nonce and ciphertext>".
+func (encryption *encryption) encrypt(value string) (string, error) {
+	nonce := make([]byte, encryption.current.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := encryption.current.aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + encryption.current.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (encryption *encryption) decrypt(value string) (string, error) {
+	keyId, encoded, ok := strings.Cut(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if !strings.HasPrefix(value, encryptedPrefix) || !ok {
+		return value, nil
+	}
+
+	key, ok := encryption.keys[keyId]
+	if !ok {
+		return "", fmt.Errorf(`unknown encryption key "%s"`, keyId)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < key.aead.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted value")
+	}
+	plain, err := key.aead.Open(nil, sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// rotated reports whether the value is encrypted with a previous key.
+func (encryption *encryption) rotated(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix) && !strings.HasPrefix(value, encryptedPrefix+encryption.current.id+":")
+}
+
+func encryptedFields(table schema.Table) map[string]bool {
+	fields := map[string]bool{}
+	for _, field := range table.Fields {
+		if field.Encrypted {
+			fields[field.Name] = true
+		}
+	}
+	return fields
+}
+
+// encryptFields returns request fields with encrypted literal values of encrypted table fields.
+func (database *Database) encryptFields(request *Request) ([]RequestField, error) {
+	encrypted := encryptedFields(database.table(request.Table))
+	if len(encrypted) == 0 {
+		return request.Fields, nil
+	}
+
+	fields := []RequestField{}
+	for _, field := range request.Fields {
+		value, null := literal(field.Value)
+		if encrypted[field.Name] && !null {
+			if strings.TrimSpace(field.Value) == value {
+				return nil, fmt.Errorf(`[XServer] [Database] [Error] value of encrypted "%s" field must be a string literal`, field.Name)
+			}
+			encryptedValue, err := database.encryption.encrypt(value)
+			if err != nil {
+				return nil, fmt.Errorf("[XServer] [Database] [Error] failed encrypt field value: %s", err)
+			}
+			field.Value = quote(encryptedValue)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// checkEncryptedFilters rejects filters by encrypted fields, encrypted values are not comparable.
+func (database *Database) checkEncryptedFilters(request *Request) error {
+	encrypted := encryptedFields(database.table(request.Table))
+	for _, filter := range request.Filters {
+		if encrypted[filter.Name] {
+			return fmt.Errorf(`[XServer] [Database] [Error] filter by encrypted "%s" field is not supported`, filter.Name)
+		}
+	}
+	return nil
+}
+
+// decryptRows decrypts values of encrypted table fields in selected rows.
+func (database *Database) decryptRows(table schema.Table, columns []string, rows [][]sql.NullString) error {
+	encrypted := encryptedFields(table)
+	if len(encrypted) == 0 {
+		return nil
+	}
+
+	for _, row := range rows {
+		for index, column := range columns {
+			if !encrypted[column] || !row[index].Valid {
+				continue
+			}
+			value, err := database.encryption.decrypt(row[index].String)
+			if err != nil {
+				return fmt.Errorf(`failed decrypt "%s" field: %s`, column, err)
+			}
+			row[index].String = value
+		}
+	}
+	return nil
+}
+
+// decryptRecord decrypts values of encrypted table fields in the record e.g. the revision data.
+func (database *Database) decryptRecord(table schema.Table, record map[string]*string) error {
+	for name := range encryptedFields(table) {
+		if value := record[name]; value != nil {
+			decrypted, err := database.encryption.decrypt(*value)
+			if err != nil {
+				return fmt.Errorf(`failed decrypt "%s" field: %s`, name, err)
+			}
+			record[name] = &decrypted
+		}
+	}
+	return nil
+}
+
+func (database *Database) reencrypt(value string) (string, error) {
+	plain, err := database.encryption.decrypt(value)
+	if err != nil {
+		return "", err
+	}
+	return database.encryption.encrypt(plain)
+}
+
+// rotateKey re-encrypts values encrypted with previous keys by the current key, including records history,
+// previous keys can be removed after rotation.
+func (database *Database) rotateKey() (int64, error) {
+	if database.encryption == nil {
+		return 0, fmt.Errorf("encryption key is not configured")
+	}
+
+	database.tablesMutex.RLock()
+	tables := []schema.Table{}
+	for _, table := range database.tables {
+		if len(encryptedFields(table)) != 0 {
+			tables = append(tables, table)
+		}
+	}
+	database.tablesMutex.RUnlock()
+
+	tx, err := database.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rotated := int64(0)
+	for _, table := range tables {
+		for name := range encryptedFields(table) {
+			rows, err := tx.Query(fmt.Sprintf("SELECT rowid AS __rowid, %s FROM %s WHERE %s LIKE 'enc:%%'", name, table.Name, name))
+			if err != nil {
+				return 0, err
+			}
+			records, err := scanRows(rows)
+			if err != nil {
+				return 0, err
+			}
+
+			for _, record := range records {
+				if !database.encryption.rotated(*record[name]) {
+					continue
+				}
+				value, err := database.reencrypt(*record[name])
+				if err != nil {
+					return 0, fmt.Errorf(`failed decrypt "%s" field of "%s" table: %s`, name, table.Name, err)
+				}
+				if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s = $1 WHERE rowid = $2", table.Name, name), value, *record["__rowid"]); err != nil {
+					return 0, err
+				}
+				rotated++
+			}
+		}
+
+		if !table.History {
+			continue
+		}
+		rows, err := tx.Query("SELECT rowid AS __rowid, data FROM __RecordHistory WHERE table_name = $1 AND data LIKE '%enc:%'", table.Name)
+		if err != nil {
+			return 0, err
+		}
+		revisions, err := scanRows(rows)
+		if err != nil {
+			return 0, err
+		}
+		for _, revision := range revisions {
+			data := map[string]*string{}
+			if err := json.Unmarshal([]byte(*revision["data"]), &data); err != nil {
+				return 0, err
+			}
+			changed := false
+			for name := range encryptedFields(table) {
+				if value := data[name]; value != nil && database.encryption.rotated(*value) {
+					reencrypted, err := database.reencrypt(*value)
+					if err != nil {
+						return 0, fmt.Errorf(`failed decrypt "%s" field of "%s" table history: %s`, name, table.Name, err)
+					}
+					data[name] = &reencrypted
+					changed = true
+				}
+			}
+			if !changed {
+				continue
+			}
+			encodedData, _ := json.Marshal(data)
+			if _, err := tx.Exec("UPDATE __RecordHistory SET data = $1 WHERE rowid = $2", string(encodedData), *revision["__rowid"]); err != nil {
+				return 0, err
+			}
+			rotated++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	database.cache.invalidate("")
+	return rotated, nil
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+	"xserver/src/config"
+)
+
+const secretsSchema = `[{"name":"Users","fields":[{"name":"name","type":"string"},{"name":"secret","type":"string","encrypted":true}],"primary_key":["name"]}]`
+
+func setKey(t *testing.T, env string, value byte) {
+	t.Helper()
+	t.Setenv(env, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{value}, 32)))
+}
+
+func insertSecret(t *testing.T, storage *Database, name string, secret string) {
+	t.Helper()
+	request := `{"table": "Users", "fields": [{"name": "name", "value": "'` + name + `'"}, {"name": "secret", "value": "'` + secret + `'"}]}`
+	if err := storage.Insert(strings.NewReader(request), &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func selectSecrets(t *testing.T, storage *Database) string {
+	t.Helper()
+	output := &bytes.Buffer{}
+	if err := storage.Select(strings.NewReader(`{"table": "Users", "fields": [{"name": "name"}, {"name": "secret"}]}`), output); err != nil {
+		t.Fatal(err)
+	}
+	return output.String()
+}
+
+func TestFieldEncryption(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{name: "text", secret: "password"},
+		{name: "empty", secret: ""},
+		{name: "unicode", secret: "пароль"},
+	}
+	setKey(t, "XSERVER_TEST_KEY", 1)
+	serverConfig := testConfig(t, secretsSchema)
+	serverConfig.Database.Encryption = config.Encryption{KeyEnv: "XSERVER_TEST_KEY"}
+	storage := openTestDatabase(t, serverConfig)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			insertSecret(t, storage, test.name, test.secret)
+
+			stored := ""
+			if err := storage.db.QueryRow("SELECT secret FROM Users WHERE name = $1", test.name).Scan(&stored); err != nil {
+				t.Fatal(err)
+			}
+			if test.secret != "" && strings.Contains(stored, test.secret) {
+				t.Fatalf("secret is stored in plain text: %q", stored)
+			}
+			if result := selectSecrets(t, storage); !strings.Contains(result, `"secret": "`+test.secret+`"`) {
+				t.Fatalf("secret is not decrypted: %s", result)
+			}
+		})
+	}
+}
+
+func TestFieldKeyRotation(t *testing.T) {
+	setKey(t, "XSERVER_TEST_OLD_KEY", 1)
+	setKey(t, "XSERVER_TEST_NEW_KEY", 2)
+	serverConfig := testConfig(t, secretsSchema)
+	serverConfig.Database.Encryption = config.Encryption{KeyEnv: "XSERVER_TEST_OLD_KEY"}
+	storage := openTestDatabase(t, serverConfig)
+	insertSecret(t, storage, "user", "password")
+	storage.Close()
+
+	serverConfig.Database.Encryption = config.Encryption{KeyEnv: "XSERVER_TEST_NEW_KEY", PreviousKeysEnv: []string{"XSERVER_TEST_OLD_KEY"}}
+	storage = openTestDatabase(t, serverConfig)
+	if result := selectSecrets(t, storage); !strings.Contains(result, `"secret": "password"`) {
+		t.Fatalf("secret of the previous key is not decrypted: %s", result)
+	}
+	if _, err := storage.Maintain(MaintenanceRotateKey, false); err != nil {
+		t.Fatal(err)
+	}
+	storage.Close()
+
+	serverConfig.Database.Encryption = config.Encryption{KeyEnv: "XSERVER_TEST_NEW_KEY"}
+	storage = openTestDatabase(t, serverConfig)
+	if result := selectSecrets(t, storage); !strings.Contains(result, `"secret": "password"`) {
+		t.Fatalf("secret is not rotated to the new key: %s", result)
+	}
+}
+
+func TestFileEncryption(t *testing.T) {
+	setKey(t, "XSERVER_TEST_FILE_KEY", 3)
+	serverConfig := testConfig(t, secretsSchema)
+	serverConfig.Database.FileEncryption = config.Encryption{KeyEnv: "XSERVER_TEST_FILE_KEY"}
+	setKey(t, "XSERVER_TEST_KEY", 1)
+	serverConfig.Database.Encryption = config.Encryption{KeyEnv: "XSERVER_TEST_KEY"}
+	storage := openTestDatabase(t, serverConfig)
+	insertSecret(t, storage, "plain_marker_name", "password")
+	storage.Close()
+
+	data, err := os.ReadFile(serverConfig.Database.Storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("plain_marker_name")) || bytes.HasPrefix(data, []byte("SQLite format 3")) {
+		t.Fatal("storage file is not encrypted")
+	}
+	db, err := sql.Open("sqlite3", serverConfig.Database.Storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("SELECT * FROM Users"); err == nil {
+		t.Fatal("encrypted storage is opened without the key")
+	}
+
+	storage = openTestDatabase(t, serverConfig)
+	if result := selectSecrets(t, storage); !strings.Contains(result, `"name": "plain_marker_name"`) {
+		t.Fatalf("records are not read from the encrypted storage: %s", result)
+	}
+	storage.Close()
+
+	serverConfig.Database.FileEncryption = config.Encryption{}
+	if _, err := Create(serverConfig); err == nil {
+		t.Fatal("encrypted storage must be rejected without the file encryption key")
+	}
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+)
+
+func init() {
+	metrics.Register("xserver_db_queries_total", metrics.CounterType, "Number of database queries.")
+	metrics.Register("xserver_db_query_seconds_total", metrics.CounterType, "Total duration of database queries.")
+	metrics.Register("xserver_db_query_last_seconds", metrics.GaugeType, "Duration of the last database query.")
+}
+
+func observeQuery(operation string, table string, startedAt time.Time) {
+	duration := time.Since(startedAt).Seconds()
+	metrics.Inc("xserver_db_queries_total", "operation", operation, "table", table)
+	metrics.Add("xserver_db_query_seconds_total", duration, "operation", operation, "table", table)
+	metrics.Set("xserver_db_query_last_seconds", duration, "operation", operation, "table", table)
+}
+
+type PlanStep struct {
+	Detail    string `json:"detail"`
+	Table     string `json:"table,omitempty"`
+	Index     string `json:"index,omitempty"`
+	FullScan  bool   `json:"full_scan"`
+	TableRows int64  `json:"table_rows"`
+}
+
+type Explanation struct {
+	Sql         string     `json:"sql"`
+	Plan        []PlanStep `json:"plan"`
+	Rows        int64      `json:"rows"`
+	RowsScanned int64      `json:"rows_scanned"`
+	Cost        float64    `json:"estimated_cost"`
+	DurationMs  float64    `json:"duration_ms"`
+}
+
+// parsePlanStep extracts the table and the index from plan details like "SEARCH Users USING INDEX name_index (name=?)".
+func parsePlanStep(detail string) PlanStep {
+	step := PlanStep{Detail: detail}
+	fields := strings.Fields(detail)
+	if len(fields) < 2 || (fields[0] != "SCAN" && fields[0] != "SEARCH") {
+		return step
+	}
+
+	step.FullScan = fields[0] == "SCAN"
+	step.Table = fields[1]
+	if fields[1] == "TABLE" && len(fields) > 2 {
+		step.Table = fields[2]
+	}
+
+	if _, using, ok := strings.Cut(detail, " USING "); ok {
+		if _, index, ok := strings.Cut(using, "INDEX "); ok {
+			step.Index = strings.Fields(index)[0]
+		} else if strings.HasPrefix(using, "INTEGER PRIMARY KEY") {
+			step.Index = "INTEGER PRIMARY KEY"
+		}
+	}
+	return step
+}
+
+// Explain executes the select request and responds its query plan, returned rows and duration,
+// rows_scanned is estimated as table rows for full scans and returned rows for index searches,
+// estimated_cost adds table rows for full scans and an index lookup per returned row for index searches.
+func (database *Database) Explain(data io.Reader, responseWriter io.Writer) error {
+	request, err := decodeRequest("Explain", data)
+	if err != nil {
+		return err
+	}
+
+	sqlCommand := database.selectCommand(request)
+	explanation := &Explanation{Sql: database.redactSql(request, sqlCommand), Plan: []PlanStep{}}
+	logger.Debug(fmt.Sprintf("[XServer] [Database] [Explain] sql request: %s", explanation.Sql))
+
+	plan, err := database.db.Query("EXPLAIN QUERY PLAN " + sqlCommand)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Database] [Explain] [Error] failed explain request: %s", err)
+	}
+	for plan.Next() {
+		var id, parent, unused int
+		detail := ""
+		if err := plan.Scan(&id, &parent, &unused, &detail); err != nil {
+			plan.Close()
+			return fmt.Errorf("[XServer] [Database] [Explain] [Error] failed scan query plan: %s", err)
+		}
+		explanation.Plan = append(explanation.Plan, parsePlanStep(detail))
+	}
+	plan.Close()
+
+	startedAt := time.Now()
+	if err := database.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM (%s)", sqlCommand)).Scan(&explanation.Rows); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Explain] [Error] failed database request: %s", err)
+	}
+	explanation.DurationMs = float64(time.Since(startedAt).Microseconds()) / 1000
+	observeQuery("explain", request.Table, startedAt)
+
+	for index, step := range explanation.Plan {
+		if step.Table == "" {
+			continue
+		}
+		database.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", step.Table)).Scan(&explanation.Plan[index].TableRows)
+		tableRows := explanation.Plan[index].TableRows
+		if step.FullScan {
+			explanation.RowsScanned += tableRows
+			explanation.Cost += float64(tableRows)
+		} else {
+			explanation.RowsScanned += explanation.Rows
+			explanation.Cost += math.Log2(float64(tableRows)+1) * math.Max(float64(explanation.Rows), 1)
+		}
+	}
+
+	result, _ := json.Marshal(explanation)
+	responseWriter.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+	return nil
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"fmt"
+	"xserver/src/database/schema"
+)
+
+type Flag struct {
+	Handler string `json:"handler"`
+	Enabled bool   `json:"enabled"`
+	Variant string `json:"variant,omitempty"`
+	Percent int    `json:"percent,omitempty"`
+}
+
+func (database *Database) initFlags() error {
+	table := schema.Table{
+		Name: "__Flags",
+		Fields: []schema.TableField{
+			{Name: "handler", Type: "string"},
+			{Name: "enabled", Type: "integer"},
+			{Name: "variant", Type: "string"},
+			{Name: "percent", Type: "integer"},
+		},
+		PrimaryKey: []string{"handler"},
+	}
+
+	if _, err := database.db.Exec(schema.CreateTableCommand(table)); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed init flags table: %s", err)
+	}
+
+	return nil
+}
+
+func (database *Database) Flags() ([]Flag, error) {
+	result, err := database.db.Query("SELECT handler, enabled, variant, percent FROM __Flags")
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Database] [Error] failed select flags: %s", err)
+	}
+	defer result.Close()
+
+	flags := []Flag{}
+	for result.Next() {
+		flag := Flag{}
+		if err := result.Scan(&flag.Handler, &flag.Enabled, &flag.Variant, &flag.Percent); err != nil {
+			return nil, fmt.Errorf("[XServer] [Database] [Error] failed scan flag: %s", err)
+		}
+		flags = append(flags, flag)
+	}
+
+	return flags, nil
+}
+
+func (database *Database) SetFlag(flag Flag) error {
+	if _, err := database.db.Exec(
+		"INSERT OR REPLACE INTO __Flags (handler, enabled, variant, percent) VALUES ($1, $2, $3, $4)",
+		flag.Handler,
+		flag.Enabled,
+		flag.Variant,
+		flag.Percent,
+	); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed set flag: %s", err)
+	}
+	return nil
+}
+
+func (database *Database) DeleteFlag(handler string) error {
+	if _, err := database.db.Exec("DELETE FROM __Flags WHERE handler = $1", handler); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed delete flag: %s", err)
+	}
+	return nil
+}
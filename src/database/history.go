@@ -0,0 +1,88 @@
+package database
+
+import (
+	"fmt"
+	"time"
+	"xserver/src/database/schema"
+)
+
+type TaskRun struct {
+	Task       string    `json:"task"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	ExitStatus int       `json:"exit_status"`
+	Output     string    `json:"output"`
+	Error      string    `json:"error,omitempty"`
+}
+
+func (database *Database) initTaskHistory() error {
+	table := schema.Table{
+		Name: "__TaskHistory",
+		Fields: []schema.TableField{
+			{Name: "task", Type: "string"},
+			{Name: "started_at", Type: "integer"},
+			{Name: "duration_ms", Type: "integer"},
+			{Name: "exit_status", Type: "integer"},
+			{Name: "output", Type: "string"},
+			{Name: "error", Type: "string"},
+		},
+		PrimaryKey: []string{"task", "started_at"},
+	}
+
+	if _, err := database.db.Exec(schema.CreateTableCommand(table)); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed init task history table: %s", err)
+	}
+
+	return nil
+}
+
+func (database *Database) AddTaskRun(run TaskRun, retention time.Duration) error {
+	if _, err := database.db.Exec(
+		"INSERT INTO __TaskHistory (task, started_at, duration_ms, exit_status, output, error) VALUES ($1, $2, $3, $4, $5, $6)",
+		run.Task,
+		run.StartedAt.UnixNano(),
+		run.DurationMs,
+		run.ExitStatus,
+		run.Output,
+		run.Error,
+	); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed insert task run: %s", err)
+	}
+
+	if retention > 0 {
+		if _, err := database.db.Exec(
+			"DELETE FROM __TaskHistory WHERE task = $1 AND started_at < $2",
+			run.Task,
+			time.Now().Add(-retention).UnixNano(),
+		); err != nil {
+			return fmt.Errorf("[XServer] [Database] [Error] failed delete expired task runs: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func (database *Database) TaskHistory(task string, limit int) ([]TaskRun, error) {
+	result, err := database.db.Query(
+		"SELECT task, started_at, duration_ms, exit_status, output, error FROM __TaskHistory WHERE task = $1 ORDER BY started_at DESC LIMIT $2",
+		task,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Database] [Error] failed select task history: %s", err)
+	}
+	defer result.Close()
+
+	runs := []TaskRun{}
+	for result.Next() {
+		run := TaskRun{}
+		startedAt := int64(0)
+		if err := result.Scan(&run.Task, &startedAt, &run.DurationMs, &run.ExitStatus, &run.Output, &run.Error); err != nil {
+			return nil, fmt.Errorf("[XServer] [Database] [Error] failed scan task run: %s", err)
+		}
+		run.StartedAt = time.Unix(0, startedAt)
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
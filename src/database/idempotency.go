@@ -0,0 +1,87 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"xserver/src/database/schema"
+)
+
+// IdempotentResponse is the stored response of the first request with the idempotency key, headers are json encoded.
+type IdempotentResponse struct {
+	Handler     string
+	Key         string
+	Fingerprint string
+	Status      int
+	Headers     string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+func (database *Database) initIdempotency() error {
+	table := schema.Table{
+		Name: "__Idempotency",
+		Fields: []schema.TableField{
+			{Name: "handler", Type: "string"},
+			{Name: "key", Type: "string"},
+			{Name: "fingerprint", Type: "string"},
+			{Name: "status", Type: "integer"},
+			{Name: "headers", Type: "string"},
+			{Name: "body", Type: "string"},
+			{Name: "created_at", Type: "integer"},
+		},
+		PrimaryKey: []string{"handler", "key"},
+	}
+
+	if _, err := database.db.Exec(schema.CreateTableCommand(table)); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed init idempotency table: %s", err)
+	}
+
+	return nil
+}
+
+// AddIdempotentResponse stores the response and deletes responses of the handler older than the ttl.
+func (database *Database) AddIdempotentResponse(response IdempotentResponse, ttl time.Duration) error {
+	if _, err := database.db.Exec(
+		"INSERT OR REPLACE INTO __Idempotency (handler, key, fingerprint, status, headers, body, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		response.Handler,
+		response.Key,
+		response.Fingerprint,
+		response.Status,
+		response.Headers,
+		response.Body,
+		response.CreatedAt.UnixNano(),
+	); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed add idempotent response: %s", err)
+	}
+
+	if _, err := database.db.Exec(
+		"DELETE FROM __Idempotency WHERE handler = $1 AND created_at < $2",
+		response.Handler,
+		time.Now().Add(-ttl).UnixNano(),
+	); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed delete expired idempotent responses: %s", err)
+	}
+
+	return nil
+}
+
+// IdempotentResponse returns the response of the handler stored for the key within the ttl, nil if there is no one.
+func (database *Database) IdempotentResponse(handler string, key string, ttl time.Duration) (*IdempotentResponse, error) {
+	response := &IdempotentResponse{Handler: handler, Key: key}
+	createdAt := int64(0)
+	err := database.db.QueryRow(
+		"SELECT fingerprint, status, headers, body, created_at FROM __Idempotency WHERE handler = $1 AND key = $2 AND created_at >= $3",
+		handler,
+		key,
+		time.Now().Add(-ttl).UnixNano(),
+	).Scan(&response.Fingerprint, &response.Status, &response.Headers, &response.Body, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Database] [Error] failed select idempotent response: %s", err)
+	}
+	response.CreatedAt = time.Unix(0, createdAt)
+	return response, nil
+}
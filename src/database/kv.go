@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"xserver/src/database/schema"
+)
+
+type KvRequest struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type KvResponse struct {
+	Result bool    `json:"result"`
+	Value  *string `json:"value,omitempty"`
+}
+
+func decodeKvRequest(data io.Reader) (*KvRequest, error) {
+	request := &KvRequest{}
+	if err := json.NewDecoder(data).Decode(request); err != nil {
+		return nil, fmt.Errorf("[XServer] [Database] [Kv] [Error] failed decode json request: %s", err)
+	}
+	if request.Key == "" {
+		return nil, fmt.Errorf("[XServer] [Database] [Kv] [Error] key is empty")
+	}
+	return request, nil
+}
+
+func (database *Database) initKeyValue() error {
+	table := schema.Table{
+		Name: "__KeyValue",
+		Fields: []schema.TableField{
+			{Name: "key", Type: "string"},
+			{Name: "value", Type: "string"},
+		},
+		PrimaryKey: []string{"key"},
+	}
+
+	if _, err := database.db.Exec(schema.CreateTableCommand(table)); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed init key value table: %s", err)
+	}
+
+	return nil
+}
+
+func (database *Database) KvGet(key string) (string, bool, error) {
+	value := ""
+	err := database.db.QueryRow("SELECT value FROM __KeyValue WHERE key = $1", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("[XServer] [Database] [Error] failed get key value: %s", err)
+	}
+	return value, true, nil
+}
+
+func (database *Database) KvSet(key string, value string) error {
+	if _, err := database.db.Exec("INSERT OR REPLACE INTO __KeyValue (key, value) VALUES ($1, $2)", key, value); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed set key value: %s", err)
+	}
+	return nil
+}
+
+func (database *Database) KvDelete(key string) error {
+	if _, err := database.db.Exec("DELETE FROM __KeyValue WHERE key = $1", key); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed delete key value: %s", err)
+	}
+	return nil
+}
+
+func (database *Database) GetKey(data io.Reader, responseWriter io.Writer) error {
+	request, err := decodeKvRequest(data)
+	if err != nil {
+		return err
+	}
+
+	value, ok, err := database.KvGet(request.Key)
+	if err != nil {
+		return err
+	}
+
+	response := KvResponse{Result: ok}
+	if ok {
+		response.Value = &value
+	}
+	return json.NewEncoder(responseWriter).Encode(response)
+}
+
+func (database *Database) SetKey(data io.Reader, responseWriter io.Writer) error {
+	request, err := decodeKvRequest(data)
+	if err != nil {
+		return err
+	}
+
+	if err := database.KvSet(request.Key, request.Value); err != nil {
+		return err
+	}
+	return json.NewEncoder(responseWriter).Encode(KvResponse{Result: true})
+}
+
+func (database *Database) DeleteKey(data io.Reader, responseWriter io.Writer) error {
+	request, err := decodeKvRequest(data)
+	if err != nil {
+		return err
+	}
+
+	if err := database.KvDelete(request.Key); err != nil {
+		return err
+	}
+	return json.NewEncoder(responseWriter).Encode(KvResponse{Result: true})
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+)
+
+const (
+	MaintenanceCompact   = "compact"
+	MaintenanceVacuum    = "vacuum"
+	MaintenanceIntegrity = "integrity"
+	MaintenanceRotateKey = "rotate_key"
+)
+
+var (
+	MaintenanceOperations = []string{MaintenanceIntegrity, MaintenanceCompact, MaintenanceVacuum, MaintenanceRotateKey, MaintenanceRetention}
+)
+
+func init() {
+	metrics.Register("xserver_db_maintenance_total", metrics.CounterType, "Number of database maintenance operations.")
+	metrics.Register("xserver_db_maintenance_duration_seconds", metrics.GaugeType, "Duration of the last database maintenance operation.")
+	metrics.Register("xserver_db_size_bytes", metrics.GaugeType, "Size of the database file after the last maintenance operation.")
+	metrics.Register("xserver_db_free_pages", metrics.GaugeType, "Number of unused database pages after the last maintenance operation.")
+}
+
+type MaintenanceReport struct {
+	Operation     string            `json:"operation"`
+	DurationMs    int64             `json:"duration_ms"`
+	SizeBefore    int64             `json:"size_before"`
+	SizeAfter     int64             `json:"size_after"`
+	FreePages     int64             `json:"free_pages"`
+	Problems      []string          `json:"problems,omitempty"`
+	Rotated       int64             `json:"rotated,omitempty"`
+	RotatedBlocks int64             `json:"rotated_blocks,omitempty"`
+	DryRun        bool              `json:"dry_run,omitempty"`
+	Retention     []RetentionResult `json:"retention,omitempty"`
+}
+
+func (database *Database) fileSize() int64 {
+	size := int64(0)
+	for _, path := range []string{database.config.Storage, database.config.Storage + "-wal"} {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+func (database *Database) freePages() int64 {
+	freePages := int64(0)
+	database.db.QueryRow("PRAGMA freelist_count").Scan(&freePages)
+	return freePages
+}
+
+func (database *Database) integrityCheck() ([]string, error) {
+	result, err := database.db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	problems := []string{}
+	for result.Next() {
+		problem := ""
+		if err := result.Scan(&problem); err != nil {
+			return nil, err
+		}
+		if problem != "ok" {
+			problems = append(problems, problem)
+		}
+	}
+	return problems, result.Err()
+}
+
+// Maintain runs the maintenance operation: compact truncates the write-ahead log and optimizes statistics,
+// vacuum rebuilds the database file reclaiming unused pages, integrity checks the database consistency,
+// rotate_key re-encrypts encrypted fields values and blocks of the encrypted database file by the current key, retention deletes records expired by retention rules.
+// The dry run is supported by retention only, it reports matched records without changes.
+func (database *Database) Maintain(operation string, dryRun bool) (*MaintenanceReport, error) {
+	if dryRun && operation != MaintenanceRetention {
+		return nil, fmt.Errorf(`[XServer] [Database] [Maintenance] [Error] dry run is supported by %s only`, MaintenanceRetention)
+	}
+
+	database.maintenanceMutex.Lock()
+	defer database.maintenanceMutex.Unlock()
+
+	report := &MaintenanceReport{
+		Operation:  operation,
+		SizeBefore: database.fileSize(),
+		DryRun:     dryRun,
+	}
+	logger.Info(fmt.Sprintf("[XServer] [Database] [Maintenance] %s started, size %d bytes, %d free pages", operation, report.SizeBefore, database.freePages()))
+
+	startedAt := time.Now()
+	var err error
+	switch operation {
+	case MaintenanceCompact:
+		if _, err = database.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err == nil {
+			_, err = database.db.Exec("PRAGMA optimize")
+		}
+	case MaintenanceVacuum:
+		_, err = database.db.Exec("VACUUM")
+	case MaintenanceIntegrity:
+		report.Problems, err = database.integrityCheck()
+	case MaintenanceRotateKey:
+		if database.encryption == nil && !database.fileEncryption {
+			err = fmt.Errorf("encryption key is not configured")
+			break
+		}
+		if database.encryption != nil {
+			report.Rotated, err = database.rotateKey()
+		}
+		if err == nil && database.fileEncryption {
+			report.RotatedBlocks, report.Problems, err = database.rotateFileKey()
+		}
+	case MaintenanceRetention:
+		report.Retention, err = database.retention(dryRun)
+	default:
+		return nil, fmt.Errorf(`[XServer] [Database] [Maintenance] [Error] unknown operation "%s", expected one of %s`, operation, strings.Join(MaintenanceOperations, ", "))
+	}
+	report.DurationMs = time.Since(startedAt).Milliseconds()
+
+	if err != nil {
+		metrics.Inc("xserver_db_maintenance_total", "operation", operation, "result", "error")
+		return nil, fmt.Errorf("[XServer] [Database] [Maintenance] [Error] failed %s: %s", operation, err)
+	}
+
+	report.SizeAfter = database.fileSize()
+	report.FreePages = database.freePages()
+
+	result := "ok"
+	if len(report.Problems) != 0 {
+		result = "problems"
+	}
+	metrics.Inc("xserver_db_maintenance_total", "operation", operation, "result", result)
+	metrics.Set("xserver_db_maintenance_duration_seconds", time.Since(startedAt).Seconds(), "operation", operation)
+	metrics.Set("xserver_db_size_bytes", float64(report.SizeAfter))
+	metrics.Set("xserver_db_free_pages", float64(report.FreePages))
+
+	logger.Info(fmt.Sprintf("[XServer] [Database] [Maintenance] %s finished in %dms, size %d -> %d bytes, %d free pages", operation, report.DurationMs, report.SizeBefore, report.SizeAfter, report.FreePages))
+	for _, problem := range report.Problems {
+		logger.Error(fmt.Sprintf("[XServer] [Database] [Maintenance] [Error] integrity problem: %s", problem))
+	}
+	return report, nil
+}
+
+// Backup writes the consistent copy of the database to the new file of the path while the database is in use.
+func (database *Database) Backup(path string) error {
+	database.maintenanceMutex.Lock()
+	defer database.maintenanceMutex.Unlock()
+
+	if _, err := database.db.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed backup database: %s", err)
+	}
+	return nil
+}
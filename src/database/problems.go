@@ -0,0 +1,33 @@
+package database
+
+import (
+	"errors"
+	"net/http"
+	"xserver/src/problem"
+)
+
+// Problem converts the database error to the error response, errors other than validation, conflict and quota ones are responded with the status.
+func Problem(err error, status int) *problem.Problem {
+	var validationError *ValidationError
+	var conflictError *ConflictError
+	var quotaError *QuotaError
+	switch {
+	case errors.As(err, &validationError):
+		return problem.New(http.StatusBadRequest, problem.CodeValidationFailed, err.Error()).WithErrors(validationError.Errors)
+	case errors.As(err, &conflictError):
+		return problem.New(http.StatusConflict, problem.CodeConflict, err.Error()).With("revision", conflictError.Revision)
+	case errors.As(err, &quotaError):
+		return problem.New(http.StatusInsufficientStorage, problem.CodeQuotaExceeded, err.Error()).With("quota", quotaError.Quota).With("limit", quotaError.Limit)
+	}
+
+	code := problem.CodeDatabaseError
+	switch status {
+	case http.StatusBadRequest:
+		code = problem.CodeBadRequest
+	case http.StatusNotFound:
+		code = problem.CodeNotFound
+	case http.StatusMethodNotAllowed:
+		code = problem.CodeMethodNotAllowed
+	}
+	return problem.New(status, code, err.Error())
+}
@@ -0,0 +1,191 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"xserver/src/metrics"
+	"xserver/src/problem"
+	"xserver/src/protobuf"
+)
+
+// Fields of the Request and Response messages of the protobuf schema.
+const (
+	requestTable       = 1
+	requestFields      = 2
+	requestFilters     = 3
+	requestWithDeleted = 4
+	requestInclude     = 5
+	requestIfRevision  = 6
+	requestUnredact    = 7
+	requestLimit       = 8
+	requestCursor      = 9
+
+	responseResult = 1
+	responseError  = 2
+	responseCode   = 3
+	responseExtra  = 4
+)
+
+func init() {
+	metrics.Register("xserver_db_protobuf_requests_total", metrics.CounterType, "Number of database requests or responses encoded as protobuf.")
+}
+
+// DecodeProtoRequest decodes the protobuf Request message.
+func DecodeProtoRequest(data []byte) (*Request, error) {
+	request := &Request{Fields: []RequestField{}, Filters: []RequestFilter{}}
+	err := protobuf.Decode(data, func(field protobuf.Field) error {
+		switch field.Number {
+		case requestTable:
+			request.Table = field.String()
+		case requestFields:
+			request.Fields = append(request.Fields, RequestField{})
+			return protobuf.Decode(field.Data, func(member protobuf.Field) error {
+				current := &request.Fields[len(request.Fields)-1]
+				switch member.Number {
+				case 1:
+					current.Name = member.String()
+				case 2:
+					current.Value = member.String()
+				}
+				return nil
+			})
+		case requestFilters:
+			request.Filters = append(request.Filters, RequestFilter{})
+			return protobuf.Decode(field.Data, func(member protobuf.Field) error {
+				filter := &request.Filters[len(request.Filters)-1]
+				switch member.Number {
+				case 1:
+					filter.Name = member.String()
+				case 2:
+					filter.Operator = member.String()
+				case 3:
+					filter.Value = member.String()
+				}
+				return nil
+			})
+		case requestWithDeleted:
+			request.WithDeleted = field.Bool()
+		case requestInclude:
+			request.Include = append(request.Include, field.String())
+		case requestIfRevision:
+			revision := field.Int()
+			request.IfRevision = &revision
+		case requestUnredact:
+			request.Unredact = field.String()
+		case requestLimit:
+			request.Limit = int(field.Int())
+		case requestCursor:
+			request.Cursor = field.String()
+		}
+		return nil
+	})
+	return request, err
+}
+
+// EncodeProtoResponse encodes the json response as the protobuf Response message.
+func EncodeProtoResponse(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	response := map[string]interface{}{}
+	if err := decoder.Decode(&response); err != nil {
+		return nil, err
+	}
+
+	encoder := &protobuf.Encoder{}
+	if result, ok := response["result"]; ok {
+		value, err := protobuf.EncodeValue(result)
+		if err != nil {
+			return nil, err
+		}
+		encoder.Raw(responseResult, value)
+		delete(response, "result")
+	}
+	for number, name := range map[int]string{responseError: "error", responseCode: "code"} {
+		if text, ok := response[name].(string); ok {
+			encoder.String(number, text)
+			delete(response, name)
+		}
+	}
+	if len(response) != 0 {
+		extra, err := protobuf.EncodeObject(response)
+		if err != nil {
+			return nil, err
+		}
+		encoder.Raw(responseExtra, extra)
+	}
+	return encoder.Data(), nil
+}
+
+// bufferedWriter keeps the json response to encode it as protobuf, msgpack or cbor.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (writer *bufferedWriter) Write(data []byte) (int, error) {
+	return writer.body.Write(data)
+}
+
+func (writer *bufferedWriter) WriteHeader(status int) {
+	writer.status = status
+}
+
+func (writer *bufferedWriter) Unwrap() http.ResponseWriter {
+	return writer.ResponseWriter
+}
+
+// Protobuf serves /db endpoints with protobuf bodies: Request messages are passed to the endpoint as json,
+// responses are Response messages when Accept names protobuf or the request is protobuf.
+func Protobuf(operation string, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Add("Vary", "Accept")
+		protoRequest := protobuf.Is(request.Header.Get("Content-Type"))
+		protoResponse := protobuf.Accepts(request.Header.Get("Accept")) || protoRequest
+		if !protoRequest && !protoResponse {
+			next(writer, request)
+			return
+		}
+		metrics.Inc("xserver_db_protobuf_requests_total", "operation", operation)
+
+		if protoRequest {
+			data, err := io.ReadAll(request.Body)
+			var decoded *Request
+			if err == nil {
+				decoded, err = DecodeProtoRequest(data)
+			}
+			if err == nil {
+				data, err = json.Marshal(decoded)
+			}
+			if err != nil {
+				problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, fmt.Sprintf("[XServer] [Database] [Error] failed decode protobuf request: %s", err)).WithResult(false))
+				return
+			}
+			request.Body = io.NopCloser(bytes.NewReader(data))
+			request.ContentLength = int64(len(data))
+			request.Header.Set("Content-Type", "application/json")
+			request.Header.Set("Content-Length", strconv.Itoa(len(data)))
+		}
+		if !protoResponse {
+			next(writer, request)
+			return
+		}
+
+		buffered := &bufferedWriter{ResponseWriter: writer, status: http.StatusOK}
+		next(buffered, request)
+		encoded, err := EncodeProtoResponse(buffered.body.Bytes())
+		if err != nil {
+			writer.WriteHeader(buffered.status)
+			writer.Write(buffered.body.Bytes())
+			return
+		}
+		writer.Header().Del("Content-Length")
+		writer.Header().Set("Content-Type", protobuf.ContentType)
+		writer.WriteHeader(buffered.status)
+		writer.Write(encoded)
+	}
+}
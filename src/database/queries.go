@@ -0,0 +1,381 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"xserver/src/config"
+	"xserver/src/database/schema"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+)
+
+const (
+	QuerySourceConfig  = "config"
+	QuerySourceRuntime = "runtime"
+)
+
+var (
+	queryName        = regexp.MustCompile(`^[\w.-]+$`)
+	queryPlaceholder = regexp.MustCompile(`^\{(\w+)\}$`)
+	queryOperators   = map[string]bool{"=": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true, "LIKE": true, "NOT LIKE": true, "GLOB": true, "IS": true, "IS NOT": true}
+)
+
+func init() {
+	metrics.Register("xserver_db_query_runs_total", metrics.CounterType, "Number of named database queries runs.")
+}
+
+// Query is the named select, filters values "{name}" are replaced by parameters of the run, other values are sql literals.
+type Query struct {
+	Table   string                `json:"table"`
+	Fields  []string              `json:"fields,omitempty"`
+	Filters []RequestFilter       `json:"filters,omitempty"`
+	Include []string              `json:"include,omitempty"`
+	Params  map[string]QueryParam `json:"params,omitempty"`
+	ApiKeys []string              `json:"api_keys,omitempty"`
+}
+
+// QueryParam is the parameter of the query: string, integer or float.
+type QueryParam struct {
+	Type     string `json:"type"`
+	Required bool   `json:"required,omitempty"`
+	Default  string `json:"default,omitempty"`
+}
+
+// NamedQuery is the query listed by /db/queries, queries of the config can't be redefined or deleted at runtime.
+type NamedQuery struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Query
+}
+
+// QueryRequest runs the named query with parameters, limit and cursor paginate it as select requests.
+type QueryRequest struct {
+	Name     string                 `json:"name"`
+	Params   map[string]interface{} `json:"params"`
+	Limit    int                    `json:"limit,omitempty"`
+	Cursor   string                 `json:"cursor,omitempty"`
+	Unredact string                 `json:"unredact,omitempty"`
+}
+
+type queryDefinition struct {
+	Name  string `json:"name"`
+	Query *Query `json:"query"`
+}
+
+func configQuery(query config.Query) Query {
+	result := Query{Table: query.Table, Fields: query.Fields, Include: query.Include, ApiKeys: query.ApiKeys, Params: map[string]QueryParam{}}
+	for _, filter := range query.Filters {
+		result.Filters = append(result.Filters, RequestFilter{Name: filter.Name, Operator: filter.Operator, Value: filter.Value})
+	}
+	for paramName, param := range query.Params {
+		result.Params[paramName] = QueryParam{Type: param.Type, Required: param.Required, Default: param.Default}
+	}
+	return result
+}
+
+// initQueries loads queries of the config and queries defined at runtime, runtime queries are kept in the __Queries table.
+func (database *Database) initQueries(config *config.Config) error {
+	table := schema.Table{
+		Name: "__Queries",
+		Fields: []schema.TableField{
+			{Name: "name", Type: "string"},
+			{Name: "data", Type: "string"},
+		},
+		PrimaryKey: []string{"name"},
+	}
+	if _, err := database.db.Exec(schema.CreateTableCommand(table)); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed init queries table: %s", err)
+	}
+
+	database.apiKeys = map[string]bool{}
+	for keyName := range config.ApiKeys.Keys {
+		database.apiKeys[keyName] = true
+	}
+	database.queries = map[string]NamedQuery{}
+	for name, query := range config.Database.Queries {
+		converted := configQuery(query)
+		if err := database.verifyQuery(name, converted); err != nil {
+			return fmt.Errorf("[XServer] [Database] [Error] invalid \"%s\" query: %s", name, err)
+		}
+		database.queries[name] = NamedQuery{Name: name, Source: QuerySourceConfig, Query: converted}
+	}
+
+	result, err := database.db.Query("SELECT name, data FROM __Queries")
+	if err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed select queries: %s", err)
+	}
+	defer result.Close()
+	for result.Next() {
+		name, data := "", ""
+		if err := result.Scan(&name, &data); err != nil {
+			return fmt.Errorf("[XServer] [Database] [Error] failed scan query: %s", err)
+		}
+		query := Query{}
+		if err := json.Unmarshal([]byte(data), &query); err != nil {
+			logger.Error(fmt.Sprintf("[XServer] [Database] [Error] skip invalid \"%s\" query: %s", name, err))
+			continue
+		}
+		if _, ok := database.queries[name]; ok {
+			logger.Info(fmt.Sprintf("[XServer] [Database] [Warning] \"%s\" runtime query is hidden by the config query", name))
+			continue
+		}
+		if err := database.verifyQuery(name, query); err != nil {
+			logger.Error(fmt.Sprintf("[XServer] [Database] [Error] skip invalid \"%s\" query: %s", name, err))
+			continue
+		}
+		database.queries[name] = NamedQuery{Name: name, Source: QuerySourceRuntime, Query: query}
+	}
+	return nil
+}
+
+// staticLiteral reports whether the filter value is null, the quoted string or the number, so queries don't embed sql expressions.
+func staticLiteral(value string) bool {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "null") {
+		return true
+	}
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return !strings.Contains(strings.ReplaceAll(value[1:len(value)-1], "''", ""), "'")
+	}
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil
+}
+
+// verifyQuery checks the query against the schema once, so runs only bind parameters.
+func (database *Database) verifyQuery(name string, query Query) error {
+	if !queryName.MatchString(name) {
+		return fmt.Errorf("invalid query name, expected letters, digits, _, . and -")
+	}
+	table, ok := database.Table(query.Table)
+	if !ok || strings.HasPrefix(query.Table, "__") {
+		return fmt.Errorf(`unknown "%s" table`, query.Table)
+	}
+	fields := map[string]schema.TableField{}
+	for _, field := range table.Columns() {
+		fields[field.Name] = field
+	}
+
+	for _, fieldName := range query.Fields {
+		if _, ok := fields[fieldName]; !ok {
+			return fmt.Errorf(`unknown "%s" field of "%s" table`, fieldName, query.Table)
+		}
+	}
+	for _, fieldName := range query.Include {
+		if fields[fieldName].Ref == "" {
+			return fmt.Errorf(`included "%s" is not a ref field of "%s" table`, fieldName, query.Table)
+		}
+	}
+	for paramName, param := range query.Params {
+		if param.Type != config.QueryParamString && param.Type != config.QueryParamInteger && param.Type != config.QueryParamFloat {
+			return fmt.Errorf(`invalid type "%s" of "%s" parameter`, param.Type, paramName)
+		}
+		if param.Default != "" {
+			if _, err := paramLiteral(param, param.Default); err != nil {
+				return fmt.Errorf(`invalid default of "%s" parameter: %s`, paramName, err)
+			}
+		}
+	}
+	for _, filter := range query.Filters {
+		if _, ok := fields[filter.Name]; !ok {
+			return fmt.Errorf(`unknown "%s" filter field of "%s" table`, filter.Name, query.Table)
+		}
+		if !queryOperators[strings.ToUpper(strings.TrimSpace(filter.Operator))] {
+			return fmt.Errorf(`unsupported operator "%s" of "%s" filter`, filter.Operator, filter.Name)
+		}
+		if match := queryPlaceholder.FindStringSubmatch(filter.Value); match != nil {
+			if _, ok := query.Params[match[1]]; !ok {
+				return fmt.Errorf(`undeclared "%s" parameter of "%s" filter`, match[1], filter.Name)
+			}
+		} else if !staticLiteral(filter.Value) {
+			return fmt.Errorf(`value of "%s" filter must be a literal or a "{parameter}" placeholder`, filter.Name)
+		}
+	}
+	for _, keyName := range query.ApiKeys {
+		if !database.apiKeys[keyName] {
+			return fmt.Errorf(`unknown api key "%s"`, keyName)
+		}
+	}
+	return nil
+}
+
+// paramLiteral returns the sql literal of the parameter value, strings are quoted and numbers are checked.
+func paramLiteral(param QueryParam, value interface{}) (string, error) {
+	text := ""
+	switch value := value.(type) {
+	case string:
+		text = value
+	case json.Number:
+		text = value.String()
+	case float64:
+		text = strconv.FormatFloat(value, 'g', -1, 64)
+	default:
+		return "", fmt.Errorf("expected %s value", param.Type)
+	}
+
+	switch param.Type {
+	case config.QueryParamInteger:
+		number, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("expected integer value")
+		}
+		return strconv.FormatInt(number, 10), nil
+	case config.QueryParamFloat:
+		number, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+			return "", fmt.Errorf("expected float value")
+		}
+		return strconv.FormatFloat(number, 'g', -1, 64), nil
+	default:
+		return quote(text), nil
+	}
+}
+
+// bindQuery returns the select request of the query run, filters of missing optional parameters are skipped.
+func bindQuery(query Query, run *QueryRequest) (*Request, error) {
+	for paramName := range run.Params {
+		if _, ok := query.Params[paramName]; !ok {
+			return nil, fmt.Errorf(`unknown "%s" parameter`, paramName)
+		}
+	}
+	literals := map[string]string{}
+	for paramName, param := range query.Params {
+		value, ok := run.Params[paramName]
+		if !ok || value == nil {
+			if param.Required {
+				return nil, fmt.Errorf(`"%s" parameter is required`, paramName)
+			}
+			if param.Default == "" {
+				continue
+			}
+			value = param.Default
+		}
+		literal, err := paramLiteral(param, value)
+		if err != nil {
+			return nil, fmt.Errorf(`invalid "%s" parameter: %s`, paramName, err)
+		}
+		literals[paramName] = literal
+	}
+
+	request := &Request{Table: query.Table, Fields: []RequestField{}, Filters: []RequestFilter{}, Include: query.Include, Limit: run.Limit, Cursor: run.Cursor, Unredact: run.Unredact}
+	for _, fieldName := range query.Fields {
+		request.Fields = append(request.Fields, RequestField{Name: fieldName})
+	}
+	for _, filter := range query.Filters {
+		if match := queryPlaceholder.FindStringSubmatch(filter.Value); match != nil {
+			literal, ok := literals[match[1]]
+			if !ok {
+				continue
+			}
+			filter.Value = literal
+		}
+		request.Filters = append(request.Filters, filter)
+	}
+	return request, nil
+}
+
+// FindQuery returns the named query.
+func (database *Database) FindQuery(name string) (NamedQuery, bool) {
+	database.queriesMutex.RLock()
+	defer database.queriesMutex.RUnlock()
+	query, ok := database.queries[name]
+	return query, ok
+}
+
+// Queries returns named queries sorted by names.
+func (database *Database) Queries() []NamedQuery {
+	database.queriesMutex.RLock()
+	defer database.queriesMutex.RUnlock()
+	queries := []NamedQuery{}
+	for _, query := range database.queries {
+		queries = append(queries, query)
+	}
+	sort.Slice(queries, func(i, j int) bool { return queries[i].Name < queries[j].Name })
+	return queries
+}
+
+// RunQuery selects records of the named query with parameters of the request, the response is the select response.
+func (database *Database) RunQuery(data io.Reader, responseWriter io.Writer) error {
+	run := &QueryRequest{}
+	decoder := json.NewDecoder(data)
+	decoder.UseNumber()
+	if err := decoder.Decode(run); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Query] [Error] failed decode json request: %s", err)
+	}
+	query, ok := database.FindQuery(run.Name)
+	if !ok {
+		return fmt.Errorf(`[XServer] [Database] [Query] [Error] unknown "%s" query`, run.Name)
+	}
+	request, err := bindQuery(query.Query, run)
+	if err != nil {
+		return fmt.Errorf(`[XServer] [Database] [Query] [Error] "%s" query: %s`, run.Name, err)
+	}
+
+	metrics.Inc("xserver_db_query_runs_total", "query", run.Name)
+	requestData, _ := json.Marshal(request)
+	return database.Select(bytes.NewReader(requestData), responseWriter)
+}
+
+// DefineQuery adds or replaces the runtime query, queries of the config can't be redefined.
+func (database *Database) DefineQuery(data io.Reader, responseWriter io.Writer) error {
+	definition := &queryDefinition{}
+	if err := json.NewDecoder(data).Decode(definition); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Query] [Error] failed decode json request: %s", err)
+	}
+	if definition.Query == nil {
+		return fmt.Errorf(`[XServer] [Database] [Query] [Error] query of "%s" is required`, definition.Name)
+	}
+	query := *definition.Query
+	for paramName, param := range query.Params {
+		if param.Type == "" {
+			param.Type = config.QueryParamString
+			query.Params[paramName] = param
+		}
+	}
+	if err := database.verifyQuery(definition.Name, query); err != nil {
+		return fmt.Errorf(`[XServer] [Database] [Query] [Error] invalid "%s" query: %s`, definition.Name, err)
+	}
+
+	database.queriesMutex.Lock()
+	defer database.queriesMutex.Unlock()
+	if existing, ok := database.queries[definition.Name]; ok && existing.Source == QuerySourceConfig {
+		return fmt.Errorf(`[XServer] [Database] [Query] [Error] "%s" query of the config can't be redefined`, definition.Name)
+	}
+	queryData, _ := json.Marshal(query)
+	if _, err := database.db.Exec("INSERT OR REPLACE INTO __Queries (name, data) VALUES ($1, $2)", definition.Name, string(queryData)); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Query] [Error] failed save query: %s", err)
+	}
+	database.queries[definition.Name] = NamedQuery{Name: definition.Name, Source: QuerySourceRuntime, Query: query}
+	responseWriter.Write([]byte(`{"result": true}`))
+	return nil
+}
+
+// DeleteQuery deletes the runtime query.
+func (database *Database) DeleteQuery(data io.Reader, responseWriter io.Writer) error {
+	definition := &queryDefinition{}
+	if err := json.NewDecoder(data).Decode(definition); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Query] [Error] failed decode json request: %s", err)
+	}
+
+	database.queriesMutex.Lock()
+	defer database.queriesMutex.Unlock()
+	existing, ok := database.queries[definition.Name]
+	if !ok {
+		return fmt.Errorf(`[XServer] [Database] [Query] [Error] unknown "%s" query`, definition.Name)
+	}
+	if existing.Source == QuerySourceConfig {
+		return fmt.Errorf(`[XServer] [Database] [Query] [Error] "%s" query of the config can't be deleted`, definition.Name)
+	}
+	if _, err := database.db.Exec("DELETE FROM __Queries WHERE name = $1", definition.Name); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Query] [Error] failed delete query: %s", err)
+	}
+	delete(database.queries, definition.Name)
+	responseWriter.Write([]byte(`{"result": true}`))
+	return nil
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"xserver/src/config"
+)
+
+func TestDefineQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition string
+		valid      bool
+	}{
+		{name: "valid", definition: `{"name": "adults", "query": {"table": "Users", "fields": ["name"], "filters": [{"name": "age", "operator": ">=", "value": "{age}"}], "params": {"age": {"type": "integer"}}}}`, valid: true},
+		{name: "unknown table", definition: `{"name": "unknown", "query": {"table": "Unknown"}}`},
+		{name: "internal table", definition: `{"name": "internal", "query": {"table": "__Queries"}}`},
+		{name: "unknown field", definition: `{"name": "field", "query": {"table": "Users", "fields": ["unknown"]}}`},
+		{name: "invalid name", definition: `{"name": "invalid name", "query": {"table": "Users"}}`},
+		{name: "missing query", definition: `{"name": "missing"}`},
+	}
+	storage := createTestDatabase(t, nil)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := storage.DefineQuery(strings.NewReader(test.definition), &bytes.Buffer{})
+			if (err == nil) != test.valid {
+				t.Fatalf("unexpected define result %v", err)
+			}
+		})
+	}
+}
+
+func TestInitQueries(t *testing.T) {
+	storage := createTestDatabase(t, nil)
+	if err := storage.DefineQuery(strings.NewReader(`{"name": "names", "query": {"table": "Users", "fields": ["name", "age"]}}`), &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	stored := []string{
+		`INSERT INTO __Queries (name, data) VALUES ('unknown_table', '{"table": "Unknown"}')`,
+		`INSERT INTO __Queries (name, data) VALUES ('unknown_field', '{"table": "Users", "fields": ["unknown"]}')`,
+		`INSERT INTO __Queries (name, data) VALUES ('broken', '{')`,
+	}
+	for _, command := range stored {
+		if _, err := storage.db.Exec(command); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := storage.initQueries(&config.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	queries := map[string]bool{}
+	for _, query := range storage.Queries() {
+		queries[query.Name] = true
+	}
+	if len(queries) != 1 || !queries["names"] {
+		t.Fatalf("only valid stored queries must be loaded, got %v", queries)
+	}
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+	"xserver/src/config"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+)
+
+const (
+	sizeQuota = "size"
+)
+
+func init() {
+	metrics.Register("xserver_db_quota_usage_ratio", metrics.GaugeType, "Usage of the database quota, size or table rows.")
+	metrics.Register("xserver_db_quota_rejections_total", metrics.CounterType, "Number of writes rejected by database quotas.")
+	metrics.Register("xserver_db_quota_evictions_total", metrics.CounterType, "Number of records evicted by database quotas.")
+}
+
+// QuotaError is returned by writes exceeding the database size or table rows quota, it is responded with 507 status.
+type QuotaError struct {
+	Quota string
+	Limit int64
+}
+
+func (err *QuotaError) Error() string {
+	if err.Quota == sizeQuota {
+		return fmt.Sprintf("[XServer] [Database] [Error] database size quota of %d bytes is exceeded", err.Limit)
+	}
+	return fmt.Sprintf(`[XServer] [Database] [Error] "%s" table quota of %d rows is exceeded`, err.Quota, err.Limit)
+}
+
+// usage updates the quota usage metric and logs the alert once the usage reaches the alert threshold.
+func (database *Database) usage(quota string, used int64, limit int64) {
+	ratio := float64(used) / float64(limit)
+	metrics.Set("xserver_db_quota_usage_ratio", ratio, "quota", quota)
+
+	database.quotaMutex.Lock()
+	defer database.quotaMutex.Unlock()
+
+	alert := ratio >= database.config.Quotas.Alert
+	if alert && !database.quotaAlerts[quota] {
+		logger.Info(fmt.Sprintf(`[XServer] [Database] [Warning] quota "%s" usage is %.0f%%, used %d of %d`, quota, ratio*100, used, limit))
+	}
+	database.quotaAlerts[quota] = alert
+}
+
+func (database *Database) rowsCount(table string) (int64, error) {
+	count := int64(0)
+	err := database.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", table) + database.filtersClause(&Request{Table: table})).Scan(&count)
+	return count, err
+}
+
+// checkQuotas rejects writes if the database size quota is exceeded and inserts if the rejecting table rows quota is exceeded.
+func (database *Database) checkQuotas(request *Request, insert bool) error {
+	quotas := database.config.Quotas
+	if quotas.MaxSize > 0 {
+		size := database.fileSize()
+		database.usage(sizeQuota, size, quotas.MaxSize)
+		if size >= quotas.MaxSize {
+			metrics.Inc("xserver_db_quota_rejections_total", "quota", sizeQuota)
+			return &QuotaError{Quota: sizeQuota, Limit: quotas.MaxSize}
+		}
+	}
+
+	quota, ok := quotas.Tables[request.Table]
+	if !insert || !ok || quota.Policy != config.QuotaReject {
+		return nil
+	}
+
+	count, err := database.rowsCount(request.Table)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed count table rows: %s", err)
+	}
+	database.usage(request.Table, count, quota.MaxRows)
+	if count >= quota.MaxRows {
+		metrics.Inc("xserver_db_quota_rejections_total", "quota", request.Table)
+		return &QuotaError{Quota: request.Table, Limit: quota.MaxRows}
+	}
+	return nil
+}
+
+// olderThan returns the filter of records with the time field before the cutoff, the field is unix nanoseconds or RFC 3339 time.
+func (database *Database) olderThan(tableName string, fieldName string, cutoff time.Time) RequestFilter {
+	value := quote(cutoff.UTC().Format(time.RFC3339Nano))
+	for _, field := range database.table(tableName).Fields {
+		if field.Name == fieldName && field.Numeric() {
+			value = strconv.FormatInt(cutoff.UnixNano(), 10)
+		}
+	}
+	return RequestFilter{Name: fieldName, Operator: "<", Value: value}
+}
+
+// evict deletes the oldest records over the table rows quota or records older than the table ttl after inserts.
+func (database *Database) evict(tableName string) {
+	quota, ok := database.config.Quotas.Tables[tableName]
+	if !ok {
+		return
+	}
+
+	filter := RequestFilter{}
+	count := int64(0)
+	switch quota.Policy {
+	case config.QuotaEvictOldest:
+		var err error
+		if count, err = database.rowsCount(tableName); err != nil {
+			logger.Error(fmt.Sprintf("[XServer] [Database] [Error] failed count table rows: %s", err))
+			return
+		}
+		if count <= quota.MaxRows {
+			database.usage(tableName, count, quota.MaxRows)
+			return
+		}
+		oldest := fmt.Sprintf("SELECT rowid FROM %s", tableName) + database.filtersClause(&Request{Table: tableName})
+		filter = RequestFilter{Name: "rowid", Operator: "IN", Value: fmt.Sprintf("(%s ORDER BY rowid LIMIT %d)", oldest, count-quota.MaxRows)}
+	case config.QuotaEvictTtl:
+		ttl, _ := time.ParseDuration(quota.Ttl)
+		filter = database.olderThan(tableName, quota.Field, time.Now().Add(-ttl))
+	default:
+		return
+	}
+
+	evicted, err := database.DeleteRecords(&Request{Table: tableName, Filters: []RequestFilter{filter}})
+	if err != nil {
+		logger.Error(fmt.Sprintf(`[XServer] [Database] [Error] failed evict "%s" table records: %s`, tableName, err))
+		return
+	}
+	if quota.Policy == config.QuotaEvictOldest {
+		database.usage(tableName, count-evicted, quota.MaxRows)
+	}
+	if evicted != 0 {
+		metrics.Add("xserver_db_quota_evictions_total", float64(evicted), "table", tableName)
+		logger.Debug(fmt.Sprintf(`[XServer] [Database] evicted %d "%s" table records`, evicted, tableName))
+	}
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"fmt"
+	"time"
+	"xserver/src/database/schema"
+)
+
+func (database *Database) initRecordings() error {
+	table := schema.Table{
+		Name: "__Recordings",
+		Fields: []schema.TableField{
+			{Name: "handler", Type: "string"},
+			{Name: "recorded_at", Type: "integer"},
+			{Name: "request", Type: "string"},
+		},
+		PrimaryKey: []string{"handler", "recorded_at"},
+	}
+
+	if _, err := database.db.Exec(schema.CreateTableCommand(table)); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed init recordings table: %s", err)
+	}
+
+	return nil
+}
+
+func (database *Database) AddRecording(handler string, recordedAt time.Time, request string) error {
+	if _, err := database.db.Exec(
+		"INSERT OR REPLACE INTO __Recordings (handler, recorded_at, request) VALUES ($1, $2, $3)",
+		handler,
+		recordedAt.UnixNano(),
+		request,
+	); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed add recording: %s", err)
+	}
+	return nil
+}
+
+// Recordings returns recorded requests in order of recording, all handlers if handler is empty.
+func (database *Database) Recordings(handler string) ([]string, error) {
+	result, err := database.db.Query(
+		"SELECT request FROM __Recordings WHERE $1 = '' OR handler = $1 ORDER BY recorded_at",
+		handler,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Database] [Error] failed select recordings: %s", err)
+	}
+	defer result.Close()
+
+	requests := []string{}
+	for result.Next() {
+		request := ""
+		if err := result.Scan(&request); err != nil {
+			return nil, fmt.Errorf("[XServer] [Database] [Error] failed scan recording: %s", err)
+		}
+		requests = append(requests, request)
+	}
+
+	return requests, nil
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"xserver/src/database/schema"
+)
+
+const (
+	redacted = "[redacted]"
+)
+
+func redactedFields(table schema.Table) map[string]bool {
+	fields := map[string]bool{}
+	for _, field := range table.Fields {
+		if field.Redacted {
+			fields[field.Name] = true
+		}
+	}
+	return fields
+}
+
+// unredacted reports whether the token permits reading redacted fields values.
+func (database *Database) unredacted(token string) bool {
+	return database.config.UnredactToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(database.config.UnredactToken)) == 1
+}
+
+func (database *Database) redactRows(table schema.Table, columns []string, rows [][]sql.NullString) {
+	fields := redactedFields(table)
+	for _, row := range rows {
+		for index, column := range columns {
+			if fields[column] && row[index].Valid {
+				row[index].String = redacted
+			}
+		}
+	}
+}
+
+func (database *Database) redactRecord(table schema.Table, record map[string]*string) {
+	for name := range redactedFields(table) {
+		if record[name] != nil {
+			value := redacted
+			record[name] = &value
+		}
+	}
+}
+
+// redactSql replaces values of redacted fields in the sql command for logging.
+func (database *Database) redactSql(request *Request, sqlCommand string) string {
+	fields := redactedFields(database.table(request.Table))
+	for _, field := range request.Fields {
+		if fields[field.Name] && strings.TrimSpace(field.Value) != "" {
+			sqlCommand = strings.ReplaceAll(sqlCommand, field.Value, quote(redacted))
+		}
+	}
+	for _, filter := range request.Filters {
+		if fields[filter.Name] && strings.TrimSpace(filter.Value) != "" {
+			sqlCommand = strings.ReplaceAll(sqlCommand, filter.Value, quote(redacted))
+		}
+	}
+	return sqlCommand
+}
+
+// RedactRequest returns the request copy with redacted fields values and without the unredact token e.g. for webhooks payloads.
+func (database *Database) RedactRequest(request *Request) *Request {
+	fields := redactedFields(database.table(request.Table))
+	result := *request
+	result.Unredact = ""
+	result.Fields = []RequestField{}
+	for _, field := range request.Fields {
+		if fields[field.Name] {
+			field.Value = quote(redacted)
+		}
+		result.Fields = append(result.Fields, field)
+	}
+	result.Filters = []RequestFilter{}
+	for _, filter := range request.Filters {
+		if fields[filter.Name] {
+			filter.Value = quote(redacted)
+		}
+		result.Filters = append(result.Filters, filter)
+	}
+	return &result
+}
+
+// RedactPayload redacts the json encoded request, not requests payloads are returned as is.
+func (database *Database) RedactPayload(data []byte) []byte {
+	request := &Request{}
+	if err := json.Unmarshal(data, request); err != nil || request.Table == "" {
+		return data
+	}
+	if len(redactedFields(database.table(request.Table))) == 0 && request.Unredact == "" {
+		return data
+	}
+	payload, err := json.Marshal(database.RedactRequest(request))
+	if err != nil {
+		return data
+	}
+	return payload
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"xserver/src/database/schema"
+)
+
+type reference struct {
+	table schema.Table
+	field schema.TableField
+}
+
+// referrers returns ref fields referencing the table.
+func (database *Database) referrers(tableName string) []reference {
+	database.tablesMutex.RLock()
+	defer database.tablesMutex.RUnlock()
+
+	references := []reference{}
+	for _, table := range database.tables {
+		for _, field := range table.Fields {
+			if field.Ref == tableName {
+				references = append(references, reference{table: table, field: field})
+			}
+		}
+	}
+	sort.Slice(references, func(i, j int) bool {
+		return references[i].table.Name+"."+references[i].field.Name < references[j].table.Name+"."+references[j].field.Name
+	})
+	return references
+}
+
+func quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// deleteReferences applies on_delete actions of referrers to records referencing deleted keys.
+func (database *Database) deleteReferences(tx *sql.Tx, table schema.Table, keys []map[string]string) error {
+	referrers := database.referrers(table.Name)
+	if len(keys) == 0 || len(referrers) == 0 {
+		return nil
+	}
+
+	values := []string{}
+	for _, key := range keys {
+		values = append(values, quote(key[table.PrimaryKey[0]]))
+	}
+
+	for _, referrer := range referrers {
+		request := &Request{
+			Table:   referrer.table.Name,
+			Filters: []RequestFilter{{Name: referrer.field.Name, Operator: "IN", Value: "(" + strings.Join(values, ", ") + ")"}},
+		}
+
+		switch referrer.field.OnDelete {
+		case schema.OnDeleteCascade:
+			sqlCommand, filtersClause := database.deleteCommand(request)
+			if _, err := database.writeTx(tx, "delete", referrer.table, sqlCommand, filtersClause); err != nil {
+				return err
+			}
+		case schema.OnDeleteSetNull:
+			request.Fields = []RequestField{{Name: referrer.field.Name, Value: "NULL"}}
+			sqlCommand, filtersClause := database.updateCommand(request)
+			if _, err := database.writeTx(tx, "update", referrer.table, sqlCommand, filtersClause); err != nil {
+				return err
+			}
+		default:
+			count := 0
+			if err := tx.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", referrer.table.Name) + database.filtersClause(request)).Scan(&count); err != nil {
+				return err
+			}
+			if count != 0 {
+				return &ValidationError{
+					Table: table.Name,
+					Errors: []FieldError{{
+						Field:   table.PrimaryKey[0],
+						Rule:    schema.OnDeleteRestrict,
+						Message: fmt.Sprintf("is referenced by %d %s records", count, referrer.table.Name),
+					}},
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// refExists reports whether the record referenced by the ref field exists.
+func (database *Database) refExists(field schema.TableField, value string) (bool, error) {
+	refTable := database.table(field.Ref)
+	request := &Request{
+		Table:   refTable.Name,
+		Filters: []RequestFilter{{Name: refTable.PrimaryKey[0], Operator: "=", Value: quote(value)}},
+	}
+
+	count := 0
+	err := database.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", refTable.Name) + database.filtersClause(request)).Scan(&count)
+	return count != 0, err
+}
+
+// includeReferences selects records referenced by included fields of selected rows,
+// result maps the field name to referenced records by primary key.
+func (database *Database) includeReferences(reader querier, request *Request, columns []string, rows [][]sql.NullString) (map[string]map[string]map[string]*string, error) {
+	included := map[string]map[string]map[string]*string{}
+	if len(request.Include) == 0 {
+		return included, nil
+	}
+
+	fields := map[string]schema.TableField{}
+	for _, field := range database.table(request.Table).Fields {
+		fields[field.Name] = field
+	}
+
+	for _, name := range request.Include {
+		field, ok := fields[name]
+		if !ok || field.Ref == "" {
+			return nil, fmt.Errorf(`"%s" is not a ref field of "%s" table`, name, request.Table)
+		}
+
+		column := -1
+		for index, columnName := range columns {
+			if columnName == name {
+				column = index
+			}
+		}
+		if column == -1 {
+			return nil, fmt.Errorf(`included "%s" field is not selected`, name)
+		}
+
+		values := []string{}
+		for _, row := range rows {
+			if row[column].Valid {
+				values = append(values, quote(row[column].String))
+			}
+		}
+
+		records := map[string]map[string]*string{}
+		included[name] = records
+		if len(values) == 0 {
+			continue
+		}
+
+		refTable := database.table(field.Ref)
+		primaryKey := refTable.PrimaryKey[0]
+		result, err := reader.Query(fmt.Sprintf("SELECT * FROM %s WHERE %s IN (%s)", refTable.Name, primaryKey, strings.Join(values, ", ")))
+		if err != nil {
+			return nil, err
+		}
+		refRecords, err := scanRows(result)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range refRecords {
+			if err := database.decryptRecord(refTable, record); err != nil {
+				return nil, err
+			}
+			if !database.unredacted(request.Unredact) {
+				database.redactRecord(refTable, record)
+			}
+			if key := record[primaryKey]; key != nil {
+				records[*key] = record
+			}
+		}
+	}
+	return included, nil
+}
+
+// dependencies returns tables of the select response: the requested table and tables referenced by included fields.
+func (database *Database) dependencies(request *Request) []string {
+	tables := []string{request.Table}
+	for _, field := range database.table(request.Table).Fields {
+		for _, name := range request.Include {
+			if field.Name == name && field.Ref != "" {
+				tables = append(tables, field.Ref)
+			}
+		}
+	}
+	return tables
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+	"xserver/src/config"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+	"xserver/src/s3"
+)
+
+const (
+	MaintenanceRetention = "retention"
+
+	retentionRowId = "__rowid"
+)
+
+func init() {
+	metrics.Register("xserver_db_retention_records_total", metrics.CounterType, "Number of records deleted by retention rules.")
+}
+
+type RetentionResult struct {
+	Table   string    `json:"table"`
+	Action  string    `json:"action"`
+	Cutoff  time.Time `json:"cutoff"`
+	Matched int64     `json:"matched"`
+	Deleted int64     `json:"deleted"`
+	Archive string    `json:"archive,omitempty"`
+	S3      string    `json:"s3,omitempty"`
+}
+
+// expiredRecords returns stored values of records matched by the request, values are neither decrypted nor redacted, and the max rowid of them.
+func (database *Database) expiredRecords(request *Request) ([]map[string]*string, int64, error) {
+	result, err := database.db.Query(fmt.Sprintf("SELECT rowid AS %s, * FROM %s", retentionRowId, request.Table) + database.filtersClause(request))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer result.Close()
+
+	columns, err := result.Columns()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	records := []map[string]*string{}
+	maxRowId := int64(0)
+	for result.Next() {
+		values := make([]sql.NullString, len(columns))
+		valuesPointers := make([]interface{}, len(columns))
+		for i := range values {
+			valuesPointers[i] = &values[i]
+		}
+		if err := result.Scan(valuesPointers...); err != nil {
+			return nil, 0, err
+		}
+
+		record := map[string]*string{}
+		for i, column := range columns {
+			if column == retentionRowId {
+				if rowId, _ := strconv.ParseInt(values[i].String, 10, 64); rowId > maxRowId {
+					maxRowId = rowId
+				}
+				continue
+			}
+			if values[i].Valid {
+				value := values[i].String
+				record[column] = &value
+			} else {
+				record[column] = nil
+			}
+		}
+		records = append(records, record)
+	}
+	return records, maxRowId, result.Err()
+}
+
+// archive encodes records as newline delimited json objects with sorted keys.
+func archive(records []map[string]*string) []byte {
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	for _, record := range records {
+		encoder.Encode(record)
+	}
+	return buffer.Bytes()
+}
+
+// retain applies the retention rule to the table, records are archived to the file and exported to S3 before they are deleted.
+func (database *Database) retain(tableName string, rule config.RetentionRule, dryRun bool) (RetentionResult, error) {
+	result := RetentionResult{Table: tableName, Action: rule.Action, Cutoff: time.Now().AddDate(0, 0, -rule.Days).UTC()}
+	if database.table(tableName).Name == "" {
+		return result, fmt.Errorf(`unknown table "%s"`, tableName)
+	}
+
+	request := &Request{Table: tableName, WithDeleted: true, Filters: []RequestFilter{database.olderThan(tableName, rule.Field, result.Cutoff)}}
+	records, maxRowId, err := database.expiredRecords(request)
+	if err != nil {
+		return result, fmt.Errorf(`failed select "%s" table expired records: %s`, tableName, err)
+	}
+	result.Matched = int64(len(records))
+	if dryRun || len(records) == 0 {
+		return result, nil
+	}
+
+	name := fmt.Sprintf("%s-%s.ndjson", tableName, time.Now().UTC().Format("20060102T150405Z"))
+	data := archive(records)
+	if rule.Action == config.RetentionArchive {
+		result.Archive = filepath.Join(rule.Archive, name)
+		if err := os.MkdirAll(rule.Archive, os.ModePerm); err != nil {
+			return result, fmt.Errorf(`failed create archive directory: %s`, err)
+		}
+		if err := os.WriteFile(result.Archive, data, 0644); err != nil {
+			return result, fmt.Errorf(`failed write "%s" table archive: %s`, tableName, err)
+		}
+	}
+	if rule.S3 {
+		settings := database.config.Retention.S3
+		client, err := s3.Create(settings)
+		if err != nil {
+			return result, err
+		}
+		key := path.Join(settings.Prefix, tableName, name)
+		if err := client.Put(context.Background(), key, data, "application/x-ndjson"); err != nil {
+			return result, fmt.Errorf(`failed export "%s" table records to s3: %s`, tableName, err)
+		}
+		result.S3 = fmt.Sprintf("s3://%s/%s", settings.Bucket, key)
+	}
+
+	request.Filters = append(request.Filters, RequestFilter{Name: "rowid", Operator: "<=", Value: strconv.FormatInt(maxRowId, 10)})
+	filtersClause := database.filtersClause(request)
+	deleted, err := database.write("delete", request, fmt.Sprintf("DELETE FROM %s", tableName)+filtersClause, filtersClause)
+	if err != nil {
+		return result, fmt.Errorf(`failed delete "%s" table expired records: %s`, tableName, err)
+	}
+	if result.Deleted, err = deleted.RowsAffected(); err != nil {
+		return result, err
+	}
+	metrics.Add("xserver_db_retention_records_total", float64(result.Deleted), "table", tableName, "action", rule.Action)
+	logger.Info(fmt.Sprintf(`[XServer] [Database] [Retention] deleted %d "%s" table records older than %s`, result.Deleted, tableName, result.Cutoff.Format(time.RFC3339)))
+	return result, nil
+}
+
+// retention applies retention rules of all tables, the dry run reports matched records without changes.
+func (database *Database) retention(dryRun bool) ([]RetentionResult, error) {
+	tables := []string{}
+	for tableName := range database.config.Retention.Tables {
+		tables = append(tables, tableName)
+	}
+	sort.Strings(tables)
+
+	results := []RetentionResult{}
+	for _, tableName := range tables {
+		result, err := database.retain(tableName, database.config.Retention.Tables[tableName], dryRun)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
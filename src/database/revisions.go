@@ -0,0 +1,402 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"xserver/src/database/schema"
+)
+
+type Revision struct {
+	Revision  int64              `json:"revision"`
+	Operation string             `json:"operation"`
+	ChangedAt time.Time          `json:"changed_at"`
+	Data      map[string]*string `json:"data"`
+}
+
+type RevisionsRequest struct {
+	Table    string            `json:"table"`
+	Key      map[string]string `json:"key"`
+	Revision int64             `json:"revision"`
+	Unredact string            `json:"unredact,omitempty"`
+}
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (database *Database) initRevisions() error {
+	table := schema.Table{
+		Name: "__RecordHistory",
+		Fields: []schema.TableField{
+			{Name: "table_name", Type: "string"},
+			{Name: "record_key", Type: "string"},
+			{Name: "revision", Type: "integer"},
+			{Name: "operation", Type: "string"},
+			{Name: "changed_at", Type: "integer"},
+			{Name: "data", Type: "string"},
+		},
+		PrimaryKey: []string{"table_name", "record_key", "revision"},
+	}
+
+	if _, err := database.db.Exec(schema.CreateTableCommand(table)); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed init record history table: %s", err)
+	}
+
+	return nil
+}
+
+func scanRows(rows *sql.Rows) ([]map[string]*string, error) {
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	records := []map[string]*string{}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		valuesPointers := make([]interface{}, len(columns))
+		for i := range values {
+			valuesPointers[i] = &values[i]
+		}
+		if err := rows.Scan(valuesPointers...); err != nil {
+			return nil, err
+		}
+
+		record := map[string]*string{}
+		for i, column := range columns {
+			if values[i].Valid {
+				value := values[i].String
+				record[column] = &value
+			} else {
+				record[column] = nil
+			}
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// selectKeys returns primary keys of the table records matched by the WHERE clause.
+func selectKeys(db querier, table schema.Table, whereClause string) ([]map[string]string, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM %s%s", strings.Join(table.PrimaryKey, ", "), table.Name, whereClause))
+	if err != nil {
+		return nil, err
+	}
+	records, err := scanRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []map[string]string{}
+	for _, record := range records {
+		key := map[string]string{}
+		for name, value := range record {
+			if value != nil {
+				key[name] = *value
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// keyClause returns the WHERE clause of the record key, placeholders are numbered after offset ones.
+func keyClause(table schema.Table, key map[string]string, offset int) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	for index, name := range table.PrimaryKey {
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", name, offset+index+1))
+		args = append(args, key[name])
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func snapshot(db querier, table schema.Table, key map[string]string) (map[string]*string, error) {
+	whereClause, args := keyClause(table, key, 0)
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s%s", table.Name, whereClause), args...)
+	if err != nil {
+		return nil, err
+	}
+	records, err := scanRows(rows)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+func addRevision(tx *sql.Tx, table schema.Table, key map[string]string, operation string, data map[string]*string) error {
+	recordKey, _ := json.Marshal(key)
+	encodedData, _ := json.Marshal(data)
+
+	revision := int64(0)
+	if err := tx.QueryRow(
+		"SELECT COALESCE(MAX(revision), 0) FROM __RecordHistory WHERE table_name = $1 AND record_key = $2",
+		table.Name,
+		string(recordKey),
+	).Scan(&revision); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(
+		"INSERT INTO __RecordHistory (table_name, record_key, revision, operation, changed_at, data) VALUES ($1, $2, $3, $4, $5, $6)",
+		table.Name,
+		string(recordKey),
+		revision+1,
+		operation,
+		time.Now().UnixNano(),
+		string(encodedData),
+	)
+	return err
+}
+
+// write executes the write command, in transaction with revisions of changed records for history tables
+// and with references handling for deletes from referenced tables.
+func (database *Database) write(operation string, request *Request, sqlCommand string, filtersClause string) (sql.Result, error) {
+	table := database.table(request.Table)
+	referrers := operation == "delete" && len(database.referrers(table.Name)) != 0
+	if referrers {
+		defer database.cache.invalidate("")
+	} else {
+		defer database.cache.invalidate(request.Table)
+	}
+
+	if !table.History && !referrers {
+		return database.db.Exec(sqlCommand)
+	}
+
+	tx, err := database.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := database.writeTx(tx, operation, table, sqlCommand, filtersClause)
+	if err != nil {
+		return nil, err
+	}
+	return result, tx.Commit()
+}
+
+func (database *Database) writeTx(tx *sql.Tx, operation string, table schema.Table, sqlCommand string, filtersClause string) (sql.Result, error) {
+	keys := []map[string]string{}
+	snapshots := map[int]map[string]*string{}
+	var err error
+	if operation != "insert" && table.Name != "" {
+		if keys, err = selectKeys(tx, table, filtersClause); err != nil {
+			return nil, err
+		}
+	}
+	if operation == "delete" {
+		if err := database.deleteReferences(tx, table, keys); err != nil {
+			return nil, err
+		}
+		if table.History && !table.SoftDelete {
+			for index, key := range keys {
+				if snapshots[index], err = snapshot(tx, table, key); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	result, err := tx.Exec(sqlCommand)
+	if err != nil || !table.History {
+		return result, err
+	}
+
+	if operation == "insert" {
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		if keys, err = selectKeys(tx, table, fmt.Sprintf(" WHERE rowid = %d", id)); err != nil {
+			return nil, err
+		}
+	}
+
+	for index, key := range keys {
+		data, ok := snapshots[index]
+		if !ok {
+			if data, err = snapshot(tx, table, key); err != nil {
+				return nil, err
+			}
+		}
+		if err := addRevision(tx, table, key, operation, data); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (database *Database) decodeRevisionsRequest(operation string, data io.Reader) (*RevisionsRequest, schema.Table, error) {
+	request := &RevisionsRequest{}
+	if err := json.NewDecoder(data).Decode(request); err != nil {
+		return nil, schema.Table{}, fmt.Errorf("[XServer] [Database] [%s] [Error] failed decode json request: %s", operation, err)
+	}
+	if err := checkTable(operation, request.Table); err != nil {
+		return nil, schema.Table{}, err
+	}
+
+	table := database.table(request.Table)
+	if table.Name == "" {
+		return nil, table, fmt.Errorf(`[XServer] [Database] [%s] [Error] unknown table "%s"`, operation, request.Table)
+	}
+	for _, name := range table.PrimaryKey {
+		if _, ok := request.Key[name]; !ok {
+			return nil, table, fmt.Errorf(`[XServer] [Database] [%s] [Error] key field "%s" is missed`, operation, name)
+		}
+	}
+	return request, table, nil
+}
+
+func (database *Database) revisions(table schema.Table, key map[string]string) ([]Revision, error) {
+	recordKey, _ := json.Marshal(key)
+	rows, err := database.db.Query(
+		"SELECT revision, operation, changed_at, data FROM __RecordHistory WHERE table_name = $1 AND record_key = $2 ORDER BY revision DESC",
+		table.Name,
+		string(recordKey),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+	for rows.Next() {
+		revision := Revision{}
+		changedAt := int64(0)
+		data := ""
+		if err := rows.Scan(&revision.Revision, &revision.Operation, &changedAt, &data); err != nil {
+			return nil, err
+		}
+		revision.ChangedAt = time.Unix(0, changedAt)
+		json.Unmarshal([]byte(data), &revision.Data)
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// History responds revisions of the record by its primary key, newest first.
+func (database *Database) History(data io.Reader, responseWriter io.Writer) error {
+	request, table, err := database.decodeRevisionsRequest("History", data)
+	if err != nil {
+		return err
+	}
+	if !table.History {
+		return fmt.Errorf(`[XServer] [Database] [History] [Error] history of "%s" table is disabled`, table.Name)
+	}
+
+	revisions, err := database.revisions(table, request.Key)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Database] [History] [Error] failed select record history: %s", err)
+	}
+	for _, revision := range revisions {
+		if err := database.decryptRecord(table, revision.Data); err != nil {
+			return fmt.Errorf("[XServer] [Database] [History] [Error] %s", err)
+		}
+		if !database.unredacted(request.Unredact) {
+			database.redactRecord(table, revision.Data)
+		}
+	}
+
+	result, _ := json.Marshal(revisions)
+	responseWriter.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+	return nil
+}
+
+// Restore writes the record revision back, without revision it undeletes the soft deleted record.
+func (database *Database) Restore(data io.Reader, responseWriter io.Writer) error {
+	request, table, err := database.decodeRevisionsRequest("Restore", data)
+	if err != nil {
+		return err
+	}
+
+	sqlCommand := ""
+	args := []interface{}{}
+	switch {
+	case request.Revision != 0:
+		if !table.History {
+			return fmt.Errorf(`[XServer] [Database] [Restore] [Error] history of "%s" table is disabled`, table.Name)
+		}
+		revisions, err := database.revisions(table, request.Key)
+		if err != nil {
+			return fmt.Errorf("[XServer] [Database] [Restore] [Error] failed select record history: %s", err)
+		}
+
+		var revision *Revision
+		for index := range revisions {
+			if revisions[index].Revision == request.Revision {
+				revision = &revisions[index]
+			}
+		}
+		if revision == nil || revision.Data == nil {
+			return fmt.Errorf(`[XServer] [Database] [Restore] [Error] revision %d of the record is not found`, request.Revision)
+		}
+
+		names := []string{}
+		placeholders := []string{}
+		for _, field := range table.Fields {
+			if field.Computed != "" {
+				continue
+			}
+			names = append(names, field.Name)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(names)))
+			args = append(args, revision.Data[field.Name])
+		}
+		if table.Versioned {
+			whereClause, keyArgs := keyClause(table, request.Key, len(args))
+			names = append(names, schema.RevisionField)
+			placeholders = append(placeholders, fmt.Sprintf("(SELECT COALESCE(MAX(%s), 0) + 1 FROM %s%s)", schema.RevisionField, table.Name, whereClause))
+			args = append(args, keyArgs...)
+		}
+		sqlCommand = fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) VALUES (%s)", table.Name, strings.Join(names, ", "), strings.Join(placeholders, ", "))
+	case table.SoftDelete:
+		whereClause, keyArgs := keyClause(table, request.Key, 0)
+		sqlCommand = fmt.Sprintf("UPDATE %s SET %s = NULL", table.Name, schema.DeletedAtField)
+		if increment := revisionIncrement(table); increment != "" {
+			sqlCommand += ", " + increment
+		}
+		sqlCommand += whereClause
+		args = keyArgs
+	default:
+		return fmt.Errorf(`[XServer] [Database] [Restore] [Error] revision is required for "%s" table without soft delete`, table.Name)
+	}
+
+	tx, err := database.db.Begin()
+	if err != nil {
+		return fmt.Errorf("[XServer] [Database] [Restore] [Error] failed begin transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(sqlCommand, args...)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Database] [Restore] [Error] failed database request: %s", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("[XServer] [Database] [Restore] [Error] record is not found")
+	}
+
+	if table.History {
+		restored, err := snapshot(tx, table, request.Key)
+		if err == nil {
+			err = addRevision(tx, table, request.Key, "restore", restored)
+		}
+		if err != nil {
+			return fmt.Errorf("[XServer] [Database] [Restore] [Error] failed add record revision: %s", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Restore] [Error] failed commit transaction: %s", err)
+	}
+	database.cache.invalidate(table.Name)
+
+	responseWriter.Write([]byte(`{"result": true}`))
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strings"
 	"xserver/src/logger"
 )
@@ -17,6 +18,13 @@ var (
 		"string":    "text",
 		"timestamp": "timestamp",
 		"datetime":  "datetime",
+		"ref":       "text",
+	}
+	onDeleteActions = map[string]bool{
+		"":               true,
+		OnDeleteRestrict: true,
+		OnDeleteCascade:  true,
+		OnDeleteSetNull:  true,
 	}
 )
 
@@ -26,15 +34,63 @@ type Pair[T, U any] struct {
 }
 
 type TableField struct {
-	Name     string `json:"name"`
-	Type     string `json:"type"`
-	Nullable bool   `json:"nullable"`
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Nullable  bool     `json:"nullable"`
+	Unique    bool     `json:"unique"`
+	Required  bool     `json:"required"`
+	Enum      []string `json:"enum"`
+	Pattern   string   `json:"pattern"`
+	Min       *float64 `json:"min"`
+	Max       *float64 `json:"max"`
+	Ref       string   `json:"ref"`
+	OnDelete  string   `json:"on_delete"`
+	Default   string   `json:"default"`
+	Computed  string   `json:"computed"`
+	Encrypted bool     `json:"encrypted"`
+	Redacted  bool     `json:"redacted"`
+}
+
+// Numeric reports whether the field stores numbers.
+func (field TableField) Numeric() bool {
+	return fieldsTypesMap[field.Type] == "integer" || fieldsTypesMap[field.Type] == "float"
 }
 
 type Table struct {
 	Name       string       `json:"name"`
 	Fields     []TableField `json:"fields"`
 	PrimaryKey []string     `json:"primary_key"`
+	SoftDelete bool         `json:"soft_delete"`
+	History    bool         `json:"history"`
+	Versioned  bool         `json:"versioned"`
+}
+
+const (
+	DeletedAtField = "deleted_at"
+	RevisionField  = "revision"
+
+	OnDeleteRestrict = "restrict"
+	OnDeleteCascade  = "cascade"
+	OnDeleteSetNull  = "set_null"
+
+	DefaultNow           = "now()"
+	DefaultUuid          = "uuid()"
+	DefaultAutoIncrement = "autoincrement()"
+)
+
+// Columns returns table fields with implicit ones e.g. deleted_at of soft delete tables and revision of versioned tables.
+func (table Table) Columns() []TableField {
+	if !table.SoftDelete && !table.Versioned {
+		return table.Fields
+	}
+	columns := append([]TableField{}, table.Fields...)
+	if table.SoftDelete {
+		columns = append(columns, TableField{Name: DeletedAtField, Type: "integer", Nullable: true})
+	}
+	if table.Versioned {
+		columns = append(columns, TableField{Name: RevisionField, Type: "integer"})
+	}
+	return columns
 }
 
 func Parse(schemaData []byte) ([]Table, error) {
@@ -46,7 +102,56 @@ func Parse(schemaData []byte) ([]Table, error) {
 	return *schema, nil
 }
 
+func verifyRef(field TableField, table Table, tablesMap map[string]Table) error {
+	refTable, ok := tablesMap[field.Ref]
+	if !ok {
+		return fmt.Errorf(`unknown table "%s" referenced by "%s" field in "%s" table`, field.Ref, field.Name, table.Name)
+	}
+	if len(refTable.PrimaryKey) != 1 {
+		return fmt.Errorf(`table "%s" referenced by "%s" field in "%s" table must have single field primary key`, field.Ref, field.Name, table.Name)
+	}
+	if !onDeleteActions[field.OnDelete] {
+		return fmt.Errorf(`unknown on_delete "%s" of "%s" field in "%s" table`, field.OnDelete, field.Name, table.Name)
+	}
+	if field.OnDelete == OnDeleteSetNull && !field.Nullable {
+		return fmt.Errorf(`on_delete set_null of not nullable "%s" field in "%s" table`, field.Name, table.Name)
+	}
+	return nil
+}
+
+func verifyDefault(field TableField, table Table) error {
+	switch {
+	case field.Computed != "":
+		return fmt.Errorf(`computed "%s" field in "%s" table can't have default`, field.Name, table.Name)
+	case field.Default == DefaultUuid && field.Numeric():
+		return fmt.Errorf(`uuid() default of numeric "%s" field in "%s" table`, field.Name, table.Name)
+	case field.Default == DefaultAutoIncrement && fieldsTypesMap[field.Type] != "integer":
+		return fmt.Errorf(`autoincrement() default of not integer "%s" field in "%s" table`, field.Name, table.Name)
+	}
+	return nil
+}
+
+func verifyEncrypted(field TableField, table Table) error {
+	switch {
+	case field.Type != "string":
+		return fmt.Errorf(`encrypted "%s" field in "%s" table must be string`, field.Name, table.Name)
+	case field.Unique || field.Computed != "":
+		return fmt.Errorf(`encrypted "%s" field in "%s" table can't be unique or computed`, field.Name, table.Name)
+	}
+	for _, fieldName := range table.PrimaryKey {
+		if fieldName == field.Name {
+			return fmt.Errorf(`encrypted field "%s" in primary key for "%s" table`, field.Name, table.Name)
+		}
+	}
+	return nil
+}
+
 func Verify(tables []Table) error {
+	tablesMap := map[string]Table{}
+	for _, table := range tables {
+		tablesMap[table.Name] = table
+	}
+
 	for _, table := range tables {
 		if table.Name == "" {
 			return fmt.Errorf("table name is empty")
@@ -65,6 +170,41 @@ func Verify(tables []Table) error {
 			if !ok {
 				return fmt.Errorf(`unknown type for "%s" field in "%s" table`, field.Name, table.Name)
 			}
+			if table.SoftDelete && field.Name == DeletedAtField {
+				return fmt.Errorf(`field "%s" is reserved in soft delete "%s" table`, field.Name, table.Name)
+			}
+			if table.Versioned && field.Name == RevisionField {
+				return fmt.Errorf(`field "%s" is reserved in versioned "%s" table`, field.Name, table.Name)
+			}
+			if field.Pattern != "" {
+				if _, err := regexp.Compile(field.Pattern); err != nil {
+					return fmt.Errorf(`invalid pattern of "%s" field in "%s" table: %s`, field.Name, table.Name, err)
+				}
+			}
+			if (field.Min != nil || field.Max != nil) && !field.Numeric() {
+				return fmt.Errorf(`range of not numeric "%s" field in "%s" table`, field.Name, table.Name)
+			}
+			if field.Min != nil && field.Max != nil && *field.Min > *field.Max {
+				return fmt.Errorf(`min is greater than max of "%s" field in "%s" table`, field.Name, table.Name)
+			}
+			if (field.Type == "ref") != (field.Ref != "") {
+				return fmt.Errorf(`ref type and ref table must be set together for "%s" field in "%s" table`, field.Name, table.Name)
+			}
+			if field.Ref != "" {
+				if err := verifyRef(field, table, tablesMap); err != nil {
+					return err
+				}
+			}
+			if field.Default != "" {
+				if err := verifyDefault(field, table); err != nil {
+					return err
+				}
+			}
+			if field.Encrypted {
+				if err := verifyEncrypted(field, table); err != nil {
+					return err
+				}
+			}
 			fieldsMap[field.Name] = true
 		}
 
@@ -77,6 +217,11 @@ func Verify(tables []Table) error {
 			if !ok {
 				return fmt.Errorf(`unknown field "%s" in primary key for "%s" table`, fieldName, table.Name)
 			}
+			for _, field := range table.Fields {
+				if field.Name == fieldName && field.Computed != "" {
+					return fmt.Errorf(`computed field "%s" in primary key for "%s" table`, fieldName, table.Name)
+				}
+			}
 		}
 
 	}
@@ -86,12 +231,22 @@ func Verify(tables []Table) error {
 
 func CreateTableCommand(table Table) string {
 	fields := []string{}
-	for _, field := range table.Fields {
+	for _, field := range table.Columns() {
 		tableFieldType := fieldsTypesMap[field.Type]
+		if table.Versioned && field.Name == RevisionField {
+			fields = append(fields, fmt.Sprintf("%s %s NOT NULL DEFAULT 1", field.Name, tableFieldType))
+			continue
+		}
 		tableField := fmt.Sprintf("%s %s NOT NULL", field.Name, tableFieldType)
 		if field.Nullable {
 			tableField = fmt.Sprintf("%s %s NULL", field.Name, tableFieldType)
 		}
+		if field.Unique {
+			tableField += " UNIQUE"
+		}
+		if field.Computed != "" {
+			tableField += fmt.Sprintf(" GENERATED ALWAYS AS (%s) STORED", field.Computed)
+		}
 		fields = append(fields, tableField)
 	}
 
@@ -152,11 +307,11 @@ func findTableFieldsDifference(currentTable Table, previousTable Table) ([]Table
 	currentTableFieldsMap := make(map[string]TableField)
 	previousTableFieldsMap := make(map[string]TableField)
 
-	for _, field := range previousTable.Fields {
+	for _, field := range previousTable.Columns() {
 		previousTableFieldsMap[field.Name] = field
 	}
 
-	for _, field := range currentTable.Fields {
+	for _, field := range currentTable.Columns() {
 		currentTableFieldsMap[field.Name] = field
 	}
 
@@ -165,7 +320,7 @@ func findTableFieldsDifference(currentTable Table, previousTable Table) ([]Table
 	sameNamedFields := []Pair[TableField, TableField]{}
 	sameFields := []string{}
 
-	for _, field := range currentTable.Fields {
+	for _, field := range currentTable.Columns() {
 		previousField, ok := previousTableFieldsMap[field.Name]
 		if ok {
 			sameNamedFields = append(sameNamedFields, Pair[TableField, TableField]{field, previousField})
@@ -175,7 +330,7 @@ func findTableFieldsDifference(currentTable Table, previousTable Table) ([]Table
 		}
 	}
 
-	for _, field := range previousTable.Fields {
+	for _, field := range previousTable.Columns() {
 		_, ok := currentTableFieldsMap[field.Name]
 		if !ok {
 			removedFields = append(removedFields, field)
@@ -183,6 +338,9 @@ func findTableFieldsDifference(currentTable Table, previousTable Table) ([]Table
 	}
 
 	for _, fields := range sameNamedFields {
+		if fields.First.Computed != "" {
+			continue
+		}
 		if fields.First.Type != fields.Second.Type {
 			newFields = append(newFields, fields.First)
 			removedFields = append(removedFields, fields.Second)
@@ -258,7 +416,7 @@ func schemaUpgrade(db *sql.DB, currentSchema []Table, previousSchema []Table) er
 		table.Name = "_new_" + table.Name
 
 		newFields, removedFields, sameFields := findTableFieldsDifference(tables.First, tables.Second)
-		tableIsChanged := len(newFields) != 0 || len(removedFields) != 0
+		tableIsChanged := len(newFields) != 0 || len(removedFields) != 0 || CreateTableCommand(tables.First) != CreateTableCommand(tables.Second)
 
 		if tableIsChanged {
 			if _, err := db.Exec(CreateTableCommand(table)); err != nil {
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// enableSnapshotReads switches the storage to the write-ahead log journal, so readers keep the state of their transaction start
+// while writers append pages to the log instead of waiting for readers.
+func (database *Database) enableSnapshotReads() error {
+	mode := ""
+	if err := database.db.QueryRow("PRAGMA journal_mode=WAL").Scan(&mode); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed enable wal journal mode: %s", err)
+	}
+	if !strings.EqualFold(mode, "wal") {
+		return fmt.Errorf(`[XServer] [Database] [Error] failed enable wal journal mode of "%s" storage, journal mode is %s`, database.config.Storage, mode)
+	}
+	return nil
+}
+
+// snapshot returns the querier of selects: the read transaction with snapshot reads, so rows and included references
+// are selected from one state of the database, or the database otherwise. The returned function ends the transaction.
+func (database *Database) snapshot() (querier, func(), error) {
+	if !database.config.SnapshotReads {
+		return database.db, func() {}, nil
+	}
+	tx, err := database.db.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("[XServer] [Database] [Select] [Error] failed begin snapshot: %s", err)
+	}
+	return tx, func() { tx.Rollback() }, nil
+}
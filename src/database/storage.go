@@ -0,0 +1,151 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"xserver/src/config"
+	"xserver/src/database/vfs"
+	"xserver/src/logger"
+)
+
+// configureFileEncryption loads keys of the encrypted vfs, it returns false if file encryption is not configured.
+func configureFileEncryption(settings config.Encryption) (bool, error) {
+	if settings.KeyEnv == "" {
+		return false, nil
+	}
+
+	current, err := loadKey(settings.KeyEnv)
+	if err != nil {
+		return false, fmt.Errorf("[XServer] [Database] [Error] failed load file encryption key: %s", err)
+	}
+	previous := [][]byte{}
+	for _, env := range settings.PreviousKeysEnv {
+		key, err := loadKey(env)
+		if err != nil {
+			return false, fmt.Errorf("[XServer] [Database] [Error] failed load previous file encryption key: %s", err)
+		}
+		previous = append(previous, key)
+	}
+	if err := vfs.Configure(current, previous); err != nil {
+		return false, fmt.Errorf("[XServer] [Database] [Error] failed configure file encryption: %s", err)
+	}
+	if err := vfs.Register(); err != nil {
+		return false, fmt.Errorf("[XServer] [Database] [Error] failed configure file encryption: %s", err)
+	}
+	return true, nil
+}
+
+// encryptPlainStorage encrypts the existing plain storage, the write-ahead log is checkpointed into the file before.
+func encryptPlainStorage(storage string) error {
+	plain, err := vfs.IsPlain(storage)
+	if err != nil || !plain {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf(`[XServer] [Database] encrypting plain "%s" storage`, storage))
+	db, err := sql.Open("sqlite3", storage)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	db.Close()
+	if err != nil {
+		return fmt.Errorf("failed checkpoint write-ahead log: %s", err)
+	}
+	for _, suffix := range []string{"-wal", "-journal"} {
+		if info, err := os.Stat(storage + suffix); err == nil {
+			if info.Size() != 0 {
+				return fmt.Errorf(`"%s" is not empty after checkpoint`, storage+suffix)
+			}
+			os.Remove(storage + suffix)
+		}
+	}
+	return vfs.EncryptFile(storage)
+}
+
+// openStorage opens the storage, storages with file encryption are opened by the encrypted vfs and
+// existing plain storages are encrypted on open.
+func openStorage(settings *config.Database) (*sql.DB, bool, error) {
+	encrypted, err := configureFileEncryption(settings.FileEncryption)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !encrypted {
+		if info, err := os.Stat(settings.Storage); err == nil && info.Size() != 0 {
+			if plain, err := vfs.IsPlain(settings.Storage); err == nil && !plain {
+				return nil, false, fmt.Errorf(`[XServer] [Database] [Error] "%s" storage is encrypted or corrupted, set database.file_encryption.key_env to open encrypted storages`, settings.Storage)
+			}
+		}
+		db, err := sql.Open("sqlite3", settings.Storage)
+		if err != nil {
+			return nil, false, fmt.Errorf("[XServer] [Database] [Error] failed open database: %s", err)
+		}
+		return db, false, nil
+	}
+
+	if err := encryptPlainStorage(settings.Storage); err != nil {
+		return nil, false, fmt.Errorf(`[XServer] [Database] [Error] failed encrypt "%s" storage: %s`, settings.Storage, err)
+	}
+
+	separator := "?"
+	if strings.Contains(settings.Storage, "?") {
+		separator = "&"
+	}
+	db, err := sql.Open("sqlite3", settings.Storage+separator+"vfs="+vfs.Name+"&_sync=FULL")
+	if err != nil {
+		return nil, false, fmt.Errorf("[XServer] [Database] [Error] failed open database: %s", err)
+	}
+
+	pageSize := 0
+	if err := db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		db.Close()
+		return nil, false, fmt.Errorf("[XServer] [Database] [Error] failed open encrypted database: %s", err)
+	}
+	if pageSize%vfs.BlockSize != 0 {
+		db.Close()
+		return nil, false, fmt.Errorf("[XServer] [Database] [Error] page size %d of encrypted database must be a multiple of %d, vacuum the plain database with PRAGMA page_size = %d before", pageSize, vfs.BlockSize, vfs.BlockSize)
+	}
+	return db, true, nil
+}
+
+// rotateFileKey rewrites pages of the storage encrypted with previous keys by the current key,
+// it returns the number of rewritten blocks and blocks still encrypted with previous keys.
+func (database *Database) rotateFileKey() (int64, []string, error) {
+	previousBlocks := func() (int64, error) {
+		usage, err := vfs.KeyUsage(database.config.Storage)
+		if err != nil {
+			return 0, err
+		}
+		blocks := int64(0)
+		for id, count := range usage {
+			if id != vfs.CurrentKey() {
+				blocks += count
+			}
+		}
+		return blocks, nil
+	}
+
+	before, err := previousBlocks()
+	if err != nil {
+		return 0, nil, err
+	}
+	if _, err := database.db.Exec("VACUUM"); err != nil {
+		return 0, nil, err
+	}
+	if _, err := database.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return 0, nil, err
+	}
+	after, err := previousBlocks()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	problems := []string{}
+	if after != 0 {
+		problems = append(problems, fmt.Sprintf("%d blocks of the database file are still encrypted with previous keys", after))
+	}
+	return before - after, problems, nil
+}
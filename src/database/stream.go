@@ -0,0 +1,174 @@
+package database
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+)
+
+const (
+	NdjsonContentType = "application/x-ndjson"
+
+	// streamChunkSize is the number of rows decrypted, redacted and written at once by streamed selects.
+	streamChunkSize = 500
+)
+
+func init() {
+	metrics.Register("xserver_db_streamed_records_total", metrics.CounterType, "Number of records written by streamed selects.")
+}
+
+// acceptsNdjson reports whether the Accept header names ndjson, application/jsonl is accepted too.
+func acceptsNdjson(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && (mediaType == NdjsonContentType || mediaType == "application/jsonl") {
+			return true
+		}
+	}
+	return false
+}
+
+// Streaming serves select requests with Accept: application/x-ndjson by the stream handler and others by the next handler.
+func Streaming(stream http.HandlerFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if !acceptsNdjson(request.Header.Get("Accept")) {
+			next(writer, request)
+			return
+		}
+		writer.Header().Add("Vary", "Accept")
+		writer.Header().Set("Content-Type", NdjsonContentType)
+		writer.Header().Set("X-Content-Type-Options", "nosniff")
+		stream(writer, request)
+	}
+}
+
+// writeRecord writes the row as the json object line, included references are nested objects.
+func writeRecord(writer io.Writer, columns []string, values []sql.NullString, included map[string]map[string]map[string]*string) error {
+	record := []byte{'{'}
+	for i, column := range columns {
+		if i != 0 {
+			record = append(record, ',')
+		}
+		name, _ := json.Marshal(column)
+		record = append(append(record, name...), ':')
+		var value []byte
+		if references, ok := included[column]; ok {
+			value, _ = json.Marshal(references[values[i].String])
+		} else {
+			value, _ = json.Marshal(values[i].String)
+		}
+		record = append(record, value...)
+	}
+	_, err := writer.Write(append(record, '}', '\n'))
+	return err
+}
+
+// SelectStream writes selected records as json lines while rows are read, so large selects are not kept in memory.
+// Errors after the first written line are written as the {"error": ...} line since the status is already sent.
+func (database *Database) SelectStream(data io.Reader, responseWriter io.Writer) error {
+	request, err := decodeRequest("Select", data)
+	if err != nil {
+		return err
+	}
+	if err := database.checkEncryptedFilters(request); err != nil {
+		return err
+	}
+	if request.Limit != 0 || request.Cursor != "" {
+		return fmt.Errorf("[XServer] [Database] [Select] [Error] limit and cursor are not supported by streamed selects")
+	}
+
+	sqlCommand := database.selectCommand(request)
+	logger.Debug(fmt.Sprintf("[XServer] [Database] [Select] stream sql request: %s", database.redactSql(request, sqlCommand)))
+
+	reader, done, err := database.snapshot()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	defer observeQuery("select", request.Table, time.Now())
+	result, err := reader.Query(sqlCommand)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Database] [Select] [Error] failed database request: %s", err)
+	}
+	defer result.Close()
+
+	columns, err := result.Columns()
+	if err != nil {
+		return fmt.Errorf("[XServer] [Database] [Select] [Error] failed get result columns: %s", err)
+	}
+
+	flush := func() {}
+	if httpWriter, ok := responseWriter.(http.ResponseWriter); ok {
+		controller := http.NewResponseController(httpWriter)
+		flush = func() { controller.Flush() }
+	}
+	writer := bufio.NewWriter(responseWriter)
+	table := database.table(request.Table)
+	unredacted := database.unredacted(request.Unredact)
+	written := 0
+
+	writeRows := func(rows [][]sql.NullString) error {
+		if err := database.decryptRows(table, columns, rows); err != nil {
+			return fmt.Errorf("[XServer] [Database] [Select] [Error] %s", err)
+		}
+		if !unredacted {
+			database.redactRows(table, columns, rows)
+		}
+		included, err := database.includeReferences(reader, request, columns, rows)
+		if err != nil {
+			return fmt.Errorf("[XServer] [Database] [Select] [Error] failed include references: %s", err)
+		}
+		for _, values := range rows {
+			if err := writeRecord(writer, columns, values, included); err != nil {
+				return err
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		flush()
+		written += len(rows)
+		metrics.Add("xserver_db_streamed_records_total", float64(len(rows)), "table", request.Table)
+		return nil
+	}
+
+	rows := make([][]sql.NullString, 0, streamChunkSize)
+	for err == nil && result.Next() {
+		values := make([]sql.NullString, len(columns))
+		valuesPointers := make([]interface{}, len(columns))
+		for i := range values {
+			valuesPointers[i] = &values[i]
+		}
+		if err = result.Scan(valuesPointers...); err != nil {
+			err = fmt.Errorf("[XServer] [Database] [Select] [Error] failed scan row values: %s", err)
+			break
+		}
+		if rows = append(rows, values); len(rows) == streamChunkSize {
+			err = writeRows(rows)
+			rows = make([][]sql.NullString, 0, streamChunkSize)
+		}
+	}
+	if err == nil {
+		err = result.Err()
+	}
+	if err == nil && len(rows) != 0 {
+		err = writeRows(rows)
+	}
+
+	if err != nil && written != 0 {
+		logger.Error(err.Error())
+		line, _ := json.Marshal(map[string]string{"error": err.Error()})
+		responseWriter.Write(append(line, '\n'))
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"fmt"
+	"xserver/src/database/schema"
+)
+
+// Usage is the number of requests of the API key to the handler within the day e.g. "2024-01-31".
+type Usage struct {
+	Key      string `json:"key"`
+	Handler  string `json:"handler"`
+	Day      string `json:"day"`
+	Requests int64  `json:"requests"`
+}
+
+func (database *Database) initUsage() error {
+	table := schema.Table{
+		Name: "__Usage",
+		Fields: []schema.TableField{
+			{Name: "key", Type: "string"},
+			{Name: "handler", Type: "string"},
+			{Name: "day", Type: "string"},
+			{Name: "requests", Type: "integer"},
+		},
+		PrimaryKey: []string{"key", "handler", "day"},
+	}
+
+	if _, err := database.db.Exec(schema.CreateTableCommand(table)); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed init usage table: %s", err)
+	}
+
+	return nil
+}
+
+// AddUsage adds requests to the stored usage.
+func (database *Database) AddUsage(usage []Usage) error {
+	transaction, err := database.db.Begin()
+	if err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed begin usage transaction: %s", err)
+	}
+	defer transaction.Rollback()
+
+	for _, each := range usage {
+		if _, err := transaction.Exec(
+			"INSERT INTO __Usage (key, handler, day, requests) VALUES ($1, $2, $3, $4) ON CONFLICT(key, handler, day) DO UPDATE SET requests = requests + excluded.requests",
+			each.Key,
+			each.Handler,
+			each.Day,
+			each.Requests,
+		); err != nil {
+			return fmt.Errorf("[XServer] [Database] [Error] failed add usage: %s", err)
+		}
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return fmt.Errorf("[XServer] [Database] [Error] failed commit usage: %s", err)
+	}
+	return nil
+}
+
+// Usage returns the usage of days between from and to inclusive, all keys if key is empty.
+func (database *Database) Usage(key string, from string, to string) ([]Usage, error) {
+	result, err := database.db.Query(
+		"SELECT key, handler, day, requests FROM __Usage WHERE ($1 = '' OR key = $1) AND day >= $2 AND day <= $3 ORDER BY day, key, handler",
+		key,
+		from,
+		to,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Database] [Error] failed select usage: %s", err)
+	}
+	defer result.Close()
+
+	usage := []Usage{}
+	for result.Next() {
+		each := Usage{}
+		if err := result.Scan(&each.Key, &each.Handler, &each.Day, &each.Requests); err != nil {
+			return nil, fmt.Errorf("[XServer] [Database] [Error] failed scan usage: %s", err)
+		}
+		usage = append(usage, each)
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"xserver/src/database/schema"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned by writes violating fields rules, it is responded with 400 status.
+type ValidationError struct {
+	Table  string
+	Errors []FieldError
+}
+
+func (err *ValidationError) Error() string {
+	messages := []string{}
+	for _, fieldError := range err.Errors {
+		messages = append(messages, fmt.Sprintf("%s %s", fieldError.Field, fieldError.Message))
+	}
+	return fmt.Sprintf(`[XServer] [Database] [Error] invalid "%s" record: %s`, err.Table, strings.Join(messages, ", "))
+}
+
+// literal returns the value of the sql literal e.g. 'text' or 10, non literal expressions are returned as is.
+func literal(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "null") {
+		return "", true
+	}
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), false
+	}
+	return value, false
+}
+
+func (database *Database) fieldPattern(pattern string) *regexp.Regexp {
+	database.tablesMutex.RLock()
+	defer database.tablesMutex.RUnlock()
+	return database.patterns[pattern]
+}
+
+func (database *Database) validateField(field schema.TableField, value string) []FieldError {
+	value, null := literal(value)
+	if null || value == "" {
+		if field.Required || (null && !field.Nullable) {
+			return []FieldError{{Field: field.Name, Rule: "required", Message: "is required"}}
+		}
+		return nil
+	}
+
+	fieldErrors := []FieldError{}
+	if len(field.Enum) != 0 {
+		allowed := false
+		for _, item := range field.Enum {
+			allowed = allowed || item == value
+		}
+		if !allowed {
+			fieldErrors = append(fieldErrors, FieldError{Field: field.Name, Rule: "enum", Message: fmt.Sprintf("must be one of %s", strings.Join(field.Enum, ", "))})
+		}
+	}
+
+	if field.Pattern != "" {
+		if pattern := database.fieldPattern(field.Pattern); pattern != nil && !pattern.MatchString(value) {
+			fieldErrors = append(fieldErrors, FieldError{Field: field.Name, Rule: "pattern", Message: fmt.Sprintf("must match %s", field.Pattern)})
+		}
+	}
+
+	if field.Ref != "" {
+		exists, err := database.refExists(field, value)
+		if err == nil && !exists {
+			fieldErrors = append(fieldErrors, FieldError{Field: field.Name, Rule: "ref", Message: fmt.Sprintf("references missing %s record", field.Ref)})
+		}
+	}
+
+	if field.Min != nil || field.Max != nil {
+		number, err := strconv.ParseFloat(value, 64)
+		switch {
+		case err != nil:
+			fieldErrors = append(fieldErrors, FieldError{Field: field.Name, Rule: "type", Message: "must be a number"})
+		case field.Min != nil && number < *field.Min:
+			fieldErrors = append(fieldErrors, FieldError{Field: field.Name, Rule: "min", Message: fmt.Sprintf("must be at least %v", *field.Min)})
+		case field.Max != nil && number > *field.Max:
+			fieldErrors = append(fieldErrors, FieldError{Field: field.Name, Rule: "max", Message: fmt.Sprintf("must be at most %v", *field.Max)})
+		}
+	}
+	return fieldErrors
+}
+
+// validate checks request fields by the table schema, insert also requires all required fields without defaults.
+func (database *Database) validate(request *Request, insert bool) error {
+	table := database.table(request.Table)
+	if table.Name == "" {
+		return nil
+	}
+
+	values := map[string]string{}
+	for _, field := range request.Fields {
+		values[field.Name] = field.Value
+	}
+
+	fieldErrors := []FieldError{}
+	if _, ok := values[schema.RevisionField]; ok && table.Versioned {
+		fieldErrors = append(fieldErrors, FieldError{Field: schema.RevisionField, Rule: "revision", Message: "is maintained by the database"})
+	}
+	for _, field := range table.Fields {
+		value, ok := values[field.Name]
+		if ok && field.Computed != "" {
+			fieldErrors = append(fieldErrors, FieldError{Field: field.Name, Rule: "computed", Message: "is computed"})
+			continue
+		}
+		if !ok {
+			if insert && field.Required && field.Default == "" {
+				fieldErrors = append(fieldErrors, FieldError{Field: field.Name, Rule: "required", Message: "is required"})
+			}
+			continue
+		}
+		fieldErrors = append(fieldErrors, database.validateField(field, value)...)
+	}
+
+	if len(fieldErrors) != 0 {
+		return &ValidationError{Table: table.Name, Errors: fieldErrors}
+	}
+	return nil
+}
+
+// constraintError converts unique constraint failures like "UNIQUE constraint failed: Users.email" to the validation error.
+func constraintError(table string, err error) error {
+	var sqliteError sqlite3.Error
+	if !errors.As(err, &sqliteError) || sqliteError.ExtendedCode != sqlite3.ErrConstraintUnique {
+		return nil
+	}
+
+	fieldErrors := []FieldError{}
+	_, columns, _ := strings.Cut(sqliteError.Error(), ": ")
+	for _, column := range strings.Split(columns, ", ") {
+		_, field, _ := strings.Cut(column, ".")
+		fieldErrors = append(fieldErrors, FieldError{Field: field, Rule: "unique", Message: "must be unique"})
+	}
+	return &ValidationError{Table: table, Errors: fieldErrors}
+}
@@ -0,0 +1,298 @@
+package vfs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+const (
+	// BlockSize is the size of plain blocks, pages of encrypted databases are multiples of blocks.
+	BlockSize = 4096
+
+	keyIdSize = 4
+	nonceSize = 12
+	tagSize   = 16
+	overhead  = keyIdSize + nonceSize + tagSize
+
+	// chunkSize is the stored size of the block: the key id, the nonce, the encrypted block and the tag.
+	chunkSize = BlockSize + overhead
+)
+
+var (
+	errShortRead  = errors.New("read past the end of the file")
+	errUnknownKey = errors.New("block is encrypted with unknown key")
+
+	keys atomic.Pointer[keyring]
+)
+
+type key struct {
+	id   [keyIdSize]byte
+	aead cipher.AEAD
+}
+
+// keyring seals blocks with the current key and opens blocks sealed with the current or previous keys.
+type keyring struct {
+	current *key
+	keys    map[[keyIdSize]byte]*key
+}
+
+func newKey(data []byte) (*key, error) {
+	if len(data) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(data)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	result := &key{aead: aead}
+	hash := sha256.Sum256(data)
+	copy(result.id[:], hash[:])
+	return result, nil
+}
+
+// Configure sets the current key of written blocks and previous keys of blocks written before the rotation.
+func Configure(current []byte, previous [][]byte) error {
+	currentKey, err := newKey(current)
+	if err != nil {
+		return err
+	}
+	ring := &keyring{current: currentKey, keys: map[[keyIdSize]byte]*key{currentKey.id: currentKey}}
+	for _, data := range previous {
+		previousKey, err := newKey(data)
+		if err != nil {
+			return err
+		}
+		ring.keys[previousKey.id] = previousKey
+	}
+	keys.Store(ring)
+	return nil
+}
+
+// CurrentKey returns the id of the current key.
+func CurrentKey() string {
+	if ring := keys.Load(); ring != nil {
+		return hex.EncodeToString(ring.current.id[:])
+	}
+	return ""
+}
+
+func minimum(a int64, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maximum(a int64, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// additionalData binds the block to its position, so blocks can't be swapped.
+func additionalData(index int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(index))
+}
+
+func (ring *keyring) seal(index int64, plain []byte) ([]byte, error) {
+	chunk := make([]byte, keyIdSize+nonceSize, overhead+len(plain))
+	copy(chunk, ring.current.id[:])
+	if _, err := rand.Read(chunk[keyIdSize:]); err != nil {
+		return nil, err
+	}
+	return ring.current.aead.Seal(chunk, chunk[keyIdSize:], plain, additionalData(index)), nil
+}
+
+func (ring *keyring) open(index int64, chunk []byte) ([]byte, error) {
+	id := [keyIdSize]byte{}
+	copy(id[:], chunk)
+	key, ok := ring.keys[id]
+	if !ok {
+		return nil, errUnknownKey
+	}
+	return key.aead.Open(nil, chunk[keyIdSize:keyIdSize+nonceSize], chunk[keyIdSize+nonceSize:], additionalData(index))
+}
+
+// storage is the file encrypted chunks are kept in.
+type storage interface {
+	ReadAt(data []byte, offset int64) error
+	WriteAt(data []byte, offset int64) error
+	Truncate(size int64) error
+	Size() (int64, error)
+}
+
+// file reads and writes plain data of the storage, the n-th block of plain data is kept as the n-th chunk,
+// the last block may be shorter. Torn last chunks of journals are read as zeros, sqlite checksums reject them.
+type file struct {
+	storage storage
+	keys    *keyring
+	main    bool
+}
+
+// logicalSize returns the size of plain data of the storage of the size.
+func logicalSize(size int64) int64 {
+	chunks := (size + chunkSize - 1) / chunkSize
+	if chunks == 0 {
+		return 0
+	}
+	last := size - (chunks-1)*chunkSize
+	if last <= overhead {
+		return (chunks - 1) * BlockSize
+	}
+	return (chunks-1)*BlockSize + last - overhead
+}
+
+func (file *file) Size() (int64, error) {
+	size, err := file.storage.Size()
+	return logicalSize(size), err
+}
+
+func (file *file) readBlock(index int64, size int64) ([]byte, error) {
+	offset := index * chunkSize
+	length := size - offset
+	if length > chunkSize {
+		length = chunkSize
+	}
+	if length <= overhead {
+		return []byte{}, nil
+	}
+
+	chunk := make([]byte, length)
+	if err := file.storage.ReadAt(chunk, offset); err != nil {
+		return nil, err
+	}
+	plain, err := file.keys.open(index, chunk)
+	if err == nil {
+		return plain, nil
+	}
+	if !file.main && offset+length == size {
+		return make([]byte, length-overhead), nil
+	}
+	if err == errUnknownKey {
+		return nil, fmt.Errorf("block %d is encrypted with unknown key %s", index, hex.EncodeToString(chunk[:keyIdSize]))
+	}
+	return nil, fmt.Errorf("block %d is corrupted or encrypted with other key: %s", index, err)
+}
+
+func (file *file) writeBlock(index int64, plain []byte) error {
+	chunk, err := file.keys.seal(index, plain)
+	if err != nil {
+		return err
+	}
+	return file.storage.WriteAt(chunk, index*chunkSize)
+}
+
+// ReadAt reads plain data at the offset, data after the end of the file is zeroed and errShortRead is returned.
+func (file *file) ReadAt(data []byte, offset int64) error {
+	size, err := file.storage.Size()
+	if err != nil {
+		return err
+	}
+	end := logicalSize(size)
+
+	short := false
+	for position := int64(0); position < int64(len(data)); {
+		current := offset + position
+		index, inner := current/BlockSize, current%BlockSize
+		target := data[position:minimum(int64(len(data)), position+BlockSize-inner)]
+		position += int64(len(target))
+
+		copied := 0
+		if current < end {
+			plain, err := file.readBlock(index, size)
+			if err != nil {
+				return err
+			}
+			if inner < int64(len(plain)) {
+				copied = copy(target, plain[inner:])
+			}
+		}
+		if copied < len(target) {
+			for i := copied; i < len(target); i++ {
+				target[i] = 0
+			}
+			short = true
+		}
+	}
+	if short {
+		return errShortRead
+	}
+	return nil
+}
+
+// WriteAt writes plain data at the offset, blocks between the end of the file and the offset are written as zeros.
+func (file *file) WriteAt(data []byte, offset int64) error {
+	size, err := file.storage.Size()
+	if err != nil {
+		return err
+	}
+	end := logicalSize(size)
+	writeEnd := offset + int64(len(data))
+
+	for index := minimum(offset, end) / BlockSize; index*BlockSize < writeEnd; index++ {
+		blockStart := index * BlockSize
+		existing := maximum(0, minimum(BlockSize, end-blockStart))
+		length := maximum(existing, minimum(BlockSize, writeEnd-blockStart))
+		from, to := maximum(offset, blockStart), minimum(writeEnd, blockStart+BlockSize)
+		touched := from < to
+		if !touched && length == existing {
+			continue
+		}
+
+		plain := make([]byte, length)
+		if existing > 0 && !(touched && from == blockStart && to >= blockStart+existing) {
+			current, err := file.readBlock(index, size)
+			if err != nil {
+				return err
+			}
+			copy(plain, current)
+		}
+		if touched {
+			copy(plain[from-blockStart:], data[from-offset:to-offset])
+		}
+		if err := file.writeBlock(index, plain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Truncate changes the size of plain data, the last partial block is written again.
+func (file *file) Truncate(size int64) error {
+	physical, err := file.storage.Size()
+	if err != nil {
+		return err
+	}
+	end := logicalSize(physical)
+	if size >= end {
+		if size > end {
+			return file.WriteAt(make([]byte, size-end), end)
+		}
+		return nil
+	}
+
+	index, inner := size/BlockSize, size%BlockSize
+	if inner == 0 {
+		return file.storage.Truncate(index * chunkSize)
+	}
+	plain, err := file.readBlock(index, physical)
+	if err != nil {
+		return err
+	}
+	if err := file.storage.Truncate(index * chunkSize); err != nil {
+		return err
+	}
+	return file.writeBlock(index, plain[:minimum(inner, int64(len(plain)))])
+}
@@ -0,0 +1,137 @@
+package vfs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var (
+	plainHeader = []byte("SQLite format 3\x00")
+)
+
+// osStorage is the file opened by the os, it's used for files closed by sqlite.
+type osStorage struct {
+	file *os.File
+}
+
+func (storage osStorage) ReadAt(data []byte, offset int64) error {
+	_, err := storage.file.ReadAt(data, offset)
+	return err
+}
+
+func (storage osStorage) WriteAt(data []byte, offset int64) error {
+	_, err := storage.file.WriteAt(data, offset)
+	return err
+}
+
+func (storage osStorage) Truncate(size int64) error {
+	return storage.file.Truncate(size)
+}
+
+func (storage osStorage) Size() (int64, error) {
+	info, err := storage.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// IsPlain reports whether the file of the path is the plain sqlite database, missing and empty files are not plain.
+func IsPlain(path string) (bool, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	header := make([]byte, len(plainHeader))
+	if _, err := io.ReadFull(file, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		return false, err
+	}
+	return bytes.Equal(header, plainHeader), nil
+}
+
+// EncryptFile encrypts the plain file of the path with the current key, the file is replaced after the encrypted copy is synced.
+func EncryptFile(path string) error {
+	ring := keys.Load()
+	if ring == nil {
+		return fmt.Errorf("%s vfs keys are not configured", Name)
+	}
+
+	plain, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer plain.Close()
+	info, err := plain.Stat()
+	if err != nil {
+		return err
+	}
+
+	encryptingPath := path + ".encrypting"
+	encrypting, err := os.OpenFile(encryptingPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer os.Remove(encryptingPath)
+	defer encrypting.Close()
+
+	encrypted := &file{storage: osStorage{file: encrypting}, keys: ring, main: true}
+	block := make([]byte, BlockSize)
+	for offset := int64(0); ; offset += BlockSize {
+		read, err := io.ReadFull(plain, block)
+		if read > 0 {
+			if err := encrypted.WriteAt(block[:read], offset); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := encrypting.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(encryptingPath, path); err != nil {
+		return err
+	}
+	if directory, err := os.Open(filepath.Dir(path)); err == nil {
+		directory.Sync()
+		directory.Close()
+	}
+	return nil
+}
+
+// KeyUsage returns the number of blocks of the encrypted file of the path by ids of their keys.
+func KeyUsage(path string) (map[string]int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	usage := map[string]int64{}
+	id := make([]byte, keyIdSize)
+	for offset := int64(0); ; offset += chunkSize {
+		if _, err := file.ReadAt(id, offset); err != nil {
+			if err == io.EOF {
+				return usage, nil
+			}
+			return nil, err
+		}
+		usage[hex.EncodeToString(id)]++
+	}
+}
@@ -0,0 +1,99 @@
+/*
+** Declarations of the SQLite VFS interface used by the encrypted VFS, the SQLite library itself is linked by
+** github.com/mattn/go-sqlite3. Copied from sqlite3.h of SQLite 3.42.0, which is in the public domain.
+*/
+#ifndef XSERVER_SQLITE3VFS_H
+#define XSERVER_SQLITE3VFS_H
+
+typedef long long int sqlite3_int64;
+typedef const char *sqlite3_filename;
+typedef void (*sqlite3_syscall_ptr)(void);
+
+typedef struct sqlite3_file sqlite3_file;
+typedef struct sqlite3_io_methods sqlite3_io_methods;
+typedef struct sqlite3_vfs sqlite3_vfs;
+
+struct sqlite3_file {
+  const struct sqlite3_io_methods *pMethods;
+};
+
+struct sqlite3_io_methods {
+  int iVersion;
+  int (*xClose)(sqlite3_file*);
+  int (*xRead)(sqlite3_file*, void*, int iAmt, sqlite3_int64 iOfst);
+  int (*xWrite)(sqlite3_file*, const void*, int iAmt, sqlite3_int64 iOfst);
+  int (*xTruncate)(sqlite3_file*, sqlite3_int64 size);
+  int (*xSync)(sqlite3_file*, int flags);
+  int (*xFileSize)(sqlite3_file*, sqlite3_int64 *pSize);
+  int (*xLock)(sqlite3_file*, int);
+  int (*xUnlock)(sqlite3_file*, int);
+  int (*xCheckReservedLock)(sqlite3_file*, int *pResOut);
+  int (*xFileControl)(sqlite3_file*, int op, void *pArg);
+  int (*xSectorSize)(sqlite3_file*);
+  int (*xDeviceCharacteristics)(sqlite3_file*);
+  int (*xShmMap)(sqlite3_file*, int iPg, int pgsz, int, void volatile**);
+  int (*xShmLock)(sqlite3_file*, int offset, int n, int flags);
+  void (*xShmBarrier)(sqlite3_file*);
+  int (*xShmUnmap)(sqlite3_file*, int deleteFlag);
+  int (*xFetch)(sqlite3_file*, sqlite3_int64 iOfst, int iAmt, void **pp);
+  int (*xUnfetch)(sqlite3_file*, sqlite3_int64 iOfst, void *p);
+};
+
+struct sqlite3_vfs {
+  int iVersion;
+  int szOsFile;
+  int mxPathname;
+  sqlite3_vfs *pNext;
+  const char *zName;
+  void *pAppData;
+  int (*xOpen)(sqlite3_vfs*, sqlite3_filename zName, sqlite3_file*, int flags, int *pOutFlags);
+  int (*xDelete)(sqlite3_vfs*, const char *zName, int syncDir);
+  int (*xAccess)(sqlite3_vfs*, const char *zName, int flags, int *pResOut);
+  int (*xFullPathname)(sqlite3_vfs*, const char *zName, int nOut, char *zOut);
+  void *(*xDlOpen)(sqlite3_vfs*, const char *zFilename);
+  void (*xDlError)(sqlite3_vfs*, int nByte, char *zErrMsg);
+  void (*(*xDlSym)(sqlite3_vfs*,void*, const char *zSymbol))(void);
+  void (*xDlClose)(sqlite3_vfs*, void*);
+  int (*xRandomness)(sqlite3_vfs*, int nByte, char *zOut);
+  int (*xSleep)(sqlite3_vfs*, int microseconds);
+  int (*xCurrentTime)(sqlite3_vfs*, double*);
+  int (*xGetLastError)(sqlite3_vfs*, int, char *);
+  int (*xCurrentTimeInt64)(sqlite3_vfs*, sqlite3_int64*);
+  int (*xSetSystemCall)(sqlite3_vfs*, const char *zName, sqlite3_syscall_ptr);
+  sqlite3_syscall_ptr (*xGetSystemCall)(sqlite3_vfs*, const char *zName);
+  const char *(*xNextSystemCall)(sqlite3_vfs*, const char *zName);
+};
+
+sqlite3_vfs *sqlite3_vfs_find(const char *zVfsName);
+int sqlite3_vfs_register(sqlite3_vfs*, int makeDflt);
+
+#define SQLITE_OK                        0
+#define SQLITE_ERROR                     1
+#define SQLITE_IOERR                     10
+#define SQLITE_NOTFOUND                  12
+#define SQLITE_IOERR_READ                (SQLITE_IOERR | (1<<8))
+#define SQLITE_IOERR_SHORT_READ          (SQLITE_IOERR | (2<<8))
+#define SQLITE_IOERR_WRITE               (SQLITE_IOERR | (3<<8))
+#define SQLITE_IOERR_TRUNCATE            (SQLITE_IOERR | (6<<8))
+#define SQLITE_IOERR_FSTAT               (SQLITE_IOERR | (7<<8))
+
+#define SQLITE_OPEN_MAIN_DB              0x00000100
+
+#define SQLITE_FCNTL_SIZE_HINT           5
+#define SQLITE_FCNTL_CHUNK_SIZE          6
+#define SQLITE_FCNTL_MMAP_SIZE           18
+
+#define SQLITE_IOCAP_ATOMIC              0x00000001
+#define SQLITE_IOCAP_ATOMIC512           0x00000002
+#define SQLITE_IOCAP_ATOMIC1K            0x00000004
+#define SQLITE_IOCAP_ATOMIC2K            0x00000008
+#define SQLITE_IOCAP_ATOMIC4K            0x00000010
+#define SQLITE_IOCAP_ATOMIC8K            0x00000020
+#define SQLITE_IOCAP_ATOMIC16K           0x00000040
+#define SQLITE_IOCAP_ATOMIC32K           0x00000080
+#define SQLITE_IOCAP_ATOMIC64K           0x00000100
+#define SQLITE_IOCAP_SAFE_APPEND         0x00000200
+#define SQLITE_IOCAP_POWERSAFE_OVERWRITE 0x00001000
+#define SQLITE_IOCAP_BATCH_ATOMIC        0x00004000
+
+#endif
@@ -0,0 +1,183 @@
+#include <stddef.h>
+#include "sqlite3vfs.h"
+#include "_cgo_export.h"
+
+/*
+** The encrypted VFS wraps the default VFS: files are opened by the default VFS and their reads, writes, truncates
+** and sizes are passed to Go, which keeps every 4096 bytes block encrypted. Locks, syncs and the shared memory
+** of the write-ahead log are passed to the default VFS as is.
+*/
+
+#define XSERVER_VFS_SECTOR_SIZE 4096
+
+typedef struct xserver_file {
+  sqlite3_file base;
+  sqlite3_file *real;
+  int main;
+} xserver_file;
+
+static sqlite3_vfs *xserver_root = 0;
+static sqlite3_vfs xserver_vfs;
+
+int xserver_real_read(sqlite3_file *file, void *buffer, int amount, sqlite3_int64 offset) {
+  return file->pMethods->xRead(file, buffer, amount, offset);
+}
+
+int xserver_real_write(sqlite3_file *file, void *buffer, int amount, sqlite3_int64 offset) {
+  return file->pMethods->xWrite(file, buffer, amount, offset);
+}
+
+int xserver_real_truncate(sqlite3_file *file, sqlite3_int64 size) {
+  return file->pMethods->xTruncate(file, size);
+}
+
+int xserver_real_size(sqlite3_file *file, sqlite3_int64 *size) {
+  return file->pMethods->xFileSize(file, size);
+}
+
+static int xserverClose(sqlite3_file *file) {
+  sqlite3_file *real = ((xserver_file*)file)->real;
+  return real->pMethods->xClose(real);
+}
+
+static int xserverRead(sqlite3_file *file, void *buffer, int amount, sqlite3_int64 offset) {
+  xserver_file *current = (xserver_file*)file;
+  return xserverVfsRead(current->real, current->main, buffer, amount, offset);
+}
+
+static int xserverWrite(sqlite3_file *file, const void *buffer, int amount, sqlite3_int64 offset) {
+  xserver_file *current = (xserver_file*)file;
+  return xserverVfsWrite(current->real, (void*)buffer, amount, offset);
+}
+
+static int xserverTruncate(sqlite3_file *file, sqlite3_int64 size) {
+  return xserverVfsTruncate(((xserver_file*)file)->real, size);
+}
+
+static int xserverSync(sqlite3_file *file, int flags) {
+  sqlite3_file *real = ((xserver_file*)file)->real;
+  return real->pMethods->xSync(real, flags);
+}
+
+static int xserverFileSize(sqlite3_file *file, sqlite3_int64 *size) {
+  return xserverVfsFileSize(((xserver_file*)file)->real, size);
+}
+
+static int xserverLock(sqlite3_file *file, int lock) {
+  sqlite3_file *real = ((xserver_file*)file)->real;
+  return real->pMethods->xLock(real, lock);
+}
+
+static int xserverUnlock(sqlite3_file *file, int lock) {
+  sqlite3_file *real = ((xserver_file*)file)->real;
+  return real->pMethods->xUnlock(real, lock);
+}
+
+static int xserverCheckReservedLock(sqlite3_file *file, int *result) {
+  sqlite3_file *real = ((xserver_file*)file)->real;
+  return real->pMethods->xCheckReservedLock(real, result);
+}
+
+/* Size hints and chunks preallocate plain bytes and memory mapping reads plain pages, so they are not passed. */
+static int xserverFileControl(sqlite3_file *file, int op, void *arg) {
+  sqlite3_file *real = ((xserver_file*)file)->real;
+  switch (op) {
+    case SQLITE_FCNTL_SIZE_HINT:
+    case SQLITE_FCNTL_CHUNK_SIZE:
+      return SQLITE_OK;
+    case SQLITE_FCNTL_MMAP_SIZE:
+      return SQLITE_NOTFOUND;
+  }
+  return real->pMethods->xFileControl(real, op, arg);
+}
+
+static int xserverSectorSize(sqlite3_file *file) {
+  return XSERVER_VFS_SECTOR_SIZE;
+}
+
+/* Writes of encrypted blocks are neither atomic nor powersafe, so the write-ahead log pads commits to whole blocks. */
+static int xserverDeviceCharacteristics(sqlite3_file *file) {
+  sqlite3_file *real = ((xserver_file*)file)->real;
+  int characteristics = real->pMethods->xDeviceCharacteristics(real);
+  return characteristics & ~(SQLITE_IOCAP_ATOMIC | SQLITE_IOCAP_ATOMIC512 | SQLITE_IOCAP_ATOMIC1K | SQLITE_IOCAP_ATOMIC2K |
+    SQLITE_IOCAP_ATOMIC4K | SQLITE_IOCAP_ATOMIC8K | SQLITE_IOCAP_ATOMIC16K | SQLITE_IOCAP_ATOMIC32K | SQLITE_IOCAP_ATOMIC64K |
+    SQLITE_IOCAP_SAFE_APPEND | SQLITE_IOCAP_POWERSAFE_OVERWRITE | SQLITE_IOCAP_BATCH_ATOMIC);
+}
+
+static int xserverShmMap(sqlite3_file *file, int page, int pageSize, int extend, void volatile **pages) {
+  sqlite3_file *real = ((xserver_file*)file)->real;
+  return real->pMethods->xShmMap(real, page, pageSize, extend, pages);
+}
+
+static int xserverShmLock(sqlite3_file *file, int offset, int n, int flags) {
+  sqlite3_file *real = ((xserver_file*)file)->real;
+  return real->pMethods->xShmLock(real, offset, n, flags);
+}
+
+static void xserverShmBarrier(sqlite3_file *file) {
+  sqlite3_file *real = ((xserver_file*)file)->real;
+  real->pMethods->xShmBarrier(real);
+}
+
+static int xserverShmUnmap(sqlite3_file *file, int deleteFlag) {
+  sqlite3_file *real = ((xserver_file*)file)->real;
+  return real->pMethods->xShmUnmap(real, deleteFlag);
+}
+
+static const sqlite3_io_methods xserver_io_methods = {
+  2,
+  xserverClose,
+  xserverRead,
+  xserverWrite,
+  xserverTruncate,
+  xserverSync,
+  xserverFileSize,
+  xserverLock,
+  xserverUnlock,
+  xserverCheckReservedLock,
+  xserverFileControl,
+  xserverSectorSize,
+  xserverDeviceCharacteristics,
+  xserverShmMap,
+  xserverShmLock,
+  xserverShmBarrier,
+  xserverShmUnmap,
+  0,
+  0
+};
+
+static int xserverOpen(sqlite3_vfs *vfs, sqlite3_filename name, sqlite3_file *file, int flags, int *outFlags) {
+  xserver_file *current = (xserver_file*)file;
+  current->real = (sqlite3_file*)&current[1];
+  current->main = (flags & SQLITE_OPEN_MAIN_DB) != 0;
+
+  int result = xserver_root->xOpen(xserver_root, name, current->real, flags, outFlags);
+  if (result != SQLITE_OK) {
+    file->pMethods = 0;
+    return result;
+  }
+  if (current->real->pMethods->iVersion < 2) {
+    current->real->pMethods->xClose(current->real);
+    file->pMethods = 0;
+    return SQLITE_ERROR;
+  }
+  file->pMethods = &xserver_io_methods;
+  return SQLITE_OK;
+}
+
+int xserver_vfs_register(const char *name) {
+  if (sqlite3_vfs_find(name) != 0) {
+    return SQLITE_OK;
+  }
+  xserver_root = sqlite3_vfs_find(0);
+  if (xserver_root == 0) {
+    return SQLITE_ERROR;
+  }
+
+  xserver_vfs = *xserver_root;
+  xserver_vfs.szOsFile = (int)sizeof(xserver_file) + xserver_root->szOsFile;
+  xserver_vfs.pNext = 0;
+  xserver_vfs.zName = name;
+  xserver_vfs.xOpen = xserverOpen;
+  return sqlite3_vfs_register(&xserver_vfs, 0);
+}
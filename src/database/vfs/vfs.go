@@ -0,0 +1,142 @@
+// Package vfs registers the sqlite vfs keeping database files, their journals and write-ahead logs encrypted with AES-GCM.
+package vfs
+
+/*
+#include "sqlite3vfs.h"
+
+int xserver_real_read(sqlite3_file *file, void *buffer, int amount, sqlite3_int64 offset);
+int xserver_real_write(sqlite3_file *file, void *buffer, int amount, sqlite3_int64 offset);
+int xserver_real_truncate(sqlite3_file *file, sqlite3_int64 size);
+int xserver_real_size(sqlite3_file *file, sqlite3_int64 *size);
+int xserver_vfs_register(const char *name);
+*/
+import "C"
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+	"xserver/src/logger"
+)
+
+const (
+	// Name is the name of the vfs in data sources, e.g. "storage.db?vfs=xserver-aes".
+	Name = "xserver-aes"
+)
+
+var (
+	registerOnce  sync.Once
+	registerError error
+)
+
+// Register registers the vfs in sqlite, keys are set by Configure.
+func Register() error {
+	registerOnce.Do(func() {
+		if result := C.xserver_vfs_register(C.CString(Name)); result != C.SQLITE_OK {
+			registerError = fmt.Errorf("failed register %s vfs, sqlite error %d", Name, int(result))
+		}
+	})
+	return registerError
+}
+
+// realFile is the file opened by the default vfs.
+type realFile struct {
+	file *C.sqlite3_file
+}
+
+func (real realFile) ReadAt(data []byte, offset int64) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if result := C.xserver_real_read(real.file, unsafe.Pointer(&data[0]), C.int(len(data)), C.sqlite3_int64(offset)); result != C.SQLITE_OK {
+		return fmt.Errorf("failed read file, sqlite error %d", int(result))
+	}
+	return nil
+}
+
+func (real realFile) WriteAt(data []byte, offset int64) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if result := C.xserver_real_write(real.file, unsafe.Pointer(&data[0]), C.int(len(data)), C.sqlite3_int64(offset)); result != C.SQLITE_OK {
+		return fmt.Errorf("failed write file, sqlite error %d", int(result))
+	}
+	return nil
+}
+
+func (real realFile) Truncate(size int64) error {
+	if result := C.xserver_real_truncate(real.file, C.sqlite3_int64(size)); result != C.SQLITE_OK {
+		return fmt.Errorf("failed truncate file, sqlite error %d", int(result))
+	}
+	return nil
+}
+
+func (real realFile) Size() (int64, error) {
+	size := C.sqlite3_int64(0)
+	if result := C.xserver_real_size(real.file, &size); result != C.SQLITE_OK {
+		return 0, fmt.Errorf("failed get file size, sqlite error %d", int(result))
+	}
+	return int64(size), nil
+}
+
+func openFile(real *C.sqlite3_file, main bool) (*file, bool) {
+	ring := keys.Load()
+	if ring == nil {
+		logger.Error(fmt.Sprintf("[XServer] [Database] [Vfs] [Error] %s vfs keys are not configured", Name))
+		return nil, false
+	}
+	return &file{storage: realFile{file: real}, keys: ring, main: main}, true
+}
+
+//export xserverVfsRead
+func xserverVfsRead(real *C.sqlite3_file, main C.int, buffer unsafe.Pointer, amount C.int, offset C.sqlite3_int64) C.int {
+	current, ok := openFile(real, main != 0)
+	if !ok {
+		return C.SQLITE_IOERR_READ
+	}
+	err := current.ReadAt(unsafe.Slice((*byte)(buffer), int(amount)), int64(offset))
+	if err == errShortRead {
+		return C.SQLITE_IOERR_SHORT_READ
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("[XServer] [Database] [Vfs] [Error] failed read %d bytes at %d: %s", int(amount), int64(offset), err))
+		return C.SQLITE_IOERR_READ
+	}
+	return C.SQLITE_OK
+}
+
+//export xserverVfsWrite
+func xserverVfsWrite(real *C.sqlite3_file, buffer unsafe.Pointer, amount C.int, offset C.sqlite3_int64) C.int {
+	current, ok := openFile(real, false)
+	if !ok {
+		return C.SQLITE_IOERR_WRITE
+	}
+	if err := current.WriteAt(unsafe.Slice((*byte)(buffer), int(amount)), int64(offset)); err != nil {
+		logger.Error(fmt.Sprintf("[XServer] [Database] [Vfs] [Error] failed write %d bytes at %d: %s", int(amount), int64(offset), err))
+		return C.SQLITE_IOERR_WRITE
+	}
+	return C.SQLITE_OK
+}
+
+//export xserverVfsTruncate
+func xserverVfsTruncate(real *C.sqlite3_file, size C.sqlite3_int64) C.int {
+	current, ok := openFile(real, false)
+	if !ok {
+		return C.SQLITE_IOERR_TRUNCATE
+	}
+	if err := current.Truncate(int64(size)); err != nil {
+		logger.Error(fmt.Sprintf("[XServer] [Database] [Vfs] [Error] failed truncate to %d bytes: %s", int64(size), err))
+		return C.SQLITE_IOERR_TRUNCATE
+	}
+	return C.SQLITE_OK
+}
+
+//export xserverVfsFileSize
+func xserverVfsFileSize(real *C.sqlite3_file, size *C.sqlite3_int64) C.int {
+	physical, err := realFile{file: real}.Size()
+	if err != nil {
+		return C.SQLITE_IOERR_FSTAT
+	}
+	*size = C.sqlite3_int64(logicalSize(physical))
+	return C.SQLITE_OK
+}
@@ -0,0 +1,332 @@
+package vfs
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	testKey      = bytes.Repeat([]byte{1}, 32)
+	testOtherKey = bytes.Repeat([]byte{2}, 32)
+)
+
+// memoryStorage keeps chunks in memory.
+type memoryStorage struct {
+	data []byte
+}
+
+func (storage *memoryStorage) ReadAt(data []byte, offset int64) error {
+	if offset+int64(len(data)) > int64(len(storage.data)) {
+		return fmt.Errorf("read past the end")
+	}
+	copy(data, storage.data[offset:])
+	return nil
+}
+
+func (storage *memoryStorage) WriteAt(data []byte, offset int64) error {
+	if end := offset + int64(len(data)); end > int64(len(storage.data)) {
+		storage.data = append(storage.data, make([]byte, end-int64(len(storage.data)))...)
+	}
+	copy(storage.data[offset:], data)
+	return nil
+}
+
+func (storage *memoryStorage) Truncate(size int64) error {
+	storage.data = storage.data[:size]
+	return nil
+}
+
+func (storage *memoryStorage) Size() (int64, error) {
+	return int64(len(storage.data)), nil
+}
+
+func configureTestKeys(t *testing.T, current []byte, previous ...[]byte) {
+	t.Helper()
+	if err := Configure(current, previous); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { keys.Store(nil) })
+}
+
+func pattern(length int, seed byte) []byte {
+	data := make([]byte, length)
+	for i := range data {
+		data[i] = seed + byte(i%251)
+	}
+	return data
+}
+
+func TestLogicalSize(t *testing.T) {
+	tests := []struct {
+		physical int64
+		logical  int64
+	}{
+		{0, 0},
+		{overhead, 0},
+		{overhead + 1, 1},
+		{chunkSize, BlockSize},
+		{chunkSize + overhead + 10, BlockSize + 10},
+		{3 * chunkSize, 3 * BlockSize},
+	}
+	for _, test := range tests {
+		if result := logicalSize(test.physical); result != test.logical {
+			t.Errorf("logicalSize(%d) = %d, expected %d", test.physical, result, test.logical)
+		}
+	}
+}
+
+func TestFileReadWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []int64
+		length int
+	}{
+		{name: "aligned block", writes: []int64{0}, length: BlockSize},
+		{name: "pages", writes: []int64{0, 2 * BlockSize, BlockSize}, length: 2 * BlockSize},
+		{name: "unaligned frames", writes: []int64{32, 32 + 4120, 32 + 2*4120}, length: 4120},
+		{name: "small writes", writes: []int64{0, 100, 5000}, length: 24},
+		{name: "gap", writes: []int64{3*BlockSize + 7}, length: 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configureTestKeys(t, testKey)
+			storage := &memoryStorage{}
+			current := &file{storage: storage, keys: keys.Load()}
+			expected := []byte{}
+			for index, offset := range test.writes {
+				data := pattern(test.length, byte(index))
+				if err := current.WriteAt(data, offset); err != nil {
+					t.Fatal(err)
+				}
+				if end := offset + int64(len(data)); end > int64(len(expected)) {
+					expected = append(expected, make([]byte, end-int64(len(expected)))...)
+				}
+				copy(expected[offset:], data)
+			}
+
+			if size, _ := current.Size(); size != int64(len(expected)) {
+				t.Fatalf("size %d, expected %d", size, len(expected))
+			}
+			result := make([]byte, len(expected))
+			if err := current.ReadAt(result, 0); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(result, expected) {
+				t.Fatal("read data differs from written data")
+			}
+			if bytes.Contains(storage.data, pattern(test.length, 0)[:int(minimum(int64(test.length), 16))]) {
+				t.Fatal("storage contains plain data")
+			}
+		})
+	}
+}
+
+func TestFileShortRead(t *testing.T) {
+	configureTestKeys(t, testKey)
+	current := &file{storage: &memoryStorage{}, keys: keys.Load()}
+	if err := current.WriteAt(pattern(100, 1), 0); err != nil {
+		t.Fatal(err)
+	}
+	result := bytes.Repeat([]byte{0xff}, 200)
+	if err := current.ReadAt(result, 0); err != errShortRead {
+		t.Fatalf("expected short read, got %v", err)
+	}
+	if !bytes.Equal(result[:100], pattern(100, 1)) || !bytes.Equal(result[100:], make([]byte, 100)) {
+		t.Fatal("short read must return data and zeros after the end")
+	}
+}
+
+func TestFileTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		size int64
+	}{
+		{name: "block boundary", size: BlockSize},
+		{name: "inside block", size: BlockSize + 100},
+		{name: "empty", size: 0},
+		{name: "extend", size: 4 * BlockSize},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configureTestKeys(t, testKey)
+			current := &file{storage: &memoryStorage{}, keys: keys.Load()}
+			data := pattern(3*BlockSize, 3)
+			if err := current.WriteAt(data, 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := current.Truncate(test.size); err != nil {
+				t.Fatal(err)
+			}
+			if size, _ := current.Size(); size != test.size {
+				t.Fatalf("size %d, expected %d", size, test.size)
+			}
+			expected := append(data, make([]byte, BlockSize)...)[:test.size]
+			result := make([]byte, test.size)
+			if err := current.ReadAt(result, 0); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(result, expected) {
+				t.Fatal("truncated data differs")
+			}
+		})
+	}
+}
+
+func TestFileTornChunk(t *testing.T) {
+	tests := []struct {
+		name  string
+		main  bool
+		fails bool
+	}{
+		{name: "journal", main: false, fails: false},
+		{name: "main database", main: true, fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configureTestKeys(t, testKey)
+			storage := &memoryStorage{}
+			current := &file{storage: storage, keys: keys.Load(), main: test.main}
+			if err := current.WriteAt(pattern(BlockSize+500, 5), 0); err != nil {
+				t.Fatal(err)
+			}
+			storage.data[len(storage.data)-1] ^= 0xff
+
+			result := make([]byte, 500)
+			err := current.ReadAt(result, BlockSize)
+			if test.fails != (err != nil) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !test.fails && !bytes.Equal(result, make([]byte, 500)) {
+				t.Fatal("torn chunk must be read as zeros")
+			}
+			if err := current.ReadAt(result, 0); err != nil {
+				t.Fatalf("whole chunks must be read, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFileKeyRotation(t *testing.T) {
+	configureTestKeys(t, testKey)
+	storage := &memoryStorage{}
+	data := pattern(2*BlockSize, 7)
+	if err := (&file{storage: storage, keys: keys.Load()}).WriteAt(data, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	configureTestKeys(t, testOtherKey)
+	result := make([]byte, len(data))
+	if err := (&file{storage: storage, keys: keys.Load(), main: true}).ReadAt(result, 0); err == nil {
+		t.Fatal("blocks of the unknown key must not be read")
+	}
+
+	configureTestKeys(t, testOtherKey, testKey)
+	current := &file{storage: storage, keys: keys.Load(), main: true}
+	if err := current.ReadAt(result, 0); err != nil || !bytes.Equal(result, data) {
+		t.Fatalf("blocks of the previous key must be read, got %v", err)
+	}
+	if err := current.WriteAt(data[:BlockSize], 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(storage.data[:keyIdSize], keys.Load().current.id[:]) || bytes.Equal(storage.data[chunkSize:chunkSize+keyIdSize], keys.Load().current.id[:]) {
+		t.Fatal("only written blocks must be encrypted with the current key")
+	}
+}
+
+func TestFileSwappedChunks(t *testing.T) {
+	configureTestKeys(t, testKey)
+	storage := &memoryStorage{}
+	current := &file{storage: storage, keys: keys.Load(), main: true}
+	if err := current.WriteAt(pattern(2*BlockSize, 9), 0); err != nil {
+		t.Fatal(err)
+	}
+	first := append([]byte{}, storage.data[:chunkSize]...)
+	copy(storage.data, storage.data[chunkSize:])
+	copy(storage.data[chunkSize:], first)
+	if err := current.ReadAt(make([]byte, BlockSize), 0); err == nil {
+		t.Fatal("swapped chunks must not be read")
+	}
+}
+
+func TestDatabase(t *testing.T) {
+	if err := Register(); err != nil {
+		t.Fatal(err)
+	}
+	configureTestKeys(t, testKey)
+	directory := t.TempDir()
+	path := filepath.Join(directory, "storage.db")
+
+	plain, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{"CREATE TABLE Users (name TEXT)", "INSERT INTO Users VALUES ('plain-secret-value')"} {
+		if _, err := plain.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	plain.Close()
+
+	if isPlain, err := IsPlain(path); err != nil || !isPlain {
+		t.Fatalf("expected plain database, got %v", err)
+	}
+	if err := EncryptFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if isPlain, _ := IsPlain(path); isPlain {
+		t.Fatal("expected encrypted database")
+	}
+
+	for _, journal := range []string{"DELETE", "WAL"} {
+		t.Run(journal, func(t *testing.T) {
+			db, err := sql.Open("sqlite3", path+"?vfs="+Name+"&_sync=FULL")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if _, err := db.Exec("PRAGMA journal_mode=" + journal); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 200; i++ {
+				if _, err := db.Exec("INSERT INTO Users VALUES (?)", fmt.Sprintf("secret-value-%d", i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			count := 0
+			if err := db.QueryRow("SELECT count(*) FROM Users WHERE name LIKE '%secret-value%'").Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+			if count == 0 {
+				t.Fatal("rows are not selected")
+			}
+			problem := ""
+			if err := db.QueryRow("PRAGMA integrity_check").Scan(&problem); err != nil || problem != "ok" {
+				t.Fatalf("integrity check %q, %v", problem, err)
+			}
+		})
+	}
+
+	for _, suffix := range []string{"", "-wal", "-journal"} {
+		data, err := os.ReadFile(path + suffix)
+		if err != nil {
+			continue
+		}
+		if bytes.Contains(data, []byte("secret-value")) {
+			t.Fatalf("%s contains plain values", path+suffix)
+		}
+	}
+
+	usage, err := KeyUsage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 1 || usage[CurrentKey()] == 0 {
+		t.Fatalf("unexpected key usage %v", usage)
+	}
+}
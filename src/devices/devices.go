@@ -0,0 +1,154 @@
+package devices
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/metrics"
+)
+
+const (
+	GpusEnv    = "XSERVER_GPUS"
+	DevicesEnv = "XSERVER_DEVICES"
+)
+
+var (
+	ErrQueueTimeout = errors.New("gpus wait timeout")
+)
+
+func init() {
+	metrics.Register("xserver_gpus_active", metrics.GaugeType, "Number of units processes running on the gpu.")
+	metrics.Register("xserver_gpus_queued", metrics.GaugeType, "Number of units processes waiting for free gpus.")
+	metrics.Register("xserver_gpus_rejected_total", metrics.CounterType, "Number of units processes rejected because gpus are busy.")
+}
+
+// Scheduler assigns gpus to units processes, processes wait for free gpus until the queue timeout.
+type Scheduler struct {
+	devices      []string
+	perDevice    int
+	queueTimeout time.Duration
+	mutex        sync.Mutex
+	used         map[string]int
+	queued       int
+	released     chan struct{}
+}
+
+func Create(settings config.Gpus) (*Scheduler, error) {
+	if len(settings.Devices) == 0 {
+		return nil, nil
+	}
+
+	queueTimeout, err := time.ParseDuration(settings.QueueTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduler := &Scheduler{
+		devices:      settings.Devices,
+		perDevice:    settings.PerDevice,
+		queueTimeout: queueTimeout,
+		used:         map[string]int{},
+		released:     make(chan struct{}),
+	}
+	for _, device := range settings.Devices {
+		metrics.Set("xserver_gpus_active", 0, "device", device)
+	}
+	return scheduler, nil
+}
+
+// assign takes the least loaded devices with free slots, devices are kept in the configured order on ties.
+func (scheduler *Scheduler) assign(count int) []string {
+	free := []string{}
+	for _, device := range scheduler.devices {
+		if scheduler.used[device] < scheduler.perDevice {
+			free = append(free, device)
+		}
+	}
+	if len(free) < count {
+		return nil
+	}
+	sort.SliceStable(free, func(i, j int) bool { return scheduler.used[free[i]] < scheduler.used[free[j]] })
+
+	assigned := free[:count]
+	for _, device := range assigned {
+		scheduler.used[device]++
+		metrics.Set("xserver_gpus_active", float64(scheduler.used[device]), "device", device)
+	}
+	return assigned
+}
+
+func (scheduler *Scheduler) release(assigned []string) {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	for _, device := range assigned {
+		scheduler.used[device]--
+		metrics.Set("xserver_gpus_active", float64(scheduler.used[device]), "device", device)
+	}
+	close(scheduler.released)
+	scheduler.released = make(chan struct{})
+}
+
+// Acquire assigns gpus requested by the unit and returns their release, units without gpus are not scheduled.
+func (scheduler *Scheduler) Acquire(ctx context.Context, devices *config.Devices) ([]string, func(), error) {
+	if scheduler == nil || devices == nil || devices.Gpus == 0 {
+		return nil, func() {}, nil
+	}
+
+	timer := time.NewTimer(scheduler.queueTimeout)
+	defer timer.Stop()
+
+	queued := false
+	defer func() {
+		if queued {
+			scheduler.mutex.Lock()
+			scheduler.queued--
+			metrics.Set("xserver_gpus_queued", float64(scheduler.queued))
+			scheduler.mutex.Unlock()
+		}
+	}()
+
+	for {
+		scheduler.mutex.Lock()
+		assigned := scheduler.assign(devices.Gpus)
+		released := scheduler.released
+		if assigned == nil && !queued {
+			queued = true
+			scheduler.queued++
+			metrics.Set("xserver_gpus_queued", float64(scheduler.queued))
+		}
+		scheduler.mutex.Unlock()
+		if assigned != nil {
+			return assigned, func() { scheduler.release(assigned) }, nil
+		}
+
+		select {
+		case <-released:
+		case <-timer.C:
+			metrics.Inc("xserver_gpus_rejected_total")
+			return nil, nil, ErrQueueTimeout
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// Env returns variables exposing the assigned gpus and device files to the unit process.
+func Env(devices *config.Devices, assigned []string) []string {
+	env := []string{}
+	if devices == nil {
+		return env
+	}
+	if len(assigned) != 0 {
+		gpus := strings.Join(assigned, ",")
+		env = append(env, "CUDA_VISIBLE_DEVICES="+gpus, "NVIDIA_VISIBLE_DEVICES="+gpus, GpusEnv+"="+gpus)
+	}
+	if len(devices.Paths) != 0 {
+		env = append(env, DevicesEnv+"="+strings.Join(devices.Paths, ","))
+	}
+	return env
+}
@@ -0,0 +1,135 @@
+package doctor
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	versionArguments = map[string][]string{
+		"go": {"version"},
+	}
+)
+
+type Result struct {
+	Name    string
+	Info    string
+	Warning string
+	Error   error
+	Fix     string
+}
+
+func ToolVersion(tool string) (string, error) {
+	toolPath, err := exec.LookPath(tool)
+	if err != nil {
+		return "", err
+	}
+
+	arguments, ok := versionArguments[filepath.Base(tool)]
+	if !ok {
+		arguments = []string{"--version"}
+	}
+
+	output, err := exec.Command(toolPath, arguments...).CombinedOutput()
+	if err != nil {
+		return toolPath, nil
+	}
+
+	version := strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0])
+	return fmt.Sprintf("%s (%s)", version, toolPath), nil
+}
+
+func Writable(directory string) error {
+	for {
+		info, err := os.Stat(directory)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", directory)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(directory)
+		if parent == directory {
+			return err
+		}
+		directory = parent
+	}
+
+	file, err := os.CreateTemp(directory, ".xserver-doctor-")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+func PortAvailable(url string) error {
+	listener, err := net.Listen("tcp", url)
+	if err != nil {
+		return err
+	}
+	return listener.Close()
+}
+
+// Reachable checks the http url responds without server error or the tcp url accepts connections.
+func Reachable(target string, timeout time.Duration) error {
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+
+	if parsed.Scheme == "tcp" {
+		connection, err := net.DialTimeout("tcp", parsed.Host, timeout)
+		if err != nil {
+			return err
+		}
+		return connection.Close()
+	}
+
+	response, err := (&http.Client{Timeout: timeout}).Get(target)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("responded %s", response.Status)
+	}
+	return nil
+}
+
+func Report(writer io.Writer, results []Result) bool {
+	ok := true
+	for _, result := range results {
+		if result.Error == nil && result.Warning != "" {
+			fmt.Fprintf(writer, "[WARN] %s: %s\n", result.Name, result.Warning)
+			continue
+		}
+
+		if result.Error == nil {
+			fmt.Fprintf(writer, "[OK] %s", result.Name)
+			if result.Info != "" {
+				fmt.Fprintf(writer, ": %s", result.Info)
+			}
+			fmt.Fprintln(writer)
+			continue
+		}
+
+		ok = false
+		fmt.Fprintf(writer, "[FAIL] %s: %s\n", result.Name, result.Error)
+		if result.Fix != "" {
+			fmt.Fprintf(writer, "\tfix: %s\n", result.Fix)
+		}
+	}
+	return ok
+}
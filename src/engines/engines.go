@@ -0,0 +1,95 @@
+package engines
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"xserver/src/database"
+	"xserver/src/modes"
+)
+
+const (
+	EngineEmbedded = "embedded"
+)
+
+type Engine interface {
+	Handle(writer http.ResponseWriter, request *http.Request) error
+}
+
+func Create(path string, storage *database.Database, serverModes *modes.Modes) (Engine, error) {
+	api := &sandbox{storage: storage, modes: serverModes}
+	switch filepath.Ext(path) {
+	case ".lua":
+		return newLua(path, api)
+	case ".star":
+		return newStarlark(path, api)
+	}
+	return nil, fmt.Errorf(`embedded engine does not support "%s" files`, filepath.Ext(path))
+}
+
+// sandbox is the db and kv api of scripts, writes are rejected in read-only mode as writes of database endpoints.
+type sandbox struct {
+	storage *database.Database
+	modes   *modes.Modes
+}
+
+// checkAvailable rejects calls without the database, e.g. when the server is degraded after the failed database startup check.
+func (api *sandbox) checkAvailable() error {
+	if api.storage == nil {
+		return fmt.Errorf("[XServer] [Database] [Error] database is unavailable")
+	}
+	return nil
+}
+
+func (api *sandbox) checkWrite() error {
+	if api.modes != nil && api.modes.Get().ReadOnly {
+		return fmt.Errorf("[XServer] [Modes] [Error] server is in read-only mode")
+	}
+	return api.checkAvailable()
+}
+
+// db runs the database operation with the json request and returns the json result.
+func (api *sandbox) db(operation string, request string) (string, error) {
+	check := api.checkAvailable
+	if operation != "select" {
+		check = api.checkWrite
+	}
+	if err := check(); err != nil {
+		return "", err
+	}
+	calls := map[string]func(io.Reader, io.Writer) error{
+		"insert": api.storage.Insert,
+		"select": api.storage.Select,
+		"update": api.storage.Update,
+		"delete": api.storage.Delete,
+	}
+	output := &bytes.Buffer{}
+	if err := calls[operation](strings.NewReader(request), output); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output.String()), nil
+}
+
+func (api *sandbox) kvGet(key string) (string, bool, error) {
+	if err := api.checkAvailable(); err != nil {
+		return "", false, err
+	}
+	return api.storage.KvGet(key)
+}
+
+func (api *sandbox) kvSet(key string, value string) error {
+	if err := api.checkWrite(); err != nil {
+		return err
+	}
+	return api.storage.KvSet(key, value)
+}
+
+func (api *sandbox) kvDelete(key string) error {
+	if err := api.checkWrite(); err != nil {
+		return err
+	}
+	return api.storage.KvDelete(key)
+}
@@ -0,0 +1,178 @@
+package engines
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"xserver/src/config"
+	"xserver/src/modes"
+)
+
+func writeScript(t *testing.T, name string, source string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		source string
+	}{
+		{
+			name: "lua",
+			file: "handler.lua",
+			source: `response.status = 201
+response.headers["Content-Type"] = "text/plain"
+response.body = request.method .. " " .. request.path .. " " .. request.query .. " " .. request.headers["X-Name"] .. " " .. request.body`,
+		},
+		{
+			name: "starlark",
+			file: "handler.star",
+			source: `response["status"] = 201
+response["headers"]["Content-Type"] = "text/plain"
+response["body"] = " ".join([request.method, request.path, request.query, request.headers["X-Name"], request.body])`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			engine, err := Create(writeScript(t, test.file, test.source), nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := httptest.NewRequest(http.MethodPost, "/hello?a=1", strings.NewReader("payload"))
+			request.Header.Set("X-Name", "name")
+			recorder := httptest.NewRecorder()
+			if err := engine.Handle(recorder, request); err != nil {
+				t.Fatal(err)
+			}
+			if recorder.Code != http.StatusCreated || recorder.Header().Get("Content-Type") != "text/plain" {
+				t.Fatalf("unexpected response %d %v", recorder.Code, recorder.Header())
+			}
+			if body := recorder.Body.String(); body != "POST /hello a=1 name payload" {
+				t.Fatalf("unexpected body %q", body)
+			}
+		})
+	}
+}
+
+func TestCreateErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		source string
+	}{
+		{name: "unsupported", file: "handler.js", source: "response.body = 1"},
+		{name: "lua syntax", file: "handler.lua", source: "response.body = "},
+		{name: "starlark syntax", file: "handler.star", source: "response[\"body\"] = "},
+		{name: "starlark undefined", file: "handler.star", source: "unknown()"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Create(writeScript(t, test.file, test.source), nil, nil); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		source string
+	}{
+		{name: "lua io", file: "handler.lua", source: `io.open("/etc/passwd")`},
+		{name: "lua require", file: "handler.lua", source: `require("os")`},
+		{name: "starlark load", file: "handler.star", source: `load("os.star", "os")`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			engine, err := Create(writeScript(t, test.file, test.source), nil, nil)
+			if err != nil {
+				return
+			}
+			if err := engine.Handle(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	api := &sandbox{modes: modes.Create(config.Modes{ReadOnly: true})}
+	for _, operation := range []string{"insert", "update", "delete"} {
+		if _, err := api.db(operation, "{}"); err == nil || !strings.Contains(err.Error(), "read-only") {
+			t.Errorf("%s must be rejected in read-only mode, got %v", operation, err)
+		}
+	}
+	if err := api.kvSet("key", "value"); err == nil {
+		t.Error("kv set must be rejected in read-only mode")
+	}
+	if err := api.kvDelete("key"); err == nil {
+		t.Error("kv delete must be rejected in read-only mode")
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		source string
+	}{
+		{name: "lua db", file: "handler.lua", source: `db.select("{}")`},
+		{name: "lua kv", file: "handler.lua", source: `kv.get("key")`},
+		{name: "starlark db", file: "handler.star", source: `db.select("{}")`},
+		{name: "starlark kv", file: "handler.star", source: `kv.get("key")`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			engine, err := Create(writeScript(t, test.file, test.source), nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = engine.Handle(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			if err == nil || !strings.Contains(err.Error(), "database is unavailable") {
+				t.Fatalf("expected unavailable database error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCancel(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		source string
+	}{
+		{name: "lua", file: "handler.lua", source: "while true do end"},
+		{name: "starlark", file: "handler.star", source: "for i in range(1000000000):\n    pass"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			engine, err := Create(writeScript(t, test.file, test.source), nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			startedAt := time.Now()
+			request := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+			if err := engine.Handle(httptest.NewRecorder(), request); err == nil {
+				t.Fatal("expected error")
+			}
+			if time.Since(startedAt) > 5*time.Second {
+				t.Fatal("script is not cancelled by the context")
+			}
+		})
+	}
+}
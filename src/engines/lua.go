@@ -0,0 +1,167 @@
+package engines
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+var (
+	luaLibraries = []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	}
+	luaUnsafeGlobals = []string{"dofile", "loadfile", "load", "loadstring", "require", "module", "collectgarbage"}
+)
+
+type Lua struct {
+	proto *lua.FunctionProto
+	api   *sandbox
+}
+
+func newLua(path string, api *sandbox) (*Lua, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed open script: %s", err)
+	}
+	defer file.Close()
+
+	chunk, err := parse.Parse(file, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed parse script: %s", err)
+	}
+
+	proto, err := lua.Compile(chunk, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed compile script: %s", err)
+	}
+
+	return &Lua{proto: proto, api: api}, nil
+}
+
+func (engine *Lua) newState() *lua.LState {
+	state := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, library := range luaLibraries {
+		state.Push(state.NewFunction(library.open))
+		state.Push(lua.LString(library.name))
+		state.Call(1, 0)
+	}
+	for _, name := range luaUnsafeGlobals {
+		state.SetGlobal(name, lua.LNil)
+	}
+	return state
+}
+
+func (engine *Lua) requestTable(state *lua.LState, request *http.Request, body []byte) *lua.LTable {
+	headers := state.NewTable()
+	for name := range request.Header {
+		headers.RawSetString(name, lua.LString(request.Header.Get(name)))
+	}
+
+	table := state.NewTable()
+	table.RawSetString("method", lua.LString(request.Method))
+	table.RawSetString("path", lua.LString(request.URL.Path))
+	table.RawSetString("query", lua.LString(request.URL.RawQuery))
+	table.RawSetString("headers", headers)
+	table.RawSetString("body", lua.LString(body))
+	return table
+}
+
+func (engine *Lua) dbCall(operation string) lua.LGFunction {
+	return func(state *lua.LState) int {
+		result, err := engine.api.db(operation, state.CheckString(1))
+		if err != nil {
+			state.RaiseError("%s", err)
+		}
+		state.Push(lua.LString(result))
+		return 1
+	}
+}
+
+func (engine *Lua) dbTable(state *lua.LState) *lua.LTable {
+	return state.SetFuncs(state.NewTable(), map[string]lua.LGFunction{
+		"insert": engine.dbCall("insert"),
+		"select": engine.dbCall("select"),
+		"update": engine.dbCall("update"),
+		"delete": engine.dbCall("delete"),
+	})
+}
+
+func (engine *Lua) kvTable(state *lua.LState) *lua.LTable {
+	return state.SetFuncs(state.NewTable(), map[string]lua.LGFunction{
+		"get": func(state *lua.LState) int {
+			value, ok, err := engine.api.kvGet(state.CheckString(1))
+			if err != nil {
+				state.RaiseError("%s", err)
+			}
+			if !ok {
+				state.Push(lua.LNil)
+				return 1
+			}
+			state.Push(lua.LString(value))
+			return 1
+		},
+		"set": func(state *lua.LState) int {
+			if err := engine.api.kvSet(state.CheckString(1), state.CheckString(2)); err != nil {
+				state.RaiseError("%s", err)
+			}
+			return 0
+		},
+		"delete": func(state *lua.LState) int {
+			if err := engine.api.kvDelete(state.CheckString(1)); err != nil {
+				state.RaiseError("%s", err)
+			}
+			return 0
+		},
+	})
+}
+
+func (engine *Lua) Handle(writer http.ResponseWriter, request *http.Request) error {
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return fmt.Errorf("failed read request body: %s", err)
+	}
+
+	state := engine.newState()
+	defer state.Close()
+	state.SetContext(request.Context())
+
+	response := state.NewTable()
+	response.RawSetString("status", lua.LNumber(http.StatusOK))
+	response.RawSetString("headers", state.NewTable())
+	response.RawSetString("body", lua.LString(""))
+
+	state.SetGlobal("request", engine.requestTable(state, request, body))
+	state.SetGlobal("response", response)
+	state.SetGlobal("db", engine.dbTable(state))
+	state.SetGlobal("kv", engine.kvTable(state))
+
+	state.Push(state.NewFunctionFromProto(engine.proto))
+	if err := state.PCall(0, 0, nil); err != nil {
+		if apiError, ok := err.(*lua.ApiError); ok {
+			return fmt.Errorf("failed run script: %s", apiError.Object)
+		}
+		return fmt.Errorf("failed run script: %s", err)
+	}
+
+	if headers, ok := response.RawGetString("headers").(*lua.LTable); ok {
+		headers.ForEach(func(name lua.LValue, value lua.LValue) {
+			writer.Header().Set(name.String(), value.String())
+		})
+	}
+	if status, ok := response.RawGetString("status").(lua.LNumber); ok {
+		writer.WriteHeader(int(status))
+	}
+	writer.Write([]byte(lua.LVAsString(response.RawGetString("body"))))
+
+	return nil
+}
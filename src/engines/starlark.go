@@ -0,0 +1,187 @@
+package engines
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"xserver/src/logger"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+var (
+	starlarkOptions     = &syntax.FileOptions{Set: true, TopLevelControl: true, GlobalReassign: true}
+	starlarkPredeclared = []string{"request", "response", "db", "kv"}
+)
+
+type Starlark struct {
+	path    string
+	program *starlark.Program
+	api     *sandbox
+}
+
+func newStarlark(path string, api *sandbox) (*Starlark, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed open script: %s", err)
+	}
+
+	predeclared := map[string]bool{}
+	for _, name := range starlarkPredeclared {
+		predeclared[name] = true
+	}
+	_, program, err := starlark.SourceProgramOptions(starlarkOptions, path, source, func(name string) bool { return predeclared[name] })
+	if err != nil {
+		return nil, fmt.Errorf("failed compile script: %s", err)
+	}
+
+	return &Starlark{path: path, program: program, api: api}, nil
+}
+
+func (engine *Starlark) requestStruct(request *http.Request, body []byte) *starlarkstruct.Struct {
+	headers := starlark.NewDict(len(request.Header))
+	for name := range request.Header {
+		headers.SetKey(starlark.String(name), starlark.String(request.Header.Get(name)))
+	}
+	headers.Freeze()
+
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"method":  starlark.String(request.Method),
+		"path":    starlark.String(request.URL.Path),
+		"query":   starlark.String(request.URL.RawQuery),
+		"headers": headers,
+		"body":    starlark.String(body),
+	})
+}
+
+func (engine *Starlark) dbCall(operation string) *starlark.Builtin {
+	return starlark.NewBuiltin(operation, func(thread *starlark.Thread, builtin *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		request := ""
+		if err := starlark.UnpackPositionalArgs(builtin.Name(), args, kwargs, 1, &request); err != nil {
+			return nil, err
+		}
+		result, err := engine.api.db(operation, request)
+		if err != nil {
+			return nil, err
+		}
+		return starlark.String(result), nil
+	})
+}
+
+func (engine *Starlark) dbModule() *starlarkstruct.Module {
+	return &starlarkstruct.Module{Name: "db", Members: starlark.StringDict{
+		"insert": engine.dbCall("insert"),
+		"select": engine.dbCall("select"),
+		"update": engine.dbCall("update"),
+		"delete": engine.dbCall("delete"),
+	}}
+}
+
+func (engine *Starlark) kvModule() *starlarkstruct.Module {
+	return &starlarkstruct.Module{Name: "kv", Members: starlark.StringDict{
+		"get": starlark.NewBuiltin("get", func(thread *starlark.Thread, builtin *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			key := ""
+			if err := starlark.UnpackPositionalArgs(builtin.Name(), args, kwargs, 1, &key); err != nil {
+				return nil, err
+			}
+			value, ok, err := engine.api.kvGet(key)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return starlark.None, nil
+			}
+			return starlark.String(value), nil
+		}),
+		"set": starlark.NewBuiltin("set", func(thread *starlark.Thread, builtin *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			key, value := "", ""
+			if err := starlark.UnpackPositionalArgs(builtin.Name(), args, kwargs, 2, &key, &value); err != nil {
+				return nil, err
+			}
+			return starlark.None, engine.api.kvSet(key, value)
+		}),
+		"delete": starlark.NewBuiltin("delete", func(thread *starlark.Thread, builtin *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			key := ""
+			if err := starlark.UnpackPositionalArgs(builtin.Name(), args, kwargs, 1, &key); err != nil {
+				return nil, err
+			}
+			return starlark.None, engine.api.kvDelete(key)
+		}),
+	}}
+}
+
+func (engine *Starlark) Handle(writer http.ResponseWriter, request *http.Request) error {
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return fmt.Errorf("failed read request body: %s", err)
+	}
+
+	headers := starlark.NewDict(0)
+	response := starlark.NewDict(3)
+	response.SetKey(starlark.String("status"), starlark.MakeInt(http.StatusOK))
+	response.SetKey(starlark.String("headers"), headers)
+	response.SetKey(starlark.String("body"), starlark.String(""))
+
+	predeclared := starlark.StringDict{
+		"request":  engine.requestStruct(request, body),
+		"response": response,
+		"db":       engine.dbModule(),
+		"kv":       engine.kvModule(),
+	}
+
+	thread := &starlark.Thread{
+		Name: engine.path,
+		Print: func(thread *starlark.Thread, message string) {
+			logger.Verbose(fmt.Sprintf("[XServer] [Starlark] %s", message))
+		},
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-request.Context().Done():
+			thread.Cancel(request.Context().Err().Error())
+		case <-done:
+		}
+	}()
+
+	if _, err := engine.program.Init(thread, predeclared); err != nil {
+		if evalError, ok := err.(*starlark.EvalError); ok {
+			return fmt.Errorf("failed run script: %s", evalError.Backtrace())
+		}
+		return fmt.Errorf("failed run script: %s", err)
+	}
+
+	if headers, ok := dictValue(response, "headers").(*starlark.Dict); ok {
+		for _, item := range headers.Items() {
+			writer.Header().Set(stringValue(item[0]), stringValue(item[1]))
+		}
+	}
+	if status, ok := dictValue(response, "status").(starlark.Int); ok {
+		if code, ok := status.Int64(); ok {
+			writer.WriteHeader(int(code))
+		}
+	}
+	writer.Write([]byte(stringValue(dictValue(response, "body"))))
+
+	return nil
+}
+
+func dictValue(dict *starlark.Dict, key string) starlark.Value {
+	value, _, _ := dict.Get(starlark.String(key))
+	return value
+}
+
+// stringValue returns strings as is and other values as their starlark representation.
+func stringValue(value starlark.Value) string {
+	if value == nil || value == starlark.None {
+		return ""
+	}
+	if text, ok := starlark.AsString(value); ok {
+		return text
+	}
+	return value.String()
+}
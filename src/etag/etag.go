@@ -0,0 +1,151 @@
+package etag
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"xserver/src/metrics"
+)
+
+const (
+	// maxEntries is the max number of remembered responses last modification times, all are dropped once it is reached.
+	maxEntries = 10000
+)
+
+func init() {
+	metrics.Register("xserver_not_modified_total", metrics.CounterType, "Number of requests responded with 304 Not Modified.")
+}
+
+type entry struct {
+	tag      string
+	modified time.Time
+}
+
+// Tags remembers when responses of urls got their current ETag, the time is responded as Last-Modified.
+type Tags struct {
+	mutex   sync.Mutex
+	entries map[string]entry
+}
+
+func Create() *Tags {
+	return &Tags{entries: map[string]entry{}}
+}
+
+// bufferedWriter keeps the response to compute its ETag before it is written.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (writer *bufferedWriter) Write(data []byte) (int, error) {
+	return writer.body.Write(data)
+}
+
+func (writer *bufferedWriter) WriteHeader(status int) {
+	writer.status = status
+}
+
+func (writer *bufferedWriter) Unwrap() http.ResponseWriter {
+	return writer.ResponseWriter
+}
+
+func hash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// modified returns the time the url response got the tag.
+func (tags *Tags) modified(url string, tag string) time.Time {
+	tags.mutex.Lock()
+	defer tags.mutex.Unlock()
+
+	current, ok := tags.entries[url]
+	if ok && current.tag == tag {
+		return current.modified
+	}
+	if !ok && len(tags.entries) >= maxEntries {
+		tags.entries = map[string]entry{}
+	}
+	current = entry{tag: tag, modified: time.Now().UTC().Truncate(time.Second)}
+	tags.entries[url] = current
+	return current.modified
+}
+
+func matches(ifNoneMatch string, tag string) bool {
+	for _, each := range strings.Split(ifNoneMatch, ",") {
+		each = strings.TrimSpace(each)
+		if each == "*" || strings.TrimPrefix(each, "W/") == strings.TrimPrefix(tag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified returns whether the client has the response by If-None-Match or If-Modified-Since, If-None-Match takes precedence.
+func notModified(request *http.Request, tag string, modified time.Time) bool {
+	if ifNoneMatch := request.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return matches(ifNoneMatch, tag)
+	}
+	if modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(request.Header.Get("If-Modified-Since"))
+	return err == nil && !modified.After(since)
+}
+
+// Handler adds ETag and Last-Modified headers to successful GET and HEAD responses and responds 304 to conditional requests of unchanged responses.
+func (tags *Tags) Handler(name string, next http.HandlerFunc) http.HandlerFunc {
+	return tags.handler(name, next, false)
+}
+
+// Reads is the Handler of endpoints reading data by any method, e.g. POST /db/select, responses of other methods than GET and HEAD get the ETag only.
+func (tags *Tags) Reads(name string, next http.HandlerFunc) http.HandlerFunc {
+	return tags.handler(name, next, true)
+}
+
+func (tags *Tags) handler(name string, next http.HandlerFunc, reads bool) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		get := request.Method == http.MethodGet || request.Method == http.MethodHead
+		if !get && !reads {
+			next(writer, request)
+			return
+		}
+
+		buffered := &bufferedWriter{ResponseWriter: writer, status: http.StatusOK}
+		next(buffered, request)
+
+		if buffered.status != http.StatusOK {
+			writer.WriteHeader(buffered.status)
+			writer.Write(buffered.body.Bytes())
+			return
+		}
+
+		tag := writer.Header().Get("ETag")
+		if tag == "" {
+			tag = hash(buffered.body.Bytes())
+			writer.Header().Set("ETag", tag)
+		}
+		modified := time.Time{}
+		if get {
+			if modified, _ = http.ParseTime(writer.Header().Get("Last-Modified")); modified.IsZero() {
+				modified = tags.modified(request.URL.RequestURI(), tag)
+				writer.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+			}
+		}
+
+		if notModified(request, tag, modified) {
+			metrics.Inc("xserver_not_modified_total", "handler", name)
+			writer.Header().Del("Content-Length")
+			writer.Header().Del("Content-Type")
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writer.WriteHeader(buffered.status)
+		writer.Write(buffered.body.Bytes())
+	}
+}
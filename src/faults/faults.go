@@ -0,0 +1,167 @@
+package faults
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/logger"
+	"xserver/src/problem"
+)
+
+type Fault struct {
+	Handler        string `json:"handler"`
+	Enable         bool   `json:"enable"`
+	ErrorPercent   int    `json:"error_percent"`
+	Latency        string `json:"latency,omitempty"`
+	LatencyPercent int    `json:"latency_percent"`
+	DropPercent    int    `json:"drop_percent"`
+}
+
+type fault struct {
+	settings Fault
+	latency  time.Duration
+}
+
+type Faults struct {
+	mutex    sync.RWMutex
+	handlers map[string]bool
+	faults   map[string]*fault
+}
+
+func newFault(settings Fault) (*fault, error) {
+	for name, percent := range map[string]int{
+		"error_percent":   settings.ErrorPercent,
+		"latency_percent": settings.LatencyPercent,
+		"drop_percent":    settings.DropPercent,
+	} {
+		if percent < 0 || percent > 100 {
+			return nil, fmt.Errorf(`[XServer] [Faults] [Error] %s of "%s" handler must be between 0 and 100`, name, settings.Handler)
+		}
+	}
+
+	current := &fault{settings: settings}
+	if settings.Latency != "" {
+		latency, err := time.ParseDuration(settings.Latency)
+		if err != nil {
+			return nil, fmt.Errorf(`[XServer] [Faults] [Error] failed parse latency of "%s" handler: %s`, settings.Handler, err)
+		}
+		current.latency = latency
+		if current.settings.LatencyPercent == 0 {
+			current.settings.LatencyPercent = 100
+		}
+	}
+	return current, nil
+}
+
+func Create(handlers map[string]config.ExecutableServerUnit) (*Faults, error) {
+	faults := &Faults{
+		handlers: map[string]bool{},
+		faults:   map[string]*fault{},
+	}
+
+	for handlerName, handler := range handlers {
+		faults.handlers[handlerName] = true
+		if handler.Faults == nil {
+			continue
+		}
+
+		current, err := newFault(Fault{
+			Handler:        handlerName,
+			Enable:         handler.Faults.Enable,
+			ErrorPercent:   handler.Faults.ErrorPercent,
+			Latency:        handler.Faults.Latency,
+			LatencyPercent: handler.Faults.LatencyPercent,
+			DropPercent:    handler.Faults.DropPercent,
+		})
+		if err != nil {
+			return nil, err
+		}
+		faults.faults[handlerName] = current
+	}
+	return faults, nil
+}
+
+// Set replaces fault settings of the handler.
+func (faults *Faults) Set(settings Fault) error {
+	if !faults.handlers[settings.Handler] {
+		return fmt.Errorf(`[XServer] [Faults] [Error] unknown handler "%s"`, settings.Handler)
+	}
+
+	current, err := newFault(settings)
+	if err != nil {
+		return err
+	}
+
+	faults.mutex.Lock()
+	defer faults.mutex.Unlock()
+	faults.faults[settings.Handler] = current
+	return nil
+}
+
+func (faults *Faults) SetEnabled(handler string, enable bool) error {
+	faults.mutex.Lock()
+	defer faults.mutex.Unlock()
+
+	current, ok := faults.faults[handler]
+	if !ok {
+		return fmt.Errorf(`[XServer] [Faults] [Error] faults of "%s" handler are not configured`, handler)
+	}
+	current.settings.Enable = enable
+	return nil
+}
+
+func (faults *Faults) List() []Fault {
+	faults.mutex.RLock()
+	defer faults.mutex.RUnlock()
+
+	result := []Fault{}
+	for _, current := range faults.faults {
+		result = append(result, current.settings)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Handler < result[j].Handler })
+	return result
+}
+
+func hit(percent int) bool {
+	return percent > 0 && rand.Intn(100) < percent
+}
+
+// Inject applies enabled faults of the handler to the request and reports whether the request is already handled.
+func (faults *Faults) Inject(handler string, writer http.ResponseWriter, request *http.Request) bool {
+	faults.mutex.RLock()
+	current, ok := faults.faults[handler]
+	var settings Fault
+	var latency time.Duration
+	if ok {
+		settings, latency = current.settings, current.latency
+	}
+	faults.mutex.RUnlock()
+
+	if !ok || !settings.Enable {
+		return false
+	}
+
+	if latency > 0 && hit(settings.LatencyPercent) {
+		select {
+		case <-time.After(latency):
+		case <-request.Context().Done():
+			return true
+		}
+	}
+
+	if hit(settings.DropPercent) {
+		logger.Verbose(fmt.Sprintf("[XServer] [%s Handler] [Faults] drop connection", handler))
+		panic(http.ErrAbortHandler)
+	}
+
+	if hit(settings.ErrorPercent) {
+		logger.Verbose(fmt.Sprintf("[XServer] [%s Handler] [Faults] inject error", handler))
+		problem.Write(writer, request, problem.New(http.StatusInternalServerError, problem.CodeInjectedFault, fmt.Sprintf("[XServer] [%s Handler] [Faults] injected error", handler)))
+		return true
+	}
+	return false
+}
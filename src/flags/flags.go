@@ -0,0 +1,164 @@
+package flags
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"xserver/src/database"
+)
+
+const (
+	SplitKeyHeader = "X-XServer-Split-Key"
+	VariantHeader  = "X-XServer-Variant"
+)
+
+type Flags struct {
+	mutex    sync.RWMutex
+	flags    map[string]database.Flag
+	handlers map[string]bool
+	storage  *database.Database
+}
+
+// Create loads flags state from the database, flags are kept in memory only if the database is disabled.
+func Create(storage *database.Database, handlers []string) (*Flags, error) {
+	flags := &Flags{
+		flags:    map[string]database.Flag{},
+		handlers: map[string]bool{},
+		storage:  storage,
+	}
+	for _, handler := range handlers {
+		flags.handlers[handler] = true
+	}
+
+	if storage == nil {
+		return flags, nil
+	}
+
+	stored, err := storage.Flags()
+	if err != nil {
+		return nil, err
+	}
+	for _, flag := range stored {
+		if flags.handlers[flag.Handler] {
+			flags.flags[flag.Handler] = flag
+		}
+	}
+	return flags, nil
+}
+
+func (flags *Flags) Get(handler string) database.Flag {
+	flags.mutex.RLock()
+	defer flags.mutex.RUnlock()
+
+	flag, ok := flags.flags[handler]
+	if !ok {
+		return database.Flag{Handler: handler, Enabled: true}
+	}
+	return flag
+}
+
+func (flags *Flags) List() []database.Flag {
+	flags.mutex.RLock()
+	defer flags.mutex.RUnlock()
+
+	result := []database.Flag{}
+	for _, flag := range flags.flags {
+		result = append(result, flag)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Handler < result[j].Handler })
+	return result
+}
+
+func (flags *Flags) update(handler string, update func(flag *database.Flag) error) error {
+	if !flags.handlers[handler] {
+		return fmt.Errorf(`[XServer] [Flags] [Error] unknown handler "%s"`, handler)
+	}
+
+	flags.mutex.Lock()
+	defer flags.mutex.Unlock()
+
+	flag, ok := flags.flags[handler]
+	if !ok {
+		flag = database.Flag{Handler: handler, Enabled: true}
+	}
+	if err := update(&flag); err != nil {
+		return err
+	}
+
+	if flags.storage != nil {
+		if err := flags.storage.SetFlag(flag); err != nil {
+			return err
+		}
+	}
+	flags.flags[handler] = flag
+	return nil
+}
+
+func (flags *Flags) SetEnabled(handler string, enabled bool) error {
+	return flags.update(handler, func(flag *database.Flag) error {
+		flag.Enabled = enabled
+		return nil
+	})
+}
+
+// Split routes percent of the handler requests to the variant handler, zero percent disables the split.
+func (flags *Flags) Split(handler string, variant string, percent int) error {
+	return flags.update(handler, func(flag *database.Flag) error {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("[XServer] [Flags] [Error] percent must be between 0 and 100")
+		}
+		if percent != 0 && (variant == handler || !flags.handlers[variant]) {
+			return fmt.Errorf(`[XServer] [Flags] [Error] invalid variant handler "%s"`, variant)
+		}
+		if percent == 0 {
+			variant = ""
+		}
+		flag.Variant = variant
+		flag.Percent = percent
+		return nil
+	})
+}
+
+func (flags *Flags) Reset(handler string) error {
+	if !flags.handlers[handler] {
+		return fmt.Errorf(`[XServer] [Flags] [Error] unknown handler "%s"`, handler)
+	}
+
+	flags.mutex.Lock()
+	defer flags.mutex.Unlock()
+
+	if flags.storage != nil {
+		if err := flags.storage.DeleteFlag(handler); err != nil {
+			return err
+		}
+	}
+	delete(flags.flags, handler)
+	return nil
+}
+
+// Route returns the handler serving the request and whether the requested handler is enabled.
+// Requests with the same split key header are always routed to the same handler.
+func (flags *Flags) Route(handler string, request *http.Request) (string, bool) {
+	flag := flags.Get(handler)
+	if !flag.Enabled {
+		return handler, false
+	}
+	if flag.Variant == "" || flag.Percent == 0 {
+		return handler, true
+	}
+
+	bucket := rand.Intn(100)
+	if key := request.Header.Get(SplitKeyHeader); key != "" {
+		hash := fnv.New32a()
+		hash.Write([]byte(handler + "#" + key))
+		bucket = int(hash.Sum32() % 100)
+	}
+
+	if bucket < flag.Percent {
+		return flag.Variant, true
+	}
+	return handler, true
+}
@@ -0,0 +1,124 @@
+package flags
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"xserver/src/config"
+	"xserver/src/database"
+)
+
+// createStorage creates the database of the empty schema in the directory.
+func createStorage(t *testing.T, dir string) *database.Database {
+	t.Helper()
+	settings := config.Database{Enable: true, Storage: filepath.Join(dir, "storage.db"), Schema: filepath.Join(dir, "schema.json")}
+	if err := os.WriteFile(settings.Schema, []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", settings.Storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Exec("CREATE TABLE IF NOT EXISTS __Schema(version TEXT NOT NULL, data TEXT, PRIMARY KEY(version)); INSERT OR IGNORE INTO __Schema VALUES('current', '[]')")
+	db.Close()
+
+	storage, err := database.Create(&config.Config{Database: settings})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { storage.Close() })
+	return storage
+}
+
+func TestRoute(t *testing.T) {
+	flags, err := Create(nil, []string{"users", "users_v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodGet, "/users", nil)
+	if handler, enabled := flags.Route("users", request); handler != "users" || !enabled {
+		t.Fatalf("unexpected route %s %v of the handler without flag", handler, enabled)
+	}
+
+	if err := flags.Split("users", "users_v2", 100); err != nil {
+		t.Fatal(err)
+	}
+	if handler, _ := flags.Route("users", request); handler != "users_v2" {
+		t.Fatalf("unexpected route %s of the full split", handler)
+	}
+
+	if err := flags.Split("users", "users_v2", 50); err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set(SplitKeyHeader, "client")
+	first, _ := flags.Route("users", request)
+	for index := 0; index < 20; index++ {
+		if handler, _ := flags.Route("users", request); handler != first {
+			t.Fatal("requests of the same split key must be routed to the same handler")
+		}
+	}
+
+	if err := flags.SetEnabled("users", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, enabled := flags.Route("users", request); enabled {
+		t.Fatal("disabled handler is routed")
+	}
+	if err := flags.Reset("users"); err != nil {
+		t.Fatal(err)
+	}
+	if handler, enabled := flags.Route("users", request); handler != "users" || !enabled {
+		t.Fatalf("unexpected route %s %v of the reset flag", handler, enabled)
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler string
+		variant string
+		percent int
+	}{
+		{name: "unknown handler", handler: "unknown", variant: "users_v2", percent: 10},
+		{name: "unknown variant", handler: "users", variant: "unknown", percent: 10},
+		{name: "same variant", handler: "users", variant: "users", percent: 10},
+		{name: "percent", handler: "users", variant: "users_v2", percent: 101},
+	}
+	flags, err := Create(nil, []string{"users", "users_v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := flags.Split(test.handler, test.variant, test.percent); err == nil {
+				t.Fatal("invalid split must be rejected")
+			}
+		})
+	}
+}
+
+func TestStorage(t *testing.T) {
+	dir := t.TempDir()
+	flags, err := Create(createStorage(t, dir), []string{"users", "users_v2", "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := flags.Split("users", "users_v2", 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := flags.SetEnabled("orders", false); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := Create(createStorage(t, dir), []string{"users", "users_v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := restored.List()
+	if len(list) != 1 || list[0].Handler != "users" || list[0].Variant != "users_v2" || list[0].Percent != 30 || !list[0].Enabled {
+		t.Fatalf("unexpected restored flags %+v", list)
+	}
+}
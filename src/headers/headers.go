@@ -0,0 +1,57 @@
+package headers
+
+import (
+	"net/http"
+	"xserver/src/config"
+)
+
+var (
+	// presets are response headers of security_headers presets.
+	presets = map[string]map[string]string{
+		config.SecurityHeadersBasic: {
+			"X-Content-Type-Options": "nosniff",
+			"X-Frame-Options":        "SAMEORIGIN",
+			"Referrer-Policy":        "strict-origin-when-cross-origin",
+		},
+		config.SecurityHeadersStrict: {
+			"Strict-Transport-Security":    "max-age=63072000; includeSubDomains",
+			"Content-Security-Policy":      "default-src 'none'; frame-ancestors 'none'",
+			"X-Content-Type-Options":       "nosniff",
+			"X-Frame-Options":              "DENY",
+			"Referrer-Policy":              "no-referrer",
+			"Cross-Origin-Opener-Policy":   "same-origin",
+			"Cross-Origin-Resource-Policy": "same-origin",
+			"Permissions-Policy":           "camera=(), microphone=(), geolocation=()",
+		},
+	}
+)
+
+// Set sets the headers of the response, headers with empty values are removed.
+func Set(writer http.ResponseWriter, headers map[string]string) {
+	for name, value := range headers {
+		if value == "" {
+			writer.Header().Del(name)
+			continue
+		}
+		writer.Header().Set(name, value)
+	}
+}
+
+// Handler sets headers of the security_headers preset and global headers to all responses, handlers headers override them.
+func Handler(settings *config.Config, next http.Handler) http.Handler {
+	global := map[string]string{}
+	for name, value := range presets[settings.SecurityHeaders] {
+		global[name] = value
+	}
+	for name, value := range settings.Headers {
+		global[name] = value
+	}
+	if len(global) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		Set(writer, global)
+		next.ServeHTTP(writer, request)
+	})
+}
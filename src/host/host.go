@@ -0,0 +1,218 @@
+package host
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+)
+
+const (
+	ResourceCpu      = "cpu_percent"
+	ResourceMemory   = "memory_mb"
+	ResourceFds      = "open_fds"
+	ResourceChildren = "child_processes"
+	ResourceBin      = "bin_mb"
+	ResourceDatabase = "database_mb"
+
+	megabyte = 1 << 20
+)
+
+func init() {
+	metrics.Register("xserver_process_cpu_percent", metrics.GaugeType, "Server process CPU usage since the previous check, 100 is one core.")
+	metrics.Register("xserver_process_memory_bytes", metrics.GaugeType, "Server process resident memory.")
+	metrics.Register("xserver_process_open_fds", metrics.GaugeType, "Number of open file descriptors of the server process.")
+	metrics.Register("xserver_process_children", metrics.GaugeType, "Number of child processes of the server process.")
+	metrics.Register("xserver_disk_usage_bytes", metrics.GaugeType, "Disk usage of built units and the database.")
+	metrics.Register("xserver_host_threshold_exceeded", metrics.GaugeType, "1 if the resource usage exceeds its warning threshold.")
+}
+
+// Usage is the last checked resources usage of the server, resources unknown on the platform are -1.
+type Usage struct {
+	CheckedAt      time.Time `json:"checked_at"`
+	CpuPercent     float64   `json:"cpu_percent"`
+	MemoryBytes    int64     `json:"memory_bytes"`
+	OpenFds        int       `json:"open_fds"`
+	ChildProcesses int       `json:"child_processes"`
+	Goroutines     int       `json:"goroutines"`
+	BinBytes       int64     `json:"bin_bytes"`
+	DatabaseBytes  int64     `json:"database_bytes"`
+	Exceeded       []string  `json:"exceeded"`
+}
+
+// Exceeded is the resource usage crossed its threshold.
+type Exceeded struct {
+	Resource  string
+	Value     float64
+	Threshold float64
+}
+
+// process is the server process usage, unknown values are -1.
+type process struct {
+	cpuSeconds  float64
+	memoryBytes int64
+	openFds     int
+	children    int
+}
+
+type Monitor struct {
+	settings   config.Host
+	binDir     string
+	database   string
+	onExceeded func(exceeded Exceeded)
+	mutex      sync.Mutex
+	usage      Usage
+	exceeded   map[string]bool
+	cpuSeconds float64
+	stop       chan struct{}
+}
+
+// Create creates the monitor of the server process, units built to binDir and the database file, the database is empty if disabled.
+func Create(settings config.Host, binDir string, database string, onExceeded func(exceeded Exceeded)) *Monitor {
+	return &Monitor{
+		settings:   settings,
+		binDir:     binDir,
+		database:   database,
+		onExceeded: onExceeded,
+		exceeded:   map[string]bool{},
+		stop:       make(chan struct{}),
+	}
+}
+
+func directorySize(path string) int64 {
+	size := int64(0)
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+func filesSize(paths ...string) int64 {
+	size := int64(0)
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// Check samples resources usage, updates metrics and reports resources crossed their thresholds.
+func (monitor *Monitor) Check() Usage {
+	now := time.Now()
+	process := processStats()
+
+	monitor.mutex.Lock()
+	usage := Usage{
+		CheckedAt:      now,
+		CpuPercent:     -1,
+		MemoryBytes:    process.memoryBytes,
+		OpenFds:        process.openFds,
+		ChildProcesses: process.children,
+		Goroutines:     runtime.NumGoroutine(),
+		BinBytes:       directorySize(monitor.binDir),
+		Exceeded:       []string{},
+	}
+	if process.cpuSeconds >= 0 && !monitor.usage.CheckedAt.IsZero() {
+		usage.CpuPercent = (process.cpuSeconds - monitor.cpuSeconds) / now.Sub(monitor.usage.CheckedAt).Seconds() * 100
+	}
+	monitor.cpuSeconds = process.cpuSeconds
+	if monitor.database != "" {
+		usage.DatabaseBytes = filesSize(monitor.database, monitor.database+"-wal", monitor.database+"-shm")
+	}
+
+	thresholds := monitor.settings.Thresholds
+	checks := []Exceeded{
+		{Resource: ResourceCpu, Value: usage.CpuPercent, Threshold: thresholds.CpuPercent},
+		{Resource: ResourceMemory, Value: float64(usage.MemoryBytes) / megabyte, Threshold: float64(thresholds.MemoryMb)},
+		{Resource: ResourceFds, Value: float64(usage.OpenFds), Threshold: float64(thresholds.OpenFds)},
+		{Resource: ResourceChildren, Value: float64(usage.ChildProcesses), Threshold: float64(thresholds.ChildProcesses)},
+		{Resource: ResourceBin, Value: float64(usage.BinBytes) / megabyte, Threshold: float64(thresholds.BinMb)},
+		{Resource: ResourceDatabase, Value: float64(usage.DatabaseBytes) / megabyte, Threshold: float64(thresholds.DatabaseMb)},
+	}
+	crossed := []Exceeded{}
+	for _, check := range checks {
+		if check.Threshold <= 0 || check.Value < 0 {
+			continue
+		}
+		exceeded := check.Value >= check.Threshold
+		if exceeded {
+			usage.Exceeded = append(usage.Exceeded, check.Resource)
+			if !monitor.exceeded[check.Resource] {
+				crossed = append(crossed, check)
+			}
+		} else if monitor.exceeded[check.Resource] {
+			logger.Info(fmt.Sprintf("[XServer] [Host] %s is back below the threshold", check.Resource))
+		}
+		monitor.exceeded[check.Resource] = exceeded
+		metrics.Set("xserver_host_threshold_exceeded", boolValue(exceeded), "resource", check.Resource)
+	}
+	monitor.usage = usage
+	monitor.mutex.Unlock()
+
+	if usage.CpuPercent >= 0 {
+		metrics.Set("xserver_process_cpu_percent", usage.CpuPercent)
+	}
+	if usage.MemoryBytes >= 0 {
+		metrics.Set("xserver_process_memory_bytes", float64(usage.MemoryBytes))
+	}
+	if usage.OpenFds >= 0 {
+		metrics.Set("xserver_process_open_fds", float64(usage.OpenFds))
+	}
+	if usage.ChildProcesses >= 0 {
+		metrics.Set("xserver_process_children", float64(usage.ChildProcesses))
+	}
+	metrics.Set("xserver_disk_usage_bytes", float64(usage.BinBytes), "path", "bin")
+	if monitor.database != "" {
+		metrics.Set("xserver_disk_usage_bytes", float64(usage.DatabaseBytes), "path", "database")
+	}
+
+	for _, exceeded := range crossed {
+		monitor.onExceeded(exceeded)
+	}
+	return usage
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// Usage returns the last checked usage.
+func (monitor *Monitor) Usage() Usage {
+	monitor.mutex.Lock()
+	defer monitor.mutex.Unlock()
+	return monitor.usage
+}
+
+// Start checks resources every interval until Stop.
+func (monitor *Monitor) Start() {
+	interval, _ := time.ParseDuration(monitor.settings.Interval)
+	monitor.Check()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				monitor.Check()
+			case <-monitor.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (monitor *Monitor) Stop() {
+	close(monitor.stop)
+}
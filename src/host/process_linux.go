@@ -0,0 +1,57 @@
+//go:build linux
+
+package host
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// clockTicks is USER_HZ of /proc times, it is 100 on all common kernels.
+	clockTicks = 100
+)
+
+// statFields returns fields of /proc/<pid>/stat after the command name, the first one is the state.
+func statFields(pid string) []string {
+	data, err := os.ReadFile("/proc/" + pid + "/stat")
+	if err != nil {
+		return nil
+	}
+	stat := string(data)
+	return strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+}
+
+func processStats() process {
+	stats := process{cpuSeconds: -1, memoryBytes: -1, openFds: -1, children: -1}
+
+	if fields := statFields("self"); len(fields) > 12 {
+		utime, _ := strconv.ParseFloat(fields[11], 64)
+		stime, _ := strconv.ParseFloat(fields[12], 64)
+		stats.cpuSeconds = (utime + stime) / clockTicks
+	}
+	if data, err := os.ReadFile("/proc/self/statm"); err == nil {
+		if fields := strings.Fields(string(data)); len(fields) > 1 {
+			pages, _ := strconv.ParseInt(fields[1], 10, 64)
+			stats.memoryBytes = pages * int64(os.Getpagesize())
+		}
+	}
+	if entries, err := os.ReadDir("/proc/self/fd"); err == nil {
+		stats.openFds = len(entries)
+	}
+
+	if entries, err := os.ReadDir("/proc"); err == nil {
+		pid := strconv.Itoa(os.Getpid())
+		stats.children = 0
+		for _, entry := range entries {
+			if _, err := strconv.Atoi(entry.Name()); err != nil {
+				continue
+			}
+			if fields := statFields(entry.Name()); len(fields) > 1 && fields[1] == pid {
+				stats.children++
+			}
+		}
+	}
+	return stats
+}
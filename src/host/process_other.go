@@ -0,0 +1,14 @@
+//go:build !linux
+
+package host
+
+import (
+	"runtime"
+)
+
+// processStats returns the memory obtained by the Go runtime only, other resources are unknown without /proc.
+func processStats() process {
+	memory := runtime.MemStats{}
+	runtime.ReadMemStats(&memory)
+	return process{cpuSeconds: -1, memoryBytes: int64(memory.Sys), openFds: -1, children: -1}
+}
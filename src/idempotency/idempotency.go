@@ -0,0 +1,214 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/database"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+	"xserver/src/problem"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+var (
+	// volatileHeaders are response headers not stored with responses.
+	volatileHeaders = []string{"Date", problem.RequestIdHeader}
+	// credentialsHeaders are request headers of the caller, keys of other callers are not shared.
+	credentialsHeaders = []string{"Authorization"}
+)
+
+func init() {
+	metrics.Register("xserver_idempotent_replays_total", metrics.CounterType, "Number of requests responded with the stored response of their idempotency key.")
+}
+
+type settings struct {
+	ttl      time.Duration
+	required bool
+}
+
+// Store keeps the first response of mutating requests with the Idempotency-Key header and replays it for retries.
+type Store struct {
+	storage  *database.Database
+	handlers map[string]settings
+	headers  []string
+	mutex    sync.Mutex
+	inFlight map[string]bool
+}
+
+// Create creates the store of handlers with idempotency settings, settings are verified by the config.
+// Keys are scoped by the caller credentials of the Authorization and api keys headers.
+func Create(storage *database.Database, handlers map[string]config.ExecutableServerUnit, apiKeysHeader string) *Store {
+	headers := append([]string{}, credentialsHeaders...)
+	if apiKeysHeader != "" {
+		headers = append(headers, apiKeysHeader)
+	}
+	store := &Store{storage: storage, handlers: map[string]settings{}, headers: headers, inFlight: map[string]bool{}}
+	for handlerName, handler := range handlers {
+		if handler.Idempotency == nil {
+			continue
+		}
+		ttl, _ := time.ParseDuration(handler.Idempotency.Ttl)
+		store.handlers[handlerName] = settings{ttl: ttl, required: handler.Idempotency.Required}
+	}
+	return store
+}
+
+// Handles returns whether mutating requests of the handler are idempotent.
+func (store *Store) Handles(handlerName string) bool {
+	if store == nil {
+		return false
+	}
+	_, ok := store.handlers[handlerName]
+	return ok
+}
+
+// recorder writes the response through and keeps it for storing.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (recorder *recorder) Write(data []byte) (int, error) {
+	recorder.body.Write(data)
+	return recorder.ResponseWriter.Write(data)
+}
+
+func (recorder *recorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *recorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+// credentials returns the hash of the caller credentials headers of the request.
+func (store *Store) credentials(request *http.Request) string {
+	hash := sha256.New()
+	for _, name := range store.headers {
+		hash.Write([]byte(strings.Join(request.Header.Values(name), ",") + "\n"))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func fingerprint(request *http.Request, credentials string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(request.Method + " " + request.URL.RequestURI() + "\n" + credentials + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replay(writer http.ResponseWriter, stored *database.IdempotentResponse) {
+	headers := http.Header{}
+	json.Unmarshal([]byte(stored.Headers), &headers)
+	for name, values := range headers {
+		writer.Header()[name] = values
+	}
+	writer.Header().Set(ReplayedHeader, "true")
+	writer.WriteHeader(stored.Status)
+	writer.Write(stored.Body)
+}
+
+// Serve serves the mutating request of the handler by next once per idempotency key within the ttl.
+// Retries with the same key and request get the stored response, the key reused with another request or sent while the first request is in progress is rejected with 409.
+// next returns whether the handler failed, responses of failed handlers are not stored.
+func (store *Store) Serve(handlerName string, writer http.ResponseWriter, request *http.Request, next func(writer http.ResponseWriter, request *http.Request) bool) {
+	current := store.handlers[handlerName]
+	key := request.Header.Get(Header)
+	if key == "" {
+		if current.required {
+			problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, fmt.Sprintf("[XServer] [%s Handler] [Error] %s header is required", handlerName, Header)))
+			return
+		}
+		next(writer, request)
+		return
+	}
+	if store.storage == nil {
+		problem.Write(writer, request, problem.New(http.StatusServiceUnavailable, problem.CodeUnavailable, fmt.Sprintf("[XServer] [%s Handler] [Error] idempotency keys are unavailable without the database", handlerName)))
+		return
+	}
+	if len(key) > maxKeyLength {
+		problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, fmt.Sprintf("[XServer] [%s Handler] [Error] %s header must be at most %d characters", handlerName, Header, maxKeyLength)))
+		return
+	}
+
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, fmt.Sprintf("[XServer] [%s Handler] [Error] failed read request body", handlerName)))
+		return
+	}
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	credentials := store.credentials(request)
+	requestFingerprint := fingerprint(request, credentials, body)
+	storedKey := credentials + ":" + key
+
+	inFlightKey := handlerName + "\n" + storedKey
+	store.mutex.Lock()
+	if store.inFlight[inFlightKey] {
+		store.mutex.Unlock()
+		problem.Write(writer, request, problem.New(http.StatusConflict, problem.CodeConflict, fmt.Sprintf("[XServer] [%s Handler] [Error] request with the same %s is in progress", handlerName, Header)))
+		return
+	}
+	store.inFlight[inFlightKey] = true
+	store.mutex.Unlock()
+	defer func() {
+		store.mutex.Lock()
+		delete(store.inFlight, inFlightKey)
+		store.mutex.Unlock()
+	}()
+
+	stored, err := store.storage.IdempotentResponse(handlerName, storedKey, current.ttl)
+	if err != nil {
+		logger.Error(err.Error())
+		problem.Write(writer, request, problem.New(http.StatusInternalServerError, problem.CodeDatabaseError, err.Error()))
+		return
+	}
+	if stored != nil {
+		if stored.Fingerprint != requestFingerprint {
+			problem.Write(writer, request, problem.New(http.StatusConflict, problem.CodeConflict, fmt.Sprintf("[XServer] [%s Handler] [Error] %s is already used by another request", handlerName, Header)))
+			return
+		}
+		logger.Debug(fmt.Sprintf("[XServer] [%s Handler] replay response of idempotency key", handlerName))
+		metrics.Inc("xserver_idempotent_replays_total", "handler", handlerName)
+		replay(writer, stored)
+		return
+	}
+
+	response := &recorder{ResponseWriter: writer, status: http.StatusOK}
+	if failed := next(response, request); failed || response.status >= http.StatusInternalServerError {
+		return
+	}
+
+	headers := response.Header().Clone()
+	for _, name := range volatileHeaders {
+		headers.Del(name)
+	}
+	encodedHeaders, _ := json.Marshal(headers)
+	if err := store.storage.AddIdempotentResponse(database.IdempotentResponse{
+		Handler:     handlerName,
+		Key:         storedKey,
+		Fingerprint: requestFingerprint,
+		Status:      response.status,
+		Headers:     string(encodedHeaders),
+		Body:        response.body.Bytes(),
+		CreatedAt:   time.Now(),
+	}, current.ttl); err != nil {
+		logger.Error(err.Error())
+	}
+}
@@ -0,0 +1,153 @@
+package idempotency
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"xserver/src/config"
+	"xserver/src/database"
+)
+
+// createStorage creates the database of the empty schema in the temporary directory.
+func createStorage(t *testing.T) *database.Database {
+	t.Helper()
+	dir := t.TempDir()
+	settings := config.Database{Enable: true, Storage: filepath.Join(dir, "storage.db"), Schema: filepath.Join(dir, "schema.json")}
+	if err := os.WriteFile(settings.Schema, []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", settings.Storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("CREATE TABLE __Schema(version TEXT NOT NULL, data TEXT, PRIMARY KEY(version)); INSERT INTO __Schema VALUES('current', '[]')")
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err := database.Create(&config.Config{Database: settings})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { storage.Close() })
+	return storage
+}
+
+type step struct {
+	key      string
+	header   http.Header
+	body     string
+	failed   bool
+	status   int
+	executed bool
+	replayed bool
+}
+
+func TestServe(t *testing.T) {
+	tests := []struct {
+		name     string
+		required bool
+		noDb     bool
+		steps    []step
+	}{
+		{
+			name: "replay",
+			steps: []step{
+				{key: "first", body: "a", status: http.StatusCreated, executed: true},
+				{key: "first", body: "a", status: http.StatusCreated, replayed: true},
+				{key: "second", body: "a", status: http.StatusCreated, executed: true},
+			},
+		},
+		{
+			name: "key reused by another request",
+			steps: []step{
+				{key: "first", body: "a", status: http.StatusCreated, executed: true},
+				{key: "first", body: "b", status: http.StatusConflict},
+			},
+		},
+		{
+			name: "key of another authorization",
+			steps: []step{
+				{key: "first", body: "a", header: http.Header{"Authorization": {"Bearer first"}}, status: http.StatusCreated, executed: true},
+				{key: "first", body: "a", header: http.Header{"Authorization": {"Bearer second"}}, status: http.StatusCreated, executed: true},
+				{key: "first", body: "a", header: http.Header{"Authorization": {"Bearer first"}}, status: http.StatusCreated, replayed: true},
+			},
+		},
+		{
+			name: "key of another api key",
+			steps: []step{
+				{key: "first", body: "a", header: http.Header{"X-Api-Key": {"first"}}, status: http.StatusCreated, executed: true},
+				{key: "first", body: "b", header: http.Header{"X-Api-Key": {"second"}}, status: http.StatusCreated, executed: true},
+				{key: "first", body: "a", status: http.StatusCreated, executed: true},
+			},
+		},
+		{
+			name: "failed responses are not stored",
+			steps: []step{
+				{key: "first", body: "a", failed: true, status: http.StatusInternalServerError, executed: true},
+				{key: "first", body: "a", status: http.StatusCreated, executed: true},
+			},
+		},
+		{
+			name: "without key",
+			steps: []step{
+				{body: "a", status: http.StatusCreated, executed: true},
+				{body: "a", status: http.StatusCreated, executed: true},
+			},
+		},
+		{name: "required key", required: true, steps: []step{{body: "a", status: http.StatusBadRequest}}},
+		{name: "long key", steps: []step{{key: strings.Repeat("k", maxKeyLength+1), body: "a", status: http.StatusBadRequest}}},
+		{name: "without database", noDb: true, steps: []step{{key: "first", body: "a", status: http.StatusServiceUnavailable}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var storage *database.Database
+			if !test.noDb {
+				storage = createStorage(t)
+			}
+			store := Create(storage, map[string]config.ExecutableServerUnit{
+				"handler": {Idempotency: &config.Idempotency{Ttl: "1h", Required: test.required}},
+			}, "X-Api-Key")
+			if !store.Handles("handler") || store.Handles("other") {
+				t.Fatal("unexpected idempotent handlers")
+			}
+
+			for index, current := range test.steps {
+				executed := false
+				request := httptest.NewRequest(http.MethodPost, "/handler", strings.NewReader(current.body))
+				for name, values := range current.header {
+					request.Header[name] = values
+				}
+				if current.key != "" {
+					request.Header.Set(Header, current.key)
+				}
+				recorder := httptest.NewRecorder()
+				store.Serve("handler", recorder, request, func(writer http.ResponseWriter, request *http.Request) bool {
+					executed = true
+					if current.failed {
+						writer.WriteHeader(http.StatusInternalServerError)
+						return true
+					}
+					writer.WriteHeader(http.StatusCreated)
+					writer.Write([]byte("created"))
+					return false
+				})
+
+				if recorder.Code != current.status || executed != current.executed {
+					t.Fatalf("step %d: unexpected status %d, executed %v", index, recorder.Code, executed)
+				}
+				if replayed := recorder.Header().Get(ReplayedHeader) == "true"; replayed != current.replayed {
+					t.Fatalf("step %d: unexpected %s header", index, ReplayedHeader)
+				}
+				if current.replayed && recorder.Body.String() != "created" {
+					t.Fatalf("step %d: unexpected replayed body %q", index, recorder.Body.String())
+				}
+			}
+		})
+	}
+}
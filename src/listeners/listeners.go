@@ -0,0 +1,208 @@
+package listeners
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+)
+
+const (
+	RemoteAddrEnv = "XSERVER_REMOTE_ADDR"
+	BatchSizeEnv  = "XSERVER_BATCH_SIZE"
+
+	maxDatagramSize = 65535
+)
+
+func init() {
+	metrics.Register("xserver_listener_connections_total", metrics.CounterType, "Number of tcp connections served by handlers listeners.")
+	metrics.Register("xserver_listener_datagrams_total", metrics.CounterType, "Number of udp datagrams received by handlers listeners.")
+	metrics.Register("xserver_listener_rejected_total", metrics.CounterType, "Number of tcp connections and udp datagrams rejected by handlers listeners because the server is busy.")
+}
+
+// Run runs the handler process with the reader as stdin and the writer as stdout, env is added to the process environment.
+type Run func(ctx context.Context, writer io.Writer, reader io.Reader, env []string) error
+
+// Acquire acquires the slot of the running process, e.g. of the workers pool.
+type Acquire func(ctx context.Context) (func(), error)
+
+// Listener pipes tcp connections or udp datagrams to processes of the handler.
+type Listener struct {
+	handlerName string
+	settings    config.Listen
+	timeout     time.Duration
+	run         Run
+	acquire     Acquire
+	result      func(err error)
+	ctx         context.Context
+	cancel      context.CancelFunc
+	closer      io.Closer
+	running     sync.WaitGroup
+}
+
+// Start listens the address of listen settings, settings are verified by the config.
+func Start(handlerName string, settings config.Listen, timeout time.Duration, acquire Acquire, run Run, result func(err error)) (*Listener, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	listener := &Listener{handlerName: handlerName, settings: settings, timeout: timeout, run: run, acquire: acquire, result: result, ctx: ctx, cancel: cancel}
+
+	if settings.Protocol == config.ListenTcp {
+		tcp, err := net.Listen("tcp", settings.Address)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("[XServer] [%s Handler] [Error] failed listen tcp %s: %s", handlerName, settings.Address, err)
+		}
+		listener.closer = tcp
+		listener.running.Add(1)
+		go listener.accept(tcp)
+	} else {
+		udp, err := net.ListenPacket("udp", settings.Address)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("[XServer] [%s Handler] [Error] failed listen udp %s: %s", handlerName, settings.Address, err)
+		}
+		listener.closer = udp
+		listener.running.Add(1)
+		go listener.receive(udp)
+	}
+
+	logger.Info(fmt.Sprintf("[XServer] [%s Handler] listen %s %s", handlerName, settings.Protocol, settings.Address))
+	return listener, nil
+}
+
+// Stop closes the listener and terminates running processes.
+func (listener *Listener) Stop() {
+	listener.closer.Close()
+	listener.cancel()
+	listener.running.Wait()
+}
+
+// process runs the handler process within the handler timeout, the process is rejected when no slot is acquired.
+func (listener *Listener) process(writer io.Writer, reader io.Reader, env []string) bool {
+	ctx := listener.ctx
+	if listener.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, listener.timeout)
+		defer cancel()
+	}
+
+	release, err := listener.acquire(ctx)
+	if err != nil {
+		logger.Error(fmt.Sprintf("[XServer] [%s Handler] [Error] %s rejected: %s", listener.handlerName, listener.settings.Protocol, err))
+		metrics.Inc("xserver_listener_rejected_total", "handler", listener.handlerName)
+		return false
+	}
+	defer release()
+
+	err = listener.run(ctx, writer, reader, env)
+	if listener.ctx.Err() == nil {
+		listener.result(err)
+	}
+	return err == nil
+}
+
+func (listener *Listener) accept(tcp net.Listener) {
+	defer listener.running.Done()
+	for {
+		connection, err := tcp.Accept()
+		if err != nil {
+			if listener.ctx.Err() == nil {
+				logger.Error(fmt.Sprintf("[XServer] [%s Handler] [Error] failed accept tcp connection: %s", listener.handlerName, err))
+			}
+			return
+		}
+		metrics.Inc("xserver_listener_connections_total", "handler", listener.handlerName)
+		listener.running.Add(1)
+		go func() {
+			defer listener.running.Done()
+			defer connection.Close()
+			logger.Verbose(fmt.Sprintf("[XServer] [%s Handler] tcp connection from %s", listener.handlerName, connection.RemoteAddr()))
+			listener.process(connection, connection, []string{RemoteAddrEnv + "=" + connection.RemoteAddr().String()})
+		}()
+	}
+}
+
+func (listener *Listener) receive(udp net.PacketConn) {
+	defer listener.running.Done()
+
+	var datagrams chan []byte
+	if listener.settings.Batch != nil {
+		datagrams = make(chan []byte, listener.settings.Batch.MaxSize)
+		listener.running.Add(1)
+		go listener.batch(datagrams)
+		defer close(datagrams)
+	}
+
+	buffer := make([]byte, maxDatagramSize)
+	for {
+		size, address, err := udp.ReadFrom(buffer)
+		if err != nil {
+			if listener.ctx.Err() == nil {
+				logger.Error(fmt.Sprintf("[XServer] [%s Handler] [Error] failed read udp datagram: %s", listener.handlerName, err))
+			}
+			return
+		}
+		metrics.Inc("xserver_listener_datagrams_total", "handler", listener.handlerName)
+		datagram := append([]byte{}, buffer[:size]...)
+
+		if datagrams != nil {
+			datagrams <- datagram
+			continue
+		}
+		listener.running.Add(1)
+		go func() {
+			defer listener.running.Done()
+			var output io.Writer = io.Discard
+			reply := &bytes.Buffer{}
+			if listener.settings.Reply {
+				output = reply
+			}
+			if listener.process(output, bytes.NewReader(datagram), []string{RemoteAddrEnv + "=" + address.String()}) && reply.Len() != 0 {
+				if reply.Len() > maxDatagramSize {
+					reply.Truncate(maxDatagramSize)
+				}
+				if _, err := udp.WriteTo(reply.Bytes(), address); err != nil {
+					logger.Error(fmt.Sprintf("[XServer] [%s Handler] [Error] failed reply udp datagram: %s", listener.handlerName, err))
+				}
+			}
+		}()
+	}
+}
+
+// batch runs one process for up to max_size datagrams received within max_delay after the first one, datagrams are stdin lines.
+func (listener *Listener) batch(datagrams chan []byte) {
+	defer listener.running.Done()
+	maxDelay, _ := time.ParseDuration(listener.settings.Batch.MaxDelay)
+
+	for first := range datagrams {
+		batch := [][]byte{first}
+		timer := time.NewTimer(maxDelay)
+	collect:
+		for len(batch) < listener.settings.Batch.MaxSize {
+			select {
+			case datagram, ok := <-datagrams:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, datagram)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		input := &bytes.Buffer{}
+		for _, datagram := range batch {
+			input.Write(datagram)
+			if !bytes.HasSuffix(datagram, []byte("\n")) {
+				input.WriteByte('\n')
+			}
+		}
+		listener.process(io.Discard, input, []string{fmt.Sprintf("%s=%d", BatchSizeEnv, len(batch))})
+	}
+}
@@ -0,0 +1,102 @@
+package logger
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHistorySize = 1000
+)
+
+var (
+	// unitPattern matches units messages like "[XServer] [users Handler] ..." or "[XServer] [cleanup Task] ...".
+	unitPattern = regexp.MustCompile(`^\[XServer\] \[([^\]]+) (?:Handler|Task)\]`)
+
+	historyMutex    sync.RWMutex
+	history         = make([]Entry, 0, defaultHistorySize)
+	historySize     = defaultHistorySize
+	historyStart    = 0
+	historySequence = int64(0)
+)
+
+type Entry struct {
+	Sequence int64     `json:"sequence"`
+	Time     time.Time `json:"time"`
+	Level    string    `json:"level"`
+	Unit     string    `json:"unit,omitempty"`
+	Message  string    `json:"message"`
+	level    int
+}
+
+// Query filters history entries, zero fields match all entries.
+type Query struct {
+	Unit  string
+	Units map[string]bool
+	Level string
+	Since time.Time
+	After int64
+}
+
+func setHistorySize(size int) {
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	historySize = size
+	if size < 0 {
+		size = 0
+	}
+	history = make([]Entry, 0, size)
+	historyStart = 0
+}
+
+// remember appends the message to the ring buffer of the last log_history messages.
+func remember(message message) {
+	entry := Entry{Time: time.Now(), Level: levelsNames[message.level], Message: message.text, level: message.level}
+	if match := unitPattern.FindStringSubmatch(message.text); match != nil {
+		entry.Unit = match[1]
+	}
+
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	historySequence++
+	entry.Sequence = historySequence
+	if historySize <= 0 {
+		return
+	}
+	if len(history) < historySize {
+		history = append(history, entry)
+		return
+	}
+	history[historyStart] = entry
+	historyStart = (historyStart + 1) % historySize
+}
+
+// History returns remembered messages matched by the query in order, the level matches messages of the level and more severe ones.
+func History(query Query) ([]Entry, error) {
+	maxLevel := verboseLevel
+	if query.Level != "" {
+		level, ok := logLevelMap[query.Level]
+		if !ok {
+			return nil, fmt.Errorf(`[XServer] [Logger] [Error] unknown level "%s"`, query.Level)
+		}
+		maxLevel = level
+	}
+
+	historyMutex.RLock()
+	defer historyMutex.RUnlock()
+
+	entries := []Entry{}
+	for index := 0; index < len(history); index++ {
+		entry := history[(historyStart+index)%len(history)]
+		if entry.Sequence <= query.After || entry.Time.Before(query.Since) || entry.level > maxLevel {
+			continue
+		}
+		if (query.Unit != "" && entry.Unit != query.Unit) || (query.Units != nil && !query.Units[entry.Unit]) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -1,12 +1,17 @@
 package logger
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path"
+	"strings"
 	"sync"
+	"time"
 	"xserver/src/config"
+	prefixes "xserver/src/messages"
 )
 
 const (
@@ -14,21 +19,164 @@ const (
 	infoLevel    = 1
 	debugLevel   = 2
 	verboseLevel = 3
+
+	messagesBufferSize = 1024
+
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorCyan   = "\033[36m"
+	colorGray   = "\033[90m"
 )
 
+type message struct {
+	level int
+	text  string
+}
+
 var (
-	logLevel    = infoLevel
-	mutex       sync.Mutex
-	logLevelMap = map[string]int{
+	fileLevel      = infoLevel
+	fileLogger     *log.Logger
+	consoleLevel   = infoLevel
+	consoleLogger  = log.New(os.Stdout, "", log.LstdFlags)
+	consoleFlagged = false
+	colored        = terminal(os.Stdout) && os.Getenv("NO_COLOR") == ""
+	jsonFormat     = false
+	messagesMutex  sync.RWMutex
+	messages       = make(chan message, messagesBufferSize)
+	written        = make(chan struct{})
+	flushes        = make(chan chan struct{})
+	logLevelMap    = map[string]int{
 		"error":   errorLevel,
 		"info":    infoLevel,
 		"debug":   debugLevel,
 		"verbose": verboseLevel,
 	}
+	levelsNames = map[int]string{
+		errorLevel:   "ERROR",
+		infoLevel:    "INFO",
+		debugLevel:   "DEBUG",
+		verboseLevel: "VERBOSE",
+	}
+	levelsColors = map[int]string{
+		errorLevel:   colorRed,
+		infoLevel:    colorGreen,
+		debugLevel:   colorCyan,
+		verboseLevel: colorGray,
+	}
 )
 
+func init() {
+	go write(messages, written)
+}
+
+func terminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// jsonLine formats the message as the json object with bracketed prefixes split to scope and level fields.
+func jsonLine(message message) string {
+	split := prefixes.Split(message.text)
+	level := strings.ToLower(levelsNames[message.level])
+	if split.Level == "warning" && message.level == infoLevel {
+		level = split.Level
+	}
+	line := map[string]interface{}{
+		"time":    time.Now().Format(time.RFC3339Nano),
+		"level":   level,
+		"scope":   split.Scope,
+		"message": split.Text,
+	}
+	if match := unitPattern.FindStringSubmatch(message.text); match != nil {
+		line["unit"] = match[1]
+	}
+	data, _ := json.Marshal(line)
+	return string(data)
+}
+
+func output(message message) {
+	remember(message)
+	if jsonFormat {
+		line := jsonLine(message)
+		if fileLogger != nil && message.level <= fileLevel {
+			fileLogger.Println(line)
+		}
+		if message.level <= consoleLevel {
+			consoleLogger.Println(line)
+		}
+		return
+	}
+	if fileLogger != nil && message.level <= fileLevel {
+		fileLogger.Println(levelsNames[message.level] + ": " + message.text)
+	}
+	if message.level > consoleLevel {
+		return
+	}
+	if !colored {
+		consoleLogger.Println(levelsNames[message.level] + ": " + message.text)
+		return
+	}
+
+	color := levelsColors[message.level]
+	if message.level == infoLevel && strings.Contains(message.text, "[Warning]") {
+		color = colorYellow
+	}
+	consoleLogger.Println(color + levelsNames[message.level] + colorReset + ": " + message.text)
+}
+
+func write(messages chan message, written chan struct{}) {
+	defer close(written)
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			output(message)
+		case flushed := <-flushes:
+			for len(messages) > 0 {
+				output(<-messages)
+			}
+			close(flushed)
+		}
+	}
+}
+
+func Flush() {
+	flushed := make(chan struct{})
+	flushes <- flushed
+	<-flushed
+}
+
+// SetVerbosity sets the console output level by command line flags: -1 is --quiet with errors only, 0 is info, 1 is -v with debug and 2 is -vv with verbose messages.
+func SetVerbosity(verbosity int) {
+	reconfigure(0, func() {
+		consoleFlagged = true
+		consoleLevel = infoLevel + verbosity
+		if consoleLevel < errorLevel {
+			consoleLevel = errorLevel
+		}
+		if consoleLevel > verboseLevel {
+			consoleLevel = verboseLevel
+		}
+	})
+}
+
+// Configure sets the log file and its level, without the log file messages are written to the console only with log_level unless verbosity flags are set.
 func Configure(config *config.Config) error {
-	log.SetOutput(os.Stdout)
+	configLogLevel, ok := logLevelMap[config.LogLevel]
+	if !ok {
+		configLogLevel = infoLevel
+	}
+
+	flags := log.LstdFlags
+	if config.LogFormat == "json" {
+		flags = 0
+	}
+
+	var configFileLogger *log.Logger
 	if config.LogPath != "" {
 		if err := os.MkdirAll(path.Dir(config.LogPath), os.ModePerm); err != nil {
 			return fmt.Errorf("[XServer] [Logger] [Error] failed create logs directory: %s", err)
@@ -42,55 +190,134 @@ func Configure(config *config.Config) error {
 				return fmt.Errorf("[XServer] [Logger] [Error] failed create logs file: %s", err)
 			}
 		}
-		log.SetOutput(logsFile)
+		configFileLogger = log.New(logsFile, "", flags)
 	}
 
-	configLogLevel, ok := logLevelMap[config.LogLevel]
-	if !ok {
-		configLogLevel = infoLevel
+	if config.LogHistory != historySize {
+		setHistorySize(config.LogHistory)
 	}
 
-	logLevel = configLogLevel
+	reconfigure(config.LogBuffer, func() {
+		jsonFormat = config.LogFormat == "json"
+		consoleLogger.SetFlags(flags)
+		fileLogger = configFileLogger
+		if fileLogger != nil {
+			fileLevel = configLogLevel
+		} else if !consoleFlagged {
+			consoleLevel = configLogLevel
+		}
+	})
+	return nil
+}
+
+// reconfigure stops the writer after written messages, so settings are not changed while messages are written,
+// and starts the writer of the messages buffer of the size, 0 keeps the buffer size. Senders wait for the new writer.
+func reconfigure(size int, change func()) {
+	messagesMutex.Lock()
+	defer messagesMutex.Unlock()
+	if size <= 0 {
+		size = cap(messages)
+	}
+	close(messages)
+	<-written
+	change()
+	messages = make(chan message, size)
+	written = make(chan struct{})
+	go write(messages, written)
+}
 
+// SetLevel changes the level of the log file, or of the console messages without the log file.
+func SetLevel(level string) error {
+	value, ok := logLevelMap[level]
+	if !ok {
+		return fmt.Errorf(`[XServer] [Logger] [Error] unknown log level "%s", expected error, info, debug or verbose`, level)
+	}
+	reconfigure(0, func() {
+		if fileLogger != nil {
+			fileLevel = value
+		} else {
+			consoleLevel = value
+		}
+	})
 	return nil
 }
 
-func Info(message string) {
-	if logLevel >= infoLevel {
-		go func() {
-			mutex.Lock()
-			defer mutex.Unlock()
-			log.Println("INFO: " + message)
-		}()
+// Level returns the name of the log file level, or of the console level without the log file.
+func Level() string {
+	messagesMutex.RLock()
+	defer messagesMutex.RUnlock()
+	level := consoleLevel
+	if fileLogger != nil {
+		level = fileLevel
 	}
+	return strings.ToLower(levelsNames[level])
 }
 
-func Error(message string) {
-	if logLevel >= errorLevel {
-		go func() {
-			mutex.Lock()
-			defer mutex.Unlock()
-			log.Println("ERROR: " + message)
-		}()
+func enabled(level int) bool {
+	return level <= consoleLevel || (fileLogger != nil && level <= fileLevel)
+}
+
+func send(level int, text string) {
+	messagesMutex.RLock()
+	defer messagesMutex.RUnlock()
+	if enabled(level) {
+		messages <- message{level: level, text: text}
+	}
+}
+
+func Info(text string) {
+	send(infoLevel, text)
+}
+
+func Error(text string) {
+	send(errorLevel, text)
+}
+
+func Debug(text string) {
+	send(debugLevel, text)
+}
+
+func Verbose(text string) {
+	send(verboseLevel, text)
+}
+
+type LineWriter struct {
+	log     func(string)
+	prefix  string
+	maxLine int
+	buffer  []byte
+}
+
+func NewLineWriter(prefix string, maxLine int, log func(string)) *LineWriter {
+	return &LineWriter{
+		log:     log,
+		prefix:  prefix,
+		maxLine: maxLine,
 	}
 }
 
-func Debug(message string) {
-	if logLevel >= debugLevel {
-		go func() {
-			mutex.Lock()
-			defer mutex.Unlock()
-			log.Println("DEBUG: " + message)
-		}()
+func (writer *LineWriter) Write(data []byte) (int, error) {
+	writer.buffer = append(writer.buffer, data...)
+	for {
+		index := bytes.IndexByte(writer.buffer, '\n')
+		if index < 0 {
+			break
+		}
+		writer.log(writer.prefix + strings.TrimSuffix(string(writer.buffer[:index]), "\r"))
+		writer.buffer = writer.buffer[index+1:]
+	}
+
+	if writer.maxLine > 0 && len(writer.buffer) >= writer.maxLine {
+		writer.log(writer.prefix + string(writer.buffer))
+		writer.buffer = nil
 	}
+
+	return len(data), nil
 }
 
-func Verbose(message string) {
-	if logLevel >= verboseLevel {
-		go func() {
-			mutex.Lock()
-			defer mutex.Unlock()
-			log.Println("VERBOSE: " + message)
-		}()
+func (writer *LineWriter) Flush() {
+	if len(writer.buffer) != 0 {
+		writer.log(writer.prefix + string(writer.buffer))
+		writer.buffer = nil
 	}
 }
@@ -0,0 +1,44 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"xserver/src/config"
+)
+
+func TestConfigureBufferWhileLogging(t *testing.T) {
+	consoleLogger.SetOutput(io.Discard)
+	setHistorySize(10000)
+
+	const writers, count = 8, 200
+	group := sync.WaitGroup{}
+	for writer := 0; writer < writers; writer++ {
+		group.Add(1)
+		go func(writer int) {
+			defer group.Done()
+			for index := 0; index < count; index++ {
+				Info(fmt.Sprintf("writer %d message %d", writer, index))
+			}
+		}(writer)
+	}
+	for _, size := range []int{1, 64, 2, 1024, 16} {
+		if err := Configure(&config.Config{LogBuffer: size, LogHistory: 10000}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	group.Wait()
+	Flush()
+
+	entries, err := History(Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != writers*count {
+		t.Fatalf("%d messages written, expected %d", len(entries), writers*count)
+	}
+	if cap(messages) != 16 {
+		t.Fatalf("buffer size %d, expected 16", cap(messages))
+	}
+}
@@ -0,0 +1,262 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+)
+
+const (
+	commandTimeout = 5 * time.Minute
+	maxRecipients  = 100
+)
+
+func init() {
+	metrics.Register("xserver_mail_received_total", metrics.CounterType, "Number of inbound mail messages delivered to handlers.")
+	metrics.Register("xserver_mail_rejected_total", metrics.CounterType, "Number of inbound mail recipients and messages rejected by reason.")
+}
+
+// Deliver runs the handler with the message, failed deliveries are temporary failures retried by the sender.
+type Deliver func(handlerName string, message *Message) error
+
+// Server accepts mail of configured recipients over SMTP, no authentication and STARTTLS are offered.
+type Server struct {
+	settings config.Mail
+	hostname string
+	deliver  Deliver
+	listener net.Listener
+	stopped  chan struct{}
+	sessions sync.WaitGroup
+}
+
+// Start listens the mail address, settings are verified by the config.
+func Start(settings config.Mail, deliver Deliver) (*Server, error) {
+	hostname := settings.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	listener, err := net.Listen("tcp", settings.Address)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Mail] [Error] failed listen %s: %s", settings.Address, err)
+	}
+
+	server := &Server{settings: settings, hostname: hostname, deliver: deliver, listener: listener, stopped: make(chan struct{})}
+	server.sessions.Add(1)
+	go server.accept()
+	logger.Info(fmt.Sprintf("[XServer] [Mail] listen smtp %s", settings.Address))
+	return server, nil
+}
+
+// Stop closes the listener and waits for sessions delivering messages.
+func (server *Server) Stop() {
+	close(server.stopped)
+	server.listener.Close()
+	server.sessions.Wait()
+}
+
+func (server *Server) accept() {
+	defer server.sessions.Done()
+	for {
+		connection, err := server.listener.Accept()
+		if err != nil {
+			select {
+			case <-server.stopped:
+			default:
+				logger.Error(fmt.Sprintf("[XServer] [Mail] [Error] failed accept connection: %s", err))
+			}
+			return
+		}
+		server.sessions.Add(1)
+		go func() {
+			defer server.sessions.Done()
+			defer connection.Close()
+			server.serve(connection)
+		}()
+	}
+}
+
+// Handler returns the handler of the recipient: the handler of the address or of its *@domain.
+func (server *Server) Handler(recipient string) (string, bool) {
+	recipient = strings.ToLower(recipient)
+	for address, handler := range server.settings.Recipients {
+		if strings.ToLower(address) == recipient {
+			return handler, true
+		}
+	}
+	if _, domain, ok := strings.Cut(recipient, "@"); ok {
+		for address, handler := range server.settings.Recipients {
+			if strings.ToLower(address) == "*@"+domain {
+				return handler, true
+			}
+		}
+	}
+	return "", false
+}
+
+// path returns the address of MAIL FROM:<address> and RCPT TO:<address> commands.
+func path(argument string, prefix string) (string, bool) {
+	if len(argument) < len(prefix) || !strings.EqualFold(argument[:len(prefix)], prefix) {
+		return "", false
+	}
+	value := strings.TrimSpace(argument[len(prefix):])
+	start := strings.IndexByte(value, '<')
+	end := strings.IndexByte(value, '>')
+	if start < 0 || end < start {
+		return "", false
+	}
+	return value[start+1 : end], true
+}
+
+type session struct {
+	from       string
+	started    bool
+	recipients []string
+}
+
+func (server *Server) serve(connection net.Conn) {
+	text := textproto.NewConn(connection)
+	reply := func(code int, message string) {
+		text.PrintfLine("%d %s", code, message)
+	}
+	remote := connection.RemoteAddr().String()
+	logger.Verbose(fmt.Sprintf("[XServer] [Mail] connection from %s", remote))
+
+	reply(220, server.hostname+" ESMTP xserver")
+	current := &session{}
+	for {
+		connection.SetDeadline(time.Now().Add(commandTimeout))
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command, argument, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(command) {
+		case "HELO":
+			current = &session{}
+			reply(250, server.hostname)
+		case "EHLO":
+			current = &session{}
+			text.PrintfLine("250-%s", server.hostname)
+			text.PrintfLine("250-SIZE %d", server.settings.MaxSize)
+			text.PrintfLine("250-8BITMIME")
+			reply(250, "PIPELINING")
+		case "MAIL":
+			from, ok := path(argument, "FROM:")
+			if !ok {
+				reply(501, "syntax: MAIL FROM:<address>")
+				continue
+			}
+			current = &session{from: from, started: true}
+			reply(250, "OK")
+		case "RCPT":
+			recipient, ok := path(argument, "TO:")
+			switch {
+			case !current.started:
+				reply(503, "MAIL FROM first")
+			case !ok:
+				reply(501, "syntax: RCPT TO:<address>")
+			case len(current.recipients) >= maxRecipients:
+				reply(452, "too many recipients")
+			default:
+				if _, ok := server.Handler(recipient); !ok {
+					metrics.Inc("xserver_mail_rejected_total", "reason", "recipient")
+					reply(550, "no such recipient")
+					continue
+				}
+				current.recipients = append(current.recipients, recipient)
+				reply(250, "OK")
+			}
+		case "DATA":
+			if len(current.recipients) == 0 {
+				reply(503, "RCPT TO first")
+				continue
+			}
+			reply(354, "end data with <CR><LF>.<CR><LF>")
+			reader := text.DotReader()
+			data, err := io.ReadAll(io.LimitReader(reader, server.settings.MaxSize+1))
+			if err != nil {
+				return
+			}
+			if int64(len(data)) > server.settings.MaxSize {
+				io.Copy(io.Discard, reader)
+				metrics.Inc("xserver_mail_rejected_total", "reason", "size")
+				reply(552, "message exceeds max size")
+			} else if _, err := mail.ReadMessage(bytes.NewReader(data)); err != nil {
+				metrics.Inc("xserver_mail_rejected_total", "reason", "invalid")
+				reply(554, "invalid message")
+			} else if err := server.receive(current, data); err != nil {
+				logger.Error(fmt.Sprintf("[XServer] [Mail] [Error] failed deliver message from %s: %s", current.from, err))
+				reply(451, "delivery failed, try again later")
+			} else {
+				reply(250, "OK")
+			}
+			current = &session{}
+		case "RSET":
+			current = &session{}
+			reply(250, "OK")
+		case "NOOP":
+			reply(250, "OK")
+		case "VRFY":
+			reply(252, "cannot verify")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		default:
+			reply(502, "command not implemented")
+		}
+	}
+}
+
+// receive delivers the message to handlers of its recipients, every handler runs once with its recipients.
+func (server *Server) receive(current *session, data []byte) error {
+	received := fmt.Sprintf("Received: from %s by %s with SMTP; %s\r\n", current.from, server.hostname, time.Now().Format(time.RFC1123Z))
+	data = append([]byte(received), data...)
+
+	handlers := map[string][]string{}
+	for _, recipient := range current.recipients {
+		handler, _ := server.Handler(recipient)
+		handlers[handler] = append(handlers[handler], recipient)
+	}
+	names := []string{}
+	for name := range handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, handlerName := range names {
+		if err := server.deliverTo(handlerName, handlers[handlerName], data); err != nil {
+			return fmt.Errorf(`"%s" handler: %s`, handlerName, err)
+		}
+	}
+	return nil
+}
+
+func (server *Server) deliverTo(handlerName string, recipients []string, data []byte) error {
+	directory, err := os.MkdirTemp("", "xserver-mail-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(directory)
+
+	message, err := Parse(data, recipients, directory)
+	if err != nil {
+		return err
+	}
+	if err := server.deliver(handlerName, message); err != nil {
+		return err
+	}
+	metrics.Inc("xserver_mail_received_total", "handler", handlerName)
+	logger.Verbose(fmt.Sprintf("[XServer] [Mail] message from %s delivered to %s", message.From, handlerName))
+	return nil
+}
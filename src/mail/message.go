@@ -0,0 +1,190 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Attachment is the message part saved to the file, the file is removed after the handler run.
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+}
+
+// Message is the parsed mail passed to the handler as json.
+type Message struct {
+	From        string              `json:"from"`
+	To          []string            `json:"to"`
+	Recipients  []string            `json:"recipients"`
+	Subject     string              `json:"subject"`
+	Date        *time.Time          `json:"date,omitempty"`
+	MessageId   string              `json:"message_id"`
+	Headers     map[string][]string `json:"headers"`
+	Text        string              `json:"text"`
+	Html        string              `json:"html"`
+	Attachments []Attachment        `json:"attachments"`
+}
+
+var (
+	headerDecoder = &mime.WordDecoder{}
+)
+
+func decodeHeader(value string) string {
+	decoded, err := headerDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+func addresses(header mail.Header, name string) []string {
+	result := []string{}
+	list, err := header.AddressList(name)
+	if err != nil {
+		if value := header.Get(name); value != "" {
+			result = append(result, value)
+		}
+		return result
+	}
+	for _, address := range list {
+		result = append(result, address.Address)
+	}
+	return result
+}
+
+// Parse parses the message, attachments are saved to files of the directory.
+func Parse(data []byte, recipients []string, directory string) (*Message, error) {
+	parsed, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed parse message: %s", err)
+	}
+
+	message := &Message{
+		To:          addresses(parsed.Header, "To"),
+		Recipients:  recipients,
+		Subject:     decodeHeader(parsed.Header.Get("Subject")),
+		MessageId:   parsed.Header.Get("Message-Id"),
+		Headers:     map[string][]string{},
+		Attachments: []Attachment{},
+	}
+	if from := addresses(parsed.Header, "From"); len(from) != 0 {
+		message.From = from[0]
+	}
+	if date, err := parsed.Header.Date(); err == nil {
+		message.Date = &date
+	}
+	for name, values := range parsed.Header {
+		for _, value := range values {
+			message.Headers[name] = append(message.Headers[name], decodeHeader(value))
+		}
+	}
+
+	part := &part{header: map[string][]string(parsed.Header), body: parsed.Body}
+	if err := message.addPart(part, directory); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+type part struct {
+	header map[string][]string
+	body   io.Reader
+}
+
+func (part *part) get(name string) string {
+	values := part.header[name]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// decoded returns the part body decoded by its transfer encoding.
+func (part *part) decoded() io.Reader {
+	switch strings.ToLower(part.get("Content-Transfer-Encoding")) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, part.body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(part.body)
+	}
+	return part.body
+}
+
+// addPart adds text and html bodies of the part and its nested parts, other parts and parts with filenames are attachments.
+func (message *Message) addPart(current *part, directory string) error {
+	contentType := current.get("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, parameters, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "application/octet-stream"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(current.body, parameters["boundary"])
+		for {
+			nested, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed parse message part: %s", err)
+			}
+			if err := message.addPart(&part{header: nested.Header, body: nested}, directory); err != nil {
+				return err
+			}
+		}
+	}
+
+	disposition, dispositionParameters, _ := mime.ParseMediaType(current.get("Content-Disposition"))
+	filename := dispositionParameters["filename"]
+	if filename == "" {
+		filename = parameters["name"]
+	}
+	if disposition != "attachment" && filename == "" && (mediaType == "text/plain" || mediaType == "text/html") {
+		data, err := io.ReadAll(current.decoded())
+		if err != nil {
+			return fmt.Errorf("failed read message body: %s", err)
+		}
+		if mediaType == "text/html" {
+			message.Html += string(data)
+		} else {
+			message.Text += string(data)
+		}
+		return nil
+	}
+
+	return message.addAttachment(current, decodeHeader(filename), mediaType, directory)
+}
+
+func (message *Message) addAttachment(current *part, filename string, mediaType string, directory string) error {
+	name := filepath.Base(filepath.Clean("/" + filename))
+	if name == "/" || name == "." {
+		name = "attachment"
+	}
+	path := filepath.Join(directory, fmt.Sprintf("%d-%s", len(message.Attachments)+1, name))
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed save attachment: %s", err)
+	}
+	defer file.Close()
+	size, err := io.Copy(file, current.decoded())
+	if err != nil {
+		return fmt.Errorf("failed save attachment: %s", err)
+	}
+	message.Attachments = append(message.Attachments, Attachment{Filename: filename, ContentType: mediaType, Path: path, Size: size})
+	return nil
+}
@@ -2,312 +2,2616 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
-	"path"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"xserver/src/admin"
 	"xserver/src/builders"
+	"xserver/src/canary"
+	"xserver/src/cli"
 	"xserver/src/config"
 	"xserver/src/database"
+	"xserver/src/devices"
+	"xserver/src/doctor"
+	"xserver/src/engines"
+	"xserver/src/etag"
+	"xserver/src/faults"
+	"xserver/src/flags"
+	"xserver/src/headers"
+	"xserver/src/host"
 	"xserver/src/logger"
+	"xserver/src/manifest"
+	"xserver/src/metering"
+	"xserver/src/metrics"
+	"xserver/src/mirror"
+	"xserver/src/modes"
+	"xserver/src/notifications"
+	"xserver/src/observability"
+	"xserver/src/plugins"
+	"xserver/src/problem"
+	"xserver/src/quarantine"
+	"xserver/src/recording"
+	"xserver/src/redirects"
+	"xserver/src/reporting"
+	"xserver/src/reports"
+	"xserver/src/rest"
 	"xserver/src/runners"
+	"xserver/src/scheduler"
+	"xserver/src/sdk"
 	"xserver/src/server"
+	"xserver/src/service"
+	"xserver/src/slo"
+	"xserver/src/snapshots"
+	"xserver/src/sources"
+	"xserver/src/tasks"
+	"xserver/src/tracing"
 	"xserver/src/utils"
+	"xserver/src/webhooks"
+	"xserver/src/workers"
 
 	"github.com/robfig/cron"
 )
 
 var (
-	commands = map[string]func(config *config.Config) error{
-		"build": build,
-		"start": start,
+	configPath = "./config.yml"
+	// units paths of the default build output dir until loadConfig sets paths of the config.
+	defaultBuild      = &config.Config{Build: config.ProjectBuild{OutputDir: config.DefaultOutputDir}}
+	handlersFilesPath = defaultBuild.HandlersOutputDir()
+	tasksFilesPath    = defaultBuild.TasksOutputDir()
+	sourcesFilesPath  = defaultBuild.SourcesOutputDir()
+
+	defaultTaskHistoryLimit = 100
+	logsFollowPeriod        = time.Second
+	defaultTracesLimit      = 100
+
+	manifestDirectories = []string{"handlers", "tasks"}
+	defaultSdkPath      = "sdk"
+	defaultServiceName  = "xserver"
+	serverUrlEnv        = "XSERVER_URL"
+	protocolVersionEnv  = "XSERVER_PROTOCOL_VERSION"
+	protocolHeader      = "X-XServer-Protocol"
+	resourcesEnv        = "XSERVER_RESOURCES"
+	resourcesDirectory  = "resources"
+	unitExecutableName  = builders.ExecutableName("executable")
+
+	languagesBuildCommands = map[string]func(string, string, string, ...string) error{
+		".go":  builders.Go,
+		".c":   builders.Cpp,
+		".cpp": builders.Cpp,
+	}
+	languagesTemplates  = map[string]config.Language{}
+	languagesBuildTools = map[string]string{
+		".go":  "go",
+		".c":   "cc",
+		".cpp": "cc",
+	}
+	doctorTools    = []string{"go", "cc", "python", "lua", "node"}
+	languagesTools = map[string][]string{
+		".py":  {"python"},
+		".lua": {"lua"},
+		".bat": {"cmd", "/C"},
+		".cmd": {"cmd", "/C"},
+		".ps1": {"powershell", "-NoProfile", "-ExecutionPolicy", "Bypass", "-File"},
+	}
+)
+
+func buildUnits(unitTag string, unitsFilesPath string, units map[string]config.ExecutableServerUnit) error {
+	if err := os.RemoveAll(unitsFilesPath); err != nil {
+		return fmt.Errorf("[XServer] [Build] [%s] [Error] failed delete file directory: %s", unitTag, err)
+	}
+
+	if err := os.MkdirAll(unitsFilesPath, os.ModePerm); err != nil {
+		return fmt.Errorf("[XServer] [Build] [%s] [Error] failed create file directory: %s", unitTag, err)
+	}
+
+	failedUnits := []string{}
+	for unitName, unit := range units {
+		if err := buildUnit(unitTag, unitsFilesPath, unitName, unit); err != nil {
+			logger.Error(err.Error())
+			failedUnits = append(failedUnits, unitName)
+		}
+	}
+
+	if len(failedUnits) != 0 {
+		sort.Strings(failedUnits)
+		return fmt.Errorf("[XServer] [Build] [%s] [Error] failed build %s", unitTag, strings.Join(failedUnits, ", "))
+	}
+
+	return nil
+}
+
+func resolveUnitSources(unit config.ExecutableServerUnit) (config.ExecutableServerUnit, error) {
+	if unit.Git == nil {
+		return unit, nil
+	}
+
+	directory := sources.GitDirectory(sourcesFilesPath, unit.Git.Url, unit.Git.Ref)
+	if err := sources.GitFetch(directory, unit.Git.Url, unit.Git.Ref); err != nil {
+		return unit, err
+	}
+
+	unit.File = filepath.Join(directory, unit.File)
+	resources := []string{}
+	for _, resource := range unit.Resources {
+		resources = append(resources, filepath.Join(directory, resource))
+	}
+	unit.Resources = resources
+	return unit, nil
+}
+
+func buildUnit(unitTag string, unitsFilesPath string, unitName string, unit config.ExecutableServerUnit) error {
+	if unit.Mock != nil {
+		logger.Info(fmt.Sprintf(`[XServer] [Build] [%s] skip mock "%s"`, unitTag, unitName))
+		return nil
+	}
+	if unit.Report != nil {
+		logger.Info(fmt.Sprintf(`[XServer] [Build] [%s] skip report "%s"`, unitTag, unitName))
+		return nil
+	}
+
+	logger.Info(fmt.Sprintf(`[XServer] [Build] [%s] build "%s"`, unitTag, unitName))
+	unitFilesPath := filepath.Join(unitsFilesPath, unitName)
+	if err := os.RemoveAll(unitFilesPath); err != nil {
+		return fmt.Errorf("[XServer] [Build] [%s] [Error] failed delete file directory: %s", unitTag, err)
+	}
+	if err := os.MkdirAll(unitFilesPath, os.ModePerm); err != nil {
+		return fmt.Errorf("[XServer] [Build] [%s] [Error] failed create file directory: %s", unitTag, err)
+	}
+
+	unit, err := resolveUnitSources(unit)
+	if err != nil {
+		return fmt.Errorf(`[XServer] [Build] [%s] [Error] failed fetch "%s" sources: %s`, unitTag, unitName, err)
+	}
+
+	hooks := &config.Build{}
+	if unit.Build != nil {
+		hooks = unit.Build
+	}
+
+	if err := runBuildHooks("pre", hooks.Pre, unitName, unitFilesPath, unit); err != nil {
+		return fmt.Errorf(`[XServer] [Build] [%s] [Error] failed build "%s": %s`, unitTag, unitName, err)
+	}
+
+	if err := compileUnit(unitTag, unitFilesPath, unitName, unit); err != nil {
+		return fmt.Errorf(`[XServer] [Build] [%s] [Error] failed compile "%s": %s`, unitTag, unitName, err)
+	}
+
+	if err := copyResources(unitFilesPath, unit); err != nil {
+		return fmt.Errorf(`[XServer] [Build] [%s] [Error] failed copy "%s" resources: %s`, unitTag, unitName, err)
+	}
+
+	if err := runBuildHooks("post", hooks.Post, unitName, unitFilesPath, unit); err != nil {
+		return fmt.Errorf(`[XServer] [Build] [%s] [Error] failed build "%s": %s`, unitTag, unitName, err)
+	}
+
+	return nil
+}
+
+func copyResources(unitFilesPath string, unit config.ExecutableServerUnit) error {
+	for _, resource := range unit.Resources {
+		if err := utils.CopyPath(resource, filepath.Join(unitFilesPath, resourcesDirectory, filepath.Base(filepath.Clean(resource)))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runBuildHooks(stage string, hooks []string, unitName string, unitFilesPath string, unit config.ExecutableServerUnit) error {
+	for _, hook := range hooks {
+		logger.Info(fmt.Sprintf(`[XServer] [Build] [%s] run %s hook: %s`, unitName, stage, hook))
+		output, err := builders.Hook(hook, []string{
+			"XSERVER_UNIT=" + unitName,
+			"XSERVER_UNIT_FILE=" + unit.File,
+			"XSERVER_UNIT_DIR=" + unitFilesPath,
+		})
+		if len(output) != 0 {
+			logger.Info(fmt.Sprintf(`[XServer] [Build] [%s] %s hook output: %s`, unitName, stage, strings.TrimSpace(string(output))))
+		}
+		if err != nil {
+			return fmt.Errorf("%s hook %q failed: %s", stage, hook, err)
+		}
+	}
+	return nil
+}
+
+func compileUnit(unitTag string, unitFilesPath string, unitName string, unit config.ExecutableServerUnit) error {
+	flags := []string{}
+	if unit.Build != nil {
+		flags = unit.Build.Flags
+	}
+
+	if unit.Run != nil && unit.Run.Engine == plugins.EnginePlugin {
+		return builders.Plugin(unit.Toolchain("go"), unit.File, filepath.Join(unitFilesPath, plugins.FileName), flags...)
+	}
+
+	if language, ok := languagesTemplates[filepath.Ext(unit.File)]; ok && language.Build != "" && (unit.Build == nil || unit.Build.Tool == "") {
+		return builders.Template(language.Build, unit.File, filepath.Join(unitFilesPath, unitExecutableName), flags...)
+	}
+
+	if unit.Build != nil && unit.Build.Tool != "" {
+		logger.Info(fmt.Sprintf(`[XServer] [Build] [%s] "%s" has specified build options -> build by options`, unitTag, unitName))
+		return builders.Tool(unit.Build.Tool, unit.File, filepath.Join(unitFilesPath, unitExecutableName), flags...)
+	}
+
+	if buildCommand, ok := languagesBuildCommands[filepath.Ext(unit.File)]; ok {
+		return buildCommand(unit.Toolchain(languagesBuildTools[filepath.Ext(unit.File)]), unit.File, filepath.Join(unitFilesPath, unitExecutableName), flags...)
+	}
+
+	return utils.CopyFile(unit.File, filepath.Join(unitFilesPath, filepath.Base(unit.File)))
+}
+
+func signBuild(outputDir string, manifestPath string, signingKey string) error {
+	key, err := manifest.LoadPrivateKey(signingKey)
+	if err != nil {
+		return err
+	}
+
+	buildManifest, err := manifest.Create(outputDir, manifestDirectories...)
+	if err != nil {
+		return err
+	}
+	buildManifest.Sign(key)
+	return buildManifest.Save(manifestPath)
+}
+
+func verifyBuild(outputDir string, manifestPath string, verifyKey string) error {
+	if _, err := os.Stat(manifestPath); verifyKey == "" && os.IsNotExist(err) {
+		return nil
+	}
+
+	buildManifest, err := manifest.Load(manifestPath)
+	if err != nil {
+		return err
+	}
+	if verifyKey != "" {
+		key, err := manifest.LoadPublicKey(verifyKey)
+		if err != nil {
+			return err
+		}
+		if err := buildManifest.VerifySignature(key); err != nil {
+			return err
+		}
+	}
+	return buildManifest.Verify(outputDir, manifestDirectories...)
+}
+
+func build(config *config.Config, arguments []string) error {
+	parsed, err := parseArguments(arguments)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) != 0 {
+		usage()
+		return nil
+	}
+	sign := parsed.Bool("--sign")
+	if sign && config.Build.SigningKey == "" {
+		return fmt.Errorf("[XServer] [Build] [Error] build.signing_key is required to sign build")
+	}
+
+	logger.Info("[XServer] [Build] Build project")
+
+	if err := os.Remove(config.ManifestPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("[XServer] [Build] [Error] failed remove previous manifest: %s", err)
+	}
+
+	handlersErr := buildUnits("Handlers", handlersFilesPath, config.Handlers)
+	tasksErr := buildUnits("Tasks", tasksFilesPath, config.Tasks)
+
+	if err := errors.Join(handlersErr, tasksErr); err != nil {
+		return err
+	}
+
+	if sign {
+		if err := signBuild(config.Build.OutputDir, config.ManifestPath(), config.Build.SigningKey); err != nil {
+			return err
+		}
+		logger.Info(fmt.Sprintf("[XServer] [Build] build signed, manifest saved to %s", config.ManifestPath()))
+	}
+	return nil
+}
+
+// getUnitPaths returns the unit source file copied to the output directory and the unit executable, they are the same for not builded units.
+func getUnitPaths(unitsFilesPath string, unitName string, unit config.ExecutableServerUnit) (string, string) {
+	language, custom := languagesTemplates[filepath.Ext(unit.File)]
+	_, stdBuilded := languagesBuildCommands[filepath.Ext(unit.File)]
+	builded := stdBuilded || (unit.Build != nil && unit.Build.Tool != "") || (custom && language.Build != "")
+	unitSourcePath := filepath.Join(unitsFilesPath, unitName, filepath.Base(unit.File))
+	if builded {
+		return unitSourcePath, filepath.Join(unitsFilesPath, unitName, unitExecutableName)
+	}
+	return unitSourcePath, unitSourcePath
+}
+
+func getUnitCommand(unitTag string, unitsFilesPath string, unitName string, unit config.ExecutableServerUnit) (string, []string, error) {
+	language, custom := languagesTemplates[filepath.Ext(unit.File)]
+	unitSourcePath, unitExecutablePath := getUnitPaths(unitsFilesPath, unitName, unit)
+	builded := unitSourcePath != unitExecutablePath
+
+	args := []string{}
+	if unit.Run != nil {
+		args = unit.Run.Args
+	}
+
+	if custom && language.Run != "" && (unit.Run == nil || unit.Run.Tool == "") {
+		command := builders.ExpandTemplate(language.Run, unitSourcePath, unitExecutablePath, args)
+		if len(command) == 0 {
+			return "", nil, fmt.Errorf("[XServer] [%s %s] [Error] run command is empty", unitName, unitTag)
+		}
+		return command[0], command[1:], nil
+	}
+
+	tool, ok := languagesTools[filepath.Ext(unit.File)]
+	if unit.Run != nil && unit.Run.Tool != "" {
+		tool, ok = []string{unit.Run.Tool}, true
+	}
+
+	if ok {
+		toolArgs := append([]string{}, tool[1:]...)
+		return unit.Toolchain(tool[0]), append(append(toolArgs, unitExecutablePath), args...), nil
+	}
+	if builded {
+		return unitExecutablePath, args, nil
+	}
+	return "", nil, fmt.Errorf("[XServer] [%s %s] [Error] run command is unknown", unitName, unitTag)
+}
+
+func getUnitEnv(unitsFilesPath string, unitName string, unit config.ExecutableServerUnit) []string {
+	env := []string{}
+	if len(unit.Resources) != 0 {
+		resourcesPath, err := filepath.Abs(filepath.Join(unitsFilesPath, unitName, resourcesDirectory))
+		if err == nil {
+			env = append(env, resourcesEnv+"="+resourcesPath)
+		}
+	}
+	if unit.Process != nil && unit.Process.Locale != "" {
+		env = append(env, "LANG="+unit.Process.Locale, "LC_ALL="+unit.Process.Locale)
+	}
+	names := []string{}
+	for name := range unit.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+unit.Env[name])
+	}
+	return env
+}
+
+func persistentHandler(handlerName string, unit config.ExecutableServerUnit, devicesEnv []string) (http.HandlerFunc, func(), error) {
+	command, args, err := getUnitCommand("Handler", handlersFilesPath, handlerName, unit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	persistent := runners.NewPersistent(command, args, append(getUnitEnv(handlersFilesPath, handlerName, unit), devicesEnv...), unit.Run.Encoding, unit.Process, func(message string) {
+		logger.Verbose(fmt.Sprintf("[XServer] [%s Handler] %s", handlerName, message))
+	})
+	call, stop := persistent.Call, persistent.Stop
+	if unit.Run.Batch != nil {
+		maxDelay, err := time.ParseDuration(unit.Run.Batch.MaxDelay)
+		if err != nil {
+			return nil, nil, fmt.Errorf("[XServer] [%s Handler] [Error] failed parse batch max delay: %s", handlerName, err)
+		}
+		batched := runners.NewBatched(persistent, unit.Run.Batch.MaxSize, maxDelay, func(size int) {
+			metrics.Inc("xserver_handler_batches_total", "handler", handlerName)
+			metrics.Add("xserver_handler_batched_requests_total", float64(size), "handler", handlerName)
+		})
+		batched.Start()
+		call, stop = batched.Call, batched.Stop
+	} else if unit.Run.Warm {
+		persistent.Warm()
+	}
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			logger.Error(fmt.Sprintf("[XServer] [%s Handler] [Error] failed read request body: %s", handlerName, err))
+			problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, fmt.Sprintf("[XServer] [%s Handler] [Error] failed read request body", handlerName)))
+			return
+		}
+
+		response, err := call(request.Context(), runners.RpcRequest{
+			Method:  request.Method,
+			Path:    request.URL.Path,
+			Query:   request.URL.RawQuery,
+			Headers: request.Header,
+			Body:    string(body),
+		})
+		if err != nil {
+			message := fmt.Sprintf("[XServer] [%s Handler] [Error] failed call persistent handler: %s", handlerName, err)
+			logger.Error(message)
+			problem.Write(writer, request, problem.New(http.StatusBadGateway, problem.CodeBadGateway, message))
+			return
+		}
+
+		for name, value := range response.Headers {
+			writer.Header().Set(name, value)
+		}
+		if response.Status != 0 {
+			writer.WriteHeader(response.Status)
+		}
+		writer.Write([]byte(response.Body))
+	}, stop, nil
+}
+
+func proxiedHandler(handlerName string, unit config.ExecutableServerUnit, devicesEnv []string) (*runners.Proxied, error) {
+	command, args, err := getUnitCommand("Handler", handlersFilesPath, handlerName, unit)
+	if err != nil {
+		return nil, err
+	}
+
+	startupTimeout, err := time.ParseDuration(unit.Run.StartupTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [%s Handler] [Error] failed parse startup timeout: %s", handlerName, err)
+	}
+
+	proxied, err := runners.NewProxied(command, args, append(getUnitEnv(handlersFilesPath, handlerName, unit), devicesEnv...), unit.Process, unit.Run.Socket, unit.Run.Port, startupTimeout, func(message string) {
+		logger.Verbose(fmt.Sprintf("[XServer] [%s Handler] %s", handlerName, message))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [%s Handler] [Error] %s", handlerName, err)
+	}
+
+	return proxied, nil
+}
+
+func getUnitRunCommand(unitTag string, unitsFilesPath string, unitName string, unit config.ExecutableServerUnit, stream bool) (func(context.Context, io.Writer, io.Reader, []string, func(time.Duration)) error, error) {
+	command, args, err := getUnitCommand(unitTag, unitsFilesPath, unitName, unit)
+	if err != nil {
+		return nil, err
+	}
+	env := getUnitEnv(unitsFilesPath, unitName, unit)
+
+	return func(ctx context.Context, writer io.Writer, request io.Reader, devicesEnv []string, started func(time.Duration)) error {
+		var runError error
+		stderr := &bytes.Buffer{}
+		runners.Executable(
+			ctx,
+			command,
+			writer,
+			request,
+			runners.Options{
+				Args: args,
+				Env:  append(append(tracing.Env(ctx), env...), devicesEnv...),
+				Error: func(message string, err error) {
+					if ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+						err = fmt.Errorf("%w: %s", ctx.Err(), err)
+					}
+					runError = fmt.Errorf("%s: %w", message, err)
+					message = fmt.Sprintf("[XServer] [%s %s] [Error] %s: %s", unitName, unitTag, message, err)
+					if errors.Is(err, context.Canceled) {
+						logger.Verbose(message)
+					} else {
+						logger.Error(message)
+					}
+					problem.New(http.StatusInternalServerError, problem.CodeHandlerFailed, message).Encode(writer, "")
+				},
+				Log: func(message string) {
+					logger.Verbose(fmt.Sprintf("[XServer] [%s %s] %s", unitName, unitTag, message))
+				},
+				Started: started,
+				Stream:  stream,
+				Process: unit.Process,
+				MaxLine: unit.MaxLine,
+				Stderr:  &utils.LimitedWriter{Writer: stderr, Limit: reporting.MaxOutput},
+			},
+		)
+		if runError != nil {
+			return &reporting.Error{Err: runError, Stderr: stderr.String()}
+		}
+		return nil
+	}, nil
+}
+
+func formatMilliseconds(duration time.Duration) string {
+	return strconv.FormatFloat(float64(duration.Microseconds())/1000, 'f', 3, 64)
+}
+
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	exitError := &exec.ExitError{}
+	if errors.As(err, &exitError) {
+		return exitError.ExitCode()
+	}
+	return -1
+}
+
+// databaseHandler runs the database operation, the tenant of the request table is checked by the meter of table operations.
+func databaseHandler(operation string, errorResult interface{}, storage *database.Database, dispatcher *webhooks.Webhooks, serverModes *modes.Modes, meter *metering.Meter, call func(io.Reader, io.Writer) error) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if serverModes.RejectWrite(writer, request) {
+			return
+		}
+
+		if version := request.Header.Get(protocolHeader); version != "" && version != strconv.Itoa(runners.ProtocolVersion) {
+			message := fmt.Sprintf("[XServer] [Database] [Error] incompatible protocol version %s of sdk, server supports %d, regenerate sdk with xserver init --sdk", version, runners.ProtocolVersion)
+			logger.Error(message)
+			problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeIncompatibleProtocol, message).WithResult(errorResult))
+			return
+		}
+
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			logger.Error(fmt.Sprintf("[XServer] [Database] [Error] failed read request body: %s", err))
+			problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(errorResult))
+			return
+		}
+
+		if meter != nil {
+			tableRequest := &struct {
+				Table string `json:"table"`
+			}{}
+			json.Unmarshal(body, tableRequest)
+			if meter.RejectTable(tableRequest.Table, writer, request) {
+				return
+			}
+		}
+
+		if err := call(bytes.NewReader(body), writer); err != nil {
+			logger.Error(err.Error())
+			problem.Write(writer, request, database.Problem(err, http.StatusBadRequest).WithResult(errorResult))
+			return
+		}
+
+		if dispatcher != nil && operation != "select" {
+			dispatcher.Fire("db."+operation, storage.RedactPayload(body))
+		}
+	}
+}
+
+// queryHandler runs named queries of the database, the query api_keys and the tenant of its table are checked before the run.
+func queryHandler(storage *database.Database, meter *metering.Meter) http.HandlerFunc {
+	run := databaseHandler("query", []interface{}{}, storage, nil, nil, nil, storage.RunQuery)
+	return func(writer http.ResponseWriter, request *http.Request) {
+		body, err := io.ReadAll(request.Body)
+		queryRequest := &database.QueryRequest{}
+		if err == nil {
+			err = json.Unmarshal(body, queryRequest)
+		}
+		if err != nil {
+			err = fmt.Errorf("[XServer] [Database] [Query] [Error] failed decode json request: %s", err)
+			logger.Error(err.Error())
+			problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult([]interface{}{}))
+			return
+		}
+		if query, ok := storage.FindQuery(queryRequest.Name); ok {
+			if meter.RejectQuery(query.Name, query.ApiKeys, writer, request) || meter.RejectTable(query.Table, writer, request) {
+				return
+			}
+		}
+		request.Body = io.NopCloser(bytes.NewReader(body))
+		run(writer, request)
+	}
+}
+
+func start(config *config.Config, arguments []string) error {
+	logger.Info("[XServer] Start project")
+
+	if err := verifyBuild(config.Build.OutputDir, config.ManifestPath(), config.Build.VerifyKey); err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	dispatcher := webhooks.Create(config)
+
+	os.Setenv(serverUrlEnv, config.Scheme()+"://"+config.Url)
+	os.Setenv(protocolVersionEnv, strconv.Itoa(runners.ProtocolVersion))
+
+	alerts, err := notifications.Create(config)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	reporter, err := reporting.Create(config.Reporting)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	serverModes := modes.Create(config.Modes)
+	access := server.NewAccess(config)
+
+	startupResults := checkExecutables("Handler", handlersFilesPath, config.Handlers)
+	startupResults = append(startupResults, checkExecutables("Task", tasksFilesPath, config.Tasks)...)
+	startupResults = append(startupResults, checkDevices("Handler", config.Handlers)...)
+	startupResults = append(startupResults, checkDevices("Task", config.Tasks)...)
+
+	var storage *database.Database
+	var storageErr error
+	if config.Database.Enable {
+		result := doctor.Result{Name: "database " + config.Database.Storage}
+		storage, storageErr = database.Create(config)
+		if storageErr != nil {
+			result.Error = storageErr
+			result.Fix = "check database.storage and database.schema"
+		} else {
+			defer storage.Close()
+
+			stopMaintenance, err := scheduleMaintenance(storage, config.Database.Maintenance)
+			if err != nil {
+				logger.Error(err.Error())
+				return err
+			}
+			defer stopMaintenance()
+		}
+		startupResults = append(startupResults, result)
+	}
+
+	startupResults = append(startupResults, checkDependencies(config.Startup)...)
+	if err := reportStartup(config.Startup, startupResults); err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	serverSnapshots, err := snapshots.Create(config.Snapshots)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+	if serverSnapshots != nil {
+		stopSnapshots, err := scheduleSnapshots(config, storage, serverSnapshots)
+		if err != nil {
+			logger.Error(err.Error())
+			return err
+		}
+		defer stopSnapshots()
+	}
+
+	taskHistoryRetention, err := time.ParseDuration(config.Database.TaskHistory.Retention)
+	if err != nil {
+		err = fmt.Errorf("[XServer] [Config] [Error] failed parse task history retention: %s", err)
+		logger.Error(err.Error())
+		return err
+	}
+
+	pool, err := workers.Create(&config.Workers)
+	if err != nil {
+		err = fmt.Errorf("[XServer] [Config] [Error] failed parse workers queue timeout: %s", err)
+		logger.Error(err.Error())
+		return err
+	}
+	defer runners.TerminateAll()
+
+	gpus, err := devices.Create(config.Workers.Gpus)
+	if err != nil {
+		err = fmt.Errorf("[XServer] [Config] [Error] failed parse workers gpus queue timeout: %s", err)
+		logger.Error(err.Error())
+		return err
+	}
+
+	if reapInterval, _ := time.ParseDuration(config.Workers.ReapInterval); reapInterval > 0 {
+		stopReaper := runners.StartReaper([]string{config.HandlersOutputDir(), config.TasksOutputDir()}, reapInterval)
+		defer stopReaper()
+	}
+
+	handlersNames := []string{}
+	for handlerName := range config.Handlers {
+		handlersNames = append(handlersNames, handlerName)
+	}
+	handlersFlags, err := flags.Create(storage, handlersNames)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	thresholds, err := canaryThresholds(config.Canary)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+	canaries := canary.Create(thresholds, func(status canary.Status) {
+		if status.State == canary.StatePassed {
+			logger.Info(fmt.Sprintf(`[XServer] [Canary] canary "%s" of handler "%s" passed`, status.Variant, status.Handler))
+		} else {
+			logger.Error(fmt.Sprintf(`[XServer] [Canary] canary "%s" of handler "%s" rolled back: %s`, status.Variant, status.Handler, status.Reason))
+			if err := handlersFlags.Split(status.Handler, "", 0); err != nil {
+				logger.Error(err.Error())
+			}
+			alerts.Notify(notifications.Alert{
+				Kind:  notifications.CanaryFailed,
+				Unit:  status.Handler,
+				Error: status.Reason,
+			})
+		}
+		payload, _ := json.Marshal(status)
+		dispatcher.Fire("canary."+status.State, payload)
+	})
+
+	var recorder *recording.Recorder
+	if config.Recording.Enable {
+		if recorder, err = recording.Create(config.Recording, storage); err != nil {
+			logger.Error(err.Error())
+			return err
+		}
+		defer recorder.Close()
+	}
+
+	handlersFaults, err := faults.Create(config.Handlers)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	slos, err := slo.Create(config.Handlers, func(status slo.Status) {
+		alerts.Notify(notifications.Alert{
+			Kind:     notifications.SloBurnRate,
+			Unit:     status.Handler,
+			Window:   status.AlertWindow,
+			Slo:      status.Slo,
+			BurnRate: status.BurnRate,
+		})
+	})
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	tracer, err := tracing.Create(config.Tracing, config.Handlers)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	var meter *metering.Meter
+	if len(config.ApiKeys.Keys) > 0 || len(config.Tenants) > 0 {
+		if meter, err = metering.Create(config, storage); err != nil {
+			logger.Error(err.Error())
+			return err
+		}
+		defer meter.Close()
+	}
+
+	handlersQuarantine, err := quarantine.Create(config.Workers.Quarantine, func(entry quarantine.Entry) {
+		alerts.Notify(notifications.Alert{
+			Kind:   notifications.Quarantined,
+			Unit:   entry.Handler,
+			Count:  entry.Failures,
+			Window: config.Workers.Quarantine.Duration,
+			Error:  entry.Error,
+		})
+	})
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	units := newRunningUnits(config, storage, pool, gpus, alerts, reporter, handlersFlags, canaries, slos, meter, recorder, handlersFaults, serverModes, handlersQuarantine)
+	defer units.Stop()
+
+	for handlerName, handler := range config.Handlers {
+		if err := units.Add(handlerName, handler); err != nil {
+			logger.Error(err.Error())
+		}
+		if handler.Listen == nil {
+			continue
+		}
+		if err := units.Listen(handlerName, handler); err != nil {
+			logger.Error(err.Error())
+		}
+	}
+	if config.Mail.Address != "" {
+		if err := units.Mail(); err != nil {
+			logger.Error(err.Error())
+		}
+	}
+	for watcherName, watcher := range config.Watchers {
+		if err := units.Watch(watcherName, watcher); err != nil {
+			logger.Error(err.Error())
+		}
+	}
+
+	scheduledTasks, err := tasks.Create(config.State)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	for taskName, task := range config.Tasks {
+		currentTaskName := taskName
+		currentTask := task
+
+		if currentTask.Report != nil {
+			reportRunCommand, err := reports.Create(currentTaskName, *currentTask.Report, config.Smtp, storage)
+			if err != nil {
+				logger.Error(err.Error())
+				continue
+			}
+			if err := scheduledTasks.Add(currentTaskName, currentTask, reportRunCommand); err != nil {
+				logger.Error(fmt.Sprintf("[XServer] [%s Task] [Error] %s", currentTaskName, err))
+			}
+			continue
+		}
+
+		runCommand, err := getUnitRunCommand("Task", tasksFilesPath, currentTaskName, currentTask, config.LowMemory())
+
+		if err != nil {
+			logger.Error(err.Error())
+			continue
+		}
+
+		taskDevices := currentTask.Devices
+		taskRunCommand := func(ctx context.Context, writer io.Writer, request io.Reader) error {
+			assigned, release, err := gpus.Acquire(ctx, taskDevices)
+			if err != nil {
+				return fmt.Errorf("failed acquire gpus: %w", err)
+			}
+			defer release()
+			return runCommand(ctx, writer, request, devices.Env(taskDevices, assigned), nil)
+		}
+
+		if err := scheduledTasks.Add(currentTaskName, currentTask, taskRunCommand); err != nil {
+			logger.Error(fmt.Sprintf("[XServer] [%s Task] [Error] %s", currentTaskName, err))
+			continue
+		}
+	}
+
+	scheduledTasks.OnRun(func(run tasks.Run) {
+		alerts.TaskResult(run.Task, run.Error)
+		reporter.Report(reporting.Report{Kind: reporting.KindTask, Unit: run.Task, Error: run.Error, Output: run.Output})
+	})
+
+	if storage != nil && config.Database.TaskHistory.Enable {
+		scheduledTasks.OnRun(func(run tasks.Run) {
+			output := run.Output
+			if len(output) > config.Database.TaskHistory.MaxOutput {
+				output = output[:config.Database.TaskHistory.MaxOutput]
+			}
+			taskRun := database.TaskRun{
+				Task:       run.Task,
+				StartedAt:  run.StartedAt,
+				DurationMs: run.Duration.Milliseconds(),
+				ExitStatus: exitStatus(run.Error),
+				Output:     output,
+			}
+			if run.Error != nil {
+				taskRun.Error = run.Error.Error()
+			}
+			if err := storage.AddTaskRun(taskRun, taskHistoryRetention); err != nil {
+				logger.Error(err.Error())
+			}
+		})
+	}
+
+	scheduledTasks.OnRun(func(run tasks.Run) {
+		event := "task.completed"
+		if run.Error != nil {
+			event = "task.failed"
+		}
+		payload, _ := json.Marshal(map[string]string{"task": run.Task, "output": run.Output})
+		dispatcher.Fire(event, payload)
+	})
+
+	if storage != nil {
+		server.AddHandler("/db/insert", database.Encodings("insert", databaseHandler("insert", false, storage, dispatcher, serverModes, meter, storage.Insert)))
+		tags := etag.Create()
+		selectHandler := databaseHandler("select", []interface{}{}, storage, dispatcher, nil, meter, storage.Select)
+		if config.Database.Etag {
+			selectHandler = tags.Reads("db_select", selectHandler)
+		}
+		streamHandler := databaseHandler("select", []interface{}{}, storage, nil, nil, meter, storage.SelectStream)
+		server.AddHandler("/db/select", database.Streaming(streamHandler, database.Encodings("select", selectHandler)))
+		server.AddHandler("/db/update", database.Encodings("update", databaseHandler("update", false, storage, dispatcher, serverModes, meter, storage.Update)))
+		server.AddHandler("/db/delete", database.Encodings("delete", databaseHandler("delete", false, storage, dispatcher, serverModes, meter, storage.Delete)))
+		server.AddHandler("/db/explain", database.Encodings("explain", databaseHandler("explain", false, storage, nil, nil, meter, storage.Explain)))
+		server.AddHandler("/db/history", database.Encodings("history", databaseHandler("history", []interface{}{}, storage, nil, nil, meter, storage.History)))
+		server.AddHandler("/db/restore", database.Encodings("restore", databaseHandler("restore", false, storage, dispatcher, serverModes, meter, storage.Restore)))
+		server.AddHandler("/db/queries", func(writer http.ResponseWriter, request *http.Request) {
+			result, _ := json.Marshal(storage.Queries())
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		})
+		server.AddHandler("/db/queries/run", database.Binary("query", queryHandler(storage, meter)))
+		server.AddHandler("/db/queries/define", access.Authorized(server.RoleOperator, databaseHandler("query_define", false, storage, nil, serverModes, nil, storage.DefineQuery)))
+		server.AddHandler("/db/queries/delete", access.Authorized(server.RoleOperator, databaseHandler("query_delete", false, storage, nil, serverModes, nil, storage.DeleteQuery)))
+
+		if config.Database.Rest {
+			restHandler := rest.Create(storage, serverModes, dispatcher, meter).ServeHTTP
+			if config.Database.Etag {
+				restHandler = tags.Handler("rest", restHandler)
+			}
+			server.AddHandler(rest.Prefix, restHandler)
+		}
+		server.AddHandler("/kv/get", databaseHandler("kv_get", false, storage, nil, nil, nil, storage.GetKey))
+		server.AddHandler("/kv/set", databaseHandler("kv_set", false, storage, nil, serverModes, nil, storage.SetKey))
+		server.AddHandler("/kv/delete", databaseHandler("kv_delete", false, storage, nil, serverModes, nil, storage.DeleteKey))
+
+		server.AddHandler(
+			"/admin/db/maintenance",
+			access.Authorized(server.RoleAdmin, func(writer http.ResponseWriter, request *http.Request) {
+				maintenance := &maintenanceRequest{}
+				if err := json.NewDecoder(request.Body).Decode(maintenance); err != nil {
+					err = fmt.Errorf("[XServer] [Database] [Maintenance] [Error] failed decode json request: %s", err)
+					logger.Error(err.Error())
+					problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+					return
+				}
+				report, err := storage.Maintain(maintenance.Operation, maintenance.DryRun)
+				if err != nil {
+					logger.Error(err.Error())
+					problem.Write(writer, request, database.Problem(err, http.StatusInternalServerError).WithResult(false))
+					return
+				}
+				result, _ := json.Marshal(report)
+				writer.Write([]byte(fmt.Sprintf(`{"result": true, "report": %s}`, result)))
+			}),
+		)
+
+		server.AddHandler(
+			"/db/set_schema",
+			func(writer http.ResponseWriter, request *http.Request) {
+				if serverModes.RejectWrite(writer, request) {
+					return
+				}
+				if err := storage.SetSchema(request.Body); err != nil {
+					logger.Error(err.Error())
+					problem.Write(writer, request, database.Problem(err, http.StatusBadRequest).WithResult(false))
+					return
+				}
+				writer.Write([]byte(`{"result": true}`))
+			},
+		)
+	} else if config.Database.Enable {
+		addUnavailableDatabase(config.Database, storageErr)
+	}
+
+	server.AddHandler(
+		"/tasks/",
+		func(writer http.ResponseWriter, request *http.Request) {
+			taskName, ok := strings.CutSuffix(strings.TrimPrefix(request.URL.Path, "/tasks/"), "/history")
+			if !ok || taskName == "" {
+				http.NotFound(writer, request)
+				return
+			}
+
+			if storage == nil || !config.Database.TaskHistory.Enable {
+				problem.Write(writer, request, problem.New(http.StatusNotFound, problem.CodeNotFound, "[XServer] [Tasks] [Error] task history is disabled").WithResult([]interface{}{}))
+				return
+			}
+
+			limit, err := strconv.Atoi(request.URL.Query().Get("limit"))
+			if err != nil || limit <= 0 {
+				limit = defaultTaskHistoryLimit
+			}
+
+			runs, err := storage.TaskHistory(taskName, limit)
+			if err != nil {
+				logger.Error(err.Error())
+				problem.Write(writer, request, database.Problem(err, http.StatusInternalServerError).WithResult([]interface{}{}))
+				return
+			}
+
+			result, _ := json.Marshal(runs)
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		},
+	)
+
+	server.AddHandler(
+		"/admin/tasks",
+		access.Authorized(server.RoleViewer, func(writer http.ResponseWriter, request *http.Request) {
+			result, _ := json.Marshal(scheduledTasks.List())
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		}),
+	)
+
+	for action, call := range map[string]func(request *taskRequest) error{
+		"pause":  func(request *taskRequest) error { return scheduledTasks.Pause(request.Task) },
+		"resume": func(request *taskRequest) error { return scheduledTasks.Resume(request.Task) },
+		"period": func(request *taskRequest) error { return scheduledTasks.SetPeriod(request.Task, request.Period) },
+		"run":    func(request *taskRequest) error { return scheduledTasks.RunNow(request.Task) },
+	} {
+		currentCall := call
+		server.AddHandler(
+			"/admin/tasks/"+action,
+			access.Authorized(server.RoleOperator, func(writer http.ResponseWriter, request *http.Request) {
+				taskRequest := &taskRequest{}
+				if err := json.NewDecoder(request.Body).Decode(taskRequest); err != nil {
+					err = fmt.Errorf("[XServer] [Tasks] [Error] failed decode json request: %s", err)
+					logger.Error(err.Error())
+					problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+					return
+				}
+				if err := currentCall(taskRequest); err != nil {
+					logger.Error(err.Error())
+					problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+					return
+				}
+				writer.Write([]byte(`{"result": true}`))
+			}),
+		)
+	}
+
+	server.AddHandler(
+		"/admin/pull",
+		access.Authorized(server.RoleOperator, func(writer http.ResponseWriter, request *http.Request) {
+			pullRequest := &pullRequest{}
+			if err := json.NewDecoder(request.Body).Decode(pullRequest); err != nil {
+				err = fmt.Errorf("[XServer] [Pull] [Error] failed decode json request: %s", err)
+				logger.Error(err.Error())
+				problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+				return
+			}
+			pulled, err := pullUnits(config.Handlers, config.Tasks, pullRequest.Unit, units.Rebuild)
+			if err != nil {
+				logger.Error(err.Error())
+				problem.Write(writer, request, problem.New(http.StatusInternalServerError, problem.CodeInternal, err.Error()).WithResult(false).With("units", pulled))
+				return
+			}
+			result, _ := json.Marshal(pulled)
+			writer.Write([]byte(fmt.Sprintf(`{"result": true, "units": %s}`, result)))
+		}),
+	)
+
+	server.AddHandler(
+		"/flags",
+		func(writer http.ResponseWriter, request *http.Request) {
+			result, _ := json.Marshal(handlersFlags.List())
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		},
+	)
+
+	for action, call := range map[string]func(request *flagRequest) error{
+		"enable":  func(request *flagRequest) error { return handlersFlags.SetEnabled(request.Handler, true) },
+		"disable": func(request *flagRequest) error { return handlersFlags.SetEnabled(request.Handler, false) },
+		"split": func(request *flagRequest) error {
+			return handlersFlags.Split(request.Handler, request.Variant, request.Percent)
+		},
+		"reset": func(request *flagRequest) error { return handlersFlags.Reset(request.Handler) },
+	} {
+		currentCall := call
+		server.AddHandler(
+			"/admin/flags/"+action,
+			access.Authorized(server.RoleOperator, func(writer http.ResponseWriter, request *http.Request) {
+				flagRequest := &flagRequest{}
+				if err := json.NewDecoder(request.Body).Decode(flagRequest); err != nil {
+					err = fmt.Errorf("[XServer] [Flags] [Error] failed decode json request: %s", err)
+					logger.Error(err.Error())
+					problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+					return
+				}
+				if err := currentCall(flagRequest); err != nil {
+					logger.Error(err.Error())
+					problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+					return
+				}
+				writer.Write([]byte(`{"result": true}`))
+			}),
+		)
+	}
+
+	server.AddHandler(
+		"/admin/canary",
+		access.Authorized(server.RoleViewer, func(writer http.ResponseWriter, request *http.Request) {
+			result, _ := json.Marshal(canaries.List())
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		}),
+	)
+
+	for action, call := range map[string]func(request *flagRequest) error{
+		"start": func(request *flagRequest) error {
+			if request.Percent <= 0 || request.Percent >= 100 {
+				return fmt.Errorf("[XServer] [Canary] [Error] percent must be between 1 and 99")
+			}
+			if err := handlersFlags.Split(request.Handler, request.Variant, request.Percent); err != nil {
+				return err
+			}
+			canaries.Start(request.Handler, request.Variant, request.Percent)
+			return nil
+		},
+		"rollback": func(request *flagRequest) error { return canaries.Rollback(request.Handler, "manual rollback") },
+	} {
+		currentCall := call
+		server.AddHandler(
+			"/admin/canary/"+action,
+			access.Authorized(server.RoleOperator, func(writer http.ResponseWriter, request *http.Request) {
+				flagRequest := &flagRequest{}
+				if err := json.NewDecoder(request.Body).Decode(flagRequest); err != nil {
+					err = fmt.Errorf("[XServer] [Canary] [Error] failed decode json request: %s", err)
+					logger.Error(err.Error())
+					problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+					return
+				}
+				if err := currentCall(flagRequest); err != nil {
+					logger.Error(err.Error())
+					problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+					return
+				}
+				writer.Write([]byte(`{"result": true}`))
+			}),
+		)
+	}
+
+	server.AddHandler(
+		"/admin/shadow",
+		access.Authorized(server.RoleViewer, func(writer http.ResponseWriter, request *http.Request) {
+			result, _ := json.Marshal(units.mirror.Diffs(request.URL.Query().Get("handler")))
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		}),
+	)
+
+	server.AddHandler(
+		"/admin/faults",
+		access.Authorized(server.RoleViewer, func(writer http.ResponseWriter, request *http.Request) {
+			result, _ := json.Marshal(handlersFaults.List())
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		}),
+	)
+
+	for action, call := range map[string]func(request *faults.Fault) error{
+		"enable":  func(request *faults.Fault) error { return handlersFaults.SetEnabled(request.Handler, true) },
+		"disable": func(request *faults.Fault) error { return handlersFaults.SetEnabled(request.Handler, false) },
+		"set":     func(request *faults.Fault) error { return handlersFaults.Set(*request) },
+	} {
+		currentCall := call
+		server.AddHandler(
+			"/admin/faults/"+action,
+			access.Authorized(server.RoleOperator, func(writer http.ResponseWriter, request *http.Request) {
+				faultRequest := &faults.Fault{}
+				if err := json.NewDecoder(request.Body).Decode(faultRequest); err != nil {
+					err = fmt.Errorf("[XServer] [Faults] [Error] failed decode json request: %s", err)
+					logger.Error(err.Error())
+					problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+					return
+				}
+				if err := currentCall(faultRequest); err != nil {
+					logger.Error(err.Error())
+					problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+					return
+				}
+				writer.Write([]byte(`{"result": true}`))
+			}),
+		)
+	}
+
+	server.AddHandler(
+		"/admin/quarantine",
+		access.Authorized(server.RoleViewer, func(writer http.ResponseWriter, request *http.Request) {
+			result, _ := json.Marshal(handlersQuarantine.List())
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		}),
+	)
+
+	server.AddHandler(
+		"/admin/quarantine/release",
+		access.Authorized(server.RoleOperator, func(writer http.ResponseWriter, request *http.Request) {
+			releaseRequest := &quarantineRequest{}
+			if err := json.NewDecoder(request.Body).Decode(releaseRequest); err != nil {
+				err = fmt.Errorf("[XServer] [Quarantine] [Error] failed decode json request: %s", err)
+				logger.Error(err.Error())
+				problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+				return
+			}
+			if !handlersQuarantine.Release(releaseRequest.Handler) {
+				err := fmt.Errorf(`[XServer] [Quarantine] [Error] handler "%s" is not quarantined`, releaseRequest.Handler)
+				logger.Error(err.Error())
+				problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+				return
+			}
+			writer.Write([]byte(`{"result": true}`))
+		}),
+	)
+
+	server.AddHandler(
+		"/admin/snapshots",
+		access.Authorized(server.RoleViewer, func(writer http.ResponseWriter, request *http.Request) {
+			if serverSnapshots == nil {
+				problem.Write(writer, request, problem.New(http.StatusNotFound, problem.CodeNotFound, "[XServer] [Snapshots] [Error] snapshots directory or s3 is not configured").WithResult(false))
+				return
+			}
+			list, err := serverSnapshots.List()
+			if err != nil {
+				err = fmt.Errorf("[XServer] [Snapshots] [Error] failed list snapshots: %s", err)
+				logger.Error(err.Error())
+				problem.Write(writer, request, problem.New(http.StatusBadGateway, problem.CodeBadGateway, err.Error()).WithResult(false))
+				return
+			}
+			result, _ := json.Marshal(list)
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		}),
+	)
+
+	server.AddHandler(
+		"/admin/snapshots/create",
+		access.Authorized(server.RoleOperator, func(writer http.ResponseWriter, request *http.Request) {
+			if serverSnapshots == nil {
+				problem.Write(writer, request, problem.New(http.StatusNotFound, problem.CodeNotFound, "[XServer] [Snapshots] [Error] snapshots directory or s3 is not configured").WithResult(false))
+				return
+			}
+			snapshot, err := takeSnapshot(config, storage, serverSnapshots)
+			if err != nil {
+				problem.Write(writer, request, problem.New(http.StatusInternalServerError, problem.CodeInternal, err.Error()).WithResult(false))
+				return
+			}
+			result, _ := json.Marshal(snapshot)
+			writer.Write([]byte(fmt.Sprintf(`{"result": true, "snapshot": %s}`, result)))
+		}),
+	)
+
+	server.AddHandler(
+		"/admin/slo",
+		access.Authorized(server.RoleViewer, func(writer http.ResponseWriter, request *http.Request) {
+			result, _ := json.Marshal(slos.List())
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		}),
+	)
+
+	server.AddHandler(
+		"/admin/traces",
+		access.Authorized(server.RoleViewer, func(writer http.ResponseWriter, request *http.Request) {
+			query := tracing.Query{
+				TraceId: request.URL.Query().Get("trace_id"),
+				Handler: request.URL.Query().Get("handler"),
+				Failed:  request.URL.Query().Get("failed") == "true",
+				Limit:   defaultTracesLimit,
+			}
+			if limit := request.URL.Query().Get("limit"); limit != "" {
+				query.Limit, _ = strconv.Atoi(limit)
+			}
+			result, _ := json.Marshal(tracer.Traces(query))
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		}),
+	)
+
+	server.AddHandler(
+		"/admin/usage",
+		access.Authorized(server.RoleViewer, func(writer http.ResponseWriter, request *http.Request) {
+			now := time.Now().UTC()
+			from := request.URL.Query().Get("from")
+			if from == "" {
+				from = now.Format("2006-01") + "-01"
+			}
+			to := request.URL.Query().Get("to")
+			if to == "" {
+				to = now.Format("2006-01-02")
+			}
+			report, err := meter.Report(request.URL.Query().Get("key"), from, to)
+			if err != nil {
+				logger.Error(err.Error())
+				problem.Write(writer, request, database.Problem(err, http.StatusInternalServerError).WithResult([]interface{}{}))
+				return
+			}
+			result, _ := json.Marshal(report)
+			keys, _ := json.Marshal(meter.Keys())
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s, "keys": %s}`, result, keys)))
+		}),
+	)
+
+	server.AddHandler(
+		"/admin/tenants",
+		access.Authorized(server.RoleViewer, func(writer http.ResponseWriter, request *http.Request) {
+			result, _ := json.Marshal(tenantsStatus(config, meter))
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		}),
+	)
+
+	for action, suspend := range map[string]bool{"suspend": true, "resume": false} {
+		currentSuspend := suspend
+		server.AddHandler(
+			"/admin/tenants/"+action,
+			access.Authorized(server.RoleAdmin, func(writer http.ResponseWriter, request *http.Request) {
+				tenantRequest := &tenantRequest{}
+				if err := json.NewDecoder(request.Body).Decode(tenantRequest); err != nil {
+					err = fmt.Errorf("[XServer] [Tenants] [Error] failed decode json request: %s", err)
+					logger.Error(err.Error())
+					problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+					return
+				}
+				if err := suspendTenant(config, handlersFlags, scheduledTasks, tenantRequest.Tenant, currentSuspend); err != nil {
+					logger.Error(err.Error())
+					problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+					return
+				}
+				writer.Write([]byte(`{"result": true}`))
+			}),
+		)
+	}
+
+	server.AddHandler(
+		"/admin/errors",
+		access.Authorized(server.RoleViewer, func(writer http.ResponseWriter, request *http.Request) {
+			result, _ := json.Marshal(reporter.Issues())
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		}),
+	)
+
+	server.AddHandler(
+		"/admin/logs",
+		access.Authorized(server.RoleViewer, func(writer http.ResponseWriter, request *http.Request) {
+			query := logger.Query{
+				Unit:  request.URL.Query().Get("unit"),
+				Level: request.URL.Query().Get("level"),
+			}
+			if tenant := request.URL.Query().Get("tenant"); tenant != "" {
+				if _, ok := config.Tenants[tenant]; !ok {
+					err := fmt.Errorf(`[XServer] [Logs] [Error] unknown tenant "%s"`, tenant)
+					problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult([]interface{}{}))
+					return
+				}
+				query.Units = config.TenantUnits(tenant)
+			}
+			if since := request.URL.Query().Get("since"); since != "" {
+				duration, err := time.ParseDuration(since)
+				if err != nil {
+					err = fmt.Errorf("[XServer] [Logs] [Error] failed parse since: %s", err)
+					problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult([]interface{}{}))
+					return
+				}
+				query.Since = time.Now().Add(-duration)
+			}
+			if after := request.URL.Query().Get("after"); after != "" {
+				query.After, _ = strconv.ParseInt(after, 10, 64)
+			}
+
+			entries, err := logger.History(query)
+			if err != nil {
+				problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult([]interface{}{}))
+				return
+			}
+			result, _ := json.Marshal(entries)
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		}),
+	)
+
+	server.AddHandler(
+		"/admin/modes",
+		access.Authorized(server.RoleViewer, func(writer http.ResponseWriter, request *http.Request) {
+			result, _ := json.Marshal(serverModes.Get())
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		}),
+	)
+
+	for action, enable := range map[string]bool{"enable": true, "disable": false} {
+		currentEnable := enable
+		server.AddHandler(
+			"/admin/modes/"+action,
+			access.Authorized(server.RoleOperator, func(writer http.ResponseWriter, request *http.Request) {
+				mode := &modeRequest{}
+				if err := json.NewDecoder(request.Body).Decode(mode); err != nil {
+					err = fmt.Errorf("[XServer] [Modes] [Error] failed decode json request: %s", err)
+					logger.Error(err.Error())
+					problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+					return
+				}
+				if err := serverModes.Set(mode.Mode, currentEnable); err != nil {
+					logger.Error(err.Error())
+					problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+					return
+				}
+				logger.Info(fmt.Sprintf("[XServer] [Modes] %s mode enabled: %t", mode.Mode, currentEnable))
+				writer.Write([]byte(`{"result": true}`))
+			}),
+		)
+	}
+
+	settings := &runtimeSettings{
+		config:         config,
+		handlersFlags:  handlersFlags,
+		handlersFaults: handlersFaults,
+		serverModes:    serverModes,
+		scheduledTasks: scheduledTasks,
+	}
+
+	server.AddHandler(
+		"/admin/config",
+		access.Authorized(server.RoleViewer, func(writer http.ResponseWriter, request *http.Request) {
+			value, err := settings.get(request.URL.Query().Get("key"))
+			if err != nil {
+				problem.Write(writer, request, problem.New(http.StatusNotFound, problem.CodeNotFound, err.Error()).WithResult(nil))
+				return
+			}
+			result, _ := json.Marshal(value)
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		}),
+	)
+
+	server.AddHandler(
+		"/admin/config/set",
+		access.Authorized(server.RoleOperator, func(writer http.ResponseWriter, request *http.Request) {
+			setting := &settingRequest{}
+			if err := json.NewDecoder(request.Body).Decode(setting); err != nil {
+				err = fmt.Errorf("[XServer] [Config] [Error] failed decode json request: %s", err)
+				logger.Error(err.Error())
+				problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+				return
+			}
+			if setting.Save && runtimeOnly(setting.Key) {
+				err := fmt.Errorf(`[XServer] [Config] [Error] "%s" is kept in the runtime state and can't be saved to the config file`, setting.Key)
+				problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+				return
+			}
+			value, err := settings.set(setting.Key, setting.Value)
+			if err != nil {
+				logger.Error(err.Error())
+				problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+				return
+			}
+			logger.Info(fmt.Sprintf(`[XServer] [Config] "%s" set to "%s"`, setting.Key, setting.Value))
+			if setting.Save {
+				if err := settings.save(setting.Key, value); err != nil {
+					logger.Error(err.Error())
+					problem.Write(writer, request, problem.New(http.StatusInternalServerError, problem.CodeInternal, err.Error()).WithResult(false))
+					return
+				}
+			}
+			writer.Write([]byte(`{"result": true}`))
+		}),
+	)
+
+	server.AddHandler("/admin/rebuild/", access.Authorized(server.RoleOperator, units.RebuildHandler))
+
+	if config.Admin.GithubSecret != "" {
+		server.AddHandler("/github/rebuild/", units.GithubHandler)
+	}
+
+	server.AddHandler(
+		"/webhooks/fire",
+		access.Authorized(server.RoleOperator, func(writer http.ResponseWriter, request *http.Request) {
+			event := &webhooks.Event{}
+			if err := json.NewDecoder(request.Body).Decode(event); err != nil || event.Event == "" {
+				if err == nil {
+					err = fmt.Errorf("event name is empty")
+				}
+				logger.Error(fmt.Sprintf("[XServer] [Webhooks] [Error] failed decode event: %s", err))
+				problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, err.Error()).WithResult(false))
+				return
+			}
+			deliveries, _ := json.Marshal(dispatcher.Fire(event.Event, event.Data))
+			writer.Write([]byte(fmt.Sprintf(`{"result": true, "deliveries": %s}`, deliveries)))
+		}),
+	)
+
+	server.AddHandler(
+		"/webhooks/deliveries",
+		access.Authorized(server.RoleViewer, func(writer http.ResponseWriter, request *http.Request) {
+			deliveries, _ := json.Marshal(dispatcher.Deliveries(request.URL.Query().Get("id")))
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, deliveries)))
+		}),
+	)
+
+	server.AddHandler("/metrics", metrics.Handler)
+
+	databasePath := ""
+	if config.Database.Enable {
+		databasePath = config.Database.Storage
+	}
+	hostMonitor := host.Create(config.Host, config.Build.OutputDir, databasePath, func(exceeded host.Exceeded) {
+		alerts.Notify(notifications.Alert{
+			Kind:      notifications.HostResource,
+			Unit:      exceeded.Resource,
+			Value:     exceeded.Value,
+			Threshold: exceeded.Threshold,
+		})
+	})
+	hostMonitor.Start()
+	defer hostMonitor.Stop()
+
+	server.AddHandler(
+		"/admin/host",
+		access.Authorized(server.RoleViewer, func(writer http.ResponseWriter, request *http.Request) {
+			result, _ := json.Marshal(hostMonitor.Usage())
+			writer.Write([]byte(fmt.Sprintf(`{"result": %s}`, result)))
+		}),
+	)
+
+	stopExporters, err := observability.Start(config.Observability)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+	defer stopExporters()
+
+	server.AddHandler(
+		"/status",
+		func(writer http.ResponseWriter, request *http.Request) {
+			writer.Write([]byte("OK"))
+		},
+	)
+
+	scheduledTasks.Start()
+	defer scheduledTasks.Stop()
+
+	scheduledTasks.Monitor(func(missed tasks.Missed) {
+		kind := notifications.TaskNotRun
+		if missed.Kind == tasks.MissedSuccess {
+			kind = notifications.TaskNotOk
+		}
+		alerts.Notify(notifications.Alert{
+			Kind:   kind,
+			Unit:   missed.Task,
+			Window: missed.Window.String(),
+		})
+	})
+
+	alerts.ServerStarted()
+
+	err = server.Start(config, problem.Handler(tracer.Handler(headers.Handler(config, serverModes.Handler(redirects.Handler(config, http.DefaultServeMux))))))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+type taskRequest struct {
+	Task   string `json:"task"`
+	Period string `json:"period"`
+}
+
+func tasksCommand(config *config.Config, arguments []string) error {
+	if len(arguments) == 0 || arguments[0] == "list" {
+		response, err := admin.Request(config, "/admin/tasks", nil)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(response))
+		return nil
+	}
+
+	action := arguments[0]
+	request := &taskRequest{}
+	switch {
+	case (action == "pause" || action == "resume" || action == "run") && len(arguments) == 2:
+		request.Task = arguments[1]
+	case action == "period" && len(arguments) == 3:
+		request.Task = arguments[1]
+		request.Period = arguments[2]
+	default:
+		usage()
+		return nil
+	}
+
+	response, err := admin.Request(config, "/admin/tasks/"+action, request)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(response))
+	return nil
+}
+
+type modeRequest struct {
+	Mode string `json:"mode"`
+}
+
+func modesCommand(config *config.Config, arguments []string) error {
+	if len(arguments) == 0 || arguments[0] == "list" {
+		response, err := admin.Request(config, "/admin/modes", nil)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(response))
+		return nil
+	}
+
+	if (arguments[0] != "enable" && arguments[0] != "disable") || len(arguments) != 2 {
+		usage()
+		return nil
+	}
+
+	response, err := admin.Request(config, "/admin/modes/"+arguments[0], &modeRequest{Mode: arguments[1]})
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(response))
+	return nil
+}
+
+// logsCommand prints remembered messages of the running server, with -f it polls new messages until interrupted.
+func logsCommand(config *config.Config, arguments []string) error {
+	parsed, err := parseArguments(arguments)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) > 1 {
+		usage()
+		return nil
+	}
+	follow := parsed.Bool("-f")
+	parameters := url.Values{}
+	for _, name := range []string{"level", "since", "tenant"} {
+		if value := parsed.String("--"+name, ""); value != "" {
+			parameters.Set(name, value)
+		}
+	}
+	if len(parsed.Positional) == 1 {
+		parameters.Set("unit", parsed.Positional[0])
+	}
+
+	for {
+		response, err := admin.Request(config, "/admin/logs?"+parameters.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		result := struct {
+			Result []logger.Entry `json:"result"`
+		}{}
+		if err := json.Unmarshal(response, &result); err != nil {
+			return fmt.Errorf("[XServer] [Logs] [Error] failed decode response: %s", err)
+		}
+		for _, entry := range result.Result {
+			fmt.Printf("%s %s: %s\n", entry.Time.Format("2006/01/02 15:04:05"), entry.Level, entry.Message)
+			parameters.Set("after", strconv.FormatInt(entry.Sequence, 10))
+		}
+
+		if !follow {
+			return nil
+		}
+		parameters.Del("since")
+		time.Sleep(logsFollowPeriod)
+	}
+}
+
+type maintenanceRequest struct {
+	Operation string `json:"operation"`
+	DryRun    bool   `json:"dry_run"`
+}
+
+// scheduleMaintenance runs configured database maintenance operations by the period, one after another.
+func scheduleMaintenance(storage *database.Database, maintenance config.Maintenance) (func(), error) {
+	if maintenance.Period == "" {
+		return func() {}, nil
+	}
+
+	for _, operation := range maintenance.Operations {
+		known := false
+		for _, maintenanceOperation := range database.MaintenanceOperations {
+			known = known || operation == maintenanceOperation
+		}
+		if !known {
+			return nil, fmt.Errorf(`[XServer] [Config] [Error] unknown database maintenance operation "%s", expected one of %s`, operation, strings.Join(database.MaintenanceOperations, ", "))
+		}
+	}
+
+	schedule, err := scheduler.Parse(maintenance.Period, maintenance.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Config] [Error] database maintenance: %s", err)
+	}
+
+	maintenanceCron := cron.New()
+	maintenanceCron.Schedule(schedule, cron.FuncJob(func() {
+		for _, operation := range maintenance.Operations {
+			if _, err := storage.Maintain(operation, false); err != nil {
+				logger.Error(err.Error())
+			}
+		}
+	}))
+	maintenanceCron.Start()
+	return maintenanceCron.Stop, nil
+}
+
+func dbCommand(config *config.Config, arguments []string) error {
+	parsed, err := parseArguments(arguments)
+	if err != nil {
+		return err
+	}
+	request := &maintenanceRequest{DryRun: parsed.Bool("--dry-run")}
+	if len(parsed.Positional) == 1 {
+		request.Operation = parsed.Positional[0]
+	}
+	if request.Operation == "" {
+		usage()
+		return nil
+	}
+
+	response, err := admin.Request(config, "/admin/db/maintenance", request)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(response))
+	return nil
+}
+
+type pullRequest struct {
+	Unit string `json:"unit"`
+}
+
+func pullCommand(config *config.Config, arguments []string) error {
+	request := &pullRequest{}
+	if len(arguments) > 0 {
+		request.Unit = arguments[0]
+	}
+
+	response, err := admin.Request(config, "/admin/pull", request)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(response))
+	return nil
+}
+
+func keygenCommand(config *config.Config, arguments []string) error {
+	directory := "."
+	if len(arguments) > 0 {
+		directory = arguments[0]
+	}
+
+	privatePath := filepath.Join(directory, "signing.key")
+	publicPath := filepath.Join(directory, "signing.pub")
+	if err := manifest.GenerateKeys(privatePath, publicPath); err != nil {
+		return err
+	}
+	fmt.Printf("[XServer] [Keygen] generated %s and %s\n", privatePath, publicPath)
+	return nil
+}
+
+type flagRequest struct {
+	Handler string `json:"handler"`
+	Variant string `json:"variant"`
+	Percent int    `json:"percent"`
+}
+
+func flagsCommand(config *config.Config, arguments []string) error {
+	if len(arguments) == 0 || arguments[0] == "list" {
+		response, err := admin.Request(config, "/flags", nil)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(response))
+		return nil
+	}
+
+	action := arguments[0]
+	request := &flagRequest{}
+	switch {
+	case (action == "enable" || action == "disable" || action == "reset") && len(arguments) == 2:
+		request.Handler = arguments[1]
+	case action == "split" && len(arguments) == 4:
+		percent, err := strconv.Atoi(strings.TrimSuffix(arguments[3], "%"))
+		if err != nil {
+			return fmt.Errorf("[XServer] [Flags] [Error] invalid percent: %s", err)
+		}
+		request.Handler = arguments[1]
+		request.Variant = arguments[2]
+		request.Percent = percent
+	default:
+		usage()
+		return nil
+	}
+
+	response, err := admin.Request(config, "/admin/flags/"+action, request)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(response))
+	return nil
+}
+
+func canaryThresholds(settings config.Canary) (canary.Thresholds, error) {
+	thresholds := canary.Thresholds{
+		MaxErrorRate: settings.MaxErrorRate,
+		MinRequests:  settings.MinRequests,
+	}
+
+	window, err := time.ParseDuration(settings.Window)
+	if err != nil {
+		return thresholds, fmt.Errorf("[XServer] [Config] [Error] failed parse canary window: %s", err)
+	}
+	thresholds.Window = window
+
+	if settings.MaxLatency != "" {
+		maxLatency, err := time.ParseDuration(settings.MaxLatency)
+		if err != nil {
+			return thresholds, fmt.Errorf("[XServer] [Config] [Error] failed parse canary max latency: %s", err)
+		}
+		thresholds.MaxLatency = maxLatency
+	}
+	return thresholds, nil
+}
+
+func canaryCommand(config *config.Config, arguments []string) error {
+	if len(arguments) == 0 || arguments[0] == "list" {
+		response, err := admin.Request(config, "/admin/canary", nil)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(response))
+		return nil
+	}
+
+	action := arguments[0]
+	request := &flagRequest{}
+	switch {
+	case action == "rollback" && len(arguments) == 2:
+		request.Handler = arguments[1]
+	case action == "start" && len(arguments) == 4:
+		percent, err := strconv.Atoi(strings.TrimSuffix(arguments[3], "%"))
+		if err != nil {
+			return fmt.Errorf("[XServer] [Canary] [Error] invalid percent: %s", err)
+		}
+		request.Handler = arguments[1]
+		request.Variant = arguments[2]
+		request.Percent = percent
+	default:
+		usage()
+		return nil
+	}
+
+	response, err := admin.Request(config, "/admin/canary/"+action, request)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(response))
+	return nil
+}
+
+// offlineUnits creates handlers outside of the running server, notifications are disabled.
+func offlineUnits(unitsConfig *config.Config) (*runningUnits, func(), error) {
+	quietConfig := *unitsConfig
+	quietConfig.Notifications = config.Notifications{HandlerErrorsWindow: unitsConfig.Notifications.HandlerErrorsWindow}
+	alerts, err := notifications.Create(&quietConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pool, err := workers.Create(&unitsConfig.Workers)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[XServer] [Config] [Error] failed parse workers queue timeout: %s", err)
+	}
+
+	gpus, err := devices.Create(unitsConfig.Workers.Gpus)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[XServer] [Config] [Error] failed parse workers gpus queue timeout: %s", err)
+	}
+
+	var storage *database.Database
+	if unitsConfig.Database.Enable {
+		if storage, err = database.Create(unitsConfig); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	handlersFlags, err := flags.Create(nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	units := newRunningUnits(unitsConfig, storage, pool, gpus, alerts, nil, handlersFlags, nil, nil, nil, nil, nil, nil, nil)
+	return units, func() {
+		units.Stop()
+		if storage != nil {
+			storage.Close()
+		}
+	}, nil
+}
+
+func truncateBody(body []byte) string {
+	const maxLength = 200
+	text := strings.TrimSpace(string(body))
+	if len(text) > maxLength {
+		return text[:maxLength] + "..."
+	}
+	return text
+}
+
+func diffCommand(config *config.Config, arguments []string) error {
+	parsed, err := parseArguments(arguments)
+	if err != nil {
+		return err
+	}
+	handlersNames := parsed.Positional
+	requestsPath := parsed.String("--requests", "")
+	if len(handlersNames) != 2 || requestsPath == "" {
+		usage()
+		return nil
+	}
+
+	requests, err := recording.ReadFile(requestsPath)
+	if err != nil {
+		return err
+	}
+
+	units, stop, err := offlineUnits(config)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	handlers := []http.HandlerFunc{}
+	for _, handlerName := range handlersNames {
+		handler, ok := config.Handlers[handlerName]
+		if !ok {
+			return fmt.Errorf(`[XServer] [Diff] [Error] unknown handler "%s"`, handlerName)
+		}
+		handlerFunc, stopHandler, err := units.createHandler(handlerName, handler)
+		if err != nil {
+			return err
+		}
+		defer stopHandler()
+		handlers = append(handlers, handlerFunc)
+	}
+
+	differences := 0
+	for index, request := range requests {
+		responses := []*mirror.Recorder{}
+		for _, handlerFunc := range handlers {
+			httpRequest, err := request.HttpRequest("http://" + config.Url)
+			if err != nil {
+				return err
+			}
+			response := mirror.NewRecorder()
+			handlerFunc(response, httpRequest)
+			responses = append(responses, response)
+		}
+
+		first, second := responses[0], responses[1]
+		result := mirror.Compare(first.Status, first.Body.Bytes(), second.Status, second.Body.Bytes())
+		if len(result) == 0 {
+			continue
+		}
+
+		differences++
+		fmt.Printf("[XServer] [Diff] request %d %s %s: %s\n", index+1, request.Method, request.Path, strings.Join(result, ", "))
+		fmt.Printf("\t%s: %d %s\n", handlersNames[0], first.Status, truncateBody(first.Body.Bytes()))
+		fmt.Printf("\t%s: %d %s\n", handlersNames[1], second.Status, truncateBody(second.Body.Bytes()))
+	}
+
+	fmt.Printf("[XServer] [Diff] %d requests, %d differences\n", len(requests), differences)
+	if differences != 0 {
+		return fmt.Errorf("[XServer] [Diff] [Error] responses of %s and %s differ", handlersNames[0], handlersNames[1])
+	}
+	return nil
+}
+
+func replayRequests(replayConfig *config.Config, source string, handler string) ([]recording.Request, error) {
+	if source != config.RecordingDatabase {
+		requests, err := recording.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+		filtered := []recording.Request{}
+		for _, request := range requests {
+			if handler == "" || request.Handler == handler {
+				filtered = append(filtered, request)
+			}
+		}
+		return filtered, nil
+	}
+
+	if !replayConfig.Database.Enable {
+		return nil, fmt.Errorf("[XServer] [Replay] [Error] database is disabled")
+	}
+	storage, err := database.Create(replayConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer storage.Close()
+
+	lines, err := storage.Recordings(handler)
+	if err != nil {
+		return nil, err
+	}
+	return recording.Read(strings.NewReader(strings.Join(lines, "\n")))
+}
+
+func replayCommand(config *config.Config, arguments []string) error {
+	parsed, err := parseArguments(arguments)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) != 1 {
+		usage()
+		return nil
+	}
+	source := parsed.Positional[0]
+	target := parsed.String("--target", config.Scheme()+"://"+config.Url)
+	handler := parsed.String("--handler", "")
+
+	requests, err := replayRequests(config, source, handler)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	failed := 0
+	for index, request := range requests {
+		httpRequest, err := request.HttpRequest(target)
+		if err != nil {
+			return err
+		}
+
+		response, err := client.Do(httpRequest)
+		if err != nil {
+			failed++
+			fmt.Printf("[XServer] [Replay] request %d %s %s: %s\n", index+1, request.Method, request.Path, err)
+			continue
+		}
+		io.Copy(io.Discard, response.Body)
+		response.Body.Close()
+		if response.StatusCode >= http.StatusInternalServerError {
+			failed++
+		}
+		fmt.Printf("[XServer] [Replay] request %d %s %s: %d\n", index+1, request.Method, request.Path, response.StatusCode)
+	}
+
+	fmt.Printf("[XServer] [Replay] %d requests, %d failed\n", len(requests), failed)
+	return nil
+}
+
+func faultsCommand(config *config.Config, arguments []string) error {
+	if len(arguments) == 0 || arguments[0] == "list" {
+		response, err := admin.Request(config, "/admin/faults", nil)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(response))
+		return nil
+	}
+
+	if (arguments[0] != "enable" && arguments[0] != "disable") || len(arguments) != 2 {
+		usage()
+		return nil
+	}
+
+	response, err := admin.Request(config, "/admin/faults/"+arguments[0], &faults.Fault{Handler: arguments[1]})
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(response))
+	return nil
+}
+
+type quarantineRequest struct {
+	Handler string `json:"handler"`
+}
+
+func quarantineCommand(config *config.Config, arguments []string) error {
+	if len(arguments) == 0 || arguments[0] == "list" {
+		response, err := admin.Request(config, "/admin/quarantine", nil)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(response))
+		return nil
+	}
+
+	if arguments[0] != "release" || len(arguments) != 2 {
+		usage()
+		return nil
+	}
+
+	response, err := admin.Request(config, "/admin/quarantine/release", &quarantineRequest{Handler: arguments[1]})
+	if err != nil {
+		return err
 	}
-	configPath        = "./config.yml"
-	handlersFilesPath = "bin/handlers/"
-	tasksFilesPath    = "bin/tasks/"
+	fmt.Println(string(response))
+	return nil
+}
 
-	languagesBuildCommands = map[string]func(string, string, ...string) error{
-		".go":  builders.Go,
-		".c":   builders.Cpp,
-		".cpp": builders.Cpp,
-	}
-	languagesRunCommands = map[string]func(string, io.Writer, io.Reader, func(string, error), func(string), ...string){
-		".go":  runners.Executable,
-		".c":   runners.Executable,
-		".cpp": runners.Executable,
-		".py":  runners.Python,
-		".lua": runners.Lua,
+func sloCommand(config *config.Config, arguments []string) error {
+	if len(arguments) != 0 {
+		usage()
+		return nil
 	}
-)
 
-func buildUnits(unitTag string, unitsFilesPath string, units map[string]config.ExecutableServerUnit) error {
-	if err := os.RemoveAll(unitsFilesPath); err != nil {
-		return fmt.Errorf("[XServer] [Build] [%s] [Error] failed delete file directory: %s", unitTag, err)
+	response, err := admin.Request(config, "/admin/slo", nil)
+	if err != nil {
+		return err
 	}
+	fmt.Println(string(response))
+	return nil
+}
 
-	if err := os.MkdirAll(unitsFilesPath, os.ModePerm); err != nil {
-		return fmt.Errorf("[XServer] [Build] [%s] [Error] failed create file directory: %s", unitTag, err)
+func tracesCommand(config *config.Config, arguments []string) error {
+	parsed, err := parseArguments(arguments)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) > 1 {
+		usage()
+		return nil
+	}
+	parameters := url.Values{}
+	if len(parsed.Positional) == 1 {
+		parameters.Set("handler", parsed.Positional[0])
+	}
+	if parsed.Bool("--failed") {
+		parameters.Set("failed", "true")
 	}
 
-	for unitName, unit := range units {
-		logger.Info(fmt.Sprintf(`[XServer] [Build] [%s] build "%s"`, unitTag, unitName))
-		if err := os.MkdirAll(path.Join(unitsFilesPath, unitName), os.ModePerm); err != nil {
-			return fmt.Errorf("[XServer] [Build] [%s] [Error] failed create file directory: %s", unitTag, err)
-		}
+	response, err := admin.Request(config, "/admin/traces?"+parameters.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(response))
+	return nil
+}
 
-		if unit.Build != nil && unit.Build.Tool != "" {
-			logger.Info(fmt.Sprintf(`[XServer] [Build] [%s] "%s" has specified build options -> build by options`, unitTag, unitName))
-			if err := builders.Tool(unit.Build.Tool, unit.File, path.Join(unitsFilesPath, unitName, "executable"), unit.Build.Flags...); err != nil {
-				logger.Error(fmt.Sprintf(`[XServer] [Build] [%s] [Error] failed compile "%s": %s`, unitTag, unitName, err))
-			}
-			continue
-		}
+func hostCommand(config *config.Config, arguments []string) error {
+	if len(arguments) != 0 {
+		usage()
+		return nil
+	}
 
-		buildCommand, ok := languagesBuildCommands[path.Ext(unit.File)]
+	response, err := admin.Request(config, "/admin/host", nil)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(response))
+	return nil
+}
 
-		if ok {
-			flags := []string{}
-			if unit.Build != nil {
-				flags = unit.Build.Flags
-			}
-			if err := buildCommand(unit.File, path.Join(unitsFilesPath, unitName, "executable"), flags...); err != nil {
-				logger.Error(fmt.Sprintf(`[XServer] [Build] [%s] [Error] failed compile "%s": %s`, unitTag, unitName, err))
-			}
-			continue
-		} else {
-			if err := utils.CopyFile(unit.File, path.Join(unitsFilesPath, unitName, path.Base(unit.File))); err != nil {
-				logger.Error(fmt.Sprintf(`[XServer] [Build] [%s] [Error] failed copy "%s": %s`, unitTag, unitName, err))
-			}
+func usageCommand(config *config.Config, arguments []string) error {
+	parsed, err := parseArguments(arguments)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) > 1 {
+		usage()
+		return nil
+	}
+	parameters := url.Values{}
+	for _, name := range []string{"from", "to"} {
+		if value := parsed.String("--"+name, ""); value != "" {
+			parameters.Set(name, value)
 		}
 	}
+	if len(parsed.Positional) == 1 {
+		parameters.Set("key", parsed.Positional[0])
+	}
 
+	response, err := admin.Request(config, "/admin/usage?"+parameters.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(response))
 	return nil
 }
 
-func build(config *config.Config) error {
-	logger.Info("[XServer] [Build] Build project")
+func rebuildCommand(config *config.Config, arguments []string) error {
+	if len(arguments) != 1 {
+		usage()
+		return nil
+	}
+
+	response, err := admin.Request(config, "/admin/rebuild/"+arguments[0], nil)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(response))
+	return nil
+}
 
-	if err := buildUnits("Handlers", handlersFilesPath, config.Handlers); err != nil {
+func initCommand(config *config.Config, arguments []string) error {
+	parsed, err := parseArguments(arguments)
+	if err != nil {
 		return err
 	}
+	if len(parsed.Positional) > 1 {
+		usage()
+		return nil
+	}
+	directory := defaultSdkPath
+	if len(parsed.Positional) == 1 {
+		directory = parsed.Positional[0]
+	}
+	withSdk := parsed.Bool("--sdk")
 
-	if err := buildUnits("Tasks", tasksFilesPath, config.Tasks); err != nil {
+	files, err := sdk.Generate(directory, withSdk)
+	if err != nil {
 		return err
 	}
 
+	for _, file := range files {
+		fmt.Printf("[XServer] [Init] generated %s\n", file)
+	}
 	return nil
 }
 
-func getUnitRunCommand(unitTag string, unitsFilesPath string, unitName string, unit config.ExecutableServerUnit) (func(io.Writer, io.Reader), error) {
-	_, stdBuilded := languagesBuildCommands[path.Ext(unit.File)]
-	builded := stdBuilded || (unit.Build != nil)
-	unitExecutablePath := path.Join(unitsFilesPath, unitName, path.Base(unit.File))
-	if builded {
-		unitExecutablePath = path.Join(unitsFilesPath, unitName, "executable")
+func unitTools(unit config.ExecutableServerUnit) []string {
+	if unit.Mock != nil || unit.Report != nil || (unit.Run != nil && unit.Run.Engine == engines.EngineEmbedded) {
+		return []string{}
+	}
+	if unit.Run != nil && unit.Run.Engine == plugins.EnginePlugin {
+		return []string{unit.Toolchain("go")}
 	}
 
-	runCommand := languagesRunCommands[path.Ext(unit.File)]
+	tools := []string{}
+	language, custom := languagesTemplates[filepath.Ext(unit.File)]
+	if unit.Build != nil && unit.Build.Tool != "" {
+		tools = append(tools, unit.Build.Tool)
+	} else if custom && language.Build != "" {
+		tools = append(tools, strings.Fields(language.Build)[0])
+	} else if tool, ok := languagesBuildTools[filepath.Ext(unit.File)]; ok {
+		tools = append(tools, unit.Toolchain(tool))
+	}
 
 	if unit.Run != nil && unit.Run.Tool != "" {
-		runCommand = func(path string, writer io.Writer, request io.Reader, errorCallback func(string, error), logCallback func(string), args ...string) {
-			runners.Tool(unit.Run.Tool, path, writer, request, errorCallback, logCallback, args...)
+		tools = append(tools, unit.Run.Tool)
+	} else if custom && language.Run != "" {
+		tools = append(tools, strings.Fields(language.Run)[0])
+	} else if tool, ok := languagesTools[filepath.Ext(unit.File)]; ok {
+		tools = append(tools, unit.Toolchain(tool[0]))
+	}
+
+	return tools
+}
+
+func checkUnits(unitTag string, units map[string]config.ExecutableServerUnit, requiredTools map[string][]string, results *[]doctor.Result) bool {
+	usesPlugins := false
+	for unitName, unit := range units {
+		for _, tool := range unitTools(unit) {
+			requiredTools[tool] = append(requiredTools[tool], fmt.Sprintf(`%s "%s"`, unitTag, unitName))
+		}
+		if unit.Mock != nil || unit.Report != nil {
+			continue
+		}
+		if unit.Git != nil {
+			requiredTools["git"] = append(requiredTools["git"], fmt.Sprintf(`%s "%s"`, unitTag, unitName))
+		} else if _, err := os.Stat(unit.File); err != nil {
+			*results = append(*results, doctor.Result{
+				Name:  fmt.Sprintf(`%s "%s" file`, unitTag, unitName),
+				Error: err,
+				Fix:   fmt.Sprintf("create %s or fix file path in config", unit.File),
+			})
 		}
+		usesPlugins = usesPlugins || (unit.Run != nil && unit.Run.Engine == plugins.EnginePlugin)
 	}
+	return usesPlugins
+}
 
-	if runCommand == nil {
-		if builded {
-			runCommand = runners.Executable
-		} else {
-			return nil, fmt.Errorf(fmt.Sprintf("[XServer] [%s %s] [Error] run command is unknown", unitName, unitTag))
+func doctorCommand(config *config.Config, arguments []string) error {
+	results := []doctor.Result{}
+
+	requiredTools := map[string][]string{}
+	usesPlugins := checkUnits("handler", config.Handlers, requiredTools, &results)
+	usesPlugins = checkUnits("task", config.Tasks, requiredTools, &results) || usesPlugins
+
+	tools := []string{}
+	for _, doctorTool := range doctorTools {
+		tools = append(tools, config.Toolchain(doctorTool))
+	}
+	for tool := range requiredTools {
+		known := false
+		for _, doctorTool := range doctorTools {
+			known = known || config.Toolchain(doctorTool) == tool
+		}
+		if !known {
+			tools = append(tools, tool)
 		}
 	}
+	sort.Strings(tools[len(doctorTools):])
 
-	args := []string{}
-	if unit.Run != nil {
-		args = unit.Run.Args
+	for _, tool := range tools {
+		units, required := requiredTools[tool]
+		sort.Strings(units)
+		version, err := doctor.ToolVersion(tool)
+		result := doctor.Result{Name: "tool " + tool, Info: version}
+		if err != nil && required {
+			result.Error = fmt.Errorf("not found, required by %s", strings.Join(units, ", "))
+			result.Fix = fmt.Sprintf("install %s or set full path of the tool in toolchains", tool)
+		} else if err != nil {
+			result.Warning = "not found, not required by units"
+		}
+		results = append(results, result)
 	}
 
-	return func(writer io.Writer, request io.Reader) {
-		runCommand(
-			unitExecutablePath,
-			writer,
-			request,
-			func(message string, err error) {
-				message = fmt.Sprintf(`{ "error": "[XServer] [%s %s] [Error] %s: %s" }`, unitName, unitTag, message, strings.ReplaceAll(err.Error(), `"`, `\"`))
-				logger.Error(message)
-				writer.Write([]byte(message + "\n"))
-			},
-			func(message string) {
-				logger.Verbose(fmt.Sprintf("[XServer] [%s %s] %s", unitName, unitTag, message))
-			},
-			args...,
-		)
-	}, nil
+	if usesPlugins {
+		result := doctor.Result{Name: "plugins go version", Info: runtime.Version()}
+		output, err := exec.Command(config.Toolchain("go"), "env", "GOVERSION").Output()
+		if err != nil {
+			result.Error = fmt.Errorf("failed get go version: %s", err)
+			result.Fix = "install go " + runtime.Version()
+		} else if version := strings.TrimSpace(string(output)); version != runtime.Version() {
+			result.Error = fmt.Errorf("go %s does not match go %s the server is built with", version, runtime.Version())
+			result.Fix = fmt.Sprintf("install go %s or rebuild xserver with go %s", runtime.Version(), version)
+		}
+		results = append(results, result)
+	}
+
+	directories := []string{config.Build.OutputDir, filepath.Dir(config.State)}
+	if config.LogPath != "" {
+		directories = append(directories, filepath.Dir(config.LogPath))
+	}
+	if config.Database.Enable {
+		directories = append(directories, filepath.Dir(config.Database.Storage))
+	}
+	checkedDirectories := map[string]bool{}
+	for _, directory := range directories {
+		if checkedDirectories[directory] {
+			continue
+		}
+		checkedDirectories[directory] = true
+
+		result := doctor.Result{Name: "write access to " + directory}
+		if err := doctor.Writable(directory); err != nil {
+			result.Error = err
+			result.Fix = "grant write permissions to the user running xserver"
+		}
+		results = append(results, result)
+	}
+
+	if config.Database.Enable {
+		result := doctor.Result{Name: "database schema " + config.Database.Schema}
+		if _, err := os.Stat(config.Database.Schema); err != nil {
+			result.Error = err
+			result.Fix = "create schema file or set database.schema"
+		}
+		results = append(results, result)
+	}
+
+	result := doctor.Result{Name: "listen " + config.Url}
+	if err := doctor.PortAvailable(config.Url); err != nil {
+		result.Error = err
+		result.Fix = "stop the process using the port or change url"
+	}
+	results = append(results, result)
+
+	if !doctor.Report(os.Stdout, results) {
+		return fmt.Errorf("[XServer] [Doctor] [Error] some checks failed")
+	}
+	return nil
 }
 
-func start(config *config.Config) error {
-	logger.Info("[XServer] Start project")
+func migrateConfigCommand(_ *config.Config, arguments []string) error {
+	path := configPath
+	if len(arguments) != 0 {
+		path = arguments[0]
+	}
 
-	for handlerName, handler := range config.Handlers {
-		currentHandlerName := handlerName
-		currentHandler := handler
+	version, err := config.Migrate(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("[Config] [Migrate] config %s has version %d\n", path, version)
+	return nil
+}
 
-		runCommand, err := getUnitRunCommand("Handler", handlersFilesPath, currentHandlerName, currentHandler)
+func configCommand(_ *config.Config, arguments []string) error {
+	if len(arguments) == 0 {
+		usage()
+		return nil
+	}
 
+	if arguments[0] == "defaults" {
+		profile := config.ProfileDefault
+		if len(arguments) == 3 && arguments[1] == "--profile" {
+			profile = arguments[2]
+		} else if len(arguments) != 1 {
+			usage()
+			return nil
+		}
+		defaults, err := config.Defaults(profile)
 		if err != nil {
-			logger.Error(err.Error())
-			continue
+			return err
 		}
+		fmt.Print(string(defaults))
+		return nil
+	}
 
-		server.AddHandler(
-			currentHandler.Path,
-			func(writer http.ResponseWriter, request *http.Request) {
-				logger.Verbose(fmt.Sprintf("[XServer] [%s Handler] handler called", currentHandlerName))
-				runCommand(writer, request.Body)
-			},
-		)
+	if arguments[0] == "get" || arguments[0] == "set" {
+		loaded, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		return runtimeConfigCommand(loaded, arguments)
 	}
 
-	cron := cron.New()
-	for taskName, task := range config.Tasks {
-		currentTaskName := taskName
-		currentTask := task
+	if arguments[0] == "key" {
+		key, err := config.GenerateKey()
+		if err != nil {
+			return fmt.Errorf("[Config] [Error] failed generate master key: %s", err)
+		}
+		fmt.Println(key)
+		return nil
+	}
 
-		runCommand, err := getUnitRunCommand("Task", tasksFilesPath, currentTaskName, currentTask)
+	path := configPath
+	fields := []string{}
+	for index := 1; index < len(arguments); index++ {
+		switch {
+		case arguments[0] == "encrypt" && arguments[index] == "--field" && index+1 < len(arguments):
+			fields = append(fields, arguments[index+1])
+			index++
+		case !strings.HasPrefix(arguments[index], "-"):
+			path = arguments[index]
+		default:
+			usage()
+			return nil
+		}
+	}
 
+	switch arguments[0] {
+	case "encrypt":
+		paths, err := config.Encrypt(path, fields)
 		if err != nil {
-			logger.Error(err.Error())
-			continue
+			return err
 		}
-
-		cron.AddFunc(
-			currentTask.Period,
-			func() {
-				if task.LogsEnable {
-					logger.Verbose(fmt.Sprintf("[XServer] [%s Task] task started", currentTaskName))
-				}
-				outBuffer := &bytes.Buffer{}
-				runCommand(outBuffer, &bytes.Buffer{})
-				if task.LogsEnable {
-					logger.Info(fmt.Sprintf("[XServer] [%s Task] returned: %s", currentTaskName, outBuffer.String()))
-				}
-			},
-		)
+		fmt.Printf("[Config] [Encrypt] encrypted %d values of %s: %s\n", len(paths), path, strings.Join(paths, ", "))
+	case "decrypt":
+		paths, err := config.Decrypt(path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("[Config] [Decrypt] decrypted %d values of %s: %s\n", len(paths), path, strings.Join(paths, ", "))
+	default:
+		usage()
 	}
+	return nil
+}
 
-	if config.Database.Enable {
-		database, err := database.Create(config)
+func runtimeConfigCommand(config *config.Config, arguments []string) error {
+	if arguments[0] == "get" && len(arguments) <= 2 {
+		key := ""
+		if len(arguments) == 2 {
+			key = arguments[1]
+		}
+		response, err := admin.Request(config, "/admin/config?"+url.Values{"key": {key}}.Encode(), nil)
 		if err != nil {
-			logger.Error(err.Error())
 			return err
 		}
-		defer database.Close()
+		fmt.Println(string(response))
+		return nil
+	}
 
-		server.AddHandler(
-			"/db/insert",
-			func(writer http.ResponseWriter, request *http.Request) {
-				if err := database.Insert(request.Body, writer); err != nil {
-					logger.Error(err.Error())
-					writer.Write([]byte(fmt.Sprintf(`{"result": false, "error": "%s"}`, strings.ReplaceAll(err.Error(), `"`, `\"`)) + "\n"))
-				}
-			},
-		)
+	if arguments[0] != "set" || len(arguments) < 3 || len(arguments) > 4 || (len(arguments) == 4 && arguments[3] != "--save") {
+		usage()
+		return nil
+	}
 
-		server.AddHandler(
-			"/db/select",
-			func(writer http.ResponseWriter, request *http.Request) {
-				if err := database.Select(request.Body, writer); err != nil {
-					logger.Error(err.Error())
-					writer.Write([]byte(fmt.Sprintf(`{"result": [], "error": "%s"}`, strings.ReplaceAll(err.Error(), `"`, `\"`)) + "\n"))
-				}
-			},
-		)
+	response, err := admin.Request(config, "/admin/config/set", &settingRequest{Key: arguments[1], Value: arguments[2], Save: len(arguments) == 4})
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(response))
+	return nil
+}
 
-		server.AddHandler(
-			"/db/update",
-			func(writer http.ResponseWriter, request *http.Request) {
-				if err := database.Update(request.Body, writer); err != nil {
-					logger.Error(err.Error())
-					writer.Write([]byte(fmt.Sprintf(`{"result": false, "error": "%s"}`, strings.ReplaceAll(err.Error(), `"`, `\"`)) + "\n"))
-				}
-			},
-		)
+func loadConfig() (*config.Config, error) {
+	config, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
 
-		server.AddHandler(
-			"/db/delete",
-			func(writer http.ResponseWriter, request *http.Request) {
-				if err := database.Delete(request.Body, writer); err != nil {
-					logger.Error(err.Error())
-					writer.Write([]byte(fmt.Sprintf(`{"result": false, "error": "%s"}`, strings.ReplaceAll(err.Error(), `"`, `\"`)) + "\n"))
-				}
-			},
-		)
+	for extension, language := range config.Languages {
+		languagesTemplates[extension] = language
+	}
+	handlersFilesPath = config.HandlersOutputDir()
+	tasksFilesPath = config.TasksOutputDir()
+	sourcesFilesPath = config.SourcesOutputDir()
 
-		server.AddHandler(
-			"/db/set_schema",
-			func(writer http.ResponseWriter, request *http.Request) {
-				if err := database.SetSchema(request.Body); err != nil {
-					logger.Error(err.Error())
-					writer.Write([]byte(fmt.Sprintf(`{"result": false, "error": "%s"}`, strings.ReplaceAll(err.Error(), `"`, `\"`)) + "\n"))
-					return
-				}
-				writer.Write([]byte(`{"result": true}`))
-			},
-		)
+	if err := logger.Configure(config); err != nil {
+		return nil, err
 	}
+	problem.Configure(config.Errors)
+	scheduler.Configure(config.CronFormat)
 
-	server.AddHandler(
-		"/status",
-		func(writer http.ResponseWriter, request *http.Request) {
-			writer.Write([]byte("OK"))
-		},
-	)
+	return config, nil
+}
 
-	cron.Start()
-	defer cron.Stop()
+func serviceCommand(_ *config.Config, arguments []string) error {
+	if len(arguments) == 0 {
+		return fmt.Errorf("[XServer] [Service] [Error] action is not specified, expected install, uninstall or run")
+	}
 
-	err := server.Start(config)
-	if err != nil {
-		return err
+	name := defaultServiceName
+	if len(arguments) > 1 {
+		name = arguments[1]
 	}
-	return nil
+
+	switch arguments[0] {
+	case "install":
+		directory, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("[XServer] [Service] [Error] failed get working directory: %s", err)
+		}
+		if err := service.Install(name, directory); err != nil {
+			return err
+		}
+		fmt.Printf("[XServer] [Service] installed \"%s\" service for %s\n", name, directory)
+		return nil
+	case "uninstall":
+		if err := service.Uninstall(name); err != nil {
+			return err
+		}
+		fmt.Printf("[XServer] [Service] uninstalled \"%s\" service\n", name)
+		return nil
+	case "run":
+		if len(arguments) > 2 {
+			if err := os.Chdir(arguments[2]); err != nil {
+				return fmt.Errorf("[XServer] [Service] [Error] failed change working directory: %s", err)
+			}
+		}
+		return service.Run(name, func() error {
+			config, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if err := start(config, nil); err != nil {
+				logger.Error(err.Error())
+				return err
+			}
+			return nil
+		}, server.Shutdown)
+	}
+
+	return fmt.Errorf(`[XServer] [Service] [Error] unknown action "%s"`, arguments[0])
 }
 
-func usage() {
-	fmt.Println("usage: xserver <command>")
-	fmt.Println("\tcommands:")
-	fmt.Println("\t\tbuild: compiles all handlers and tasks")
-	fmt.Println("\t\tstart: start server")
+// verbosityFlags removes -v, -vv and --quiet flags from arguments and sets the console output level by them.
+func verbosityFlags(arguments []string) []string {
+	result := []string{}
+	for _, argument := range arguments {
+		switch argument {
+		case "-v", "--verbose":
+			logger.SetVerbosity(1)
+		case "-vv":
+			logger.SetVerbosity(2)
+		case "-q", "--quiet":
+			logger.SetVerbosity(-1)
+		default:
+			result = append(result, argument)
+		}
+	}
+	return result
 }
 
 func main() {
-	arguments := os.Args
+	arguments := verbosityFlags(os.Args)
 	if (len(arguments)) == 1 {
 		usage()
 		return
 	}
-	command, ok := commands[arguments[1]]
+
+	switch arguments[1] {
+	case cli.HelpCommand:
+		if len(arguments) == 3 {
+			if command, ok := commandLine.Find(arguments[2]); ok {
+				commandLine.Select(command)
+			}
+		}
+		usage()
+		return
+	case cli.CompleteCommand:
+		for _, candidate := range commandLine.Complete(arguments[2:], completionValues()) {
+			fmt.Println(candidate)
+		}
+		return
+	}
+
+	command, ok := commandLine.Find(arguments[1])
 	if !ok {
+		fmt.Printf("[XServer] [Error] unknown command \"%s\"\n", arguments[1])
+		usage()
+		os.Exit(1)
+	}
+	commandLine.Select(command)
+	if cli.HelpRequested(arguments[2:]) {
 		usage()
 		return
 	}
 
-	config, err := config.Load(configPath)
-	if err != nil {
-		fmt.Println(err)
+	if command.WithoutConfig {
+		if err := command.Run(nil, arguments[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 		return
 	}
 
-	if err := logger.Configure(config); err != nil {
+	config, err := loadConfig()
+	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
-	if err := command(config); err != nil {
+	err = command.Run(config, arguments[2:])
+	logger.Flush()
+	if err != nil {
 		fmt.Println(err)
-		return
+		os.Exit(1)
 	}
 
 }
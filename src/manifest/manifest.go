@@ -0,0 +1,219 @@
+package manifest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	stagingPrefix = ".rebuild-"
+)
+
+type Manifest struct {
+	Files     map[string]string `json:"files"`
+	Signature string            `json:"signature"`
+}
+
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Create computes checksums of all files in the subdirectories of the build directory.
+func Create(directory string, subdirectories ...string) (*Manifest, error) {
+	manifest := &Manifest{Files: map[string]string{}}
+	for _, subdirectory := range subdirectories {
+		root := filepath.Join(directory, subdirectory)
+		if _, err := os.Stat(root); os.IsNotExist(err) {
+			continue
+		}
+
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				if strings.HasPrefix(entry.Name(), stagingPrefix) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			relative, err := filepath.Rel(directory, path)
+			if err != nil {
+				return err
+			}
+			checksum, err := fileChecksum(path)
+			if err != nil {
+				return err
+			}
+			manifest.Files[filepath.ToSlash(relative)] = checksum
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("[XServer] [Manifest] [Error] failed compute checksums: %s", err)
+		}
+	}
+	return manifest, nil
+}
+
+func (manifest *Manifest) payload() []byte {
+	data, _ := json.Marshal(manifest.Files)
+	return data
+}
+
+func (manifest *Manifest) Sign(key ed25519.PrivateKey) {
+	manifest.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifest.payload()))
+}
+
+func (manifest *Manifest) VerifySignature(key ed25519.PublicKey) error {
+	signature, err := base64.StdEncoding.DecodeString(manifest.Signature)
+	if err != nil || !ed25519.Verify(key, manifest.payload(), signature) {
+		return fmt.Errorf("[XServer] [Manifest] [Error] invalid manifest signature")
+	}
+	return nil
+}
+
+// Verify compares checksums of the build directory with the manifest and lists changed, missing and unexpected files.
+func (manifest *Manifest) Verify(directory string, subdirectories ...string) error {
+	current, err := Create(directory, subdirectories...)
+	if err != nil {
+		return err
+	}
+
+	mismatched := []string{}
+	for path, checksum := range manifest.Files {
+		currentChecksum, ok := current.Files[path]
+		if !ok {
+			mismatched = append(mismatched, path+" (missing)")
+		} else if currentChecksum != checksum {
+			mismatched = append(mismatched, path+" (changed)")
+		}
+	}
+	for path := range current.Files {
+		if _, ok := manifest.Files[path]; !ok {
+			mismatched = append(mismatched, path+" (unexpected)")
+		}
+	}
+
+	if len(mismatched) != 0 {
+		sort.Strings(mismatched)
+		return fmt.Errorf("[XServer] [Manifest] [Error] build does not match manifest: %s", strings.Join(mismatched, ", "))
+	}
+	return nil
+}
+
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Manifest] [Error] failed read manifest: %s", err)
+	}
+
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("[XServer] [Manifest] [Error] failed parse manifest: %s", err)
+	}
+	return manifest, nil
+}
+
+func (manifest *Manifest) Save(path string) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("[XServer] [Manifest] [Error] failed encode manifest: %s", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("[XServer] [Manifest] [Error] failed write manifest: %s", err)
+	}
+	return nil
+}
+
+func readPem(path string, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Manifest] [Error] failed read key: %s", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf(`[XServer] [Manifest] [Error] key "%s" is not a %s pem block`, path, blockType)
+	}
+	return block.Bytes, nil
+}
+
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := readPem(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Manifest] [Error] failed parse private key: %s", err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("[XServer] [Manifest] [Error] private key is not ed25519 key")
+	}
+	return privateKey, nil
+}
+
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := readPem(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Manifest] [Error] failed parse public key: %s", err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("[XServer] [Manifest] [Error] public key is not ed25519 key")
+	}
+	return publicKey, nil
+}
+
+// GenerateKeys writes a new ed25519 key pair in pem format, the private key is readable by the owner only.
+func GenerateKeys(privatePath string, publicPath string) error {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Manifest] [Error] failed generate keys: %s", err)
+	}
+
+	privateData, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Manifest] [Error] failed encode private key: %s", err)
+	}
+	publicData, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Manifest] [Error] failed encode public key: %s", err)
+	}
+
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateData}), 0600); err != nil {
+		return fmt.Errorf("[XServer] [Manifest] [Error] failed write private key: %s", err)
+	}
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicData}), 0644); err != nil {
+		return fmt.Errorf("[XServer] [Manifest] [Error] failed write public key: %s", err)
+	}
+	return nil
+}
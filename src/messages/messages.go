@@ -0,0 +1,114 @@
+package messages
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Message is the text split from its bracketed prefixes, e.g. "[XServer] [users Handler] [Error] failed" has
+// the scope ["XServer", "users Handler"], the "error" level and the "failed" text.
+type Message struct {
+	Scope []string
+	Level string
+	Text  string
+}
+
+// Split parses the leading bracketed prefixes of the text, [Error] and [Warning] prefixes are the level.
+func Split(text string) Message {
+	message := Message{Scope: []string{}}
+	rest := text
+	for strings.HasPrefix(rest, "[") {
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			break
+		}
+		prefix := rest[1:end]
+		switch prefix {
+		case "Error", "Warning":
+			message.Level = strings.ToLower(prefix)
+		default:
+			message.Scope = append(message.Scope, prefix)
+		}
+		rest = strings.TrimLeft(rest[end+1:], " ")
+	}
+	message.Text = rest
+	return message
+}
+
+// Catalog is the messages of error codes by language, messages are text/template templates.
+type Catalog struct {
+	language  string
+	templates map[string]map[string]*template.Template
+}
+
+// NewCatalog parses messages of languages, the language is the default one of requests without Accept-Language.
+func NewCatalog(language string, messages map[string]map[string]string) (*Catalog, error) {
+	catalog := &Catalog{language: strings.ToLower(language), templates: map[string]map[string]*template.Template{}}
+	for messagesLanguage, codes := range messages {
+		templates := map[string]*template.Template{}
+		for code, text := range codes {
+			parsed, err := template.New(code).Option("missingkey=zero").Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf(`invalid "%s" message of "%s" language: %s`, code, messagesLanguage, err)
+			}
+			templates[code] = parsed
+		}
+		catalog.templates[strings.ToLower(messagesLanguage)] = templates
+	}
+	return catalog, nil
+}
+
+// Negotiate returns the language of the catalog preferred by the Accept-Language header or the default one.
+func (catalog *Catalog) Negotiate(acceptLanguage string) string {
+	type preference struct {
+		tag     string
+		quality float64
+	}
+	preferences := []preference{}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, parameters, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(parameters), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if quality > 0 {
+			preferences = append(preferences, preference{tag: strings.ToLower(tag), quality: quality})
+		}
+	}
+	sort.SliceStable(preferences, func(i, j int) bool { return preferences[i].quality > preferences[j].quality })
+
+	for _, preference := range preferences {
+		if preference.tag == "*" {
+			return catalog.language
+		}
+		primary, _, _ := strings.Cut(preference.tag, "-")
+		for _, tag := range []string{preference.tag, primary} {
+			if _, ok := catalog.templates[tag]; ok || tag == catalog.language {
+				return tag
+			}
+		}
+	}
+	return catalog.language
+}
+
+// Format returns the message of the code in the language executed with the data, false without the message.
+func (catalog *Catalog) Format(language string, code string, data map[string]interface{}) (string, bool) {
+	message, ok := catalog.templates[language][code]
+	if !ok {
+		return "", false
+	}
+	buffer := &bytes.Buffer{}
+	if err := message.Execute(buffer, data); err != nil {
+		return "", false
+	}
+	return buffer.String(), true
+}
@@ -0,0 +1,409 @@
+package metering
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/database"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+	"xserver/src/problem"
+)
+
+const (
+	// Anonymous is the key of requests without the api key header.
+	Anonymous = "anonymous"
+
+	QuotaDaily   = "daily"
+	QuotaMonthly = "monthly"
+
+	dayLayout   = "2006-01-02"
+	flushPeriod = 10 * time.Second
+)
+
+func init() {
+	metrics.Register("xserver_api_requests_total", metrics.CounterType, "Number of handlers requests by api key.")
+	metrics.Register("xserver_api_quota_rejections_total", metrics.CounterType, "Number of handlers requests rejected by api keys and tenants quotas.")
+}
+
+// Quota is the usage within the current day and month, limits are 0 for unlimited quotas.
+type Quota struct {
+	Daily        int64 `json:"daily"`
+	DailyLimit   int64 `json:"daily_limit"`
+	Monthly      int64 `json:"monthly"`
+	MonthlyLimit int64 `json:"monthly_limit"`
+}
+
+type Key struct {
+	Key    string `json:"key"`
+	Tenant string `json:"tenant,omitempty"`
+	Quota
+}
+
+// exceeded returns the exceeded quota and its limit.
+func (quota *Quota) exceeded() (string, int64) {
+	switch {
+	case quota.DailyLimit > 0 && quota.Daily >= quota.DailyLimit:
+		return QuotaDaily, quota.DailyLimit
+	case quota.MonthlyLimit > 0 && quota.Monthly >= quota.MonthlyLimit:
+		return QuotaMonthly, quota.MonthlyLimit
+	}
+	return "", 0
+}
+
+type row struct {
+	key     string
+	handler string
+	day     string
+}
+
+type Meter struct {
+	config  *config.Config
+	secrets map[string]string
+	storage *database.Database
+	mutex   sync.Mutex
+	keys    map[string]*Key
+	tenants map[string]*Quota
+	day     string
+	month   string
+	// rows are counts not flushed to the database yet, all counts are kept in memory if the database is disabled.
+	rows map[row]int64
+	stop chan struct{}
+}
+
+func today() string {
+	return time.Now().UTC().Format(dayLayout)
+}
+
+// Create loads the usage of the current month from the database and flushes new requests counts to it periodically.
+func Create(config *config.Config, storage *database.Database) (*Meter, error) {
+	meter := &Meter{
+		config:  config,
+		secrets: map[string]string{},
+		storage: storage,
+		keys:    map[string]*Key{Anonymous: {Key: Anonymous}},
+		tenants: map[string]*Quota{},
+		day:     today(),
+		rows:    map[row]int64{},
+		stop:    make(chan struct{}),
+	}
+	meter.month = meter.day[:7]
+
+	for name, key := range config.ApiKeys.Keys {
+		secret := key.Secret()
+		if secret == "" {
+			return nil, fmt.Errorf(`[XServer] [Metering] [Error] empty key of "%s" api key, set %s environment variable`, name, key.KeyEnv)
+		}
+		if other, ok := meter.secrets[secret]; ok {
+			return nil, fmt.Errorf(`[XServer] [Metering] [Error] "%s" and "%s" api keys have the same key`, other, name)
+		}
+		meter.secrets[secret] = name
+		meter.keys[name] = &Key{Key: name, Tenant: key.Tenant, Quota: Quota{DailyLimit: key.Daily, MonthlyLimit: key.Monthly}}
+	}
+	for name, tenant := range config.Tenants {
+		meter.tenants[name] = &Quota{DailyLimit: tenant.Daily, MonthlyLimit: tenant.Monthly}
+	}
+
+	if storage == nil {
+		return meter, nil
+	}
+
+	stored, err := storage.Usage("", meter.month+"-01", meter.day)
+	if err != nil {
+		return nil, err
+	}
+	for _, each := range stored {
+		quotas := []*Quota{}
+		if key, ok := meter.keys[each.Key]; ok {
+			quotas = append(quotas, &key.Quota)
+		}
+		if tenant, ok := meter.tenants[config.Handlers[each.Handler].Tenant]; ok {
+			quotas = append(quotas, tenant)
+		}
+		for _, quota := range quotas {
+			quota.Monthly += each.Requests
+			if each.Day == meter.day {
+				quota.Daily += each.Requests
+			}
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(flushPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				meter.flush()
+			case <-meter.stop:
+				return
+			}
+		}
+	}()
+	return meter, nil
+}
+
+func (meter *Meter) quotas() []*Quota {
+	quotas := []*Quota{}
+	for _, key := range meter.keys {
+		quotas = append(quotas, &key.Quota)
+	}
+	for _, tenant := range meter.tenants {
+		quotas = append(quotas, tenant)
+	}
+	return quotas
+}
+
+// rollover resets daily and monthly counts of the previous day and month.
+func (meter *Meter) rollover() {
+	day := today()
+	if day == meter.day {
+		return
+	}
+	meter.day = day
+	for _, quota := range meter.quotas() {
+		quota.Daily = 0
+	}
+	if day[:7] != meter.month {
+		meter.month = day[:7]
+		for _, quota := range meter.quotas() {
+			quota.Monthly = 0
+		}
+	}
+}
+
+// retryAfter returns seconds until the exceeded quota is reset at UTC midnight.
+func retryAfter(quota string) int {
+	now := time.Now().UTC()
+	reset := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	if quota == QuotaMonthly {
+		reset = time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return int(reset.Sub(now).Seconds()) + 1
+}
+
+func contains(values []string, value string) bool {
+	for _, each := range values {
+		if each == value {
+			return true
+		}
+	}
+	return false
+}
+
+// identify returns the api key of the request, the problem is returned for unknown keys and missing required keys.
+func (meter *Meter) identify(request *http.Request, required bool) (*Key, *problem.Problem) {
+	header := meter.config.ApiKeys.Header
+	secret := request.Header.Get(header)
+	if secret == "" {
+		if required {
+			return nil, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, fmt.Sprintf("[XServer] [Metering] [Error] api key is required in %s header", header))
+		}
+		return meter.keys[Anonymous], nil
+	}
+	name, ok := meter.secrets[secret]
+	if !ok {
+		return nil, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, fmt.Sprintf("[XServer] [Metering] [Error] unknown api key in %s header", header))
+	}
+	return meter.keys[name], nil
+}
+
+// Reject identifies the api key of the handler request and counts the request.
+// Requests with unknown keys, without keys if keys are required, with keys not allowed by the handler api_keys, with keys of other tenants or exceeding key or tenant quotas are rejected.
+func (meter *Meter) Reject(handlerName string, writer http.ResponseWriter, request *http.Request) bool {
+	if meter == nil {
+		return false
+	}
+
+	key, rejection := meter.identify(request, meter.config.ApiKeys.Required)
+	if rejection != nil {
+		problem.Write(writer, request, rejection)
+		return true
+	}
+
+	if allowed := meter.config.Handlers[handlerName].ApiKeys; len(allowed) > 0 && !contains(allowed, key.Key) {
+		if key.Key == Anonymous {
+			problem.Write(writer, request, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, fmt.Sprintf("[XServer] [Metering] [Error] api key is required in %s header", meter.config.ApiKeys.Header)))
+		} else {
+			problem.Write(writer, request, problem.New(http.StatusForbidden, problem.CodeForbidden, fmt.Sprintf(`[XServer] [Metering] [Error] api key "%s" can't call "%s" handler`, key.Key, handlerName)))
+		}
+		return true
+	}
+
+	tenantName := meter.config.Handlers[handlerName].Tenant
+	if key.Tenant != "" && tenantName != "" && key.Tenant != tenantName {
+		problem.Write(writer, request, problem.New(http.StatusForbidden, problem.CodeForbidden, fmt.Sprintf(`[XServer] [Metering] [Error] api key of "%s" tenant can't call handler of "%s" tenant`, key.Tenant, tenantName)))
+		return true
+	}
+
+	meter.mutex.Lock()
+	meter.rollover()
+	exceeded, limit := key.exceeded()
+	owner := key.Key
+	if tenant, ok := meter.tenants[tenantName]; ok && exceeded == "" {
+		exceeded, limit = tenant.exceeded()
+		owner = tenantName
+	}
+	if exceeded == "" {
+		for _, quota := range []*Quota{&key.Quota, meter.tenants[tenantName]} {
+			if quota != nil {
+				quota.Daily++
+				quota.Monthly++
+			}
+		}
+		meter.rows[row{key: key.Key, handler: handlerName, day: meter.day}]++
+	}
+	meter.mutex.Unlock()
+
+	if exceeded != "" {
+		metrics.Inc("xserver_api_quota_rejections_total", "key", key.Key, "tenant", tenantName, "quota", exceeded)
+		writer.Header().Set("Retry-After", strconv.Itoa(retryAfter(exceeded)))
+		problem.Write(writer, request, problem.New(http.StatusTooManyRequests, problem.CodeQuotaExceeded, fmt.Sprintf(`[XServer] [Metering] [Error] %s quota of "%s" is exceeded`, exceeded, owner)).With("quota", exceeded).With("limit", limit))
+		return true
+	}
+	metrics.Inc("xserver_api_requests_total", "key", key.Key, "handler", handlerName)
+	return false
+}
+
+// RejectTable rejects requests to tables of a tenant without an api key of the tenant or a key without tenant.
+func (meter *Meter) RejectTable(tableName string, writer http.ResponseWriter, request *http.Request) bool {
+	if meter == nil {
+		return false
+	}
+	tenantName := meter.config.TableTenant(tableName)
+	if tenantName == "" {
+		return false
+	}
+
+	key, rejection := meter.identify(request, true)
+	if rejection == nil && key.Tenant != "" && key.Tenant != tenantName {
+		rejection = problem.New(http.StatusForbidden, problem.CodeForbidden, fmt.Sprintf(`[XServer] [Metering] [Error] api key of "%s" tenant can't access table of "%s" tenant`, key.Tenant, tenantName))
+	}
+	if rejection != nil {
+		problem.Write(writer, request, rejection)
+		return true
+	}
+	return false
+}
+
+// RejectQuery rejects runs of the named query by api keys not allowed by the query api_keys.
+func (meter *Meter) RejectQuery(queryName string, allowed []string, writer http.ResponseWriter, request *http.Request) bool {
+	if meter == nil || len(allowed) == 0 {
+		return false
+	}
+
+	key, rejection := meter.identify(request, true)
+	if rejection == nil && !contains(allowed, key.Key) {
+		rejection = problem.New(http.StatusForbidden, problem.CodeForbidden, fmt.Sprintf(`[XServer] [Metering] [Error] api key "%s" can't run "%s" query`, key.Key, queryName))
+	}
+	if rejection != nil {
+		problem.Write(writer, request, rejection)
+		return true
+	}
+	return false
+}
+
+// flush adds counted requests to the database, they are kept for the next flush if the database fails.
+func (meter *Meter) flush() {
+	if meter.storage == nil {
+		return
+	}
+
+	meter.mutex.Lock()
+	rows := meter.rows
+	meter.rows = map[row]int64{}
+	meter.mutex.Unlock()
+	if len(rows) == 0 {
+		return
+	}
+
+	stored := []database.Usage{}
+	for each, requests := range rows {
+		stored = append(stored, database.Usage{Key: each.key, Handler: each.handler, Day: each.day, Requests: requests})
+	}
+	if err := meter.storage.AddUsage(stored); err != nil {
+		logger.Error(err.Error())
+		meter.mutex.Lock()
+		for each, requests := range rows {
+			meter.rows[each] += requests
+		}
+		meter.mutex.Unlock()
+	}
+}
+
+// Keys returns the usage of keys within the current day and month.
+func (meter *Meter) Keys() []Key {
+	result := []Key{}
+	if meter == nil {
+		return result
+	}
+
+	meter.mutex.Lock()
+	meter.rollover()
+	for _, key := range meter.keys {
+		result = append(result, *key)
+	}
+	meter.mutex.Unlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+// Tenant returns the usage of the tenant within the current day and month.
+func (meter *Meter) Tenant(tenantName string) Quota {
+	if meter == nil {
+		return Quota{}
+	}
+
+	meter.mutex.Lock()
+	defer meter.mutex.Unlock()
+	meter.rollover()
+	if tenant, ok := meter.tenants[tenantName]; ok {
+		return *tenant
+	}
+	return Quota{}
+}
+
+// Report returns requests counts by key, handler and day between from and to days inclusive, all keys if key is empty.
+func (meter *Meter) Report(key string, from string, to string) ([]database.Usage, error) {
+	if meter == nil {
+		return []database.Usage{}, nil
+	}
+	if meter.storage != nil {
+		meter.flush()
+		return meter.storage.Usage(key, from, to)
+	}
+
+	result := []database.Usage{}
+	meter.mutex.Lock()
+	for each, requests := range meter.rows {
+		if (key == "" || each.key == key) && each.day >= from && each.day <= to {
+			result = append(result, database.Usage{Key: each.key, Handler: each.handler, Day: each.day, Requests: requests})
+		}
+	}
+	meter.mutex.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Day != result[j].Day {
+			return result[i].Day < result[j].Day
+		}
+		if result[i].Key != result[j].Key {
+			return result[i].Key < result[j].Key
+		}
+		return result[i].Handler < result[j].Handler
+	})
+	return result, nil
+}
+
+// Close stops periodic flushes and flushes the remaining counts.
+func (meter *Meter) Close() {
+	if meter == nil || meter.storage == nil {
+		return
+	}
+	close(meter.stop)
+	meter.flush()
+}
@@ -0,0 +1,105 @@
+package metering
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"xserver/src/config"
+)
+
+const testHeader = "X-Api-Key"
+
+func create(t *testing.T, serverConfig *config.Config) *Meter {
+	t.Helper()
+	serverConfig.ApiKeys.Header = testHeader
+	meter, err := Create(serverConfig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return meter
+}
+
+// reject sends the handler request with the api key, responds the status of rejected requests and 200 otherwise.
+func reject(meter *Meter, handlerName string, apiKey string) int {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/"+handlerName, nil)
+	if apiKey != "" {
+		request.Header.Set(testHeader, apiKey)
+	}
+	if !meter.Reject(handlerName, recorder, request) {
+		return http.StatusOK
+	}
+	return recorder.Code
+}
+
+func TestReject(t *testing.T) {
+	tests := []struct {
+		name     string
+		required bool
+		apiKey   string
+		statuses []int
+	}{
+		{name: "anonymous", statuses: []int{http.StatusOK, http.StatusOK, http.StatusOK}},
+		{name: "required", required: true, statuses: []int{http.StatusUnauthorized}},
+		{name: "unknown key", apiKey: "unknown", statuses: []int{http.StatusUnauthorized}},
+		{name: "daily quota", apiKey: "daily-secret", statuses: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}},
+		{name: "monthly quota", apiKey: "monthly-secret", statuses: []int{http.StatusOK, http.StatusTooManyRequests}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			meter := create(t, &config.Config{ApiKeys: config.ApiKeys{Required: test.required, Keys: map[string]config.ApiKey{
+				"daily":   {Key: "daily-secret", Daily: 2},
+				"monthly": {Key: "monthly-secret", Monthly: 1},
+			}}})
+			for index, status := range test.statuses {
+				if current := reject(meter, "users", test.apiKey); current != status {
+					t.Fatalf("request %d: unexpected status %d, expected %d", index, current, status)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		keys map[string]config.ApiKey
+	}{
+		{name: "empty key", keys: map[string]config.ApiKey{"empty": {KeyEnv: "XSERVER_TEST_MISSING_KEY"}}},
+		{name: "same key", keys: map[string]config.ApiKey{"first": {Key: "secret"}, "second": {Key: "secret"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Create(&config.Config{ApiKeys: config.ApiKeys{Header: testHeader, Keys: test.keys}}, nil); err == nil {
+				t.Fatal("invalid api keys must be rejected")
+			}
+		})
+	}
+}
+
+func TestUsage(t *testing.T) {
+	meter := create(t, &config.Config{ApiKeys: config.ApiKeys{Keys: map[string]config.ApiKey{"first": {Key: "first-secret", Daily: 10}}}})
+	reject(meter, "users", "first-secret")
+	reject(meter, "users", "first-secret")
+	reject(meter, "orders", "")
+
+	keys := map[string]Key{}
+	for _, key := range meter.Keys() {
+		keys[key.Key] = key
+	}
+	if first := keys["first"]; first.Daily != 2 || first.Monthly != 2 || first.DailyLimit != 10 {
+		t.Fatalf("unexpected usage %+v", first)
+	}
+	if anonymous := keys[Anonymous]; anonymous.Daily != 1 {
+		t.Fatalf("unexpected anonymous usage %+v", anonymous)
+	}
+
+	day := today()
+	report, err := meter.Report("first", day, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 1 || report[0].Handler != "users" || report[0].Requests != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,99 @@
+package metering
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"xserver/src/config"
+)
+
+func tenantsConfig() *config.Config {
+	return &config.Config{
+		ApiKeys: config.ApiKeys{Keys: map[string]config.ApiKey{
+			"search":  {Key: "search-secret", Tenant: "search"},
+			"billing": {Key: "billing-secret", Tenant: "billing"},
+			"admin":   {Key: "admin-secret"},
+		}},
+		Tenants: map[string]config.Tenant{
+			"search":  {Prefix: "/search", Tables: []string{"Documents"}, Daily: 2},
+			"billing": {Prefix: "/billing", Tables: []string{"Invoices"}},
+		},
+		Handlers: map[string]config.ExecutableServerUnit{
+			"query":    {Tenant: "search"},
+			"invoices": {Tenant: "billing"},
+			"health":   {},
+		},
+	}
+}
+
+func TestTenantHandlers(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler string
+		apiKey  string
+		status  int
+	}{
+		{name: "tenant key", handler: "query", apiKey: "search-secret", status: http.StatusOK},
+		{name: "other tenant key", handler: "invoices", apiKey: "search-secret", status: http.StatusForbidden},
+		{name: "handler without tenant", handler: "health", apiKey: "search-secret", status: http.StatusOK},
+		{name: "key without tenant", handler: "invoices", apiKey: "admin-secret", status: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			meter := create(t, tenantsConfig())
+			if status := reject(meter, test.handler, test.apiKey); status != test.status {
+				t.Fatalf("unexpected status %d, expected %d", status, test.status)
+			}
+		})
+	}
+}
+
+func TestTenantQuota(t *testing.T) {
+	meter := create(t, tenantsConfig())
+	for index, apiKey := range []string{"search-secret", "admin-secret"} {
+		if status := reject(meter, "query", apiKey); status != http.StatusOK {
+			t.Fatalf("request %d: unexpected status %d", index, status)
+		}
+	}
+	if status := reject(meter, "query", "admin-secret"); status != http.StatusTooManyRequests {
+		t.Fatalf("tenant quota is not applied, status %d", status)
+	}
+	if status := reject(meter, "health", "search-secret"); status != http.StatusOK {
+		t.Fatalf("tenant quota must not apply to handlers without tenant, status %d", status)
+	}
+	if quota := meter.Tenant("search"); quota.Daily != 2 || quota.DailyLimit != 2 {
+		t.Fatalf("unexpected tenant usage %+v", quota)
+	}
+}
+
+func TestRejectTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		table  string
+		apiKey string
+		status int
+	}{
+		{name: "tenant key", table: "Documents", apiKey: "search-secret", status: http.StatusOK},
+		{name: "other tenant key", table: "Invoices", apiKey: "search-secret", status: http.StatusForbidden},
+		{name: "key without tenant", table: "Invoices", apiKey: "admin-secret", status: http.StatusOK},
+		{name: "without key", table: "Invoices", status: http.StatusUnauthorized},
+		{name: "table without tenant", table: "Users", status: http.StatusOK},
+	}
+	meter := create(t, tenantsConfig())
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/db/select", nil)
+			if test.apiKey != "" {
+				request.Header.Set(testHeader, test.apiKey)
+			}
+			status := http.StatusOK
+			if meter.RejectTable(test.table, recorder, request) {
+				status = recorder.Code
+			}
+			if status != test.status {
+				t.Fatalf("unexpected status %d, expected %d", status, test.status)
+			}
+		})
+	}
+}
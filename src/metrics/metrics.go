@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	CounterType = "counter"
+	GaugeType   = "gauge"
+)
+
+type description struct {
+	kind string
+	help string
+}
+
+type sample struct {
+	name   string
+	labels string
+	pairs  []string
+	value  float64
+}
+
+// Sample is the current value of the metric, labels are name and value pairs.
+type Sample struct {
+	Name   string
+	Kind   string
+	Labels []string
+	Value  float64
+}
+
+var (
+	mutex        sync.Mutex
+	descriptions = map[string]description{}
+	samples      = map[string]*sample{}
+)
+
+func Register(name string, kind string, help string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	descriptions[name] = description{kind: kind, help: help}
+}
+
+func formatLabels(labels []string) string {
+	pairs := []string{}
+	for i := 0; i+1 < len(labels); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], value))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func update(name string, labels []string, update func(value float64) float64) {
+	formattedLabels := formatLabels(labels)
+	key := name + formattedLabels
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	current, ok := samples[key]
+	if !ok {
+		current = &sample{name: name, labels: formattedLabels, pairs: append([]string{}, labels...)}
+		samples[key] = current
+	}
+	current.value = update(current.value)
+}
+
+func Add(name string, value float64, labels ...string) {
+	update(name, labels, func(current float64) float64 { return current + value })
+}
+
+func Inc(name string, labels ...string) {
+	Add(name, 1, labels...)
+}
+
+func Set(name string, value float64, labels ...string) {
+	update(name, labels, func(float64) float64 { return value })
+}
+
+func Get(name string, labels ...string) float64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if current, ok := samples[name+formatLabels(labels)]; ok {
+		return current.value
+	}
+	return 0
+}
+
+func Text() string {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	byName := map[string][]*sample{}
+	names := []string{}
+	for _, current := range samples {
+		if _, ok := byName[current.name]; !ok {
+			names = append(names, current.name)
+		}
+		byName[current.name] = append(byName[current.name], current)
+	}
+	sort.Strings(names)
+
+	builder := &strings.Builder{}
+	for _, name := range names {
+		if description, ok := descriptions[name]; ok {
+			fmt.Fprintf(builder, "# HELP %s %s\n", name, description.help)
+			fmt.Fprintf(builder, "# TYPE %s %s\n", name, description.kind)
+		}
+
+		nameSamples := byName[name]
+		sort.Slice(nameSamples, func(i, j int) bool { return nameSamples[i].labels < nameSamples[j].labels })
+		for _, current := range nameSamples {
+			fmt.Fprintf(builder, "%s%s %v\n", current.name, current.labels, current.value)
+		}
+	}
+
+	return builder.String()
+}
+
+// Snapshot returns current values of all metrics sorted by name and labels.
+func Snapshot() []Sample {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	keys := []string{}
+	for key := range samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]Sample, 0, len(keys))
+	for _, key := range keys {
+		current := samples[key]
+		result = append(result, Sample{Name: current.name, Kind: descriptions[current.name].kind, Labels: current.pairs, Value: current.value})
+	}
+	return result
+}
+
+func Handler(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writer.Write([]byte(Text()))
+}
@@ -0,0 +1,124 @@
+package mirror
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+)
+
+const (
+	maxDiffs = 100
+)
+
+func init() {
+	metrics.Register("xserver_shadow_requests_total", metrics.CounterType, "Number of requests mirrored to shadow handlers.")
+	metrics.Register("xserver_shadow_diffs_total", metrics.CounterType, "Number of shadow responses different from primary responses.")
+}
+
+// Recorder is a response writer keeping the shadow handler response.
+type Recorder struct {
+	Status int
+	header http.Header
+	Body   bytes.Buffer
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{Status: http.StatusOK, header: http.Header{}}
+}
+
+func (recorder *Recorder) Header() http.Header {
+	return recorder.header
+}
+
+func (recorder *Recorder) Write(data []byte) (int, error) {
+	return recorder.Body.Write(data)
+}
+
+func (recorder *Recorder) WriteHeader(status int) {
+	recorder.Status = status
+}
+
+type Diff struct {
+	Handler     string    `json:"handler"`
+	Shadow      string    `json:"shadow"`
+	Time        time.Time `json:"time"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	Differences []string  `json:"differences"`
+}
+
+type Mirror struct {
+	mutex sync.Mutex
+	diffs []Diff
+}
+
+func Create() *Mirror {
+	return &Mirror{diffs: []Diff{}}
+}
+
+// EqualBodies compares bodies as json values if both are valid json and as trimmed text otherwise.
+func EqualBodies(first []byte, second []byte) bool {
+	var firstValue, secondValue interface{}
+	if json.Unmarshal(first, &firstValue) == nil && json.Unmarshal(second, &secondValue) == nil {
+		return reflect.DeepEqual(firstValue, secondValue)
+	}
+	return bytes.Equal(bytes.TrimSpace(first), bytes.TrimSpace(second))
+}
+
+func Compare(primaryStatus int, primaryBody []byte, shadowStatus int, shadowBody []byte) []string {
+	differences := []string{}
+	if primaryStatus != shadowStatus {
+		differences = append(differences, fmt.Sprintf("status %d != %d", primaryStatus, shadowStatus))
+	}
+	if !EqualBodies(primaryBody, shadowBody) {
+		differences = append(differences, "body")
+	}
+	return differences
+}
+
+// Record compares primary and shadow responses and keeps the last differences.
+func (mirror *Mirror) Record(handler string, shadow string, request *http.Request, primaryStatus int, primaryBody []byte, shadowStatus int, shadowBody []byte) {
+	metrics.Inc("xserver_shadow_requests_total", "handler", handler, "shadow", shadow)
+
+	differences := Compare(primaryStatus, primaryBody, shadowStatus, shadowBody)
+	if len(differences) == 0 {
+		return
+	}
+
+	metrics.Inc("xserver_shadow_diffs_total", "handler", handler, "shadow", shadow)
+	logger.Verbose(fmt.Sprintf("[XServer] [%s Handler] shadow %s response differs: %v", handler, shadow, differences))
+
+	mirror.mutex.Lock()
+	defer mirror.mutex.Unlock()
+
+	mirror.diffs = append(mirror.diffs, Diff{
+		Handler:     handler,
+		Shadow:      shadow,
+		Time:        time.Now(),
+		Method:      request.Method,
+		Path:        request.URL.RequestURI(),
+		Differences: differences,
+	})
+	if len(mirror.diffs) > maxDiffs {
+		mirror.diffs = mirror.diffs[len(mirror.diffs)-maxDiffs:]
+	}
+}
+
+func (mirror *Mirror) Diffs(handler string) []Diff {
+	mirror.mutex.Lock()
+	defer mirror.mutex.Unlock()
+
+	result := []Diff{}
+	for _, diff := range mirror.diffs {
+		if handler == "" || diff.Handler == handler {
+			result = append(result, diff)
+		}
+	}
+	return result
+}
@@ -0,0 +1,65 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"text/template"
+	"xserver/src/config"
+	"xserver/src/problem"
+)
+
+type requestData struct {
+	Method  string
+	Path    string
+	Query   url.Values
+	Headers http.Header
+	Body    string
+	Json    interface{}
+}
+
+// Create creates the handler serving the configured response, the body is a text/template rendered with request fields.
+func Create(handlerName string, settings config.Mock) (http.HandlerFunc, error) {
+	bodyTemplate, err := template.New(handlerName).Parse(settings.Body)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [%s Handler] [Error] failed parse mock body template: %s", handlerName, err)
+	}
+
+	status := settings.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, fmt.Sprintf("[XServer] [%s Handler] [Error] failed read request body", handlerName)))
+			return
+		}
+
+		data := requestData{
+			Method:  request.Method,
+			Path:    request.URL.Path,
+			Query:   request.URL.Query(),
+			Headers: request.Header,
+			Body:    string(body),
+			Json:    map[string]interface{}{},
+		}
+		json.Unmarshal(body, &data.Json)
+
+		response := &bytes.Buffer{}
+		if err := bodyTemplate.Execute(response, data); err != nil {
+			problem.Write(writer, request, problem.New(http.StatusInternalServerError, problem.CodeHandlerFailed, fmt.Sprintf("[XServer] [%s Handler] [Error] failed render mock body: %s", handlerName, err)))
+			return
+		}
+
+		for name, value := range settings.Headers {
+			writer.Header().Set(name, value)
+		}
+		writer.WriteHeader(status)
+		writer.Write(response.Bytes())
+	}, nil
+}
@@ -0,0 +1,115 @@
+package modes
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"xserver/src/config"
+	"xserver/src/metrics"
+	"xserver/src/problem"
+)
+
+const (
+	ReadOnly    = "read_only"
+	Maintenance = "maintenance"
+)
+
+var (
+	// exemptPaths are served in maintenance mode.
+	exemptPaths = []string{"/admin/", "/metrics"}
+)
+
+func init() {
+	metrics.Register("xserver_mode_enabled", metrics.GaugeType, "Whether the server mode is enabled.")
+}
+
+type Status struct {
+	ReadOnly    bool `json:"read_only"`
+	Maintenance bool `json:"maintenance"`
+}
+
+type Modes struct {
+	mutex    sync.RWMutex
+	status   Status
+	response config.MaintenanceResponse
+}
+
+func Create(settings config.Modes) *Modes {
+	modes := &Modes{response: settings.MaintenanceResponse}
+	modes.Set(ReadOnly, settings.ReadOnly)
+	modes.Set(Maintenance, settings.Maintenance)
+	return modes
+}
+
+func (modes *Modes) Set(mode string, enable bool) error {
+	modes.mutex.Lock()
+	defer modes.mutex.Unlock()
+
+	switch mode {
+	case ReadOnly:
+		modes.status.ReadOnly = enable
+	case Maintenance:
+		modes.status.Maintenance = enable
+	default:
+		return fmt.Errorf(`[XServer] [Modes] [Error] unknown mode "%s", expected %s or %s`, mode, ReadOnly, Maintenance)
+	}
+
+	value := 0.0
+	if enable {
+		value = 1
+	}
+	metrics.Set("xserver_mode_enabled", value, "mode", mode)
+	return nil
+}
+
+func (modes *Modes) Get() Status {
+	modes.mutex.RLock()
+	defer modes.mutex.RUnlock()
+	return modes.status
+}
+
+// Mutating reports whether the request method may change data.
+func Mutating(request *http.Request) bool {
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// RejectWrite responds 503 and reports true if the server is in read-only mode.
+func (modes *Modes) RejectWrite(writer http.ResponseWriter, request *http.Request) bool {
+	if modes == nil || !modes.Get().ReadOnly {
+		return false
+	}
+	problem.Write(writer, request, problem.New(http.StatusServiceUnavailable, problem.CodeReadOnly, "[XServer] [Modes] [Error] server is in read-only mode").WithResult(false))
+	return true
+}
+
+// Handler serves the maintenance response for all routes except admin and metrics ones while maintenance mode is enabled.
+func (modes *Modes) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !modes.Get().Maintenance {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		for _, path := range exemptPaths {
+			if strings.HasPrefix(request.URL.Path, path) {
+				next.ServeHTTP(writer, request)
+				return
+			}
+		}
+
+		for name, value := range modes.response.Headers {
+			writer.Header().Set(name, value)
+		}
+		if modes.response.Body == "" {
+			problem.Write(writer, request, problem.New(modes.response.Status, problem.CodeMaintenance, "[XServer] server is under maintenance"))
+			return
+		}
+		writer.WriteHeader(modes.response.Status)
+		writer.Write([]byte(modes.response.Body))
+	})
+}
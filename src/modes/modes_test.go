@@ -0,0 +1,80 @@
+package modes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"xserver/src/config"
+)
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings config.Modes
+		path     string
+		status   int
+		body     string
+	}{
+		{name: "disabled", settings: config.Modes{MaintenanceResponse: config.MaintenanceResponse{Status: http.StatusServiceUnavailable}}, path: "/handler", status: http.StatusOK, body: "served"},
+		{name: "maintenance", settings: config.Modes{Maintenance: true, MaintenanceResponse: config.MaintenanceResponse{Status: http.StatusServiceUnavailable}}, path: "/handler", status: http.StatusServiceUnavailable},
+		{name: "custom body", settings: config.Modes{Maintenance: true, MaintenanceResponse: config.MaintenanceResponse{Status: http.StatusOK, Body: "later"}}, path: "/handler", status: http.StatusOK, body: "later"},
+		{name: "admin", settings: config.Modes{Maintenance: true, MaintenanceResponse: config.MaintenanceResponse{Status: http.StatusServiceUnavailable}}, path: "/admin/modes", status: http.StatusOK, body: "served"},
+		{name: "metrics", settings: config.Modes{Maintenance: true, MaintenanceResponse: config.MaintenanceResponse{Status: http.StatusServiceUnavailable}}, path: "/metrics", status: http.StatusOK, body: "served"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := Create(test.settings).Handler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				writer.Write([]byte("served"))
+			}))
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.path, nil))
+			if recorder.Code != test.status {
+				t.Fatalf("unexpected status %d", recorder.Code)
+			}
+			if test.body != "" && recorder.Body.String() != test.body {
+				t.Fatalf("unexpected body %q", recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestRejectWrite(t *testing.T) {
+	serverModes := Create(config.Modes{})
+	if serverModes.RejectWrite(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil)) {
+		t.Fatal("writes must be served without read-only mode")
+	}
+	if err := serverModes.Set(ReadOnly, true); err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	if !serverModes.RejectWrite(recorder, httptest.NewRequest(http.MethodPost, "/", nil)) || recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("writes must be rejected in read-only mode, got %d", recorder.Code)
+	}
+	if err := serverModes.Set("unknown", true); err == nil {
+		t.Fatal("unknown mode must be rejected")
+	}
+	var disabled *Modes
+	if disabled.RejectWrite(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil)) {
+		t.Fatal("nil modes must not reject writes")
+	}
+}
+
+func TestMutating(t *testing.T) {
+	tests := []struct {
+		method   string
+		mutating bool
+	}{
+		{method: http.MethodGet},
+		{method: http.MethodHead},
+		{method: http.MethodOptions},
+		{method: http.MethodPost, mutating: true},
+		{method: http.MethodPut, mutating: true},
+		{method: http.MethodPatch, mutating: true},
+		{method: http.MethodDelete, mutating: true},
+	}
+	for _, test := range tests {
+		if Mutating(httptest.NewRequest(test.method, "/", nil)) != test.mutating {
+			t.Errorf("%s must be mutating %v", test.method, test.mutating)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package msgpack
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	ContentType = "application/msgpack"
+
+	// maxDepth is the max nesting of decoded arrays and maps.
+	maxDepth = 100
+)
+
+var (
+	errTruncated = errors.New("truncated msgpack value")
+)
+
+// Is reports whether the media type is msgpack, application/x-msgpack and application/vnd.msgpack are accepted too.
+func Is(mediaType string) bool {
+	return mediaType == ContentType || mediaType == "application/x-msgpack" || mediaType == "application/vnd.msgpack"
+}
+
+// Marshal encodes the decoded json value, json numbers are integers when they are whole, map keys are sorted.
+func Marshal(value interface{}) ([]byte, error) {
+	return appendValue(nil, value)
+}
+
+func appendLength(data []byte, length int, fix byte, fixMax int, codes [3]byte) []byte {
+	switch {
+	case fix != 0 && length <= fixMax:
+		return append(data, fix|byte(length))
+	case codes[0] != 0 && length <= math.MaxUint8:
+		return append(data, codes[0], byte(length))
+	case length <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(data, codes[1]), uint16(length))
+	default:
+		return binary.BigEndian.AppendUint32(append(data, codes[2]), uint32(length))
+	}
+}
+
+func appendInt(data []byte, value int64) []byte {
+	switch {
+	case value >= 0 && value <= 127, value < 0 && value >= -32:
+		return append(data, byte(value))
+	case value >= 0 && value <= math.MaxUint8:
+		return append(data, 0xcc, byte(value))
+	case value >= 0 && value <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(data, 0xcd), uint16(value))
+	case value >= 0 && value <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(data, 0xce), uint32(value))
+	case value >= 0:
+		return binary.BigEndian.AppendUint64(append(data, 0xcf), uint64(value))
+	case value >= math.MinInt8:
+		return append(data, 0xd0, byte(value))
+	case value >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(data, 0xd1), uint16(value))
+	case value >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(data, 0xd2), uint32(value))
+	default:
+		return binary.BigEndian.AppendUint64(append(data, 0xd3), uint64(value))
+	}
+}
+
+func appendValue(data []byte, value interface{}) ([]byte, error) {
+	switch value := value.(type) {
+	case nil:
+		return append(data, 0xc0), nil
+	case bool:
+		if value {
+			return append(data, 0xc3), nil
+		}
+		return append(data, 0xc2), nil
+	case int:
+		return appendInt(data, int64(value)), nil
+	case int64:
+		return appendInt(data, value), nil
+	case float64:
+		return binary.BigEndian.AppendUint64(append(data, 0xcb), math.Float64bits(value)), nil
+	case json.Number:
+		if number, err := value.Int64(); err == nil {
+			return appendInt(data, number), nil
+		}
+		number, err := value.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendValue(data, number)
+	case string:
+		data = appendLength(data, len(value), 0xa0, 31, [3]byte{0xd9, 0xda, 0xdb})
+		return append(data, value...), nil
+	case []byte:
+		data = appendLength(data, len(value), 0, 0, [3]byte{0xc4, 0xc5, 0xc6})
+		return append(data, value...), nil
+	case []interface{}:
+		data = appendLength(data, len(value), 0x90, 15, [3]byte{0, 0xdc, 0xdd})
+		for _, item := range value {
+			var err error
+			if data, err = appendValue(data, item); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	case map[string]interface{}:
+		keys := []string{}
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		data = appendLength(data, len(value), 0x80, 15, [3]byte{0, 0xde, 0xdf})
+		for _, key := range keys {
+			var err error
+			if data, err = appendValue(data, key); err != nil {
+				return nil, err
+			}
+			if data, err = appendValue(data, value[key]); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported msgpack value %T", value)
+	}
+}
+
+// Unmarshal decodes the value as json would, binaries are strings and map keys are formatted as strings.
+func Unmarshal(data []byte) (interface{}, error) {
+	decoder := &decoder{data: data}
+	value, err := decoder.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoder.data) != 0 {
+		return nil, errors.New("trailing data after msgpack value")
+	}
+	return value, nil
+}
+
+type decoder struct {
+	data []byte
+}
+
+func (decoder *decoder) take(size int) ([]byte, error) {
+	if size < 0 || len(decoder.data) < size {
+		return nil, errTruncated
+	}
+	result := decoder.data[:size]
+	decoder.data = decoder.data[size:]
+	return result, nil
+}
+
+func (decoder *decoder) uint(size int) (uint64, error) {
+	data, err := decoder.take(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(data[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(data)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(data)), nil
+	default:
+		return binary.BigEndian.Uint64(data), nil
+	}
+}
+
+func (decoder *decoder) length(size int) (int, error) {
+	length, err := decoder.uint(size)
+	if err != nil {
+		return 0, err
+	}
+	// every item takes one byte at least, longer lengths are truncated values
+	if length > uint64(len(decoder.data)) {
+		return 0, errTruncated
+	}
+	return int(length), nil
+}
+
+func (decoder *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("msgpack value exceeds %d nesting levels", maxDepth)
+	}
+	head, err := decoder.take(1)
+	if err != nil {
+		return nil, err
+	}
+	code := head[0]
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code&0xe0 == 0xa0:
+		return decoder.text(int(code & 0x1f))
+	case code&0xf0 == 0x90:
+		return decoder.array(int(code&0x0f), depth)
+	case code&0xf0 == 0x80:
+		return decoder.object(int(code&0x0f), depth)
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		value, err := decoder.uint(1 << (code - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if value > math.MaxInt64 {
+			return float64(value), nil
+		}
+		return int64(value), nil
+	case 0xd0:
+		value, err := decoder.uint(1)
+		return int64(int8(value)), err
+	case 0xd1:
+		value, err := decoder.uint(2)
+		return int64(int16(value)), err
+	case 0xd2:
+		value, err := decoder.uint(4)
+		return int64(int32(value)), err
+	case 0xd3:
+		value, err := decoder.uint(8)
+		return int64(value), err
+	case 0xca:
+		value, err := decoder.uint(4)
+		return float64(math.Float32frombits(uint32(value))), err
+	case 0xcb:
+		value, err := decoder.uint(8)
+		return math.Float64frombits(value), err
+	case 0xd9, 0xda, 0xdb, 0xc4, 0xc5, 0xc6:
+		size := 1
+		if code == 0xda || code == 0xc5 {
+			size = 2
+		} else if code == 0xdb || code == 0xc6 {
+			size = 4
+		}
+		length, err := decoder.length(size)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.text(length)
+	case 0xdc, 0xdd:
+		length, err := decoder.length(2 << (code - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.array(length, depth)
+	case 0xde, 0xdf:
+		length, err := decoder.length(2 << (code - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.object(length, depth)
+	}
+	return nil, fmt.Errorf("unsupported msgpack type 0x%02x", code)
+}
+
+func (decoder *decoder) text(length int) (interface{}, error) {
+	data, err := decoder.take(length)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (decoder *decoder) array(length int, depth int) (interface{}, error) {
+	result := make([]interface{}, 0, length)
+	for i := 0; i < length; i++ {
+		item, err := decoder.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+func (decoder *decoder) object(length int, depth int) (interface{}, error) {
+	result := make(map[string]interface{}, length)
+	for i := 0; i < length; i++ {
+		key, err := decoder.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		value, err := decoder.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if text, ok := key.(string); ok {
+			result[text] = value
+		} else {
+			result[fmt.Sprint(key)] = value
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,268 @@
+package normalize
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"xserver/src/metrics"
+	"xserver/src/problem"
+)
+
+const (
+	NormalizedHeader = "X-XServer-Normalized"
+
+	// maxFieldsSize is the max size of form fields and xml bodies kept in memory, multipart files are saved to files.
+	maxFieldsSize   = 10 << 20
+	attributePrefix = "@"
+	textKey         = "#text"
+)
+
+func init() {
+	metrics.Register("xserver_normalized_requests_total", metrics.CounterType, "Number of form and xml requests bodies normalized to json envelopes.")
+}
+
+// File is the multipart file saved to the file, the file is removed after the handler finished.
+type File struct {
+	Field       string `json:"field"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+}
+
+// Envelope is the json body passed to the handler instead of the form or xml body.
+type Envelope struct {
+	ContentType string                 `json:"content_type"`
+	Fields      map[string]interface{} `json:"fields,omitempty"`
+	Files       []File                 `json:"files,omitempty"`
+	Xml         map[string]interface{} `json:"xml,omitempty"`
+}
+
+// addField adds the field value, repeated fields are lists of values.
+func (envelope *Envelope) addField(name string, value string) {
+	switch current := envelope.Fields[name].(type) {
+	case nil:
+		envelope.Fields[name] = value
+	case string:
+		envelope.Fields[name] = []interface{}{current, value}
+	case []interface{}:
+		envelope.Fields[name] = append(current, value)
+	}
+}
+
+func readLimited(reader io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(reader, maxFieldsSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxFieldsSize {
+		return nil, fmt.Errorf("body exceeds %d bytes", maxFieldsSize)
+	}
+	return data, nil
+}
+
+func (envelope *Envelope) readForm(body io.Reader) error {
+	data, err := readLimited(body)
+	if err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	for name, list := range values {
+		for _, value := range list {
+			envelope.addField(name, value)
+		}
+	}
+	return nil
+}
+
+func (envelope *Envelope) readMultipart(request *http.Request, directory string) error {
+	reader, err := request.MultipartReader()
+	if err != nil {
+		return err
+	}
+	fieldsSize := 0
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if part.FileName() == "" {
+			data, err := readLimited(part)
+			if err != nil {
+				return err
+			}
+			if fieldsSize += len(data); fieldsSize > maxFieldsSize {
+				return fmt.Errorf("fields exceed %d bytes", maxFieldsSize)
+			}
+			envelope.addField(part.FormName(), string(data))
+			continue
+		}
+
+		name := filepath.Base(filepath.Clean("/" + part.FileName()))
+		if name == "/" || name == "." {
+			name = "file"
+		}
+		path := filepath.Join(directory, fmt.Sprintf("%d-%s", len(envelope.Files)+1, name))
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		size, err := io.Copy(file, part)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		contentType := part.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		envelope.Files = append(envelope.Files, File{Field: part.FormName(), Filename: part.FileName(), ContentType: contentType, Path: path, Size: size})
+	}
+}
+
+// element is the xml element converted to json, elements without attributes and children are their text.
+type element struct {
+	name       string
+	attributes []xml.Attr
+	children   []*element
+	text       strings.Builder
+}
+
+func (current *element) value() interface{} {
+	text := strings.TrimSpace(current.text.String())
+	if len(current.attributes) == 0 && len(current.children) == 0 {
+		return text
+	}
+	result := map[string]interface{}{}
+	for _, attribute := range current.attributes {
+		result[attributePrefix+attribute.Name.Local] = attribute.Value
+	}
+	for _, child := range current.children {
+		switch existing := result[child.name].(type) {
+		case nil:
+			result[child.name] = child.value()
+		case []interface{}:
+			result[child.name] = append(existing, child.value())
+		default:
+			result[child.name] = []interface{}{existing, child.value()}
+		}
+	}
+	if text != "" {
+		result[textKey] = text
+	}
+	return result
+}
+
+func (envelope *Envelope) readXml(body io.Reader) error {
+	data, err := readLimited(body)
+	if err != nil {
+		return err
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	stack := []*element{}
+	var root *element
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			current := &element{name: token.Name.Local}
+			for _, attribute := range token.Attr {
+				if attribute.Name.Space != "xmlns" && attribute.Name.Local != "xmlns" {
+					current.attributes = append(current.attributes, attribute)
+				}
+			}
+			if len(stack) != 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, current)
+			} else if root == nil {
+				root = current
+			} else {
+				return errors.New("multiple root elements")
+			}
+			stack = append(stack, current)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) != 0 {
+				stack[len(stack)-1].text.Write(token)
+			}
+		}
+	}
+	if root == nil {
+		return errors.New("no root element")
+	}
+	envelope.Xml = map[string]interface{}{root.name: root.value()}
+	return nil
+}
+
+// xmlType reports whether the media type is xml, e.g. application/xml, text/xml or application/soap+xml.
+func xmlType(mediaType string) bool {
+	return mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+// Handler replaces form, multipart and xml bodies of requests to the handler with the json envelope,
+// other bodies are passed as is and invalid bodies are rejected with 400.
+func Handler(handlerName string, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+		if err != nil || (mediaType != "application/x-www-form-urlencoded" && mediaType != "multipart/form-data" && !xmlType(mediaType)) {
+			next(writer, request)
+			return
+		}
+
+		envelope := &Envelope{ContentType: mediaType, Fields: map[string]interface{}{}}
+		switch {
+		case mediaType == "multipart/form-data":
+			directory, createErr := os.MkdirTemp("", "xserver-form-")
+			if createErr != nil {
+				problem.Write(writer, request, problem.New(http.StatusInternalServerError, problem.CodeInternal, fmt.Sprintf("[XServer] [%s Handler] [Error] failed create files directory: %s", handlerName, createErr)))
+				return
+			}
+			defer os.RemoveAll(directory)
+			err = envelope.readMultipart(request, directory)
+		case xmlType(mediaType):
+			err = envelope.readXml(request.Body)
+		default:
+			err = envelope.readForm(request.Body)
+		}
+		if err != nil {
+			problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, fmt.Sprintf("[XServer] [%s Handler] [Error] invalid %s body: %s", handlerName, mediaType, err)))
+			return
+		}
+
+		data, err := json.Marshal(envelope)
+		if err != nil {
+			problem.Write(writer, request, problem.New(http.StatusInternalServerError, problem.CodeInternal, fmt.Sprintf("[XServer] [%s Handler] [Error] failed encode envelope: %s", handlerName, err)))
+			return
+		}
+		metrics.Inc("xserver_normalized_requests_total", "handler", handlerName, "type", mediaType)
+		request.Body = io.NopCloser(bytes.NewReader(data))
+		request.ContentLength = int64(len(data))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Content-Length", strconv.Itoa(len(data)))
+		request.Header.Set(NormalizedHeader, mediaType)
+		next(writer, request)
+	}
+}
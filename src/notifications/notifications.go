@@ -0,0 +1,246 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+	"xserver/src/config"
+	"xserver/src/logger"
+)
+
+const (
+	TaskFailed    = "task_failed"
+	HandlerErrors = "handler_errors"
+	ServerStarted = "server_started"
+	TaskNotRun    = "task_not_run"
+	TaskNotOk     = "task_not_succeeded"
+	CanaryFailed  = "canary_rolled_back"
+	SloBurnRate   = "slo_burn_rate"
+	HostResource  = "host_resource"
+	Quarantined   = "handler_quarantined"
+)
+
+var (
+	defaultTemplates = map[string]string{
+		TaskFailed:    `[XServer] task "{{.Unit}}" failed {{.Count}} times in a row: {{.Error}}`,
+		HandlerErrors: `[XServer] handler "{{.Unit}}" returned {{.Count}} errors in {{.Window}}: {{.Error}}`,
+		ServerStarted: `[XServer] server started on {{.Host}}`,
+		TaskNotRun:    `[XServer] task "{{.Unit}}" has not run within {{.Window}}`,
+		TaskNotOk:     `[XServer] task "{{.Unit}}" has not succeeded within {{.Window}}`,
+		CanaryFailed:  `[XServer] canary of handler "{{.Unit}}" rolled back: {{.Error}}`,
+		SloBurnRate:   `[XServer] handler "{{.Unit}}" burns {{.Slo}} SLO error budget {{printf "%.1f" .BurnRate}} times faster than allowed in {{.Window}}`,
+		HostResource:  `[XServer] {{.Unit}} usage {{printf "%.1f" .Value}} on {{.Host}} exceeds the {{printf "%.1f" .Threshold}} threshold`,
+		Quarantined:   `[XServer] handler "{{.Unit}}" quarantined for {{.Window}} after {{.Count}} immediate failures in a row: {{.Error}}`,
+	}
+	senders = map[string]func(client *http.Client, channel config.NotificationChannel, message string) error{
+		"slack":    sendSlack,
+		"discord":  sendDiscord,
+		"telegram": sendTelegram,
+	}
+)
+
+type Alert struct {
+	Kind      string
+	Unit      string
+	Count     int
+	Window    string
+	Error     string
+	Host      string
+	Slo       string
+	BurnRate  float64
+	Value     float64
+	Threshold float64
+	Time      time.Time
+}
+
+type handlerErrors struct {
+	errors      []time.Time
+	lastAlerted time.Time
+}
+
+type Notifications struct {
+	config        *config.Notifications
+	client        *http.Client
+	templates     map[string]*template.Template
+	window        time.Duration
+	mutex         sync.Mutex
+	taskFailures  map[string]int
+	handlerErrors map[string]*handlerErrors
+}
+
+func Create(config *config.Config) (*Notifications, error) {
+	window, err := time.ParseDuration(config.Notifications.HandlerErrorsWindow)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Notifications] [Error] failed parse handler errors window: %s", err)
+	}
+
+	notifications := &Notifications{
+		config:        &config.Notifications,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		templates:     map[string]*template.Template{},
+		window:        window,
+		taskFailures:  map[string]int{},
+		handlerErrors: map[string]*handlerErrors{},
+	}
+
+	for name, channel := range config.Notifications.Channels {
+		if _, ok := senders[channel.Type]; !ok {
+			return nil, fmt.Errorf(`[XServer] [Notifications] [Error] unknown type "%s" of "%s" channel`, channel.Type, name)
+		}
+	}
+
+	for kind, text := range defaultTemplates {
+		if customText, ok := config.Notifications.Templates[kind]; ok {
+			text = customText
+		}
+		messageTemplate, err := template.New(kind).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf(`[XServer] [Notifications] [Error] failed parse "%s" template: %s`, kind, err)
+		}
+		notifications.templates[kind] = messageTemplate
+	}
+
+	return notifications, nil
+}
+
+func (notifications *Notifications) Notify(alert Alert) {
+	if alert.Time.IsZero() {
+		alert.Time = time.Now()
+	}
+	if alert.Host == "" {
+		alert.Host, _ = os.Hostname()
+	}
+
+	messageTemplate, ok := notifications.templates[alert.Kind]
+	if !ok {
+		logger.Error(fmt.Sprintf(`[XServer] [Notifications] [Error] unknown alert kind "%s"`, alert.Kind))
+		return
+	}
+
+	message := &bytes.Buffer{}
+	if err := messageTemplate.Execute(message, alert); err != nil {
+		logger.Error(fmt.Sprintf(`[XServer] [Notifications] [Error] failed render "%s" template: %s`, alert.Kind, err))
+		return
+	}
+
+	logger.Info(fmt.Sprintf("[XServer] [Notifications] %s", message.String()))
+
+	for name, channel := range notifications.config.Channels {
+		channelName := name
+		currentChannel := channel
+		go func() {
+			if err := senders[currentChannel.Type](notifications.client, currentChannel, message.String()); err != nil {
+				logger.Error(fmt.Sprintf(`[XServer] [Notifications] [Error] failed notify "%s" channel: %s`, channelName, err))
+			}
+		}()
+	}
+}
+
+func (notifications *Notifications) TaskResult(taskName string, taskError error) {
+	notifications.mutex.Lock()
+	if taskError == nil {
+		notifications.taskFailures[taskName] = 0
+		notifications.mutex.Unlock()
+		return
+	}
+	notifications.taskFailures[taskName]++
+	failures := notifications.taskFailures[taskName]
+	notifications.mutex.Unlock()
+
+	threshold := notifications.config.TaskFailures
+	if threshold > 0 && failures%threshold == 0 {
+		notifications.Notify(Alert{
+			Kind:  TaskFailed,
+			Unit:  taskName,
+			Count: failures,
+			Error: taskError.Error(),
+		})
+	}
+}
+
+func (notifications *Notifications) HandlerResult(handlerName string, handlerError error) {
+	threshold := notifications.config.HandlerErrors
+	if handlerError == nil || threshold <= 0 {
+		return
+	}
+
+	now := time.Now()
+
+	notifications.mutex.Lock()
+	state, ok := notifications.handlerErrors[handlerName]
+	if !ok {
+		state = &handlerErrors{}
+		notifications.handlerErrors[handlerName] = state
+	}
+
+	errors := []time.Time{}
+	for _, errorTime := range state.errors {
+		if now.Sub(errorTime) < notifications.window {
+			errors = append(errors, errorTime)
+		}
+	}
+	state.errors = append(errors, now)
+
+	count := len(state.errors)
+	alert := count >= threshold && now.Sub(state.lastAlerted) >= notifications.window
+	if alert {
+		state.lastAlerted = now
+	}
+	notifications.mutex.Unlock()
+
+	if alert {
+		notifications.Notify(Alert{
+			Kind:   HandlerErrors,
+			Unit:   handlerName,
+			Count:  count,
+			Window: notifications.window.String(),
+			Error:  handlerError.Error(),
+		})
+	}
+}
+
+func (notifications *Notifications) ServerStarted() {
+	if notifications.config.ServerStart {
+		notifications.Notify(Alert{Kind: ServerStarted})
+	}
+}
+
+func post(client *http.Client, url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+	return nil
+}
+
+func sendSlack(client *http.Client, channel config.NotificationChannel, message string) error {
+	return post(client, channel.Url, map[string]string{"text": message})
+}
+
+func sendDiscord(client *http.Client, channel config.NotificationChannel, message string) error {
+	return post(client, channel.Url, map[string]string{"content": message})
+}
+
+func sendTelegram(client *http.Client, channel config.NotificationChannel, message string) error {
+	apiUrl := channel.Url
+	if apiUrl == "" {
+		apiUrl = fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", url.PathEscape(channel.Token))
+	}
+	return post(client, apiUrl, map[string]string{"chat_id": channel.ChatId, "text": message})
+}
@@ -0,0 +1,144 @@
+package notifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"xserver/src/config"
+)
+
+// channelServer responds the json bodies of notifications posted to the channel.
+func channelServer(t *testing.T) (*httptest.Server, chan map[string]string) {
+	t.Helper()
+	messages := make(chan map[string]string, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		message := map[string]string{}
+		json.NewDecoder(request.Body).Decode(&message)
+		messages <- message
+	}))
+	t.Cleanup(server.Close)
+	return server, messages
+}
+
+func waitMessage(t *testing.T, messages chan map[string]string) map[string]string {
+	t.Helper()
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification is not sent")
+	}
+	return nil
+}
+
+func noMessage(t *testing.T, messages chan map[string]string) {
+	t.Helper()
+	select {
+	case message := <-messages:
+		t.Fatalf("unexpected notification %v", message)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func create(t *testing.T, notificationsConfig config.Notifications) *Notifications {
+	t.Helper()
+	if notificationsConfig.HandlerErrorsWindow == "" {
+		notificationsConfig.HandlerErrorsWindow = "1m"
+	}
+	notifications, err := Create(&config.Config{Notifications: notificationsConfig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return notifications
+}
+
+func TestChannels(t *testing.T) {
+	tests := []struct {
+		channel string
+		field   string
+		chatId  string
+	}{
+		{channel: "slack", field: "text"},
+		{channel: "discord", field: "content"},
+		{channel: "telegram", field: "text", chatId: "42"},
+	}
+	for _, test := range tests {
+		t.Run(test.channel, func(t *testing.T) {
+			server, messages := channelServer(t)
+			notifications := create(t, config.Notifications{
+				Channels:    map[string]config.NotificationChannel{"alerts": {Type: test.channel, Url: server.URL, ChatId: test.chatId}},
+				ServerStart: true,
+			})
+			notifications.Notify(Alert{Kind: ServerStarted, Host: "host"})
+
+			message := waitMessage(t, messages)
+			if message[test.field] != "[XServer] server started on host" || message["chat_id"] != test.chatId {
+				t.Fatalf("unexpected message %v", message)
+			}
+		})
+	}
+}
+
+func TestTaskResult(t *testing.T) {
+	server, messages := channelServer(t)
+	notifications := create(t, config.Notifications{
+		Channels:     map[string]config.NotificationChannel{"alerts": {Type: "slack", Url: server.URL}},
+		Templates:    map[string]string{TaskFailed: "{{.Unit}} {{.Count}} {{.Error}}"},
+		TaskFailures: 2,
+	})
+
+	notifications.TaskResult("backup", fmt.Errorf("failed"))
+	noMessage(t, messages)
+	notifications.TaskResult("backup", fmt.Errorf("failed"))
+	if message := waitMessage(t, messages); message["text"] != "backup 2 failed" {
+		t.Fatalf("unexpected message %v", message)
+	}
+
+	notifications.TaskResult("backup", nil)
+	notifications.TaskResult("backup", fmt.Errorf("failed"))
+	noMessage(t, messages)
+}
+
+func TestHandlerResult(t *testing.T) {
+	server, messages := channelServer(t)
+	notifications := create(t, config.Notifications{
+		Channels:      map[string]config.NotificationChannel{"alerts": {Type: "slack", Url: server.URL}},
+		Templates:     map[string]string{HandlerErrors: "{{.Unit}} {{.Count}} {{.Window}}"},
+		HandlerErrors: 2,
+	})
+
+	notifications.HandlerResult("users", nil)
+	notifications.HandlerResult("users", fmt.Errorf("failed"))
+	noMessage(t, messages)
+	notifications.HandlerResult("users", fmt.Errorf("failed"))
+	if message := waitMessage(t, messages); message["text"] != "users 2 1m0s" {
+		t.Fatalf("unexpected message %v", message)
+	}
+
+	notifications.HandlerResult("users", fmt.Errorf("failed"))
+	noMessage(t, messages)
+}
+
+func TestCreateErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		notifications config.Notifications
+	}{
+		{name: "unknown channel type", notifications: config.Notifications{Channels: map[string]config.NotificationChannel{"alerts": {Type: "unknown"}}}},
+		{name: "invalid template", notifications: config.Notifications{Templates: map[string]string{TaskFailed: "{{.Unit"}}},
+		{name: "invalid window", notifications: config.Notifications{HandlerErrorsWindow: "invalid"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.notifications.HandlerErrorsWindow == "" {
+				test.notifications.HandlerErrorsWindow = "1m"
+			}
+			if _, err := Create(&config.Config{Notifications: test.notifications}); err == nil {
+				t.Fatal("invalid notifications config must be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package observability
+
+import (
+	"fmt"
+	"time"
+	"xserver/src/config"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+)
+
+func init() {
+	metrics.Register("xserver_metrics_push_failures_total", metrics.CounterType, "Number of failed pushes of metrics by exporter.")
+}
+
+type exporter interface {
+	name() string
+	push(samples []metrics.Sample, now time.Time) error
+}
+
+// Start pushes metrics by configured exporters every interval, the returned stop pushes them the last time.
+func Start(settings config.Observability) (func(), error) {
+	exporters := []exporter{}
+	if settings.Statsd != nil {
+		statsd, err := newStatsd(*settings.Statsd)
+		if err != nil {
+			return nil, fmt.Errorf("[XServer] [Observability] [Error] failed create statsd exporter: %s", err)
+		}
+		exporters = append(exporters, statsd)
+	}
+	if settings.RemoteWrite != nil {
+		exporters = append(exporters, newRemoteWrite(*settings.RemoteWrite))
+	}
+	if len(exporters) == 0 {
+		return func() {}, nil
+	}
+
+	interval, _ := time.ParseDuration(settings.Interval)
+	failed := map[string]bool{}
+	push := func() {
+		samples := metrics.Snapshot()
+		now := time.Now()
+		for _, current := range exporters {
+			err := current.push(samples, now)
+			if err != nil {
+				metrics.Inc("xserver_metrics_push_failures_total", "exporter", current.name())
+				if !failed[current.name()] {
+					logger.Error(fmt.Sprintf("[XServer] [Observability] [Error] failed push metrics by %s: %s", current.name(), err))
+				}
+			} else if failed[current.name()] {
+				logger.Info(fmt.Sprintf("[XServer] [Observability] metrics are pushed by %s again", current.name()))
+			}
+			failed[current.name()] = err != nil
+		}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				push()
+			case <-stop:
+				push()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}, nil
+}
@@ -0,0 +1,130 @@
+package observability
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"xserver/src/config"
+	"xserver/src/metrics"
+)
+
+// remoteWrite sends all samples by the Prometheus remote write protocol 1.0, protobuf messages are encoded by hand.
+type remoteWrite struct {
+	settings config.RemoteWrite
+	client   *http.Client
+}
+
+func newRemoteWrite(settings config.RemoteWrite) *remoteWrite {
+	return &remoteWrite{settings: settings, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (remoteWrite *remoteWrite) name() string {
+	return "remote_write"
+}
+
+func appendVarint(buffer []byte, value uint64) []byte {
+	return binary.AppendUvarint(buffer, value)
+}
+
+// appendField appends the length delimited protobuf field.
+func appendField(buffer []byte, field int, data []byte) []byte {
+	buffer = appendVarint(buffer, uint64(field<<3|2))
+	buffer = appendVarint(buffer, uint64(len(data)))
+	return append(buffer, data...)
+}
+
+func label(name string, value string) []byte {
+	encoded := appendField(nil, 1, []byte(name))
+	return appendField(encoded, 2, []byte(value))
+}
+
+// writeRequest encodes the WriteRequest of time series with one sample each, labels are sorted by name.
+func (remoteWrite *remoteWrite) writeRequest(samples []metrics.Sample, now time.Time) []byte {
+	request := []byte{}
+	for _, sample := range samples {
+		labels := map[string]string{}
+		for name, value := range remoteWrite.settings.Labels {
+			labels[name] = value
+		}
+		for i := 0; i+1 < len(sample.Labels); i += 2 {
+			labels[sample.Labels[i]] = sample.Labels[i+1]
+		}
+		labels["__name__"] = sample.Name
+
+		names := []string{}
+		for name := range labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		series := []byte{}
+		for _, name := range names {
+			series = appendField(series, 1, label(name, labels[name]))
+		}
+
+		encodedSample := []byte{1<<3 | 1}
+		encodedSample = binary.LittleEndian.AppendUint64(encodedSample, math.Float64bits(sample.Value))
+		encodedSample = appendVarint(encodedSample, 2<<3)
+		encodedSample = appendVarint(encodedSample, uint64(now.UnixMilli()))
+		series = appendField(series, 2, encodedSample)
+
+		request = appendField(request, 1, series)
+	}
+	return request
+}
+
+// snappyBlock encodes data to the snappy block format as literals without compression, it is valid for any snappy decoder.
+func snappyBlock(data []byte) []byte {
+	block := appendVarint(nil, uint64(len(data)))
+	const maxLiteral = 1 << 16
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > maxLiteral {
+			chunk = chunk[:maxLiteral]
+		}
+		length := len(chunk) - 1
+		if length < 60 {
+			block = append(block, byte(length<<2))
+		} else if length < 1<<8 {
+			block = append(block, 60<<2, byte(length))
+		} else {
+			block = append(block, 61<<2, byte(length), byte(length>>8))
+		}
+		block = append(block, chunk...)
+		data = data[len(chunk):]
+	}
+	return block
+}
+
+func (remoteWrite *remoteWrite) push(samples []metrics.Sample, now time.Time) error {
+	body := snappyBlock(remoteWrite.writeRequest(samples, now))
+	request, err := http.NewRequest(http.MethodPost, remoteWrite.settings.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-protobuf")
+	request.Header.Set("Content-Encoding", "snappy")
+	request.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if remoteWrite.settings.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+remoteWrite.settings.Token)
+	} else if remoteWrite.settings.Username != "" {
+		request.SetBasicAuth(remoteWrite.settings.Username, remoteWrite.settings.Password)
+	}
+
+	response, err := remoteWrite.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("remote write responded with %d status: %s", response.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
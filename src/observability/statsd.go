@@ -0,0 +1,106 @@
+package observability
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"xserver/src/config"
+	"xserver/src/metrics"
+)
+
+const (
+	// maxPacket keeps statsd packets within the common network MTU.
+	maxPacket = 1432
+)
+
+var (
+	unsafeName = regexp.MustCompile(`[^A-Za-z0-9_\-]`)
+)
+
+// statsd sends gauges values and counters increments since the previous push, labels are dogstatsd tags or name parts.
+type statsd struct {
+	settings config.Statsd
+	conn     net.Conn
+	tags     []string
+	counters map[string]float64
+}
+
+func newStatsd(settings config.Statsd) (*statsd, error) {
+	conn, err := net.Dial("udp", settings.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	for name, value := range settings.Tags {
+		tags = append(tags, name+":"+value)
+	}
+	sort.Strings(tags)
+	return &statsd{settings: settings, conn: conn, tags: tags, counters: map[string]float64{}}, nil
+}
+
+func (statsd *statsd) name() string {
+	return "statsd"
+}
+
+func (statsd *statsd) line(sample metrics.Sample, value float64, kind string) string {
+	name := statsd.settings.Prefix + sample.Name
+	tags := append([]string{}, statsd.tags...)
+	for i := 0; i+1 < len(sample.Labels); i += 2 {
+		if statsd.settings.Dogstatsd {
+			tags = append(tags, sample.Labels[i]+":"+strings.NewReplacer(",", "_", "|", "_").Replace(sample.Labels[i+1]))
+		} else {
+			name += "." + unsafeName.ReplaceAllString(sample.Labels[i+1], "_")
+		}
+	}
+
+	line := fmt.Sprintf("%s:%s|%s", name, strconv.FormatFloat(value, 'f', -1, 64), kind)
+	if statsd.settings.Dogstatsd && len(tags) != 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+func (statsd *statsd) push(samples []metrics.Sample, _ time.Time) error {
+	lines := []string{}
+	for _, sample := range samples {
+		if sample.Kind != metrics.CounterType {
+			lines = append(lines, statsd.line(sample, sample.Value, "g"))
+			continue
+		}
+
+		key := sample.Name + strings.Join(sample.Labels, "\x00")
+		delta := sample.Value - statsd.counters[key]
+		if delta < 0 {
+			delta = sample.Value
+		}
+		statsd.counters[key] = sample.Value
+		if delta != 0 {
+			lines = append(lines, statsd.line(sample, delta, "c"))
+		}
+	}
+
+	packet := &bytes.Buffer{}
+	for _, line := range lines {
+		if packet.Len() != 0 && packet.Len()+1+len(line) > maxPacket {
+			if _, err := statsd.conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() != 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() != 0 {
+		_, err := statsd.conn.Write(packet.Bytes())
+		return err
+	}
+	return nil
+}
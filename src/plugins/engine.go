@@ -0,0 +1,7 @@
+package plugins
+
+const (
+	EnginePlugin  = "plugin"
+	HandlerSymbol = "Handle"
+	FileName      = "handler.so"
+)
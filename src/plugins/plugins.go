@@ -0,0 +1,32 @@
+//go:build (linux || darwin || freebsd) && cgo
+
+package plugins
+
+import (
+	"fmt"
+	"net/http"
+	"plugin"
+)
+
+func Load(path string) (http.HandlerFunc, error) {
+	handlerPlugin, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed open plugin: %s", err)
+	}
+
+	symbol, err := handlerPlugin.Lookup(HandlerSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed lookup %s: %s", HandlerSymbol, err)
+	}
+
+	switch handler := symbol.(type) {
+	case func(http.ResponseWriter, *http.Request):
+		return handler, nil
+	case *func(http.ResponseWriter, *http.Request):
+		return *handler, nil
+	case *http.HandlerFunc:
+		return *handler, nil
+	}
+
+	return nil, fmt.Errorf("%s has type %T, expected func(http.ResponseWriter, *http.Request)", HandlerSymbol, symbol)
+}
@@ -0,0 +1,13 @@
+//go:build !((linux || darwin || freebsd) && cgo)
+
+package plugins
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+)
+
+func Load(path string) (http.HandlerFunc, error) {
+	return nil, fmt.Errorf("go plugins are not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,199 @@
+package problem
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"xserver/src/config"
+	"xserver/src/messages"
+)
+
+const (
+	ContentType     = "application/problem+json"
+	RequestIdHeader = "X-Request-Id"
+
+	CodeBadRequest           = "bad_request"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodeValidationFailed     = "validation_failed"
+	CodeIncompatibleProtocol = "incompatible_protocol"
+	CodeQuotaExceeded        = "quota_exceeded"
+	CodeRateLimited          = "rate_limited"
+	CodeReadOnly             = "read_only"
+	CodeMaintenance          = "maintenance"
+	CodeBusy                 = "busy"
+	CodeNotReady             = "not_ready"
+	CodeUnavailable          = "unavailable"
+	CodeHandlerDisabled      = "handler_disabled"
+	CodeHandlerFailed        = "handler_failed"
+	CodeHandlerQuarantined   = "handler_quarantined"
+	CodeInjectedFault        = "injected_fault"
+	CodeBadGateway           = "bad_gateway"
+	CodeDatabaseError        = "database_error"
+	CodeInternal             = "internal_error"
+)
+
+var (
+	format     = config.ErrorsLegacy
+	typePrefix = ""
+	structured = false
+	localized  = false
+	catalog, _ = messages.NewCatalog("en", nil)
+)
+
+// Configure sets the errors format and messages of all responses, messages are verified by the config.
+func Configure(settings config.Errors) {
+	format = settings.Format
+	typePrefix = settings.TypePrefix
+	structured = settings.Structured
+	localized = len(settings.Messages) != 0
+	if configured, err := messages.NewCatalog(settings.Language, settings.Messages); err == nil {
+		catalog = configured
+	}
+}
+
+// Problem is the error response, encoded as RFC 7807 problem+json or as the legacy {"result": ..., "error": ...} object.
+type Problem struct {
+	Status     int
+	Code       string
+	Detail     string
+	Result     interface{}
+	Errors     interface{}
+	Extensions map[string]interface{}
+}
+
+func New(status int, code string, detail string) *Problem {
+	return &Problem{Status: status, Code: code, Detail: detail, Extensions: map[string]interface{}{}}
+}
+
+// WithResult sets the "result" member of legacy responses.
+func (problem *Problem) WithResult(result interface{}) *Problem {
+	problem.Result = result
+	return problem
+}
+
+// WithErrors sets the "errors" member e.g. fields validation errors.
+func (problem *Problem) WithErrors(errors interface{}) *Problem {
+	problem.Errors = errors
+	return problem
+}
+
+// With sets the extension member.
+func (problem *Problem) With(name string, value interface{}) *Problem {
+	problem.Extensions[name] = value
+	return problem
+}
+
+// detail returns the message of the code in the language or the detail, structured details are split from their prefixes to the scope.
+func (problem *Problem) detail(language string) (string, []string, bool) {
+	message := messages.Split(problem.Detail)
+	data := map[string]interface{}{}
+	for name, value := range problem.Extensions {
+		data[name] = value
+	}
+	data["status"] = problem.Status
+	data["code"] = problem.Code
+	data["detail"] = message.Text
+	data["scope"] = message.Scope
+	if text, ok := catalog.Format(language, problem.Code, data); ok {
+		return text, message.Scope, true
+	}
+	if structured {
+		return message.Text, message.Scope, false
+	}
+	return problem.Detail, nil, false
+}
+
+func (problem *Problem) body(requestId string, instance string, detail string, scope []string) map[string]interface{} {
+	body := map[string]interface{}{}
+	for name, value := range problem.Extensions {
+		body[name] = value
+	}
+
+	if format == config.ErrorsProblem {
+		body["type"] = typePrefix + problem.Code
+		body["title"] = http.StatusText(problem.Status)
+		body["status"] = problem.Status
+		body["detail"] = detail
+		if instance != "" {
+			body["instance"] = instance
+		}
+	} else {
+		if problem.Result != nil {
+			body["result"] = problem.Result
+		}
+		body["error"] = detail
+	}
+	if structured {
+		body["scope"] = scope
+	}
+
+	body["code"] = problem.Code
+	if problem.Errors != nil {
+		body["errors"] = problem.Errors
+	}
+	if requestId != "" {
+		body["request_id"] = requestId
+	}
+	return body
+}
+
+// Encode writes the problem without response headers e.g. to the streamed response.
+func (problem *Problem) Encode(writer io.Writer, requestId string) {
+	detail, scope, _ := problem.detail(catalog.Negotiate(""))
+	data, _ := json.Marshal(problem.body(requestId, "", detail, scope))
+	writer.Write(append(data, '\n'))
+}
+
+func (problem *Problem) ContentType() string {
+	if format == config.ErrorsProblem {
+		return ContentType
+	}
+	return "application/json"
+}
+
+// Write responds the problem with its status, the message is in the language negotiated by the Accept-Language header.
+func Write(writer http.ResponseWriter, request *http.Request, problem *Problem) {
+	language := catalog.Negotiate(request.Header.Get("Accept-Language"))
+	detail, scope, translated := problem.detail(language)
+	data, _ := json.Marshal(problem.body(RequestId(request), request.URL.Path, detail, scope))
+	if translated {
+		writer.Header().Set("Content-Language", language)
+	}
+	if localized {
+		writer.Header().Add("Vary", "Accept-Language")
+	}
+	writer.Header().Set("Content-Type", problem.ContentType())
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	writer.WriteHeader(problem.Status)
+	writer.Write(append(data, '\n'))
+}
+
+// RequestId returns the request id assigned by Handler.
+func RequestId(request *http.Request) string {
+	return request.Header.Get(RequestIdHeader)
+}
+
+func newRequestId() string {
+	data := make([]byte, 8)
+	rand.Read(data)
+	return hex.EncodeToString(data)
+}
+
+// Handler assigns the request id: the one sent by the client in X-Request-Id header or a generated one, and responds it in the same header.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requestId := request.Header.Get(RequestIdHeader)
+		if requestId == "" || len(requestId) > 128 {
+			requestId = newRequestId()
+			request.Header.Set(RequestIdHeader, requestId)
+		}
+		writer.Header().Set(RequestIdHeader, requestId)
+		next.ServeHTTP(writer, request)
+	})
+}
@@ -0,0 +1,109 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"xserver/src/config"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name        string
+		settings    config.Errors
+		language    string
+		contentType string
+		body        map[string]interface{}
+	}{
+		{
+			name:        "legacy",
+			settings:    config.Errors{Format: config.ErrorsLegacy},
+			contentType: "application/json",
+			body:        map[string]interface{}{"code": "not_found", "error": "[XServer] [Test] [Error] missing", "result": false, "request_id": "id", "limit": 1.0},
+		},
+		{
+			name:        "problem",
+			settings:    config.Errors{Format: config.ErrorsProblem, TypePrefix: "https://errors/"},
+			contentType: ContentType,
+			body: map[string]interface{}{
+				"code": "not_found", "type": "https://errors/not_found", "title": "Not Found", "status": 404.0,
+				"detail": "[XServer] [Test] [Error] missing", "instance": "/path", "request_id": "id", "limit": 1.0,
+			},
+		},
+		{
+			name:        "structured",
+			settings:    config.Errors{Format: config.ErrorsLegacy, Structured: true},
+			contentType: "application/json",
+			body:        map[string]interface{}{"code": "not_found", "error": "missing", "scope": []interface{}{"XServer", "Test"}, "result": false, "request_id": "id", "limit": 1.0},
+		},
+		{
+			name:        "localized",
+			settings:    config.Errors{Format: config.ErrorsLegacy, Language: "en", Messages: map[string]map[string]string{"de": {"not_found": "Nicht gefunden {{.limit}}"}}},
+			language:    "de",
+			contentType: "application/json",
+			body:        map[string]interface{}{"code": "not_found", "error": "Nicht gefunden 1", "result": false, "request_id": "id", "limit": 1.0},
+		},
+	}
+	defer Configure(config.Errors{Format: config.ErrorsLegacy})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			Configure(test.settings)
+			request := httptest.NewRequest(http.MethodGet, "/path", nil)
+			request.Header.Set(RequestIdHeader, "id")
+			if test.language != "" {
+				request.Header.Set("Accept-Language", test.language)
+			}
+			recorder := httptest.NewRecorder()
+			Write(recorder, request, New(http.StatusNotFound, CodeNotFound, "[XServer] [Test] [Error] missing").WithResult(false).With("limit", 1))
+
+			if recorder.Code != http.StatusNotFound || recorder.Header().Get("Content-Type") != test.contentType {
+				t.Fatalf("unexpected response %d %s", recorder.Code, recorder.Header().Get("Content-Type"))
+			}
+			body := map[string]interface{}{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(body, test.body) {
+				t.Fatalf("unexpected body %v", body)
+			}
+			if test.language != "" && recorder.Header().Get("Content-Language") != test.language {
+				t.Fatalf("unexpected content language %q", recorder.Header().Get("Content-Language"))
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestId string
+		kept      bool
+	}{
+		{name: "client id", requestId: "client", kept: true},
+		{name: "generated id"},
+		{name: "too long id", requestId: string(make([]byte, 129))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			received := ""
+			handler := Handler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				received = RequestId(request)
+			}))
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.requestId != "" {
+				request.Header.Set(RequestIdHeader, test.requestId)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if received == "" || recorder.Header().Get(RequestIdHeader) != received {
+				t.Fatalf("unexpected request id %q responded as %q", received, recorder.Header().Get(RequestIdHeader))
+			}
+			if (received == test.requestId) != test.kept {
+				t.Fatalf("unexpected request id %q", received)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"xserver/src/config"
+	"xserver/src/snapshots"
+)
+
+const (
+	projectFile   = "project.json"
+	projectConfig = "config.yml"
+)
+
+// Project describes the exported project archive.
+type Project struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Built     bool      `json:"built"`
+	Files     []string  `json:"files"`
+	Secrets   []string  `json:"secrets"`
+}
+
+// projectPath returns the slash separated path relative to the working directory, other paths are not portable.
+func projectPath(path string) (string, error) {
+	directory, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	relative, err := filepath.Rel(directory, absolute)
+	if err != nil || !filepath.IsLocal(relative) {
+		return "", fmt.Errorf(`"%s" is outside of the project directory`, path)
+	}
+	return filepath.ToSlash(relative), nil
+}
+
+// addProjectPath adds the file or files of the directory except the skipped one to the entries.
+func addProjectPath(entries map[string]snapshots.Entry, path string, skip string) error {
+	return filepath.WalkDir(path, func(current string, file fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if file.IsDir() {
+			if skip != "" && filepath.Clean(current) == filepath.Clean(skip) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !file.Type().IsRegular() {
+			return nil
+		}
+		name, err := projectPath(current)
+		if err != nil {
+			return err
+		}
+		info, err := file.Info()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(current)
+		if err != nil {
+			return err
+		}
+		entries[name] = snapshots.Entry{Name: name, Mode: info.Mode().Perm(), Data: data}
+		return nil
+	})
+}
+
+// addUnitsSources adds files and resources of units, git units are fetched by the build on the target machine.
+func addUnitsSources(entries map[string]snapshots.Entry, units map[string]config.ExecutableServerUnit) error {
+	for unitName, unit := range units {
+		if unit.Mock != nil || unit.Report != nil || unit.Git != nil || unit.File == "" {
+			continue
+		}
+		for _, path := range append([]string{unit.File}, unit.Resources...) {
+			if err := addProjectPath(entries, path, ""); err != nil {
+				return fmt.Errorf(`failed export "%s" sources: %s`, unitName, err)
+			}
+		}
+	}
+	return nil
+}
+
+func exportCommand(exportConfig *config.Config, arguments []string) error {
+	parsed, err := parseArguments(arguments)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) != 0 {
+		usage()
+		return nil
+	}
+	built := parsed.Bool("--built")
+	output := parsed.String("--output", "")
+	createdAt := time.Now().UTC()
+	if output == "" {
+		output = "xserver-export-" + createdAt.Format("20060102T150405Z") + ".tar.gz"
+	}
+
+	entries := map[string]snapshots.Entry{}
+	configData, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Export] [Error] failed read config: %s", err)
+	}
+	entries[projectConfig] = snapshots.Entry{Name: projectConfig, Data: configData}
+
+	if exportConfig.Database.Enable {
+		if err := addProjectPath(entries, exportConfig.Database.Schema, ""); err != nil {
+			return fmt.Errorf("[XServer] [Export] [Error] failed export database schema: %s", err)
+		}
+	}
+	if exportConfig.Build.VerifyKey != "" {
+		if err := addProjectPath(entries, exportConfig.Build.VerifyKey, ""); err != nil {
+			return fmt.Errorf("[XServer] [Export] [Error] failed export build verify key: %s", err)
+		}
+	}
+	if built {
+		if _, err := os.Stat(exportConfig.Build.OutputDir); err != nil {
+			return fmt.Errorf("[XServer] [Export] [Error] project is not built, run xserver build before export: %s", err)
+		}
+		if err := addProjectPath(entries, exportConfig.Build.OutputDir, exportConfig.SourcesOutputDir()); err != nil {
+			return fmt.Errorf("[XServer] [Export] [Error] failed export built units: %s", err)
+		}
+	} else {
+		for _, units := range []map[string]config.ExecutableServerUnit{exportConfig.Handlers, exportConfig.Tasks} {
+			if err := addUnitsSources(entries, units); err != nil {
+				return fmt.Errorf("[XServer] [Export] [Error] %s", err)
+			}
+		}
+	}
+
+	names := []string{}
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	project := Project{Version: exportConfig.Version, CreatedAt: createdAt, Built: built, Files: names, Secrets: exportConfig.SecretsEnv()}
+	if config.Encrypted(configData) {
+		project.Secrets = append(project.Secrets, config.KeyEnv)
+	}
+	projectData, err := json.MarshalIndent(project, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	archiveEntries := []snapshots.Entry{{Name: projectFile, Data: projectData}}
+	for _, name := range names {
+		archiveEntries = append(archiveEntries, entries[name])
+	}
+	data, err := snapshots.Archive(archiveEntries, createdAt)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Export] [Error] failed write archive: %s", err)
+	}
+	if err := os.WriteFile(output, data, 0600); err != nil {
+		return fmt.Errorf("[XServer] [Export] [Error] failed write archive: %s", err)
+	}
+
+	fmt.Printf("[XServer] [Export] exported %d files to %s\n", len(names), output)
+	if len(project.Secrets) != 0 {
+		fmt.Printf("[XServer] [Export] secrets aren't exported, set them on the target machine: %s\n", strings.Join(project.Secrets, ", "))
+	}
+	return nil
+}
+
+// importFile writes the imported file, the replaced file is kept with the .bak suffix.
+func importFile(path string, entry snapshots.Entry) error {
+	if current, err := os.ReadFile(path); err == nil {
+		if bytes.Equal(current, entry.Data) {
+			return nil
+		}
+		if err := os.WriteFile(path+".bak", current, 0644); err != nil {
+			return fmt.Errorf(`failed write "%s" backup: %s`, path, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, entry.Data, entry.Mode); err != nil {
+		return fmt.Errorf(`failed write "%s": %s`, path, err)
+	}
+	if err := os.Chmod(path, entry.Mode); err != nil {
+		return err
+	}
+	fmt.Printf("[XServer] [Import] imported %s\n", path)
+	return nil
+}
+
+// importCommand writes files of the exported project to the working directory, changed files are replaced with --force only.
+func importCommand(_ *config.Config, arguments []string) error {
+	parsed, err := parseArguments(arguments)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Positional) != 1 {
+		usage()
+		return nil
+	}
+	force := parsed.Bool("--force")
+	archivePath := parsed.Positional[0]
+
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Import] [Error] failed read archive: %s", err)
+	}
+	entries, err := snapshots.Extract(data)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Import] [Error] %s", err)
+	}
+
+	project := &Project{}
+	files := []snapshots.Entry{}
+	for _, entry := range entries {
+		if entry.Name == projectFile {
+			if err := json.Unmarshal(entry.Data, project); err != nil {
+				return fmt.Errorf("[XServer] [Import] [Error] failed parse %s: %s", projectFile, err)
+			}
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(entry.Name)) {
+			return fmt.Errorf(`[XServer] [Import] [Error] archive file "%s" is outside of the project directory`, entry.Name)
+		}
+		files = append(files, entry)
+	}
+	if project.CreatedAt.IsZero() {
+		return fmt.Errorf("[XServer] [Import] [Error] archive has no %s, create it by xserver export", projectFile)
+	}
+
+	path := func(name string) string {
+		if name == projectConfig {
+			return configPath
+		}
+		return filepath.FromSlash(name)
+	}
+	conflicts := []string{}
+	for _, entry := range files {
+		if current, err := os.ReadFile(path(entry.Name)); err == nil && !bytes.Equal(current, entry.Data) {
+			conflicts = append(conflicts, path(entry.Name))
+		}
+	}
+	if len(conflicts) != 0 && !force {
+		return fmt.Errorf("[XServer] [Import] [Error] files differ from the archive: %s, use --force to replace them", strings.Join(conflicts, ", "))
+	}
+
+	for _, entry := range files {
+		if err := importFile(path(entry.Name), entry); err != nil {
+			return fmt.Errorf("[XServer] [Import] [Error] %s", err)
+		}
+	}
+
+	missing := []string{}
+	for _, secret := range project.Secrets {
+		if os.Getenv(secret) == "" {
+			missing = append(missing, secret)
+		}
+	}
+	if len(missing) != 0 {
+		fmt.Printf("[XServer] [Import] set secrets environment variables: %s\n", strings.Join(missing, ", "))
+	} else if _, err := config.Load(configPath); err != nil {
+		return fmt.Errorf("[XServer] [Import] [Error] failed load imported config: %s", err)
+	}
+
+	if project.Built {
+		fmt.Println("[XServer] [Import] imported built units, run xserver doctor to check toolchains of the machine")
+	} else {
+		fmt.Println("[XServer] [Import] imported, run xserver build to build units")
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package protobuf
+
+// Schema is the protobuf schema of database requests and responses and of the jsonrpc handlers protocol with protobuf encoding,
+// it is generated by "xserver init" for protoc.
+const Schema = `// Code generated by "xserver init". DO NOT EDIT.
+syntax = "proto3";
+
+package xserver;
+
+// Database operations requests of /db endpoints with Content-Type: application/x-protobuf.
+message Field {
+  string name = 1;
+  string value = 2;
+}
+
+message Filter {
+  string name = 1;
+  string operator = 2;
+  string value = 3;
+}
+
+message Request {
+  string table = 1;
+  repeated Field fields = 2;
+  repeated Filter filters = 3;
+  bool with_deleted = 4;
+  repeated string include = 5;
+  optional int64 if_revision = 6;
+  string unredact = 7;
+  int64 limit = 8;
+  string cursor = 9;
+}
+
+// Value is the json value of responses.
+message Value {
+  oneof kind {
+    bool null = 1;
+    double number = 2;
+    string string = 3;
+    bool bool = 4;
+    Object object = 5;
+    List list = 6;
+  }
+}
+
+message Object {
+  map<string, Value> fields = 1;
+}
+
+message List {
+  repeated Value values = 1;
+}
+
+// Response is the json response of /db endpoints with Accept: application/x-protobuf, other members are in extra.
+message Response {
+  Value result = 1;
+  string error = 2;
+  string code = 3;
+  Object extra = 4;
+}
+
+// Messages of jsonrpc handlers with encoding: protobuf, every message is prefixed by its varint length.
+message Values {
+  repeated string values = 1;
+}
+
+message RpcRequest {
+  int64 id = 1;
+  int32 version = 2;
+  string method = 3;
+  string path = 4;
+  string query = 5;
+  map<string, Values> headers = 6;
+  bytes body = 7;
+}
+
+message RpcBatch {
+  int64 id = 1;
+  int32 version = 2;
+  repeated RpcRequest requests = 3;
+}
+
+// RpcMessage is the message sent to the handler process.
+message RpcMessage {
+  oneof kind {
+    RpcRequest request = 1;
+    RpcBatch batch = 2;
+  }
+}
+
+// RpcResponse is the message sent by the handler process, responses of batches are in responses.
+message RpcResponse {
+  int64 id = 1;
+  int32 version = 2;
+  int32 status = 3;
+  map<string, string> headers = 4;
+  bytes body = 5;
+  repeated RpcResponse responses = 6;
+}
+`
@@ -0,0 +1,146 @@
+package protobuf
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Fields of the Value, Object and List messages of the schema.
+const (
+	valueNull   = 1
+	valueNumber = 2
+	valueString = 3
+	valueBool   = 4
+	valueObject = 5
+	valueList   = 6
+
+	objectFields = 1
+	entryKey     = 1
+	entryValue   = 2
+	listValues   = 1
+)
+
+// EncodeValue encodes the decoded json value as the Value message.
+func EncodeValue(value interface{}) ([]byte, error) {
+	encoder := &Encoder{}
+	switch value := value.(type) {
+	case nil:
+		encoder.Varint(valueNull, 1)
+	case float64:
+		encoder.Double(valueNumber, value)
+	case json.Number:
+		number, err := value.Float64()
+		if err != nil {
+			return nil, err
+		}
+		encoder.Double(valueNumber, number)
+	case string:
+		encoder.Raw(valueString, []byte(value))
+	case bool:
+		flag := uint64(0)
+		if value {
+			flag = 1
+		}
+		encoder.Varint(valueBool, flag)
+	case map[string]interface{}:
+		object, err := EncodeObject(value)
+		if err != nil {
+			return nil, err
+		}
+		encoder.Raw(valueObject, object)
+	case []interface{}:
+		list := &Encoder{}
+		for _, item := range value {
+			data, err := EncodeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list.Raw(listValues, data)
+		}
+		encoder.Raw(valueList, list.Data())
+	default:
+		return nil, fmt.Errorf("unsupported value %T", value)
+	}
+	return encoder.Data(), nil
+}
+
+// EncodeObject encodes the json object as the Object message, entries are sorted by keys so encoding is stable.
+func EncodeObject(object map[string]interface{}) ([]byte, error) {
+	keys := []string{}
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	encoder := &Encoder{}
+	for _, key := range keys {
+		data, err := EncodeValue(object[key])
+		if err != nil {
+			return nil, err
+		}
+		entry := &Encoder{}
+		entry.String(entryKey, key)
+		entry.Raw(entryValue, data)
+		encoder.Raw(objectFields, entry.Data())
+	}
+	return encoder.Data(), nil
+}
+
+// DecodeValue decodes the Value message as the json value, the empty message is null.
+func DecodeValue(data []byte) (interface{}, error) {
+	var result interface{}
+	err := Decode(data, func(field Field) error {
+		var err error
+		switch field.Number {
+		case valueNull:
+			result = nil
+		case valueNumber:
+			result = field.Double()
+		case valueString:
+			result = field.String()
+		case valueBool:
+			result = field.Bool()
+		case valueObject:
+			result, err = DecodeObject(field.Data)
+		case valueList:
+			list := []interface{}{}
+			err = Decode(field.Data, func(item Field) error {
+				if item.Number != listValues {
+					return nil
+				}
+				value, err := DecodeValue(item.Data)
+				list = append(list, value)
+				return err
+			})
+			result = list
+		}
+		return err
+	})
+	return result, err
+}
+
+// DecodeObject decodes the Object message as the json object.
+func DecodeObject(data []byte) (map[string]interface{}, error) {
+	object := map[string]interface{}{}
+	err := Decode(data, func(field Field) error {
+		if field.Number != objectFields {
+			return nil
+		}
+		key := ""
+		var value interface{}
+		err := Decode(field.Data, func(entry Field) error {
+			var err error
+			switch entry.Number {
+			case entryKey:
+				key = entry.String()
+			case entryValue:
+				value, err = DecodeValue(entry.Data)
+			}
+			return err
+		})
+		object[key] = value
+		return err
+	})
+	return object, err
+}
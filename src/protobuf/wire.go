@@ -0,0 +1,186 @@
+package protobuf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"strings"
+)
+
+const (
+	ContentType = "application/x-protobuf"
+
+	VarintType  = 0
+	Fixed64Type = 1
+	BytesType   = 2
+	Fixed32Type = 5
+
+	// maxMessageSize is the max size of length delimited messages read from streams.
+	maxMessageSize = 64 * 1024 * 1024
+)
+
+var (
+	errTruncated = errors.New("truncated protobuf message")
+)
+
+// Is reports whether the content type is protobuf, application/protobuf is accepted too.
+func Is(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == ContentType || mediaType == "application/protobuf")
+}
+
+// Accepts reports whether the Accept header names protobuf.
+func Accepts(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		if Is(strings.TrimSpace(part)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Encoder appends fields of the message, zero values are skipped like proto3 does.
+type Encoder struct {
+	data []byte
+}
+
+func (encoder *Encoder) Data() []byte {
+	return encoder.data
+}
+
+func (encoder *Encoder) tag(number int, wireType int) {
+	encoder.data = binary.AppendUvarint(encoder.data, uint64(number)<<3|uint64(wireType))
+}
+
+// Varint appends the varint field even when it is zero, e.g. a oneof false.
+func (encoder *Encoder) Varint(number int, value uint64) {
+	encoder.tag(number, VarintType)
+	encoder.data = binary.AppendUvarint(encoder.data, value)
+}
+
+func (encoder *Encoder) Int(number int, value int64) {
+	if value != 0 {
+		encoder.Varint(number, uint64(value))
+	}
+}
+
+func (encoder *Encoder) Bool(number int, value bool) {
+	if value {
+		encoder.Varint(number, 1)
+	}
+}
+
+func (encoder *Encoder) Double(number int, value float64) {
+	encoder.tag(number, Fixed64Type)
+	encoder.data = binary.LittleEndian.AppendUint64(encoder.data, math.Float64bits(value))
+}
+
+// Raw appends the length delimited field even when it is empty, e.g. an empty nested message or a oneof string.
+func (encoder *Encoder) Raw(number int, value []byte) {
+	encoder.tag(number, BytesType)
+	encoder.data = binary.AppendUvarint(encoder.data, uint64(len(value)))
+	encoder.data = append(encoder.data, value...)
+}
+
+func (encoder *Encoder) Bytes(number int, value []byte) {
+	if len(value) != 0 {
+		encoder.Raw(number, value)
+	}
+}
+
+func (encoder *Encoder) String(number int, value string) {
+	if value != "" {
+		encoder.Raw(number, []byte(value))
+	}
+}
+
+// Field is the decoded field, Data is the value of length delimited fields and Value of others.
+type Field struct {
+	Number   int
+	WireType int
+	Value    uint64
+	Data     []byte
+}
+
+func (field Field) Int() int64 {
+	return int64(field.Value)
+}
+
+func (field Field) Bool() bool {
+	return field.Value != 0
+}
+
+func (field Field) Double() float64 {
+	return math.Float64frombits(field.Value)
+}
+
+func (field Field) String() string {
+	return string(field.Data)
+}
+
+// Decode calls the visitor for every field of the message, unknown fields are skipped by the visitor.
+func Decode(data []byte, visit func(field Field) error) error {
+	for len(data) != 0 {
+		key, size := binary.Uvarint(data)
+		if size <= 0 {
+			return errTruncated
+		}
+		data = data[size:]
+		field := Field{Number: int(key >> 3), WireType: int(key & 7)}
+		switch field.WireType {
+		case VarintType:
+			if field.Value, size = binary.Uvarint(data); size <= 0 {
+				return errTruncated
+			}
+			data = data[size:]
+		case Fixed64Type:
+			if len(data) < 8 {
+				return errTruncated
+			}
+			field.Value, data = binary.LittleEndian.Uint64(data), data[8:]
+		case Fixed32Type:
+			if len(data) < 4 {
+				return errTruncated
+			}
+			field.Value, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		case BytesType:
+			length, size := binary.Uvarint(data)
+			if size <= 0 || uint64(len(data)-size) < length {
+				return errTruncated
+			}
+			field.Data, data = data[size:size+int(length)], data[size+int(length):]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", field.WireType)
+		}
+		if err := visit(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteDelimited writes the message prefixed by its varint length.
+func WriteDelimited(writer io.Writer, message []byte) error {
+	_, err := writer.Write(append(binary.AppendUvarint(nil, uint64(len(message))), message...))
+	return err
+}
+
+// ReadDelimited reads the message prefixed by its varint length.
+func ReadDelimited(reader *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxMessageSize {
+		return nil, fmt.Errorf("protobuf message exceeds %d bytes", maxMessageSize)
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(reader, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
@@ -0,0 +1,169 @@
+package quarantine
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+	"xserver/src/problem"
+)
+
+func init() {
+	metrics.Register("xserver_handler_quarantined", metrics.GaugeType, "1 if the handler is quarantined after failing immediately in a row.")
+	metrics.Register("xserver_handler_quarantines_total", metrics.CounterType, "Number of handlers quarantines.")
+}
+
+// Entry is the quarantined handler, it is served again after Until.
+type Entry struct {
+	Handler  string    `json:"handler"`
+	Failures int       `json:"failures"`
+	Error    string    `json:"error"`
+	Since    time.Time `json:"since"`
+	Until    time.Time `json:"until"`
+}
+
+type handler struct {
+	failures int
+	err      string
+	since    time.Time
+	until    time.Time
+}
+
+type Quarantine struct {
+	failures      int
+	within        time.Duration
+	duration      time.Duration
+	onQuarantined func(entry Entry)
+	mutex         sync.Mutex
+	handlers      map[string]*handler
+}
+
+func Create(settings config.Quarantine, onQuarantined func(entry Entry)) (*Quarantine, error) {
+	within, err := time.ParseDuration(settings.Within)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Quarantine] [Error] failed parse within: %s", err)
+	}
+	duration, err := time.ParseDuration(settings.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Quarantine] [Error] failed parse duration: %s", err)
+	}
+	return &Quarantine{
+		failures:      settings.Failures,
+		within:        within,
+		duration:      duration,
+		onQuarantined: onQuarantined,
+		handlers:      map[string]*handler{},
+	}, nil
+}
+
+// Reject responds 503 Service Unavailable while the handler is quarantined.
+func (quarantine *Quarantine) Reject(handlerName string, writer http.ResponseWriter, request *http.Request) bool {
+	if quarantine == nil || quarantine.failures < 0 {
+		return false
+	}
+
+	quarantine.mutex.Lock()
+	current, ok := quarantine.handlers[handlerName]
+	quarantined := ok && time.Now().Before(current.until)
+	var entry Entry
+	if quarantined {
+		entry = Entry{Handler: handlerName, Failures: current.failures, Error: current.err, Since: current.since, Until: current.until}
+	}
+	quarantine.mutex.Unlock()
+	if !quarantined {
+		return false
+	}
+
+	retryAfter := int(math.Ceil(time.Until(entry.Until).Seconds()))
+	writer.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	problem.Write(writer, request, problem.New(
+		http.StatusServiceUnavailable,
+		problem.CodeHandlerQuarantined,
+		fmt.Sprintf("[XServer] [%s Handler] [Error] handler is quarantined until %s after %d immediate failures in a row: %s", handlerName, entry.Until.Format(time.RFC3339), entry.Failures, entry.Error),
+	).With("quarantined_until", entry.Until))
+	return true
+}
+
+// Result counts failures of processes exited within the quarantine time after the start, other results reset the count.
+// The handler served again after the quarantine is quarantined by its next immediate failure.
+func (quarantine *Quarantine) Result(handlerName string, duration time.Duration, err error) {
+	if quarantine == nil || quarantine.failures < 0 {
+		return
+	}
+
+	quarantine.mutex.Lock()
+	current, ok := quarantine.handlers[handlerName]
+	if err == nil || duration > quarantine.within {
+		if ok {
+			delete(quarantine.handlers, handlerName)
+			metrics.Set("xserver_handler_quarantined", 0, "handler", handlerName)
+		}
+		quarantine.mutex.Unlock()
+		return
+	}
+	if !ok {
+		current = &handler{}
+		quarantine.handlers[handlerName] = current
+	}
+
+	now := time.Now()
+	current.failures++
+	current.err = err.Error()
+	if current.failures < quarantine.failures || now.Before(current.until) {
+		quarantine.mutex.Unlock()
+		return
+	}
+	current.since = now
+	current.until = now.Add(quarantine.duration)
+	entry := Entry{Handler: handlerName, Failures: current.failures, Error: current.err, Since: current.since, Until: current.until}
+	quarantine.mutex.Unlock()
+
+	logger.Error(fmt.Sprintf("[XServer] [%s Handler] [Error] handler quarantined until %s after %d immediate failures in a row: %s", handlerName, entry.Until.Format(time.RFC3339), entry.Failures, entry.Error))
+	metrics.Set("xserver_handler_quarantined", 1, "handler", handlerName)
+	metrics.Inc("xserver_handler_quarantines_total", "handler", handlerName)
+	quarantine.onQuarantined(entry)
+}
+
+// List returns handlers quarantined now.
+func (quarantine *Quarantine) List() []Entry {
+	quarantine.mutex.Lock()
+	defer quarantine.mutex.Unlock()
+
+	now := time.Now()
+	entries := []Entry{}
+	for handlerName, current := range quarantine.handlers {
+		if now.Before(current.until) {
+			entries = append(entries, Entry{Handler: handlerName, Failures: current.failures, Error: current.err, Since: current.since, Until: current.until})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Handler < entries[j].Handler })
+	return entries
+}
+
+// Release serves the handler again and resets its failures.
+func (quarantine *Quarantine) Release(handlerName string) bool {
+	if quarantine == nil {
+		return false
+	}
+
+	quarantine.mutex.Lock()
+	defer quarantine.mutex.Unlock()
+
+	current, ok := quarantine.handlers[handlerName]
+	if !ok {
+		return false
+	}
+	delete(quarantine.handlers, handlerName)
+	metrics.Set("xserver_handler_quarantined", 0, "handler", handlerName)
+	if time.Now().Before(current.until) {
+		logger.Info(fmt.Sprintf("[XServer] [%s Handler] handler released from quarantine", handlerName))
+		return true
+	}
+	return false
+}
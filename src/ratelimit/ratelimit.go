@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/metrics"
+	"xserver/src/problem"
+)
+
+func init() {
+	metrics.Register("xserver_rate_limited_total", metrics.CounterType, "Number of handlers requests rejected by rate limits.")
+}
+
+// bucket allows requests per window with bursts up to requests, tokens are refilled continuously.
+type bucket struct {
+	capacity float64
+	rate     float64
+	tokens   float64
+	updated  time.Time
+}
+
+type Limits struct {
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+}
+
+// Create creates rate limits of handlers with rate_limit settings, settings are verified by the config.
+func Create(handlers map[string]config.ExecutableServerUnit) *Limits {
+	limits := &Limits{buckets: map[string]*bucket{}}
+	for handlerName, handler := range handlers {
+		if handler.RateLimit == nil {
+			continue
+		}
+		window, _ := time.ParseDuration(handler.RateLimit.Window)
+		capacity := float64(handler.RateLimit.Requests)
+		limits.buckets[handlerName] = &bucket{
+			capacity: capacity,
+			rate:     capacity / window.Seconds(),
+			tokens:   capacity,
+			updated:  time.Now(),
+		}
+	}
+	return limits
+}
+
+// Reject rejects the handler request with 429 if the handler rate limit is exceeded.
+func (limits *Limits) Reject(handlerName string, writer http.ResponseWriter, request *http.Request) bool {
+	if limits == nil {
+		return false
+	}
+	current, ok := limits.buckets[handlerName]
+	if !ok {
+		return false
+	}
+
+	now := time.Now()
+	limits.mutex.Lock()
+	current.tokens = math.Min(current.capacity, current.tokens+now.Sub(current.updated).Seconds()*current.rate)
+	current.updated = now
+	allowed := current.tokens >= 1
+	if allowed {
+		current.tokens--
+	}
+	retryAfter := int(math.Ceil((1 - current.tokens) / current.rate))
+	limits.mutex.Unlock()
+
+	if allowed {
+		return false
+	}
+	metrics.Inc("xserver_rate_limited_total", "handler", handlerName)
+	writer.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	problem.Write(writer, request, problem.New(http.StatusTooManyRequests, problem.CodeRateLimited, fmt.Sprintf("[XServer] [%s Handler] [Error] rate limit is exceeded", handlerName)))
+	return true
+}
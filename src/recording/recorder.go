@@ -0,0 +1,168 @@
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/database"
+	"xserver/src/logger"
+)
+
+const (
+	scrubbed = "[scrubbed]"
+)
+
+type Recorder struct {
+	sample   float64
+	handlers map[string]bool
+	headers  map[string]bool
+	fields   map[string]bool
+	patterns []*regexp.Regexp
+	storage  *database.Database
+	mutex    sync.Mutex
+	file     *os.File
+}
+
+// Create creates the recorder writing to the ndjson file or the database if output is database.
+func Create(settings config.Recording, storage *database.Database) (*Recorder, error) {
+	recorder := &Recorder{
+		sample:   settings.Sample,
+		handlers: map[string]bool{},
+		headers:  map[string]bool{},
+		fields:   map[string]bool{},
+		patterns: []*regexp.Regexp{},
+	}
+	for _, handler := range settings.Handlers {
+		recorder.handlers[handler] = true
+	}
+	for _, header := range settings.Scrub.Headers {
+		recorder.headers[http.CanonicalHeaderKey(header)] = true
+	}
+	for _, field := range settings.Scrub.Fields {
+		recorder.fields[strings.ToLower(field)] = true
+	}
+	for _, pattern := range settings.Scrub.Patterns {
+		expression, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf(`[XServer] [Recording] [Error] failed compile scrub pattern "%s": %s`, pattern, err)
+		}
+		recorder.patterns = append(recorder.patterns, expression)
+	}
+
+	if settings.Output == config.RecordingDatabase {
+		recorder.storage = storage
+		return recorder, nil
+	}
+
+	file, err := os.OpenFile(settings.Output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Recording] [Error] failed open output file: %s", err)
+	}
+	recorder.file = file
+	return recorder, nil
+}
+
+func (recorder *Recorder) Close() {
+	if recorder.file != nil {
+		recorder.file.Close()
+	}
+}
+
+// Sampled reports whether the next request of the handler must be recorded.
+func (recorder *Recorder) Sampled(handler string) bool {
+	if len(recorder.handlers) != 0 && !recorder.handlers[handler] {
+		return false
+	}
+	return rand.Float64() < recorder.sample
+}
+
+func (recorder *Recorder) scrubText(text string) string {
+	for _, pattern := range recorder.patterns {
+		text = pattern.ReplaceAllString(text, scrubbed)
+	}
+	return text
+}
+
+func (recorder *Recorder) scrubValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, field := range typed {
+			if recorder.fields[strings.ToLower(key)] {
+				typed[key] = scrubbed
+				continue
+			}
+			typed[key] = recorder.scrubValue(field)
+		}
+	case []interface{}:
+		for index, item := range typed {
+			typed[index] = recorder.scrubValue(item)
+		}
+	case string:
+		return recorder.scrubText(typed)
+	}
+	return value
+}
+
+// Scrub replaces configured headers, json body fields and patterns matches with [scrubbed].
+func (recorder *Recorder) Scrub(request Request) Request {
+	headers := map[string]string{}
+	for name, value := range request.Headers {
+		if recorder.headers[http.CanonicalHeaderKey(name)] {
+			value = scrubbed
+		}
+		headers[name] = value
+	}
+	request.Headers = headers
+	request.Path = recorder.scrubText(request.Path)
+
+	var body interface{}
+	if len(recorder.fields) != 0 && json.Unmarshal([]byte(request.Body), &body) == nil {
+		data, _ := json.Marshal(recorder.scrubValue(body))
+		request.Body = string(data)
+	} else {
+		request.Body = recorder.scrubText(request.Body)
+	}
+	return request
+}
+
+func (recorder *Recorder) Record(handler string, request *http.Request, body []byte) {
+	recorded := Request{
+		Handler: handler,
+		Method:  request.Method,
+		Path:    request.URL.RequestURI(),
+		Headers: map[string]string{},
+		Body:    string(body),
+	}
+	for name := range request.Header {
+		if name != "Content-Length" {
+			recorded.Headers[name] = request.Header.Get(name)
+		}
+	}
+	recorded = recorder.Scrub(recorded)
+
+	data, err := json.Marshal(recorded)
+	if err != nil {
+		logger.Error(fmt.Sprintf("[XServer] [Recording] [Error] failed encode request: %s", err))
+		return
+	}
+
+	if recorder.storage != nil {
+		if err := recorder.storage.AddRecording(handler, time.Now(), string(data)); err != nil {
+			logger.Error(err.Error())
+		}
+		return
+	}
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	if _, err := recorder.file.Write(append(data, '\n')); err != nil {
+		logger.Error(fmt.Sprintf("[XServer] [Recording] [Error] failed write request: %s", err))
+	}
+}
@@ -0,0 +1,72 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	maxLineSize = 16 * 1024 * 1024
+)
+
+// Request is a recorded request, one json object per line in ndjson files.
+type Request struct {
+	Handler string            `json:"handler,omitempty"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+func Read(reader io.Reader) ([]Request, error) {
+	requests := []Request{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		request := Request{}
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			return nil, fmt.Errorf("[XServer] [Recording] [Error] failed parse request on line %d: %s", line, err)
+		}
+		if request.Method == "" {
+			request.Method = http.MethodGet
+		}
+		requests = append(requests, request)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("[XServer] [Recording] [Error] failed read requests: %s", err)
+	}
+	return requests, nil
+}
+
+func ReadFile(path string) ([]Request, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Recording] [Error] failed open requests file: %s", err)
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+// HttpRequest creates the request to the server with the base url e.g. http://localhost:8080.
+func (request Request) HttpRequest(baseUrl string) (*http.Request, error) {
+	httpRequest, err := http.NewRequest(request.Method, strings.TrimSuffix(baseUrl, "/")+request.Path, strings.NewReader(request.Body))
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Recording] [Error] failed create request: %s", err)
+	}
+	for name, value := range request.Headers {
+		httpRequest.Header.Set(name, value)
+	}
+	return httpRequest, nil
+}
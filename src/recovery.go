@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"xserver/src/admin"
+	"xserver/src/config"
+	"xserver/src/database"
+	"xserver/src/logger"
+	"xserver/src/manifest"
+	"xserver/src/scheduler"
+	"xserver/src/snapshots"
+
+	"github.com/robfig/cron"
+)
+
+const (
+	snapshotConfig   = "config.yml"
+	snapshotSchema   = "schema.json"
+	snapshotDatabase = "storage.db"
+	snapshotManifest = "manifest.json"
+)
+
+// snapshotEntries collects the config, database schema, consistent database copy and build manifest,
+// the manifest of unsigned builds is created by checksums of built files.
+func snapshotEntries(config *config.Config, storage *database.Database) ([]snapshots.Entry, error) {
+	entries := []snapshots.Entry{}
+	configData, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed read config: %s", err)
+	}
+	entries = append(entries, snapshots.Entry{Name: snapshotConfig, Data: configData})
+
+	if storage != nil {
+		schemaData, err := os.ReadFile(config.Database.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed read database schema: %s", err)
+		}
+		entries = append(entries, snapshots.Entry{Name: snapshotSchema, Data: schemaData})
+
+		directory, err := os.MkdirTemp("", "xserver-snapshot-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(directory)
+		backupPath := filepath.Join(directory, snapshotDatabase)
+		if err := storage.Backup(backupPath); err != nil {
+			return nil, err
+		}
+		databaseData, err := os.ReadFile(backupPath)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, snapshots.Entry{Name: snapshotDatabase, Data: databaseData})
+	}
+
+	manifestData, err := os.ReadFile(config.ManifestPath())
+	if os.IsNotExist(err) {
+		buildManifest, createErr := manifest.Create(config.Build.OutputDir, manifestDirectories...)
+		if createErr != nil {
+			return nil, fmt.Errorf("failed create build manifest: %s", createErr)
+		}
+		manifestData, err = json.MarshalIndent(buildManifest, "", "  ")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed read build manifest: %s", err)
+	}
+	entries = append(entries, snapshots.Entry{Name: snapshotManifest, Data: manifestData})
+	return entries, nil
+}
+
+func takeSnapshot(config *config.Config, storage *database.Database, serverSnapshots *snapshots.Snapshots) (snapshots.Snapshot, error) {
+	entries, err := snapshotEntries(config, storage)
+	if err != nil {
+		err = fmt.Errorf("[XServer] [Snapshots] [Error] failed take snapshot: %s", err)
+		logger.Error(err.Error())
+		return snapshots.Snapshot{}, err
+	}
+	snapshot, err := serverSnapshots.Take(entries)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+	return snapshot, err
+}
+
+// scheduleSnapshots takes snapshots by the period.
+func scheduleSnapshots(config *config.Config, storage *database.Database, serverSnapshots *snapshots.Snapshots) (func(), error) {
+	if config.Snapshots.Period == "" {
+		return func() {}, nil
+	}
+
+	schedule, err := scheduler.Parse(config.Snapshots.Period, config.Snapshots.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Config] [Error] snapshots: %s", err)
+	}
+
+	snapshotsCron := cron.New()
+	snapshotsCron.Schedule(schedule, cron.FuncJob(func() { takeSnapshot(config, storage, serverSnapshots) }))
+	snapshotsCron.Start()
+	return snapshotsCron.Stop, nil
+}
+
+func snapshotsCommand(config *config.Config, arguments []string) error {
+	path := "/admin/snapshots"
+	if len(arguments) == 1 && arguments[0] == "create" {
+		path = "/admin/snapshots/create"
+	} else if len(arguments) != 0 && (len(arguments) != 1 || arguments[0] != "list") {
+		usage()
+		return nil
+	}
+
+	response, err := admin.Request(config, path, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(response))
+	return nil
+}
+
+// readSnapshot reads the snapshot archive file or the snapshot of the configured storage by name.
+func readSnapshot(from string) ([]byte, error) {
+	if _, err := os.Stat(from); err == nil {
+		return os.ReadFile(from)
+	}
+
+	currentConfig, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("snapshot file is not found and the config is not loaded: %s", err)
+	}
+	serverSnapshots, err := snapshots.Create(currentConfig.Snapshots)
+	if err != nil {
+		return nil, err
+	}
+	if serverSnapshots == nil {
+		return nil, fmt.Errorf("snapshot file is not found and snapshots directory or s3 is not configured")
+	}
+	return serverSnapshots.Read(from)
+}
+
+// restoreFile replaces the file by the snapshot entry, the replaced file is kept with the .bak suffix.
+func restoreFile(path string, data []byte) error {
+	if current, err := os.ReadFile(path); err == nil {
+		if err := os.WriteFile(path+".bak", current, 0644); err != nil {
+			return fmt.Errorf(`failed write "%s" backup: %s`, path, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf(`failed write "%s": %s`, path, err)
+	}
+	fmt.Printf("[XServer] [Restore] restored %s\n", path)
+	return nil
+}
+
+// restoreCommand restores the config first and the database, schema and build manifest to paths of the restored config.
+func restoreCommand(_ *config.Config, arguments []string) error {
+	parsed, err := parseArguments(arguments)
+	if err != nil {
+		return err
+	}
+	from := parsed.String("--from", "")
+	if from == "" || len(parsed.Positional) != 0 {
+		usage()
+		return nil
+	}
+
+	data, err := readSnapshot(from)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Restore] [Error] failed read snapshot: %s", err)
+	}
+	entries, err := snapshots.Extract(data)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Restore] [Error] %s", err)
+	}
+	files := map[string][]byte{}
+	for _, entry := range entries {
+		files[entry.Name] = entry.Data
+	}
+	if _, ok := files[snapshotConfig]; !ok {
+		return fmt.Errorf("[XServer] [Restore] [Error] snapshot has no %s", snapshotConfig)
+	}
+
+	if currentConfig, err := config.Load(configPath); err == nil {
+		_, address, _ := strings.Cut(admin.Url(currentConfig, ""), "://")
+		if connection, err := net.DialTimeout("tcp", address, time.Second); err == nil {
+			connection.Close()
+			return fmt.Errorf("[XServer] [Restore] [Error] server is running on %s, stop it before restore", address)
+		}
+	}
+
+	if err := restoreFile(configPath, files[snapshotConfig]); err != nil {
+		return fmt.Errorf("[XServer] [Restore] [Error] %s", err)
+	}
+	restoredConfig, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Restore] [Error] failed load restored config: %s", err)
+	}
+
+	targets := map[string]string{
+		snapshotSchema:   restoredConfig.Database.Schema,
+		snapshotDatabase: restoredConfig.Database.Storage,
+		snapshotManifest: restoredConfig.ManifestPath(),
+	}
+	for _, name := range []string{snapshotSchema, snapshotDatabase, snapshotManifest} {
+		data, ok := files[name]
+		if !ok {
+			continue
+		}
+		if name == snapshotManifest {
+			buildManifest := &manifest.Manifest{}
+			if err := json.Unmarshal(data, buildManifest); err != nil || buildManifest.Signature == "" {
+				fmt.Println("[XServer] [Restore] unsigned build manifest is not restored, it is kept in the snapshot only")
+				continue
+			}
+		}
+		if name == snapshotDatabase {
+			for _, suffix := range []string{"-wal", "-shm"} {
+				if err := os.Remove(targets[name] + suffix); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("[XServer] [Restore] [Error] failed delete database %s file: %s", suffix, err)
+				}
+			}
+		}
+		if err := restoreFile(targets[name], data); err != nil {
+			return fmt.Errorf("[XServer] [Restore] [Error] %s", err)
+		}
+	}
+	fmt.Println("[XServer] [Restore] restored, run xserver build to build units of the restored config")
+	return nil
+}
@@ -0,0 +1,101 @@
+package redirects
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"xserver/src/config"
+	"xserver/src/metrics"
+)
+
+func init() {
+	metrics.Register("xserver_redirects_total", metrics.CounterType, "Number of requests answered by redirect rules.")
+}
+
+type rule struct {
+	settings config.Redirect
+	segments []string
+	rest     bool
+}
+
+// match returns values of placeholders of the escaped path, the trailing * value is the "path" one.
+func (rule *rule) match(path string) (map[string]string, bool) {
+	segments := strings.Split(path, "/")
+	if len(segments) < len(rule.segments) || (!rule.rest && len(segments) != len(rule.segments)) {
+		return nil, false
+	}
+	values := map[string]string{}
+	for index, expected := range rule.segments {
+		actual := segments[index]
+		if strings.HasPrefix(expected, "{") && strings.HasSuffix(expected, "}") {
+			if actual == "" {
+				return nil, false
+			}
+			values[expected[1:len(expected)-1]] = actual
+			continue
+		}
+		if actual != expected {
+			return nil, false
+		}
+	}
+	if rule.rest {
+		values["path"] = strings.Join(segments[len(rule.segments):], "/")
+	}
+	return values, true
+}
+
+// target returns the target with substituted placeholders and the request query.
+func (rule *rule) target(values map[string]string, query string) string {
+	target := rule.settings.To
+	for name, value := range values {
+		target = strings.ReplaceAll(target, "{"+name+"}", value)
+	}
+	if query == "" {
+		return target
+	}
+	if strings.Contains(target, "?") {
+		return target + "&" + query
+	}
+	return target + "?" + query
+}
+
+func requestHost(request *http.Request) string {
+	host := request.Host
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	return strings.ToLower(host)
+}
+
+// Handler answers requests matching redirect rules before handlers, the first matching rule wins.
+func Handler(settings *config.Config, next http.Handler) http.Handler {
+	if len(settings.Redirects) == 0 {
+		return next
+	}
+	rules := []rule{}
+	for _, redirect := range settings.Redirects {
+		current := rule{settings: redirect, segments: strings.Split(redirect.From, "/")}
+		if last := len(current.segments) - 1; current.segments[last] == config.RedirectRest {
+			current.segments, current.rest = current.segments[:last], true
+		}
+		rules = append(rules, current)
+	}
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		path := request.URL.EscapedPath()
+		for index := range rules {
+			current := &rules[index]
+			if current.settings.Host != "" && !strings.EqualFold(current.settings.Host, requestHost(request)) {
+				continue
+			}
+			values, ok := current.match(path)
+			if !ok {
+				continue
+			}
+			metrics.Inc("xserver_redirects_total", "from", current.settings.From)
+			http.Redirect(writer, request, current.target(values, request.URL.RawQuery), current.settings.Status)
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
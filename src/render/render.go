@@ -0,0 +1,213 @@
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	htmlTemplate "html/template"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"xserver/src/config"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+	"xserver/src/problem"
+)
+
+const (
+	JsonType = "application/json"
+)
+
+var (
+	functions = map[string]interface{}{
+		"json": func(value interface{}) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+		"xml": func(value interface{}) (string, error) {
+			escaped := &strings.Builder{}
+			err := xml.EscapeText(escaped, []byte(fmt.Sprint(value)))
+			return escaped.String(), err
+		},
+		"csv": func(values ...interface{}) (string, error) {
+			row := []string{}
+			for _, value := range values {
+				if list, ok := value.([]interface{}); ok {
+					for _, item := range list {
+						row = append(row, fmt.Sprint(item))
+					}
+					continue
+				}
+				row = append(row, fmt.Sprint(value))
+			}
+			line := &strings.Builder{}
+			writer := csv.NewWriter(line)
+			writer.Write(row)
+			writer.Flush()
+			return strings.TrimSuffix(line.String(), "\n"), writer.Error()
+		},
+	}
+)
+
+func init() {
+	metrics.Register("xserver_rendered_responses_total", metrics.CounterType, "Number of handlers json responses rendered by templates.")
+}
+
+type renderer interface {
+	Execute(writer io.Writer, data interface{}) error
+}
+
+// handlerTemplates are templates of the handler by media type, offered are media types in negotiation order with json first.
+type handlerTemplates struct {
+	templates map[string]renderer
+	offered   []string
+}
+
+type Renderers struct {
+	handlers map[string]*handlerTemplates
+}
+
+// html reports whether the media type is rendered by html/template escaping values.
+func html(mediaType string) bool {
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// Create parses templates of handlers, handlers with failed templates respond json.
+func Create(handlers map[string]config.ExecutableServerUnit) *Renderers {
+	renderers := &Renderers{handlers: map[string]*handlerTemplates{}}
+	for handlerName, handler := range handlers {
+		if len(handler.Templates) == 0 {
+			continue
+		}
+		current := &handlerTemplates{templates: map[string]renderer{}}
+		for mediaType, path := range handler.Templates {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				logger.Error(fmt.Sprintf(`[XServer] [%s Handler] [Error] failed read "%s" template: %s`, handlerName, mediaType, err))
+				continue
+			}
+			mediaType = strings.ToLower(mediaType)
+			var parsed renderer
+			if html(mediaType) {
+				parsed, err = htmlTemplate.New(mediaType).Funcs(functions).Parse(string(data))
+			} else {
+				parsed, err = template.New(mediaType).Funcs(functions).Parse(string(data))
+			}
+			if err != nil {
+				logger.Error(fmt.Sprintf(`[XServer] [%s Handler] [Error] failed parse "%s" template: %s`, handlerName, mediaType, err))
+				continue
+			}
+			current.templates[mediaType] = parsed
+			current.offered = append(current.offered, mediaType)
+		}
+		sort.Strings(current.offered)
+		current.offered = append([]string{JsonType}, current.offered...)
+		renderers.handlers[handlerName] = current
+	}
+	return renderers
+}
+
+type preference struct {
+	mediaType string
+	quality   float64
+}
+
+// Negotiate returns the offered media type preferred by the Accept header, the first offered one without the header.
+func Negotiate(accept string, offered []string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return offered[0], true
+	}
+	preferences := []preference{}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, parameters, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if value, ok := parameters["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if quality > 0 {
+			preferences = append(preferences, preference{mediaType: mediaType, quality: quality})
+		}
+	}
+	sort.SliceStable(preferences, func(i, j int) bool { return preferences[i].quality > preferences[j].quality })
+
+	for _, preference := range preferences {
+		for _, mediaType := range offered {
+			kind, _, _ := strings.Cut(mediaType, "/")
+			if preference.mediaType == mediaType || preference.mediaType == "*/*" || preference.mediaType == kind+"/*" {
+				return mediaType, true
+			}
+		}
+	}
+	return "", false
+}
+
+// bufferedWriter keeps the handler response to render it after the handler finished.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (writer *bufferedWriter) Write(data []byte) (int, error) {
+	return writer.body.Write(data)
+}
+
+func (writer *bufferedWriter) WriteHeader(status int) {
+	writer.status = status
+}
+
+func (writer *bufferedWriter) Unwrap() http.ResponseWriter {
+	return writer.ResponseWriter
+}
+
+// Handler renders successful json responses of the handler by the template of the media type preferred by the Accept header,
+// json is responded as is when it is preferred, failed responses and responses other than json aren't rendered.
+func (renderers *Renderers) Handler(handlerName string, next http.HandlerFunc) http.HandlerFunc {
+	current, ok := renderers.handlers[handlerName]
+	if !ok {
+		return next
+	}
+	return func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Add("Vary", "Accept")
+		mediaType, ok := Negotiate(request.Header.Get("Accept"), current.offered)
+		if !ok || mediaType == JsonType {
+			next(writer, request)
+			return
+		}
+
+		buffered := &bufferedWriter{ResponseWriter: writer, status: http.StatusOK}
+		next(buffered, request)
+
+		var data interface{}
+		if buffered.status < 200 || buffered.status >= 300 || json.Unmarshal(buffered.body.Bytes(), &data) != nil {
+			writer.WriteHeader(buffered.status)
+			writer.Write(buffered.body.Bytes())
+			return
+		}
+		output := &bytes.Buffer{}
+		if err := current.templates[mediaType].Execute(output, data); err != nil {
+			message := fmt.Sprintf(`[XServer] [%s Handler] [Error] failed render "%s" template: %s`, handlerName, mediaType, err)
+			logger.Error(message)
+			problem.Write(writer, request, problem.New(http.StatusInternalServerError, problem.CodeHandlerFailed, message))
+			return
+		}
+
+		metrics.Inc("xserver_rendered_responses_total", "handler", handlerName, "type", mediaType)
+		writer.Header().Del("Content-Length")
+		writer.Header().Set("Content-Type", mime.FormatMediaType(mediaType, map[string]string{"charset": "utf-8"}))
+		writer.WriteHeader(buffered.status)
+		writer.Write(output.Bytes())
+	}
+}
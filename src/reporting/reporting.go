@@ -0,0 +1,268 @@
+package reporting
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+)
+
+const (
+	KindHandler = "handler"
+	KindTask    = "task"
+
+	// MaxOutput is the max size of the unit output attached to reports.
+	MaxOutput = 4096
+)
+
+var (
+	// variables are numbers and hex ids replaced in messages fingerprints, e.g. "user 42 not found" and "user 43 not found" are the same issue.
+	variables = regexp.MustCompile(`[0-9a-fA-F]{8,}|[0-9]+`)
+)
+
+func init() {
+	metrics.Register("xserver_errors_total", metrics.CounterType, "Number of reported errors of handlers and tasks.")
+	metrics.Register("xserver_error_issues", metrics.GaugeType, "Number of distinct errors of handlers and tasks.")
+	metrics.Register("xserver_errors_forwarded_total", metrics.CounterType, "Number of issues forwarded to the error tracker.")
+}
+
+// Error attaches the unit stderr output to the error.
+type Error struct {
+	Err    error
+	Stderr string
+}
+
+func (err *Error) Error() string {
+	return err.Err.Error()
+}
+
+func (err *Error) Unwrap() error {
+	return err.Err
+}
+
+type Report struct {
+	Kind      string
+	Unit      string
+	Error     error
+	RequestId string
+	Output    string
+}
+
+// Issue aggregates errors of the unit with the same fingerprint.
+type Issue struct {
+	Fingerprint string    `json:"fingerprint"`
+	Kind        string    `json:"kind"`
+	Unit        string    `json:"unit"`
+	Message     string    `json:"message"`
+	Count       int       `json:"count"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	RequestId   string    `json:"request_id,omitempty"`
+	Output      string    `json:"output,omitempty"`
+	forwarded   time.Time
+	unforwarded int
+}
+
+type sentryDsn struct {
+	endpoint string
+	key      string
+}
+
+type Reporter struct {
+	settings config.Reporting
+	window   time.Duration
+	dsn      *sentryDsn
+	client   *http.Client
+	mutex    sync.Mutex
+	issues   map[string]*Issue
+}
+
+func parseDsn(dsn string) (*sentryDsn, error) {
+	parsed, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	project := strings.Trim(parsed.Path, "/")
+	if parsed.User == nil || parsed.User.Username() == "" || project == "" {
+		return nil, fmt.Errorf("expected https://<key>@<host>/<project>")
+	}
+	return &sentryDsn{
+		endpoint: fmt.Sprintf("%s://%s/api/%s/store/", parsed.Scheme, parsed.Host, project),
+		key:      parsed.User.Username(),
+	}, nil
+}
+
+func Create(settings config.Reporting) (*Reporter, error) {
+	window, err := time.ParseDuration(settings.Window)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Reporting] [Error] failed parse window: %s", err)
+	}
+
+	reporter := &Reporter{
+		settings: settings,
+		window:   window,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		issues:   map[string]*Issue{},
+	}
+	if settings.Dsn != "" {
+		if reporter.dsn, err = parseDsn(settings.Dsn); err != nil {
+			return nil, fmt.Errorf("[XServer] [Reporting] [Error] invalid dsn: %s", err)
+		}
+	}
+	return reporter, nil
+}
+
+func fingerprint(kind string, unit string, message string) string {
+	hash := sha1.Sum([]byte(kind + "\n" + unit + "\n" + variables.ReplaceAllString(message, "#")))
+	return hex.EncodeToString(hash[:8])
+}
+
+// Report aggregates the error by its fingerprint, the issue is forwarded to the error tracker once per window with the number of errors since the last forwarding.
+func (reporter *Reporter) Report(report Report) {
+	if reporter == nil || report.Error == nil {
+		return
+	}
+
+	message := report.Error.Error()
+	output := report.Output
+	var stderrError *Error
+	if errors.As(report.Error, &stderrError) && output == "" {
+		output = stderrError.Stderr
+	}
+	if len(output) > MaxOutput {
+		output = output[len(output)-MaxOutput:]
+	}
+
+	now := time.Now()
+	key := fingerprint(report.Kind, report.Unit, message)
+
+	reporter.mutex.Lock()
+	issue, ok := reporter.issues[key]
+	if !ok {
+		reporter.evict()
+		issue = &Issue{Fingerprint: key, Kind: report.Kind, Unit: report.Unit, Message: message, FirstSeen: now}
+		reporter.issues[key] = issue
+	}
+	issue.Count++
+	issue.unforwarded++
+	issue.LastSeen = now
+	issue.RequestId = report.RequestId
+	issue.Output = output
+
+	forward := reporter.dsn != nil && now.Sub(issue.forwarded) >= reporter.window
+	forwarded := *issue
+	if forward {
+		issue.forwarded = now
+		issue.unforwarded = 0
+	}
+	issues := len(reporter.issues)
+	reporter.mutex.Unlock()
+
+	metrics.Inc("xserver_errors_total", "unit", report.Unit)
+	metrics.Set("xserver_error_issues", float64(issues))
+
+	if forward {
+		go reporter.forward(forwarded, message)
+	}
+}
+
+// evict removes the least recently seen issue if the issues limit is reached.
+func (reporter *Reporter) evict() {
+	if reporter.settings.MaxIssues <= 0 || len(reporter.issues) < reporter.settings.MaxIssues {
+		return
+	}
+	oldest := ""
+	for key, issue := range reporter.issues {
+		if oldest == "" || issue.LastSeen.Before(reporter.issues[oldest].LastSeen) {
+			oldest = key
+		}
+	}
+	delete(reporter.issues, oldest)
+}
+
+// Issues returns aggregated errors, the most recent first.
+func (reporter *Reporter) Issues() []Issue {
+	if reporter == nil {
+		return []Issue{}
+	}
+
+	reporter.mutex.Lock()
+	issues := []Issue{}
+	for _, issue := range reporter.issues {
+		issues = append(issues, *issue)
+	}
+	reporter.mutex.Unlock()
+
+	sort.Slice(issues, func(i, j int) bool {
+		return issues[i].LastSeen.After(issues[j].LastSeen)
+	})
+	return issues
+}
+
+func eventId() string {
+	data := make([]byte, 16)
+	rand.Read(data)
+	return hex.EncodeToString(data)
+}
+
+// forward sends the issue as the event of Sentry store api, it is also supported by GlitchTip.
+func (reporter *Reporter) forward(issue Issue, message string) {
+	host, _ := os.Hostname()
+	event := map[string]interface{}{
+		"event_id":    eventId(),
+		"timestamp":   issue.LastSeen.UTC().Format(time.RFC3339),
+		"level":       "error",
+		"platform":    "other",
+		"logger":      "xserver",
+		"server_name": host,
+		"message":     map[string]string{"formatted": message},
+		"fingerprint": []string{issue.Fingerprint},
+		"tags": map[string]string{
+			"unit":       issue.Unit,
+			"kind":       issue.Kind,
+			"request_id": issue.RequestId,
+		},
+		"extra": map[string]interface{}{
+			"output": issue.Output,
+			"count":  issue.unforwarded,
+		},
+	}
+	if reporter.settings.Environment != "" {
+		event["environment"] = reporter.settings.Environment
+	}
+
+	data, _ := json.Marshal(event)
+	request, err := http.NewRequest(http.MethodPost, reporter.dsn.endpoint, bytes.NewReader(data))
+	if err != nil {
+		logger.Error(fmt.Sprintf("[XServer] [Reporting] [Error] failed create request: %s", err))
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=xserver/1.0, sentry_key=%s", reporter.dsn.key))
+
+	response, err := reporter.client.Do(request)
+	if err != nil {
+		logger.Error(fmt.Sprintf("[XServer] [Reporting] [Error] failed forward issue: %s", err))
+		return
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		logger.Error(fmt.Sprintf("[XServer] [Reporting] [Error] failed forward issue: unexpected status code %d", response.StatusCode))
+		return
+	}
+	metrics.Inc("xserver_errors_forwarded_total", "unit", issue.Unit)
+}
@@ -0,0 +1,308 @@
+package reports
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmlTemplate "html/template"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+	"xserver/src/config"
+	"xserver/src/database"
+)
+
+const (
+	ReportHeader = "X-XServer-Report"
+
+	defaultHtml = `<html>
+<body>
+<h3>{{.Task}} {{.Time.Format "2006-01-02 15:04"}}</h3>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`
+)
+
+var (
+	contentTypes = map[string]string{
+		config.ReportCsv:  "text/csv; charset=utf-8",
+		config.ReportHtml: "text/html; charset=utf-8",
+		config.ReportJson: "application/json",
+	}
+	functions = map[string]interface{}{
+		"json": func(value interface{}) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+	}
+)
+
+// Data is the data of report templates, also used by file and subject templates.
+type Data struct {
+	Task    string
+	Time    time.Time
+	Columns []string
+	Rows    [][]string
+	Records []map[string]string
+}
+
+type renderer interface {
+	Execute(writer io.Writer, data interface{}) error
+}
+
+type report struct {
+	name     string
+	settings config.Report
+	smtp     config.Smtp
+	storage  *database.Database
+	client   *http.Client
+	template renderer
+	file     *template.Template
+	subject  *template.Template
+}
+
+// Create creates the run command of the report task, it renders the query result and delivers it to all configured destinations.
+func Create(taskName string, settings config.Report, smtp config.Smtp, storage *database.Database) (func(ctx context.Context, writer io.Writer, request io.Reader) error, error) {
+	current := &report{
+		name:     taskName,
+		settings: settings,
+		smtp:     smtp,
+		storage:  storage,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+
+	var err error
+	source := ""
+	if settings.Template != "" {
+		data, err := os.ReadFile(settings.Template)
+		if err != nil {
+			return nil, fmt.Errorf("[XServer] [%s Task] [Error] failed read report template: %s", taskName, err)
+		}
+		source = string(data)
+	} else if settings.Format == config.ReportHtml {
+		source = defaultHtml
+	}
+	if source != "" {
+		if settings.Format == config.ReportHtml {
+			current.template, err = htmlTemplate.New(taskName).Funcs(functions).Parse(source)
+		} else {
+			current.template, err = template.New(taskName).Funcs(functions).Parse(source)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("[XServer] [%s Task] [Error] failed parse report template: %s", taskName, err)
+		}
+	}
+
+	if settings.File != "" {
+		if current.file, err = template.New("file").Parse(settings.File); err != nil {
+			return nil, fmt.Errorf("[XServer] [%s Task] [Error] failed parse report file: %s", taskName, err)
+		}
+	}
+	if settings.Email != nil {
+		subject := settings.Email.Subject
+		if subject == "" {
+			subject = `[XServer] {{.Task}} report {{.Time.Format "2006-01-02"}}`
+		}
+		if current.subject, err = template.New("subject").Parse(subject); err != nil {
+			return nil, fmt.Errorf("[XServer] [%s Task] [Error] failed parse report email subject: %s", taskName, err)
+		}
+	}
+
+	return current.run, nil
+}
+
+func (report *report) query() (*Data, error) {
+	if report.storage == nil {
+		return nil, fmt.Errorf("database is unavailable")
+	}
+	request := &database.Request{Table: report.settings.Query.Table}
+	for _, field := range report.settings.Query.Fields {
+		request.Fields = append(request.Fields, database.RequestField{Name: field})
+	}
+	for _, filter := range report.settings.Query.Filters {
+		request.Filters = append(request.Filters, database.RequestFilter{Name: filter.Name, Operator: filter.Operator, Value: filter.Value})
+	}
+
+	columns, rows, err := report.storage.SelectTable(request)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &Data{Task: report.name, Time: time.Now(), Columns: columns, Rows: rows, Records: []map[string]string{}}
+	for _, row := range rows {
+		record := map[string]string{}
+		for index, column := range columns {
+			record[column] = row[index]
+		}
+		data.Records = append(data.Records, record)
+	}
+	return data, nil
+}
+
+func (report *report) render(data *Data) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	if report.template != nil {
+		err := report.template.Execute(buffer, data)
+		return buffer.Bytes(), err
+	}
+
+	if report.settings.Format == config.ReportJson {
+		return json.Marshal(data.Records)
+	}
+
+	writer := csv.NewWriter(buffer)
+	writer.Write(data.Columns)
+	writer.WriteAll(data.Rows)
+	return buffer.Bytes(), writer.Error()
+}
+
+func execute(current *template.Template, data *Data) (string, error) {
+	buffer := &bytes.Buffer{}
+	err := current.Execute(buffer, data)
+	return buffer.String(), err
+}
+
+func (report *report) run(ctx context.Context, writer io.Writer, _ io.Reader) error {
+	data, err := report.query()
+	if err != nil {
+		return err
+	}
+	content, err := report.render(data)
+	if err != nil {
+		return fmt.Errorf("failed render report: %s", err)
+	}
+	fmt.Fprintf(writer, "report of %d rows rendered\n", len(data.Rows))
+
+	errs := []error{}
+	if report.file != nil {
+		if path, err := report.writeFile(data, content); err != nil {
+			errs = append(errs, fmt.Errorf("failed write report file: %s", err))
+		} else {
+			fmt.Fprintf(writer, "report written to %s\n", path)
+		}
+	}
+	if report.settings.Webhook != "" {
+		if err := report.sendWebhook(ctx, content); err != nil {
+			errs = append(errs, fmt.Errorf("failed send report webhook: %s", err))
+		} else {
+			fmt.Fprintf(writer, "report sent to webhook\n")
+		}
+	}
+	if report.settings.Email != nil {
+		if err := report.sendEmail(data, content); err != nil {
+			errs = append(errs, fmt.Errorf("failed send report email: %s", err))
+		} else {
+			fmt.Fprintf(writer, "report sent to %s\n", strings.Join(report.settings.Email.To, ", "))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (report *report) writeFile(data *Data, content []byte) (string, error) {
+	path, err := execute(report.file, data)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, content, 0644)
+}
+
+func (report *report) sendWebhook(ctx context.Context, content []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, report.settings.Webhook, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentTypes[report.settings.Format])
+	request.Header.Set(ReportHeader, report.name)
+
+	response, err := report.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %d status", response.StatusCode)
+	}
+	return nil
+}
+
+// message returns the email message, html reports are the message body and other formats are attached.
+func (report *report) message(data *Data, content []byte) ([]byte, error) {
+	subject, err := execute(report.subject, data)
+	if err != nil {
+		return nil, err
+	}
+
+	message := &bytes.Buffer{}
+	fmt.Fprintf(message, "From: %s\r\n", report.smtp.From)
+	fmt.Fprintf(message, "To: %s\r\n", strings.Join(report.settings.Email.To, ", "))
+	fmt.Fprintf(message, "Subject: %s\r\n", subject)
+	fmt.Fprintf(message, "MIME-Version: 1.0\r\n")
+
+	if report.settings.Format == config.ReportHtml {
+		fmt.Fprintf(message, "Content-Type: %s\r\n\r\n", contentTypes[config.ReportHtml])
+		message.Write(content)
+		return message.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(message)
+	fmt.Fprintf(message, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", parts.Boundary())
+
+	text, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(text, "%s report of %d rows is attached.\r\n", report.name, len(data.Rows))
+
+	fileName := fmt.Sprintf("%s-%s.%s", report.name, data.Time.Format("2006-01-02"), report.settings.Format)
+	attachment, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentTypes[report.settings.Format]},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {fmt.Sprintf(`attachment; filename="%s"`, fileName)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		fmt.Fprintf(attachment, "%s\r\n", encoded[:76])
+		encoded = encoded[76:]
+	}
+	fmt.Fprintf(attachment, "%s\r\n", encoded)
+
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return message.Bytes(), nil
+}
+
+func (report *report) sendEmail(data *Data, content []byte) error {
+	message, err := report.message(data, content)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if report.smtp.Username != "" {
+		host := strings.Split(report.smtp.Address, ":")[0]
+		auth = smtp.PlainAuth("", report.smtp.Username, report.smtp.Password, host)
+	}
+	return smtp.SendMail(report.smtp.Address, auth, report.smtp.From, report.settings.Email.To, message)
+}
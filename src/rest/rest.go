@@ -0,0 +1,332 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"xserver/src/database"
+	"xserver/src/database/schema"
+	"xserver/src/logger"
+	"xserver/src/metering"
+	"xserver/src/modes"
+	"xserver/src/problem"
+	"xserver/src/webhooks"
+)
+
+const (
+	Prefix = "/api/"
+
+	// UnredactHeader carries database.unredact_token permitting to read redacted fields values.
+	UnredactHeader = "X-XServer-Unredact"
+)
+
+var (
+	// operators are query parameters suffixes e.g. ?age__gt=18.
+	operators = map[string]string{
+		"":       "=",
+		"ne":     "!=",
+		"gt":     ">",
+		"gte":    ">=",
+		"lt":     "<",
+		"lte":    "<=",
+		"like":   "LIKE",
+		"isnull": "IS",
+	}
+	// parameters are reserved query parameters.
+	parameters = map[string]bool{
+		"include":      true,
+		"with_deleted": true,
+	}
+)
+
+type Rest struct {
+	storage    *database.Database
+	modes      *modes.Modes
+	dispatcher *webhooks.Webhooks
+	meter      *metering.Meter
+}
+
+func Create(storage *database.Database, serverModes *modes.Modes, dispatcher *webhooks.Webhooks, meter *metering.Meter) *Rest {
+	return &Rest{storage: storage, modes: serverModes, dispatcher: dispatcher, meter: meter}
+}
+
+func quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// literal converts the json value to the sql literal.
+func literal(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if typed {
+			return "1"
+		}
+		return "0"
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	case string:
+		return quote(typed)
+	default:
+		data, _ := json.Marshal(typed)
+		return quote(string(data))
+	}
+}
+
+func writeError(writer http.ResponseWriter, request *http.Request, status int, err error) {
+	logger.Error(err.Error())
+	problem.Write(writer, request, database.Problem(err, status))
+}
+
+func writeJson(writer http.ResponseWriter, status int, value interface{}) {
+	data, _ := json.Marshal(value)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	writer.Write(data)
+}
+
+func (rest *Rest) fire(operation string, request *database.Request) {
+	if rest.dispatcher == nil {
+		return
+	}
+	payload, _ := json.Marshal(rest.storage.RedactRequest(request))
+	rest.dispatcher.Fire("db."+operation, payload)
+}
+
+// fields converts the json object body to request fields of known table fields.
+func fields(table schema.Table, request *http.Request) ([]database.RequestField, error) {
+	body := map[string]interface{}{}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("[XServer] [Rest] [Error] failed decode json body: %s", err)
+	}
+
+	known := map[string]bool{}
+	for _, field := range table.Fields {
+		known[field.Name] = true
+	}
+
+	result := []database.RequestField{}
+	for name, value := range body {
+		if !known[name] {
+			return nil, fmt.Errorf(`[XServer] [Rest] [Error] unknown field "%s" of "%s" table`, name, table.Name)
+		}
+		result = append(result, database.RequestField{Name: name, Value: literal(value)})
+	}
+	return result, nil
+}
+
+// filters converts query parameters like name=value or age__gt=18 to request filters of known table fields.
+func filters(table schema.Table, request *http.Request) ([]database.RequestFilter, error) {
+	known := map[string]bool{}
+	for _, field := range table.Columns() {
+		known[field.Name] = true
+	}
+
+	result := []database.RequestFilter{}
+	for parameter, values := range request.URL.Query() {
+		if parameters[parameter] {
+			continue
+		}
+
+		name, suffix, _ := strings.Cut(parameter, "__")
+		operator, ok := operators[suffix]
+		if !known[name] || !ok {
+			return nil, fmt.Errorf(`[XServer] [Rest] [Error] unknown filter "%s" of "%s" table`, parameter, table.Name)
+		}
+
+		for _, value := range values {
+			filter := database.RequestFilter{Name: name, Operator: operator, Value: quote(value)}
+			if suffix == "isnull" {
+				filter.Value = "NULL"
+				if value == "false" {
+					filter.Operator = "IS NOT"
+				}
+			}
+			result = append(result, filter)
+		}
+	}
+	return result, nil
+}
+
+// ifRevision parses the If-Match header revision e.g. "3" of conditional writes.
+func ifRevision(table schema.Table, request *http.Request) (*int64, error) {
+	etag := request.Header.Get("If-Match")
+	if etag == "" || !table.Versioned {
+		return nil, nil
+	}
+	revision, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(etag, "W/"), `"`), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf(`[XServer] [Rest] [Error] invalid If-Match revision "%s"`, etag)
+	}
+	return &revision, nil
+}
+
+// writeRecord responds the record with its revision as ETag of versioned tables.
+func writeRecord(writer http.ResponseWriter, status int, table schema.Table, record map[string]interface{}) {
+	if revision, ok := record[schema.RevisionField].(string); ok && table.Versioned {
+		writer.Header().Set("ETag", `"`+revision+`"`)
+	}
+	writeJson(writer, status, record)
+}
+
+func idFilter(table schema.Table, id string) []database.RequestFilter {
+	return []database.RequestFilter{{Name: table.PrimaryKey[0], Operator: "=", Value: quote(id)}}
+}
+
+func selectRequest(table schema.Table, request *http.Request) *database.Request {
+	selectRequest := &database.Request{Table: table.Name}
+	if include := request.URL.Query().Get("include"); include != "" {
+		selectRequest.Include = strings.Split(include, ",")
+	}
+	selectRequest.WithDeleted = request.URL.Query().Get("with_deleted") == "true"
+	selectRequest.Unredact = request.Header.Get(UnredactHeader)
+	return selectRequest
+}
+
+func (rest *Rest) record(table schema.Table, request *http.Request, filters []database.RequestFilter) (map[string]interface{}, error) {
+	selectRequest := selectRequest(table, request)
+	selectRequest.Filters = filters
+	records, err := rest.storage.SelectRecords(selectRequest)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// ServeHTTP serves GET/POST /api/{table} and GET/PUT/DELETE /api/{table}/{id} routes of schema tables.
+func (rest *Rest) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	tableName, id, withId := strings.Cut(strings.Trim(strings.TrimPrefix(request.URL.Path, Prefix), "/"), "/")
+	table, ok := rest.storage.Table(tableName)
+	if !ok || strings.HasPrefix(tableName, "__") {
+		writeError(writer, request, http.StatusNotFound, fmt.Errorf(`[XServer] [Rest] [Error] unknown table "%s"`, tableName))
+		return
+	}
+	if withId && len(table.PrimaryKey) != 1 {
+		writeError(writer, request, http.StatusNotFound, fmt.Errorf(`[XServer] [Rest] [Error] table "%s" with composite primary key has no record routes`, tableName))
+		return
+	}
+
+	if rest.meter.RejectTable(table.Name, writer, request) {
+		return
+	}
+
+	if modes.Mutating(request) && rest.modes.RejectWrite(writer, request) {
+		return
+	}
+
+	switch {
+	case !withId && request.Method == http.MethodGet:
+		selectRequest := selectRequest(table, request)
+		filters, err := filters(table, request)
+		if err != nil {
+			writeError(writer, request, http.StatusBadRequest, err)
+			return
+		}
+		selectRequest.Filters = filters
+
+		records, err := rest.storage.SelectRecords(selectRequest)
+		if err != nil {
+			writeError(writer, request, http.StatusInternalServerError, err)
+			return
+		}
+		writeJson(writer, http.StatusOK, records)
+
+	case !withId && request.Method == http.MethodPost:
+		fields, err := fields(table, request)
+		if err != nil {
+			writeError(writer, request, http.StatusBadRequest, err)
+			return
+		}
+
+		insertRequest := &database.Request{Table: table.Name, Fields: fields}
+		rowid, err := rest.storage.InsertRecord(insertRequest)
+		if err != nil {
+			writeError(writer, request, http.StatusInternalServerError, err)
+			return
+		}
+		rest.fire("insert", insertRequest)
+
+		record, err := rest.record(table, request, []database.RequestFilter{{Name: "rowid", Operator: "=", Value: strconv.FormatInt(rowid, 10)}})
+		if err != nil {
+			writeError(writer, request, http.StatusInternalServerError, err)
+			return
+		}
+		writeRecord(writer, http.StatusCreated, table, record)
+
+	case withId && request.Method == http.MethodGet:
+		record, err := rest.record(table, request, idFilter(table, id))
+		if err != nil {
+			writeError(writer, request, http.StatusInternalServerError, err)
+			return
+		}
+		if record == nil {
+			writeError(writer, request, http.StatusNotFound, fmt.Errorf(`[XServer] [Rest] [Error] "%s" record "%s" is not found`, table.Name, id))
+			return
+		}
+		writeRecord(writer, http.StatusOK, table, record)
+
+	case withId && request.Method == http.MethodPut:
+		revision, err := ifRevision(table, request)
+		if err != nil {
+			writeError(writer, request, http.StatusBadRequest, err)
+			return
+		}
+		fields, err := fields(table, request)
+		if err != nil {
+			writeError(writer, request, http.StatusBadRequest, err)
+			return
+		}
+
+		updateRequest := &database.Request{Table: table.Name, Fields: fields, Filters: idFilter(table, id), IfRevision: revision}
+		updated, err := rest.storage.UpdateRecords(updateRequest)
+		if err != nil {
+			writeError(writer, request, http.StatusInternalServerError, err)
+			return
+		}
+		if updated == 0 {
+			writeError(writer, request, http.StatusNotFound, fmt.Errorf(`[XServer] [Rest] [Error] "%s" record "%s" is not found`, table.Name, id))
+			return
+		}
+		rest.fire("update", updateRequest)
+
+		filters := idFilter(table, id)
+		for _, field := range fields {
+			if field.Name == table.PrimaryKey[0] {
+				filters = []database.RequestFilter{{Name: field.Name, Operator: "=", Value: field.Value}}
+			}
+		}
+		record, err := rest.record(table, request, filters)
+		if err != nil {
+			writeError(writer, request, http.StatusInternalServerError, err)
+			return
+		}
+		writeRecord(writer, http.StatusOK, table, record)
+
+	case withId && request.Method == http.MethodDelete:
+		revision, err := ifRevision(table, request)
+		if err != nil {
+			writeError(writer, request, http.StatusBadRequest, err)
+			return
+		}
+
+		deleteRequest := &database.Request{Table: table.Name, Filters: idFilter(table, id), IfRevision: revision}
+		deleted, err := rest.storage.DeleteRecords(deleteRequest)
+		if err != nil {
+			writeError(writer, request, http.StatusInternalServerError, err)
+			return
+		}
+		if deleted == 0 {
+			writeError(writer, request, http.StatusNotFound, fmt.Errorf(`[XServer] [Rest] [Error] "%s" record "%s" is not found`, table.Name, id))
+			return
+		}
+		rest.fire("delete", deleteRequest)
+		writer.WriteHeader(http.StatusNoContent)
+
+	default:
+		writer.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		writeError(writer, request, http.StatusMethodNotAllowed, fmt.Errorf("[XServer] [Rest] [Error] method %s is not allowed", request.Method))
+	}
+}
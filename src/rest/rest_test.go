@@ -0,0 +1,119 @@
+package rest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"xserver/src/config"
+	"xserver/src/database"
+)
+
+const testSchema = `[{"name":"Books","fields":[{"name":"id","type":"string"},{"name":"title","type":"string"},{"name":"pages","type":"integer","nullable":true}],"primary_key":["id"]}]`
+
+// createRest creates the api of the test schema database in the temporary directory.
+func createRest(t *testing.T) *Rest {
+	t.Helper()
+	dir := t.TempDir()
+	settings := config.Database{Enable: true, Storage: filepath.Join(dir, "storage.db"), Schema: filepath.Join(dir, "schema.json")}
+	if err := os.WriteFile(settings.Schema, []byte(testSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", settings.Storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("CREATE TABLE __Schema(version TEXT NOT NULL, data TEXT, PRIMARY KEY(version)); INSERT INTO __Schema VALUES('current', '[]')")
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err := database.Create(&config.Config{Database: settings})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { storage.Close() })
+	return Create(storage, nil, nil, nil)
+}
+
+func serve(rest *Rest, method string, target string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	rest.ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return recorder
+}
+
+func decode(t *testing.T, recorder *httptest.ResponseRecorder, value interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(recorder.Body.Bytes(), value); err != nil {
+		t.Fatalf("failed decode response %s: %s", recorder.Body.String(), err)
+	}
+}
+
+func TestRecords(t *testing.T) {
+	rest := createRest(t)
+
+	created := serve(rest, http.MethodPost, "/api/Books", `{"id": "1", "title": "Hobbit", "pages": 310}`)
+	if created.Code != http.StatusCreated {
+		t.Fatalf("unexpected insert status %d: %s", created.Code, created.Body.String())
+	}
+	record := map[string]interface{}{}
+	decode(t, created, &record)
+	if fmt.Sprint(record["id"]) != "1" || fmt.Sprint(record["title"]) != "Hobbit" {
+		t.Fatalf("unexpected created record %v", record)
+	}
+	serve(rest, http.MethodPost, "/api/Books", `{"id": "2", "title": "Silmarillion", "pages": 365}`)
+
+	selected := serve(rest, http.MethodGet, "/api/Books?pages__gt=320", "")
+	records := []map[string]interface{}{}
+	decode(t, selected, &records)
+	if selected.Code != http.StatusOK || len(records) != 1 || fmt.Sprint(records[0]["id"]) != "2" {
+		t.Fatalf("unexpected selected records %s", selected.Body.String())
+	}
+
+	updated := serve(rest, http.MethodPut, "/api/Books/1", `{"title": "The Hobbit"}`)
+	record = map[string]interface{}{}
+	decode(t, updated, &record)
+	if updated.Code != http.StatusOK || fmt.Sprint(record["title"]) != "The Hobbit" {
+		t.Fatalf("unexpected updated record %s", updated.Body.String())
+	}
+
+	if deleted := serve(rest, http.MethodDelete, "/api/Books/1", ""); deleted.Code != http.StatusNoContent {
+		t.Fatalf("unexpected delete status %d", deleted.Code)
+	}
+	if missing := serve(rest, http.MethodGet, "/api/Books/1", ""); missing.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status %d of the deleted record", missing.Code)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{name: "unknown table", method: http.MethodGet, target: "/api/Unknown", status: http.StatusNotFound},
+		{name: "internal table", method: http.MethodGet, target: "/api/__Schema", status: http.StatusNotFound},
+		{name: "unknown filter", method: http.MethodGet, target: "/api/Books?unknown=1", status: http.StatusBadRequest},
+		{name: "unknown operator", method: http.MethodGet, target: "/api/Books?pages__in=1", status: http.StatusBadRequest},
+		{name: "unknown field", method: http.MethodPost, target: "/api/Books", body: `{"id": "1", "unknown": 1}`, status: http.StatusBadRequest},
+		{name: "invalid body", method: http.MethodPost, target: "/api/Books", body: `{`, status: http.StatusBadRequest},
+		{name: "missing record", method: http.MethodPut, target: "/api/Books/missing", body: `{"title": "Missing"}`, status: http.StatusNotFound},
+		{name: "method", method: http.MethodPatch, target: "/api/Books/1", status: http.StatusMethodNotAllowed},
+	}
+	rest := createRest(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if recorder := serve(rest, test.method, test.target, test.body); recorder.Code != test.status {
+				t.Fatalf("unexpected status %d: %s", recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
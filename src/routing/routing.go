@@ -0,0 +1,123 @@
+package routing
+
+import (
+	"net/http"
+	"strings"
+	"time"
+	"xserver/src/config"
+	"xserver/src/metrics"
+)
+
+const (
+	AnyValue = "*"
+)
+
+func init() {
+	metrics.Register("xserver_routed_requests_total", metrics.CounterType, "Number of handlers requests routed to other handlers by routing rules.")
+}
+
+// window matches times of days in minutes from midnight, windows with from after to end on the next day.
+type window struct {
+	days     map[time.Weekday]bool
+	from     int
+	to       int
+	location *time.Location
+}
+
+type rule struct {
+	handler string
+	header  map[string]string
+	query   map[string]string
+	window  *window
+}
+
+type Routes struct {
+	rules map[string][]rule
+}
+
+func minutes(clock string) int {
+	parsed, _ := time.Parse("15:04", clock)
+	return parsed.Hour()*60 + parsed.Minute()
+}
+
+// Create creates routing rules of handlers with routes, routes are verified by the config.
+func Create(handlers map[string]config.ExecutableServerUnit) *Routes {
+	routes := &Routes{rules: map[string][]rule{}}
+	for handlerName, handler := range handlers {
+		for _, route := range handler.Routes {
+			current := rule{handler: route.Handler, header: route.Header, query: route.Query}
+			if route.Time != nil {
+				location, _ := time.LoadLocation(route.Time.Timezone)
+				current.window = &window{days: map[time.Weekday]bool{}, from: minutes(route.Time.From), to: minutes(route.Time.To), location: location}
+				for _, day := range route.Time.Days {
+					current.window.days[config.Weekdays[strings.ToLower(day)]] = true
+				}
+			}
+			routes.rules[handlerName] = append(routes.rules[handlerName], current)
+		}
+	}
+	return routes
+}
+
+// contains reports whether the time is in the window, the day of windows ending on the next day is the day they start.
+func (window *window) contains(now time.Time) bool {
+	now = now.In(window.location)
+	current := now.Hour()*60 + now.Minute()
+	day := now.Weekday()
+	switch {
+	case window.from == window.to:
+	case window.from < window.to:
+		if current < window.from || current >= window.to {
+			return false
+		}
+	case current < window.to:
+		day = (day + 6) % 7
+	case current < window.from:
+		return false
+	}
+	return len(window.days) == 0 || window.days[day]
+}
+
+func matches(values map[string]string, value func(name string) (string, bool)) bool {
+	for name, expected := range values {
+		actual, ok := value(name)
+		if !ok || (expected != AnyValue && actual != expected) {
+			return false
+		}
+	}
+	return true
+}
+
+func (rule *rule) matches(request *http.Request, now time.Time) bool {
+	header := func(name string) (string, bool) {
+		values := request.Header.Values(name)
+		if len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	}
+	query := request.URL.Query()
+	parameter := func(name string) (string, bool) {
+		return query.Get(name), query.Has(name)
+	}
+	return matches(rule.header, header) && matches(rule.query, parameter) && (rule.window == nil || rule.window.contains(now))
+}
+
+// Route returns the handler of the first route matching the request or the handler itself.
+func (routes *Routes) Route(handlerName string, request *http.Request) string {
+	if routes == nil {
+		return handlerName
+	}
+	rules := routes.rules[handlerName]
+	if len(rules) == 0 {
+		return handlerName
+	}
+	now := time.Now()
+	for index := range rules {
+		if rules[index].matches(request, now) {
+			metrics.Inc("xserver_routed_requests_total", "handler", handlerName, "target", rules[index].handler)
+			return rules[index].handler
+		}
+	}
+	return handlerName
+}
@@ -0,0 +1,139 @@
+package runners
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrBatchStopped    = errors.New("batched handler is stopped")
+	ErrMissingResponse = errors.New("batch response misses the request response")
+)
+
+type batchCall struct {
+	ctx      context.Context
+	request  RpcRequest
+	response chan batchResult
+}
+
+type batchResult struct {
+	response RpcResponse
+	err      error
+}
+
+// Batched sends requests queued while the persistent process handles the previous batch as one batch.
+type Batched struct {
+	persistent *Persistent
+	maxSize    int
+	maxDelay   time.Duration
+	sent       func(size int)
+	queue      chan *batchCall
+	stop       chan struct{}
+}
+
+func NewBatched(persistent *Persistent, maxSize int, maxDelay time.Duration, sent func(size int)) *Batched {
+	return &Batched{
+		persistent: persistent,
+		maxSize:    maxSize,
+		maxDelay:   maxDelay,
+		sent:       sent,
+		queue:      make(chan *batchCall),
+		stop:       make(chan struct{}),
+	}
+}
+
+// Start warms the persistent process and starts dispatching batches.
+func (batched *Batched) Start() {
+	batched.persistent.Warm()
+	go batched.dispatch()
+}
+
+func (batched *Batched) Call(ctx context.Context, request RpcRequest) (RpcResponse, error) {
+	call := &batchCall{ctx: ctx, request: request, response: make(chan batchResult, 1)}
+	select {
+	case batched.queue <- call:
+	case <-batched.stop:
+		return RpcResponse{}, ErrBatchStopped
+	case <-ctx.Done():
+		return RpcResponse{}, ctx.Err()
+	}
+
+	select {
+	case result := <-call.response:
+		return result.response, result.err
+	case <-ctx.Done():
+		return RpcResponse{}, ctx.Err()
+	}
+}
+
+func (batched *Batched) Stop() {
+	close(batched.stop)
+	batched.persistent.Stop()
+}
+
+// dispatch collects the batch up to maxSize requests within maxDelay after the first one, one batch is sent at a time.
+func (batched *Batched) dispatch() {
+	for {
+		calls := []*batchCall{}
+		select {
+		case call := <-batched.queue:
+			calls = append(calls, call)
+		case <-batched.stop:
+			return
+		}
+
+		timer := time.NewTimer(batched.maxDelay)
+	collect:
+		for len(calls) < batched.maxSize {
+			select {
+			case call := <-batched.queue:
+				calls = append(calls, call)
+			case <-timer.C:
+				break collect
+			case <-batched.stop:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		batched.send(calls)
+	}
+}
+
+func (batched *Batched) send(calls []*batchCall) {
+	pending := []*batchCall{}
+	requests := []RpcRequest{}
+	for _, call := range calls {
+		if call.ctx.Err() != nil {
+			continue
+		}
+		call.request.Id = int64(len(requests) + 1)
+		call.request.Version = ProtocolVersion
+		pending = append(pending, call)
+		requests = append(requests, call.request)
+	}
+	if len(requests) == 0 {
+		return
+	}
+	if batched.sent != nil {
+		batched.sent(len(requests))
+	}
+
+	responses, err := batched.persistent.CallBatch(context.Background(), requests)
+	byId := map[int64]RpcResponse{}
+	for _, response := range responses {
+		byId[response.Id] = response
+	}
+	for _, call := range pending {
+		result := batchResult{err: err}
+		if err == nil {
+			response, ok := byId[call.request.Id]
+			result = batchResult{response: response}
+			if !ok {
+				result.err = ErrMissingResponse
+			}
+		}
+		call.response <- result
+	}
+}
@@ -0,0 +1,114 @@
+package runners
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+	"xserver/src/config"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+)
+
+const (
+	terminateAllPollInterval = 50 * time.Millisecond
+)
+
+func init() {
+	metrics.Register("xserver_orphans_reaped_total", metrics.CounterType, "Number of orphaned units processes killed by the reaper.")
+}
+
+// groups are running processes started in their own process groups by start.
+var groups = struct {
+	mutex     sync.Mutex
+	processes map[int]*os.Process
+}{processes: map[int]*os.Process{}}
+
+// start starts the command in its own process group with the unit process settings, the group is tracked until wait.
+func start(cmd *exec.Cmd, settings *config.Process) error {
+	setGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := setPriority(cmd.Process.Pid, settings); err != nil {
+		signalGroup(cmd.Process, syscall.SIGKILL)
+		cmd.Wait()
+		return fmt.Errorf("failed set process priority: %w", err)
+	}
+
+	groups.mutex.Lock()
+	groups.processes[cmd.Process.Pid] = cmd.Process
+	groups.mutex.Unlock()
+	return nil
+}
+
+// wait waits for the command started by start and stops tracking its group, groups are terminated by cancel, stop and shutdown only.
+func wait(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+
+	groups.mutex.Lock()
+	delete(groups.processes, cmd.Process.Pid)
+	groups.mutex.Unlock()
+
+	return err
+}
+
+// terminateGroup sends SIGTERM to the process group and SIGKILL after grace.
+func terminateGroup(process *os.Process, grace time.Duration) error {
+	if err := signalGroup(process, syscall.SIGTERM); err != nil {
+		return err
+	}
+	time.AfterFunc(grace, func() { signalGroup(process, syscall.SIGKILL) })
+	return nil
+}
+
+func running() int {
+	groups.mutex.Lock()
+	defer groups.mutex.Unlock()
+	return len(groups.processes)
+}
+
+// TerminateAll terminates groups of all running processes and waits until they exit, it is called on shutdown.
+func TerminateAll() {
+	groups.mutex.Lock()
+	for _, process := range groups.processes {
+		terminateGroup(process, waitDelay)
+	}
+	groups.mutex.Unlock()
+
+	deadline := time.Now().Add(2 * waitDelay)
+	for running() != 0 && time.Now().Before(deadline) {
+		time.Sleep(terminateAllPollInterval)
+	}
+}
+
+// tracked reports whether the process group is started by the server and still running.
+func tracked(group int) bool {
+	groups.mutex.Lock()
+	defer groups.mutex.Unlock()
+	_, ok := groups.processes[group]
+	return ok
+}
+
+// StartReaper kills orphaned processes of units built to dirs every interval until stop.
+func StartReaper(dirs []string, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, pid := range reapOrphans(dirs) {
+					logger.Info(fmt.Sprintf("[XServer] [Reaper] orphaned process %d killed", pid))
+					metrics.Inc("xserver_orphans_reaped_total")
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
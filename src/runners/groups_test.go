@@ -0,0 +1,129 @@
+//go:build !windows
+
+package runners
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// background writes the script starting the background process, which writes its pid to the pid file, and runs the rest of the script.
+func background(t *testing.T, rest string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	pidPath := filepath.Join(dir, "pid")
+	script := filepath.Join(dir, "handler.sh")
+	source := "#!/bin/sh\nsh -c 'echo $$ > " + pidPath + "; exec sleep 30' > /dev/null 2>&1 &\nwhile [ ! -s " + pidPath + " ]; do sleep 0.01; done\n" + rest + "\n"
+	if err := os.WriteFile(script, []byte(source), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return script, pidPath
+}
+
+func alive(pid int) bool {
+	return syscall.Kill(pid, 0) == nil
+}
+
+func waitExited(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		var status syscall.WaitStatus
+		syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
+		if !alive(pid) {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func readPid(t *testing.T, pidPath string) int {
+	t.Helper()
+	data, err := os.ReadFile(pidPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pid
+}
+
+func TestGroupTermination(t *testing.T) {
+	tests := []struct {
+		name       string
+		rest       string
+		timeout    time.Duration
+		terminated bool
+	}{
+		{name: "exit", rest: "echo done"},
+		{name: "timeout", rest: "sleep 30", timeout: 200 * time.Millisecond, terminated: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			script, pidPath := background(t, test.rest)
+			ctx := context.Background()
+			if test.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, test.timeout)
+				defer cancel()
+			}
+
+			output := &bytes.Buffer{}
+			Executable(ctx, script, output, strings.NewReader(""), Options{
+				Error: func(message string, err error) {},
+				Log:   func(message string) {},
+			})
+			if running() != 0 {
+				t.Fatal("process group is tracked after the process exit")
+			}
+
+			pid := readPid(t, pidPath)
+			defer syscall.Kill(pid, syscall.SIGKILL)
+			if exited := waitExited(pid, 2*waitDelay); exited != test.terminated {
+				t.Fatalf("background process exited %v, expected %v", exited, test.terminated)
+			}
+		})
+	}
+}
+
+func TestTerminateAll(t *testing.T) {
+	script, pidPath := background(t, "sleep 30")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Executable(context.Background(), script, &bytes.Buffer{}, strings.NewReader(""), Options{
+			Error: func(message string, err error) {},
+			Log:   func(message string) {},
+		})
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for (running() == 0 || !fileExists(pidPath)) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	pid := readPid(t, pidPath)
+	defer syscall.Kill(pid, syscall.SIGKILL)
+
+	TerminateAll()
+	if running() != 0 {
+		t.Fatal("process groups are running after TerminateAll")
+	}
+	if !waitExited(pid, 3*waitDelay) {
+		t.Fatal("background process is not terminated with its group")
+	}
+	<-done
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Size() != 0
+}
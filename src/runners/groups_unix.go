@@ -0,0 +1,18 @@
+//go:build !windows
+
+package runners
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func setGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalGroup signals all processes of the group led by the process, it works after the leader exited as well.
+func signalGroup(process *os.Process, signal syscall.Signal) error {
+	return syscall.Kill(-process.Pid, signal)
+}
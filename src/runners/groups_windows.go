@@ -0,0 +1,17 @@
+//go:build windows
+
+package runners
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func setGroup(cmd *exec.Cmd) {
+}
+
+// signalGroup kills the process at once, windows processes have no groups and signals.
+func signalGroup(process *os.Process, signal syscall.Signal) error {
+	return process.Kill()
+}
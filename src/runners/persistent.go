@@ -0,0 +1,303 @@
+package runners
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/protobuf"
+)
+
+const (
+	ProtocolJsonRpc = config.ProtocolJsonRpc
+	ProtocolVersion = 1
+
+	maxResponseLine = 64 * 1024 * 1024
+
+	persistentRestartDelay = time.Second
+)
+
+var (
+	ErrProcessExited = errors.New("persistent process exited")
+)
+
+type RpcRequest struct {
+	Id      int64               `json:"id"`
+	Version int                 `json:"version"`
+	Method  string              `json:"method"`
+	Path    string              `json:"path"`
+	Query   string              `json:"query,omitempty"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    string              `json:"body"`
+}
+
+type RpcResponse struct {
+	Id        int64             `json:"id"`
+	Version   int               `json:"version,omitempty"`
+	Status    int               `json:"status"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      string            `json:"body"`
+	Responses []RpcResponse     `json:"responses,omitempty"`
+}
+
+// RpcBatch is requests sent in one line, the process responds them in one line with responses.
+type RpcBatch struct {
+	Id       int64        `json:"id"`
+	Version  int          `json:"version"`
+	Requests []RpcRequest `json:"requests"`
+}
+
+type Persistent struct {
+	command  string
+	args     []string
+	env      []string
+	encoding string
+	process  *config.Process
+	log      func(message string)
+	mutex    sync.Mutex
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	nextId   int64
+	pending  map[int64]chan RpcResponse
+	exited   chan struct{}
+	stopped  bool
+}
+
+func NewPersistent(command string, args []string, env []string, encoding string, process *config.Process, log func(message string)) *Persistent {
+	return &Persistent{
+		command:  command,
+		args:     args,
+		env:      env,
+		encoding: encoding,
+		process:  process,
+		log:      log,
+		pending:  map[int64]chan RpcResponse{},
+	}
+}
+
+// encode encodes the message as the json line or the length delimited protobuf RpcMessage.
+func (persistent *Persistent) encode(message interface{}) ([]byte, error) {
+	if persistent.encoding != EncodingProtobuf {
+		data, err := json.Marshal(message)
+		return append(data, '\n'), err
+	}
+	data, err := encodeRpcMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	buffer := &bytes.Buffer{}
+	err = protobuf.WriteDelimited(buffer, data)
+	return buffer.Bytes(), err
+}
+
+// read calls the visitor for every response of the process until its stdout is closed.
+func (persistent *Persistent) read(stdout io.Reader, visit func(response RpcResponse)) {
+	if persistent.encoding == EncodingProtobuf {
+		reader := bufio.NewReader(stdout)
+		for {
+			data, err := protobuf.ReadDelimited(reader)
+			if err != nil {
+				if err != io.EOF {
+					persistent.log(fmt.Sprintf("stop reading responses: %s", err))
+					io.Copy(io.Discard, reader)
+				}
+				return
+			}
+			response, err := decodeRpcResponse(data)
+			if err != nil {
+				persistent.log(fmt.Sprintf("skip invalid response message: %s", err))
+				continue
+			}
+			visit(response)
+		}
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxResponseLine)
+	for scanner.Scan() {
+		response := RpcResponse{}
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+			persistent.log(fmt.Sprintf("skip invalid response line: %s", err))
+			continue
+		}
+		visit(response)
+	}
+}
+
+func (persistent *Persistent) start() error {
+	cmd := command(context.Background(), persistent.process, persistent.command, persistent.args...)
+	if len(persistent.env) != 0 {
+		cmd.Env = append(os.Environ(), persistent.env...)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	persistent.log("start persistent process")
+	if err := start(cmd, persistent.process); err != nil {
+		return err
+	}
+
+	exited := make(chan struct{})
+	persistent.cmd = cmd
+	persistent.stdin = stdin
+	persistent.exited = exited
+
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			persistent.log("stderr: " + scanner.Text())
+		}
+	}()
+
+	go func() {
+		persistent.read(stdout, func(response RpcResponse) {
+			persistent.mutex.Lock()
+			responseChannel, ok := persistent.pending[response.Id]
+			delete(persistent.pending, response.Id)
+			persistent.mutex.Unlock()
+			if ok {
+				responseChannel <- response
+			}
+		})
+
+		err := wait(cmd)
+		persistent.log(fmt.Sprintf("persistent process exited: %v", err))
+
+		persistent.mutex.Lock()
+		if persistent.cmd == cmd {
+			persistent.cmd = nil
+			persistent.stdin = nil
+		}
+		persistent.mutex.Unlock()
+		close(exited)
+	}()
+
+	return nil
+}
+
+// Warm starts the process at once and restarts it after exits until Stop, so requests don't wait for the process start e.g. models loading.
+func (persistent *Persistent) Warm() {
+	go func() {
+		for {
+			persistent.mutex.Lock()
+			if persistent.stopped {
+				persistent.mutex.Unlock()
+				return
+			}
+			var exited chan struct{}
+			if persistent.cmd == nil {
+				if err := persistent.start(); err != nil {
+					persistent.log(fmt.Sprintf("failed start persistent process: %s", err))
+				}
+			}
+			if persistent.cmd != nil {
+				exited = persistent.exited
+			}
+			persistent.mutex.Unlock()
+
+			if exited != nil {
+				<-exited
+			}
+			time.Sleep(persistentRestartDelay)
+		}
+	}()
+}
+
+func (persistent *Persistent) Call(ctx context.Context, request RpcRequest) (RpcResponse, error) {
+	return persistent.call(ctx, func(id int64) interface{} {
+		request.Id = id
+		request.Version = ProtocolVersion
+		return request
+	})
+}
+
+// CallBatch sends the requests in one message and returns responses of the process in its order.
+func (persistent *Persistent) CallBatch(ctx context.Context, requests []RpcRequest) ([]RpcResponse, error) {
+	response, err := persistent.call(ctx, func(id int64) interface{} {
+		return RpcBatch{Id: id, Version: ProtocolVersion, Requests: requests}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response.Responses, nil
+}
+
+func (persistent *Persistent) call(ctx context.Context, message func(id int64) interface{}) (RpcResponse, error) {
+	persistent.mutex.Lock()
+	if persistent.cmd == nil {
+		if err := persistent.start(); err != nil {
+			persistent.mutex.Unlock()
+			return RpcResponse{}, err
+		}
+	}
+
+	persistent.nextId++
+	id := persistent.nextId
+	responseChannel := make(chan RpcResponse, 1)
+	persistent.pending[id] = responseChannel
+	stdin := persistent.stdin
+	exited := persistent.exited
+
+	data, err := persistent.encode(message(id))
+	if err == nil {
+		_, err = stdin.Write(data)
+	}
+	persistent.mutex.Unlock()
+
+	cancel := func() {
+		persistent.mutex.Lock()
+		delete(persistent.pending, id)
+		persistent.mutex.Unlock()
+	}
+
+	if err != nil {
+		cancel()
+		return RpcResponse{}, err
+	}
+
+	select {
+	case response := <-responseChannel:
+		if response.Version != 0 && response.Version != ProtocolVersion {
+			return RpcResponse{}, fmt.Errorf("incompatible protocol version %d of handler, server supports %d, regenerate shims with xserver init", response.Version, ProtocolVersion)
+		}
+		return response, nil
+	case <-exited:
+		cancel()
+		return RpcResponse{}, ErrProcessExited
+	case <-ctx.Done():
+		cancel()
+		return RpcResponse{}, ctx.Err()
+	}
+}
+
+func (persistent *Persistent) Stop() {
+	persistent.mutex.Lock()
+	defer persistent.mutex.Unlock()
+
+	persistent.stopped = true
+	if persistent.stdin != nil {
+		persistent.stdin.Close()
+	}
+	if persistent.cmd != nil && persistent.cmd.Process != nil {
+		terminateGroup(persistent.cmd.Process, waitDelay)
+	}
+}
@@ -0,0 +1,43 @@
+//go:build linux
+
+package runners
+
+import (
+	"syscall"
+	"xserver/src/config"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+var (
+	ioClasses = map[string]int{
+		config.IoClassRealtime:   1,
+		config.IoClassBestEffort: 2,
+		config.IoClassIdle:       3,
+	}
+)
+
+// setPriority sets the nice value and the io scheduling class of the started process, its children inherit them.
+func setPriority(pid int, settings *config.Process) error {
+	if settings == nil {
+		return nil
+	}
+	if settings.Nice != 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, settings.Nice); err != nil {
+			return err
+		}
+	}
+	if settings.IoClass != "" {
+		priority := ioClasses[settings.IoClass]<<ioprioClassShift | settings.IoPriority
+		if settings.IoClass == config.IoClassIdle {
+			priority = ioClasses[settings.IoClass] << ioprioClassShift
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), uintptr(priority)); errno != 0 {
+			return errno
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !windows
+
+package runners
+
+import (
+	"syscall"
+	"xserver/src/config"
+)
+
+// setPriority sets the nice value of the started process, io scheduling classes are supported on linux only.
+func setPriority(pid int, settings *config.Process) error {
+	if settings == nil || settings.Nice == 0 {
+		return nil
+	}
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, settings.Nice)
+}
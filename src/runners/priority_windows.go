@@ -0,0 +1,12 @@
+//go:build windows
+
+package runners
+
+import (
+	"xserver/src/config"
+)
+
+// setPriority keeps the priority of the server, process settings aren't supported on windows.
+func setPriority(pid int, settings *config.Process) error {
+	return nil
+}
@@ -0,0 +1,17 @@
+package runners
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"xserver/src/config"
+)
+
+// command creates the command of the unit process, the umask is set by the shell executing the command.
+func command(ctx context.Context, settings *config.Process, path string, args ...string) *exec.Cmd {
+	if settings != nil && settings.Umask != "" && runtime.GOOS != "windows" {
+		script := "umask " + settings.Umask + ` && exec "$0" "$@"`
+		return exec.CommandContext(ctx, "/bin/sh", append([]string{"-c", script, path}, args...)...)
+	}
+	return exec.CommandContext(ctx, path, args...)
+}
@@ -0,0 +1,127 @@
+package runners
+
+import (
+	"fmt"
+	"sort"
+	"xserver/src/config"
+	"xserver/src/protobuf"
+)
+
+const (
+	EncodingJson     = config.EncodingJson
+	EncodingProtobuf = config.EncodingProtobuf
+)
+
+// Fields of the Rpc messages of the protobuf schema.
+const (
+	messageRequest = 1
+	messageBatch   = 2
+
+	requestId      = 1
+	requestVersion = 2
+	requestMethod  = 3
+	requestPath    = 4
+	requestQuery   = 5
+	requestHeaders = 6
+	requestBody    = 7
+
+	batchId       = 1
+	batchVersion  = 2
+	batchRequests = 3
+
+	responseId        = 1
+	responseVersion   = 2
+	responseStatus    = 3
+	responseHeaders   = 4
+	responseBody      = 5
+	responseResponses = 6
+
+	entryKey   = 1
+	entryValue = 2
+)
+
+func encodeRpcRequest(request RpcRequest) []byte {
+	encoder := &protobuf.Encoder{}
+	encoder.Int(requestId, request.Id)
+	encoder.Int(requestVersion, int64(request.Version))
+	encoder.String(requestMethod, request.Method)
+	encoder.String(requestPath, request.Path)
+	encoder.String(requestQuery, request.Query)
+
+	names := []string{}
+	for name := range request.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := &protobuf.Encoder{}
+		for _, value := range request.Headers[name] {
+			values.Raw(1, []byte(value))
+		}
+		entry := &protobuf.Encoder{}
+		entry.String(entryKey, name)
+		entry.Raw(entryValue, values.Data())
+		encoder.Raw(requestHeaders, entry.Data())
+	}
+
+	encoder.Bytes(requestBody, []byte(request.Body))
+	return encoder.Data()
+}
+
+// encodeRpcMessage encodes the request or the batch as the RpcMessage.
+func encodeRpcMessage(message interface{}) ([]byte, error) {
+	encoder := &protobuf.Encoder{}
+	switch message := message.(type) {
+	case RpcRequest:
+		encoder.Raw(messageRequest, encodeRpcRequest(message))
+	case RpcBatch:
+		batch := &protobuf.Encoder{}
+		batch.Int(batchId, message.Id)
+		batch.Int(batchVersion, int64(message.Version))
+		for _, request := range message.Requests {
+			batch.Raw(batchRequests, encodeRpcRequest(request))
+		}
+		encoder.Raw(messageBatch, batch.Data())
+	default:
+		return nil, fmt.Errorf("unsupported rpc message %T", message)
+	}
+	return encoder.Data(), nil
+}
+
+func decodeRpcResponse(data []byte) (RpcResponse, error) {
+	response := RpcResponse{}
+	err := protobuf.Decode(data, func(field protobuf.Field) error {
+		switch field.Number {
+		case responseId:
+			response.Id = field.Int()
+		case responseVersion:
+			response.Version = int(field.Int())
+		case responseStatus:
+			response.Status = int(field.Int())
+		case responseHeaders:
+			name, value := "", ""
+			err := protobuf.Decode(field.Data, func(entry protobuf.Field) error {
+				switch entry.Number {
+				case entryKey:
+					name = entry.String()
+				case entryValue:
+					value = entry.String()
+				}
+				return nil
+			})
+			if response.Headers == nil {
+				response.Headers = map[string]string{}
+			}
+			response.Headers[name] = value
+			return err
+		case responseBody:
+			response.Body = field.String()
+		case responseResponses:
+			nested, err := decodeRpcResponse(field.Data)
+			response.Responses = append(response.Responses, nested)
+			return err
+		}
+		return nil
+	})
+	return response, err
+}
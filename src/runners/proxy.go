@@ -0,0 +1,194 @@
+package runners
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+	"xserver/src/config"
+	"xserver/src/logger"
+	"xserver/src/problem"
+)
+
+const (
+	ProtocolHttp = "http"
+
+	proxyDialInterval  = 100 * time.Millisecond
+	proxyRestartDelay  = time.Second
+	proxyStopGraceTime = 5 * time.Second
+	maxOutputLine      = 64 * 1024
+)
+
+type Proxied struct {
+	command        string
+	args           []string
+	env            []string
+	process        *config.Process
+	socket         string
+	port           int
+	startupTimeout time.Duration
+	log            func(message string)
+	proxy          *httputil.ReverseProxy
+	mutex          sync.Mutex
+	cmd            *exec.Cmd
+	ready          chan struct{}
+	stopped        bool
+}
+
+func NewProxied(command string, args []string, env []string, process *config.Process, socket string, port int, startupTimeout time.Duration, log func(message string)) (*Proxied, error) {
+	if socket == "" && port == 0 {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, fmt.Errorf("failed allocate port: %s", err)
+		}
+		port = listener.Addr().(*net.TCPAddr).Port
+		listener.Close()
+	}
+
+	proxied := &Proxied{
+		command:        command,
+		args:           args,
+		env:            env,
+		process:        process,
+		socket:         socket,
+		port:           port,
+		startupTimeout: startupTimeout,
+		log:            log,
+		ready:          make(chan struct{}),
+	}
+
+	target := &url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", port)}
+	proxied.proxy = httputil.NewSingleHostReverseProxy(target)
+	if socket != "" {
+		target.Host = "unix"
+		proxied.proxy.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		}
+	}
+	proxied.proxy.ErrorHandler = func(writer http.ResponseWriter, request *http.Request, err error) {
+		log(fmt.Sprintf("proxy error: %s", err))
+		problem.Write(writer, request, problem.New(http.StatusBadGateway, problem.CodeBadGateway, fmt.Sprintf("proxy error: %s", err)))
+	}
+
+	return proxied, nil
+}
+
+func (proxied *Proxied) dial() error {
+	network, address := "tcp", fmt.Sprintf("127.0.0.1:%d", proxied.port)
+	if proxied.socket != "" {
+		network, address = "unix", proxied.socket
+	}
+
+	connection, err := net.DialTimeout(network, address, proxyDialInterval)
+	if err != nil {
+		return err
+	}
+	return connection.Close()
+}
+
+func (proxied *Proxied) run() error {
+	if proxied.socket != "" {
+		os.Remove(proxied.socket)
+	}
+
+	cmd := command(context.Background(), proxied.process, proxied.command, proxied.args...)
+	cmd.Env = append(append(os.Environ(), proxied.env...), "XSERVER_PORT="+strconv.Itoa(proxied.port), "XSERVER_SOCKET="+proxied.socket)
+	if proxied.socket == "" {
+		cmd.Env = append(cmd.Env, "PORT="+strconv.Itoa(proxied.port))
+	}
+	output := logger.NewLineWriter("output: ", maxOutputLine, proxied.log)
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	proxied.log("start proxied process")
+	if err := start(cmd, proxied.process); err != nil {
+		return err
+	}
+
+	proxied.mutex.Lock()
+	proxied.cmd = cmd
+	proxied.mutex.Unlock()
+
+	exited := make(chan error, 1)
+	go func() { exited <- wait(cmd) }()
+
+	deadline := time.Now().Add(proxied.startupTimeout)
+	for {
+		if err := proxied.dial(); err == nil {
+			break
+		}
+		select {
+		case err := <-exited:
+			return fmt.Errorf("process exited before listening: %v", err)
+		case <-time.After(proxyDialInterval):
+		}
+		if time.Now().After(deadline) {
+			signalGroup(cmd.Process, syscall.SIGKILL)
+			<-exited
+			return fmt.Errorf("process is not listening after %s", proxied.startupTimeout)
+		}
+	}
+
+	proxied.log("proxied process is listening")
+	proxied.mutex.Lock()
+	select {
+	case <-proxied.ready:
+	default:
+		close(proxied.ready)
+	}
+	proxied.mutex.Unlock()
+
+	return <-exited
+}
+
+func (proxied *Proxied) Start() {
+	go func() {
+		for {
+			err := proxied.run()
+
+			proxied.mutex.Lock()
+			stopped := proxied.stopped
+			proxied.mutex.Unlock()
+			if stopped {
+				return
+			}
+
+			proxied.log(fmt.Sprintf("proxied process exited: %v, restart", err))
+			time.Sleep(proxyRestartDelay)
+		}
+	}()
+}
+
+func (proxied *Proxied) Stop() {
+	proxied.mutex.Lock()
+	defer proxied.mutex.Unlock()
+
+	proxied.stopped = true
+	if proxied.cmd != nil && proxied.cmd.Process != nil {
+		process := proxied.cmd.Process
+		signalGroup(process, syscall.SIGINT)
+		time.AfterFunc(proxyStopGraceTime, func() { signalGroup(process, syscall.SIGKILL) })
+	}
+}
+
+func (proxied *Proxied) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	select {
+	case <-proxied.ready:
+	case <-time.After(proxied.startupTimeout):
+		problem.Write(writer, request, problem.New(http.StatusServiceUnavailable, problem.CodeNotReady, "proxied handler is not ready"))
+		return
+	case <-request.Context().Done():
+		return
+	}
+	proxied.proxy.ServeHTTP(writer, request)
+}
@@ -0,0 +1,78 @@
+//go:build linux
+
+package runners
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// runsFrom reports whether the process executable or one of its arguments, e.g. the script of an interpreter, is inside one of dirs.
+func runsFrom(pid string, dirs []string) bool {
+	cwd, _ := os.Readlink("/proc/" + pid + "/cwd")
+	paths := []string{}
+	if exe, err := os.Readlink("/proc/" + pid + "/exe"); err == nil {
+		paths = append(paths, exe)
+	}
+	if cmdline, err := os.ReadFile("/proc/" + pid + "/cmdline"); err == nil {
+		paths = append(paths, strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00")...)
+	}
+
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			if cwd == "" {
+				continue
+			}
+			path = filepath.Join(cwd, path)
+		}
+		for _, dir := range dirs {
+			if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reapOrphans kills processes running units from dirs which are reparented to init or to the server and aren't in groups of its running processes,
+// processes of the server group are its own commands e.g. builds.
+func reapOrphans(dirs []string) []int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	self := os.Getpid()
+	selfGroup := syscall.Getpgrp()
+	reaped := []int{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		data, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		stat := string(data)
+		fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+		if len(fields) < 3 {
+			continue
+		}
+		parent, _ := strconv.Atoi(fields[1])
+		group, _ := strconv.Atoi(fields[2])
+		if (parent != 1 && parent != self) || group == selfGroup || tracked(group) || !runsFrom(entry.Name(), dirs) {
+			continue
+		}
+		if syscall.Kill(pid, syscall.SIGKILL) == nil {
+			reaped = append(reaped, pid)
+		}
+	}
+	return reaped
+}
@@ -2,49 +2,143 @@ package runners
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"io/ioutil"
+	"os"
 	"os/exec"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/utils"
 )
 
-func Executable(path string, writer io.Writer, request io.Reader, errorCallback func(string, error), logCallback func(string), args ...string) {
+const (
+	lineTruncatedMarker = " [XServer] line truncated"
+
+	// waitDelay is the time the cancelled process has to exit after SIGTERM before it is killed.
+	waitDelay = time.Second
+)
+
+type Options struct {
+	Args    []string
+	Env     []string
+	Error   func(message string, err error)
+	Log     func(message string)
+	Started func(spawn time.Duration)
+	Stream  bool
+	// Process is the nice, io priority and umask of the process.
+	Process *config.Process
+	// MaxLine is the max size of stdout and stderr lines, longer lines are truncated.
+	MaxLine int
+	// Stderr receives the copy of the process stderr, which is written to the response as well.
+	Stderr io.Writer
+}
+
+func Executable(ctx context.Context, path string, writer io.Writer, request io.Reader, options Options) {
 	myPipeReader, handlerPipeWriter := io.Pipe()
 	defer myPipeReader.Close()
 	defer handlerPipeWriter.Close()
 
-	requestBody, err := ioutil.ReadAll(request)
-	if err != nil {
-		errorCallback("failed read request body", err)
-		return
+	startedAt := time.Now()
+
+	stdin := request
+	if !options.Stream {
+		requestBody, err := ioutil.ReadAll(request)
+		if err != nil {
+			options.Error("failed read request body", err)
+			return
+		}
+		stdin = bytes.NewBuffer(requestBody)
 	}
 
-	cmd := exec.Command(path, args...)
-	cmd.Stdin = bytes.NewBuffer(requestBody)
-	cmd.Stdout = handlerPipeWriter
-	cmd.Stderr = handlerPipeWriter
+	cmd := command(ctx, options.Process, path, options.Args...)
+	cmd.WaitDelay = waitDelay
+	cmd.Cancel = func() error { return terminateGroup(cmd.Process, waitDelay) }
+	if len(options.Env) != 0 {
+		cmd.Env = append(os.Environ(), options.Env...)
+	}
+	cmd.Stdin = stdin
+	var stderr io.Writer = handlerPipeWriter
+	if options.Stderr != nil {
+		stderr = io.MultiWriter(handlerPipeWriter, options.Stderr)
+	}
 
 	go func() {
 		defer handlerPipeWriter.Close()
-		logCallback("run file")
-		if err := cmd.Run(); err != nil {
-			errorCallback("failed run handler file", err)
+		options.Log("run file")
+		relayed, err := pipeOutput(cmd, handlerPipeWriter, stderr, options.MaxLine)
+		if err != nil {
+			options.Error("failed run handler file", err)
+			return
+		}
+		defer relayed.copied.Wait()
+
+		err = start(cmd, options.Process)
+		relayed.close()
+		if err != nil {
+			options.Error("failed run handler file", err)
+			return
+		}
+		if options.Started != nil {
+			options.Started(time.Since(startedAt))
+		}
+		if err := wait(cmd); err != nil {
+			options.Error("failed run handler file", err)
 		}
 	}()
 
 	if _, err := io.Copy(writer, myPipeReader); err != nil {
-		errorCallback("failed copy handler response", err)
+		options.Error("failed copy handler response", err)
+	}
+}
+
+// output relays the process stdout and stderr by os pipes, so the process is waited without waiting for its children holding them.
+type output struct {
+	files  []*os.File
+	copied sync.WaitGroup
+}
+
+func pipeOutput(cmd *exec.Cmd, stdout io.Writer, stderr io.Writer, maxLine int) (*output, error) {
+	relayed := &output{}
+	for _, writer := range []io.Writer{stdout, stderr} {
+		if maxLine > 0 {
+			writer = &utils.LineLimitedWriter{Writer: writer, Limit: maxLine, Marker: lineTruncatedMarker}
+		}
+		reader, file, err := os.Pipe()
+		if err != nil {
+			relayed.close()
+			return nil, err
+		}
+		relayed.files = append(relayed.files, file)
+		relayed.copied.Add(1)
+		go func(writer io.Writer) {
+			defer relayed.copied.Done()
+			defer reader.Close()
+			io.Copy(writer, reader)
+		}(writer)
+	}
+	cmd.Stdout = relayed.files[0]
+	cmd.Stderr = relayed.files[1]
+	return relayed, nil
+}
+
+// close closes the server copies of the pipes, relaying ends once the process group has exited.
+func (relayed *output) close() {
+	for _, file := range relayed.files {
+		file.Close()
 	}
 }
 
-func Tool(tool string, path string, writer io.Writer, request io.Reader, errorCallback func(string, error), logCallback func(string), args ...string) {
-	cmdArgs := append([]string{path}, args...)
-	Executable(tool, writer, request, errorCallback, logCallback, cmdArgs...)
+func Tool(ctx context.Context, tool string, path string, writer io.Writer, request io.Reader, options Options) {
+	options.Args = append([]string{path}, options.Args...)
+	Executable(ctx, tool, writer, request, options)
 }
 
-func Python(path string, writer io.Writer, request io.Reader, errorCallback func(string, error), logCallback func(string), args ...string) {
-	Tool("python", path, writer, request, errorCallback, logCallback, args...)
+func Python(ctx context.Context, path string, writer io.Writer, request io.Reader, options Options) {
+	Tool(ctx, "python", path, writer, request, options)
 }
 
-func Lua(path string, writer io.Writer, request io.Reader, errorCallback func(string, error), logCallback func(string), args ...string) {
-	Tool("lua", path, writer, request, errorCallback, logCallback, args...)
+func Lua(ctx context.Context, path string, writer io.Writer, request io.Reader, options Options) {
+	Tool(ctx, "lua", path, writer, request, options)
 }
@@ -0,0 +1,192 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"xserver/src/config"
+)
+
+// Client manages objects of the S3 compatible storage signed by AWS signature version 4, urls are path style.
+type Client struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// Create creates the client of the bucket, keys are read from the settings environment variables.
+func Create(settings config.S3) (*Client, error) {
+	accessKey, secretKey := os.Getenv(settings.AccessKeyEnv), os.Getenv(settings.SecretKeyEnv)
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("s3 keys envs %s and %s are not set", settings.AccessKeyEnv, settings.SecretKeyEnv)
+	}
+	endpoint := settings.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", settings.Region)
+	}
+	return &Client{
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		region:    settings.Region,
+		bucket:    settings.Bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// escape encodes the object key path as required by the signature, all except unreserved characters and slashes.
+func escape(path string) string {
+	escaped := strings.Builder{}
+	for _, char := range []byte(path) {
+		switch {
+		case char >= 'A' && char <= 'Z', char >= 'a' && char <= 'z', char >= '0' && char <= '9', strings.IndexByte("-_.~/", char) >= 0:
+			escaped.WriteByte(char)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", char)
+		}
+	}
+	return escaped.String()
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	hash := hmac.New(sha256.New, key)
+	hash.Write([]byte(data))
+	return hash.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Put uploads the object of the key to the bucket.
+func (client *Client) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	_, err := client.do(ctx, http.MethodPut, key, url.Values{}, body, contentType)
+	return err
+}
+
+// Get downloads the object of the key.
+func (client *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	return client.do(ctx, http.MethodGet, key, url.Values{}, nil, "")
+}
+
+// Delete deletes the object of the key.
+func (client *Client) Delete(ctx context.Context, key string) error {
+	_, err := client.do(ctx, http.MethodDelete, key, url.Values{}, nil, "")
+	return err
+}
+
+type Object struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+type listResult struct {
+	Contents              []Object `xml:"Contents"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken"`
+}
+
+// List returns objects of the bucket with keys starting with the prefix.
+func (client *Client) List(ctx context.Context, prefix string) ([]Object, error) {
+	objects := []Object{}
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		data, err := client.do(ctx, http.MethodGet, "", query, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		result := listResult{}
+		if err := xml.Unmarshal(data, &result); err != nil {
+			return nil, fmt.Errorf("failed decode s3 objects list: %s", err)
+		}
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// canonicalQuery encodes the query sorted by names as required by the signature.
+func canonicalQuery(query url.Values) string {
+	names := []string{}
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := []string{}
+	for _, name := range names {
+		parts = append(parts, strings.ReplaceAll(escape(name), "/", "%2F")+"="+strings.ReplaceAll(escape(query.Get(name)), "/", "%2F"))
+	}
+	return strings.Join(parts, "&")
+}
+
+// do sends the request of the object key, or of the bucket for the empty key, signed by AWS signature version 4.
+func (client *Client) do(ctx context.Context, method string, key string, query url.Values, body []byte, contentType string) ([]byte, error) {
+	path := "/" + client.bucket
+	if key != "" {
+		path += "/" + escape(strings.TrimPrefix(key, "/"))
+	}
+	rawQuery := canonicalQuery(query)
+	target := client.endpoint + path
+	if rawQuery != "" {
+		target += "?" + rawQuery
+	}
+	request, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	headers := []string{"host:" + request.URL.Host, "x-amz-content-sha256:" + payloadHash, "x-amz-date:" + amzDate}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+		signedHeaders = "content-type;" + signedHeaders
+		headers = append([]string{"content-type:" + contentType}, headers...)
+	}
+	canonicalRequest := strings.Join(append(append([]string{method, path, rawQuery}, headers...), "", signedHeaders, payloadHash), "\n")
+	scope := date + "/" + client.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	signingKey := hmacSha256([]byte("AWS4"+client.secretKey), date)
+	for _, part := range []string{client.region, "s3", "aws4_request"} {
+		signingKey = hmacSha256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSha256(signingKey, stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", client.accessKey, scope, signedHeaders, signature))
+
+	response, err := client.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return nil, fmt.Errorf("s3 responded with %d status: %s", response.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return io.ReadAll(response.Body)
+}
@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+	"xserver/src/config"
+
+	"github.com/robfig/cron"
+)
+
+var (
+	secondsParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+	standardFormat atomic.Bool
+)
+
+// Configure sets the cron_format of periods, 5 fields periods are "second minute hour day_of_month month" in the legacy format
+// and "minute hour day_of_month month day_of_week" in the standard format.
+func Configure(cronFormat string) {
+	standardFormat.Store(cronFormat == config.CronFormatStandard)
+}
+
+type locationSchedule struct {
+	schedule cron.Schedule
+	location *time.Location
+}
+
+func (schedule locationSchedule) Next(current time.Time) time.Time {
+	return schedule.schedule.Next(current.In(schedule.location))
+}
+
+// Parse returns the schedule of the period in the configured cron_format.
+func Parse(period string, timezone string) (cron.Schedule, error) {
+	cronFormat := config.CronFormatLegacy
+	if standardFormat.Load() {
+		cronFormat = config.CronFormatStandard
+	}
+	return ParseFormat(period, timezone, cronFormat)
+}
+
+// ParseFormat returns the schedule of the period in the cron format, 6 fields periods and descriptors are the same in both formats.
+func ParseFormat(period string, timezone string, cronFormat string) (cron.Schedule, error) {
+	var schedule cron.Schedule
+	var err error
+
+	if cronFormat != config.CronFormatStandard {
+		schedule, err = cron.Parse(period)
+	} else if strings.HasPrefix(period, "@") || len(strings.Fields(period)) == 6 {
+		schedule, err = secondsParser.Parse(period)
+	} else {
+		schedule, err = cron.ParseStandard(period)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(`failed parse period "%s": %s`, period, err)
+	}
+
+	if timezone == "" {
+		return schedule, nil
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf(`failed load timezone "%s": %s`, timezone, err)
+	}
+
+	return locationSchedule{schedule: schedule, location: location}, nil
+}
+
+func Jitter(jitter string, job func()) (cron.FuncJob, error) {
+	if jitter == "" {
+		return job, nil
+	}
+
+	maxDelay, err := time.ParseDuration(jitter)
+	if err != nil {
+		return nil, fmt.Errorf(`failed parse jitter "%s": %s`, jitter, err)
+	}
+	if maxDelay <= 0 {
+		return job, nil
+	}
+
+	return func() {
+		time.Sleep(time.Duration(rand.Int63n(int64(maxDelay))))
+		job()
+	}, nil
+}
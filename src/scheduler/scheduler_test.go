@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+	"xserver/src/config"
+)
+
+func TestParseFormat(t *testing.T) {
+	current := time.Date(2024, time.January, 1, 10, 0, 30, 0, time.UTC) // Monday
+
+	tests := []struct {
+		period   string
+		format   string
+		timezone string
+		expected time.Time
+	}{
+		// legacy 5 fields periods are "second minute hour day_of_month month"
+		{"0 3 * * *", config.CronFormatLegacy, "", time.Date(2024, time.January, 1, 10, 3, 0, 0, time.UTC)},
+		{"*/5 * * * *", config.CronFormatLegacy, "", time.Date(2024, time.January, 1, 10, 0, 35, 0, time.UTC)},
+		{"0 0 12 * *", config.CronFormatLegacy, "", time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)},
+		// standard 5 fields periods are "minute hour day_of_month month day_of_week"
+		{"0 3 * * *", config.CronFormatStandard, "", time.Date(2024, time.January, 2, 3, 0, 0, 0, time.UTC)},
+		{"*/5 * * * *", config.CronFormatStandard, "", time.Date(2024, time.January, 1, 10, 5, 0, 0, time.UTC)},
+		{"0 9 * * 5", config.CronFormatStandard, "", time.Date(2024, time.January, 5, 9, 0, 0, 0, time.UTC)},
+		// 6 fields periods and descriptors are the same in both formats
+		{"0 0 3 * * *", config.CronFormatLegacy, "", time.Date(2024, time.January, 2, 3, 0, 0, 0, time.UTC)},
+		{"0 0 3 * * *", config.CronFormatStandard, "", time.Date(2024, time.January, 2, 3, 0, 0, 0, time.UTC)},
+		{"@hourly", config.CronFormatLegacy, "", time.Date(2024, time.January, 1, 11, 0, 0, 0, time.UTC)},
+		{"@hourly", config.CronFormatStandard, "", time.Date(2024, time.January, 1, 11, 0, 0, 0, time.UTC)},
+		{"@every 1m", config.CronFormatStandard, "", time.Date(2024, time.January, 1, 10, 1, 30, 0, time.UTC)},
+		// periods are evaluated in the timezone
+		{"0 0 3 * * *", config.CronFormatStandard, "Europe/Moscow", time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		schedule, err := ParseFormat(test.period, test.timezone, test.format)
+		if err != nil {
+			t.Errorf("%s %q: %s", test.format, test.period, err)
+			continue
+		}
+		if next := schedule.Next(current); !next.Equal(test.expected) {
+			t.Errorf("%s %q in %q: next run %s, expected %s", test.format, test.period, test.timezone, next.UTC(), test.expected)
+		}
+	}
+}
+
+func TestParseFormatErrors(t *testing.T) {
+	tests := []struct {
+		period   string
+		format   string
+		timezone string
+	}{
+		{"* * * *", config.CronFormatLegacy, ""},
+		{"* * * *", config.CronFormatStandard, ""},
+		{"60 * * * *", config.CronFormatLegacy, ""},
+		{"* 24 * * *", config.CronFormatStandard, ""},
+		{"@every 1m", config.CronFormatLegacy, "Mars/Olympus"},
+	}
+	for _, test := range tests {
+		if _, err := ParseFormat(test.period, test.timezone, test.format); err == nil {
+			t.Errorf("%s %q in %q: expected error", test.format, test.period, test.timezone)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	defer Configure(config.CronFormatLegacy)
+	current := time.Date(2024, time.January, 1, 10, 0, 30, 0, time.UTC)
+
+	tests := []struct {
+		format   string
+		expected time.Time
+	}{
+		{config.CronFormatLegacy, time.Date(2024, time.January, 1, 10, 3, 0, 0, time.UTC)},
+		{config.CronFormatStandard, time.Date(2024, time.January, 2, 3, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		Configure(test.format)
+		schedule, err := Parse("0 3 * * *", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next := schedule.Next(current); !next.Equal(test.expected) {
+			t.Errorf("%s: next run %s, expected %s", test.format, next, test.expected)
+		}
+	}
+}
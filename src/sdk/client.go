@@ -0,0 +1,309 @@
+package sdk
+
+const goSdk = `// Code generated by "xserver init --sdk". DO NOT EDIT.
+package xserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// ProtocolVersion is the version of the xserver protocol the sdk was generated for.
+const ProtocolVersion = {{version}}
+
+// ReadBody reads the request body of a handler started per request.
+func ReadBody() ([]byte, error) {
+	return io.ReadAll(os.Stdin)
+}
+
+// ReadJson decodes the json request body of a handler started per request.
+func ReadJson(value interface{}) error {
+	return json.NewDecoder(os.Stdin).Decode(value)
+}
+
+// Text returns a text response for Serve handlers.
+func Text(status int, body string) Response {
+	return Response{Status: status, Headers: map[string]string{"Content-Type": "text/plain"}, Body: body}
+}
+
+// Json returns a json response for Serve handlers.
+func Json(status int, value interface{}) Response {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return Text(500, err.Error())
+	}
+	return Response{Status: status, Headers: map[string]string{"Content-Type": "application/json"}, Body: string(data)}
+}
+
+type DbField struct {
+	Name  string ` + "`json:\"name\"`" + `
+	Value string ` + "`json:\"value,omitempty\"`" + `
+}
+
+type DbFilter struct {
+	Name     string ` + "`json:\"name\"`" + `
+	Operator string ` + "`json:\"operator\"`" + `
+	Value    string ` + "`json:\"value\"`" + `
+}
+
+type DbRequest struct {
+	Table   string     ` + "`json:\"table\"`" + `
+	Fields  []DbField  ` + "`json:\"fields,omitempty\"`" + `
+	Filters []DbFilter ` + "`json:\"filters,omitempty\"`" + `
+}
+
+// Client calls the database and key value apis of the server, XSERVER_URL is set by the server for handlers and tasks.
+type Client struct {
+	Url string
+}
+
+func NewClient() *Client {
+	return &Client{Url: os.Getenv("XSERVER_URL")}
+}
+
+func (client *Client) call(path string, request interface{}, response interface{}) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	httpRequest, err := http.NewRequest(http.MethodPost, client.Url+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("X-XServer-Protocol", strconv.Itoa(ProtocolVersion))
+
+	httpResponse, err := http.DefaultClient.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer httpResponse.Body.Close()
+
+	result := struct {
+		Error  string ` + "`json:\"error\"`" + `
+		Detail string ` + "`json:\"detail\"`" + `
+	}{}
+	body, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("invalid response: %s", err)
+	}
+	if result.Error != "" {
+		return fmt.Errorf("%s", result.Error)
+	}
+	if httpResponse.StatusCode >= 400 {
+		return fmt.Errorf("%s", result.Detail)
+	}
+	if response != nil {
+		return json.Unmarshal(body, response)
+	}
+	return nil
+}
+
+func (client *Client) DbInsert(request DbRequest) error {
+	return client.call("/db/insert", request, nil)
+}
+
+func (client *Client) DbSelect(request DbRequest) ([]map[string]string, error) {
+	response := struct {
+		Result []map[string]string ` + "`json:\"result\"`" + `
+	}{}
+	if err := client.call("/db/select", request, &response); err != nil {
+		return nil, err
+	}
+	return response.Result, nil
+}
+
+func (client *Client) DbUpdate(request DbRequest) error {
+	return client.call("/db/update", request, nil)
+}
+
+func (client *Client) DbDelete(request DbRequest) error {
+	return client.call("/db/delete", request, nil)
+}
+
+// KvGet returns the value of the key and false if the key is not set.
+func (client *Client) KvGet(key string) (string, bool, error) {
+	response := struct {
+		Result bool   ` + "`json:\"result\"`" + `
+		Value  string ` + "`json:\"value\"`" + `
+	}{}
+	if err := client.call("/kv/get", map[string]string{"key": key}, &response); err != nil {
+		return "", false, err
+	}
+	return response.Value, response.Result, nil
+}
+
+func (client *Client) KvSet(key string, value string) error {
+	return client.call("/kv/set", map[string]string{"key": key, "value": value}, nil)
+}
+
+func (client *Client) KvDelete(key string) error {
+	return client.call("/kv/delete", map[string]string{"key": key}, nil)
+}
+`
+
+const pythonSdk = `
+
+# Code generated by "xserver init --sdk". DO NOT EDIT.
+import os
+import urllib.error
+import urllib.request
+
+PROTOCOL_VERSION = {{version}}
+
+
+def read_body():
+    """Reads the request body of a handler started per request."""
+    return sys.stdin.read()
+
+
+def read_json():
+    """Decodes the json request body of a handler started per request."""
+    return json.loads(sys.stdin.read())
+
+
+def text(status, body):
+    """Returns a text response for serve handlers."""
+    return {"status": status, "headers": {"Content-Type": "text/plain"}, "body": body}
+
+
+def json_response(status, value):
+    """Returns a json response for serve handlers."""
+    return {"status": status, "headers": {"Content-Type": "application/json"}, "body": json.dumps(value)}
+
+
+class Client:
+    """Calls the database and key value apis of the server, XSERVER_URL is set by the server for handlers and tasks."""
+
+    def __init__(self, url=None):
+        self.url = url or os.environ.get("XSERVER_URL", "")
+
+    def _call(self, path, request):
+        http_request = urllib.request.Request(
+            self.url + path,
+            data=json.dumps(request).encode(),
+            headers={"Content-Type": "application/json", "X-XServer-Protocol": str(PROTOCOL_VERSION)},
+            method="POST",
+        )
+        try:
+            with urllib.request.urlopen(http_request) as http_response:
+                response = json.loads(http_response.read())
+        except urllib.error.HTTPError as error:
+            response = json.loads(error.read() or "{}")
+            raise RuntimeError(response.get("error") or response.get("detail") or str(error))
+        if response.get("error"):
+            raise RuntimeError(response["error"])
+        return response
+
+    def db_insert(self, table, fields):
+        self._call("/db/insert", {"table": table, "fields": fields})
+
+    def db_select(self, table, fields=None, filters=None):
+        return self._call("/db/select", {"table": table, "fields": fields or [], "filters": filters or []})["result"]
+
+    def db_update(self, table, fields, filters=None):
+        self._call("/db/update", {"table": table, "fields": fields, "filters": filters or []})
+
+    def db_delete(self, table, filters=None):
+        self._call("/db/delete", {"table": table, "filters": filters or []})
+
+    def kv_get(self, key):
+        """Returns the value of the key or None if the key is not set."""
+        return self._call("/kv/get", {"key": key}).get("value")
+
+    def kv_set(self, key, value):
+        self._call("/kv/set", {"key": key, "value": value})
+
+    def kv_delete(self, key):
+        self._call("/kv/delete", {"key": key})
+`
+
+const nodeSdk = `
+// Code generated by "xserver init --sdk". DO NOT EDIT.
+const PROTOCOL_VERSION = {{version}};
+
+// readBody reads the request body of a handler started per request.
+function readBody() {
+  return new Promise((resolve, reject) => {
+    const chunks = [];
+    process.stdin.on('data', (chunk) => chunks.push(chunk));
+    process.stdin.on('end', () => resolve(Buffer.concat(chunks).toString()));
+    process.stdin.on('error', reject);
+  });
+}
+
+// readJson decodes the json request body of a handler started per request.
+async function readJson() {
+  return JSON.parse(await readBody());
+}
+
+// text returns a text response for serve handlers.
+function text(status, body) {
+  return { status, headers: { 'Content-Type': 'text/plain' }, body };
+}
+
+// json returns a json response for serve handlers.
+function json(status, value) {
+  return { status, headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(value) };
+}
+
+// Client calls the database and key value apis of the server, XSERVER_URL is set by the server for handlers and tasks.
+class Client {
+  constructor(url) {
+    this.url = url || process.env.XSERVER_URL || '';
+  }
+
+  async call(path, request) {
+    const httpResponse = await fetch(this.url + path, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json', 'X-XServer-Protocol': String(PROTOCOL_VERSION) },
+      body: JSON.stringify(request),
+    });
+    const response = await httpResponse.json();
+    if (response.error || !httpResponse.ok) {
+      throw new Error(response.error || response.detail);
+    }
+    return response;
+  }
+
+  async dbInsert(table, fields) {
+    await this.call('/db/insert', { table, fields });
+  }
+
+  async dbSelect(table, fields = [], filters = []) {
+    return (await this.call('/db/select', { table, fields, filters })).result;
+  }
+
+  async dbUpdate(table, fields, filters = []) {
+    await this.call('/db/update', { table, fields, filters });
+  }
+
+  async dbDelete(table, filters = []) {
+    await this.call('/db/delete', { table, filters });
+  }
+
+  // kvGet returns the value of the key or undefined if the key is not set.
+  async kvGet(key) {
+    return (await this.call('/kv/get', { key })).value;
+  }
+
+  async kvSet(key, value) {
+    await this.call('/kv/set', { key, value });
+  }
+
+  async kvDelete(key) {
+    await this.call('/kv/delete', { key });
+  }
+}
+
+Object.assign(module.exports, { PROTOCOL_VERSION, readBody, readJson, text, json, Client });
+`
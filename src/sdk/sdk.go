@@ -0,0 +1,308 @@
+package sdk
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"xserver/src/protobuf"
+	"xserver/src/runners"
+)
+
+const (
+	ProtocolVersion = runners.ProtocolVersion
+)
+
+var (
+	files = map[string]string{
+		"go/xserver/xserver.go": goShim,
+		"python/xserver.py":     pythonShim,
+		"node/xserver.js":       nodeShim,
+		"proto/xserver.proto":   protobuf.Schema,
+	}
+	sdkFiles = map[string]string{
+		"go/xserver/sdk.go": goSdk,
+		"python/xserver.py": pythonShim + pythonSdk,
+		"node/xserver.js":   nodeShim + nodeSdk,
+	}
+)
+
+func Generate(directory string, withSdk bool) ([]string, error) {
+	generatedFiles := map[string]string{}
+	for name, content := range files {
+		generatedFiles[name] = content
+	}
+	if withSdk {
+		for name, content := range sdkFiles {
+			generatedFiles[name] = content
+		}
+	}
+	for name, content := range generatedFiles {
+		generatedFiles[name] = strings.ReplaceAll(content, "{{version}}", strconv.Itoa(ProtocolVersion))
+	}
+
+	generated := []string{}
+	for name, content := range generatedFiles {
+		filePath := path.Join(directory, name)
+		if err := os.MkdirAll(path.Dir(filePath), os.ModePerm); err != nil {
+			return nil, fmt.Errorf("[XServer] [Init] [Error] failed create directory: %s", err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			return nil, fmt.Errorf(`[XServer] [Init] [Error] failed write "%s" file: %s`, filePath, err)
+		}
+		generated = append(generated, filePath)
+	}
+	return generated, nil
+}
+
+const goShim = `// Code generated by "xserver init". DO NOT EDIT.
+package xserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type Request struct {
+	Id      int64               ` + "`json:\"id\"`" + `
+	Version int                 ` + "`json:\"version,omitempty\"`" + `
+	Method  string              ` + "`json:\"method\"`" + `
+	Path    string              ` + "`json:\"path\"`" + `
+	Query   string              ` + "`json:\"query,omitempty\"`" + `
+	Headers map[string][]string ` + "`json:\"headers,omitempty\"`" + `
+	Body    string              ` + "`json:\"body\"`" + `
+}
+
+type Response struct {
+	Id      int64             ` + "`json:\"id\"`" + `
+	Version int               ` + "`json:\"version,omitempty\"`" + `
+	Status  int               ` + "`json:\"status\"`" + `
+	Headers map[string]string ` + "`json:\"headers,omitempty\"`" + `
+	Body    string            ` + "`json:\"body\"`" + `
+}
+
+type batch struct {
+	Id        int64      ` + "`json:\"id\"`" + `
+	Version   int        ` + "`json:\"version,omitempty\"`" + `
+	Requests  []Request  ` + "`json:\"requests,omitempty\"`" + `
+	Responses []Response ` + "`json:\"responses,omitempty\"`" + `
+}
+
+// Serve reads requests from stdin and writes responses to stdout until stdin is closed.
+// Handlers must not write anything else to stdout, use stderr for logs.
+func Serve(handler func(request Request) Response) error {
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	encoder := json.NewEncoder(os.Stdout)
+
+	for scanner.Scan() {
+		request := Request{}
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			fmt.Fprintf(os.Stderr, "xserver: invalid request: %s\n", err)
+			continue
+		}
+
+		response := handler(request)
+		response.Id = request.Id
+		response.Version = {{version}}
+		if response.Status == 0 {
+			response.Status = 200
+		}
+		if err := encoder.Encode(response); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// ServeBatch reads batches of requests of handlers with run.batch and writes their responses in the requests order.
+// The model is loaded once before ServeBatch and handler runs it on the whole batch.
+func ServeBatch(handler func(requests []Request) []Response) error {
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	encoder := json.NewEncoder(os.Stdout)
+
+	for scanner.Scan() {
+		request := batch{}
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			fmt.Fprintf(os.Stderr, "xserver: invalid batch: %s\n", err)
+			continue
+		}
+
+		responses := handler(request.Requests)
+		for i := range responses {
+			if i < len(request.Requests) {
+				responses[i].Id = request.Requests[i].Id
+			}
+			responses[i].Version = {{version}}
+			if responses[i].Status == 0 {
+				responses[i].Status = 200
+			}
+		}
+		if err := encoder.Encode(batch{Id: request.Id, Version: {{version}}, Responses: responses}); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+`
+
+const pythonShim = `# Code generated by "xserver init". DO NOT EDIT.
+import json
+import sys
+import traceback
+
+
+def serve(handler):
+    """Reads requests from stdin and writes responses to stdout until stdin is closed.
+
+    handler(request) receives a dict with "method", "path", "query", "headers" and "body"
+    and returns a body string or a dict with "status", "headers" and "body".
+    Handlers must not print anything else to stdout, use stderr for logs.
+    """
+    for line in sys.stdin:
+        line = line.strip()
+        if not line:
+            continue
+
+        request = json.loads(line)
+        try:
+            result = handler(request)
+        except Exception:
+            traceback.print_exc(file=sys.stderr)
+            result = {"status": 500, "body": "internal handler error"}
+
+        if not isinstance(result, dict):
+            result = {"body": "" if result is None else str(result)}
+
+        response = {
+            "id": request["id"],
+            "version": {{version}},
+            "status": result.get("status", 200),
+            "headers": result.get("headers", {}),
+            "body": result.get("body", ""),
+        }
+        sys.stdout.write(json.dumps(response) + "\n")
+        sys.stdout.flush()
+
+
+def serve_batch(handler):
+    """Reads batches of requests of handlers with run.batch and writes their responses in the requests order.
+
+    handler(requests) receives a list of requests and returns a list of results, one per request.
+    Load the model once before serve_batch and run it on the whole batch.
+    """
+    for line in sys.stdin:
+        line = line.strip()
+        if not line:
+            continue
+
+        batch = json.loads(line)
+        requests = batch["requests"]
+        try:
+            results = list(handler(requests))
+        except Exception:
+            traceback.print_exc(file=sys.stderr)
+            results = [{"status": 500, "body": "internal handler error"}] * len(requests)
+
+        responses = []
+        for request, result in zip(requests, results):
+            if not isinstance(result, dict):
+                result = {"body": "" if result is None else str(result)}
+            responses.append({
+                "id": request["id"],
+                "version": {{version}},
+                "status": result.get("status", 200),
+                "headers": result.get("headers", {}),
+                "body": result.get("body", ""),
+            })
+        sys.stdout.write(json.dumps({"id": batch["id"], "version": {{version}}, "responses": responses}) + "\n")
+        sys.stdout.flush()
+`
+
+const nodeShim = `// Code generated by "xserver init". DO NOT EDIT.
+'use strict';
+
+const readline = require('readline');
+
+// serve reads requests from stdin and writes responses to stdout until stdin is closed.
+// handler(request) returns (or resolves to) a body string or an object with status, headers and body.
+// Handlers must not write anything else to stdout, use stderr for logs.
+function serve(handler) {
+  const input = readline.createInterface({ input: process.stdin });
+
+  input.on('line', async (line) => {
+    if (!line.trim()) {
+      return;
+    }
+
+    const request = JSON.parse(line);
+    let result;
+    try {
+      result = await handler(request);
+    } catch (error) {
+      console.error(error);
+      result = { status: 500, body: 'internal handler error' };
+    }
+
+    if (result === null || typeof result !== 'object') {
+      result = { body: result === undefined || result === null ? '' : String(result) };
+    }
+
+    const response = {
+      id: request.id,
+      version: {{version}},
+      status: result.status || 200,
+      headers: result.headers || {},
+      body: result.body || '',
+    };
+    process.stdout.write(JSON.stringify(response) + '\n');
+  });
+}
+
+// serveBatch reads batches of requests of handlers with run.batch and writes their responses in the requests order.
+// handler(requests) returns (or resolves to) a list of results, one per request.
+function serveBatch(handler) {
+  const input = readline.createInterface({ input: process.stdin });
+  let previous = Promise.resolve();
+
+  input.on('line', (line) => {
+    if (!line.trim()) {
+      return;
+    }
+
+    const batch = JSON.parse(line);
+    previous = previous.then(async () => {
+      let results;
+      try {
+        results = await handler(batch.requests);
+      } catch (error) {
+        console.error(error);
+        results = batch.requests.map(() => ({ status: 500, body: 'internal handler error' }));
+      }
+
+      const responses = batch.requests.map((request, i) => {
+        let result = results[i];
+        if (result === null || typeof result !== 'object') {
+          result = { body: result === undefined || result === null ? '' : String(result) };
+        }
+        return {
+          id: request.id,
+          version: {{version}},
+          status: result.status || 200,
+          headers: result.headers || {},
+          body: result.body || '',
+        };
+      });
+      process.stdout.write(JSON.stringify({ id: batch.id, version: {{version}}, responses }) + '\n');
+    });
+  });
+}
+
+module.exports = { serve, serveBatch };
+`
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"xserver/src/config"
+	"xserver/src/logger"
+	"xserver/src/problem"
+)
+
+const (
+	RoleViewer   = config.RoleViewer
+	RoleOperator = config.RoleOperator
+	RoleAdmin    = config.RoleAdmin
+)
+
+var (
+	roleLevels = map[string]int{
+		RoleViewer:   1,
+		RoleOperator: 2,
+		RoleAdmin:    3,
+	}
+)
+
+type member struct {
+	name   string
+	secret string
+	role   string
+}
+
+// Access authorizes admin requests by admin.token with the admin role or by api keys with roles.
+type Access struct {
+	members []member
+}
+
+func NewAccess(config *config.Config) *Access {
+	access := &Access{}
+	if config.Admin.Token != "" {
+		access.members = append(access.members, member{name: "admin.token", secret: config.Admin.Token, role: RoleAdmin})
+	}
+	for name, key := range config.ApiKeys.Keys {
+		if secret := key.Secret(); key.Role != "" && secret != "" {
+			access.members = append(access.members, member{name: name, secret: secret, role: key.Role})
+		}
+	}
+	return access
+}
+
+// member returns the member of the Authorization bearer token, all members are compared in constant time.
+func (access *Access) member(request *http.Request) *member {
+	token := strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")
+	var found *member
+	for index := range access.members {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(access.members[index].secret)) == 1 {
+			found = &access.members[index]
+		}
+	}
+	return found
+}
+
+// Authorized permits the request to members with the role or a higher one, all requests are permitted without admin.token and api keys roles.
+// Requests of operator and admin endpoints are logged with the member name.
+func (access *Access) Authorized(role string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if len(access.members) == 0 {
+			handler(writer, request)
+			return
+		}
+
+		member := access.member(request)
+		if member == nil {
+			problem.Write(writer, request, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "[XServer] [Admin] [Error] unauthorized").WithResult(false))
+			return
+		}
+		if roleLevels[member.role] < roleLevels[role] {
+			problem.Write(writer, request, problem.New(http.StatusForbidden, problem.CodeForbidden, fmt.Sprintf(`[XServer] [Admin] [Error] "%s" with %s role can't call %s endpoint`, member.name, member.role, role)).WithResult(false))
+			return
+		}
+		if role != RoleViewer {
+			logger.Info(fmt.Sprintf(`[XServer] [Admin] %s called by "%s"`, request.URL.Path, member.name))
+		}
+		handler(writer, request)
+	}
+}
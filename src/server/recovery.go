@@ -0,0 +1,35 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+	"xserver/src/problem"
+)
+
+func init() {
+	metrics.Register("xserver_handler_panics_total", metrics.CounterType, "Number of recovered panics of HTTP handlers.")
+}
+
+// Recovered responds 500 on panics of the handler instead of dropping the connection,
+// http.ErrAbortHandler panics are passed through to abort the response on purpose.
+func Recovered(path string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			metrics.Inc("xserver_handler_panics_total", "path", path)
+			logger.Error(fmt.Sprintf("[XServer] [Server] [Error] panic in \"%s\" handler: %v\n%s", path, recovered, debug.Stack()))
+			problem.Write(writer, request, problem.New(http.StatusInternalServerError, problem.CodeInternal, "[XServer] [Server] [Error] internal server error"))
+		}()
+		handler(writer, request)
+	}
+}
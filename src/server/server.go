@@ -1,14 +1,139 @@
 package server
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 	"xserver/src/config"
+	"xserver/src/logger"
 )
 
+const (
+	listenFdEnv     = "XSERVER_LISTEN_FD"
+	challengesFdEnv = "XSERVER_CHALLENGES_FD"
+	parentPidEnv    = "XSERVER_PARENT_PID"
+	inheritedFd     = 3
+)
+
+var (
+	shutdownRequests = make(chan struct{}, 1)
+)
+
+// AddHandler registers the recovered handler, conflicting registrations are logged instead of panicking.
 func AddHandler(path string, handler http.HandlerFunc) {
-	http.HandleFunc(path, handler)
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logger.Error(fmt.Sprintf("[XServer] [Server] [Error] failed register \"%s\" handler: %v", path, recovered))
+		}
+	}()
+	http.HandleFunc(path, Recovered(path, handler))
+}
+
+// listen returns the listener inherited from the previous process by the descriptor of the env or listens the address.
+func listen(env string, address string) (net.Listener, error) {
+	fd := os.Getenv(env)
+	if fd == "" {
+		return net.Listen("tcp", address)
+	}
+
+	descriptor, err := strconv.Atoi(fd)
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Server] [Error] invalid inherited listener descriptor: %s", err)
+	}
+	os.Unsetenv(env)
+
+	logger.Info(fmt.Sprintf("[XServer] [Server] use inherited listener %d of %s", descriptor, address))
+	return net.FileListener(os.NewFile(uintptr(descriptor), "listener"))
+}
+
+// closeInherited closes the listener inherited by the descriptor of the env which is not used by the config.
+func closeInherited(env string) {
+	if descriptor, err := strconv.Atoi(os.Getenv(env)); err == nil {
+		os.NewFile(uintptr(descriptor), "listener").Close()
+	}
+	os.Unsetenv(env)
+}
+
+func Shutdown() {
+	select {
+	case shutdownRequests <- struct{}{}:
+	default:
+	}
 }
 
-func Start(config *config.Config) error {
-	return http.ListenAndServe(config.Url, nil)
+func Start(config *config.Config, handler http.Handler) error {
+	shutdownTimeout, err := time.ParseDuration(config.ShutdownTimeout)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Server] [Error] failed parse shutdown timeout: %s", err)
+	}
+
+	server := &http.Server{Handler: handler}
+	var challenges *http.Server
+	if config.TlsEnabled() {
+		var challengesHandler http.Handler
+		if server.TLSConfig, challengesHandler, err = tlsConfig(config.Tls); err != nil {
+			return fmt.Errorf("[XServer] [Server] [Error] %s", err)
+		}
+		if challengesHandler != nil && config.Tls.Acme.Http != "" {
+			challenges = &http.Server{Addr: config.Tls.Acme.Http, Handler: challengesHandler}
+		}
+	}
+
+	listener, err := listen(listenFdEnv, config.Url)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Server] [Error] failed listen: %s", err)
+	}
+
+	var challengesListener net.Listener
+	if challenges != nil {
+		if challengesListener, err = listen(challengesFdEnv, challenges.Addr); err != nil {
+			listener.Close()
+			return fmt.Errorf("[XServer] [Server] [Error] failed listen acme challenges: %s", err)
+		}
+	} else {
+		closeInherited(challengesFdEnv)
+	}
+
+	shutdownDone := make(chan struct{})
+
+	go func() {
+		defer close(shutdownDone)
+		waitShutdown(listener, challengesListener)
+
+		logger.Info("[XServer] [Server] graceful shutdown")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Error(fmt.Sprintf("[XServer] [Server] [Error] failed graceful shutdown: %s", err))
+		}
+		if challenges != nil {
+			challenges.Shutdown(ctx)
+		}
+	}()
+
+	if challenges != nil {
+		go func() {
+			logger.Info(fmt.Sprintf("[XServer] [Server] serve acme challenges and redirects to https on %s", challenges.Addr))
+			if err := challenges.Serve(challengesListener); err != http.ErrServerClosed {
+				logger.Error(fmt.Sprintf("[XServer] [Server] [Error] failed serve acme challenges: %s", err))
+			}
+		}()
+	}
+
+	notifyParent()
+
+	serve := server.Serve
+	if server.TLSConfig != nil {
+		serve = func(listener net.Listener) error { return server.ServeTLS(listener, "", "") }
+	}
+	if err := serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+	<-shutdownDone
+
+	return nil
 }
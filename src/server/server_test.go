@@ -0,0 +1,61 @@
+//go:build !windows
+
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestListenInherited(t *testing.T) {
+	inherited, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inherited.Close()
+	file, err := inherited.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	t.Setenv(challengesFdEnv, strconv.Itoa(int(file.Fd())))
+	listener, err := listen(challengesFdEnv, "127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if os.Getenv(challengesFdEnv) != "" {
+		t.Fatal("env of the inherited descriptor must be unset")
+	}
+	if listener.Addr().String() != inherited.Addr().String() {
+		t.Fatalf("listener address %s, expected inherited %s", listener.Addr(), inherited.Addr())
+	}
+
+	connection, err := net.Dial("tcp", inherited.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer connection.Close()
+	accepted, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted.Close()
+}
+
+func TestListenAddress(t *testing.T) {
+	t.Setenv(listenFdEnv, "")
+	listener, err := listen(listenFdEnv, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+
+	t.Setenv(listenFdEnv, "invalid")
+	if _, err := listen(listenFdEnv, "127.0.0.1:0"); err == nil {
+		t.Fatal("expected error of invalid descriptor")
+	}
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+)
+
+type Swappable struct {
+	mutex   sync.RWMutex
+	handler http.HandlerFunc
+}
+
+func NewSwappable(handler http.HandlerFunc) *Swappable {
+	return &Swappable{handler: handler}
+}
+
+func (swappable *Swappable) Swap(handler http.HandlerFunc) {
+	swappable.mutex.Lock()
+	defer swappable.mutex.Unlock()
+	swappable.handler = handler
+}
+
+func (swappable *Swappable) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	swappable.mutex.RLock()
+	handler := swappable.handler
+	swappable.mutex.RUnlock()
+	handler(writer, request)
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+	"xserver/src/config"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// certificates chooses the certificate by the SNI server name: the host certificate, the acme certificate of its domain,
+// the wildcard certificate of its parent domain or the default one.
+type certificates struct {
+	fallback *tls.Certificate
+	hosts    map[string]*tls.Certificate
+	acme     *autocert.Manager
+	domains  map[string]bool
+}
+
+func loadCertificates(settings config.Tls) (*certificates, error) {
+	result := &certificates{hosts: map[string]*tls.Certificate{}, domains: map[string]bool{}}
+	if settings.Cert != "" {
+		certificate, err := tls.LoadX509KeyPair(settings.Cert, settings.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed load tls certificate: %s", err)
+		}
+		result.fallback = &certificate
+	}
+	for host, hostCertificate := range settings.Hosts {
+		certificate, err := tls.LoadX509KeyPair(hostCertificate.Cert, hostCertificate.Key)
+		if err != nil {
+			return nil, fmt.Errorf(`failed load tls certificate of "%s" host: %s`, host, err)
+		}
+		result.hosts[strings.ToLower(host)] = &certificate
+	}
+
+	if len(settings.Acme.Domains) != 0 {
+		for _, domain := range settings.Acme.Domains {
+			result.domains[strings.ToLower(domain)] = true
+		}
+		result.acme = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(settings.Acme.Domains...),
+			Cache:      autocert.DirCache(settings.Acme.Cache),
+			Email:      settings.Acme.Email,
+			Client:     &acme.Client{DirectoryURL: settings.Acme.Directory},
+		}
+	}
+	return result, nil
+}
+
+func (certificates *certificates) get(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if certificate, ok := certificates.hosts[name]; ok {
+		return certificate, nil
+	}
+	if certificates.acme != nil && certificates.domains[name] {
+		return certificates.acme.GetCertificate(hello)
+	}
+	if _, domain, ok := strings.Cut(name, "."); ok {
+		if certificate, ok := certificates.hosts["*."+domain]; ok {
+			return certificate, nil
+		}
+	}
+	if certificates.fallback != nil {
+		return certificates.fallback, nil
+	}
+	return nil, fmt.Errorf(`no certificate of "%s" host`, hello.ServerName)
+}
+
+// tlsConfig returns the server tls config with certificates of tls settings and the handler of acme HTTP-01 challenges,
+// acme certificates are renewed before expiration and served without restart.
+func tlsConfig(settings config.Tls) (*tls.Config, http.Handler, error) {
+	loaded, err := loadCertificates(settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	result := &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: loaded.get}
+	if loaded.acme == nil {
+		return result, nil, nil
+	}
+	result.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+	return result, loaded.acme.HTTPHandler(nil), nil
+}
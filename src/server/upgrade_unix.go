@@ -0,0 +1,101 @@
+//go:build !windows
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"xserver/src/logger"
+)
+
+// upgrade starts the new process of the executable passing the listener and the acme challenges listener if any.
+func upgrade(listener net.Listener, challengesListener net.Listener) error {
+	files := []*os.File{}
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for _, current := range []net.Listener{listener, challengesListener} {
+		if current == nil {
+			continue
+		}
+		tcpListener, ok := current.(*net.TCPListener)
+		if !ok {
+			return fmt.Errorf("listener does not support descriptor handover")
+		}
+		file, err := tcpListener.File()
+		if err != nil {
+			return fmt.Errorf("failed get listener descriptor: %s", err)
+		}
+		files = append(files, file)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed get executable path: %s", err)
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(
+		os.Environ(),
+		listenFdEnv+"="+strconv.Itoa(inheritedFd),
+		parentPidEnv+"="+strconv.Itoa(os.Getpid()),
+	)
+	if challengesListener != nil {
+		cmd.Env = append(cmd.Env, challengesFdEnv+"="+strconv.Itoa(inheritedFd+1))
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed start new process: %s", err)
+	}
+
+	logger.Info(fmt.Sprintf("[XServer] [Server] started new process %d, wait for handover", cmd.Process.Pid))
+	go cmd.Wait()
+
+	return nil
+}
+
+func waitShutdown(listener net.Listener, challengesListener net.Listener) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-shutdownRequests:
+			return
+		case received := <-signals:
+			if received != syscall.SIGUSR2 {
+				return
+			}
+		}
+
+		logger.Info("[XServer] [Server] upgrade requested")
+		if err := upgrade(listener, challengesListener); err != nil {
+			logger.Error(fmt.Sprintf("[XServer] [Server] [Error] failed upgrade: %s", err))
+		}
+	}
+}
+
+func notifyParent() {
+	parentPid, err := strconv.Atoi(os.Getenv(parentPidEnv))
+	os.Unsetenv(parentPidEnv)
+	if err != nil || parentPid <= 0 {
+		return
+	}
+
+	logger.Info(fmt.Sprintf("[XServer] [Server] ready, stop previous process %d", parentPid))
+	if err := syscall.Kill(parentPid, syscall.SIGTERM); err != nil {
+		logger.Error(fmt.Sprintf("[XServer] [Server] [Error] failed stop previous process: %s", err))
+	}
+}
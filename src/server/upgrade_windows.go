@@ -0,0 +1,22 @@
+//go:build windows
+
+package server
+
+import (
+	"net"
+	"os"
+	"os/signal"
+)
+
+func waitShutdown(listener net.Listener, challengesListener net.Listener) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+	select {
+	case <-signals:
+	case <-shutdownRequests:
+	}
+}
+
+func notifyParent() {
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package service
+
+import (
+	"fmt"
+)
+
+func Install(name string, directory string) error {
+	return fmt.Errorf("[XServer] [Service] [Error] services are supported only on windows, use systemd or another init system")
+}
+
+func Uninstall(name string) error {
+	return fmt.Errorf("[XServer] [Service] [Error] services are supported only on windows, use systemd or another init system")
+}
+
+func Run(name string, start func() error, stop func()) error {
+	return start()
+}
@@ -0,0 +1,127 @@
+//go:build windows
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+type handler struct {
+	start func() error
+	stop  func()
+}
+
+func (handler *handler) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	done := make(chan error, 1)
+	go func() { done <- handler.start() }()
+
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				return true, 1
+			}
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				changes <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				handler.stop()
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
+
+func Install(name string, directory string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("[XServer] [Service] [Error] failed get executable path: %s", err)
+	}
+
+	directory, err = filepath.Abs(directory)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Service] [Error] failed get working directory: %s", err)
+	}
+
+	manager, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("[XServer] [Service] [Error] failed connect to service manager: %s", err)
+	}
+	defer manager.Disconnect()
+
+	if service, err := manager.OpenService(name); err == nil {
+		service.Close()
+		return fmt.Errorf(`[XServer] [Service] [Error] service "%s" already exists`, name)
+	}
+
+	service, err := manager.CreateService(
+		name,
+		executable,
+		mgr.Config{DisplayName: "XServer (" + name + ")", StartType: mgr.StartAutomatic},
+		"service", "run", name, directory,
+	)
+	if err != nil {
+		return fmt.Errorf("[XServer] [Service] [Error] failed create service: %s", err)
+	}
+	defer service.Close()
+
+	return nil
+}
+
+func Uninstall(name string) error {
+	manager, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("[XServer] [Service] [Error] failed connect to service manager: %s", err)
+	}
+	defer manager.Disconnect()
+
+	service, err := manager.OpenService(name)
+	if err != nil {
+		return fmt.Errorf(`[XServer] [Service] [Error] service "%s" is not installed: %s`, name, err)
+	}
+	defer service.Close()
+
+	if status, err := service.Control(svc.Stop); err == nil {
+		for deadline := time.Now().Add(30 * time.Second); status.State != svc.Stopped && time.Now().Before(deadline); {
+			time.Sleep(500 * time.Millisecond)
+			if status, err = service.Query(); err != nil {
+				break
+			}
+		}
+	}
+
+	if err := service.Delete(); err != nil {
+		return fmt.Errorf("[XServer] [Service] [Error] failed delete service: %s", err)
+	}
+
+	return nil
+}
+
+func Run(name string, start func() error, stop func()) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return fmt.Errorf("[XServer] [Service] [Error] failed detect service environment: %s", err)
+	}
+	if !isService {
+		return start()
+	}
+
+	if err := svc.Run(name, &handler{start: start, stop: stop}); err != nil {
+		return fmt.Errorf("[XServer] [Service] [Error] failed run service: %s", err)
+	}
+	return nil
+}
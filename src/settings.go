@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"xserver/src/config"
+	"xserver/src/faults"
+	"xserver/src/flags"
+	"xserver/src/logger"
+	"xserver/src/modes"
+	"xserver/src/tasks"
+)
+
+type settingRequest struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Save  bool   `json:"save"`
+}
+
+// runtimeSettings are config keys changed on the running server without restart.
+type runtimeSettings struct {
+	config         *config.Config
+	handlersFlags  *flags.Flags
+	handlersFaults *faults.Faults
+	serverModes    *modes.Modes
+	scheduledTasks *tasks.Tasks
+}
+
+// unitKey splits keys like "tasks.cleanup.period" to the unit name and the unit setting.
+func unitKey(key string, units string) (string, string, bool) {
+	if !strings.HasPrefix(key, units+".") {
+		return "", "", false
+	}
+	rest := strings.TrimPrefix(key, units+".")
+	separator := strings.Index(rest, ".")
+	if separator <= 0 {
+		return "", "", false
+	}
+	return rest[:separator], rest[separator+1:], true
+}
+
+// values returns current values of runtime settings by their keys.
+func (settings *runtimeSettings) values() map[string]interface{} {
+	status := settings.serverModes.Get()
+	values := map[string]interface{}{
+		"log_level":         logger.Level(),
+		"modes.read_only":   status.ReadOnly,
+		"modes.maintenance": status.Maintenance,
+	}
+	for handlerName := range settings.config.Handlers {
+		values["handlers."+handlerName+".enabled"] = settings.handlersFlags.Get(handlerName).Enabled
+	}
+	for _, fault := range settings.handlersFaults.List() {
+		values["handlers."+fault.Handler+".faults.enable"] = fault.Enable
+	}
+	for _, task := range settings.scheduledTasks.List() {
+		values["tasks."+task.Name+".period"] = task.Period
+	}
+	return values
+}
+
+// get returns the value of the dotted key of the running config, all config for the empty key, sensitive values are redacted.
+func (settings *runtimeSettings) get(key string) (interface{}, error) {
+	document, err := settings.config.Document()
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Config] [Error] failed encode config: %s", err)
+	}
+	for valueKey, value := range settings.values() {
+		if document, err = config.Assign(document, valueKey, value); err != nil {
+			return nil, fmt.Errorf("[XServer] [Config] [Error] failed set %s: %s", valueKey, err)
+		}
+	}
+
+	value, ok := config.Lookup(document, key)
+	if !ok {
+		return nil, fmt.Errorf(`[XServer] [Config] [Error] unknown key "%s"`, key)
+	}
+	return config.Plain(value), nil
+}
+
+// set changes the runtime setting, the typed value is returned for saving to the config file.
+func (settings *runtimeSettings) set(key string, value string) (interface{}, error) {
+	parseBool := func() (bool, error) {
+		enable, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf(`[XServer] [Config] [Error] value of "%s" must be true or false`, key)
+		}
+		return enable, nil
+	}
+
+	switch key {
+	case "log_level":
+		return value, logger.SetLevel(value)
+	case "modes.read_only", "modes.maintenance":
+		enable, err := parseBool()
+		if err != nil {
+			return nil, err
+		}
+		return enable, settings.serverModes.Set(strings.TrimPrefix(key, "modes."), enable)
+	}
+
+	if handlerName, setting, ok := unitKey(key, "handlers"); ok {
+		switch setting {
+		case "enabled":
+			enable, err := parseBool()
+			if err != nil {
+				return nil, err
+			}
+			return enable, settings.handlersFlags.SetEnabled(handlerName, enable)
+		case "faults.enable":
+			enable, err := parseBool()
+			if err != nil {
+				return nil, err
+			}
+			return enable, settings.handlersFaults.SetEnabled(handlerName, enable)
+		}
+	}
+
+	if taskName, setting, ok := unitKey(key, "tasks"); ok && setting == "period" {
+		return value, settings.scheduledTasks.SetPeriod(taskName, value)
+	}
+
+	return nil, fmt.Errorf(`[XServer] [Config] [Error] "%s" can't be changed at runtime, change the config file and restart the server`, key)
+}
+
+// save writes the setting value to the config file.
+func (settings *runtimeSettings) save(key string, value interface{}) error {
+	return config.Save(configPath, key, value)
+}
+
+// runtimeOnly returns whether the key is kept in the runtime state instead of the config file.
+func runtimeOnly(key string) bool {
+	_, setting, ok := unitKey(key, "handlers")
+	return ok && setting == "enabled"
+}
@@ -0,0 +1,293 @@
+package slo
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/metrics"
+)
+
+const (
+	KindErrors  = "errors"
+	KindLatency = "latency"
+
+	defaultWindow           = time.Hour
+	defaultAlertWindow      = 5 * time.Minute
+	defaultBurnRate         = 14.4
+	defaultMinRequests      = 20
+	defaultLatencyObjective = 0.99
+
+	// buckets is the number of rolling window buckets, requests older than the window are dropped by buckets of window/buckets.
+	buckets = 60
+)
+
+func init() {
+	metrics.Register("xserver_slo_compliance_ratio", metrics.GaugeType, "Fraction of good handler requests within the SLO window.")
+	metrics.Register("xserver_slo_error_budget_remaining_ratio", metrics.GaugeType, "Fraction of the SLO error budget remaining within the SLO window.")
+	metrics.Register("xserver_slo_burn_rate", metrics.GaugeType, "Rate of the SLO error budget consumption within the alert window, 1 consumes the budget exactly in the SLO window.")
+	metrics.Register("xserver_slo_alerts_total", metrics.CounterType, "Number of SLO burn rate alerts.")
+}
+
+type Status struct {
+	Handler         string  `json:"handler"`
+	Slo             string  `json:"slo"`
+	Objective       float64 `json:"objective"`
+	Latency         string  `json:"latency,omitempty"`
+	Window          string  `json:"window"`
+	Requests        int     `json:"requests"`
+	Bad             int     `json:"bad"`
+	Compliance      float64 `json:"compliance"`
+	BudgetRemaining float64 `json:"budget_remaining"`
+	BurnRate        float64 `json:"burn_rate"`
+	AlertWindow     string  `json:"alert_window"`
+	Met             bool    `json:"met"`
+}
+
+type bucket struct {
+	index    int64
+	requests int
+	errors   int
+	slow     int
+}
+
+type tracker struct {
+	handler          string
+	objective        float64
+	latency          time.Duration
+	latencyObjective float64
+	window           time.Duration
+	alertWindow      time.Duration
+	bucketSize       time.Duration
+	burnRate         float64
+	minRequests      int
+	buckets          []bucket
+	lastAlerted      map[string]time.Time
+}
+
+type Slos struct {
+	mutex    sync.Mutex
+	trackers map[string]*tracker
+	onBurn   func(status Status)
+}
+
+func parseDuration(value string, defaultValue time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return time.ParseDuration(value)
+}
+
+func newTracker(handlerName string, settings config.Slo) (*tracker, error) {
+	current := &tracker{
+		handler:          handlerName,
+		objective:        settings.Objective,
+		latencyObjective: settings.LatencyObjective,
+		burnRate:         settings.BurnRate,
+		minRequests:      settings.MinRequests,
+		buckets:          make([]bucket, buckets),
+		lastAlerted:      map[string]time.Time{},
+	}
+
+	var err error
+	if current.window, err = parseDuration(settings.Window, defaultWindow); err != nil {
+		return nil, fmt.Errorf(`[XServer] [Slo] [Error] failed parse window of "%s" handler slo: %s`, handlerName, err)
+	}
+	if current.alertWindow, err = parseDuration(settings.AlertWindow, defaultAlertWindow); err != nil {
+		return nil, fmt.Errorf(`[XServer] [Slo] [Error] failed parse alert window of "%s" handler slo: %s`, handlerName, err)
+	}
+	if current.window < time.Minute || current.alertWindow <= 0 || current.alertWindow > current.window {
+		return nil, fmt.Errorf(`[XServer] [Slo] [Error] window of "%s" handler slo must be at least 1m and alert window must be within the window`, handlerName)
+	}
+	if current.latency, err = parseDuration(settings.Latency, 0); err != nil {
+		return nil, fmt.Errorf(`[XServer] [Slo] [Error] failed parse latency of "%s" handler slo: %s`, handlerName, err)
+	}
+	current.bucketSize = current.window / buckets
+
+	if current.latency > 0 && current.latencyObjective == 0 {
+		current.latencyObjective = defaultLatencyObjective
+	}
+	if current.burnRate == 0 {
+		current.burnRate = defaultBurnRate
+	}
+	if current.minRequests == 0 {
+		current.minRequests = defaultMinRequests
+	}
+
+	if current.objective == 0 && current.latency == 0 {
+		return nil, fmt.Errorf(`[XServer] [Slo] [Error] slo of "%s" handler requires objective or latency`, handlerName)
+	}
+	for name, objective := range map[string]float64{"objective": current.objective, "latency_objective": current.latencyObjective} {
+		if objective < 0 || objective >= 1 {
+			return nil, fmt.Errorf(`[XServer] [Slo] [Error] %s of "%s" handler slo must be between 0 and 1`, name, handlerName)
+		}
+	}
+	return current, nil
+}
+
+// Create creates SLO trackers of handlers with slo settings, onBurn is called once per alert window while the SLO error budget burns faster than the burn rate.
+func Create(handlers map[string]config.ExecutableServerUnit, onBurn func(status Status)) (*Slos, error) {
+	slos := &Slos{
+		trackers: map[string]*tracker{},
+		onBurn:   onBurn,
+	}
+	for handlerName, handler := range handlers {
+		if handler.Slo == nil {
+			continue
+		}
+		current, err := newTracker(handlerName, *handler.Slo)
+		if err != nil {
+			return nil, err
+		}
+		slos.trackers[handlerName] = current
+	}
+	return slos, nil
+}
+
+// Tracked returns whether the handler has SLOs, responses of tracked handlers are recorded.
+func (slos *Slos) Tracked(handlerName string) bool {
+	if slos == nil {
+		return false
+	}
+	_, ok := slos.trackers[handlerName]
+	return ok
+}
+
+// sum counts requests of buckets within the duration.
+func (current *tracker) sum(now time.Time, duration time.Duration) bucket {
+	index := now.UnixNano() / int64(current.bucketSize)
+	count := int64((duration + current.bucketSize - 1) / current.bucketSize)
+
+	result := bucket{}
+	for _, each := range current.buckets {
+		if each.index > index-count && each.index <= index {
+			result.requests += each.requests
+			result.errors += each.errors
+			result.slow += each.slow
+		}
+	}
+	return result
+}
+
+func (current *tracker) status(now time.Time, kind string) Status {
+	status := Status{
+		Handler:     current.handler,
+		Slo:         kind,
+		Objective:   current.objective,
+		Window:      current.window.String(),
+		AlertWindow: current.alertWindow.String(),
+		Compliance:  1,
+	}
+	bad := func(counts bucket) int { return counts.errors }
+	if kind == KindLatency {
+		status.Objective = current.latencyObjective
+		status.Latency = current.latency.String()
+		bad = func(counts bucket) int { return counts.slow }
+	}
+	budget := 1 - status.Objective
+
+	window := current.sum(now, current.window)
+	status.Requests = window.requests
+	status.Bad = bad(window)
+	if window.requests > 0 {
+		status.Compliance = 1 - float64(status.Bad)/float64(window.requests)
+	}
+	status.BudgetRemaining = 1 - (1-status.Compliance)/budget
+	status.Met = status.Compliance >= status.Objective
+
+	alertWindow := current.sum(now, current.alertWindow)
+	if alertWindow.requests > 0 {
+		status.BurnRate = float64(bad(alertWindow)) / float64(alertWindow.requests) / budget
+	}
+	return status
+}
+
+func (current *tracker) kinds() []string {
+	kinds := []string{}
+	if current.objective > 0 {
+		kinds = append(kinds, KindErrors)
+	}
+	if current.latency > 0 {
+		kinds = append(kinds, KindLatency)
+	}
+	return kinds
+}
+
+func setMetrics(status Status) {
+	metrics.Set("xserver_slo_compliance_ratio", status.Compliance, "handler", status.Handler, "slo", status.Slo)
+	metrics.Set("xserver_slo_error_budget_remaining_ratio", status.BudgetRemaining, "handler", status.Handler, "slo", status.Slo)
+	metrics.Set("xserver_slo_burn_rate", status.BurnRate, "handler", status.Handler, "slo", status.Slo)
+}
+
+// Record adds the handler response, failed responses and responses slower than the SLO latency are bad ones.
+func (slos *Slos) Record(handlerName string, duration time.Duration, failed bool) {
+	if slos == nil {
+		return
+	}
+	current, ok := slos.trackers[handlerName]
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	index := now.UnixNano() / int64(current.bucketSize)
+
+	slos.mutex.Lock()
+	slot := &current.buckets[index%buckets]
+	if slot.index != index {
+		*slot = bucket{index: index}
+	}
+	slot.requests++
+	if failed {
+		slot.errors++
+	}
+	if current.latency > 0 && duration > current.latency {
+		slot.slow++
+	}
+
+	burning := []Status{}
+	for _, kind := range current.kinds() {
+		status := current.status(now, kind)
+		setMetrics(status)
+		if status.BurnRate >= current.burnRate && current.sum(now, current.alertWindow).requests >= current.minRequests && now.Sub(current.lastAlerted[kind]) >= current.alertWindow {
+			current.lastAlerted[kind] = now
+			burning = append(burning, status)
+		}
+	}
+	slos.mutex.Unlock()
+
+	for _, status := range burning {
+		metrics.Inc("xserver_slo_alerts_total", "handler", status.Handler, "slo", status.Slo)
+		if slos.onBurn != nil {
+			slos.onBurn(status)
+		}
+	}
+}
+
+// List returns the current compliance of all SLOs.
+func (slos *Slos) List() []Status {
+	result := []Status{}
+	if slos == nil {
+		return result
+	}
+
+	now := time.Now()
+	slos.mutex.Lock()
+	for _, current := range slos.trackers {
+		for _, kind := range current.kinds() {
+			status := current.status(now, kind)
+			setMetrics(status)
+			result = append(result, status)
+		}
+	}
+	slos.mutex.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Handler != result[j].Handler {
+			return result[i].Handler < result[j].Handler
+		}
+		return result[i].Slo < result[j].Slo
+	})
+	return result
+}
@@ -0,0 +1,272 @@
+package snapshots
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"xserver/src/config"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+	"xserver/src/s3"
+)
+
+const (
+	namePrefix    = "xserver-"
+	nameExtension = ".tar.gz"
+	nameTime      = "20060102T150405Z"
+)
+
+func init() {
+	metrics.Register("xserver_snapshots_total", metrics.CounterType, "Number of taken snapshots by result.")
+	metrics.Register("xserver_snapshot_size_bytes", metrics.GaugeType, "Size of the last taken snapshot.")
+	metrics.Register("xserver_snapshot_timestamp_seconds", metrics.GaugeType, "Unix time of the last taken snapshot.")
+}
+
+// Entry is the file of the snapshot archive, the zero mode is 0644.
+type Entry struct {
+	Name string
+	Mode os.FileMode
+	Data []byte
+}
+
+type Snapshot struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type store interface {
+	put(name string, data []byte) error
+	get(name string) ([]byte, error)
+	list() ([]Snapshot, error)
+	delete(name string) error
+}
+
+type Snapshots struct {
+	keep  int
+	store store
+}
+
+// Create opens the snapshots storage, it is nil if neither the directory nor s3 is configured.
+func Create(settings config.Snapshots) (*Snapshots, error) {
+	if settings.Directory != "" {
+		return &Snapshots{keep: settings.Keep, store: &directoryStore{directory: settings.Directory}}, nil
+	}
+	if settings.S3 != nil {
+		client, err := s3.Create(*settings.S3)
+		if err != nil {
+			return nil, fmt.Errorf("[XServer] [Snapshots] [Error] %s", err)
+		}
+		return &Snapshots{keep: settings.Keep, store: &s3Store{client: client, prefix: settings.S3.Prefix}}, nil
+	}
+	return nil, nil
+}
+
+// Take archives the entries to the new snapshot and deletes the oldest snapshots over keep.
+func (snapshots *Snapshots) Take(entries []Entry) (Snapshot, error) {
+	snapshot, err := snapshots.take(entries)
+	if err != nil {
+		metrics.Inc("xserver_snapshots_total", "result", "error")
+		return snapshot, fmt.Errorf("[XServer] [Snapshots] [Error] failed take snapshot: %s", err)
+	}
+	metrics.Inc("xserver_snapshots_total", "result", "ok")
+	metrics.Set("xserver_snapshot_size_bytes", float64(snapshot.Size))
+	metrics.Set("xserver_snapshot_timestamp_seconds", float64(snapshot.CreatedAt.Unix()))
+	logger.Info(fmt.Sprintf("[XServer] [Snapshots] snapshot %s taken, %d bytes", snapshot.Name, snapshot.Size))
+
+	if err := snapshots.prune(); err != nil {
+		logger.Error(fmt.Sprintf("[XServer] [Snapshots] [Error] failed delete old snapshots: %s", err))
+	}
+	return snapshot, nil
+}
+
+func (snapshots *Snapshots) take(entries []Entry) (Snapshot, error) {
+	createdAt := time.Now().UTC()
+	data, err := Archive(entries, createdAt)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snapshot := Snapshot{Name: namePrefix + createdAt.Format(nameTime) + nameExtension, Size: int64(len(data)), CreatedAt: createdAt}
+	return snapshot, snapshots.store.put(snapshot.Name, data)
+}
+
+func (snapshots *Snapshots) prune() error {
+	list, err := snapshots.List()
+	if err != nil {
+		return err
+	}
+	for index := snapshots.keep; index < len(list); index++ {
+		if err := snapshots.store.delete(list[index].Name); err != nil {
+			return err
+		}
+		logger.Info(fmt.Sprintf("[XServer] [Snapshots] snapshot %s deleted", list[index].Name))
+	}
+	return nil
+}
+
+// List returns snapshots of the storage from the newest one.
+func (snapshots *Snapshots) List() ([]Snapshot, error) {
+	list, err := snapshots.store.list()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name > list[j].Name })
+	return list, nil
+}
+
+// Read returns the archive of the snapshot.
+func (snapshots *Snapshots) Read(name string) ([]byte, error) {
+	if !isSnapshot(name) {
+		return nil, fmt.Errorf(`unknown snapshot "%s", expected %s<time>%s`, name, namePrefix, nameExtension)
+	}
+	return snapshots.store.get(name)
+}
+
+func isSnapshot(name string) bool {
+	if !strings.HasPrefix(name, namePrefix) || !strings.HasSuffix(name, nameExtension) {
+		return false
+	}
+	_, err := time.Parse(nameTime, strings.TrimSuffix(strings.TrimPrefix(name, namePrefix), nameExtension))
+	return err == nil
+}
+
+// Archive writes the entries to the tar.gz archive.
+func Archive(entries []Entry, createdAt time.Time) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	compressor := gzip.NewWriter(buffer)
+	archiver := tar.NewWriter(compressor)
+	for _, entry := range entries {
+		mode := entry.Mode.Perm()
+		if mode == 0 {
+			mode = 0644
+		}
+		header := &tar.Header{Name: entry.Name, Mode: int64(mode), Size: int64(len(entry.Data)), ModTime: createdAt}
+		if err := archiver.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := archiver.Write(entry.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archiver.Close(); err != nil {
+		return nil, err
+	}
+	if err := compressor.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Extract returns entries of the snapshot archive.
+func Extract(data []byte) ([]Entry, error) {
+	decompressor, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed read snapshot archive: %s", err)
+	}
+	archive := tar.NewReader(decompressor)
+	entries := []Entry{}
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed read snapshot archive: %s", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		entryData, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, fmt.Errorf("failed read snapshot archive: %s", err)
+		}
+		entries = append(entries, Entry{Name: header.Name, Mode: os.FileMode(header.Mode).Perm(), Data: entryData})
+	}
+}
+
+type directoryStore struct {
+	directory string
+}
+
+func (store *directoryStore) put(name string, data []byte) error {
+	if err := os.MkdirAll(store.directory, os.ModePerm); err != nil {
+		return err
+	}
+	temporary := filepath.Join(store.directory, "."+name)
+	if err := os.WriteFile(temporary, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temporary, filepath.Join(store.directory, name))
+}
+
+func (store *directoryStore) get(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(store.directory, name))
+}
+
+func (store *directoryStore) list() ([]Snapshot, error) {
+	files, err := os.ReadDir(store.directory)
+	if os.IsNotExist(err) {
+		return []Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := []Snapshot{}
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil || !isSnapshot(file.Name()) {
+			continue
+		}
+		list = append(list, Snapshot{Name: file.Name(), Size: info.Size(), CreatedAt: info.ModTime().UTC()})
+	}
+	return list, nil
+}
+
+func (store *directoryStore) delete(name string) error {
+	return os.Remove(filepath.Join(store.directory, name))
+}
+
+type s3Store struct {
+	client *s3.Client
+	prefix string
+}
+
+func (store *s3Store) put(name string, data []byte) error {
+	return store.client.Put(context.Background(), path.Join(store.prefix, name), data, "application/gzip")
+}
+
+func (store *s3Store) get(name string) ([]byte, error) {
+	return store.client.Get(context.Background(), path.Join(store.prefix, name))
+}
+
+func (store *s3Store) list() ([]Snapshot, error) {
+	prefix := namePrefix
+	if store.prefix != "" {
+		prefix = strings.TrimSuffix(store.prefix, "/") + "/" + namePrefix
+	}
+	objects, err := store.client.List(context.Background(), prefix)
+	if err != nil {
+		return nil, err
+	}
+	list := []Snapshot{}
+	for _, object := range objects {
+		name := path.Base(object.Key)
+		if isSnapshot(name) {
+			list = append(list, Snapshot{Name: name, Size: object.Size, CreatedAt: object.LastModified})
+		}
+	}
+	return list, nil
+}
+
+func (store *s3Store) delete(name string) error {
+	return store.client.Delete(context.Background(), path.Join(store.prefix, name))
+}
@@ -0,0 +1,78 @@
+package sources
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultRef = "HEAD"
+)
+
+var (
+	mutexes      = map[string]*sync.Mutex{}
+	mutexesGuard sync.Mutex
+)
+
+func lock(directory string) func() {
+	mutexesGuard.Lock()
+	mutex, ok := mutexes[directory]
+	if !ok {
+		mutex = &sync.Mutex{}
+		mutexes[directory] = mutex
+	}
+	mutexesGuard.Unlock()
+
+	mutex.Lock()
+	return mutex.Unlock
+}
+
+func GitDirectory(baseDirectory string, url string, ref string) string {
+	if ref == "" {
+		ref = defaultRef
+	}
+	hash := sha256.Sum256([]byte(url + "#" + ref))
+	return filepath.Join(baseDirectory, hex.EncodeToString(hash[:])[:16])
+}
+
+func git(directory string, arguments ...string) error {
+	cmd := exec.Command("git", arguments...)
+	cmd.Dir = directory
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s: %s: %s", strings.Join(arguments, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func GitFetch(directory string, url string, ref string) error {
+	if ref == "" {
+		ref = defaultRef
+	}
+
+	defer lock(directory)()
+
+	if _, err := os.Stat(filepath.Join(directory, ".git")); err != nil {
+		if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+			return err
+		}
+		if err := git(directory, "init", "--quiet"); err != nil {
+			return err
+		}
+		if err := git(directory, "remote", "add", "origin", url); err != nil {
+			return err
+		}
+	} else if err := git(directory, "remote", "set-url", "origin", url); err != nil {
+		return err
+	}
+
+	if err := git(directory, "fetch", "--quiet", "--depth", "1", "origin", ref); err != nil {
+		return err
+	}
+	return git(directory, "checkout", "--quiet", "--force", "FETCH_HEAD")
+}
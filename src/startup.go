@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"xserver/src/config"
+	"xserver/src/doctor"
+	"xserver/src/engines"
+	"xserver/src/logger"
+	"xserver/src/plugins"
+	"xserver/src/problem"
+	"xserver/src/rest"
+	"xserver/src/server"
+)
+
+// checkExecutables checks units are built and their run tools are installed.
+func checkExecutables(unitTag string, unitsFilesPath string, units map[string]config.ExecutableServerUnit) []doctor.Result {
+	unitsNames := []string{}
+	for unitName := range units {
+		unitsNames = append(unitsNames, unitName)
+	}
+	sort.Strings(unitsNames)
+
+	results := []doctor.Result{}
+	for _, unitName := range unitsNames {
+		unit := units[unitName]
+		if unit.Mock != nil || unit.Report != nil {
+			continue
+		}
+
+		result := doctor.Result{Name: fmt.Sprintf(`%s "%s" executable`, strings.ToLower(unitTag), unitName)}
+		_, executable := getUnitPaths(unitsFilesPath, unitName, unit)
+		if unit.Run != nil && unit.Run.Engine == plugins.EnginePlugin {
+			executable = filepath.Join(unitsFilesPath, unitName, plugins.FileName)
+		}
+
+		if _, err := os.Stat(executable); err != nil {
+			result.Error = fmt.Errorf("%s is not found", executable)
+			result.Fix = "run xserver build"
+		} else if unit.Run == nil || (unit.Run.Engine != engines.EngineEmbedded && unit.Run.Engine != plugins.EnginePlugin) {
+			command, _, err := getUnitCommand(unitTag, unitsFilesPath, unitName, unit)
+			if err == nil {
+				_, err = exec.LookPath(command)
+			}
+			if err != nil {
+				result.Error = err
+				result.Fix = "install the run tool or set full path of the tool in toolchains"
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// checkDevices checks device files required by units exist, e.g. exposed to the server container.
+func checkDevices(unitTag string, units map[string]config.ExecutableServerUnit) []doctor.Result {
+	unitsNames := []string{}
+	for unitName := range units {
+		unitsNames = append(unitsNames, unitName)
+	}
+	sort.Strings(unitsNames)
+
+	results := []doctor.Result{}
+	for _, unitName := range unitsNames {
+		unit := units[unitName]
+		if unit.Devices == nil || len(unit.Devices.Paths) == 0 {
+			continue
+		}
+
+		result := doctor.Result{Name: fmt.Sprintf(`%s "%s" devices`, strings.ToLower(unitTag), unitName)}
+		for _, path := range unit.Devices.Paths {
+			if _, err := os.Stat(path); err != nil {
+				result.Error = fmt.Errorf("%s is not found", path)
+				result.Fix = "install the device driver or pass the device to the server container e.g. by docker run --device"
+				break
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// checkDependencies checks external services of startup.depends are reachable.
+func checkDependencies(settings config.Startup) []doctor.Result {
+	timeout, _ := time.ParseDuration(settings.Timeout)
+	results := []doctor.Result{}
+	for _, dependency := range settings.Depends {
+		result := doctor.Result{Name: fmt.Sprintf(`dependency "%s"`, dependency.Name)}
+		if err := doctor.Reachable(dependency.Url, timeout); err != nil {
+			result.Error = err
+			result.Fix = fmt.Sprintf("start the service or fix %s url", dependency.Url)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// reportStartup logs failed startup checks, they abort the start with startup.on_failure fail_fast.
+func reportStartup(settings config.Startup, results []doctor.Result) error {
+	failed := []string{}
+	for _, result := range results {
+		if result.Error == nil {
+			continue
+		}
+		failed = append(failed, result.Name)
+		message := fmt.Sprintf("[XServer] [Startup] [Error] %s: %s", result.Name, result.Error)
+		if result.Fix != "" {
+			message += ", fix: " + result.Fix
+		}
+		logger.Error(message)
+	}
+
+	if len(failed) == 0 {
+		logger.Info(fmt.Sprintf("[XServer] [Startup] %d startup checks passed", len(results)))
+		return nil
+	}
+	if settings.OnFailure == config.StartupFailFast {
+		return fmt.Errorf("[XServer] [Startup] [Error] failed startup checks: %s", strings.Join(failed, ", "))
+	}
+	logger.Info(fmt.Sprintf("[XServer] [Startup] [Warning] server starts degraded, failed startup checks: %s", strings.Join(failed, ", ")))
+	return nil
+}
+
+// addUnavailableDatabase serves database endpoints with 503 while the server is degraded without the database.
+func addUnavailableDatabase(settings config.Database, err error) {
+	paths := []string{"/db/", "/kv/", "/admin/db/"}
+	if settings.Rest {
+		paths = append(paths, rest.Prefix)
+	}
+	for _, path := range paths {
+		server.AddHandler(path, func(writer http.ResponseWriter, request *http.Request) {
+			problem.Write(writer, request, problem.New(http.StatusServiceUnavailable, problem.CodeUnavailable, fmt.Sprintf("[XServer] [Database] [Error] database is unavailable: %s", err)).WithResult(false))
+		})
+	}
+}
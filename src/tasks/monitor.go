@@ -0,0 +1,96 @@
+package tasks
+
+import (
+	"fmt"
+	"time"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+)
+
+const (
+	MissedRun     = "run"
+	MissedSuccess = "success"
+
+	monitorInterval = 10 * time.Second
+)
+
+type Missed struct {
+	Task   string
+	Kind   string
+	Window time.Duration
+	Since  time.Time
+}
+
+func init() {
+	metrics.Register("xserver_task_last_run_timestamp_seconds", metrics.GaugeType, "Unix time of the last task run.")
+	metrics.Register("xserver_task_last_success_timestamp_seconds", metrics.GaugeType, "Unix time of the last successful task run.")
+	metrics.Register("xserver_task_missed", metrics.GaugeType, "1 if the task has not run or succeeded within its monitor window.")
+}
+
+func (tasks *Tasks) check(now time.Time) []Missed {
+	tasks.mutex.Lock()
+	defer tasks.mutex.Unlock()
+
+	missed := []Missed{}
+	for _, task := range tasks.tasks {
+		if task.paused || (task.runWithin == 0 && task.successWithin == 0) {
+			continue
+		}
+
+		lastRun := task.lastRun
+		if lastRun.IsZero() {
+			lastRun = tasks.startedAt
+		}
+		lastSuccess := task.lastSuccess
+		if lastSuccess.IsZero() {
+			lastSuccess = tasks.startedAt
+		}
+
+		runMissed := task.runWithin != 0 && now.Sub(lastRun) > task.runWithin
+		successMissed := task.successWithin != 0 && now.Sub(lastSuccess) > task.successWithin
+
+		if runMissed && !task.missedRun {
+			missed = append(missed, Missed{Task: task.name, Kind: MissedRun, Window: task.runWithin, Since: lastRun})
+		}
+		if successMissed && !task.missedSuccess {
+			missed = append(missed, Missed{Task: task.name, Kind: MissedSuccess, Window: task.successWithin, Since: lastSuccess})
+		}
+		task.missedRun = runMissed
+		task.missedSuccess = successMissed
+
+		value := 0.0
+		if runMissed || successMissed {
+			value = 1
+		}
+		metrics.Set("xserver_task_missed", value, "task", task.name)
+	}
+
+	return missed
+}
+
+func (tasks *Tasks) Monitor(callback func(missed Missed)) {
+	tasks.mutex.Lock()
+	done := tasks.done
+	tasks.mutex.Unlock()
+
+	if done == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(monitorInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				for _, missed := range tasks.check(now) {
+					logger.Error(fmt.Sprintf("[XServer] [%s Task] [Error] task has not %s within %s", missed.Task, map[string]string{MissedRun: "run", MissedSuccess: "succeeded"}[missed.Kind], missed.Window))
+					callback(missed)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,55 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+)
+
+type taskState struct {
+	Paused bool   `json:"paused"`
+	Period string `json:"period,omitempty"`
+}
+
+type state struct {
+	Tasks map[string]taskState `json:"tasks"`
+}
+
+func loadState(statePath string) (*state, error) {
+	result := &state{Tasks: map[string]taskState{}}
+
+	data, err := os.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[XServer] [Tasks] [Error] failed read tasks state file: %s", err)
+	}
+
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("[XServer] [Tasks] [Error] failed parse tasks state file: %s", err)
+	}
+	if result.Tasks == nil {
+		result.Tasks = map[string]taskState{}
+	}
+
+	return result, nil
+}
+
+func (state *state) save(statePath string) error {
+	data, err := json.MarshalIndent(state, "", "    ")
+	if err != nil {
+		return fmt.Errorf("[XServer] [Tasks] [Error] failed encode tasks state: %s", err)
+	}
+
+	if err := os.MkdirAll(path.Dir(statePath), os.ModePerm); err != nil {
+		return fmt.Errorf("[XServer] [Tasks] [Error] failed create tasks state directory: %s", err)
+	}
+
+	if err := os.WriteFile(statePath, data, 0644); err != nil {
+		return fmt.Errorf("[XServer] [Tasks] [Error] failed write tasks state file: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,427 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+	"xserver/src/scheduler"
+	"xserver/src/utils"
+
+	"github.com/robfig/cron"
+)
+
+const (
+	truncatedMarker = "\n[XServer] output truncated"
+	maxLogLine      = 64 * 1024
+)
+
+type Run struct {
+	Task      string
+	StartedAt time.Time
+	Duration  time.Duration
+	Output    string
+	Error     error
+}
+
+type Info struct {
+	Name      string     `json:"name"`
+	Period    string     `json:"period"`
+	DependsOn []string   `json:"depends_on,omitempty"`
+	OnChange  string     `json:"on_change,omitempty"`
+	Paused    bool       `json:"paused"`
+	NextRun   *time.Time `json:"next_run,omitempty"`
+}
+
+type task struct {
+	name          string
+	unit          config.ExecutableServerUnit
+	runCommand    func(context.Context, io.Writer, io.Reader) error
+	timeout       time.Duration
+	paused        bool
+	lastRun       time.Time
+	lastSuccess   time.Time
+	runWithin     time.Duration
+	successWithin time.Duration
+	missedRun     bool
+	missedSuccess bool
+}
+
+type Tasks struct {
+	cron       *cron.Cron
+	running    bool
+	startedAt  time.Time
+	done       chan struct{}
+	tasks      map[string]*task
+	dependents map[string][]string
+	mutex      sync.Mutex
+	satisfied  map[string]map[string]bool
+	listeners  []func(run Run)
+	statePath  string
+	state      *state
+}
+
+func Create(statePath string) (*Tasks, error) {
+	state, err := loadState(statePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tasks{
+		cron:       cron.New(),
+		tasks:      map[string]*task{},
+		dependents: map[string][]string{},
+		satisfied:  map[string]map[string]bool{},
+		listeners:  []func(run Run){},
+		statePath:  statePath,
+		state:      state,
+	}, nil
+}
+
+func (tasks *Tasks) OnRun(listener func(run Run)) {
+	tasks.listeners = append(tasks.listeners, listener)
+}
+
+func (tasks *Tasks) Add(name string, unit config.ExecutableServerUnit, runCommand func(context.Context, io.Writer, io.Reader) error) error {
+	currentTask := &task{
+		name:       name,
+		unit:       unit,
+		runCommand: runCommand,
+	}
+
+	if unit.Timeout != "" {
+		timeout, err := time.ParseDuration(unit.Timeout)
+		if err != nil {
+			return fmt.Errorf(`failed parse timeout "%s": %s`, unit.Timeout, err)
+		}
+		currentTask.timeout = timeout
+	}
+
+	if unit.Monitor != nil {
+		var err error
+		if unit.Monitor.RunWithin != "" {
+			if currentTask.runWithin, err = time.ParseDuration(unit.Monitor.RunWithin); err != nil {
+				return fmt.Errorf(`failed parse monitor run window "%s": %s`, unit.Monitor.RunWithin, err)
+			}
+		}
+		if unit.Monitor.SuccessWithin != "" {
+			if currentTask.successWithin, err = time.ParseDuration(unit.Monitor.SuccessWithin); err != nil {
+				return fmt.Errorf(`failed parse monitor success window "%s": %s`, unit.Monitor.SuccessWithin, err)
+			}
+		}
+	}
+
+	if taskState, ok := tasks.state.Tasks[name]; ok {
+		currentTask.paused = taskState.Paused
+		if taskState.Period != "" {
+			currentTask.unit.Period = taskState.Period
+		}
+	}
+
+	if currentTask.scheduled() {
+		if err := tasks.scheduleTask(cron.New(), currentTask); err != nil {
+			return err
+		}
+	}
+
+	tasks.mutex.Lock()
+	defer tasks.mutex.Unlock()
+
+	for _, dependency := range unit.DependsOn {
+		tasks.dependents[dependency] = append(tasks.dependents[dependency], name)
+	}
+	if len(unit.DependsOn) != 0 {
+		tasks.satisfied[name] = map[string]bool{}
+	}
+	tasks.tasks[name] = currentTask
+
+	return tasks.reschedule()
+}
+
+// scheduled reports whether the task runs by its period, tasks with dependencies and ones without period are triggered only.
+func (task *task) scheduled() bool {
+	return len(task.unit.DependsOn) == 0 && task.unit.Period != ""
+}
+
+func (tasks *Tasks) scheduleTask(taskCron *cron.Cron, task *task) error {
+	schedule, err := scheduler.Parse(task.unit.Period, task.unit.Timezone)
+	if err != nil {
+		return err
+	}
+
+	job, err := scheduler.Jitter(task.unit.Jitter, func() { tasks.run(task, false, nil) })
+	if err != nil {
+		return err
+	}
+
+	taskCron.Schedule(schedule, job)
+	return nil
+}
+
+func (tasks *Tasks) reschedule() error {
+	taskCron := cron.New()
+	for _, task := range tasks.tasks {
+		if task.paused || !task.scheduled() {
+			continue
+		}
+		if err := tasks.scheduleTask(taskCron, task); err != nil {
+			return fmt.Errorf(`[XServer] [Tasks] [Error] failed schedule "%s" task: %s`, task.name, err)
+		}
+	}
+
+	if tasks.running {
+		tasks.cron.Stop()
+		taskCron.Start()
+	}
+	tasks.cron = taskCron
+
+	return nil
+}
+
+// run runs the task with the input as stdin.
+func (tasks *Tasks) run(task *task, force bool, input []byte) {
+	tasks.mutex.Lock()
+	paused := task.paused
+	unit := task.unit
+	tasks.mutex.Unlock()
+
+	if paused && !force {
+		logger.Verbose(fmt.Sprintf("[XServer] [%s Task] task is paused, run skipped", task.name))
+		return
+	}
+
+	if unit.LogsEnable {
+		logger.Verbose(fmt.Sprintf("[XServer] [%s Task] task started", task.name))
+	}
+
+	ctx := context.Background()
+	if task.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, task.timeout)
+		defer cancel()
+	}
+
+	startedAt := time.Now()
+	outBuffer := &bytes.Buffer{}
+	var outWriter io.Writer = outBuffer
+	if unit.MaxOutput > 0 {
+		outWriter = &utils.LimitedWriter{Writer: outBuffer, Limit: int64(unit.MaxOutput), Marker: truncatedMarker}
+	}
+
+	var lineWriter *logger.LineWriter
+	if unit.LogsEnable {
+		lineWriter = logger.NewLineWriter(fmt.Sprintf("[XServer] [%s Task] ", task.name), maxLogLine, logger.Info)
+		outWriter = io.MultiWriter(outWriter, lineWriter)
+	}
+
+	err := task.runCommand(ctx, outWriter, bytes.NewReader(input))
+	if lineWriter != nil {
+		lineWriter.Flush()
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("task timed out after %s", task.timeout)
+		logger.Error(fmt.Sprintf("[XServer] [%s Task] [Error] %s", task.name, err))
+	}
+
+	if unit.LogsEnable {
+		logger.Verbose(fmt.Sprintf("[XServer] [%s Task] task finished", task.name))
+	}
+
+	tasks.mutex.Lock()
+	task.lastRun = startedAt
+	task.missedRun = false
+	if err == nil {
+		task.lastSuccess = startedAt
+		task.missedSuccess = false
+	}
+	tasks.mutex.Unlock()
+
+	metrics.Set("xserver_task_last_run_timestamp_seconds", float64(startedAt.Unix()), "task", task.name)
+	if err == nil {
+		metrics.Set("xserver_task_last_success_timestamp_seconds", float64(startedAt.Unix()), "task", task.name)
+	}
+
+	run := Run{
+		Task:      task.name,
+		StartedAt: startedAt,
+		Duration:  time.Since(startedAt),
+		Output:    outBuffer.String(),
+		Error:     err,
+	}
+	for _, listener := range tasks.listeners {
+		listener(run)
+	}
+
+	if err == nil {
+		tasks.triggerDependents(task.name)
+	}
+}
+
+func (tasks *Tasks) triggerDependents(taskName string) {
+	ready := []*task{}
+
+	tasks.mutex.Lock()
+	for _, dependentName := range tasks.dependents[taskName] {
+		dependent, ok := tasks.tasks[dependentName]
+		if !ok {
+			continue
+		}
+
+		satisfied := tasks.satisfied[dependentName]
+		satisfied[taskName] = true
+		if len(satisfied) == len(dependent.unit.DependsOn) {
+			tasks.satisfied[dependentName] = map[string]bool{}
+			ready = append(ready, dependent)
+		}
+	}
+	tasks.mutex.Unlock()
+
+	for _, dependent := range ready {
+		logger.Verbose(fmt.Sprintf(`[XServer] [%s Task] triggered by "%s" task`, dependent.name, taskName))
+		go tasks.run(dependent, false, nil)
+	}
+}
+
+func (tasks *Tasks) get(name string) (*task, error) {
+	task, ok := tasks.tasks[name]
+	if !ok {
+		return nil, fmt.Errorf(`[XServer] [Tasks] [Error] unknown task "%s"`, name)
+	}
+	return task, nil
+}
+
+func (tasks *Tasks) update(name string, update func(task *task) error) error {
+	tasks.mutex.Lock()
+	defer tasks.mutex.Unlock()
+
+	task, err := tasks.get(name)
+	if err != nil {
+		return err
+	}
+
+	previousUnit := task.unit
+	previousPaused := task.paused
+	if err := update(task); err != nil {
+		return err
+	}
+
+	if err := tasks.reschedule(); err != nil {
+		task.unit = previousUnit
+		task.paused = previousPaused
+		return err
+	}
+
+	tasks.state.Tasks[name] = taskState{Paused: task.paused, Period: task.unit.Period}
+	return tasks.state.save(tasks.statePath)
+}
+
+func (tasks *Tasks) Pause(name string) error {
+	logger.Info(fmt.Sprintf("[XServer] [%s Task] pause", name))
+	return tasks.update(name, func(task *task) error {
+		task.paused = true
+		return nil
+	})
+}
+
+func (tasks *Tasks) Resume(name string) error {
+	logger.Info(fmt.Sprintf("[XServer] [%s Task] resume", name))
+	return tasks.update(name, func(task *task) error {
+		task.paused = false
+		return nil
+	})
+}
+
+func (tasks *Tasks) SetPeriod(name string, period string) error {
+	logger.Info(fmt.Sprintf(`[XServer] [%s Task] set period "%s"`, name, period))
+	return tasks.update(name, func(task *task) error {
+		if len(task.unit.DependsOn) != 0 {
+			return fmt.Errorf(`[XServer] [Tasks] [Error] "%s" task is triggered by dependencies and has no period`, name)
+		}
+		if _, err := scheduler.Parse(period, task.unit.Timezone); err != nil {
+			return fmt.Errorf("[XServer] [Tasks] [Error] %s", err)
+		}
+		task.unit.Period = period
+		return nil
+	})
+}
+
+// RunNow starts the task run in the background, paused tasks are run too.
+func (tasks *Tasks) RunNow(name string) error {
+	tasks.mutex.Lock()
+	task, err := tasks.get(name)
+	tasks.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("[XServer] [%s Task] run now", name))
+	go tasks.run(task, true, nil)
+	return nil
+}
+
+func (tasks *Tasks) List() []Info {
+	tasks.mutex.Lock()
+	defer tasks.mutex.Unlock()
+
+	nextRuns := map[string]time.Time{}
+	for _, task := range tasks.tasks {
+		if task.paused || !task.scheduled() {
+			continue
+		}
+		if schedule, err := scheduler.Parse(task.unit.Period, task.unit.Timezone); err == nil {
+			nextRuns[task.name] = schedule.Next(time.Now())
+		}
+	}
+
+	result := []Info{}
+	for _, task := range tasks.tasks {
+		info := Info{
+			Name:      task.name,
+			Period:    task.unit.Period,
+			DependsOn: task.unit.DependsOn,
+			OnChange:  task.unit.OnChange,
+			Paused:    task.paused,
+		}
+		if nextRun, ok := nextRuns[task.name]; ok {
+			info.NextRun = &nextRun
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result
+}
+
+func (tasks *Tasks) Start() {
+	tasks.mutex.Lock()
+	defer tasks.mutex.Unlock()
+
+	tasks.running = true
+	tasks.startedAt = time.Now()
+	tasks.done = make(chan struct{})
+	tasks.cron.Start()
+	for _, task := range tasks.tasks {
+		if task.unit.OnChange != "" {
+			go tasks.watch(task, tasks.done)
+		}
+	}
+}
+
+func (tasks *Tasks) Stop() {
+	tasks.mutex.Lock()
+	defer tasks.mutex.Unlock()
+
+	tasks.running = false
+	tasks.cron.Stop()
+	if tasks.done != nil {
+		close(tasks.done)
+		tasks.done = nil
+	}
+}
@@ -0,0 +1,176 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"xserver/src/config"
+)
+
+func command(output string, err error) func(context.Context, io.Writer, io.Reader) error {
+	return func(ctx context.Context, writer io.Writer, reader io.Reader) error {
+		io.WriteString(writer, output)
+		return err
+	}
+}
+
+func waitRun(t *testing.T, runs chan Run) Run {
+	t.Helper()
+	select {
+	case run := <-runs:
+		return run
+	case <-time.After(5 * time.Second):
+		t.Fatal("task is not run")
+	}
+	return Run{}
+}
+
+func create(t *testing.T) (*Tasks, chan Run) {
+	t.Helper()
+	tasks, err := Create(filepath.Join(t.TempDir(), "tasks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := make(chan Run, 16)
+	tasks.OnRun(func(run Run) { runs <- run })
+	return tasks, runs
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		unit   config.ExecutableServerUnit
+		run    func(context.Context, io.Writer, io.Reader) error
+		output string
+		failed bool
+	}{
+		{name: "success", run: command("done", nil), output: "done"},
+		{name: "failure", run: command("", fmt.Errorf("failed")), failed: true},
+		{name: "truncated output", unit: config.ExecutableServerUnit{MaxOutput: 4}, run: command("truncated", nil), output: "trun" + truncatedMarker},
+		{
+			name: "timeout",
+			unit: config.ExecutableServerUnit{Timeout: "10ms"},
+			run: func(ctx context.Context, writer io.Writer, reader io.Reader) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			failed: true,
+		},
+		{
+			name: "input",
+			run: func(ctx context.Context, writer io.Writer, reader io.Reader) error {
+				_, err := io.Copy(writer, reader)
+				return err
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tasks, runs := create(t)
+			if err := tasks.Add("task", test.unit, test.run); err != nil {
+				t.Fatal(err)
+			}
+			if err := tasks.RunNow("task"); err != nil {
+				t.Fatal(err)
+			}
+			run := waitRun(t, runs)
+			if (run.Error != nil) != test.failed {
+				t.Fatalf("unexpected error %v", run.Error)
+			}
+			if run.Output != test.output {
+				t.Fatalf("unexpected output %q", run.Output)
+			}
+		})
+	}
+}
+
+func TestDependsOn(t *testing.T) {
+	tasks, runs := create(t)
+	if err := tasks.Add("first", config.ExecutableServerUnit{}, command("", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tasks.Add("second", config.ExecutableServerUnit{}, command("", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tasks.Add("dependent", config.ExecutableServerUnit{DependsOn: []string{"first", "second"}}, command("", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks.RunNow("first")
+	if run := waitRun(t, runs); run.Task != "first" {
+		t.Fatalf("unexpected task %s", run.Task)
+	}
+	tasks.RunNow("second")
+	if run := waitRun(t, runs); run.Task != "second" {
+		t.Fatalf("unexpected task %s", run.Task)
+	}
+	if run := waitRun(t, runs); run.Task != "dependent" {
+		t.Fatalf("dependent task is not triggered, got %s", run.Task)
+	}
+
+	if err := tasks.SetPeriod("dependent", "@every 1m"); err == nil {
+		t.Fatal("period of the task with dependencies must be rejected")
+	}
+}
+
+func TestState(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "tasks.json")
+	tasks, err := Create(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tasks.Add("task", config.ExecutableServerUnit{Period: "@every 1h"}, command("", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tasks.SetPeriod("task", "unknown"); err == nil {
+		t.Fatal("invalid period must be rejected")
+	}
+	if err := tasks.SetPeriod("task", "@every 2h"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tasks.Pause("task"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tasks.Pause("unknown"); err == nil {
+		t.Fatal("unknown task must be rejected")
+	}
+
+	restored, err := Create(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Add("task", config.ExecutableServerUnit{Period: "@every 1h"}, command("", nil)); err != nil {
+		t.Fatal(err)
+	}
+	info := restored.List()
+	if len(info) != 1 || info[0].Period != "@every 2h" || !info[0].Paused || info[0].NextRun != nil {
+		t.Fatalf("unexpected restored state %+v", info)
+	}
+}
+
+func TestUpdateWhileRunning(t *testing.T) {
+	tasks, runs := create(t)
+	if err := tasks.Add("task", config.ExecutableServerUnit{Period: "@every 1h", LogsEnable: true}, command("", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	group := sync.WaitGroup{}
+	group.Add(1)
+	go func() {
+		defer group.Done()
+		for index := 0; index < 50; index++ {
+			tasks.SetPeriod("task", fmt.Sprintf("@every %dh", index+1))
+		}
+	}()
+	for index := 0; index < 50; index++ {
+		tasks.RunNow("task")
+	}
+	group.Wait()
+	for index := 0; index < 50; index++ {
+		waitRun(t, runs)
+	}
+}
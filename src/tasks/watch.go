@@ -0,0 +1,147 @@
+package tasks
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+)
+
+const (
+	watchInterval  = time.Second
+	anyDirectories = "**"
+)
+
+func init() {
+	metrics.Register("xserver_task_changes_total", metrics.CounterType, "Number of on_change tasks runs triggered by changed files.")
+}
+
+type fileState struct {
+	size     int64
+	modified time.Time
+}
+
+// globBase returns the directory of the pattern without wildcards walked for matching files.
+func globBase(pattern string) string {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	base := []string{}
+	for _, segment := range segments[:len(segments)-1] {
+		if strings.ContainsAny(segment, `*?[\`) {
+			break
+		}
+		base = append(base, segment)
+	}
+	if len(base) == 0 {
+		return "."
+	}
+	if len(base) == 1 && base[0] == "" {
+		return "/"
+	}
+	return filepath.FromSlash(strings.Join(base, "/"))
+}
+
+// matchGlob matches the slash separated path by the pattern, the ** segment matches any number of directories.
+func matchGlob(pattern []string, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == anyDirectories {
+		for skipped := 0; skipped <= len(path); skipped++ {
+			if matchGlob(pattern[1:], path[skipped:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+	if matched, _ := filepath.Match(pattern[0], path[0]); !matched {
+		return false
+	}
+	return matchGlob(pattern[1:], path[1:])
+}
+
+// scan returns sizes and modification times of regular files matching the pattern.
+func scan(pattern string) map[string]fileState {
+	segments := strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/")
+	result := map[string]fileState{}
+	filepath.WalkDir(globBase(pattern), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return nil
+		}
+		if !matchGlob(segments, strings.Split(filepath.ToSlash(filepath.Clean(path)), "/")) {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			result[path] = fileState{size: info.Size(), modified: info.ModTime()}
+		}
+		return nil
+	})
+	return result
+}
+
+// changes returns created, modified and removed files of the current scan.
+func changes(previous map[string]fileState, current map[string]fileState) []string {
+	result := []string{}
+	for path, state := range current {
+		if previousState, ok := previous[path]; !ok || previousState != state {
+			result = append(result, path)
+		}
+	}
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			result = append(result, path)
+		}
+	}
+	return result
+}
+
+// watch runs the task once files matching on_change didn't change within debounce after the last change,
+// the task gets changed files as stdin lines and changes made during the run trigger the next one.
+func (tasks *Tasks) watch(task *task, done chan struct{}) {
+	debounce, _ := time.ParseDuration(task.unit.Debounce)
+	interval := watchInterval
+	if debounce > 0 && debounce < interval {
+		interval = debounce
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	logger.Info(fmt.Sprintf(`[XServer] [%s Task] watch "%s"`, task.name, task.unit.OnChange))
+
+	files := scan(task.unit.OnChange)
+	changed := map[string]bool{}
+	lastChange := time.Time{}
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		current := scan(task.unit.OnChange)
+		for _, path := range changes(files, current) {
+			changed[path] = true
+			lastChange = time.Now()
+		}
+		files = current
+		if len(changed) == 0 || time.Since(lastChange) < debounce {
+			continue
+		}
+
+		paths := []string{}
+		for path := range changed {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		changed = map[string]bool{}
+
+		logger.Verbose(fmt.Sprintf("[XServer] [%s Task] triggered by %d changed files", task.name, len(paths)))
+		metrics.Inc("xserver_task_changes_total", "task", task.name)
+		tasks.run(task, false, []byte(strings.Join(paths, "\n")+"\n"))
+	}
+}
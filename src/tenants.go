@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"xserver/src/admin"
+	"xserver/src/config"
+	"xserver/src/flags"
+	"xserver/src/metering"
+	"xserver/src/tasks"
+)
+
+type tenantRequest struct {
+	Tenant string `json:"tenant"`
+}
+
+type tenantStatus struct {
+	Tenant   string         `json:"tenant"`
+	Prefix   string         `json:"prefix"`
+	Handlers []string       `json:"handlers"`
+	Tasks    []string       `json:"tasks"`
+	Tables   []string       `json:"tables"`
+	Keys     []string       `json:"keys"`
+	Usage    metering.Quota `json:"usage"`
+}
+
+func sortedUnits(units map[string]config.ExecutableServerUnit, tenantName string) []string {
+	names := []string{}
+	for unitName, unit := range units {
+		if unit.Tenant == tenantName {
+			names = append(names, unitName)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tenantsStatus lists tenants with their units, tables, api keys and quotas usage.
+func tenantsStatus(config *config.Config, meter *metering.Meter) []tenantStatus {
+	result := []tenantStatus{}
+	for tenantName, tenant := range config.Tenants {
+		status := tenantStatus{
+			Tenant:   tenantName,
+			Prefix:   tenant.Prefix,
+			Handlers: sortedUnits(config.Handlers, tenantName),
+			Tasks:    sortedUnits(config.Tasks, tenantName),
+			Tables:   append([]string{}, tenant.Tables...),
+			Keys:     []string{},
+			Usage:    meter.Tenant(tenantName),
+		}
+		status.Usage.DailyLimit = tenant.Daily
+		status.Usage.MonthlyLimit = tenant.Monthly
+		for keyName, key := range config.ApiKeys.Keys {
+			if key.Tenant == tenantName {
+				status.Keys = append(status.Keys, keyName)
+			}
+		}
+		sort.Strings(status.Keys)
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Tenant < result[j].Tenant })
+	return result
+}
+
+// suspendTenant disables handlers and pauses tasks of the tenant, resume enables and resumes them back.
+func suspendTenant(config *config.Config, handlersFlags *flags.Flags, scheduledTasks *tasks.Tasks, tenantName string, suspend bool) error {
+	if _, ok := config.Tenants[tenantName]; !ok {
+		return fmt.Errorf(`[XServer] [Tenants] [Error] unknown tenant "%s"`, tenantName)
+	}
+
+	errs := []error{}
+	for _, handlerName := range sortedUnits(config.Handlers, tenantName) {
+		errs = append(errs, handlersFlags.SetEnabled(handlerName, !suspend))
+	}
+	for _, taskName := range sortedUnits(config.Tasks, tenantName) {
+		if suspend {
+			errs = append(errs, scheduledTasks.Pause(taskName))
+		} else {
+			errs = append(errs, scheduledTasks.Resume(taskName))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func tenantsCommand(config *config.Config, arguments []string) error {
+	if len(arguments) == 0 || arguments[0] == "list" {
+		response, err := admin.Request(config, "/admin/tenants", nil)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(response))
+		return nil
+	}
+
+	if (arguments[0] != "suspend" && arguments[0] != "resume") || len(arguments) != 2 {
+		usage()
+		return nil
+	}
+
+	response, err := admin.Request(config, "/admin/tenants/"+arguments[0], &tenantRequest{Tenant: arguments[1]})
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(response))
+	return nil
+}
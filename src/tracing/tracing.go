@@ -0,0 +1,429 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/metrics"
+	"xserver/src/problem"
+)
+
+const (
+	TraceparentHeader = "traceparent"
+	TraceparentEnv    = "TRACEPARENT"
+
+	ReasonParent  = "parent"
+	ReasonError   = "error"
+	ReasonSlow    = "slow"
+	ReasonSampled = "sampled"
+
+	defaultSampleRate = 1
+	defaultMaxSpans   = 100
+	defaultMaxTraces  = 1000
+)
+
+type contextKey struct{}
+
+func init() {
+	metrics.Register("xserver_traces_total", metrics.CounterType, "Number of finished traces by the sampling decision.")
+}
+
+type Span struct {
+	TraceId    string            `json:"trace_id"`
+	SpanId     string            `json:"span_id"`
+	ParentId   string            `json:"parent_id,omitempty"`
+	Name       string            `json:"name"`
+	Start      time.Time         `json:"start"`
+	DurationMs float64           `json:"duration_ms"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	trace      *trace
+}
+
+// trace collects spans of the request until the root span ends, the sampling decision is made by the whole trace.
+type trace struct {
+	mutex         sync.Mutex
+	tracer        *Tracer
+	id            string
+	parentSampled bool
+	handler       string
+	failed        bool
+	spans         []*Span
+	droppedSpans  int
+}
+
+type Trace struct {
+	TraceId      string  `json:"trace_id"`
+	Handler      string  `json:"handler,omitempty"`
+	Reason       string  `json:"reason"`
+	DurationMs   float64 `json:"duration_ms"`
+	Failed       bool    `json:"failed"`
+	DroppedSpans int     `json:"dropped_spans,omitempty"`
+	Spans        []Span  `json:"spans"`
+}
+
+// Query filters kept traces, zero fields match all traces.
+type Query struct {
+	TraceId string
+	Handler string
+	Failed  bool
+	Limit   int
+}
+
+type Tracer struct {
+	mutex        sync.Mutex
+	sampleRate   float64
+	handlerRates map[string]float64
+	sampleErrors bool
+	slow         time.Duration
+	maxSpans     int
+	maxTraces    int
+	traces       []Trace
+}
+
+func checkRate(rate float64, owner string) error {
+	if rate < 0 || rate > 1 {
+		return fmt.Errorf("[XServer] [Tracing] [Error] sample rate of %s must be between 0 and 1", owner)
+	}
+	return nil
+}
+
+// Create creates the tracer of handlers requests, it returns nil if tracing is disabled.
+func Create(settings config.Tracing, handlers map[string]config.ExecutableServerUnit) (*Tracer, error) {
+	if !settings.Enable {
+		return nil, nil
+	}
+
+	tracer := &Tracer{
+		sampleRate:   defaultSampleRate,
+		handlerRates: map[string]float64{},
+		sampleErrors: settings.AlwaysSampleErrors == nil || *settings.AlwaysSampleErrors,
+		maxSpans:     settings.MaxSpans,
+		maxTraces:    settings.MaxTraces,
+	}
+	if settings.SampleRate != nil {
+		tracer.sampleRate = *settings.SampleRate
+	}
+	if err := checkRate(tracer.sampleRate, "tracing"); err != nil {
+		return nil, err
+	}
+	for handlerName, handler := range handlers {
+		if handler.Tracing == nil || handler.Tracing.SampleRate == nil {
+			continue
+		}
+		if err := checkRate(*handler.Tracing.SampleRate, fmt.Sprintf(`"%s" handler`, handlerName)); err != nil {
+			return nil, err
+		}
+		tracer.handlerRates[handlerName] = *handler.Tracing.SampleRate
+	}
+
+	if settings.SlowThreshold != "" {
+		slow, err := time.ParseDuration(settings.SlowThreshold)
+		if err != nil {
+			return nil, fmt.Errorf("[XServer] [Tracing] [Error] failed parse slow threshold: %s", err)
+		}
+		tracer.slow = slow
+	}
+	if tracer.maxSpans <= 0 {
+		tracer.maxSpans = defaultMaxSpans
+	}
+	if tracer.maxTraces <= 0 {
+		tracer.maxTraces = defaultMaxTraces
+	}
+	return tracer, nil
+}
+
+func randomId(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func validId(id string, size int) bool {
+	if len(id) != size*2 || strings.Trim(id, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil && strings.ToLower(id) == id
+}
+
+// parseTraceparent returns the trace id, the parent span id and the sampled flag of the W3C traceparent header.
+func parseTraceparent(value string) (string, string, bool, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return "", "", false, false
+	}
+	if !validId(parts[1], 16) || !validId(parts[2], 8) || len(parts[3]) != 2 {
+		return "", "", false, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return "", "", false, false
+	}
+	return parts[1], parts[2], flags&1 == 1, true
+}
+
+// ratioSampled samples the trace by its id, so every service sampling with the same rate makes the same decision.
+func ratioSampled(traceId string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	id, err := hex.DecodeString(traceId)
+	if err != nil || len(id) != 16 {
+		return false
+	}
+	return binary.BigEndian.Uint64(id[8:])>>1 < uint64(rate*(1<<63))
+}
+
+func (tracer *Tracer) rate(handlerName string) float64 {
+	if rate, ok := tracer.handlerRates[handlerName]; ok {
+		return rate
+	}
+	return tracer.sampleRate
+}
+
+// decide returns the reason to keep the finished trace, or false if the trace is dropped.
+func (tracer *Tracer) decide(current *trace, duration time.Duration) (string, bool) {
+	switch {
+	case current.parentSampled:
+		return ReasonParent, true
+	case current.failed && tracer.sampleErrors:
+		return ReasonError, true
+	case tracer.slow > 0 && duration >= tracer.slow:
+		return ReasonSlow, true
+	case ratioSampled(current.id, tracer.rate(current.handler)):
+		return ReasonSampled, true
+	}
+	return "", false
+}
+
+func (tracer *Tracer) keep(kept Trace) {
+	tracer.mutex.Lock()
+	defer tracer.mutex.Unlock()
+	tracer.traces = append(tracer.traces, kept)
+	if len(tracer.traces) > tracer.maxTraces {
+		tracer.traces = tracer.traces[len(tracer.traces)-tracer.maxTraces:]
+	}
+}
+
+// finish makes the tail-based sampling decision once the root span ended.
+func (tracer *Tracer) finish(root *Span) {
+	current := root.trace
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	duration := time.Duration(root.DurationMs * float64(time.Millisecond))
+	reason, ok := tracer.decide(current, duration)
+	if !ok {
+		metrics.Inc("xserver_traces_total", "result", "dropped")
+		return
+	}
+	metrics.Inc("xserver_traces_total", "result", "kept", "reason", reason)
+
+	kept := Trace{
+		TraceId:      current.id,
+		Handler:      current.handler,
+		Reason:       reason,
+		DurationMs:   root.DurationMs,
+		Failed:       current.failed,
+		DroppedSpans: current.droppedSpans,
+	}
+	for _, span := range current.spans {
+		copied := *span
+		copied.Attributes = map[string]string{}
+		for key, value := range span.Attributes {
+			copied.Attributes[key] = value
+		}
+		kept.Spans = append(kept.Spans, copied)
+	}
+	tracer.keep(kept)
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (writer *statusWriter) WriteHeader(status int) {
+	writer.status = status
+	writer.ResponseWriter.WriteHeader(status)
+}
+
+func (writer *statusWriter) Flush() {
+	if flusher, ok := writer.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (writer *statusWriter) Unwrap() http.ResponseWriter {
+	return writer.ResponseWriter
+}
+
+// Handler starts the root span of every request, the trace continues the incoming traceparent header.
+func (tracer *Tracer) Handler(next http.Handler) http.Handler {
+	if tracer == nil {
+		return next
+	}
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		current := &trace{tracer: tracer, id: randomId(16)}
+		parentId := ""
+		if traceId, spanId, sampled, ok := parseTraceparent(request.Header.Get(TraceparentHeader)); ok {
+			current.id, parentId, current.parentSampled = traceId, spanId, sampled
+		}
+
+		root := &Span{
+			TraceId:    current.id,
+			SpanId:     randomId(8),
+			ParentId:   parentId,
+			Name:       request.Method + " " + request.URL.Path,
+			Start:      time.Now(),
+			Attributes: map[string]string{"request_id": problem.RequestId(request)},
+			trace:      current,
+		}
+		current.spans = append(current.spans, root)
+
+		recorder := &statusWriter{ResponseWriter: writer, status: http.StatusOK}
+		next.ServeHTTP(recorder, request.WithContext(context.WithValue(request.Context(), contextKey{}, root)))
+
+		root.SetAttribute("status", strconv.Itoa(recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			root.Fail(fmt.Errorf("%d %s", recorder.status, http.StatusText(recorder.status)))
+		}
+		root.End()
+		tracer.finish(root)
+	})
+}
+
+// FromContext returns the current span, nil if the request is not traced.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(contextKey{}).(*Span)
+	return span
+}
+
+// Start starts the child span of the current span, the span is nil if the request is not traced.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		TraceId:  parent.TraceId,
+		SpanId:   randomId(8),
+		ParentId: parent.SpanId,
+		Name:     name,
+		Start:    time.Now(),
+		trace:    parent.trace,
+	}
+	current := parent.trace
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+	if len(current.spans) >= current.tracer.maxSpans {
+		current.droppedSpans++
+		return ctx, nil
+	}
+	current.spans = append(current.spans, span)
+	return context.WithValue(ctx, contextKey{}, span), span
+}
+
+// StartHandler starts the span of the handler, the handler sample rate is used for the trace.
+func StartHandler(ctx context.Context, handlerName string) (context.Context, *Span) {
+	ctx, span := Start(ctx, handlerName)
+	if span == nil {
+		return ctx, nil
+	}
+	span.SetAttribute("handler", handlerName)
+	span.trace.mutex.Lock()
+	if span.trace.handler == "" {
+		span.trace.handler = handlerName
+	}
+	span.trace.mutex.Unlock()
+	return ctx, span
+}
+
+func (span *Span) SetAttribute(key string, value string) {
+	if span == nil {
+		return
+	}
+	span.trace.mutex.Lock()
+	defer span.trace.mutex.Unlock()
+	if span.Attributes == nil {
+		span.Attributes = map[string]string{}
+	}
+	span.Attributes[key] = value
+}
+
+// Fail marks the span and its trace as failed, failed traces are kept with always_sample_errors.
+func (span *Span) Fail(err error) {
+	if span == nil || err == nil {
+		return
+	}
+	span.trace.mutex.Lock()
+	defer span.trace.mutex.Unlock()
+	span.Error = err.Error()
+	span.trace.failed = true
+}
+
+func (span *Span) End() {
+	if span == nil {
+		return
+	}
+	span.trace.mutex.Lock()
+	defer span.trace.mutex.Unlock()
+	span.DurationMs = float64(time.Since(span.Start).Microseconds()) / 1000
+}
+
+// Traceparent returns the W3C traceparent of the span for downstream services, sampled by the trace id with the handler sample rate.
+func (span *Span) Traceparent() string {
+	if span == nil {
+		return ""
+	}
+	span.trace.mutex.Lock()
+	sampled := span.trace.parentSampled || ratioSampled(span.TraceId, span.trace.tracer.rate(span.trace.handler))
+	span.trace.mutex.Unlock()
+
+	flags := "00"
+	if sampled {
+		flags = "01"
+	}
+	return "00-" + span.TraceId + "-" + span.SpanId + "-" + flags
+}
+
+// Env returns the TRACEPARENT environment variable of the current span for handler processes.
+func Env(ctx context.Context) []string {
+	span := FromContext(ctx)
+	if span == nil {
+		return nil
+	}
+	return []string{TraceparentEnv + "=" + span.Traceparent()}
+}
+
+// Traces returns kept traces matched by the query, the latest first.
+func (tracer *Tracer) Traces(query Query) []Trace {
+	result := []Trace{}
+	if tracer == nil {
+		return result
+	}
+
+	tracer.mutex.Lock()
+	defer tracer.mutex.Unlock()
+	for index := len(tracer.traces) - 1; index >= 0; index-- {
+		current := tracer.traces[index]
+		if (query.TraceId != "" && current.TraceId != query.TraceId) || (query.Handler != "" && current.Handler != query.Handler) || (query.Failed && !current.Failed) {
+			continue
+		}
+		result = append(result, current)
+		if query.Limit > 0 && len(result) >= query.Limit {
+			break
+		}
+	}
+	return result
+}
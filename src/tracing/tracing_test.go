@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"xserver/src/config"
+)
+
+func rate(value float64) *float64 {
+	return &value
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		ok      bool
+		sampled bool
+	}{
+		{name: "sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ok: true, sampled: true},
+		{name: "not sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", ok: true},
+		{name: "future version", value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", ok: true, sampled: true},
+		{name: "zero trace id", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "uppercase", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{name: "invalid version", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "short span id", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa-01"},
+		{name: "empty"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			traceId, spanId, sampled, ok := parseTraceparent(test.value)
+			if ok != test.ok || sampled != test.sampled {
+				t.Fatalf("unexpected result %v %v", ok, sampled)
+			}
+			if ok && (traceId != "4bf92f3577b34da6a3ce929d0e0e4736" || spanId != "00f067aa0ba902b7") {
+				t.Fatalf("unexpected ids %s %s", traceId, spanId)
+			}
+		})
+	}
+}
+
+func TestSampling(t *testing.T) {
+	tests := []struct {
+		name        string
+		settings    config.Tracing
+		handler     string
+		traceparent string
+		status      int
+		delay       time.Duration
+		reason      string
+	}{
+		{name: "sampled", settings: config.Tracing{SampleRate: rate(1)}, status: http.StatusOK, reason: ReasonSampled},
+		{name: "dropped", settings: config.Tracing{SampleRate: rate(0)}, status: http.StatusOK},
+		{name: "error", settings: config.Tracing{SampleRate: rate(0)}, status: http.StatusInternalServerError, reason: ReasonError},
+		{name: "error without always sample", settings: config.Tracing{SampleRate: rate(0), AlwaysSampleErrors: new(bool)}, status: http.StatusInternalServerError},
+		{name: "slow", settings: config.Tracing{SampleRate: rate(0), SlowThreshold: "10ms"}, status: http.StatusOK, delay: 20 * time.Millisecond, reason: ReasonSlow},
+		{name: "handler override", settings: config.Tracing{SampleRate: rate(0)}, handler: "search", status: http.StatusOK, reason: ReasonSampled},
+		{name: "parent sampled", settings: config.Tracing{SampleRate: rate(0)}, traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", status: http.StatusOK, reason: ReasonParent},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.settings.Enable = true
+			tracer, err := Create(test.settings, map[string]config.ExecutableServerUnit{"search": {Tracing: &config.HandlerTracing{SampleRate: rate(1)}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler := tracer.Handler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				if test.handler != "" {
+					_, span := StartHandler(request.Context(), test.handler)
+					span.End()
+				}
+				time.Sleep(test.delay)
+				writer.WriteHeader(test.status)
+			}))
+			request := httptest.NewRequest(http.MethodGet, "/path", nil)
+			if test.traceparent != "" {
+				request.Header.Set(TraceparentHeader, test.traceparent)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+
+			traces := tracer.Traces(Query{})
+			if test.reason == "" {
+				if len(traces) != 0 {
+					t.Fatalf("trace must be dropped, got %+v", traces)
+				}
+				return
+			}
+			if len(traces) != 1 || traces[0].Reason != test.reason {
+				t.Fatalf("expected trace kept by %s, got %+v", test.reason, traces)
+			}
+			if test.traceparent != "" && (traces[0].TraceId != "4bf92f3577b34da6a3ce929d0e0e4736" || traces[0].Spans[0].ParentId != "00f067aa0ba902b7") {
+				t.Fatalf("trace does not continue the traceparent %+v", traces[0])
+			}
+		})
+	}
+}
+
+func TestSpans(t *testing.T) {
+	tracer, err := Create(config.Tracing{Enable: true, MaxSpans: 3}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := []string{}
+	handler := tracer.Handler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx, handlerSpan := StartHandler(request.Context(), "search")
+		defer handlerSpan.End()
+		ctx, execSpan := Start(ctx, "exec")
+		env = Env(ctx)
+		execSpan.Fail(errors.New("exit status 1"))
+		execSpan.End()
+		if _, dropped := Start(ctx, "over max spans"); dropped != nil {
+			t.Error("spans over max_spans must be dropped")
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/search", nil))
+
+	traces := tracer.Traces(Query{Handler: "search", Failed: true})
+	if len(traces) != 1 || len(traces[0].Spans) != 3 || traces[0].DroppedSpans != 1 || traces[0].Reason != ReasonError {
+		t.Fatalf("unexpected traces %+v", traces)
+	}
+	root, handlerSpan, execSpan := traces[0].Spans[0], traces[0].Spans[1], traces[0].Spans[2]
+	if handlerSpan.ParentId != root.SpanId || execSpan.ParentId != handlerSpan.SpanId || execSpan.Error != "exit status 1" {
+		t.Fatalf("unexpected spans %+v", traces[0].Spans)
+	}
+	if len(env) != 1 || env[0] != TraceparentEnv+"=00-"+root.TraceId+"-"+execSpan.SpanId+"-01" {
+		t.Fatalf("unexpected env %v", env)
+	}
+	if !strings.HasPrefix(root.Name, "GET /search") || root.Attributes["status"] != "200" {
+		t.Fatalf("unexpected root span %+v", root)
+	}
+}
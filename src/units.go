@@ -0,0 +1,860 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"xserver/src/canary"
+	"xserver/src/coalesce"
+	"xserver/src/config"
+	"xserver/src/database"
+	"xserver/src/devices"
+	"xserver/src/engines"
+	"xserver/src/etag"
+	"xserver/src/faults"
+	"xserver/src/flags"
+	"xserver/src/headers"
+	"xserver/src/idempotency"
+	"xserver/src/listeners"
+	"xserver/src/logger"
+	"xserver/src/mail"
+	"xserver/src/metering"
+	"xserver/src/metrics"
+	"xserver/src/mirror"
+	"xserver/src/mock"
+	"xserver/src/modes"
+	"xserver/src/normalize"
+	"xserver/src/notifications"
+	"xserver/src/plugins"
+	"xserver/src/problem"
+	"xserver/src/quarantine"
+	"xserver/src/ratelimit"
+	"xserver/src/recording"
+	"xserver/src/render"
+	"xserver/src/reporting"
+	"xserver/src/routing"
+	"xserver/src/runners"
+	"xserver/src/server"
+	"xserver/src/slo"
+	"xserver/src/tracing"
+	"xserver/src/utils"
+	"xserver/src/watchers"
+	"xserver/src/webhooks"
+	"xserver/src/workers"
+)
+
+const (
+	reloadGraceTime       = 5 * time.Second
+	outputTruncatedMarker = "\n[XServer] output truncated"
+)
+
+func init() {
+	metrics.Register("xserver_handler_terminated_total", metrics.CounterType, "Number of handlers processes terminated because the client went away or the handler timed out.")
+	metrics.Register("xserver_handler_output_truncated_total", metrics.CounterType, "Number of handlers responses truncated by max_output.")
+	metrics.Register("xserver_handler_batches_total", metrics.CounterType, "Number of batches sent to batched handlers processes.")
+	metrics.Register("xserver_handler_batched_requests_total", metrics.CounterType, "Number of requests sent to batched handlers processes in batches.")
+}
+
+// responseRecorder keeps the response status and handler failure of requests routed to canary variants and the response body of mirrored requests.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	failed bool
+	body   *bytes.Buffer
+}
+
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	if recorder.body != nil {
+		recorder.body.Write(data)
+	}
+	return recorder.ResponseWriter.Write(data)
+}
+
+func (recorder *responseRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *responseRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (recorder *responseRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+type runningHandler struct {
+	handler *server.Swappable
+	stop    func()
+}
+
+type runningUnits struct {
+	config       *config.Config
+	storage      *database.Database
+	pool         *workers.Pool
+	gpus         *devices.Scheduler
+	alerts       *notifications.Notifications
+	reporter     *reporting.Reporter
+	flags        *flags.Flags
+	canaries     *canary.Canaries
+	slos         *slo.Slos
+	meter        *metering.Meter
+	limits       *ratelimit.Limits
+	routes       *routing.Routes
+	renderers    *render.Renderers
+	tags         *etag.Tags
+	idempotency  *idempotency.Store
+	coalescing   *coalesce.Calls
+	mirror       *mirror.Mirror
+	recorder     *recording.Recorder
+	faults       *faults.Faults
+	modes        *modes.Modes
+	quarantine   *quarantine.Quarantine
+	mutex        sync.Mutex
+	rebuildMutex sync.Mutex
+	handlers     map[string]*runningHandler
+	listeners    []*listeners.Listener
+	mail         *mail.Server
+	watchers     []*watchers.Watcher
+}
+
+func newRunningUnits(config *config.Config, storage *database.Database, pool *workers.Pool, gpus *devices.Scheduler, alerts *notifications.Notifications, reporter *reporting.Reporter, handlersFlags *flags.Flags, canaries *canary.Canaries, slos *slo.Slos, meter *metering.Meter, recorder *recording.Recorder, handlersFaults *faults.Faults, serverModes *modes.Modes, handlersQuarantine *quarantine.Quarantine) *runningUnits {
+	return &runningUnits{
+		config:      config,
+		storage:     storage,
+		pool:        pool,
+		gpus:        gpus,
+		alerts:      alerts,
+		reporter:    reporter,
+		flags:       handlersFlags,
+		canaries:    canaries,
+		slos:        slos,
+		meter:       meter,
+		limits:      ratelimit.Create(config.Handlers),
+		routes:      routing.Create(config.Handlers),
+		renderers:   render.Create(config.Handlers),
+		tags:        etag.Create(),
+		idempotency: idempotency.Create(storage, config.Handlers, config.ApiKeys.Header),
+		coalescing:  coalesce.Create(config.Handlers, config.ApiKeys.Header),
+		mirror:      mirror.Create(),
+		recorder:    recorder,
+		faults:      handlersFaults,
+		modes:       serverModes,
+		quarantine:  handlersQuarantine,
+		handlers:    map[string]*runningHandler{},
+	}
+}
+
+func (units *runningUnits) createHandler(handlerName string, handler config.ExecutableServerUnit) (http.HandlerFunc, func(), error) {
+	if handler.Mock != nil {
+		handlerFunc, err := mock.Create(handlerName, *handler.Mock)
+		return handlerFunc, func() {}, err
+	}
+
+	timeout := time.Duration(0)
+	if handler.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(handler.Timeout); err != nil {
+			return nil, nil, fmt.Errorf(`[XServer] [%s Handler] [Error] failed parse timeout "%s": %s`, handlerName, handler.Timeout, err)
+		}
+	}
+
+	if handler.Run != nil && handler.Run.Engine == engines.EngineEmbedded {
+		engine, err := engines.Create(filepath.Join(handlersFilesPath, handlerName, filepath.Base(handler.File)), units.storage, units.modes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("[XServer] [%s Handler] [Error] failed create embedded engine: %s", handlerName, err)
+		}
+		return func(writer http.ResponseWriter, request *http.Request) {
+			logger.Verbose(fmt.Sprintf("[XServer] [%s Handler] handler called", handlerName))
+
+			release, ok := units.admit(handlerName, writer, request)
+			if !ok {
+				return
+			}
+			defer release()
+
+			ctx := request.Context()
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			startedAt := time.Now()
+			err := units.runResult(ctx, handlerName, startedAt, engine.Handle(writer, request.WithContext(ctx)))
+			if err != nil {
+				message := fmt.Sprintf("[XServer] [%s Handler] [Error] %s", handlerName, err)
+				logger.Error(message)
+				problem.Write(writer, request, problem.New(http.StatusInternalServerError, problem.CodeHandlerFailed, message))
+			}
+			units.handlerResult(writer, request, handlerName, err)
+		}, func() {}, nil
+	}
+
+	if handler.Run != nil && handler.Run.Engine == plugins.EnginePlugin {
+		handlerFunc, err := plugins.Load(filepath.Join(handlersFilesPath, handlerName, plugins.FileName))
+		if err != nil {
+			return nil, nil, fmt.Errorf("[XServer] [%s Handler] [Error] failed load plugin: %s", handlerName, err)
+		}
+		return handlerFunc, func() {}, nil
+	}
+
+	if handler.Run != nil && (handler.Run.Protocol == runners.ProtocolJsonRpc || handler.Run.Protocol == runners.ProtocolHttp) {
+		return units.createLongRunningHandler(handlerName, handler)
+	}
+
+	runCommand, err := getUnitRunCommand("Handler", handlersFilesPath, handlerName, handler, units.config.LowMemory())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+		logger.Verbose(fmt.Sprintf("[XServer] [%s Handler] handler called", handlerName))
+
+		release, ok := units.admit(handlerName, writer, request)
+		if !ok {
+			return
+		}
+		defer release()
+
+		gpus, releaseGpus, err := units.gpus.Acquire(request.Context(), handler.Devices)
+		if err != nil {
+			logger.Error(fmt.Sprintf("[XServer] [%s Handler] [Error] request rejected: %s", handlerName, err))
+			writer.Header().Set("Retry-After", strconv.Itoa(units.config.Workers.RetryAfter))
+			problem.Write(writer, request, problem.New(http.StatusServiceUnavailable, problem.CodeBusy, fmt.Sprintf("[XServer] [%s Handler] [Error] gpus are busy: %s", handlerName, err)))
+			return
+		}
+		defer releaseGpus()
+		env := devices.Env(handler.Devices, gpus)
+
+		ctx := request.Context()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		ctx, span := tracing.Start(ctx, "exec")
+		defer span.End()
+
+		startedAt := time.Now()
+		if !units.config.ExecHeaders {
+			response := limitOutput(writer, handler.MaxOutput)
+			err := runCommand(ctx, response, request.Body, env, nil)
+			reportTruncated(handlerName, response)
+			units.handlerResult(writer, request, handlerName, units.runResult(ctx, handlerName, startedAt, err))
+			return
+		}
+
+		spawn := time.Duration(0)
+		output := &bytes.Buffer{}
+		response := limitOutput(output, handler.MaxOutput)
+		err = runCommand(ctx, response, request.Body, env, func(duration time.Duration) { spawn = duration })
+		reportTruncated(handlerName, response)
+		err = units.runResult(ctx, handlerName, startedAt, err)
+
+		writer.Header().Set("X-XServer-Handler", handlerName)
+		writer.Header().Set("X-XServer-Spawn-Ms", formatMilliseconds(spawn))
+		writer.Header().Set("X-XServer-Exec-Ms", formatMilliseconds(time.Since(startedAt)))
+		writer.Write(output.Bytes())
+		units.handlerResult(writer, request, handlerName, err)
+	}, func() {}, nil
+}
+
+// admit rejects requests of quarantined handlers and waits for the worker of the pool, the returned function releases the worker.
+func (units *runningUnits) admit(handlerName string, writer http.ResponseWriter, request *http.Request) (func(), bool) {
+	if units.quarantine.Reject(handlerName, writer, request) {
+		return nil, false
+	}
+
+	release, err := units.pool.Acquire(request.Context())
+	if err != nil {
+		logger.Error(fmt.Sprintf("[XServer] [%s Handler] [Error] request rejected: %s", handlerName, err))
+		writer.Header().Set("Retry-After", strconv.Itoa(units.config.Workers.RetryAfter))
+		problem.Write(writer, request, problem.New(http.StatusServiceUnavailable, problem.CodeBusy, fmt.Sprintf("[XServer] [%s Handler] [Error] server is busy: %s", handlerName, err)))
+		return nil, false
+	}
+	return release, true
+}
+
+// createLongRunningHandler creates the jsonrpc or http handler, gpus are assigned to its process until the handler is stopped.
+func (units *runningUnits) createLongRunningHandler(handlerName string, handler config.ExecutableServerUnit) (http.HandlerFunc, func(), error) {
+	gpus, releaseGpus, err := units.gpus.Acquire(context.Background(), handler.Devices)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[XServer] [%s Handler] [Error] failed acquire gpus: %s", handlerName, err)
+	}
+	env := devices.Env(handler.Devices, gpus)
+
+	if handler.Run.Protocol == runners.ProtocolJsonRpc {
+		handlerFunc, stop, err := persistentHandler(handlerName, handler, env)
+		if err != nil {
+			releaseGpus()
+			return nil, nil, err
+		}
+		return handlerFunc, func() { stop(); releaseGpus() }, nil
+	}
+
+	proxied, err := proxiedHandler(handlerName, handler, env)
+	if err != nil {
+		releaseGpus()
+		return nil, nil, err
+	}
+	proxied.Start()
+	return proxied.ServeHTTP, func() { proxied.Stop(); releaseGpus() }, nil
+}
+
+// limitOutput limits the response relayed from the handler process to maxOutput bytes, 0 is unlimited.
+func limitOutput(writer io.Writer, maxOutput int) io.Writer {
+	if maxOutput <= 0 {
+		return writer
+	}
+	return &utils.LimitedWriter{Writer: writer, Limit: int64(maxOutput), Marker: outputTruncatedMarker}
+}
+
+func reportTruncated(handlerName string, writer io.Writer) {
+	if limited, ok := writer.(*utils.LimitedWriter); ok && limited.Truncated() {
+		logger.Info(fmt.Sprintf("[XServer] [%s Handler] response truncated by max_output", handlerName))
+		metrics.Inc("xserver_handler_output_truncated_total", "handler", handlerName)
+	}
+}
+
+// runResult returns the error of the handler process run, processes terminated because the client went away are not handler errors.
+func (units *runningUnits) runResult(ctx context.Context, handlerName string, startedAt time.Time, err error) error {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		logger.Verbose(fmt.Sprintf("[XServer] [%s Handler] client went away, handler process terminated", handlerName))
+		metrics.Inc("xserver_handler_terminated_total", "handler", handlerName, "reason", "cancelled")
+		return nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		metrics.Inc("xserver_handler_terminated_total", "handler", handlerName, "reason", "timeout")
+		return err
+	}
+	units.quarantine.Result(handlerName, time.Since(startedAt), err)
+	return err
+}
+
+// Add registers the handler or swaps the already registered one, the previous handler is stopped after reloadGraceTime.
+func (units *runningUnits) Add(handlerName string, handler config.ExecutableServerUnit) error {
+	handlerFunc, stop, err := units.createHandler(handlerName, handler)
+	if err != nil {
+		return err
+	}
+
+	units.mutex.Lock()
+	defer units.mutex.Unlock()
+
+	running, ok := units.handlers[handlerName]
+	if !ok {
+		swappable := server.NewSwappable(handlerFunc)
+		units.handlers[handlerName] = &runningHandler{handler: swappable, stop: stop}
+		if pattern := units.config.HandlerPattern(handlerName); pattern != "" {
+			server.AddHandler(pattern, units.route(handlerName))
+		}
+		return nil
+	}
+
+	running.handler.Swap(handlerFunc)
+	units.quarantine.Release(handlerName)
+	previousStop := running.stop
+	running.stop = stop
+	time.AfterFunc(reloadGraceTime, previousStop)
+	return nil
+}
+
+// route serves the request by the handler or its variant according to the handler flag.
+func (units *runningUnits) running(handlerName string) *runningHandler {
+	units.mutex.Lock()
+	defer units.mutex.Unlock()
+	return units.handlers[handlerName]
+}
+
+func (units *runningUnits) route(handlerName string) http.HandlerFunc {
+	shadow := units.config.Handlers[handlerName].Shadow
+	handlerHeaders := units.config.Handlers[handlerName].Headers
+	routed := func(writer http.ResponseWriter, request *http.Request) {
+		headers.Set(writer, handlerHeaders)
+
+		ctx, span := tracing.StartHandler(request.Context(), handlerName)
+		defer span.End()
+		if span != nil {
+			request = request.WithContext(ctx)
+			request.Header.Set(tracing.TraceparentHeader, span.Traceparent())
+		}
+
+		target, enabled := units.flags.Route(handlerName, request)
+		if !enabled {
+			problem.Write(writer, request, problem.New(http.StatusNotFound, problem.CodeHandlerDisabled, fmt.Sprintf("[XServer] [%s Handler] [Error] handler is disabled", handlerName)))
+			return
+		}
+		if target == handlerName {
+			target = units.routes.Route(handlerName, request)
+		}
+
+		if units.meter.Reject(handlerName, writer, request) {
+			return
+		}
+
+		if units.limits.Reject(handlerName, writer, request) {
+			return
+		}
+
+		if modes.Mutating(request) && units.modes.RejectWrite(writer, request) {
+			return
+		}
+
+		if units.faults != nil && units.faults.Inject(handlerName, writer, request) {
+			return
+		}
+
+		if units.idempotency.Handles(handlerName) && modes.Mutating(request) {
+			units.idempotency.Serve(handlerName, writer, request, func(writer http.ResponseWriter, request *http.Request) bool {
+				return units.serve(handlerName, target, shadow, writer, request, true)
+			})
+			return
+		}
+
+		observed := units.slos.Tracked(handlerName)
+		if units.coalescing.Handles(handlerName) && request.Method == http.MethodGet {
+			units.coalescing.Serve(handlerName, target, writer, request, func(writer http.ResponseWriter, request *http.Request) bool {
+				return units.serve(handlerName, target, shadow, writer, request, observed)
+			})
+			return
+		}
+
+		units.serve(handlerName, target, shadow, writer, request, observed)
+	}
+
+	var handlerFunc http.HandlerFunc = routed
+	if units.config.Handlers[handlerName].Normalize {
+		handlerFunc = normalize.Handler(handlerName, handlerFunc)
+	}
+	rendered := units.renderers.Handler(handlerName, handlerFunc)
+	if units.config.Handlers[handlerName].Etag {
+		return units.tags.Handler(handlerName, rendered)
+	}
+	return rendered
+}
+
+// serve serves the request by the target handler, observed requests are served through the response recorder to detect failures.
+func (units *runningUnits) serve(handlerName string, target string, shadow string, writer http.ResponseWriter, request *http.Request, observed bool) bool {
+	running := units.running(target)
+	if running == nil {
+		target = handlerName
+		running = units.running(handlerName)
+	}
+
+	record := units.recorder != nil && units.recorder.Sampled(handlerName)
+	if target == handlerName && shadow == "" && !record && !observed {
+		running.handler.ServeHTTP(writer, request)
+		return false
+	}
+
+	recorder := &responseRecorder{ResponseWriter: writer, status: http.StatusOK}
+
+	var body []byte
+	if shadow != "" || record {
+		var err error
+		if body, err = io.ReadAll(request.Body); err != nil {
+			problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, fmt.Sprintf("[XServer] [%s Handler] [Error] failed read request body", handlerName)))
+			return false
+		}
+		request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if shadow != "" {
+		recorder.body = &bytes.Buffer{}
+	}
+	if record {
+		units.recorder.Record(handlerName, request, body)
+	}
+
+	if target != handlerName {
+		tracing.FromContext(request.Context()).SetAttribute("variant", target)
+		logger.Verbose(fmt.Sprintf("[XServer] [%s Handler] request routed to %s", handlerName, target))
+		request.Header.Set(flags.VariantHeader, target)
+		writer.Header().Set(flags.VariantHeader, target)
+	}
+
+	startedAt := time.Now()
+	running.handler.ServeHTTP(recorder, request)
+	duration := time.Since(startedAt)
+	failed := recorder.failed || recorder.status >= http.StatusInternalServerError
+	if target != handlerName && target == units.flags.Get(handlerName).Variant {
+		units.canaries.Record(handlerName, duration, failed)
+	}
+	units.slos.Record(handlerName, duration, failed)
+
+	if shadow != "" {
+		shadowRequest := request.Clone(context.Background())
+		shadowRequest.Body = io.NopCloser(bytes.NewReader(body))
+		go units.mirrorRequest(handlerName, shadow, shadowRequest, recorder.status, recorder.body.Bytes())
+	}
+	return failed
+}
+
+// mirrorRequest serves the request by the shadow handler and records the difference with the primary response.
+func (units *runningUnits) mirrorRequest(handlerName string, shadow string, request *http.Request, status int, body []byte) {
+	running := units.running(shadow)
+	if running == nil {
+		return
+	}
+
+	recorder := mirror.NewRecorder()
+	running.handler.ServeHTTP(recorder, request)
+	units.mirror.Record(handlerName, shadow, request, status, body, recorder.Status, recorder.Body.Bytes())
+}
+
+// handlerResult reports the handler error to alerts and marks the canary response as failed.
+func (units *runningUnits) handlerResult(writer http.ResponseWriter, request *http.Request, handlerName string, err error) {
+	if recorder, ok := writer.(*responseRecorder); ok && err != nil {
+		recorder.failed = true
+	}
+	tracing.FromContext(request.Context()).Fail(err)
+	units.alerts.HandlerResult(handlerName, err)
+	units.reporter.Report(reporting.Report{Kind: reporting.KindHandler, Unit: handlerName, Error: err, RequestId: problem.RequestId(request)})
+}
+
+func (units *runningUnits) Stop() {
+	units.mutex.Lock()
+	defer units.mutex.Unlock()
+
+	for _, listener := range units.listeners {
+		listener.Stop()
+	}
+	if units.mail != nil {
+		units.mail.Stop()
+	}
+	for _, watcher := range units.watchers {
+		watcher.Stop()
+	}
+	for _, running := range units.handlers {
+		running.stop()
+	}
+}
+
+// Mail starts the smtp listener running handlers of recipients with the json message as stdin.
+func (units *runningUnits) Mail() error {
+	runCommands := map[string]func(context.Context, io.Writer, io.Reader, []string, func(time.Duration)) error{}
+	for _, handlerName := range units.config.Mail.Recipients {
+		if _, ok := runCommands[handlerName]; ok {
+			continue
+		}
+		runCommand, err := getUnitRunCommand("Handler", handlersFilesPath, handlerName, units.config.Handlers[handlerName], false)
+		if err != nil {
+			return err
+		}
+		runCommands[handlerName] = runCommand
+	}
+
+	deliver := func(handlerName string, message *mail.Message) error {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		ctx := context.Background()
+		if timeout, err := time.ParseDuration(units.config.Handlers[handlerName].Timeout); err == nil && timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		release, err := units.pool.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		startedAt := time.Now()
+		err = units.runResult(ctx, handlerName, startedAt, runCommands[handlerName](ctx, io.Discard, bytes.NewReader(data), nil, nil))
+		units.alerts.HandlerResult(handlerName, err)
+		units.reporter.Report(reporting.Report{Kind: reporting.KindHandler, Unit: handlerName, Error: err})
+		return err
+	}
+
+	server, err := mail.Start(units.config.Mail, deliver)
+	if err != nil {
+		return err
+	}
+	units.mutex.Lock()
+	defer units.mutex.Unlock()
+	units.mail = server
+	return nil
+}
+
+// Watch starts the watcher running its handler or task for new files, stdin is the json file or the file content.
+func (units *runningUnits) Watch(watcherName string, settings config.Watcher) error {
+	unitTag, unitsFilesPath, unitName, unit := "Handler", handlersFilesPath, settings.Handler, units.config.Handlers[settings.Handler]
+	if settings.Task != "" {
+		unitTag, unitsFilesPath, unitName, unit = "Task", tasksFilesPath, settings.Task, units.config.Tasks[settings.Task]
+	}
+	runCommand, err := getUnitRunCommand(unitTag, unitsFilesPath, unitName, unit, false)
+	if err != nil {
+		return err
+	}
+	timeout := time.Duration(0)
+	if unit.Timeout != "" {
+		if timeout, err = time.ParseDuration(unit.Timeout); err != nil {
+			return fmt.Errorf(`[XServer] [%s %s] [Error] failed parse timeout "%s": %s`, unitName, unitTag, unit.Timeout, err)
+		}
+	}
+
+	run := func(ctx context.Context, file watchers.File, input io.Reader) error {
+		if input == nil {
+			data, err := json.Marshal(file)
+			if err != nil {
+				return err
+			}
+			input = bytes.NewReader(data)
+		}
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		release, err := units.pool.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		env := []string{watchers.FileEnv + "=" + file.Path, watchers.WatcherEnv + "=" + file.Watcher}
+		err = runCommand(ctx, io.Discard, input, env, nil)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return err
+		}
+		if settings.Task != "" {
+			units.alerts.TaskResult(unitName, err)
+			units.reporter.Report(reporting.Report{Kind: reporting.KindTask, Unit: unitName, Error: err})
+			return err
+		}
+		units.alerts.HandlerResult(unitName, err)
+		units.reporter.Report(reporting.Report{Kind: reporting.KindHandler, Unit: unitName, Error: err})
+		return err
+	}
+
+	watcher, err := watchers.Start(watcherName, settings, run)
+	if err != nil {
+		return err
+	}
+	units.mutex.Lock()
+	defer units.mutex.Unlock()
+	units.watchers = append(units.watchers, watcher)
+	return nil
+}
+
+// Listen starts the tcp or udp listener of the handler, every connection or datagram runs the handler process.
+func (units *runningUnits) Listen(handlerName string, handler config.ExecutableServerUnit) error {
+	runCommand, err := getUnitRunCommand("Handler", handlersFilesPath, handlerName, handler, true)
+	if err != nil {
+		return err
+	}
+	timeout := time.Duration(0)
+	if handler.Timeout != "" {
+		if timeout, err = time.ParseDuration(handler.Timeout); err != nil {
+			return fmt.Errorf(`[XServer] [%s Handler] [Error] failed parse timeout "%s": %s`, handlerName, handler.Timeout, err)
+		}
+	}
+
+	run := func(ctx context.Context, writer io.Writer, reader io.Reader, env []string) error {
+		startedAt := time.Now()
+		return units.runResult(ctx, handlerName, startedAt, runCommand(ctx, writer, reader, env, nil))
+	}
+	result := func(err error) {
+		units.alerts.HandlerResult(handlerName, err)
+		units.reporter.Report(reporting.Report{Kind: reporting.KindHandler, Unit: handlerName, Error: err})
+	}
+	listener, err := listeners.Start(handlerName, *handler.Listen, timeout, units.pool.Acquire, run, result)
+	if err != nil {
+		return err
+	}
+
+	units.mutex.Lock()
+	defer units.mutex.Unlock()
+	units.listeners = append(units.listeners, listener)
+	return nil
+}
+
+// rebuildUnit builds the unit into a staging directory and replaces the current build only if the build succeeded.
+func rebuildUnit(unitTag string, unitsFilesPath string, unitName string, unit config.ExecutableServerUnit) error {
+	if err := os.MkdirAll(unitsFilesPath, os.ModePerm); err != nil {
+		return fmt.Errorf("[XServer] [Rebuild] [Error] failed create files directory: %s", err)
+	}
+	staging, err := os.MkdirTemp(unitsFilesPath, ".rebuild-")
+	if err != nil {
+		return fmt.Errorf("[XServer] [Rebuild] [Error] failed create staging directory: %s", err)
+	}
+	defer os.RemoveAll(staging)
+
+	if err := buildUnit(unitTag, staging, unitName, unit); err != nil {
+		return err
+	}
+
+	unitFilesPath := filepath.Join(unitsFilesPath, unitName)
+	if err := os.Rename(unitFilesPath, filepath.Join(staging, ".previous")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf(`[XServer] [Rebuild] [Error] failed replace "%s" build: %s`, unitName, err)
+	}
+	if err := os.Rename(filepath.Join(staging, unitName), unitFilesPath); err != nil {
+		return fmt.Errorf(`[XServer] [Rebuild] [Error] failed replace "%s" build: %s`, unitName, err)
+	}
+	return nil
+}
+
+func (units *runningUnits) Rebuild(unitName string) error {
+	units.rebuildMutex.Lock()
+	defer units.rebuildMutex.Unlock()
+
+	handler, isHandler := units.config.Handlers[unitName]
+	task, isTask := units.config.Tasks[unitName]
+	if !isHandler && !isTask {
+		return fmt.Errorf(`[XServer] [Rebuild] [Error] unknown unit "%s"`, unitName)
+	}
+
+	_, err := os.Stat(units.config.ManifestPath())
+	signed := err == nil
+	if signed && units.config.Build.SigningKey == "" {
+		return fmt.Errorf(`[XServer] [Rebuild] [Error] build is signed, build.signing_key is required to rebuild "%s"`, unitName)
+	}
+
+	if isHandler {
+		if handler.Run != nil && handler.Run.Engine == plugins.EnginePlugin {
+			return fmt.Errorf(`[XServer] [Rebuild] [Error] plugin handler "%s" can't be reloaded, build and restart the server`, unitName)
+		}
+		if err := rebuildUnit("Handlers", handlersFilesPath, unitName, handler); err != nil {
+			return err
+		}
+		if err := units.Add(unitName, handler); err != nil {
+			return err
+		}
+		logger.Info(fmt.Sprintf(`[XServer] [Rebuild] handler "%s" reloaded`, unitName))
+	}
+
+	if isTask {
+		if err := rebuildUnit("Tasks", tasksFilesPath, unitName, task); err != nil {
+			return err
+		}
+		logger.Info(fmt.Sprintf(`[XServer] [Rebuild] task "%s" rebuilt`, unitName))
+	}
+
+	if signed {
+		return signBuild(units.config.Build.OutputDir, units.config.ManifestPath(), units.config.Build.SigningKey)
+	}
+	return nil
+}
+
+type githubPush struct {
+	Ref string `json:"ref"`
+}
+
+// refMatches reports whether the pushed ref is the ref of the git unit, units without git sources match any ref.
+func refMatches(unit config.ExecutableServerUnit, ref string) bool {
+	if unit.Git == nil || unit.Git.Ref == "" || unit.Git.Ref == "HEAD" {
+		return true
+	}
+	return ref == unit.Git.Ref || ref == "refs/heads/"+unit.Git.Ref || ref == "refs/tags/"+unit.Git.Ref
+}
+
+// GithubHandler rebuilds the unit on GitHub push events signed with admin.github_secret.
+func (units *runningUnits) GithubHandler(writer http.ResponseWriter, request *http.Request) {
+	unitName := strings.TrimPrefix(request.URL.Path, "/github/rebuild/")
+
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, "[XServer] [Github] [Error] failed read request body").WithResult(false))
+		return
+	}
+
+	signature := webhooks.Sign(units.config.Admin.GithubSecret, body)
+	if subtle.ConstantTimeCompare([]byte(request.Header.Get("X-Hub-Signature-256")), []byte(signature)) != 1 {
+		logger.Error(fmt.Sprintf(`[XServer] [Github] [Error] invalid signature of "%s" rebuild request`, unitName))
+		problem.Write(writer, request, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "[XServer] [Github] [Error] invalid signature").WithResult(false))
+		return
+	}
+
+	event := request.Header.Get("X-GitHub-Event")
+	if event == "ping" {
+		writer.Write([]byte(`{"result": true}`))
+		return
+	}
+	if event != "push" {
+		writer.Write([]byte(fmt.Sprintf(`{"result": true, "skipped": "event %s"}`, event)))
+		return
+	}
+
+	push := &githubPush{}
+	if err := json.Unmarshal(body, push); err != nil {
+		problem.Write(writer, request, problem.New(http.StatusBadRequest, problem.CodeBadRequest, fmt.Sprintf("[XServer] [Github] [Error] failed decode push event: %s", err)).WithResult(false))
+		return
+	}
+
+	unit, ok := units.config.Handlers[unitName]
+	if !ok {
+		unit = units.config.Tasks[unitName]
+	}
+	if !refMatches(unit, push.Ref) {
+		writer.Write([]byte(fmt.Sprintf(`{"result": true, "skipped": "ref %s"}`, push.Ref)))
+		return
+	}
+
+	if err := units.Rebuild(unitName); err != nil {
+		logger.Error(err.Error())
+		problem.Write(writer, request, problem.New(http.StatusInternalServerError, problem.CodeInternal, err.Error()).WithResult(false))
+		return
+	}
+	writer.Write([]byte(`{"result": true}`))
+}
+
+func (units *runningUnits) RebuildHandler(writer http.ResponseWriter, request *http.Request) {
+	unitName := strings.TrimPrefix(request.URL.Path, "/admin/rebuild/")
+	if unitName == "" {
+		http.NotFound(writer, request)
+		return
+	}
+
+	if err := units.Rebuild(unitName); err != nil {
+		logger.Error(err.Error())
+		problem.Write(writer, request, problem.New(http.StatusInternalServerError, problem.CodeInternal, err.Error()).WithResult(false))
+		return
+	}
+	writer.Write([]byte(`{"result": true}`))
+}
+
+func pullUnits(handlers map[string]config.ExecutableServerUnit, tasks map[string]config.ExecutableServerUnit, name string, rebuild func(unitName string) error) ([]string, error) {
+	names := map[string]bool{}
+	for _, units := range []map[string]config.ExecutableServerUnit{handlers, tasks} {
+		for unitName, unit := range units {
+			if unit.Git != nil && (name == "" || name == unitName) {
+				names[unitName] = true
+			}
+		}
+	}
+
+	if len(names) == 0 {
+		if name == "" {
+			return []string{}, fmt.Errorf("[XServer] [Pull] [Error] no git units")
+		}
+		return []string{}, fmt.Errorf(`[XServer] [Pull] [Error] no git unit "%s"`, name)
+	}
+
+	pulled := []string{}
+	errs := []error{}
+	for unitName := range names {
+		if err := rebuild(unitName); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		pulled = append(pulled, unitName)
+	}
+	sort.Strings(pulled)
+	return pulled, errors.Join(errs...)
+}
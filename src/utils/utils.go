@@ -1,8 +1,11 @@
 package utils
 
 import (
+	"bytes"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 )
 
 func CopyFile(srcPath, dstPath string) (err error) {
@@ -27,3 +30,109 @@ func CopyFile(srcPath, dstPath string) (err error) {
 	err = out.Sync()
 	return
 }
+
+func CopyPath(srcPath, dstPath string) error {
+	return filepath.WalkDir(srcPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(srcPath, path)
+		if err != nil {
+			return err
+		}
+		targetPath := filepath.Join(dstPath, relativePath)
+
+		if entry.IsDir() {
+			return os.MkdirAll(targetPath, os.ModePerm)
+		}
+		if err := os.MkdirAll(filepath.Dir(targetPath), os.ModePerm); err != nil {
+			return err
+		}
+		return CopyFile(path, targetPath)
+	})
+}
+
+type LimitedWriter struct {
+	Writer    io.Writer
+	Limit     int64
+	Marker    string
+	written   int64
+	truncated bool
+}
+
+func (writer *LimitedWriter) Write(data []byte) (int, error) {
+	if writer.truncated {
+		return len(data), nil
+	}
+
+	if writer.written+int64(len(data)) <= writer.Limit {
+		written, err := writer.Writer.Write(data)
+		writer.written += int64(written)
+		return written, err
+	}
+
+	available := writer.Limit - writer.written
+	if _, err := writer.Writer.Write(data[:available]); err != nil {
+		return 0, err
+	}
+	writer.written = writer.Limit
+	writer.truncated = true
+
+	if _, err := io.WriteString(writer.Writer, writer.Marker); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (writer *LimitedWriter) Truncated() bool {
+	return writer.truncated
+}
+
+// LineLimitedWriter keeps the first Limit bytes of every line and replaces the rest of the line by the marker.
+type LineLimitedWriter struct {
+	Writer    io.Writer
+	Limit     int
+	Marker    string
+	length    int
+	truncated int
+}
+
+func (writer *LineLimitedWriter) Write(data []byte) (int, error) {
+	output := make([]byte, 0, len(data))
+	for rest := data; len(rest) > 0; {
+		line := rest
+		newline := bytes.IndexByte(rest, '\n')
+		if newline >= 0 {
+			line = rest[:newline]
+			rest = rest[newline+1:]
+		} else {
+			rest = nil
+		}
+
+		if available := writer.Limit - writer.length; available >= 0 {
+			if len(line) <= available {
+				output = append(output, line...)
+				writer.length += len(line)
+			} else {
+				output = append(append(output, line[:available]...), writer.Marker...)
+				writer.length = writer.Limit + 1
+				writer.truncated++
+			}
+		}
+		if newline >= 0 {
+			output = append(output, '\n')
+			writer.length = 0
+		}
+	}
+
+	if _, err := writer.Writer.Write(output); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Truncated returns the number of truncated lines.
+func (writer *LineLimitedWriter) Truncated() int {
+	return writer.truncated
+}
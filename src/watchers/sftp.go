@@ -0,0 +1,468 @@
+package watchers
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"xserver/src/config"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Packets of the sftp protocol version 3.
+const (
+	sftpInit     = 1
+	sftpVersion  = 2
+	sftpOpen     = 3
+	sftpClose    = 4
+	sftpRead     = 5
+	sftpOpendir  = 11
+	sftpReaddir  = 12
+	sftpRemove   = 13
+	sftpMkdir    = 14
+	sftpRename   = 18
+	sftpStatus   = 101
+	sftpHandle   = 102
+	sftpData     = 103
+	sftpName     = 104
+	openRead     = 0x00000001
+	statusOk     = 0
+	statusEof    = 1
+	attrSize     = 0x00000001
+	attrUidGid   = 0x00000002
+	attrMode     = 0x00000004
+	attrTimes    = 0x00000008
+	attrExtended = 0x80000000
+	modeType     = 0170000
+	modeRegular  = 0100000
+
+	sftpProtocolVersion = 3
+	readSize            = 32 << 10
+	maxPacketSize       = 256 << 10
+	dialTimeout         = 30 * time.Second
+)
+
+var (
+	errEof = errors.New("end of file")
+)
+
+// remote is the directory of the sftp server, the connection is established on demand and dropped after failures.
+type remote struct {
+	path     string
+	address  string
+	settings *ssh.ClientConfig
+	mutex    sync.Mutex
+	ssh      *ssh.Client
+	session  *ssh.Session
+	reader   io.Reader
+	writer   io.WriteCloser
+	id       uint32
+}
+
+func expandHome(value string) string {
+	if rest, ok := strings.CutPrefix(value, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return value
+}
+
+func newRemote(directory string, settings config.Sftp) (*remote, error) {
+	hostKeys, err := knownhosts.New(expandHome(settings.KnownHosts))
+	if err != nil {
+		return nil, fmt.Errorf("failed load known hosts: %s", err)
+	}
+	auth := []ssh.AuthMethod{}
+	if settings.Key != "" {
+		data, err := os.ReadFile(expandHome(settings.Key))
+		if err != nil {
+			return nil, fmt.Errorf("failed read sftp key: %s", err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed parse sftp key: %s", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if settings.PasswordEnv != "" {
+		auth = append(auth, ssh.Password(os.Getenv(settings.PasswordEnv)))
+	}
+	return &remote{
+		path:    directory,
+		address: settings.Address,
+		settings: &ssh.ClientConfig{
+			User:            settings.Username,
+			Auth:            auth,
+			HostKeyCallback: hostKeys,
+			Timeout:         dialTimeout,
+		},
+	}, nil
+}
+
+// packet is the sftp packet payload builder and parser.
+type packet struct {
+	data []byte
+}
+
+func (packet *packet) byte(value byte) *packet {
+	packet.data = append(packet.data, value)
+	return packet
+}
+
+func (packet *packet) uint32(value uint32) *packet {
+	packet.data = binary.BigEndian.AppendUint32(packet.data, value)
+	return packet
+}
+
+func (packet *packet) uint64(value uint64) *packet {
+	packet.data = binary.BigEndian.AppendUint64(packet.data, value)
+	return packet
+}
+
+func (packet *packet) string(value string) *packet {
+	packet.uint32(uint32(len(value)))
+	packet.data = append(packet.data, value...)
+	return packet
+}
+
+func (packet *packet) readUint32() (uint32, error) {
+	if len(packet.data) < 4 {
+		return 0, errors.New("short sftp packet")
+	}
+	value := binary.BigEndian.Uint32(packet.data)
+	packet.data = packet.data[4:]
+	return value, nil
+}
+
+func (packet *packet) readUint64() (uint64, error) {
+	if len(packet.data) < 8 {
+		return 0, errors.New("short sftp packet")
+	}
+	value := binary.BigEndian.Uint64(packet.data)
+	packet.data = packet.data[8:]
+	return value, nil
+}
+
+func (packet *packet) readString() (string, error) {
+	size, err := packet.readUint32()
+	if err != nil {
+		return "", err
+	}
+	if uint32(len(packet.data)) < size {
+		return "", errors.New("short sftp packet")
+	}
+	value := string(packet.data[:size])
+	packet.data = packet.data[size:]
+	return value, nil
+}
+
+// readAttrs returns the mode, size and modification time of file attributes.
+func (packet *packet) readAttrs() (uint32, int64, time.Time, error) {
+	var mode uint32
+	var size uint64
+	var modified time.Time
+	flags, err := packet.readUint32()
+	if err != nil {
+		return 0, 0, modified, err
+	}
+	if flags&attrSize != 0 {
+		if size, err = packet.readUint64(); err != nil {
+			return 0, 0, modified, err
+		}
+	}
+	if flags&attrUidGid != 0 {
+		if _, err = packet.readUint64(); err != nil {
+			return 0, 0, modified, err
+		}
+	}
+	if flags&attrMode != 0 {
+		if mode, err = packet.readUint32(); err != nil {
+			return 0, 0, modified, err
+		}
+	}
+	if flags&attrTimes != 0 {
+		if _, err = packet.readUint32(); err != nil {
+			return 0, 0, modified, err
+		}
+		mtime, err := packet.readUint32()
+		if err != nil {
+			return 0, 0, modified, err
+		}
+		modified = time.Unix(int64(mtime), 0)
+	}
+	if flags&attrExtended != 0 {
+		count, err := packet.readUint32()
+		if err != nil {
+			return 0, 0, modified, err
+		}
+		for index := uint32(0); index < count*2; index++ {
+			if _, err := packet.readString(); err != nil {
+				return 0, 0, modified, err
+			}
+		}
+	}
+	return mode, int64(size), modified, nil
+}
+
+func (remote *remote) send(kind byte, payload []byte) error {
+	message := (&packet{}).uint32(uint32(len(payload) + 1)).byte(kind)
+	message.data = append(message.data, payload...)
+	_, err := remote.writer.Write(message.data)
+	return err
+}
+
+func (remote *remote) receive() (byte, *packet, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(remote.reader, header); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header)
+	if size < 1 || size > maxPacketSize {
+		return 0, nil, fmt.Errorf("invalid sftp packet size %d", size)
+	}
+	payload := make([]byte, size-1)
+	if _, err := io.ReadFull(remote.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[4], &packet{data: payload}, nil
+}
+
+func (remote *remote) connect() error {
+	if remote.ssh != nil {
+		return nil
+	}
+	client, err := ssh.Dial("tcp", remote.address, remote.settings)
+	if err != nil {
+		return fmt.Errorf("failed connect sftp server: %s", err)
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return fmt.Errorf("failed open sftp session: %s", err)
+	}
+	remote.ssh, remote.session = client, session
+	if remote.writer, err = session.StdinPipe(); err == nil {
+		if remote.reader, err = session.StdoutPipe(); err == nil {
+			err = session.RequestSubsystem("sftp")
+		}
+	}
+	if err == nil {
+		err = remote.send(sftpInit, (&packet{}).uint32(sftpProtocolVersion).data)
+	}
+	if err == nil {
+		var kind byte
+		if kind, _, err = remote.receive(); err == nil && kind != sftpVersion {
+			err = fmt.Errorf("unexpected sftp packet %d", kind)
+		}
+	}
+	if err != nil {
+		remote.disconnect()
+		return fmt.Errorf("failed start sftp subsystem: %s", err)
+	}
+	return nil
+}
+
+func (remote *remote) disconnect() {
+	if remote.ssh == nil {
+		return
+	}
+	remote.session.Close()
+	remote.ssh.Close()
+	remote.ssh, remote.session = nil, nil
+}
+
+// request sends the request and returns the response, requests are sequential so the response is the one of the request.
+func (remote *remote) request(kind byte, build func(request *packet)) (byte, *packet, error) {
+	remote.id++
+	request := (&packet{}).uint32(remote.id)
+	build(request)
+	if err := remote.send(kind, request.data); err != nil {
+		return 0, nil, err
+	}
+	responseKind, response, err := remote.receive()
+	if err != nil {
+		return 0, nil, err
+	}
+	id, err := response.readUint32()
+	if err != nil {
+		return 0, nil, err
+	}
+	if id != remote.id {
+		return 0, nil, fmt.Errorf("unexpected sftp response id %d", id)
+	}
+	if responseKind != sftpStatus {
+		return responseKind, response, nil
+	}
+	code, err := response.readUint32()
+	if err != nil {
+		return 0, nil, err
+	}
+	switch code {
+	case statusOk:
+		return responseKind, response, nil
+	case statusEof:
+		return 0, nil, errEof
+	}
+	message, _ := response.readString()
+	return 0, nil, fmt.Errorf("sftp status %d: %s", code, message)
+}
+
+func (remote *remote) handle(kind byte, name string, flags uint32) (string, error) {
+	responseKind, response, err := remote.request(kind, func(request *packet) {
+		request.string(name)
+		if kind == sftpOpen {
+			request.uint32(flags).uint32(0)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	if responseKind != sftpHandle {
+		return "", fmt.Errorf("unexpected sftp packet %d", responseKind)
+	}
+	return response.readString()
+}
+
+func (remote *remote) closeHandle(handle string) {
+	remote.request(sftpClose, func(request *packet) { request.string(handle) })
+}
+
+// locked runs the operation on the connection, the connection is dropped when the operation fails.
+func (remote *remote) locked(operation func() error) error {
+	remote.mutex.Lock()
+	defer remote.mutex.Unlock()
+	if err := remote.connect(); err != nil {
+		return err
+	}
+	err := operation()
+	if err != nil {
+		remote.disconnect()
+	}
+	return err
+}
+
+func (remote *remote) list() ([]entry, error) {
+	result := []entry{}
+	err := remote.locked(func() error {
+		handle, err := remote.handle(sftpOpendir, remote.path, 0)
+		if err != nil {
+			return err
+		}
+		defer remote.closeHandle(handle)
+		for {
+			kind, response, err := remote.request(sftpReaddir, func(request *packet) { request.string(handle) })
+			if err == errEof {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if kind != sftpName {
+				return fmt.Errorf("unexpected sftp packet %d", kind)
+			}
+			count, err := response.readUint32()
+			if err != nil {
+				return err
+			}
+			for index := uint32(0); index < count; index++ {
+				name, err := response.readString()
+				if err != nil {
+					return err
+				}
+				if _, err := response.readString(); err != nil {
+					return err
+				}
+				mode, size, modified, err := response.readAttrs()
+				if err != nil {
+					return err
+				}
+				if mode&modeType == modeRegular {
+					result = append(result, entry{name: name, size: size, modified: modified})
+				}
+			}
+		}
+	})
+	return result, err
+}
+
+// fetch downloads the file to the temporary file removed by cleanup.
+func (remote *remote) fetch(name string) (string, func(), error) {
+	file, err := os.CreateTemp("", "xserver-watcher-*-"+filepath.Base(name))
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(file.Name()) }
+	defer file.Close()
+
+	err = remote.locked(func() error {
+		handle, err := remote.handle(sftpOpen, path.Join(remote.path, name), openRead)
+		if err != nil {
+			return err
+		}
+		defer remote.closeHandle(handle)
+		offset := uint64(0)
+		for {
+			kind, response, err := remote.request(sftpRead, func(request *packet) {
+				request.string(handle).uint64(offset).uint32(readSize)
+			})
+			if err == errEof {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if kind != sftpData {
+				return fmt.Errorf("unexpected sftp packet %d", kind)
+			}
+			data, err := response.readString()
+			if err != nil {
+				return err
+			}
+			if _, err := file.WriteString(data); err != nil {
+				return err
+			}
+			offset += uint64(len(data))
+		}
+	})
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return file.Name(), cleanup, nil
+}
+
+func (remote *remote) remove(name string) error {
+	return remote.locked(func() error {
+		_, _, err := remote.request(sftpRemove, func(request *packet) { request.string(path.Join(remote.path, name)) })
+		return err
+	})
+}
+
+// move renames the file into the directory, relative directories are directories of the watched one and are created when missing.
+func (remote *remote) move(name string, directory string) error {
+	if !path.IsAbs(directory) {
+		directory = path.Join(remote.path, directory)
+	}
+	return remote.locked(func() error {
+		remote.request(sftpMkdir, func(request *packet) { request.string(directory).uint32(0) })
+		_, _, err := remote.request(sftpRename, func(request *packet) {
+			request.string(path.Join(remote.path, name)).string(path.Join(directory, name))
+		})
+		return err
+	})
+}
+
+func (remote *remote) close() {
+	remote.mutex.Lock()
+	defer remote.mutex.Unlock()
+	remote.disconnect()
+}
@@ -0,0 +1,261 @@
+package watchers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/logger"
+	"xserver/src/metrics"
+)
+
+const (
+	FileEnv    = "XSERVER_FILE"
+	WatcherEnv = "XSERVER_WATCHER"
+)
+
+func init() {
+	metrics.Register("xserver_watcher_files_total", metrics.CounterType, "Number of drop folders files processed by watchers by result.")
+	metrics.Register("xserver_watcher_errors_total", metrics.CounterType, "Number of failed drop folders polls of watchers.")
+}
+
+// File is the new file of the watched directory passed to the unit as json, path is the local path of the file or of its downloaded copy.
+type File struct {
+	Watcher  string    `json:"watcher"`
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// Run runs the unit of the watcher with the file, input is the file content or nil.
+type Run func(ctx context.Context, file File, input io.Reader) error
+
+// entry is the regular file of the watched directory.
+type entry struct {
+	name     string
+	size     int64
+	modified time.Time
+}
+
+// source is the watched directory, move targets are directories of the same source.
+type source interface {
+	list() ([]entry, error)
+	fetch(name string) (path string, cleanup func(), err error)
+	remove(name string) error
+	move(name string, directory string) error
+	close()
+}
+
+// Watcher polls the directory and runs the unit for files unchanged since the previous poll.
+type Watcher struct {
+	name     string
+	settings config.Watcher
+	interval time.Duration
+	source   source
+	run      Run
+	// pending are sizes and modification times of files seen by the previous poll, done are processed files kept in the directory.
+	pending map[string]entry
+	done    map[string]entry
+	cancel  context.CancelFunc
+	stopped sync.WaitGroup
+}
+
+// Start starts polling the directory of the watcher, settings are verified by the config.
+func Start(name string, settings config.Watcher, run Run) (*Watcher, error) {
+	interval, err := time.ParseDuration(settings.Interval)
+	if err != nil {
+		return nil, fmt.Errorf(`[XServer] [%s Watcher] [Error] failed parse interval "%s": %s`, name, settings.Interval, err)
+	}
+	var watched source = &local{path: settings.Path}
+	if settings.Sftp != nil {
+		watched, err = newRemote(settings.Path, *settings.Sftp)
+		if err != nil {
+			return nil, fmt.Errorf("[XServer] [%s Watcher] [Error] %s", name, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watcher := &Watcher{
+		name:     name,
+		settings: settings,
+		interval: interval,
+		source:   watched,
+		run:      run,
+		pending:  map[string]entry{},
+		done:     map[string]entry{},
+		cancel:   cancel,
+	}
+	watcher.stopped.Add(1)
+	go watcher.watch(ctx)
+	logger.Info(fmt.Sprintf("[XServer] [%s Watcher] watch %s", name, watcher.location()))
+	return watcher, nil
+}
+
+// Stop stops polling and terminates the running unit.
+func (watcher *Watcher) Stop() {
+	watcher.cancel()
+	watcher.stopped.Wait()
+	watcher.source.close()
+}
+
+func (watcher *Watcher) location() string {
+	if watcher.settings.Sftp != nil {
+		return fmt.Sprintf("sftp://%s@%s%s", watcher.settings.Sftp.Username, watcher.settings.Sftp.Address, watcher.settings.Path)
+	}
+	return watcher.settings.Path
+}
+
+func (watcher *Watcher) watch(ctx context.Context) {
+	defer watcher.stopped.Done()
+	ticker := time.NewTicker(watcher.interval)
+	defer ticker.Stop()
+	for {
+		watcher.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll processes files of the pattern unchanged since the previous poll, files still being written wait for the next one.
+func (watcher *Watcher) poll(ctx context.Context) {
+	entries, err := watcher.source.list()
+	if err != nil {
+		logger.Error(fmt.Sprintf("[XServer] [%s Watcher] [Error] failed list %s: %s", watcher.name, watcher.location(), err))
+		metrics.Inc("xserver_watcher_errors_total", "watcher", watcher.name)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modified.Before(entries[j].modified) })
+
+	current := map[string]entry{}
+	for _, file := range entries {
+		if matched, _ := filepath.Match(watcher.settings.Pattern, file.name); !matched {
+			continue
+		}
+		current[file.name] = file
+		if done, ok := watcher.done[file.name]; ok && done == file {
+			continue
+		}
+		if pending, ok := watcher.pending[file.name]; !ok || pending != file {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		watcher.process(ctx, file)
+	}
+	for name := range watcher.done {
+		if _, ok := current[name]; !ok {
+			delete(watcher.done, name)
+		}
+	}
+	watcher.pending = current
+}
+
+// process runs the unit with the file, failed files are moved to failed_to or retried after they are modified.
+func (watcher *Watcher) process(ctx context.Context, file entry) {
+	err := watcher.runFile(ctx, file)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf(`[XServer] [%s Watcher] [Error] failed process "%s": %s`, watcher.name, file.name, err))
+		metrics.Inc("xserver_watcher_files_total", "watcher", watcher.name, "result", "failed")
+		if watcher.settings.FailedTo == "" {
+			watcher.done[file.name] = file
+			return
+		}
+		if err := watcher.source.move(file.name, watcher.settings.FailedTo); err != nil {
+			logger.Error(fmt.Sprintf(`[XServer] [%s Watcher] [Error] failed move "%s" to %s: %s`, watcher.name, file.name, watcher.settings.FailedTo, err))
+			watcher.done[file.name] = file
+		}
+		return
+	}
+
+	logger.Verbose(fmt.Sprintf(`[XServer] [%s Watcher] "%s" processed`, watcher.name, file.name))
+	metrics.Inc("xserver_watcher_files_total", "watcher", watcher.name, "result", "processed")
+	switch watcher.settings.After {
+	case config.WatcherDelete:
+		err = watcher.source.remove(file.name)
+	case config.WatcherMove:
+		err = watcher.source.move(file.name, watcher.settings.MoveTo)
+	default:
+		watcher.done[file.name] = file
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf(`[XServer] [%s Watcher] [Error] failed %s "%s": %s`, watcher.name, watcher.settings.After, file.name, err))
+		watcher.done[file.name] = file
+	}
+}
+
+func (watcher *Watcher) runFile(ctx context.Context, file entry) error {
+	path, cleanup, err := watcher.source.fetch(file.name)
+	if err != nil {
+		return fmt.Errorf("failed fetch file: %s", err)
+	}
+	defer cleanup()
+
+	var input io.Reader
+	if watcher.settings.Content {
+		content, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed open file: %s", err)
+		}
+		defer content.Close()
+		input = content
+	}
+	return watcher.run(ctx, File{Watcher: watcher.name, Name: file.name, Path: path, Size: file.size, Modified: file.modified}, input)
+}
+
+// local is the directory of the server filesystem, relative move targets are directories of the watched one.
+type local struct {
+	path string
+}
+
+func (local *local) list() ([]entry, error) {
+	files, err := os.ReadDir(local.path)
+	if err != nil {
+		return nil, err
+	}
+	result := []entry{}
+	for _, file := range files {
+		if !file.Type().IsRegular() {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		result = append(result, entry{name: file.Name(), size: info.Size(), modified: info.ModTime()})
+	}
+	return result, nil
+}
+
+func (local *local) fetch(name string) (string, func(), error) {
+	path, err := filepath.Abs(filepath.Join(local.path, name))
+	return path, func() {}, err
+}
+
+func (local *local) remove(name string) error {
+	return os.Remove(filepath.Join(local.path, name))
+}
+
+func (local *local) move(name string, directory string) error {
+	if !filepath.IsAbs(directory) {
+		directory = filepath.Join(local.path, directory)
+	}
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(local.path, name), filepath.Join(directory, name))
+}
+
+func (local *local) close() {}
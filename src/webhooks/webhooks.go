@@ -0,0 +1,232 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/logger"
+)
+
+const (
+	maxDeliveries = 1000
+
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+type Delivery struct {
+	Id          string     `json:"id"`
+	Webhook     string     `json:"webhook"`
+	Event       string     `json:"event"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastCode    int        `json:"last_code,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+type Event struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type Webhooks struct {
+	config     map[string]config.Webhook
+	client     *http.Client
+	mutex      sync.Mutex
+	deliveries map[string]*Delivery
+	order      []string
+}
+
+func Create(config *config.Config) *Webhooks {
+	return &Webhooks{
+		config:     config.Webhooks,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		deliveries: map[string]*Delivery{},
+		order:      []string{},
+	}
+}
+
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newDeliveryId() string {
+	data := make([]byte, 8)
+	if _, err := rand.Read(data); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(data)
+}
+
+func subscribed(webhook config.Webhook, event string) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, webhookEvent := range webhook.Events {
+		if webhookEvent == "*" || webhookEvent == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (webhooks *Webhooks) store(delivery *Delivery) {
+	webhooks.mutex.Lock()
+	defer webhooks.mutex.Unlock()
+
+	webhooks.deliveries[delivery.Id] = delivery
+	webhooks.order = append(webhooks.order, delivery.Id)
+	if len(webhooks.order) > maxDeliveries {
+		delete(webhooks.deliveries, webhooks.order[0])
+		webhooks.order = webhooks.order[1:]
+	}
+}
+
+func (webhooks *Webhooks) update(delivery *Delivery, update func(delivery *Delivery)) {
+	webhooks.mutex.Lock()
+	defer webhooks.mutex.Unlock()
+	update(delivery)
+}
+
+func (webhooks *Webhooks) Fire(event string, data []byte) []string {
+	if len(data) == 0 || !json.Valid(data) {
+		encoded, _ := json.Marshal(string(data))
+		data = encoded
+	}
+
+	body, err := json.Marshal(Event{Event: event, Data: data})
+	if err != nil {
+		logger.Error(fmt.Sprintf("[XServer] [Webhooks] [Error] failed encode event %s: %s", event, err))
+		return nil
+	}
+
+	names := []string{}
+	for name := range webhooks.config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ids := []string{}
+	for _, name := range names {
+		webhook := webhooks.config[name]
+		if !subscribed(webhook, event) {
+			continue
+		}
+
+		delivery := &Delivery{
+			Id:        newDeliveryId(),
+			Webhook:   name,
+			Event:     event,
+			Status:    StatusPending,
+			CreatedAt: time.Now(),
+		}
+		webhooks.store(delivery)
+		ids = append(ids, delivery.Id)
+
+		go webhooks.deliver(name, webhook, delivery, body)
+	}
+
+	return ids
+}
+
+func (webhooks *Webhooks) send(webhook config.Webhook, delivery *Delivery, body []byte) (int, error) {
+	request, err := http.NewRequest(http.MethodPost, webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-XServer-Event", delivery.Event)
+	request.Header.Set("X-XServer-Delivery", delivery.Id)
+	if webhook.Secret != "" {
+		request.Header.Set("X-XServer-Signature", Sign(webhook.Secret, body))
+	}
+
+	response, err := webhooks.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("unexpected status code %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+func (webhooks *Webhooks) deliver(name string, webhook config.Webhook, delivery *Delivery, body []byte) {
+	backoff, err := time.ParseDuration(webhook.Backoff)
+	if err != nil {
+		backoff = time.Second
+	}
+
+	retries := 0
+	if webhook.Retries != nil {
+		retries = *webhook.Retries
+	}
+
+	var lastError error
+	for attempt := 1; attempt <= retries+1; attempt++ {
+		code, err := webhooks.send(webhook, delivery, body)
+		if err == nil {
+			webhooks.update(delivery, func(delivery *Delivery) {
+				delivery.Attempts = attempt
+				delivery.LastCode = code
+				delivery.Status = StatusDelivered
+				deliveredAt := time.Now()
+				delivery.DeliveredAt = &deliveredAt
+			})
+			logger.Verbose(fmt.Sprintf(`[XServer] [Webhooks] delivered "%s" event to "%s" webhook`, delivery.Event, name))
+			return
+		}
+
+		lastError = err
+		webhooks.update(delivery, func(delivery *Delivery) {
+			delivery.Attempts = attempt
+			delivery.LastCode = code
+			delivery.LastError = err.Error()
+		})
+		logger.Debug(fmt.Sprintf(`[XServer] [Webhooks] attempt %d of "%s" event to "%s" webhook failed: %s`, attempt, delivery.Event, name, err))
+
+		if attempt <= retries {
+			time.Sleep(backoff)
+			backoff = backoff * 2
+		}
+	}
+
+	webhooks.update(delivery, func(delivery *Delivery) {
+		delivery.Status = StatusFailed
+	})
+	logger.Error(fmt.Sprintf(`[XServer] [Webhooks] [Error] failed deliver "%s" event to "%s" webhook: %s`, delivery.Event, name, lastError))
+}
+
+func (webhooks *Webhooks) Deliveries(id string) []Delivery {
+	webhooks.mutex.Lock()
+	defer webhooks.mutex.Unlock()
+
+	result := []Delivery{}
+	if id != "" {
+		if delivery, ok := webhooks.deliveries[id]; ok {
+			result = append(result, *delivery)
+		}
+		return result
+	}
+
+	for _, deliveryId := range webhooks.order {
+		result = append(result, *webhooks.deliveries[deliveryId])
+	}
+	return result
+}
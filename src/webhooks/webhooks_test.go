@@ -0,0 +1,97 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"xserver/src/config"
+)
+
+func retries(count int) *int {
+	return &count
+}
+
+// waitDelivery waits until the delivery is not pending.
+func waitDelivery(t *testing.T, webhooks *Webhooks, id string) Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if deliveries := webhooks.Deliveries(id); len(deliveries) == 1 && deliveries[0].Status != StatusPending {
+			return deliveries[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("delivery %s is pending", id)
+	return Delivery{}
+}
+
+func TestFire(t *testing.T) {
+	var received atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		if request.Header.Get("X-XServer-Signature") != Sign("secret", body) {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		received.Store(body)
+	}))
+	defer server.Close()
+
+	webhooks := Create(&config.Config{Webhooks: map[string]config.Webhook{
+		"subscribed": {Url: server.URL, Secret: "secret", Events: []string{"db.insert"}, Retries: retries(0)},
+		"other":      {Url: server.URL, Events: []string{"task.failed"}, Retries: retries(0)},
+	}})
+	ids := webhooks.Fire("db.insert", []byte(`{"table":"Users"}`))
+	if len(ids) != 1 {
+		t.Fatalf("expected delivery to the subscribed webhook only, got %d", len(ids))
+	}
+
+	delivery := waitDelivery(t, webhooks, ids[0])
+	if delivery.Status != StatusDelivered || delivery.Webhook != "subscribed" || delivery.Attempts != 1 {
+		t.Fatalf("unexpected delivery %+v", delivery)
+	}
+	event := Event{}
+	if err := json.Unmarshal(received.Load().([]byte), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Event != "db.insert" || string(event.Data) != `{"table":"Users"}` {
+		t.Fatalf("unexpected event %s %s", event.Event, event.Data)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		retries  int
+		attempts int
+	}{
+		{name: "without retries", retries: 0, attempts: 1},
+		{name: "retries", retries: 2, attempts: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := int32(0)
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				writer.WriteHeader(http.StatusInternalServerError)
+			}))
+			defer server.Close()
+
+			webhooks := Create(&config.Config{Webhooks: map[string]config.Webhook{
+				"failing": {Url: server.URL, Retries: retries(test.retries), Backoff: "1ms"},
+			}})
+			ids := webhooks.Fire("task.failed", []byte("failed"))
+			delivery := waitDelivery(t, webhooks, ids[0])
+			if delivery.Status != StatusFailed || delivery.Attempts != test.attempts || delivery.LastCode != http.StatusInternalServerError {
+				t.Fatalf("unexpected delivery %+v", delivery)
+			}
+			if int(atomic.LoadInt32(&requests)) != test.attempts {
+				t.Fatalf("expected %d requests, got %d", test.attempts, requests)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"xserver/src/config"
+	"xserver/src/metrics"
+)
+
+var (
+	ErrQueueFull    = errors.New("workers queue is full")
+	ErrQueueTimeout = errors.New("workers queue wait timeout")
+)
+
+type Pool struct {
+	slots        chan struct{}
+	mutex        sync.Mutex
+	queued       int
+	maxQueue     int
+	queueTimeout time.Duration
+}
+
+func init() {
+	metrics.Register("xserver_workers_active", metrics.GaugeType, "Number of running handler processes.")
+	metrics.Register("xserver_workers_queued", metrics.GaugeType, "Number of requests waiting for a free worker.")
+	metrics.Register("xserver_workers_rejected_total", metrics.CounterType, "Number of requests rejected because all workers are busy.")
+}
+
+func Create(config *config.Workers) (*Pool, error) {
+	if config.MaxProcesses <= 0 {
+		return nil, nil
+	}
+
+	queueTimeout, err := time.ParseDuration(config.QueueTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Pool{
+		slots:        make(chan struct{}, config.MaxProcesses),
+		maxQueue:     config.MaxQueue,
+		queueTimeout: queueTimeout,
+	}, nil
+}
+
+func (pool *Pool) release() {
+	<-pool.slots
+	metrics.Set("xserver_workers_active", float64(len(pool.slots)))
+}
+
+func (pool *Pool) Acquire(ctx context.Context) (func(), error) {
+	if pool == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case pool.slots <- struct{}{}:
+		metrics.Set("xserver_workers_active", float64(len(pool.slots)))
+		return pool.release, nil
+	default:
+	}
+
+	pool.mutex.Lock()
+	if pool.queued >= pool.maxQueue {
+		pool.mutex.Unlock()
+		metrics.Inc("xserver_workers_rejected_total")
+		return nil, ErrQueueFull
+	}
+	pool.queued++
+	metrics.Set("xserver_workers_queued", float64(pool.queued))
+	pool.mutex.Unlock()
+
+	defer func() {
+		pool.mutex.Lock()
+		pool.queued--
+		metrics.Set("xserver_workers_queued", float64(pool.queued))
+		pool.mutex.Unlock()
+	}()
+
+	timer := time.NewTimer(pool.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case pool.slots <- struct{}{}:
+		metrics.Set("xserver_workers_active", float64(len(pool.slots)))
+		return pool.release, nil
+	case <-timer.C:
+		metrics.Inc("xserver_workers_rejected_total")
+		return nil, ErrQueueTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
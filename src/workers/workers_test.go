@@ -0,0 +1,75 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"xserver/src/config"
+)
+
+func TestAcquire(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings config.Workers
+		ctx      func() (context.Context, context.CancelFunc)
+		released bool
+		err      error
+	}{
+		{name: "queue full", settings: config.Workers{MaxProcesses: 1, MaxQueue: 0, QueueTimeout: "1s"}, err: ErrQueueFull},
+		{name: "queue timeout", settings: config.Workers{MaxProcesses: 1, MaxQueue: 1, QueueTimeout: "10ms"}, err: ErrQueueTimeout},
+		{name: "released", settings: config.Workers{MaxProcesses: 1, MaxQueue: 1, QueueTimeout: "1s"}, released: true},
+		{
+			name:     "cancelled",
+			settings: config.Workers{MaxProcesses: 1, MaxQueue: 1, QueueTimeout: "1s"},
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			err: context.DeadlineExceeded,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pool, err := Create(&test.settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			release, err := pool.Acquire(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.released {
+				time.AfterFunc(10*time.Millisecond, release)
+			}
+
+			ctx, cancel := context.Background(), context.CancelFunc(func() {})
+			if test.ctx != nil {
+				ctx, cancel = test.ctx()
+			}
+			defer cancel()
+			second, err := pool.Acquire(ctx)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			if err == nil {
+				second()
+			}
+		})
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	pool, err := Create(&config.Workers{})
+	if err != nil || pool != nil {
+		t.Fatalf("pool without max processes must be nil, got %v %v", pool, err)
+	}
+	release, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	if _, err := Create(&config.Workers{MaxProcesses: 1, QueueTimeout: "unknown"}); err == nil {
+		t.Fatal("invalid queue timeout must be rejected")
+	}
+}